@@ -0,0 +1,44 @@
+// Command integration runs the end-to-end scenarios of pkg/testenv against a
+// throwaway Postgres database and Redis server:
+//
+//	go run ./cmd/integration
+//
+// It exits with status 1 when a scenario fails and skips, with status 0, when
+// neither local binaries nor docker-compose.test.yml services are available.
+package main
+
+import (
+	"bank_system/pkg/testenv"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func main() {
+	logger := log.Default()
+	gin.SetMode(gin.ReleaseMode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	env, err := testenv.Start(ctx, logger)
+	if errors.Is(err, testenv.ErrUnavailable) {
+		logger.Printf("Skipping integration tests: %v\n", err)
+		return
+	}
+	if err != nil {
+		logger.Fatalf("Failed to start the test environment: %v\n", err)
+	}
+
+	err = env.RunAll(ctx)
+	env.Close()
+	if err != nil {
+		logger.Printf("Integration tests failed:\n%v\n", err)
+		os.Exit(1)
+	}
+	logger.Printf("Integration tests passed\n")
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bank_system/server"
+	"os"
 
 	"github.com/spf13/viper"
 )
@@ -24,6 +25,13 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	server, err := server.NewServer()
 	if err != nil {
 		panic(err)
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bank_system/postgres"
+	"bank_system/server"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/viper"
+)
+
+const migrateUsage = "usage: bank_system_app migrate up | down [steps] | status | to <version>"
+
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	ctx := context.Background()
+
+	pool, err := server.SetPGConn(ctx, viper.GetString("postgres.connection_string"))
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	migrator, err := postgres.NewMigrator(pool, log.Default())
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		return migrator.Down(ctx, steps)
+	case "to":
+		if len(args) < 2 {
+			return errors.New(migrateUsage)
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		return migrator.To(ctx, version)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT\tSTATE")
+		for _, s := range statuses {
+			appliedAt, state := "-", "pending"
+			if s.Applied {
+				state = "applied"
+				if s.AppliedAt != nil {
+					appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+				}
+			}
+			if s.Modified {
+				state = "modified"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, appliedAt, state)
+		}
+		return w.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+}
@@ -0,0 +1,76 @@
+package account
+
+import (
+	"bank_system/utils"
+	"context"
+	"fmt"
+)
+
+// BatchTransfer is one of the transfers of TransferBatch, to an account in
+// the currency of the sender. The service looks ToAccountID up from
+// ToIDNumber before it hands the batch to the repository.
+type BatchTransfer struct {
+	ToIDNumber  string
+	ToAccountID int64
+	Amount      float64
+	Detail      string
+}
+
+// TransferBatch makes every transfer from the account idNumber, or none of
+// them, and returns the transaction ids in the order of transfers and the
+// sender's new balance.
+func (s *AccountService) TransferBatch(
+	ctx context.Context, idNumber string, transfers []BatchTransfer,
+) ([]int64, float64, error) {
+	from, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := 0.0
+	verr := &utils.ValidationError{}
+	for i, transfer := range transfers {
+		lineErr := &utils.ValidationError{}
+		utils.ValidateAmount(lineErr, transfer.Amount, from.CurrencyCode)
+		utils.ValidateDetail(lineErr, transfer.Detail)
+		for _, field := range lineErr.Fields {
+			verr.Add(fmt.Sprintf("transfers[%d].%s", i, field.Field), field.Message)
+		}
+		total += transfer.Amount
+	}
+	if len(transfers) == 0 {
+		verr.Add("transfers", "is required")
+	}
+	if err := verr.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	resolved := make([]BatchTransfer, len(transfers))
+	for i, transfer := range transfers {
+		to, err := s.getAccount(ctx, transfer.ToIDNumber)
+		if err != nil {
+			return nil, 0, err
+		}
+		if to.ID == from.ID {
+			return nil, 0, utils.NewBankSystemError(utils.ErrSameAccountTransfer, idNumber)
+		}
+		if to.CurrencyCode != from.CurrencyCode {
+			return nil, 0, utils.NewBankSystemError(utils.ErrCurrencyMismatch, from.CurrencyCode, to.CurrencyCode)
+		}
+		transfer.ToAccountID = to.ID
+		resolved[i] = transfer
+	}
+	if err := s.checkAvailable(ctx, idNumber, total); err != nil {
+		return nil, 0, err
+	}
+
+	txIDs, balance, err := s.repo.TransferBatch(ctx, from.ID, resolved)
+	if err != nil {
+		return nil, 0, err
+	}
+	s.notifyOverdraft(ctx, from.ID, balance+total, balance)
+	for _, transfer := range resolved {
+		s.notifyOverdraftCredit(ctx, transfer.ToAccountID, transfer.ToIDNumber, transfer.Amount)
+	}
+	return txIDs, balance, nil
+}
@@ -0,0 +1,251 @@
+package account
+
+import (
+	"bank_system/postgres/sqlc"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultCacheTTL = 30 * time.Second
+
+var cacheMetrics = expvar.NewMap("account_cache")
+
+// setIfCurrentScript caches an account row only if the account's version is
+// still the one read before the database was, that is no write invalidated
+// the account in between.
+var setIfCurrentScript = redis.NewScript(`
+if (redis.call('GET', KEYS[1]) or '0') ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[2], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// cachedAccountRepository is a read-through cache in front of an
+// AccountRepository. Accounts are cached by id_number, together with the
+// id <-> id_number mapping so that writes addressed by id can invalidate them.
+// Every invalidation bumps the account's version, and a miss only fills the
+// cache if the version did not change while it read the database. Redis
+// failures are logged and the call falls back to the wrapped repository.
+type cachedAccountRepository struct {
+	AccountRepository
+	client *redis.Client
+	ttl    time.Duration
+	logger *log.Logger
+}
+
+func NewCachedAccountRepository(
+	repo AccountRepository, client *redis.Client, ttl time.Duration, logger *log.Logger,
+) AccountRepository {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+
+	return &cachedAccountRepository{
+		AccountRepository: repo,
+		client:            client,
+		ttl:               ttl,
+		logger:            logger,
+	}
+}
+
+func (r *cachedAccountRepository) GetAccountByIDNumber(
+	ctx context.Context, idNumber string,
+) (sqlc.GetAccountByIDNumberRow, error) {
+	var account sqlc.GetAccountByIDNumberRow
+
+	data, err := r.client.Get(ctx, accountKey(idNumber)).Bytes()
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &account); err == nil {
+			cacheMetrics.Add("hits", 1)
+			return account, nil
+		}
+		cacheMetrics.Add("errors", 1)
+	case errors.Is(err, redis.Nil):
+	default:
+		cacheMetrics.Add("errors", 1)
+		r.logger.Printf("account cache: get %s failed: %v\n", idNumber, err)
+	}
+	cacheMetrics.Add("misses", 1)
+
+	version, known := r.version(ctx, idNumber)
+
+	account, err = r.AccountRepository.GetAccountByIDNumber(ctx, idNumber)
+	if err != nil {
+		return account, err
+	}
+
+	if !known {
+		// The id and id_number of an account never change, so the mapping
+		// does not expire; the row is cached on the next miss.
+		pipe := r.client.TxPipeline()
+		pipe.Set(ctx, accountIDKey(account.ID), idNumber, 0)
+		pipe.Set(ctx, accountIDNumberKey(idNumber), account.ID, 0)
+		if _, err := pipe.Exec(ctx); err != nil {
+			cacheMetrics.Add("errors", 1)
+			r.logger.Printf("account cache: map %s failed: %v\n", idNumber, err)
+		}
+		return account, nil
+	}
+
+	if data, err := json.Marshal(account); err == nil {
+		keys := []string{accountVersionKey(account.ID), accountKey(idNumber)}
+		set, err := setIfCurrentScript.Run(ctx, r.client, keys, version, data, r.ttl.Milliseconds()).Int()
+		switch {
+		case err != nil:
+			cacheMetrics.Add("errors", 1)
+			r.logger.Printf("account cache: set %s failed: %v\n", idNumber, err)
+		case set == 0:
+			cacheMetrics.Add("stale", 1)
+		}
+	}
+
+	return account, nil
+}
+
+// version returns the version of the account before it is read from the
+// database, false when the account's id is not known yet.
+func (r *cachedAccountRepository) version(ctx context.Context, idNumber string) (string, bool) {
+	id, err := r.client.Get(ctx, accountIDNumberKey(idNumber)).Int64()
+	if err == nil {
+		var version string
+		version, err = r.client.Get(ctx, accountVersionKey(id)).Result()
+		if errors.Is(err, redis.Nil) {
+			return "0", true
+		}
+		if err == nil {
+			return version, true
+		}
+	}
+	if !errors.Is(err, redis.Nil) {
+		cacheMetrics.Add("errors", 1)
+		r.logger.Printf("account cache: version %s failed: %v\n", idNumber, err)
+	}
+	return "", false
+}
+
+func (r *cachedAccountRepository) WithdrawFromAccount(
+	ctx context.Context, accountID int64, amount float64, detail string,
+) (int64, float64, error) {
+	defer r.invalidate(ctx, accountID)
+	return r.AccountRepository.WithdrawFromAccount(ctx, accountID, amount, detail)
+}
+
+func (r *cachedAccountRepository) DepositToAccount(
+	ctx context.Context, accountID int64, amount float64, detail string,
+) (int64, float64, error) {
+	defer r.invalidate(ctx, accountID)
+	return r.AccountRepository.DepositToAccount(ctx, accountID, amount, detail)
+}
+
+func (r *cachedAccountRepository) TransferBetweenAccounts(
+	ctx context.Context, fromAccountID, toAccountID int64, amount float64, detail string,
+) (int64, float64, error) {
+	defer r.invalidate(ctx, fromAccountID, toAccountID)
+	return r.AccountRepository.TransferBetweenAccounts(ctx, fromAccountID, toAccountID, amount, detail)
+}
+
+func (r *cachedAccountRepository) TransferFX(
+	ctx context.Context, fromAccountID, toAccountID int64, amount float64, quoteID, detail string,
+) (int64, float64, float64, error) {
+	defer r.invalidate(ctx, fromAccountID, toAccountID)
+	return r.AccountRepository.TransferFX(ctx, fromAccountID, toAccountID, amount, quoteID, detail)
+}
+
+func (r *cachedAccountRepository) TransferBatch(
+	ctx context.Context, fromAccountID int64, transfers []BatchTransfer,
+) ([]int64, float64, error) {
+	accountIDs := []int64{fromAccountID}
+	for _, transfer := range transfers {
+		accountIDs = append(accountIDs, transfer.ToAccountID)
+	}
+	defer r.invalidate(ctx, accountIDs...)
+	return r.AccountRepository.TransferBatch(ctx, fromAccountID, transfers)
+}
+
+func (r *cachedAccountRepository) UpdateAccountStatus(ctx context.Context, idNumber, status string) error {
+	defer r.invalidateIDNumber(ctx, idNumber)
+	return r.AccountRepository.UpdateAccountStatus(ctx, idNumber, status)
+}
+
+func (r *cachedAccountRepository) CaptureHold(
+	ctx context.Context, accountID, holdID int64, amount float64, toAccountID int64,
+) (int64, float64, error) {
+	defer r.invalidate(ctx, accountID, toAccountID)
+	return r.AccountRepository.CaptureHold(ctx, accountID, holdID, amount, toAccountID)
+}
+
+func (r *cachedAccountRepository) PostOverdraftCharges(ctx context.Context, date time.Time) ([]int64, error) {
+	charged, err := r.AccountRepository.PostOverdraftCharges(ctx, date)
+	r.invalidate(ctx, charged...)
+	return charged, err
+}
+
+// invalidate is also run when the write fails, since a failed commit may
+// still have raced with a successful one. It runs after the write committed,
+// so a miss that read the database before it sees the version change.
+func (r *cachedAccountRepository) invalidate(ctx context.Context, accountIDs ...int64) {
+	for _, id := range accountIDs {
+		if err := r.client.Incr(ctx, accountVersionKey(id)).Err(); err != nil {
+			cacheMetrics.Add("errors", 1)
+			r.logger.Printf("account cache: invalidate %d failed: %v\n", id, err)
+		}
+		idNumber, err := r.client.Get(ctx, accountIDKey(id)).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			cacheMetrics.Add("errors", 1)
+			r.logger.Printf("account cache: invalidate %d failed: %v\n", id, err)
+			continue
+		}
+		r.deleteIDNumber(ctx, idNumber)
+	}
+}
+
+func (r *cachedAccountRepository) invalidateIDNumber(ctx context.Context, idNumber string) {
+	id, err := r.client.Get(ctx, accountIDNumberKey(idNumber)).Int64()
+	switch {
+	case err == nil:
+		r.invalidate(ctx, id)
+		return
+	case !errors.Is(err, redis.Nil):
+		cacheMetrics.Add("errors", 1)
+		r.logger.Printf("account cache: invalidate %s failed: %v\n", idNumber, err)
+	}
+	// Without a mapping no miss can cache the row, see version.
+	r.deleteIDNumber(ctx, idNumber)
+}
+
+func (r *cachedAccountRepository) deleteIDNumber(ctx context.Context, idNumber string) {
+	if err := r.client.Del(ctx, accountKey(idNumber)).Err(); err != nil {
+		cacheMetrics.Add("errors", 1)
+		r.logger.Printf("account cache: invalidate %s failed: %v\n", idNumber, err)
+		return
+	}
+	cacheMetrics.Add("invalidations", 1)
+}
+
+func accountKey(idNumber string) string {
+	return "account:" + idNumber
+}
+
+func accountIDKey(id int64) string {
+	return "account:id:" + strconv.FormatInt(id, 10)
+}
+
+func accountIDNumberKey(idNumber string) string {
+	return "account:id_number:" + idNumber
+}
+
+func accountVersionKey(id int64) string {
+	return "account:version:" + strconv.FormatInt(id, 10)
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -34,7 +35,11 @@ func (c *AccountController) CreateAccount(ctx *gin.Context) {
 	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
 	defer cancel()
 
-	account, err := c.service.CreateAccount(reqCtx, userID)
+	account, err := c.service.CreateAccount(reqCtx, userID, ctx.PostForm("currency_code"))
+	if utils.IsValidationError(err) {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -66,13 +71,17 @@ func (c *AccountController) GetAccountBalance(ctx *gin.Context) {
 	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
 	defer cancel()
 
-	balance, err := c.service.GetAccountBalance(reqCtx, idNumber)
+	account, err := c.service.GetAccountByIDNumber(reqCtx, idNumber)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"balance": balance})
+	ctx.JSON(http.StatusOK, gin.H{
+		"balance":       account.Balance,
+		"currency_code": account.CurrencyCode,
+		"formatted":     utils.FormatAmount(account.Balance, account.CurrencyCode),
+	})
 }
 
 func (c *AccountController) GetAllAccounts(ctx *gin.Context) {
@@ -105,7 +114,362 @@ func (c *AccountController) GetAccountTransactions(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, transactions)
 }
 
-func (c *AccountController) RegisterRoutes(router *gin.Engine) {
+func (c *AccountController) Deposit(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+
+	type DepositRequest struct {
+		Amount float64 `json:"amount" binding:"required"`
+		Detail string  `json:"detail"`
+	}
+
+	var req DepositRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	txID, balance, err := c.service.DepositByIDNumber(reqCtx, idNumber, req.Amount, req.Detail)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"transaction_id": txID, "balance": balance})
+}
+
+func (c *AccountController) Withdraw(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+
+	type WithdrawRequest struct {
+		Amount  float64 `json:"amount" binding:"required"`
+		Detail  string  `json:"detail"`
+		OTPCode string  `json:"otp_code"`
+	}
+
+	var req WithdrawRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	review, err := c.service.AuthorizeMovement(reqCtx, Movement{
+		Type:          MovementWithdrawal,
+		AccountNumber: idNumber,
+		Amount:        req.Amount,
+		Detail:        req.Detail,
+	}, req.OTPCode)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+	if review != nil {
+		ctx.JSON(http.StatusAccepted, review)
+		return
+	}
+
+	txID, balance, err := c.service.Withdraw(reqCtx, idNumber, req.Amount, req.Detail)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"transaction_id": txID, "balance": balance})
+}
+
+func (c *AccountController) Transfer(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+
+	type TransferRequest struct {
+		ToAccount string  `json:"to_account" binding:"required"`
+		Amount    float64 `json:"amount" binding:"required"`
+		Detail    string  `json:"detail"`
+		OTPCode   string  `json:"otp_code"`
+		QuoteID   string  `json:"quote_id"`
+	}
+
+	var req TransferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	review, err := c.service.AuthorizeMovement(reqCtx, Movement{
+		Type:            MovementTransfer,
+		AccountNumber:   idNumber,
+		Amount:          req.Amount,
+		Detail:          req.Detail,
+		ToAccountNumber: req.ToAccount,
+	}, req.OTPCode)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+	if review != nil {
+		ctx.JSON(http.StatusAccepted, review)
+		return
+	}
+
+	txID, balance, conversion, err := c.service.TransferWithQuote(
+		reqCtx, idNumber, req.ToAccount, req.Amount, req.Detail, req.QuoteID,
+	)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	response := gin.H{"transaction_id": txID, "balance": balance}
+	if conversion != nil {
+		response["conversion"] = conversion
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (c *AccountController) UpdateAccountStatus(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+
+	type UpdateStatusRequest struct {
+		Status string `json:"status" binding:"required"`
+	}
+
+	var req UpdateStatusRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	if err := c.service.UpdateAccountStatus(reqCtx, idNumber, req.Status); err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Account status updated successfully"})
+}
+
+func (c *AccountController) GetAccountBalances(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	balances, err := c.service.GetAccountBalances(reqCtx, idNumber)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, balances)
+}
+
+func (c *AccountController) PlaceHold(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+
+	type PlaceHoldRequest struct {
+		Amount           float64 `json:"amount" binding:"required"`
+		Detail           string  `json:"detail"`
+		ExpiresInSeconds int64   `json:"expires_in_seconds"`
+		OTPCode          string  `json:"otp_code"`
+	}
+
+	var req PlaceHoldRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	if err := c.service.AuthorizeStepUp(reqCtx, idNumber, req.Amount, req.OTPCode); err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	hold, err := c.service.PlaceHold(reqCtx, idNumber, req.Amount, req.Detail, time.Duration(req.ExpiresInSeconds)*time.Second)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, hold)
+}
+
+func (c *AccountController) GetAccountHolds(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	holds, err := c.service.GetAccountHolds(reqCtx, idNumber)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, holds)
+}
+
+func (c *AccountController) CaptureHold(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+	holdID, err := strconv.ParseInt(ctx.Param("hold_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Amount 0 captures the whole hold, ToAccount turns it into a transfer.
+	type CaptureHoldRequest struct {
+		Amount    float64 `json:"amount"`
+		ToAccount string  `json:"to_account"`
+		OTPCode   string  `json:"otp_code"`
+	}
+
+	var req CaptureHoldRequest
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+			return
+		}
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	review, err := c.service.AuthorizeCapture(reqCtx, idNumber, holdID, req.Amount, req.ToAccount, req.OTPCode)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+	if review != nil {
+		ctx.JSON(http.StatusAccepted, review)
+		return
+	}
+
+	txID, balance, err := c.service.CaptureHold(reqCtx, idNumber, holdID, req.Amount, req.ToAccount)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"transaction_id": txID, "balance": balance})
+}
+
+func (c *AccountController) ReleaseHold(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+	holdID, err := strconv.ParseInt(ctx.Param("hold_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	available, err := c.service.ReleaseHold(reqCtx, idNumber, holdID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"available": available})
+}
+
+func (c *AccountController) GetOverdraft(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	overdraft, err := c.service.GetOverdraft(reqCtx, idNumber)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, overdraft)
+}
+
+func (c *AccountController) UpdateOverdraft(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+
+	var req Overdraft
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	if err := c.service.UpdateOverdraft(reqCtx, idNumber, req); err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Overdraft updated successfully"})
+}
+
+func errorStatus(err error) int {
+	switch {
+	case utils.IsValidationError(err):
+		return http.StatusBadRequest
+	case utils.IsBankSystemError(err, utils.ErrOTPRequired),
+		utils.IsBankSystemError(err, utils.ErrInvalidOTP):
+		return http.StatusUnauthorized
+	case utils.IsBankSystemError(err, utils.ErrTOTPNotEnabled),
+		utils.IsBankSystemError(err, utils.ErrPayeeCoolingOff),
+		utils.IsBankSystemError(err, utils.ErrPayeeRequired),
+		utils.IsBankSystemError(err, utils.ErrTransactionBlocked):
+		return http.StatusForbidden
+	case utils.IsBankSystemError(err, utils.ErrAccountNotFound),
+		utils.IsBankSystemError(err, utils.ErrHoldNotFound),
+		utils.IsBankSystemError(err, utils.ErrQuoteNotFound):
+		return http.StatusNotFound
+	case utils.IsBankSystemError(err, utils.ErrHoldNotActive),
+		utils.IsBankSystemError(err, utils.ErrOverdraftLimitInUse),
+		utils.IsBankSystemError(err, utils.ErrQuoteExpired):
+		return http.StatusConflict
+	case utils.IsBankSystemError(err, utils.ErrSameAccountTransfer),
+		utils.IsBankSystemError(err, utils.ErrCurrencyMismatch):
+		return http.StatusBadRequest
+	case utils.IsBankSystemError(err, utils.ErrRateUnavailable):
+		return http.StatusServiceUnavailable
+	case utils.IsBankSystemError(err, utils.ErrInsufficientBalance),
+		utils.IsBankSystemError(err, utils.ErrInvalidCaptureAmount),
+		utils.IsBankSystemError(err, utils.ErrLimitExceeded):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RegisterRoutes serves the routes that move money, place or settle holds
+// and show the holds and balances only to the owner of the account, behind
+// the owner middleware, the status to the owner or the admin, behind
+// ownerOrAdmin, and the overdraft terms only behind the admin middleware.
+func (c *AccountController) RegisterRoutes(router *gin.Engine, owner, ownerOrAdmin, admin gin.HandlerFunc) {
 	group := router.Group("/accounts")
 	{
 		group.POST("", c.CreateAccount)
@@ -113,5 +477,16 @@ func (c *AccountController) RegisterRoutes(router *gin.Engine) {
 		group.GET("/:id_number/balance", c.GetAccountBalance)
 		group.GET("", c.GetAllAccounts)
 		group.GET("/:id_number/transactions", c.GetAccountTransactions)
+		group.POST("/:id_number/deposit", owner, c.Deposit)
+		group.POST("/:id_number/withdraw", owner, c.Withdraw)
+		group.POST("/:id_number/transfer", owner, c.Transfer)
+		group.PUT("/:id_number/status", ownerOrAdmin, c.UpdateAccountStatus)
+		group.GET("/:id_number/balances", owner, c.GetAccountBalances)
+		group.GET("/:id_number/holds", owner, c.GetAccountHolds)
+		group.POST("/:id_number/holds", owner, c.PlaceHold)
+		group.POST("/:id_number/holds/:hold_id/capture", owner, c.CaptureHold)
+		group.POST("/:id_number/holds/:hold_id/release", owner, c.ReleaseHold)
+		group.GET("/:id_number/overdraft", c.GetOverdraft)
+		group.PUT("/:id_number/overdraft", admin, c.UpdateOverdraft)
 	}
 }
@@ -0,0 +1,106 @@
+package account
+
+import (
+	"bank_system/pkg/fx"
+	"bank_system/utils"
+	"context"
+	"time"
+)
+
+// Quoter locks exchange rates for transfers between accounts in different
+// currencies, see fx.FXService.
+type Quoter interface {
+	Quote(ctx context.Context, from, to string) (fx.Quote, error)
+	GetQuote(ctx context.Context, id string) (fx.Quote, error)
+}
+
+// Conversion describes how a transfer between currencies was converted.
+type Conversion struct {
+	QuoteID         string  `json:"quote_id"`
+	FromCurrency    string  `json:"from_currency"`
+	ToCurrency      string  `json:"to_currency"`
+	Amount          float64 `json:"amount"`
+	ConvertedAmount float64 `json:"converted_amount"`
+	MidRate         float64 `json:"mid_rate"`
+	Rate            float64 `json:"rate"`
+	SpreadBps       int     `json:"spread_bps"`
+}
+
+// TransferWithQuote works like Transfer. Between accounts in different
+// currencies amount, in the sender's currency, is converted at the rate of
+// quoteID, or of a new quote when quoteID is empty, and the conversion is
+// returned; it is nil for transfers in one currency.
+func (s *AccountService) TransferWithQuote(
+	ctx context.Context, fromIDNumber, toIDNumber string, amount float64, detail, quoteID string,
+) (int64, float64, *Conversion, error) {
+	from, err := s.getAccount(ctx, fromIDNumber)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	to, err := s.getAccount(ctx, toIDNumber)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if err := validateMoneyOperation(amount, from.CurrencyCode, detail); err != nil {
+		return 0, 0, nil, err
+	}
+
+	if from.CurrencyCode == to.CurrencyCode {
+		if quoteID != "" {
+			verr := &utils.ValidationError{}
+			verr.Add("quote_id", "is only used between accounts in different currencies")
+			return 0, 0, nil, verr
+		}
+		if err := s.checkAvailable(ctx, fromIDNumber, amount); err != nil {
+			return 0, 0, nil, err
+		}
+
+		txID, balance, err := s.repo.TransferBetweenAccounts(ctx, from.ID, to.ID, amount, detail)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		s.notifyOverdraft(ctx, from.ID, balance+amount, balance)
+		s.notifyOverdraftCredit(ctx, to.ID, toIDNumber, amount)
+		return txID, balance, nil, nil
+	}
+
+	if s.fx == nil {
+		return 0, 0, nil, utils.NewBankSystemError(utils.ErrRateUnavailable, from.CurrencyCode+"/"+to.CurrencyCode)
+	}
+	var quote fx.Quote
+	if quoteID == "" {
+		quote, err = s.fx.Quote(ctx, from.CurrencyCode, to.CurrencyCode)
+	} else {
+		quote, err = s.fx.GetQuote(ctx, quoteID)
+	}
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if quote.FromCurrency != from.CurrencyCode || quote.ToCurrency != to.CurrencyCode {
+		return 0, 0, nil, utils.NewBankSystemError(utils.ErrCurrencyMismatch, quote.FromCurrency, quote.ToCurrency)
+	}
+	if !quote.Usable(time.Now()) {
+		return 0, 0, nil, utils.NewBankSystemError(utils.ErrQuoteExpired, quote.ID)
+	}
+	if err := s.checkAvailable(ctx, fromIDNumber, amount); err != nil {
+		return 0, 0, nil, err
+	}
+
+	txID, balance, converted, err := s.repo.TransferFX(ctx, from.ID, to.ID, amount, quote.ID, detail)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	s.notifyOverdraft(ctx, from.ID, balance+amount, balance)
+	s.notifyOverdraftCredit(ctx, to.ID, toIDNumber, converted)
+
+	return txID, balance, &Conversion{
+		QuoteID:         quote.ID,
+		FromCurrency:    quote.FromCurrency,
+		ToCurrency:      quote.ToCurrency,
+		Amount:          amount,
+		ConvertedAmount: converted,
+		MidRate:         quote.MidRate,
+		Rate:            quote.Rate,
+		SpreadBps:       quote.SpreadBps,
+	}, nil
+}
@@ -0,0 +1,228 @@
+package account
+
+import (
+	"bank_system/postgres/sqlc"
+	"bank_system/utils"
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	HoldActive   = "ACTIVE"
+	HoldCaptured = "CAPTURED"
+	HoldReleased = "RELEASED"
+	HoldExpired  = "EXPIRED"
+
+	DefaultHoldTTL = 7 * 24 * time.Hour
+	MaxHoldTTL     = 30 * 24 * time.Hour
+)
+
+// Hold reserves part of an account's balance until it is captured, released
+// or expires.
+type Hold struct {
+	ID             int64       `json:"id"`
+	AccountID      int64       `json:"account_id"`
+	Amount         float64     `json:"amount"`
+	CapturedAmount float64     `json:"captured_amount"`
+	Status         string      `json:"status"`
+	Detail         string      `json:"detail"`
+	TransactionID  pgtype.Int8 `json:"transaction_id"`
+	ExpiresAt      time.Time   `json:"expires_at"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+}
+
+// Balances splits an account's ledger balance into the part reserved by
+// active holds and the part still available for withdrawals and transfers,
+// which includes the overdraft limit.
+type Balances struct {
+	Ledger         float64 `json:"ledger"`
+	Held           float64 `json:"held"`
+	OverdraftLimit float64 `json:"overdraft_limit"`
+	Available      float64 `json:"available"`
+}
+
+func (s *AccountService) GetAccountBalances(ctx context.Context, idNumber string) (Balances, error) {
+	balances, err := s.repo.GetAccountBalances(ctx, idNumber)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Balances{}, utils.NewBankSystemError(utils.ErrAccountNotFound, idNumber)
+	}
+	return balances, err
+}
+
+// PlaceHold reserves amount of the available balance for ttl, DefaultHoldTTL
+// when ttl is 0.
+func (s *AccountService) PlaceHold(
+	ctx context.Context, idNumber string, amount float64, detail string, ttl time.Duration,
+) (Hold, error) {
+	account, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return Hold{}, err
+	}
+
+	if ttl == 0 {
+		ttl = DefaultHoldTTL
+	}
+	verr := &utils.ValidationError{}
+	utils.ValidateAmount(verr, amount, account.CurrencyCode)
+	utils.ValidateDetail(verr, detail)
+	if ttl < 0 || ttl > MaxHoldTTL {
+		verr.Add("expires_in_seconds", "must be positive and at most "+strconv.Itoa(int(MaxHoldTTL.Seconds())))
+	}
+	if err := verr.Err(); err != nil {
+		return Hold{}, err
+	}
+
+	if err := s.checkAvailable(ctx, idNumber, amount); err != nil {
+		return Hold{}, err
+	}
+
+	return s.repo.PlaceHold(ctx, account.ID, amount, detail, time.Now().Add(ttl))
+}
+
+func (s *AccountService) GetAccountHolds(ctx context.Context, idNumber string) ([]Hold, error) {
+	account, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetAccountHolds(ctx, account.ID)
+}
+
+// capture is a capture of a hold that was checked.
+type capture struct {
+	accountID   int64
+	hold        Hold
+	amount      float64
+	toAccountID int64
+}
+
+// AuthorizeCapture is AuthorizeMovement for CaptureHold: the capture is a
+// withdrawal, or a transfer when toIDNumber is set, of amount with the
+// detail of the hold.
+func (s *AccountService) AuthorizeCapture(
+	ctx context.Context, idNumber string, holdID int64, amount float64, toIDNumber, code string,
+) (*Review, error) {
+	capture, err := s.checkCapture(ctx, idNumber, holdID, amount, toIDNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	movement := Movement{
+		Type:          MovementWithdrawal,
+		AccountNumber: idNumber,
+		Amount:        capture.amount,
+		Detail:        capture.hold.Detail,
+		HoldID:        holdID,
+	}
+	if toIDNumber != "" {
+		movement.Type = MovementTransfer
+		movement.ToAccountNumber = toIDNumber
+	}
+	return s.AuthorizeMovement(ctx, movement, code)
+}
+
+// CaptureHold settles amount of an active hold, the whole hold when amount is
+// 0, and releases the rest. The money is withdrawn, or transferred when
+// toIDNumber is set.
+func (s *AccountService) CaptureHold(
+	ctx context.Context, idNumber string, holdID int64, amount float64, toIDNumber string,
+) (int64, float64, error) {
+	capture, err := s.checkCapture(ctx, idNumber, holdID, amount, toIDNumber)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	txID, balance, err := s.repo.CaptureHold(ctx, capture.accountID, holdID, capture.amount, capture.toAccountID)
+	if err != nil {
+		return 0, 0, err
+	}
+	s.notifyOverdraft(ctx, capture.accountID, balance+capture.amount, balance)
+	if capture.toAccountID != 0 {
+		s.notifyOverdraftCredit(ctx, capture.toAccountID, toIDNumber, capture.amount)
+	}
+	return txID, balance, nil
+}
+
+func (s *AccountService) checkCapture(
+	ctx context.Context, idNumber string, holdID int64, amount float64, toIDNumber string,
+) (capture, error) {
+	account, hold, err := s.getActiveHold(ctx, idNumber, holdID)
+	if err != nil {
+		return capture{}, err
+	}
+
+	if !hold.ExpiresAt.After(time.Now()) {
+		return capture{}, utils.NewBankSystemError(utils.ErrHoldNotActive, strconv.FormatInt(holdID, 10))
+	}
+	if amount == 0 {
+		amount = hold.Amount
+	}
+	if amount < 0 || amount > hold.Amount {
+		return capture{}, utils.NewBankSystemError(utils.ErrInvalidCaptureAmount, strconv.FormatFloat(hold.Amount, 'f', 2, 64))
+	}
+
+	var toAccountID int64
+	if toIDNumber != "" {
+		to, err := s.getAccount(ctx, toIDNumber)
+		if err != nil {
+			return capture{}, err
+		}
+		if to.ID == account.ID {
+			return capture{}, utils.NewBankSystemError(utils.ErrSameAccountTransfer, idNumber)
+		}
+		if to.CurrencyCode != account.CurrencyCode {
+			return capture{}, utils.NewBankSystemError(utils.ErrCurrencyMismatch, account.CurrencyCode, to.CurrencyCode)
+		}
+		toAccountID = to.ID
+	}
+	return capture{accountID: account.ID, hold: hold, amount: amount, toAccountID: toAccountID}, nil
+}
+
+// ReleaseHold gives an active hold back to the available balance and returns it.
+func (s *AccountService) ReleaseHold(ctx context.Context, idNumber string, holdID int64) (float64, error) {
+	account, _, err := s.getActiveHold(ctx, idNumber, holdID)
+	if err != nil {
+		return 0, err
+	}
+	return s.repo.ReleaseHold(ctx, account.ID, holdID)
+}
+
+// ExpireHolds releases every active hold past its expiry.
+func (s *AccountService) ExpireHolds(ctx context.Context) (int64, error) {
+	return s.repo.ExpireHolds(ctx)
+}
+
+func (s *AccountService) getAccount(ctx context.Context, idNumber string) (*sqlc.GetAccountByIDNumberRow, error) {
+	account, err := s.repo.GetAccountByIDNumber(ctx, idNumber)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, utils.NewBankSystemError(utils.ErrAccountNotFound, idNumber)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (s *AccountService) getActiveHold(ctx context.Context, idNumber string, holdID int64) (*sqlc.GetAccountByIDNumberRow, Hold, error) {
+	account, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return nil, Hold{}, err
+	}
+
+	hold, err := s.repo.GetHold(ctx, holdID)
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && hold.AccountID != account.ID {
+		return nil, Hold{}, utils.NewBankSystemError(utils.ErrHoldNotFound, strconv.FormatInt(holdID, 10))
+	}
+	if err != nil {
+		return nil, Hold{}, err
+	}
+	if hold.Status != HoldActive {
+		return nil, Hold{}, utils.NewBankSystemError(utils.ErrHoldNotActive, strconv.FormatInt(holdID, 10))
+	}
+	return account, hold, nil
+}
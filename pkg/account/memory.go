@@ -0,0 +1,745 @@
+package account
+
+import (
+	"bank_system/pkg/memstore"
+	"bank_system/pkg/transaction"
+	"bank_system/postgres/sqlc"
+	"bank_system/utils"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// memoryAccountRepository is an AccountRepository backed by a memstore.Store.
+// Withdrawals, deposits, transfers and holds follow the stored functions of
+// the Postgres schema: only ACTIVE accounts can move money, amounts must be
+// positive and neither the balance nor the available balance can go below zero.
+type memoryAccountRepository struct {
+	store *memstore.Store
+}
+
+func NewMemoryAccountRepository(store *memstore.Store) AccountRepository {
+	return &memoryAccountRepository{store: store}
+}
+
+func (r *memoryAccountRepository) CreateAccount(ctx context.Context, userID int64, currencyCode string) (sqlc.BKAccount, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	if _, ok := r.store.Users[userID]; !ok {
+		return sqlc.BKAccount{}, utils.NewBankSystemError(utils.ErrUserNotFound, strconv.FormatInt(userID, 10))
+	}
+	currency, ok := r.store.Currencies[currencyCode]
+	if !ok {
+		return sqlc.BKAccount{}, errors.New(`insert on "BK_Account" violates foreign key constraint "fk_bk_account_currency"`)
+	}
+	if !currency.Enabled {
+		return sqlc.BKAccount{}, fmt.Errorf("currency %s is not enabled", currencyCode)
+	}
+
+	now := memstore.Now()
+	account := &sqlc.BKAccount{
+		ID:           r.store.NextID("BK_Account"),
+		UserID:       userID,
+		IDNumber:     r.store.NewAccountNumber(),
+		CurrencyCode: currencyCode,
+		Balance:      0,
+		Status:       StatusActive,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	r.store.Accounts[account.ID] = account
+	r.store.Audit(ctx, "BK_Account", account.ID, nil, *account)
+
+	return *account, nil
+}
+
+func (r *memoryAccountRepository) CheckAccountIDNumberExists(ctx context.Context, idNumber string) (bool, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	_, ok := r.store.AccountByIDNumber(idNumber)
+	return ok, nil
+}
+
+func (r *memoryAccountRepository) GetAccountByIDNumber(
+	ctx context.Context, idNumber string,
+) (sqlc.GetAccountByIDNumberRow, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	account, ok := r.store.AccountByIDNumber(idNumber)
+	if !ok {
+		return sqlc.GetAccountByIDNumberRow{}, pgx.ErrNoRows
+	}
+	return sqlc.GetAccountByIDNumberRow{
+		ID:           account.ID,
+		UserID:       account.UserID,
+		IDNumber:     account.IDNumber,
+		CurrencyCode: account.CurrencyCode,
+		Balance:      account.Balance,
+		Status:       account.Status,
+		CreatedAt:    account.CreatedAt,
+		UpdatedAt:    account.UpdatedAt,
+	}, nil
+}
+
+func (r *memoryAccountRepository) GetAccountTransactionsByIDNumber(
+	ctx context.Context, idNumber string,
+) ([]sqlc.GetAccountTransactionsByIDNumberRow, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	transactions := []sqlc.GetAccountTransactionsByIDNumberRow{}
+
+	account, ok := r.store.AccountByIDNumber(idNumber)
+	if !ok {
+		return transactions, nil
+	}
+
+	for _, tx := range r.store.Transactions {
+		if tx.AccountFrom != account.ID && !(tx.AccountTo.Valid && tx.AccountTo.Int64 == account.ID) {
+			continue
+		}
+		transactions = append(transactions, sqlc.GetAccountTransactionsByIDNumberRow{
+			ID:           tx.ID,
+			AccountFrom:  tx.AccountFrom,
+			AccountTo:    tx.AccountTo,
+			Amount:       tx.Amount,
+			BalanceAfter: tx.BalanceAfter,
+			TxType:       tx.TxType,
+			Detail:       tx.Detail,
+			CreatedAt:    tx.CreatedAt,
+		})
+	}
+	sort.Slice(transactions, func(i, j int) bool { return transactions[i].ID > transactions[j].ID })
+
+	return transactions, nil
+}
+
+func (r *memoryAccountRepository) GetAllAccounts(ctx context.Context) ([]sqlc.GetAllAccountsRow, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	accounts := []sqlc.GetAllAccountsRow{}
+	for _, account := range r.store.Accounts {
+		accounts = append(accounts, sqlc.GetAllAccountsRow{
+			ID:           account.ID,
+			UserID:       account.UserID,
+			IDNumber:     account.IDNumber,
+			CurrencyCode: account.CurrencyCode,
+			Balance:      account.Balance,
+			Status:       account.Status,
+			CreatedAt:    account.CreatedAt,
+			UpdatedAt:    account.UpdatedAt,
+		})
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+
+	return accounts, nil
+}
+
+func (r *memoryAccountRepository) WithdrawFromAccount(
+	ctx context.Context, accountID int64, amount float64, detail string,
+) (int64, float64, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	account, err := r.activeAccount(accountID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := checkPositive(amount); err != nil {
+		return 0, 0, err
+	}
+	if r.available(account) < amount {
+		return 0, 0, utils.NewBankSystemError(utils.ErrInsufficientBalance, strconv.FormatInt(accountID, 10))
+	}
+	if err := r.store.CheckLimits(accountID, transaction.TxType_WITHDRAW, amount, 0); err != nil {
+		return 0, 0, err
+	}
+
+	account.Balance = roundMoney(account.Balance - amount)
+	account.UpdatedAt = memstore.Now()
+
+	tx := r.store.InsertTransaction(ctx, sqlc.BKTransaction{
+		AccountFrom:  accountID,
+		Amount:       amount,
+		BalanceAfter: account.Balance,
+		TxType:       transaction.TxType_WITHDRAW,
+		Detail:       detail,
+	})
+
+	return tx.ID, account.Balance, nil
+}
+
+func (r *memoryAccountRepository) DepositToAccount(
+	ctx context.Context, accountID int64, amount float64, detail string,
+) (int64, float64, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	account, err := r.activeAccount(accountID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := checkPositive(amount); err != nil {
+		return 0, 0, err
+	}
+	if err := r.store.CheckLimits(accountID, transaction.TxType_DEPOSIT, amount, 0); err != nil {
+		return 0, 0, err
+	}
+
+	account.Balance = roundMoney(account.Balance + amount)
+	account.UpdatedAt = memstore.Now()
+
+	tx := r.store.InsertTransaction(ctx, sqlc.BKTransaction{
+		AccountFrom:  accountID,
+		Amount:       amount,
+		BalanceAfter: account.Balance,
+		TxType:       transaction.TxType_DEPOSIT,
+		Detail:       detail,
+	})
+
+	return tx.ID, account.Balance, nil
+}
+
+func (r *memoryAccountRepository) TransferBetweenAccounts(
+	ctx context.Context, fromAccountID, toAccountID int64, amount float64, detail string,
+) (int64, float64, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	from, err := r.activeAccount(fromAccountID)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := r.activeAccount(toAccountID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if fromAccountID == toAccountID {
+		return 0, 0, utils.NewBankSystemError(utils.ErrSameAccountTransfer, strconv.FormatInt(fromAccountID, 10))
+	}
+	if from.CurrencyCode != to.CurrencyCode {
+		return 0, 0, utils.NewBankSystemError(utils.ErrCurrencyMismatch, from.CurrencyCode, to.CurrencyCode)
+	}
+	if err := checkPositive(amount); err != nil {
+		return 0, 0, err
+	}
+	if r.available(from) < amount {
+		return 0, 0, utils.NewBankSystemError(utils.ErrInsufficientBalance, strconv.FormatInt(fromAccountID, 10))
+	}
+	if err := r.store.CheckLimits(fromAccountID, transaction.TxType_TRANSFER, amount, 0); err != nil {
+		return 0, 0, err
+	}
+
+	now := memstore.Now()
+	from.Balance = roundMoney(from.Balance - amount)
+	from.UpdatedAt = now
+	to.Balance = roundMoney(to.Balance + amount)
+	to.UpdatedAt = now
+
+	tx := r.store.InsertTransaction(ctx, sqlc.BKTransaction{
+		AccountFrom:  fromAccountID,
+		AccountTo:    pgtype.Int8{Int64: toAccountID, Valid: true},
+		Amount:       amount,
+		BalanceAfter: from.Balance,
+		TxType:       transaction.TxType_TRANSFER,
+		Detail:       detail,
+	})
+
+	return tx.ID, from.Balance, nil
+}
+
+func (r *memoryAccountRepository) TransferBatch(
+	ctx context.Context, fromAccountID int64, transfers []BatchTransfer,
+) ([]int64, float64, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	from, err := r.activeAccount(fromAccountID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Check every transfer before the first balance changes.
+	total := 0.0
+	for i, transfer := range transfers {
+		to, err := r.activeAccount(transfer.ToAccountID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("transfer %d: %w", i+1, err)
+		}
+		if fromAccountID == transfer.ToAccountID {
+			return nil, 0, utils.NewBankSystemError(utils.ErrSameAccountTransfer, strconv.FormatInt(fromAccountID, 10))
+		}
+		if from.CurrencyCode != to.CurrencyCode {
+			return nil, 0, utils.NewBankSystemError(utils.ErrCurrencyMismatch, from.CurrencyCode, to.CurrencyCode)
+		}
+		if err := checkPositive(transfer.Amount); err != nil {
+			return nil, 0, fmt.Errorf("transfer %d: %w", i+1, err)
+		}
+		total += transfer.Amount
+	}
+	if r.available(from) < roundMoney(total) {
+		return nil, 0, utils.NewBankSystemError(utils.ErrInsufficientBalance, strconv.FormatInt(fromAccountID, 10))
+	}
+	pending := 0.0
+	for i, transfer := range transfers {
+		if err := r.store.CheckLimits(fromAccountID, transaction.TxType_TRANSFER, transfer.Amount, pending); err != nil {
+			return nil, 0, fmt.Errorf("transfer %d: %w", i+1, err)
+		}
+		pending += transfer.Amount
+	}
+
+	now := memstore.Now()
+	txIDs := make([]int64, 0, len(transfers))
+	for _, transfer := range transfers {
+		to := r.store.Accounts[transfer.ToAccountID]
+		from.Balance = roundMoney(from.Balance - transfer.Amount)
+		from.UpdatedAt = now
+		to.Balance = roundMoney(to.Balance + transfer.Amount)
+		to.UpdatedAt = now
+
+		tx := r.store.InsertTransaction(ctx, sqlc.BKTransaction{
+			AccountFrom:  fromAccountID,
+			AccountTo:    pgtype.Int8{Int64: transfer.ToAccountID, Valid: true},
+			Amount:       transfer.Amount,
+			BalanceAfter: from.Balance,
+			TxType:       transaction.TxType_TRANSFER,
+			Detail:       transfer.Detail,
+		})
+		txIDs = append(txIDs, tx.ID)
+	}
+
+	return txIDs, from.Balance, nil
+}
+
+func (r *memoryAccountRepository) TransferFX(
+	ctx context.Context, fromAccountID, toAccountID int64, amount float64, quoteID, detail string,
+) (int64, float64, float64, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	from, err := r.activeAccount(fromAccountID)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	to, err := r.activeAccount(toAccountID)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if err := checkPositive(amount); err != nil {
+		return 0, 0, 0, err
+	}
+
+	quote, ok := r.store.FXQuotes[quoteID]
+	if !ok {
+		return 0, 0, 0, utils.NewBankSystemError(utils.ErrQuoteNotFound, quoteID)
+	}
+	if quote.UsedAt.Valid || !quote.ExpiresAt.After(time.Now()) {
+		return 0, 0, 0, utils.NewBankSystemError(utils.ErrQuoteExpired, quoteID)
+	}
+	if quote.FromCurrency != from.CurrencyCode || quote.ToCurrency != to.CurrencyCode {
+		return 0, 0, 0, utils.NewBankSystemError(utils.ErrCurrencyMismatch, quote.FromCurrency, quote.ToCurrency)
+	}
+
+	converted := roundTo(amount*quote.Rate, r.store.MinorUnits(quote.ToCurrency))
+	if converted <= 0 {
+		return 0, 0, 0, utils.NewBankSystemError(utils.ErrInvalidAmount, fmt.Sprint(amount))
+	}
+	if r.available(from) < amount {
+		return 0, 0, 0, utils.NewBankSystemError(utils.ErrInsufficientBalance, strconv.FormatInt(fromAccountID, 10))
+	}
+	if err := r.store.CheckLimits(fromAccountID, transaction.TxType_TRANSFER, amount, 0); err != nil {
+		return 0, 0, 0, err
+	}
+
+	now := memstore.Now()
+	from.Balance = roundMoney(from.Balance - amount)
+	from.UpdatedAt = now
+	to.Balance = roundMoney(to.Balance + converted)
+	to.UpdatedAt = now
+
+	tx := r.store.InsertFXTransaction(ctx, sqlc.BKTransaction{
+		AccountFrom:  fromAccountID,
+		AccountTo:    pgtype.Int8{Int64: toAccountID, Valid: true},
+		Amount:       amount,
+		BalanceAfter: from.Balance,
+		TxType:       transaction.TxType_TRANSFER,
+		Detail:       detail,
+	}, memstore.FXTransferRecord{
+		QuoteID:         quote.ID,
+		FromCurrency:    quote.FromCurrency,
+		ToCurrency:      quote.ToCurrency,
+		Amount:          amount,
+		ConvertedAmount: converted,
+		MidRate:         quote.MidRate,
+		Rate:            quote.Rate,
+		SpreadBps:       quote.SpreadBps,
+	})
+	quote.UsedAt = now
+	quote.TransactionID = pgtype.Int8{Int64: tx.ID, Valid: true}
+
+	return tx.ID, from.Balance, converted, nil
+}
+
+func (r *memoryAccountRepository) UpdateAccountStatus(ctx context.Context, idNumber, status string) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	account, ok := r.store.AccountByIDNumber(idNumber)
+	if !ok {
+		return utils.NewBankSystemError(utils.ErrAccountNotFound, idNumber)
+	}
+	before := *account
+	account.Status = status
+	account.UpdatedAt = memstore.Now()
+	r.store.Audit(ctx, "BK_Account", account.ID, before, *account)
+	r.store.RecordStatusChange(*account, before.Status)
+	return nil
+}
+
+func (r *memoryAccountRepository) GetAccountBalances(ctx context.Context, idNumber string) (Balances, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	account, ok := r.store.AccountByIDNumber(idNumber)
+	if !ok {
+		return Balances{}, pgx.ErrNoRows
+	}
+	return Balances{
+		Ledger:         account.Balance,
+		Held:           roundMoney(r.store.HeldBalance(account.ID)),
+		OverdraftLimit: r.store.Overdraft(account.ID).Limit,
+		Available:      r.available(account),
+	}, nil
+}
+
+func (r *memoryAccountRepository) PlaceHold(
+	ctx context.Context, accountID int64, amount float64, detail string, expiresAt time.Time,
+) (Hold, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	account, err := r.activeAccount(accountID)
+	if err != nil {
+		return Hold{}, err
+	}
+	if err := checkPositive(amount); err != nil {
+		return Hold{}, err
+	}
+	if r.available(account) < amount {
+		return Hold{}, utils.NewBankSystemError(utils.ErrInsufficientBalance, strconv.FormatInt(accountID, 10))
+	}
+
+	now := time.Now()
+	hold := &memstore.HoldRecord{
+		ID:        r.store.NextID("BK_Account_Hold"),
+		AccountID: accountID,
+		Amount:    amount,
+		Status:    HoldActive,
+		Detail:    detail,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	r.store.Holds[hold.ID] = hold
+	r.store.Audit(ctx, "BK_Account_Hold", hold.ID, nil, *hold)
+
+	return toHold(hold), nil
+}
+
+func (r *memoryAccountRepository) GetHold(ctx context.Context, holdID int64) (Hold, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	hold, ok := r.store.Holds[holdID]
+	if !ok {
+		return Hold{}, pgx.ErrNoRows
+	}
+	return toHold(hold), nil
+}
+
+func (r *memoryAccountRepository) GetAccountHolds(ctx context.Context, accountID int64) ([]Hold, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	holds := []Hold{}
+	for _, hold := range r.store.Holds {
+		if hold.AccountID == accountID {
+			holds = append(holds, toHold(hold))
+		}
+	}
+	sort.Slice(holds, func(i, j int) bool { return holds[i].ID > holds[j].ID })
+
+	return holds, nil
+}
+
+func (r *memoryAccountRepository) CaptureHold(
+	ctx context.Context, accountID, holdID int64, amount float64, toAccountID int64,
+) (int64, float64, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	hold, err := r.activeHold(accountID, holdID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !hold.ExpiresAt.After(time.Now()) {
+		return 0, 0, utils.NewBankSystemError(utils.ErrHoldNotActive, strconv.FormatInt(holdID, 10))
+	}
+	if amount <= 0 || amount > hold.Amount {
+		return 0, 0, utils.NewBankSystemError(utils.ErrInvalidCaptureAmount, fmt.Sprint(hold.Amount))
+	}
+	if toAccountID == accountID {
+		return 0, 0, utils.NewBankSystemError(utils.ErrSameAccountTransfer, strconv.FormatInt(accountID, 10))
+	}
+
+	from, err := r.activeAccount(accountID)
+	if err != nil {
+		return 0, 0, err
+	}
+	var to *sqlc.BKAccount
+	txType := transaction.TxType_WITHDRAW
+	if toAccountID != 0 {
+		if to, err = r.activeAccount(toAccountID); err != nil {
+			return 0, 0, err
+		}
+		if to.CurrencyCode != from.CurrencyCode {
+			return 0, 0, utils.NewBankSystemError(utils.ErrCurrencyMismatch, from.CurrencyCode, to.CurrencyCode)
+		}
+		txType = transaction.TxType_TRANSFER
+	}
+	if err := r.store.CheckLimits(accountID, txType, amount, 0); err != nil {
+		return 0, 0, err
+	}
+
+	now := memstore.Now()
+	from.Balance = roundMoney(from.Balance - amount)
+	from.UpdatedAt = now
+
+	tx := sqlc.BKTransaction{
+		AccountFrom:  accountID,
+		Amount:       amount,
+		BalanceAfter: from.Balance,
+		TxType:       sqlc.TxType(txType),
+		Detail:       hold.Detail,
+	}
+	if to != nil {
+		to.Balance = roundMoney(to.Balance + amount)
+		to.UpdatedAt = now
+		tx.AccountTo = pgtype.Int8{Int64: toAccountID, Valid: true}
+	}
+	tx = r.store.InsertTransaction(ctx, tx)
+
+	before := *hold
+	hold.Status = HoldCaptured
+	hold.CapturedAmount = amount
+	hold.TransactionID = pgtype.Int8{Int64: tx.ID, Valid: true}
+	hold.UpdatedAt = now.Time
+	r.store.Audit(ctx, "BK_Account_Hold", hold.ID, before, *hold)
+
+	return tx.ID, from.Balance, nil
+}
+
+func (r *memoryAccountRepository) ReleaseHold(ctx context.Context, accountID, holdID int64) (float64, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	hold, err := r.activeHold(accountID, holdID)
+	if err != nil {
+		return 0, err
+	}
+	before := *hold
+	hold.Status = HoldReleased
+	hold.UpdatedAt = time.Now()
+	r.store.Audit(ctx, "BK_Account_Hold", hold.ID, before, *hold)
+
+	return r.available(r.store.Accounts[accountID]), nil
+}
+
+func (r *memoryAccountRepository) ExpireHolds(ctx context.Context) (int64, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	var expired int64
+	now := time.Now()
+	for _, hold := range r.store.Holds {
+		if hold.Status == HoldActive && !hold.ExpiresAt.After(now) {
+			before := *hold
+			hold.Status = HoldExpired
+			hold.UpdatedAt = now
+			r.store.Audit(ctx, "BK_Account_Hold", hold.ID, before, *hold)
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+func (r *memoryAccountRepository) GetOverdraft(ctx context.Context, idNumber string) (Overdraft, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	account, ok := r.store.AccountByIDNumber(idNumber)
+	if !ok {
+		return Overdraft{}, pgx.ErrNoRows
+	}
+	overdraft := r.store.Overdraft(account.ID)
+	return Overdraft{
+		Limit:        overdraft.Limit,
+		InterestRate: overdraft.InterestRate,
+		DailyFee:     overdraft.DailyFee,
+	}, nil
+}
+
+func (r *memoryAccountRepository) UpdateOverdraft(ctx context.Context, idNumber string, overdraft Overdraft) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	account, ok := r.store.AccountByIDNumber(idNumber)
+	if !ok {
+		return utils.NewBankSystemError(utils.ErrAccountNotFound, idNumber)
+	}
+	if roundMoney(account.Balance+overdraft.Limit-r.store.HeldBalance(account.ID)) < 0 {
+		return utils.NewBankSystemError(utils.ErrOverdraftLimitInUse, idNumber)
+	}
+
+	before := r.store.Overdraft(account.ID)
+	r.store.Overdrafts[account.ID] = &memstore.OverdraftRecord{
+		Limit:        overdraft.Limit,
+		InterestRate: overdraft.InterestRate,
+		DailyFee:     overdraft.DailyFee,
+	}
+	account.UpdatedAt = memstore.Now()
+	r.store.Audit(ctx, "BK_Account", account.ID, overdraftColumns(before), overdraftColumns(*r.store.Overdrafts[account.ID]))
+	return nil
+}
+
+func (r *memoryAccountRepository) PostOverdraftCharges(ctx context.Context, date time.Time) ([]int64, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	day := date.Format(time.DateOnly)
+
+	ids := make([]int64, 0, len(r.store.Accounts))
+	for id := range r.store.Accounts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	charged := []int64{}
+	for _, id := range ids {
+		account := r.store.Accounts[id]
+		charge := memstore.OverdraftCharge{AccountID: id, Date: day}
+		if account.Balance >= 0 || account.Status == StatusClosed || r.store.OverdraftCharges[charge] {
+			continue
+		}
+		r.store.OverdraftCharges[charge] = true
+
+		overdraft := r.store.Overdraft(id)
+		interest := roundTo(-account.Balance*overdraft.InterestRate/365, r.store.MinorUnits(account.CurrencyCode))
+		for _, posting := range []struct {
+			amount float64
+			txType string
+			detail string
+		}{
+			{interest, transaction.TxType_INTEREST, "Overdraft interest " + day},
+			{overdraft.DailyFee, transaction.TxType_FEE, "Overdraft fee " + day},
+		} {
+			if posting.amount <= 0 {
+				continue
+			}
+			account.Balance = roundMoney(account.Balance - posting.amount)
+			account.UpdatedAt = memstore.Now()
+			r.store.InsertTransaction(ctx, sqlc.BKTransaction{
+				AccountFrom:  id,
+				Amount:       posting.amount,
+				BalanceAfter: account.Balance,
+				TxType:       sqlc.TxType(posting.txType),
+				Detail:       posting.detail,
+			})
+		}
+		charged = append(charged, id)
+	}
+
+	return charged, nil
+}
+
+// activeHold returns the hold if it belongs to the account and is ACTIVE.
+// The caller must hold the store lock.
+func (r *memoryAccountRepository) activeHold(accountID, holdID int64) (*memstore.HoldRecord, error) {
+	hold, ok := r.store.Holds[holdID]
+	if !ok || hold.AccountID != accountID {
+		return nil, utils.NewBankSystemError(utils.ErrHoldNotFound, strconv.FormatInt(holdID, 10))
+	}
+	if hold.Status != HoldActive {
+		return nil, utils.NewBankSystemError(utils.ErrHoldNotActive, strconv.FormatInt(holdID, 10))
+	}
+	return hold, nil
+}
+
+// available is the balance plus the overdraft limit, minus what holds reserve.
+// The caller must hold the store lock.
+func (r *memoryAccountRepository) available(account *sqlc.BKAccount) float64 {
+	return roundMoney(account.Balance + r.store.Overdraft(account.ID).Limit - r.store.HeldBalance(account.ID))
+}
+
+func toHold(hold *memstore.HoldRecord) Hold {
+	return Hold{
+		ID:             hold.ID,
+		AccountID:      hold.AccountID,
+		Amount:         hold.Amount,
+		CapturedAmount: hold.CapturedAmount,
+		Status:         hold.Status,
+		Detail:         hold.Detail,
+		TransactionID:  hold.TransactionID,
+		ExpiresAt:      hold.ExpiresAt,
+		CreatedAt:      hold.CreatedAt,
+		UpdatedAt:      hold.UpdatedAt,
+	}
+}
+
+// activeAccount returns the account if it exists and is ACTIVE. The caller
+// must hold the store lock.
+func (r *memoryAccountRepository) activeAccount(id int64) (*sqlc.BKAccount, error) {
+	account, ok := r.store.Accounts[id]
+	if !ok || account.Status != StatusActive {
+		return nil, utils.NewBankSystemError(utils.ErrAccountNotActive, strconv.FormatInt(id, 10))
+	}
+	return account, nil
+}
+
+func checkPositive(amount float64) error {
+	if amount <= 0 {
+		return utils.NewBankSystemError(utils.ErrInvalidAmount, fmt.Sprint(amount))
+	}
+	return nil
+}
+
+// roundMoney keeps balances at NUMERIC(100, 4) precision.
+func roundMoney(amount float64) float64 {
+	return roundTo(amount, utils.MAX_MINOR_UNITS)
+}
+
+func roundTo(amount float64, decimals int) float64 {
+	scale := math.Pow10(decimals)
+	return math.Round(amount*scale) / scale
+}
+
+// overdraftColumns names the overdraft terms like the columns of "BK_Account"
+// they are stored in, for the audit log.
+func overdraftColumns(overdraft memstore.OverdraftRecord) map[string]float64 {
+	return map[string]float64{
+		"overdraft_limit":         overdraft.Limit,
+		"overdraft_interest_rate": overdraft.InterestRate,
+		"overdraft_daily_fee":     overdraft.DailyFee,
+	}
+}
@@ -0,0 +1,120 @@
+package account
+
+import (
+	"bank_system/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// OverdraftChannel is the Redis Pub/Sub channel overdraft events are published on.
+const OverdraftChannel = "account:overdraft"
+
+// Overdraft holds the terms under which an account may go below zero.
+type Overdraft struct {
+	Limit        float64 `json:"limit"`
+	InterestRate float64 `json:"interest_rate"` // yearly, charged daily on the overdrawn amount
+	DailyFee     float64 `json:"daily_fee"`     // charged for every day the account is overdrawn
+}
+
+// OverdraftEvent is sent when an account enters or leaves overdraft.
+type OverdraftEvent struct {
+	AccountID int64     `json:"account_id"`
+	Balance   float64   `json:"balance"`
+	Overdrawn bool      `json:"overdrawn"`
+	At        time.Time `json:"at"`
+}
+
+type OverdraftNotifier interface {
+	NotifyOverdraft(ctx context.Context, event OverdraftEvent)
+}
+
+type redisOverdraftNotifier struct {
+	client *redis.Client
+	logger *log.Logger
+}
+
+// NewRedisOverdraftNotifier publishes events as JSON on OverdraftChannel.
+// Publishing is best effort, failures are only logged.
+func NewRedisOverdraftNotifier(client *redis.Client, logger *log.Logger) OverdraftNotifier {
+	return &redisOverdraftNotifier{client: client, logger: logger}
+}
+
+func (n *redisOverdraftNotifier) NotifyOverdraft(ctx context.Context, event OverdraftEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		n.logger.Printf("overdraft notification for account %d failed: %v\n", event.AccountID, err)
+		return
+	}
+	if err := n.client.Publish(ctx, OverdraftChannel, data).Err(); err != nil {
+		n.logger.Printf("overdraft notification for account %d failed: %v\n", event.AccountID, err)
+	}
+}
+
+func (s *AccountService) GetOverdraft(ctx context.Context, idNumber string) (Overdraft, error) {
+	overdraft, err := s.repo.GetOverdraft(ctx, idNumber)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Overdraft{}, utils.NewBankSystemError(utils.ErrAccountNotFound, idNumber)
+	}
+	return overdraft, err
+}
+
+// UpdateOverdraft changes the terms of an account. The limit cannot be
+// lowered below what the account already uses.
+func (s *AccountService) UpdateOverdraft(ctx context.Context, idNumber string, overdraft Overdraft) error {
+	verr := &utils.ValidationError{}
+	if math.IsNaN(overdraft.Limit) || overdraft.Limit < 0 || overdraft.Limit >= utils.MAX_AMOUNT {
+		verr.Add("limit", "must be between 0 and 1e18")
+	}
+	if math.IsNaN(overdraft.InterestRate) || overdraft.InterestRate < 0 || overdraft.InterestRate > 1 {
+		verr.Add("interest_rate", "must be between 0 and 1")
+	}
+	if math.IsNaN(overdraft.DailyFee) || overdraft.DailyFee < 0 || overdraft.DailyFee >= utils.MAX_AMOUNT {
+		verr.Add("daily_fee", "must be between 0 and 1e18")
+	}
+	if err := verr.Err(); err != nil {
+		return err
+	}
+
+	return s.repo.UpdateOverdraft(ctx, idNumber, overdraft)
+}
+
+// PostOverdraftCharges posts interest and fees on every overdrawn account
+// for the day of date. Accounts already charged for that day are skipped, so
+// the job can safely run more than once a day.
+func (s *AccountService) PostOverdraftCharges(ctx context.Context, date time.Time) (int, error) {
+	charged, err := s.repo.PostOverdraftCharges(ctx, date)
+	return len(charged), err
+}
+
+// notifyOverdraft sends an event when the balance of the account crossed zero.
+func (s *AccountService) notifyOverdraft(ctx context.Context, accountID int64, before, after float64) {
+	if s.overdraft == nil || (roundMoney(before) < 0) == (roundMoney(after) < 0) {
+		return
+	}
+	s.overdraft.NotifyOverdraft(ctx, OverdraftEvent{
+		AccountID: accountID,
+		Balance:   after,
+		Overdrawn: after < 0,
+		At:        time.Now(),
+	})
+}
+
+// notifyOverdraftCredit checks the receiving side of a transfer, which the
+// stored functions do not return the balance of.
+func (s *AccountService) notifyOverdraftCredit(ctx context.Context, accountID int64, idNumber string, amount float64) {
+	if s.overdraft == nil {
+		return
+	}
+	balances, err := s.repo.GetAccountBalances(ctx, idNumber)
+	if err != nil {
+		return
+	}
+	s.notifyOverdraft(ctx, accountID, balances.Ledger-amount, balances.Ledger)
+}
@@ -2,20 +2,49 @@ package account
 
 import (
 	"bank_system/postgres/sqlc"
+	"bank_system/utils"
 	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const holdColumns = `id, account_id, amount, captured_amount, status, detail, transaction_id, expires_at, created_at, updated_at`
+
 type AccountRepository interface {
-	CreateAccount(ctx context.Context, userID int64) (sqlc.BKAccount, error)
+	CreateAccount(ctx context.Context, userID int64, currencyCode string) (sqlc.BKAccount, error)
 	CheckAccountIDNumberExists(ctx context.Context, idNumber string) (bool, error)
 	GetAccountByIDNumber(ctx context.Context, idNumber string) (sqlc.GetAccountByIDNumberRow, error)
 	GetAccountTransactionsByIDNumber(ctx context.Context, idNumber string) ([]sqlc.GetAccountTransactionsByIDNumberRow, error)
 	GetAllAccounts(ctx context.Context) ([]sqlc.GetAllAccountsRow, error)
 	WithdrawFromAccount(ctx context.Context, accountID int64, amount float64, detail string) (int64, float64, error)
 	DepositToAccount(ctx context.Context, accountID int64, amount float64, detail string) (int64, float64, error)
+	TransferBetweenAccounts(ctx context.Context, fromAccountID, toAccountID int64, amount float64, detail string) (int64, float64, error)
+	// TransferFX converts amount at the rate of the quote and returns the
+	// transaction id, the sender's new balance and the converted amount.
+	TransferFX(ctx context.Context, fromAccountID, toAccountID int64, amount float64, quoteID, detail string) (int64, float64, float64, error)
+	// TransferBatch makes every transfer in one database transaction, or none
+	// of them, and returns their transaction ids and the sender's new balance.
+	TransferBatch(ctx context.Context, fromAccountID int64, transfers []BatchTransfer) ([]int64, float64, error)
+	UpdateAccountStatus(ctx context.Context, idNumber, status string) error
+	GetAccountBalances(ctx context.Context, idNumber string) (Balances, error)
+	PlaceHold(ctx context.Context, accountID int64, amount float64, detail string, expiresAt time.Time) (Hold, error)
+	GetHold(ctx context.Context, holdID int64) (Hold, error)
+	GetAccountHolds(ctx context.Context, accountID int64) ([]Hold, error)
+	// CaptureHold withdraws amount, or transfers it when toAccountID is not 0.
+	CaptureHold(ctx context.Context, accountID, holdID int64, amount float64, toAccountID int64) (int64, float64, error)
+	ReleaseHold(ctx context.Context, accountID, holdID int64) (float64, error)
+	ExpireHolds(ctx context.Context) (int64, error)
+	GetOverdraft(ctx context.Context, idNumber string) (Overdraft, error)
+	UpdateOverdraft(ctx context.Context, idNumber string, overdraft Overdraft) error
+	// PostOverdraftCharges returns the ids of the accounts it charged.
+	PostOverdraftCharges(ctx context.Context, date time.Time) ([]int64, error)
 }
 
 type accountRepositoryImpl struct {
@@ -30,12 +59,26 @@ func NewAccountRepository(pool *pgxpool.Pool) AccountRepository {
 	}
 }
 
-func (r *accountRepositoryImpl) CreateAccount(ctx context.Context, userID int64) (sqlc.BKAccount, error) {
-	tx, err := r.queries.CreateAccount(ctx, userID)
+func (r *accountRepositoryImpl) CreateAccount(ctx context.Context, userID int64, currencyCode string) (sqlc.BKAccount, error) {
+	var account sqlc.BKAccount
+	err := r.pool.QueryRow(ctx,
+		`INSERT INTO "BK_Account" (user_id, currency_code) VALUES ($1, $2)
+		RETURNING id, user_id, id_number, currency_code, balance, status, created_at, updated_at`,
+		userID, currencyCode,
+	).Scan(
+		&account.ID,
+		&account.UserID,
+		&account.IDNumber,
+		&account.CurrencyCode,
+		&account.Balance,
+		&account.Status,
+		&account.CreatedAt,
+		&account.UpdatedAt,
+	)
 	if err != nil {
 		return sqlc.BKAccount{}, err
 	}
-	return tx, nil
+	return account, nil
 }
 
 func (r *accountRepositoryImpl) CheckAccountIDNumberExists(ctx context.Context, idNumber string) (bool, error) {
@@ -69,39 +112,281 @@ func (r *accountRepositoryImpl) GetAllAccounts(ctx context.Context) ([]sqlc.GetA
 func (r *accountRepositoryImpl) WithdrawFromAccount(
 	ctx context.Context, accountID int64, amount float64, detail string,
 ) (int64, float64, error) {
-	txOptions := pgx.TxOptions{
-		IsoLevel:       pgx.Serializable,
-		AccessMode:     pgx.ReadWrite,
-		DeferrableMode: pgx.NotDeferrable,
+	var result sqlc.WithdrawFromAccountRow
+	err := r.serializable(ctx, func(tx pgx.Tx) (err error) {
+		result, err = r.queries.WithTx(tx).WithdrawFromAccount(ctx, sqlc.WithdrawFromAccountParams{
+			AccountID: accountID,
+			Amount:    amount,
+			TxDetail:  detail,
+		})
+		return postingError(err)
+	})
+	if err != nil {
+		return 0, 0, err
 	}
 
-	tx, err := r.pool.BeginTx(ctx, txOptions)
+	return result.TransactionID, result.NewBalance, nil
+}
 
+func (r *accountRepositoryImpl) DepositToAccount(
+	ctx context.Context, accountID int64, amount float64, detail string,
+) (int64, float64, error) {
+	var result sqlc.DepositToAccountRow
+	err := r.serializable(ctx, func(tx pgx.Tx) (err error) {
+		result, err = r.queries.WithTx(tx).DepositToAccount(ctx, sqlc.DepositToAccountParams{
+			AccountID: accountID,
+			Amount:    amount,
+			TxDetail:  detail,
+		})
+		return postingError(err)
+	})
 	if err != nil {
 		return 0, 0, err
 	}
-	defer tx.Rollback(ctx)
 
-	result, err := r.queries.WithTx(tx).WithdrawFromAccount(ctx, sqlc.WithdrawFromAccountParams{
-		AccountID: accountID,
-		Amount:    amount,
-		TxDetail:  detail,
-	})
+	return result.TransactionID, result.NewBalance, nil
+}
 
+func (r *accountRepositoryImpl) TransferBetweenAccounts(
+	ctx context.Context, fromAccountID, toAccountID int64, amount float64, detail string,
+) (int64, float64, error) {
+	var (
+		txID       int64
+		newBalance float64
+	)
+	err := r.serializable(ctx, func(tx pgx.Tx) error {
+		return postingError(tx.QueryRow(ctx,
+			`SELECT transaction_id, new_balance_from FROM transfer_between_accounts($1, $2, $3, $4)`,
+			fromAccountID, toAccountID, amount, detail,
+		).Scan(&txID, &newBalance))
+	})
 	if err != nil {
 		return 0, 0, err
 	}
 
-	if err = tx.Commit(ctx); err != nil {
-		return 0, 0, err
+	return txID, newBalance, nil
+}
+
+func (r *accountRepositoryImpl) TransferBatch(
+	ctx context.Context, fromAccountID int64, transfers []BatchTransfer,
+) ([]int64, float64, error) {
+	var (
+		txIDs      []int64
+		newBalance float64
+	)
+	err := r.serializable(ctx, func(tx pgx.Tx) error {
+		txIDs = make([]int64, 0, len(transfers))
+		for i, transfer := range transfers {
+			var txID int64
+			err := tx.QueryRow(ctx,
+				`SELECT transaction_id, new_balance_from FROM transfer_between_accounts($1, $2, $3, $4)`,
+				fromAccountID, transfer.ToAccountID, transfer.Amount, transfer.Detail,
+			).Scan(&txID, &newBalance)
+			if err != nil {
+				return fmt.Errorf("transfer %d: %w", i+1, postingError(err))
+			}
+			txIDs = append(txIDs, txID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return result.TransactionID, result.NewBalance, nil
+	return txIDs, newBalance, nil
 }
 
-func (r *accountRepositoryImpl) DepositToAccount(
-	ctx context.Context, accountID int64, amount float64, detail string,
+func (r *accountRepositoryImpl) TransferFX(
+	ctx context.Context, fromAccountID, toAccountID int64, amount float64, quoteID, detail string,
+) (int64, float64, float64, error) {
+	var (
+		txID       int64
+		newBalance float64
+		converted  float64
+	)
+	err := r.serializable(ctx, func(tx pgx.Tx) error {
+		return postingError(tx.QueryRow(ctx,
+			`SELECT transaction_id, new_balance_from, converted_amount FROM fx_transfer_between_accounts($1, $2, $3, $4, $5)`,
+			fromAccountID, toAccountID, amount, quoteID, detail,
+		).Scan(&txID, &newBalance, &converted))
+	})
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	return txID, newBalance, converted, nil
+}
+
+func (r *accountRepositoryImpl) UpdateAccountStatus(ctx context.Context, idNumber, status string) error {
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE "BK_Account" SET status = $2 WHERE id_number = $1`,
+		idNumber, status,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return utils.NewBankSystemError(utils.ErrAccountNotFound, idNumber)
+	}
+	return nil
+}
+
+func (r *accountRepositoryImpl) GetAccountBalances(ctx context.Context, idNumber string) (Balances, error) {
+	var balances Balances
+	err := r.pool.QueryRow(ctx,
+		`SELECT balance, held_balance, overdraft_limit, balance + overdraft_limit - held_balance
+		FROM "BK_Account" WHERE id_number = $1`,
+		idNumber,
+	).Scan(&balances.Ledger, &balances.Held, &balances.OverdraftLimit, &balances.Available)
+	return balances, err
+}
+
+func (r *accountRepositoryImpl) PlaceHold(
+	ctx context.Context, accountID int64, amount float64, detail string, expiresAt time.Time,
+) (Hold, error) {
+	var hold Hold
+	err := r.serializable(ctx, func(tx pgx.Tx) error {
+		var holdID int64
+		err := tx.QueryRow(ctx,
+			`SELECT hold_id FROM place_hold($1, $2, $3, $4)`,
+			accountID, amount, detail, expiresAt,
+		).Scan(&holdID)
+		if err != nil {
+			return err
+		}
+
+		hold, err = scanHold(tx.QueryRow(ctx, `SELECT `+holdColumns+` FROM "BK_Account_Hold" WHERE id = $1`, holdID))
+		return err
+	})
+	if err != nil {
+		return Hold{}, err
+	}
+
+	return hold, nil
+}
+
+func (r *accountRepositoryImpl) GetHold(ctx context.Context, holdID int64) (Hold, error) {
+	return scanHold(r.pool.QueryRow(ctx, `SELECT `+holdColumns+` FROM "BK_Account_Hold" WHERE id = $1`, holdID))
+}
+
+func (r *accountRepositoryImpl) GetAccountHolds(ctx context.Context, accountID int64) ([]Hold, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+holdColumns+` FROM "BK_Account_Hold" WHERE account_id = $1 ORDER BY id DESC`,
+		accountID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds := []Hold{}
+	for rows.Next() {
+		hold, err := scanHold(rows)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+	return holds, rows.Err()
+}
+
+func (r *accountRepositoryImpl) CaptureHold(
+	ctx context.Context, accountID, holdID int64, amount float64, toAccountID int64,
 ) (int64, float64, error) {
+	var (
+		txID       int64
+		newBalance float64
+	)
+	err := r.serializable(ctx, func(tx pgx.Tx) error {
+		return postingError(tx.QueryRow(ctx,
+			`SELECT transaction_id, new_balance FROM capture_hold($1, $2, $3, $4)`,
+			accountID, holdID, amount, pgtype.Int8{Int64: toAccountID, Valid: toAccountID != 0},
+		).Scan(&txID, &newBalance))
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return txID, newBalance, nil
+}
+
+func (r *accountRepositoryImpl) ReleaseHold(ctx context.Context, accountID, holdID int64) (float64, error) {
+	var available float64
+	err := r.pool.QueryRow(ctx, `SELECT release_hold($1, $2)`, accountID, holdID).Scan(&available)
+	return available, err
+}
+
+func (r *accountRepositoryImpl) ExpireHolds(ctx context.Context) (int64, error) {
+	var expired int64
+	err := r.pool.QueryRow(ctx, `SELECT expire_holds()`).Scan(&expired)
+	return expired, err
+}
+
+func (r *accountRepositoryImpl) GetOverdraft(ctx context.Context, idNumber string) (Overdraft, error) {
+	var overdraft Overdraft
+	err := r.pool.QueryRow(ctx,
+		`SELECT overdraft_limit, overdraft_interest_rate, overdraft_daily_fee FROM "BK_Account" WHERE id_number = $1`,
+		idNumber,
+	).Scan(&overdraft.Limit, &overdraft.InterestRate, &overdraft.DailyFee)
+	return overdraft, err
+}
+
+func (r *accountRepositoryImpl) UpdateOverdraft(ctx context.Context, idNumber string, overdraft Overdraft) error {
+	_, err := r.pool.Exec(ctx,
+		`SELECT update_overdraft($1, $2, $3, $4)`,
+		idNumber, overdraft.Limit, overdraft.InterestRate, overdraft.DailyFee,
+	)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "P0002":
+			return utils.NewBankSystemError(utils.ErrAccountNotFound, idNumber)
+		case "P0001":
+			return utils.NewBankSystemError(utils.ErrOverdraftLimitInUse, idNumber)
+		}
+	}
+	return err
+}
+
+func (r *accountRepositoryImpl) PostOverdraftCharges(ctx context.Context, date time.Time) ([]int64, error) {
+	rows, err := r.pool.Query(ctx, `SELECT post_overdraft_charges($1)`, pgtype.Date{Time: date, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int64])
+}
+
+// MAX_SERIALIZABLE_ATTEMPTS bounds how often a serializable transaction runs
+// when it keeps failing with a serialization failure.
+const MAX_SERIALIZABLE_ATTEMPTS = 5
+
+// serializationFailureCode is the SQLSTATE of a serializable transaction
+// that conflicted with a concurrent one and must be run again.
+const serializationFailureCode = "40001"
+
+// serializable runs fn in a serializable transaction and commits it. When a
+// statement or the commit fails with a serialization failure, nothing was
+// written, so the transaction is rolled back and run again after a short
+// random pause, up to MAX_SERIALIZABLE_ATTEMPTS times.
+func (r *accountRepositoryImpl) serializable(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	for attempt := 1; ; attempt++ {
+		err := r.runSerializable(ctx, fn)
+
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != serializationFailureCode || attempt == MAX_SERIALIZABLE_ATTEMPTS {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(rand.Int64N(int64(attempt) * int64(10*time.Millisecond)))):
+		}
+	}
+}
+
+func (r *accountRepositoryImpl) runSerializable(ctx context.Context, fn func(tx pgx.Tx) error) error {
 	txOptions := pgx.TxOptions{
 		IsoLevel:       pgx.Serializable,
 		AccessMode:     pgx.ReadWrite,
@@ -109,25 +394,43 @@ func (r *accountRepositoryImpl) DepositToAccount(
 	}
 
 	tx, err := r.pool.BeginTx(ctx, txOptions)
-
 	if err != nil {
-		return 0, 0, err
+		return err
 	}
 	defer tx.Rollback(ctx)
 
-	result, err := r.queries.WithTx(tx).DepositToAccount(ctx, sqlc.DepositToAccountParams{
-		AccountID: accountID,
-		Amount:    amount,
-		TxDetail:  detail,
-	})
-
-	if err != nil {
-		return 0, 0, err
+	if err := fn(tx); err != nil {
+		return err
 	}
+	return tx.Commit(ctx)
+}
 
-	if err = tx.Commit(ctx); err != nil {
-		return 0, 0, err
+// limitExceededCode is the SQLSTATE enforce_transaction_limits() raises when
+// a posting exceeds a limit.
+const limitExceededCode = "BKL01"
+
+// postingError maps a posting rejected by a limit to ErrLimitExceeded.
+func postingError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == limitExceededCode {
+		return utils.NewBankSystemError(utils.ErrLimitExceeded, pgErr.Message)
 	}
+	return err
+}
 
-	return result.TransactionID, result.NewBalance, nil
+func scanHold(row pgx.Row) (Hold, error) {
+	var hold Hold
+	err := row.Scan(
+		&hold.ID,
+		&hold.AccountID,
+		&hold.Amount,
+		&hold.CapturedAmount,
+		&hold.Status,
+		&hold.Detail,
+		&hold.TransactionID,
+		&hold.ExpiresAt,
+		&hold.CreatedAt,
+		&hold.UpdatedAt,
+	)
+	return hold, err
 }
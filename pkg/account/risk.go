@@ -0,0 +1,194 @@
+package account
+
+import (
+	"bank_system/utils"
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// The outcomes of a risk assessment, from the mildest.
+const (
+	RiskAllow  = "ALLOW"
+	RiskStepUp = "STEP_UP"
+	RiskReview = "REVIEW"
+	RiskBlock  = "BLOCK"
+)
+
+// The types of movements.
+const (
+	MovementWithdrawal = "WITHDRAWAL"
+	MovementTransfer   = "TRANSFER"
+)
+
+// Movement is a withdrawal or transfer about to be made, as a RiskAssessor
+// sees it. Callers set the type, the account number, the amount, the detail
+// and what identifies the recipient; AuthorizeMovement fills in the rest.
+type Movement struct {
+	Type             string
+	UserID           int64
+	AccountID        int64
+	AccountNumber    string
+	AccountCreatedAt time.Time
+	CurrencyCode     string
+	Amount           float64
+	Detail           string
+	ToAccountNumber  string
+	// PayeeID is the payee of a transfer to one, 0 otherwise.
+	PayeeID        int64
+	PayeeCreatedAt time.Time
+	PayeeVerified  bool
+	ClientIP       string
+	// HoldID is the hold a capture settles, 0 otherwise.
+	HoldID int64
+	// Scheduled is set for the movements of standing orders and bulk
+	// payments, made in the background with nobody to give a second factor.
+	Scheduled bool
+}
+
+// RiskDecision is how a RiskAssessor judged a movement. HoldFor is how long
+// a movement to review stays held, DefaultHoldTTL when 0.
+type RiskDecision struct {
+	ID      int64
+	Outcome string
+	Reasons []string
+	HoldFor time.Duration
+}
+
+// RiskAssessor judges movements before they are made and records its
+// decisions, see risk.Engine.
+type RiskAssessor interface {
+	Assess(ctx context.Context, movement Movement) (RiskDecision, error)
+	// HoldForReview puts the decision in the review queue with the hold
+	// that reserves its movement.
+	HoldForReview(ctx context.Context, decisionID, holdID int64) error
+	// CancelReview takes a decision pending review out of the queue; it
+	// fails with ErrRiskDecisionNotPending when it was reviewed first.
+	CancelReview(ctx context.Context, decisionID int64) error
+}
+
+// Review is a movement held for an operator to review instead of being made.
+type Review struct {
+	DecisionID int64    `json:"decision_id"`
+	HoldID     int64    `json:"hold_id"`
+	Reasons    []string `json:"reasons"`
+}
+
+// AuthorizeMovement decides whether movement may be made now. A transfer to
+// another user that does not name a payee must pass CheckRecipient first.
+// Without a risk assessor it is then AuthorizeStepUp. Otherwise a blocked
+// movement fails with ErrTransactionBlocked, a movement to review is held and
+// returned for the caller to respond with instead of making it, and one that
+// needs a step-up verifies code whatever the amount. A step-up nobody can
+// give, without a StepUpVerifier or for a scheduled movement, is a review.
+//
+// Captures and scheduled movements are not asked for the step-up of their
+// amount, given when the hold was placed or the movement was set up. A
+// capture to review gives its hold back for the one the review keeps.
+func (s *AccountService) AuthorizeMovement(ctx context.Context, movement Movement, code string) (*Review, error) {
+	if err := s.CheckRecipient(ctx, movement); err != nil {
+		return nil, err
+	}
+	if s.risk == nil {
+		return nil, s.authorizeAmount(ctx, movement, code)
+	}
+
+	account, err := s.getAccount(ctx, movement.AccountNumber)
+	if err != nil {
+		return nil, err
+	}
+	// Only movements that could be made are assessed and recorded.
+	if err := validateMoneyOperation(movement.Amount, account.CurrencyCode, movement.Detail); err != nil {
+		return nil, err
+	}
+	movement.UserID = account.UserID
+	movement.AccountID = account.ID
+	movement.AccountCreatedAt = account.CreatedAt.Time
+	movement.CurrencyCode = account.CurrencyCode
+	movement.ClientIP = utils.AuditMetadataFrom(ctx).ClientIP
+
+	decision, err := s.risk.Assess(ctx, movement)
+	if err != nil {
+		return nil, err
+	}
+	switch decision.Outcome {
+	case RiskBlock:
+		return nil, utils.NewBankSystemError(utils.ErrTransactionBlocked, strconv.FormatInt(decision.ID, 10))
+	case RiskStepUp:
+		if s.stepUp != nil && !movement.Scheduled {
+			return nil, s.verifyStepUp(ctx, account.UserID, code)
+		}
+		fallthrough
+	case RiskReview:
+		if movement.HoldID != 0 {
+			// A capture releases what it does not settle anyway.
+			if _, err := s.repo.ReleaseHold(ctx, account.ID, movement.HoldID); err != nil {
+				return nil, err
+			}
+		}
+		hold, err := s.PlaceHold(ctx, movement.AccountNumber, movement.Amount, movement.Detail, decision.HoldFor)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.risk.HoldForReview(ctx, decision.ID, hold.ID); err != nil {
+			// Nobody would review the hold, so it must not keep the money.
+			s.repo.ReleaseHold(ctx, account.ID, hold.ID)
+			return nil, err
+		}
+		return &Review{DecisionID: decision.ID, HoldID: hold.ID, Reasons: decision.Reasons}, nil
+	default:
+		return nil, s.authorizeAmount(ctx, movement, code)
+	}
+}
+
+// CancelReview gives up on a movement AuthorizeMovement held for review:
+// its decision leaves the review queue, then its hold is released. It fails
+// with ErrRiskDecisionNotPending when an operator reviewed the movement first.
+func (s *AccountService) CancelReview(ctx context.Context, idNumber string, review *Review) error {
+	if s.risk != nil {
+		if err := s.risk.CancelReview(ctx, review.DecisionID); err != nil {
+			return err
+		}
+	}
+	_, err := s.ReleaseHold(ctx, idNumber, review.HoldID)
+	if utils.IsBankSystemError(err, utils.ErrHoldNotActive) {
+		// The hold expired already.
+		return nil
+	}
+	return err
+}
+
+// authorizeAmount is AuthorizeStepUp for the movements whose owner did not
+// give the step-up for their amount beforehand.
+func (s *AccountService) authorizeAmount(ctx context.Context, movement Movement, code string) error {
+	if movement.HoldID != 0 || movement.Scheduled {
+		return nil
+	}
+	return s.AuthorizeStepUp(ctx, movement.AccountNumber, movement.Amount, code)
+}
+
+// CheckRecipient runs the recipient check on a transfer that does not name a
+// payee, unless it goes to another account of the same user. Callers that set
+// up transfers to be made later run it then, AuthorizeMovement again when
+// they are made.
+func (s *AccountService) CheckRecipient(ctx context.Context, movement Movement) error {
+	if s.recipients == nil || movement.Type != MovementTransfer || movement.PayeeID != 0 {
+		return nil
+	}
+	from, err := s.getAccount(ctx, movement.AccountNumber)
+	if err != nil {
+		return err
+	}
+	to, err := s.repo.GetAccountByIDNumber(ctx, movement.ToAccountNumber)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The transfer itself fails on the missing account.
+		return nil
+	}
+	if err != nil || to.UserID == from.UserID {
+		return err
+	}
+	return s.recipients.CheckRecipient(ctx, from.UserID, movement.ToAccountNumber, movement.Amount)
+}
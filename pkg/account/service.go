@@ -6,18 +6,70 @@ import (
 	"context"
 )
 
+const (
+	StatusActive   = "ACTIVE"
+	StatusInactive = "INACTIVE"
+	StatusClosed   = "CLOSED"
+	StatusFrozen   = "FROZEN"
+
+	DefaultCurrencyCode = "USD"
+)
+
+// StepUpVerifier verifies a second factor for the owner of an account.
+type StepUpVerifier interface {
+	VerifyStepUp(ctx context.Context, userID int64, code string) error
+}
+
+// RecipientChecker vets the recipient of a transfer to another user that
+// does not name a payee, see payee.RecipientCheck.
+type RecipientChecker interface {
+	CheckRecipient(ctx context.Context, userID int64, toIDNumber string, amount float64) error
+}
+
 type AccountService struct {
-	repo AccountRepository
+	repo            AccountRepository
+	stepUp          StepUpVerifier
+	stepUpThreshold float64
+	overdraft       OverdraftNotifier
+	fx              Quoter
+	risk            RiskAssessor
+	recipients      RecipientChecker
 }
 
-func NewAccountService(repo AccountRepository) *AccountService {
+// NewAccountService creates the service. Withdrawals and transfers above
+// stepUpThreshold need a verified second factor; a threshold of 0 disables the check.
+// overdraft, if not nil, is told when an account enters or leaves overdraft.
+// fx quotes transfers between accounts in different currencies; when nil such
+// transfers are refused. risk, if not nil, assesses withdrawals and transfers
+// authorized with AuthorizeMovement, and recipients, if not nil, vets the
+// recipients of those transfers.
+func NewAccountService(
+	repo AccountRepository, stepUp StepUpVerifier, stepUpThreshold float64, overdraft OverdraftNotifier, fx Quoter,
+	risk RiskAssessor, recipients RecipientChecker,
+) *AccountService {
 	return &AccountService{
-		repo: repo,
+		repo:            repo,
+		stepUp:          stepUp,
+		stepUpThreshold: stepUpThreshold,
+		overdraft:       overdraft,
+		fx:              fx,
+		risk:            risk,
+		recipients:      recipients,
 	}
 }
 
-func (s *AccountService) CreateAccount(ctx context.Context, userID int64) (*sqlc.BKAccount, error) {
-	account, err := s.repo.CreateAccount(ctx, userID)
+// CreateAccount opens an account in currencyCode, DefaultCurrencyCode when empty.
+func (s *AccountService) CreateAccount(ctx context.Context, userID int64, currencyCode string) (*sqlc.BKAccount, error) {
+	if currencyCode == "" {
+		currencyCode = DefaultCurrencyCode
+	}
+	verr := &utils.ValidationError{}
+	utils.ValidateCurrency(verr, "currency_code", currencyCode)
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
+	account, err := s.repo.CreateAccount(ctx, userID, currencyCode)
 	if err != nil {
 		return nil, err
 	}
@@ -69,12 +121,111 @@ func (s *AccountService) Withdraw(ctx context.Context, idNumber string, amount f
 	if err != nil {
 		return 0, 0, err
 	}
-	if account.Balance < amount {
-		return 0, 0, utils.NewBankSystemError(utils.ErrInsufficientBalance)
+	if err := validateMoneyOperation(amount, account.CurrencyCode, detail); err != nil {
+		return 0, 0, err
+	}
+	if err := s.checkAvailable(ctx, idNumber, amount); err != nil {
+		return 0, 0, err
+	}
+
+	txID, balance, err := s.repo.WithdrawFromAccount(ctx, account.ID, amount, detail)
+	if err != nil {
+		return 0, 0, err
 	}
-	return s.repo.WithdrawFromAccount(ctx, account.ID, amount, detail)
+	s.notifyOverdraft(ctx, account.ID, balance+amount, balance)
+	return txID, balance, nil
 }
 
+// Deposit validates amount with DEFAULT_MINOR_UNITS, use DepositByIDNumber
+// to check it against the currency of the account.
 func (s *AccountService) Deposit(ctx context.Context, accountID int64, amount float64, detail string) (int64, float64, error) {
-	return s.repo.DepositToAccount(ctx, accountID, amount, detail)
+	return s.deposit(ctx, accountID, "", amount, detail)
+}
+
+func (s *AccountService) DepositByIDNumber(ctx context.Context, idNumber string, amount float64, detail string) (int64, float64, error) {
+	account, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return 0, 0, err
+	}
+	return s.deposit(ctx, account.ID, account.CurrencyCode, amount, detail)
+}
+
+func (s *AccountService) deposit(
+	ctx context.Context, accountID int64, currency string, amount float64, detail string,
+) (int64, float64, error) {
+	if err := validateMoneyOperation(amount, currency, detail); err != nil {
+		return 0, 0, err
+	}
+
+	txID, balance, err := s.repo.DepositToAccount(ctx, accountID, amount, detail)
+	if err != nil {
+		return 0, 0, err
+	}
+	s.notifyOverdraft(ctx, accountID, balance-amount, balance)
+	return txID, balance, nil
+}
+
+// Transfer moves amount between two accounts in the same currency, or
+// converts it at a fresh quote when the currencies differ.
+func (s *AccountService) Transfer(
+	ctx context.Context, fromIDNumber, toIDNumber string, amount float64, detail string,
+) (int64, float64, error) {
+	txID, balance, _, err := s.TransferWithQuote(ctx, fromIDNumber, toIDNumber, amount, detail, "")
+	return txID, balance, err
+}
+
+// RequiresStepUp reports whether moving amount needs a second factor.
+func (s *AccountService) RequiresStepUp(amount float64) bool {
+	return s.stepUp != nil && s.stepUpThreshold > 0 && amount > s.stepUpThreshold
+}
+
+// AuthorizeStepUp verifies the account owner's second factor when amount is above the threshold.
+func (s *AccountService) AuthorizeStepUp(ctx context.Context, idNumber string, amount float64, code string) error {
+	if !s.RequiresStepUp(amount) {
+		return nil
+	}
+
+	account, err := s.repo.GetAccountByIDNumber(ctx, idNumber)
+	if err != nil {
+		return err
+	}
+	return s.verifyStepUp(ctx, account.UserID, code)
+}
+
+func (s *AccountService) verifyStepUp(ctx context.Context, userID int64, code string) error {
+	if code == "" {
+		return utils.NewBankSystemError(utils.ErrOTPRequired)
+	}
+	return s.stepUp.VerifyStepUp(ctx, userID, code)
+}
+
+// checkAvailable rejects amounts above the available balance, including the
+// overdraft limit, early; the stored functions check it again under a row lock.
+func (s *AccountService) checkAvailable(ctx context.Context, idNumber string, amount float64) error {
+	balances, err := s.repo.GetAccountBalances(ctx, idNumber)
+	if err != nil {
+		return err
+	}
+	if balances.Available < amount {
+		return utils.NewBankSystemError(utils.ErrInsufficientBalance)
+	}
+	return nil
+}
+
+func validateMoneyOperation(amount float64, currency, detail string) error {
+	verr := &utils.ValidationError{}
+	utils.ValidateAmount(verr, amount, currency)
+	utils.ValidateDetail(verr, detail)
+	return verr.Err()
+}
+
+func (s *AccountService) UpdateAccountStatus(ctx context.Context, idNumber, status string) error {
+	switch status {
+	case StatusActive, StatusInactive, StatusClosed, StatusFrozen:
+	default:
+		verr := &utils.ValidationError{}
+		verr.Add("status", "must be one of ACTIVE, INACTIVE, CLOSED, FROZEN")
+		return verr
+	}
+	return s.repo.UpdateAccountStatus(ctx, idNumber, status)
 }
@@ -0,0 +1,256 @@
+package aml
+
+import (
+	"bank_system/utils"
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AMLController struct {
+	service *AMLService
+	logger  *log.Logger
+}
+
+func NewAMLController(service *AMLService, logger *log.Logger) *AMLController {
+	return &AMLController{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// GetReports pages backwards through the reports with before_id and limit.
+func (c *AMLController) GetReports(ctx *gin.Context) {
+	verr := &utils.ValidationError{}
+	beforeID, limit := int64(0), 0
+	var err error
+	if value := ctx.Query("before_id"); value != "" {
+		if beforeID, err = strconv.ParseInt(value, 10, 64); err != nil {
+			verr.Add("before_id", "must be a report id")
+		}
+	}
+	if value := ctx.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil {
+			verr.Add("limit", "must be a number")
+		}
+	}
+	if err := verr.Err(); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	reports, err := c.service.GetReports(reqCtx, beforeID, limit)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, reports)
+}
+
+// GetReport sends a report with its cases as a download in the format of
+// the format query parameter, json or csv.
+func (c *AMLController) GetReport(ctx *gin.Context) {
+	id, ok := idParam(ctx, "report_id", "Invalid report id")
+	if !ok {
+		return
+	}
+	format := ctx.DefaultQuery("format", FormatJSON)
+	contentType, ok := ContentType(format)
+	if !ok {
+		verr := &utils.ValidationError{}
+		verr.Add("format", "must be one of json, csv")
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(verr))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	report, err := c.service.GetReport(reqCtx, id)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := Render(&buf, report, format); err != nil {
+		c.logger.Printf("Failed to render aml report: %v\n", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Header("Content-Disposition", `attachment; filename="`+ReportFilename(report, format)+`"`)
+	ctx.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// GetCases filters by the user_id, report_id, kind and status query
+// parameters and pages backwards with before_id and limit.
+func (c *AMLController) GetCases(ctx *gin.Context) {
+	filter := Filter{
+		Kind:   ctx.Query("kind"),
+		Status: ctx.Query("status"),
+	}
+
+	verr := &utils.ValidationError{}
+	var err error
+	if userID := ctx.Query("user_id"); userID != "" {
+		if filter.UserID, err = strconv.ParseInt(userID, 10, 64); err != nil {
+			verr.Add("user_id", "must be a user id")
+		}
+	}
+	if reportID := ctx.Query("report_id"); reportID != "" {
+		if filter.ReportID, err = strconv.ParseInt(reportID, 10, 64); err != nil {
+			verr.Add("report_id", "must be a report id")
+		}
+	}
+	if beforeID := ctx.Query("before_id"); beforeID != "" {
+		if filter.BeforeID, err = strconv.ParseInt(beforeID, 10, 64); err != nil {
+			verr.Add("before_id", "must be a case id")
+		}
+	}
+	if limit := ctx.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			verr.Add("limit", "must be a number")
+		}
+	}
+	if err := verr.Err(); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	cases, err := c.service.GetCases(reqCtx, filter)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, cases)
+}
+
+func (c *AMLController) GetCase(ctx *gin.Context) {
+	id, ok := idParam(ctx, "case_id", "Invalid case id")
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	found, err := c.service.GetCase(reqCtx, id)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, found)
+}
+
+func (c *AMLController) AddNote(ctx *gin.Context) {
+	id, ok := idParam(ctx, "case_id", "Invalid case id")
+	if !ok {
+		return
+	}
+
+	type NoteRequest struct {
+		Note string `json:"note" binding:"required"`
+	}
+
+	var req NoteRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	note, err := c.service.AddNote(reqCtx, id, req.Note)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, note)
+}
+
+func (c *AMLController) CloseCase(ctx *gin.Context) {
+	id, ok := idParam(ctx, "case_id", "Invalid case id")
+	if !ok {
+		return
+	}
+
+	type CloseRequest struct {
+		Resolution string `json:"resolution" binding:"required"`
+		Note       string `json:"note"`
+	}
+
+	var req CloseRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	closed, err := c.service.CloseCase(reqCtx, id, req.Resolution, req.Note)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, closed)
+}
+
+func idParam(ctx *gin.Context, name, message string) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Param(name), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return 0, false
+	}
+	return id, true
+}
+
+func errorStatus(err error) int {
+	switch {
+	case utils.IsValidationError(err):
+		return http.StatusBadRequest
+	case utils.IsBankSystemError(err, utils.ErrAMLCaseNotFound),
+		utils.IsBankSystemError(err, utils.ErrAMLReportNotFound):
+		return http.StatusNotFound
+	case utils.IsBankSystemError(err, utils.ErrAMLCaseClosed):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RegisterRoutes serves the reports and the cases behind the admin
+// middleware.
+func (c *AMLController) RegisterRoutes(router *gin.Engine, admin gin.HandlerFunc) {
+	group := router.Group("/admin/aml", admin)
+	{
+		group.GET("/reports", c.GetReports)
+		group.GET("/reports/:report_id", c.GetReport)
+		group.GET("/cases", c.GetCases)
+		group.GET("/cases/:case_id", c.GetCase)
+		group.POST("/cases/:case_id/notes", c.AddNote)
+		group.POST("/cases/:case_id/close", c.CloseCase)
+	}
+}
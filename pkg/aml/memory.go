@@ -0,0 +1,328 @@
+package aml
+
+import (
+	"bank_system/pkg/memstore"
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// memoryAMLRepository is an AMLRepository backed by a memstore.Store.
+type memoryAMLRepository struct {
+	store *memstore.Store
+}
+
+func NewMemoryAMLRepository(store *memstore.Store) AMLRepository {
+	return &memoryAMLRepository{store: store}
+}
+
+func (r *memoryAMLRepository) GetCashMovements(ctx context.Context, from, to time.Time, min float64) ([]Movement, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	movements := []Movement{}
+	for _, tx := range r.store.Transactions {
+		txType := string(tx.TxType)
+		if txType != "DEPOSIT" && txType != "WITHDRAW" ||
+			tx.CreatedAt.Time.Before(from) || !tx.CreatedAt.Time.Before(to) || tx.Amount < min {
+			continue
+		}
+		account, ok := r.store.Accounts[tx.AccountFrom]
+		if !ok {
+			continue
+		}
+		movements = append(movements, Movement{
+			TransactionID: tx.ID,
+			UserID:        account.UserID,
+			AccountNumber: account.IDNumber,
+			CurrencyCode:  account.CurrencyCode,
+			TxType:        txType,
+			Amount:        tx.Amount,
+			CreatedAt:     tx.CreatedAt.Time,
+		})
+	}
+	sort.Slice(movements, func(i, j int) bool {
+		if !movements[i].CreatedAt.Equal(movements[j].CreatedAt) {
+			return movements[i].CreatedAt.Before(movements[j].CreatedAt)
+		}
+		return movements[i].TransactionID < movements[j].TransactionID
+	})
+	return movements, nil
+}
+
+func (r *memoryAMLRepository) GetReportPeriods(ctx context.Context, since time.Time) ([]time.Time, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	periods := []time.Time{}
+	for _, record := range r.store.AMLReports {
+		if !record.PeriodStart.Before(since) {
+			periods = append(periods, record.PeriodStart)
+		}
+	}
+	sort.Slice(periods, func(i, j int) bool { return periods[i].Before(periods[j]) })
+	return periods, nil
+}
+
+func (r *memoryAMLRepository) CreateReport(ctx context.Context, report Report) (Report, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	for _, record := range r.store.AMLReports {
+		if record.PeriodStart.Equal(report.PeriodStart) && record.PeriodEnd.Equal(report.PeriodEnd) {
+			return r.getReport(record.ID)
+		}
+	}
+	for _, c := range report.Cases {
+		if _, ok := r.store.Users[c.UserID]; !ok {
+			return Report{}, errors.New(`insert on "BK_AML_Case" violates a foreign key constraint to "BK_User"`)
+		}
+	}
+
+	now := time.Now()
+	record := &memstore.AMLReportRecord{
+		ID:                       r.store.NextID("BK_AML_Report"),
+		PeriodStart:              report.PeriodStart,
+		PeriodEnd:                report.PeriodEnd,
+		Thresholds:               maps.Clone(report.Thresholds),
+		UnscannedCurrencies:      slices.Clone(report.UnscannedCurrencies),
+		StructuringMargin:        report.StructuringMargin,
+		StructuringCount:         report.StructuringCount,
+		StructuringWindowSeconds: report.StructuringWindowSeconds,
+		CreatedAt:                now,
+	}
+	r.store.AMLReports[record.ID] = record
+	r.store.Audit(ctx, "BK_AML_Report", record.ID, nil, *record)
+
+	for _, c := range report.Cases {
+		caseRecord := &memstore.AMLCaseRecord{
+			ID:             r.store.NextID("BK_AML_Case"),
+			ReportID:       record.ID,
+			UserID:         c.UserID,
+			Kind:           c.Kind,
+			TxType:         c.TxType,
+			CurrencyCode:   c.CurrencyCode,
+			Total:          c.Total,
+			TransactionIDs: slices.Clone(c.TransactionIDs),
+			AccountNumbers: slices.Clone(c.AccountNumbers),
+			PeriodStart:    c.PeriodStart,
+			PeriodEnd:      c.PeriodEnd,
+			Status:         CaseOpen,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		r.store.AMLCases[caseRecord.ID] = caseRecord
+		r.store.Audit(ctx, "BK_AML_Case", caseRecord.ID, nil, *caseRecord)
+	}
+
+	return r.getReport(record.ID)
+}
+
+func (r *memoryAMLRepository) GetReport(ctx context.Context, id int64) (Report, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	return r.getReport(id)
+}
+
+func (r *memoryAMLRepository) getReport(id int64) (Report, error) {
+	record, ok := r.store.AMLReports[id]
+	if !ok {
+		return Report{}, pgx.ErrNoRows
+	}
+
+	report := toReport(record)
+	for _, caseRecord := range r.store.AMLCases {
+		if caseRecord.ReportID == id {
+			report.Cases = append(report.Cases, toCase(caseRecord))
+		}
+	}
+	sort.Slice(report.Cases, func(i, j int) bool { return report.Cases[i].ID < report.Cases[j].ID })
+	return report, nil
+}
+
+func (r *memoryAMLRepository) GetReportsWithoutFiles(ctx context.Context) ([]int64, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	ids := []int64{}
+	for _, record := range r.store.AMLReports {
+		if !record.FilesWrittenAt.Valid {
+			ids = append(ids, record.ID)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (r *memoryAMLRepository) SetFilesWritten(ctx context.Context, id int64) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.AMLReports[id]
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	before := *record
+	record.FilesWrittenAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	r.store.Audit(ctx, "BK_AML_Report", record.ID, before, *record)
+	return nil
+}
+
+func (r *memoryAMLRepository) GetReports(ctx context.Context, beforeID int64, limit int) ([]Report, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	reports := []Report{}
+	for _, record := range r.store.AMLReports {
+		if beforeID == 0 || record.ID < beforeID {
+			reports = append(reports, toReport(record))
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].ID > reports[j].ID })
+	if len(reports) > limit {
+		reports = reports[:limit]
+	}
+	return reports, nil
+}
+
+func (r *memoryAMLRepository) GetCase(ctx context.Context, id int64) (Case, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	return r.getCase(id)
+}
+
+func (r *memoryAMLRepository) getCase(id int64) (Case, error) {
+	record, ok := r.store.AMLCases[id]
+	if !ok {
+		return Case{}, pgx.ErrNoRows
+	}
+
+	c := toCase(record)
+	for _, note := range r.store.AMLCaseNotes {
+		if note.CaseID == id {
+			c.Notes = append(c.Notes, toNote(note))
+		}
+	}
+	sort.Slice(c.Notes, func(i, j int) bool { return c.Notes[i].ID < c.Notes[j].ID })
+	return c, nil
+}
+
+func (r *memoryAMLRepository) GetCases(ctx context.Context, filter Filter) ([]Case, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	cases := []Case{}
+	for _, record := range r.store.AMLCases {
+		if filter.UserID > 0 && record.UserID != filter.UserID ||
+			filter.ReportID > 0 && record.ReportID != filter.ReportID ||
+			filter.Kind != "" && record.Kind != filter.Kind ||
+			filter.Status != "" && record.Status != filter.Status ||
+			filter.BeforeID > 0 && record.ID >= filter.BeforeID {
+			continue
+		}
+		cases = append(cases, toCase(record))
+	}
+	sort.Slice(cases, func(i, j int) bool { return cases[i].ID > cases[j].ID })
+	if len(cases) > filter.Limit {
+		cases = cases[:filter.Limit]
+	}
+	return cases, nil
+}
+
+func (r *memoryAMLRepository) AddNote(ctx context.Context, note Note) (Note, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	c, ok := r.store.AMLCases[note.CaseID]
+	if !ok || c.Status != CaseOpen {
+		return Note{}, pgx.ErrNoRows
+	}
+
+	record := &memstore.AMLCaseNoteRecord{
+		ID:        r.store.NextID("BK_AML_Case_Note"),
+		CaseID:    note.CaseID,
+		Author:    note.Author,
+		Note:      note.Note,
+		CreatedAt: time.Now(),
+	}
+	r.store.AMLCaseNotes[record.ID] = record
+	r.store.Audit(ctx, "BK_AML_Case_Note", record.ID, nil, *record)
+
+	return toNote(record), nil
+}
+
+func (r *memoryAMLRepository) CloseCase(ctx context.Context, c Case) (Case, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.AMLCases[c.ID]
+	if !ok || record.Status != CaseOpen {
+		return Case{}, pgx.ErrNoRows
+	}
+
+	before := *record
+	now := time.Now()
+	record.Status = CaseClosed
+	record.Resolution = c.Resolution
+	record.ClosedBy = c.ClosedBy
+	record.ClosedAt = pgtype.Timestamptz{Time: now, Valid: true}
+	record.UpdatedAt = now
+	r.store.Audit(ctx, "BK_AML_Case", record.ID, before, *record)
+
+	return r.getCase(c.ID)
+}
+
+func toReport(record *memstore.AMLReportRecord) Report {
+	return Report{
+		ID:                       record.ID,
+		PeriodStart:              record.PeriodStart,
+		PeriodEnd:                record.PeriodEnd,
+		Thresholds:               maps.Clone(record.Thresholds),
+		UnscannedCurrencies:      slices.Clone(record.UnscannedCurrencies),
+		StructuringMargin:        record.StructuringMargin,
+		StructuringCount:         record.StructuringCount,
+		StructuringWindowSeconds: record.StructuringWindowSeconds,
+		FilesWrittenAt:           record.FilesWrittenAt,
+		CreatedAt:                record.CreatedAt,
+	}
+}
+
+func toCase(record *memstore.AMLCaseRecord) Case {
+	return Case{
+		ID:             record.ID,
+		ReportID:       record.ReportID,
+		UserID:         record.UserID,
+		Kind:           record.Kind,
+		TxType:         record.TxType,
+		CurrencyCode:   record.CurrencyCode,
+		Total:          record.Total,
+		TransactionIDs: slices.Clone(record.TransactionIDs),
+		AccountNumbers: slices.Clone(record.AccountNumbers),
+		PeriodStart:    record.PeriodStart,
+		PeriodEnd:      record.PeriodEnd,
+		Status:         record.Status,
+		Resolution:     record.Resolution,
+		ClosedBy:       record.ClosedBy,
+		ClosedAt:       record.ClosedAt,
+		CreatedAt:      record.CreatedAt,
+		UpdatedAt:      record.UpdatedAt,
+	}
+}
+
+func toNote(record *memstore.AMLCaseNoteRecord) Note {
+	return Note{
+		ID:        record.ID,
+		CaseID:    record.CaseID,
+		Author:    record.Author,
+		Note:      record.Note,
+		CreatedAt: record.CreatedAt,
+	}
+}
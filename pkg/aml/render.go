@@ -0,0 +1,92 @@
+package aml
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+var contentTypes = map[string]string{
+	FormatJSON: "application/json",
+	FormatCSV:  "text/csv; charset=utf-8",
+}
+
+// ContentType returns the MIME type of format, and false for unknown formats.
+func ContentType(format string) (string, bool) {
+	contentType, ok := contentTypes[format]
+	return contentType, ok
+}
+
+// ReportFilename names report in format after its day, e.g.
+// "aml-report-2026-10-18.csv".
+func ReportFilename(report Report, format string) string {
+	return fmt.Sprintf("aml-report-%s.%s", report.PeriodStart.UTC().Format(time.DateOnly), format)
+}
+
+// Render writes report with its cases to w in format.
+func Render(w io.Writer, report Report, format string) error {
+	switch format {
+	case FormatJSON:
+		// Unlike the API, the file lists the cases even when there are none.
+		file := struct {
+			Report
+			Cases []Case `json:"cases"`
+		}{report, report.Cases}
+		if file.Cases == nil {
+			file.Cases = []Case{}
+		}
+		return json.NewEncoder(w).Encode(file)
+	case FormatCSV:
+		return renderCSV(w, report)
+	default:
+		return fmt.Errorf("unknown aml report format %q", format)
+	}
+}
+
+// renderCSV writes one row per case. The transactions and accounts of a case
+// are separated by spaces.
+func renderCSV(w io.Writer, report Report) error {
+	cw := csv.NewWriter(w)
+	rows := [][]string{
+		{
+			"case_id", "kind", "user_id", "tx_type", "currency_code", "total", "threshold", "transaction_count",
+			"transaction_ids", "account_numbers", "period_start", "period_end", "status", "resolution",
+		},
+	}
+	for _, c := range report.Cases {
+		ids := make([]string, len(c.TransactionIDs))
+		for i, id := range c.TransactionIDs {
+			ids[i] = strconv.FormatInt(id, 10)
+		}
+		rows = append(rows, []string{
+			strconv.FormatInt(c.ID, 10),
+			c.Kind,
+			strconv.FormatInt(c.UserID, 10),
+			c.TxType,
+			c.CurrencyCode,
+			strconv.FormatFloat(c.Total, 'f', 2, 64),
+			strconv.FormatFloat(report.Thresholds[c.CurrencyCode], 'f', 2, 64),
+			strconv.Itoa(len(c.TransactionIDs)),
+			strings.Join(ids, " "),
+			strings.Join(c.AccountNumbers, " "),
+			c.PeriodStart.UTC().Format(time.RFC3339),
+			c.PeriodEnd.UTC().Format(time.RFC3339),
+			c.Status,
+			c.Resolution,
+		})
+	}
+
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
@@ -0,0 +1,414 @@
+// Package aml reports cash deposits and withdrawals for anti-money laundering
+// compliance. A daily report scans the cash movements of every user across
+// their accounts, opens a case for those that reach the reporting threshold
+// or look structured to stay below it, and compliance annotates and closes
+// the cases.
+package aml
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	reportColumns = `id, period_start, period_end, thresholds, unscanned_currencies, structuring_margin,
+	structuring_count, structuring_window_seconds, files_written_at, created_at`
+	caseColumns = `id, report_id, user_id, kind, tx_type, currency_code, total, transaction_ids, account_numbers,
+	period_start, period_end, status, resolution, closed_by, closed_at, created_at, updated_at`
+	noteColumns = `id, case_id, author, note, created_at`
+)
+
+// Movement is a cash deposit or withdrawal of an account.
+type Movement struct {
+	TransactionID int64
+	UserID        int64
+	AccountNumber string
+	CurrencyCode  string
+	TxType        string
+	Amount        float64
+	CreatedAt     time.Time
+}
+
+// Report is the scan of the cash movements made from PeriodStart up to, but
+// not including, PeriodEnd, with the thresholds it was made with by currency.
+// UnscannedCurrencies are the currencies of the cash movements that were not
+// scanned for want of a threshold. FilesWrittenAt is when the report was
+// written to the report directory. Cases is only set on a single report.
+type Report struct {
+	ID                       int64              `json:"id"`
+	PeriodStart              time.Time          `json:"period_start"`
+	PeriodEnd                time.Time          `json:"period_end"`
+	Thresholds               map[string]float64 `json:"thresholds"`
+	UnscannedCurrencies      []string           `json:"unscanned_currencies"`
+	StructuringMargin        float64            `json:"structuring_margin"`
+	StructuringCount         int                `json:"structuring_count"`
+	StructuringWindowSeconds int64              `json:"structuring_window_seconds"`
+	FilesWrittenAt           pgtype.Timestamptz `json:"files_written_at"`
+	CreatedAt                time.Time          `json:"created_at"`
+	Cases                    []Case             `json:"cases,omitempty"`
+}
+
+// Case is the cash movements of one user in one currency and direction that
+// a report flagged. Notes is only set on a single case.
+type Case struct {
+	ID             int64              `json:"id"`
+	ReportID       int64              `json:"report_id"`
+	UserID         int64              `json:"user_id"`
+	Kind           string             `json:"kind"`
+	TxType         string             `json:"tx_type"`
+	CurrencyCode   string             `json:"currency_code"`
+	Total          float64            `json:"total"`
+	TransactionIDs []int64            `json:"transaction_ids"`
+	AccountNumbers []string           `json:"account_numbers"`
+	PeriodStart    time.Time          `json:"period_start"`
+	PeriodEnd      time.Time          `json:"period_end"`
+	Status         string             `json:"status"`
+	Resolution     string             `json:"resolution,omitempty"`
+	ClosedBy       string             `json:"closed_by,omitempty"`
+	ClosedAt       pgtype.Timestamptz `json:"closed_at"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+	Notes          []Note             `json:"notes,omitempty"`
+}
+
+type Note struct {
+	ID        int64     `json:"id"`
+	CaseID    int64     `json:"case_id"`
+	Author    string    `json:"author"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Filter struct {
+	UserID   int64
+	ReportID int64
+	Kind     string
+	Status   string
+	BeforeID int64
+	Limit    int
+}
+
+type AMLRepository interface {
+	// GetCashMovements returns the deposits and withdrawals made in
+	// [from, to) of at least min, oldest first.
+	GetCashMovements(ctx context.Context, from, to time.Time, min float64) ([]Movement, error)
+	// GetReportPeriods returns the start of the period of every report
+	// that starts from since.
+	GetReportPeriods(ctx context.Context, since time.Time) ([]time.Time, error)
+	// CreateReport stores report and its cases together, or returns the one
+	// already stored for the period.
+	CreateReport(ctx context.Context, report Report) (Report, error)
+	// GetReport returns the report with its cases.
+	GetReport(ctx context.Context, id int64) (Report, error)
+	// GetReportsWithoutFiles returns the ids of the reports whose files were
+	// not written, oldest first.
+	GetReportsWithoutFiles(ctx context.Context) ([]int64, error)
+	// SetFilesWritten records that the files of the report were written.
+	SetFilesWritten(ctx context.Context, id int64) error
+	// GetReports returns up to limit reports before beforeID, or the latest
+	// when it is 0, newest first.
+	GetReports(ctx context.Context, beforeID int64, limit int) ([]Report, error)
+	// GetCase returns the case with its notes.
+	GetCase(ctx context.Context, id int64) (Case, error)
+	// GetCases returns up to filter.Limit cases matching filter, newest
+	// first.
+	GetCases(ctx context.Context, filter Filter) ([]Case, error)
+	// AddNote adds note to its open case. It returns pgx.ErrNoRows when the
+	// case is not open.
+	AddNote(ctx context.Context, note Note) (Note, error)
+	// CloseCase stores the resolution and closer of an open case. It returns
+	// pgx.ErrNoRows when the case is not open.
+	CloseCase(ctx context.Context, c Case) (Case, error)
+}
+
+type amlRepositoryImpl struct {
+	pool *pgxpool.Pool
+}
+
+func NewAMLRepository(pool *pgxpool.Pool) AMLRepository {
+	return &amlRepositoryImpl{pool: pool}
+}
+
+func (r *amlRepositoryImpl) GetCashMovements(ctx context.Context, from, to time.Time, min float64) ([]Movement, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT t.id, a.user_id, a.id_number, a.currency_code, t.tx_type, t.amount, t.created_at
+		FROM "BK_Transaction" t
+		JOIN "BK_Account" a ON a.id = t.account_from
+		WHERE t.tx_type IN ('DEPOSIT', 'WITHDRAW') AND t.created_at >= $1 AND t.created_at < $2 AND t.amount >= $3
+		ORDER BY t.created_at, t.id`,
+		from, to, min,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Movement, error) {
+		var movement Movement
+		err := row.Scan(
+			&movement.TransactionID,
+			&movement.UserID,
+			&movement.AccountNumber,
+			&movement.CurrencyCode,
+			&movement.TxType,
+			&movement.Amount,
+			&movement.CreatedAt,
+		)
+		return movement, err
+	})
+}
+
+func (r *amlRepositoryImpl) GetReportPeriods(ctx context.Context, since time.Time) ([]time.Time, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT period_start FROM "BK_AML_Report" WHERE period_start >= $1 ORDER BY period_start`, since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[time.Time])
+}
+
+func (r *amlRepositoryImpl) CreateReport(ctx context.Context, report Report) (Report, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO "BK_AML_Report" (
+			period_start, period_end, thresholds, unscanned_currencies, structuring_margin, structuring_count,
+			structuring_window_seconds
+		)
+		VALUES ($1, $2, COALESCE($3::JSONB, '{}'), COALESCE($4::TEXT[], '{}'), $5, $6, $7)
+		ON CONFLICT (period_start, period_end) DO NOTHING
+		RETURNING id`,
+		report.PeriodStart, report.PeriodEnd, report.Thresholds, report.UnscannedCurrencies, report.StructuringMargin,
+		report.StructuringCount, report.StructuringWindowSeconds,
+	).Scan(&report.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Another instance made the report first.
+		err = r.pool.QueryRow(ctx,
+			`SELECT id FROM "BK_AML_Report" WHERE period_start = $1 AND period_end = $2`,
+			report.PeriodStart, report.PeriodEnd,
+		).Scan(&report.ID)
+		if err != nil {
+			return Report{}, err
+		}
+		return r.GetReport(ctx, report.ID)
+	}
+	if err != nil {
+		return Report{}, err
+	}
+
+	for _, c := range report.Cases {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO "BK_AML_Case" (
+				report_id, user_id, kind, tx_type, currency_code, total, transaction_ids, account_numbers,
+				period_start, period_end
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			report.ID, c.UserID, c.Kind, c.TxType, c.CurrencyCode, c.Total, c.TransactionIDs, c.AccountNumbers,
+			c.PeriodStart, c.PeriodEnd,
+		)
+		if err != nil {
+			return Report{}, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Report{}, err
+	}
+	return r.GetReport(ctx, report.ID)
+}
+
+func (r *amlRepositoryImpl) GetReport(ctx context.Context, id int64) (Report, error) {
+	report, err := scanReport(r.pool.QueryRow(ctx, `SELECT `+reportColumns+` FROM "BK_AML_Report" WHERE id = $1`, id))
+	if err != nil {
+		return Report{}, err
+	}
+
+	rows, err := r.pool.Query(ctx, `SELECT `+caseColumns+` FROM "BK_AML_Case" WHERE report_id = $1 ORDER BY id`, id)
+	if err != nil {
+		return Report{}, err
+	}
+	report.Cases, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (Case, error) {
+		return scanCase(row)
+	})
+	if err != nil {
+		return Report{}, err
+	}
+	return report, nil
+}
+
+func (r *amlRepositoryImpl) GetReportsWithoutFiles(ctx context.Context) ([]int64, error) {
+	rows, err := r.pool.Query(ctx, `SELECT id FROM "BK_AML_Report" WHERE files_written_at IS NULL ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int64])
+}
+
+func (r *amlRepositoryImpl) SetFilesWritten(ctx context.Context, id int64) error {
+	tag, err := r.pool.Exec(ctx, `UPDATE "BK_AML_Report" SET files_written_at = NOW() WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (r *amlRepositoryImpl) GetReports(ctx context.Context, beforeID int64, limit int) ([]Report, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+reportColumns+` FROM "BK_AML_Report"
+		WHERE $1 = 0 OR id < $1
+		ORDER BY id DESC LIMIT $2`,
+		beforeID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Report, error) {
+		return scanReport(row)
+	})
+}
+
+func (r *amlRepositoryImpl) GetCase(ctx context.Context, id int64) (Case, error) {
+	c, err := scanCase(r.pool.QueryRow(ctx, `SELECT `+caseColumns+` FROM "BK_AML_Case" WHERE id = $1`, id))
+	if err != nil {
+		return Case{}, err
+	}
+
+	rows, err := r.pool.Query(ctx, `SELECT `+noteColumns+` FROM "BK_AML_Case_Note" WHERE case_id = $1 ORDER BY id`, id)
+	if err != nil {
+		return Case{}, err
+	}
+	c.Notes, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (Note, error) {
+		return scanNote(row)
+	})
+	if err != nil {
+		return Case{}, err
+	}
+	return c, nil
+}
+
+func (r *amlRepositoryImpl) GetCases(ctx context.Context, filter Filter) ([]Case, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if filter.UserID > 0 {
+		where("user_id = ?", filter.UserID)
+	}
+	if filter.ReportID > 0 {
+		where("report_id = ?", filter.ReportID)
+	}
+	if filter.Kind != "" {
+		where("kind::TEXT = ?", filter.Kind)
+	}
+	if filter.Status != "" {
+		where("status::TEXT = ?", filter.Status)
+	}
+	if filter.BeforeID > 0 {
+		where("id < ?", filter.BeforeID)
+	}
+
+	query := `SELECT ` + caseColumns + ` FROM "BK_AML_Case"`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT $%d`, len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Case, error) {
+		return scanCase(row)
+	})
+}
+
+func (r *amlRepositoryImpl) AddNote(ctx context.Context, note Note) (Note, error) {
+	return scanNote(r.pool.QueryRow(ctx,
+		`INSERT INTO "BK_AML_Case_Note" (case_id, author, note)
+		SELECT id, $2, $3 FROM "BK_AML_Case" WHERE id = $1 AND status = 'OPEN'
+		RETURNING `+noteColumns,
+		note.CaseID, note.Author, note.Note,
+	))
+}
+
+func (r *amlRepositoryImpl) CloseCase(ctx context.Context, c Case) (Case, error) {
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE "BK_AML_Case"
+		SET status = 'CLOSED', resolution = $2, closed_by = $3, closed_at = NOW()
+		WHERE id = $1 AND status = 'OPEN'`,
+		c.ID, c.Resolution, c.ClosedBy,
+	)
+	if err != nil {
+		return Case{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return Case{}, pgx.ErrNoRows
+	}
+	return r.GetCase(ctx, c.ID)
+}
+
+func scanReport(row pgx.Row) (Report, error) {
+	var report Report
+	err := row.Scan(
+		&report.ID,
+		&report.PeriodStart,
+		&report.PeriodEnd,
+		&report.Thresholds,
+		&report.UnscannedCurrencies,
+		&report.StructuringMargin,
+		&report.StructuringCount,
+		&report.StructuringWindowSeconds,
+		&report.FilesWrittenAt,
+		&report.CreatedAt,
+	)
+	return report, err
+}
+
+func scanCase(row pgx.Row) (Case, error) {
+	var c Case
+	err := row.Scan(
+		&c.ID,
+		&c.ReportID,
+		&c.UserID,
+		&c.Kind,
+		&c.TxType,
+		&c.CurrencyCode,
+		&c.Total,
+		&c.TransactionIDs,
+		&c.AccountNumbers,
+		&c.PeriodStart,
+		&c.PeriodEnd,
+		&c.Status,
+		&c.Resolution,
+		&c.ClosedBy,
+		&c.ClosedAt,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	)
+	return c, err
+}
+
+func scanNote(row pgx.Row) (Note, error) {
+	var note Note
+	err := row.Scan(&note.ID, &note.CaseID, &note.Author, &note.Note, &note.CreatedAt)
+	return note, err
+}
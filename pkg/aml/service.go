@@ -0,0 +1,430 @@
+package aml
+
+import (
+	"bank_system/pkg/account"
+	"bank_system/utils"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// The kinds of cases.
+const (
+	KindLargeCash   = "LARGE_CASH"
+	KindStructuring = "STRUCTURING"
+)
+
+// The statuses and resolutions of cases.
+const (
+	CaseOpen   = "OPEN"
+	CaseClosed = "CLOSED"
+
+	ResolutionReported  = "REPORTED"
+	ResolutionDismissed = "DISMISSED"
+)
+
+const (
+	DefaultLimit     = 100
+	MaxLimit         = 1000
+	DefaultThreshold = 10000
+	NOTE_MAX_LENGTH  = 1000
+)
+
+// Config sets what the reports flag. Amounts are in the currency of each
+// account.
+type Config struct {
+	// Thresholds is, by currency, the total of a user's cash deposits, or
+	// withdrawals, in the currency within a day from which they are
+	// reported, DefaultThreshold in account.DefaultCurrencyCode when empty.
+	// The cash in other currencies is not scanned, and the reports say so.
+	Thresholds map[string]float64
+	// Movements from a threshold less StructuringMargin, as a fraction of
+	// it, up to the threshold are just below it, 0.1 when 0.
+	StructuringMargin float64
+	// StructuringCount movements just below the threshold within
+	// StructuringWindow make a structuring case, 3 within 7 days when 0.
+	StructuringCount  int
+	StructuringWindow time.Duration
+	// Backfill is how many days before today GenerateReports makes the
+	// missing reports of, 7 when 0.
+	Backfill int
+	// ReportDir is where every report is written as CSV and JSON, nowhere
+	// when empty.
+	ReportDir string
+}
+
+type AMLService struct {
+	repo   AMLRepository
+	config Config
+}
+
+func NewAMLService(repo AMLRepository, config Config) *AMLService {
+	if len(config.Thresholds) == 0 {
+		config.Thresholds = map[string]float64{account.DefaultCurrencyCode: DefaultThreshold}
+	}
+	if config.StructuringMargin <= 0 || config.StructuringMargin >= 1 {
+		config.StructuringMargin = 0.1
+	}
+	if config.StructuringCount <= 0 {
+		config.StructuringCount = 3
+	}
+	if config.StructuringWindow <= 0 {
+		config.StructuringWindow = 7 * 24 * time.Hour
+	}
+	if config.Backfill <= 0 {
+		config.Backfill = 7
+	}
+
+	return &AMLService{
+		repo:   repo,
+		config: config,
+	}
+}
+
+// GenerateReports makes the missing reports of the Backfill UTC days before
+// the one of now, and returns how many it made. It then writes the files of
+// every report that has none yet, so that a report whose files could not be
+// written is written by a later call.
+func (s *AMLService) GenerateReports(ctx context.Context, now time.Time) (int, error) {
+	today := startOfDay(now)
+	first := today.AddDate(0, 0, -s.config.Backfill)
+	periods, err := s.repo.GetReportPeriods(ctx, first)
+	if err != nil {
+		return 0, err
+	}
+
+	generated := 0
+	for day := first; day.Before(today); day = day.AddDate(0, 0, 1) {
+		if slices.ContainsFunc(periods, day.Equal) {
+			continue
+		}
+		report, err := s.scan(ctx, day, day.AddDate(0, 0, 1))
+		if err != nil {
+			return generated, err
+		}
+		if _, err := s.repo.CreateReport(ctx, report); err != nil {
+			return generated, err
+		}
+		generated++
+	}
+	return generated, s.writeMissingFiles(ctx)
+}
+
+// caseKey groups the movements of a case.
+type caseKey struct {
+	userID       int64
+	currencyCode string
+	txType       string
+}
+
+// scan finds the cases of the cash movements made in [from, to): the users
+// whose deposits, or withdrawals, in a currency add up to its threshold, and
+// those with enough movements just below it within the structuring window
+// ending at to, one of them in the period.
+func (s *AMLService) scan(ctx context.Context, from, to time.Time) (Report, error) {
+	floors := make(map[string]float64, len(s.config.Thresholds))
+	lowest := math.Inf(1)
+	for code, threshold := range s.config.Thresholds {
+		floors[code] = round(threshold * (1 - s.config.StructuringMargin))
+		lowest = min(lowest, floors[code])
+	}
+	justBelow := func(movement Movement) bool {
+		threshold, ok := s.config.Thresholds[movement.CurrencyCode]
+		return ok && movement.Amount >= floors[movement.CurrencyCode] && movement.Amount < threshold
+	}
+	windowStart := to.Add(-s.config.StructuringWindow)
+	if windowStart.After(from) {
+		windowStart = from
+	}
+
+	movements, err := s.repo.GetCashMovements(ctx, from, to, 0)
+	if err != nil {
+		return Report{}, err
+	}
+	earlier, err := s.repo.GetCashMovements(ctx, windowStart, from, lowest)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{
+		PeriodStart:              from,
+		PeriodEnd:                to,
+		Thresholds:               s.config.Thresholds,
+		UnscannedCurrencies:      []string{},
+		StructuringMargin:        s.config.StructuringMargin,
+		StructuringCount:         s.config.StructuringCount,
+		StructuringWindowSeconds: int64(s.config.StructuringWindow / time.Second),
+		Cases:                    []Case{},
+	}
+	var (
+		period = map[caseKey][]Movement{}
+		below  = map[caseKey][]Movement{}
+		recent = map[caseKey]bool{}
+	)
+	for _, movement := range earlier {
+		if justBelow(movement) {
+			key := caseKey{movement.UserID, movement.CurrencyCode, movement.TxType}
+			below[key] = append(below[key], movement)
+		}
+	}
+	for _, movement := range movements {
+		if _, ok := s.config.Thresholds[movement.CurrencyCode]; !ok {
+			if !slices.Contains(report.UnscannedCurrencies, movement.CurrencyCode) {
+				report.UnscannedCurrencies = append(report.UnscannedCurrencies, movement.CurrencyCode)
+			}
+			continue
+		}
+		key := caseKey{movement.UserID, movement.CurrencyCode, movement.TxType}
+		period[key] = append(period[key], movement)
+		if justBelow(movement) {
+			below[key] = append(below[key], movement)
+			recent[key] = true
+		}
+	}
+	slices.Sort(report.UnscannedCurrencies)
+
+	for key, flagged := range period {
+		c := newCase(KindLargeCash, key, flagged, from, to)
+		if c.Total >= s.config.Thresholds[key.currencyCode] {
+			report.Cases = append(report.Cases, c)
+		}
+	}
+	for key, flagged := range below {
+		if recent[key] && len(flagged) >= s.config.StructuringCount {
+			report.Cases = append(report.Cases, newCase(KindStructuring, key, flagged, windowStart, to))
+		}
+	}
+	sort.Slice(report.Cases, func(i, j int) bool {
+		a, b := report.Cases[i], report.Cases[j]
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		if a.CurrencyCode != b.CurrencyCode {
+			return a.CurrencyCode < b.CurrencyCode
+		}
+		if a.TxType != b.TxType {
+			return a.TxType < b.TxType
+		}
+		return a.Kind < b.Kind
+	})
+	return report, nil
+}
+
+func newCase(kind string, key caseKey, movements []Movement, from, to time.Time) Case {
+	c := Case{
+		UserID:         key.userID,
+		Kind:           kind,
+		TxType:         key.txType,
+		CurrencyCode:   key.currencyCode,
+		TransactionIDs: []int64{},
+		AccountNumbers: []string{},
+		PeriodStart:    from,
+		PeriodEnd:      to,
+		Status:         CaseOpen,
+	}
+	for _, movement := range movements {
+		c.Total += movement.Amount
+		c.TransactionIDs = append(c.TransactionIDs, movement.TransactionID)
+		if !slices.Contains(c.AccountNumbers, movement.AccountNumber) {
+			c.AccountNumbers = append(c.AccountNumbers, movement.AccountNumber)
+		}
+	}
+	c.Total = round(c.Total)
+	slices.Sort(c.AccountNumbers)
+	return c
+}
+
+// writeMissingFiles writes the reports whose files were not written to the
+// report directory.
+func (s *AMLService) writeMissingFiles(ctx context.Context) error {
+	if s.config.ReportDir == "" {
+		return nil
+	}
+
+	ids, err := s.repo.GetReportsWithoutFiles(ctx)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		report, err := s.repo.GetReport(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.writeFiles(report); err != nil {
+			return err
+		}
+		if err := s.repo.SetFilesWritten(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFiles writes report to the report directory as CSV and JSON. Each
+// file is renamed into place once written, so that readers never see half
+// of one.
+func (s *AMLService) writeFiles(report Report) error {
+	if err := os.MkdirAll(s.config.ReportDir, 0o750); err != nil {
+		return err
+	}
+
+	for _, format := range []string{FormatCSV, FormatJSON} {
+		f, err := os.CreateTemp(s.config.ReportDir, ".aml-report-*")
+		if err != nil {
+			return err
+		}
+		err = Render(f, report, format)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), filepath.Join(s.config.ReportDir, ReportFilename(report, format)))
+		}
+		if err != nil {
+			os.Remove(f.Name())
+			return fmt.Errorf("write aml report %d: %w", report.ID, err)
+		}
+	}
+	return nil
+}
+
+// GetReports returns the reports before beforeID, newest first, without
+// their cases, and DefaultLimit of them when limit is 0.
+func (s *AMLService) GetReports(ctx context.Context, beforeID int64, limit int) ([]Report, error) {
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+	if err := validateLimit(limit); err != nil {
+		return nil, err
+	}
+	return s.repo.GetReports(ctx, beforeID, limit)
+}
+
+func (s *AMLService) GetReport(ctx context.Context, id int64) (Report, error) {
+	report, err := s.repo.GetReport(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Report{}, utils.NewBankSystemError(utils.ErrAMLReportNotFound, strconv.FormatInt(id, 10))
+	}
+	return report, err
+}
+
+// GetCases returns the cases matching filter, newest first, and
+// DefaultLimit of them when filter.Limit is 0.
+func (s *AMLService) GetCases(ctx context.Context, filter Filter) ([]Case, error) {
+	if filter.Limit == 0 {
+		filter.Limit = DefaultLimit
+	}
+
+	verr := &utils.ValidationError{}
+	switch filter.Kind {
+	case "", KindLargeCash, KindStructuring:
+	default:
+		verr.Add("kind", "must be one of LARGE_CASH, STRUCTURING")
+	}
+	switch filter.Status {
+	case "", CaseOpen, CaseClosed:
+	default:
+		verr.Add("status", "must be one of OPEN, CLOSED")
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+	if err := validateLimit(filter.Limit); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetCases(ctx, filter)
+}
+
+func (s *AMLService) GetCase(ctx context.Context, id int64) (Case, error) {
+	c, err := s.repo.GetCase(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Case{}, utils.NewBankSystemError(utils.ErrAMLCaseNotFound, strconv.FormatInt(id, 10))
+	}
+	return c, err
+}
+
+// AddNote annotates an open case as the actor of ctx.
+func (s *AMLService) AddNote(ctx context.Context, id int64, text string) (Note, error) {
+	verr := &utils.ValidationError{}
+	if n := len([]rune(text)); n < 1 || n > NOTE_MAX_LENGTH {
+		verr.Add("note", fmt.Sprintf("must be between 1 and %d characters", NOTE_MAX_LENGTH))
+	}
+	if err := verr.Err(); err != nil {
+		return Note{}, err
+	}
+
+	if _, err := s.GetCase(ctx, id); err != nil {
+		return Note{}, err
+	}
+	note, err := s.repo.AddNote(ctx, Note{
+		CaseID: id,
+		Author: utils.AuditMetadataFrom(ctx).Actor,
+		Note:   text,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Note{}, utils.NewBankSystemError(utils.ErrAMLCaseClosed, strconv.FormatInt(id, 10))
+	}
+	return note, err
+}
+
+// CloseCase closes an open case as REPORTED to the authorities or
+// DISMISSED, after adding note to it unless it is empty.
+func (s *AMLService) CloseCase(ctx context.Context, id int64, resolution, note string) (Case, error) {
+	verr := &utils.ValidationError{}
+	switch resolution {
+	case ResolutionReported, ResolutionDismissed:
+	default:
+		verr.Add("resolution", "must be one of REPORTED, DISMISSED")
+	}
+	if len([]rune(note)) > NOTE_MAX_LENGTH {
+		verr.Add("note", fmt.Sprintf("must be at most %d characters", NOTE_MAX_LENGTH))
+	}
+	if err := verr.Err(); err != nil {
+		return Case{}, err
+	}
+
+	if note != "" {
+		if _, err := s.AddNote(ctx, id, note); err != nil {
+			return Case{}, err
+		}
+	} else if _, err := s.GetCase(ctx, id); err != nil {
+		return Case{}, err
+	}
+
+	closed, err := s.repo.CloseCase(ctx, Case{
+		ID:         id,
+		Resolution: resolution,
+		ClosedBy:   utils.AuditMetadataFrom(ctx).Actor,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Case{}, utils.NewBankSystemError(utils.ErrAMLCaseClosed, strconv.FormatInt(id, 10))
+	}
+	return closed, err
+}
+
+func validateLimit(limit int) error {
+	verr := &utils.ValidationError{}
+	if limit < 1 || limit > MaxLimit {
+		verr.Add("limit", fmt.Sprintf("must be between 1 and %d", MaxLimit))
+	}
+	return verr.Err()
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
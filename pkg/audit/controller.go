@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"bank_system/utils"
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditController struct {
+	service *AuditService
+	logger  *log.Logger
+}
+
+func NewAuditController(service *AuditService, logger *log.Logger) *AuditController {
+	return &AuditController{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// GetEntries filters by the actor, action, operation, target_table,
+// target_id and request_id query parameters, by created_at with from and to
+// as RFC 3339 times, and pages backwards with before_id and limit.
+func (c *AuditController) GetEntries(ctx *gin.Context) {
+	filter, ok := filterParams(ctx)
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	entries, err := c.service.GetEntries(reqCtx, filter)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, entries)
+}
+
+func (c *AuditController) Verify(ctx *gin.Context) {
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT_STREAM)
+	defer cancel()
+
+	verification, err := c.service.Verify(reqCtx)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+	if !verification.Valid {
+		c.logger.Printf("Audit log hash chain is broken at seq %d: %s\n", verification.BrokenSeq, verification.Reason)
+	}
+
+	ctx.JSON(http.StatusOK, verification)
+}
+
+func filterParams(ctx *gin.Context) (Filter, bool) {
+	filter := Filter{
+		Actor:       ctx.Query("actor"),
+		Action:      ctx.Query("action"),
+		Operation:   ctx.Query("operation"),
+		TargetTable: ctx.Query("target_table"),
+		TargetID:    ctx.Query("target_id"),
+		RequestID:   ctx.Query("request_id"),
+	}
+
+	verr := &utils.ValidationError{}
+	var err error
+	if from := ctx.Query("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			verr.Add("from", "must be an RFC 3339 time")
+		}
+	}
+	if to := ctx.Query("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			verr.Add("to", "must be an RFC 3339 time")
+		}
+	}
+	if beforeID := ctx.Query("before_id"); beforeID != "" {
+		if filter.BeforeID, err = strconv.ParseInt(beforeID, 10, 64); err != nil {
+			verr.Add("before_id", "must be an entry id")
+		}
+	}
+	if limit := ctx.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			verr.Add("limit", "must be a number")
+		}
+	}
+	if err := verr.Err(); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return Filter{}, false
+	}
+	return filter, true
+}
+
+func errorStatus(err error) int {
+	switch {
+	case utils.IsValidationError(err):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RegisterRoutes serves the audit log behind the admin middleware.
+func (c *AuditController) RegisterRoutes(router *gin.Engine, admin gin.HandlerFunc) {
+	group := router.Group("/admin/audit", admin)
+	{
+		group.GET("", c.GetEntries)
+		group.GET("/verify", c.Verify)
+	}
+}
@@ -0,0 +1,157 @@
+package audit
+
+import (
+	"bank_system/pkg/memstore"
+	"context"
+	"fmt"
+)
+
+// memoryAuditRepository is an AuditRepository backed by a memstore.Store,
+// whose repositories write the entries.
+type memoryAuditRepository struct {
+	store *memstore.Store
+}
+
+func NewMemoryAuditRepository(store *memstore.Store) AuditRepository {
+	return &memoryAuditRepository{store: store}
+}
+
+func (r *memoryAuditRepository) GetEntries(ctx context.Context, filter Filter) ([]Entry, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	entries := []Entry{}
+	for i := len(r.store.AuditLog) - 1; i >= 0 && len(entries) < filter.Limit; i-- {
+		record := r.store.AuditLog[i]
+		if matches(record, filter) {
+			entries = append(entries, toEntry(record))
+		}
+	}
+	return entries, nil
+}
+
+func (r *memoryAuditRepository) GetChainHead(ctx context.Context) (Entry, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	var head *memstore.AuditRecord
+	for _, record := range r.store.AuditLog {
+		if record.Seq.Valid && (head == nil || record.Seq.Int64 > head.Seq.Int64) {
+			head = record
+		}
+	}
+	if head == nil {
+		return Entry{}, nil
+	}
+	return toEntry(head), nil
+}
+
+func (r *memoryAuditRepository) GetUnsealedEntries(ctx context.Context, limit int) ([]Entry, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	// Every change is done once it released Mu, so every entry can be sealed.
+	entries := []Entry{}
+	for _, record := range r.store.AuditLog {
+		if len(entries) == limit {
+			break
+		}
+		if !record.Seq.Valid {
+			entries = append(entries, toEntry(record))
+		}
+	}
+	return entries, nil
+}
+
+func (r *memoryAuditRepository) SealEntries(ctx context.Context, entries []Entry) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	records := make(map[int64]*memstore.AuditRecord, len(r.store.AuditLog))
+	seqs := map[int64]bool{}
+	for _, record := range r.store.AuditLog {
+		records[record.ID] = record
+		if record.Seq.Valid {
+			seqs[record.Seq.Int64] = true
+		}
+	}
+	for _, entry := range entries {
+		record, ok := records[entry.ID]
+		if !ok || record.Seq.Valid {
+			return fmt.Errorf("audit entry %d is sealed already", entry.ID)
+		}
+		if seqs[entry.Seq.Int64] {
+			return fmt.Errorf(`duplicate key value violates unique constraint on "BK_Audit_Log".seq`)
+		}
+		seqs[entry.Seq.Int64] = true
+	}
+
+	for _, entry := range entries {
+		record := records[entry.ID]
+		record.Seq = entry.Seq
+		record.PrevHash = append([]byte(nil), entry.PrevHash...)
+		record.Hash = append([]byte(nil), entry.Hash...)
+	}
+	return nil
+}
+
+func (r *memoryAuditRepository) GetSealedEntries(ctx context.Context, afterSeq int64, limit int) ([]Entry, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	bySeq := map[int64]*memstore.AuditRecord{}
+	var last int64
+	for _, record := range r.store.AuditLog {
+		if record.Seq.Valid && record.Seq.Int64 > afterSeq {
+			bySeq[record.Seq.Int64] = record
+			last = max(last, record.Seq.Int64)
+		}
+	}
+
+	entries := []Entry{}
+	for seq := afterSeq + 1; seq <= last && len(entries) < limit; seq++ {
+		if record, ok := bySeq[seq]; ok {
+			entries = append(entries, toEntry(record))
+		}
+	}
+	return entries, nil
+}
+
+func matches(record *memstore.AuditRecord, filter Filter) bool {
+	for _, column := range []struct {
+		value, want string
+	}{
+		{record.Actor, filter.Actor},
+		{record.Action, filter.Action},
+		{record.Operation, filter.Operation},
+		{record.TargetTable, filter.TargetTable},
+		{record.TargetID, filter.TargetID},
+		{record.RequestID, filter.RequestID},
+	} {
+		if column.want != "" && column.value != column.want {
+			return false
+		}
+	}
+	return (filter.From.IsZero() || !record.CreatedAt.Before(filter.From)) &&
+		(filter.To.IsZero() || record.CreatedAt.Before(filter.To)) &&
+		(filter.BeforeID <= 0 || record.ID < filter.BeforeID)
+}
+
+func toEntry(record *memstore.AuditRecord) Entry {
+	return Entry{
+		ID:          record.ID,
+		Seq:         record.Seq,
+		Actor:       record.Actor,
+		Action:      record.Action,
+		Operation:   record.Operation,
+		TargetTable: record.TargetTable,
+		TargetID:    record.TargetID,
+		Before:      record.Before,
+		After:       record.After,
+		RequestID:   record.RequestID,
+		ClientIP:    record.ClientIP,
+		CreatedAt:   record.CreatedAt,
+		PrevHash:    record.PrevHash,
+		Hash:        record.Hash,
+	}
+}
@@ -0,0 +1,287 @@
+package audit
+
+import (
+	"bank_system/utils"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const entryColumns = `id, seq, actor, action, operation, target_table, target_id, before, after,
+	request_id, client_ip, created_at, prev_hash, hash`
+
+// Entry is a change to a row of an audited table. Before and After hold the
+// changed columns of an update and the whole row otherwise, with secrets
+// redacted. Seq, PrevHash and Hash are set once the entry is sealed.
+type Entry struct {
+	ID          int64           `json:"id"`
+	Seq         pgtype.Int8     `json:"seq"`
+	Actor       string          `json:"actor"`
+	Action      string          `json:"action"`
+	Operation   string          `json:"operation"`
+	TargetTable string          `json:"target_table"`
+	TargetID    string          `json:"target_id"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	RequestID   string          `json:"request_id"`
+	ClientIP    string          `json:"client_ip"`
+	CreatedAt   time.Time       `json:"created_at"`
+	PrevHash    Hash            `json:"prev_hash"`
+	Hash        Hash            `json:"hash"`
+}
+
+// Hash is a SHA-256 hash, hex encoded in JSON.
+type Hash []byte
+
+func (h Hash) MarshalJSON() ([]byte, error) {
+	if h == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(hex.EncodeToString(h))
+}
+
+// Filter selects entries; zero fields match everything. BeforeID pages
+// backwards: only entries with a smaller id match.
+type Filter struct {
+	Actor       string
+	Action      string
+	Operation   string
+	TargetTable string
+	TargetID    string
+	RequestID   string
+	From        time.Time
+	To          time.Time
+	BeforeID    int64
+	Limit       int
+}
+
+type AuditRepository interface {
+	// GetEntries returns up to filter.Limit entries matching filter, newest
+	// first.
+	GetEntries(ctx context.Context, filter Filter) ([]Entry, error)
+	// GetChainHead returns the last sealed entry, the zero Entry when none is.
+	GetChainHead(ctx context.Context) (Entry, error)
+	// GetUnsealedEntries returns up to limit entries that are not sealed yet,
+	// in id order, leaving out those of transactions that have not ended.
+	GetUnsealedEntries(ctx context.Context, limit int) ([]Entry, error)
+	// SealEntries stores the seq and hashes of entries, all or none. It fails
+	// when one of them is sealed already or its seq is taken.
+	SealEntries(ctx context.Context, entries []Entry) error
+	// GetSealedEntries returns up to limit sealed entries after seq, in chain
+	// order.
+	GetSealedEntries(ctx context.Context, afterSeq int64, limit int) ([]Entry, error)
+}
+
+type auditRepositoryImpl struct {
+	pool *pgxpool.Pool
+}
+
+func NewAuditRepository(pool *pgxpool.Pool) AuditRepository {
+	return &auditRepositoryImpl{pool: pool}
+}
+
+func (r *auditRepositoryImpl) GetEntries(ctx context.Context, filter Filter) ([]Entry, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+	for _, column := range []struct {
+		name  string
+		value string
+	}{
+		{"actor", filter.Actor},
+		{"action", filter.Action},
+		{"operation", filter.Operation},
+		{"target_table", filter.TargetTable},
+		{"target_id", filter.TargetID},
+		{"request_id", filter.RequestID},
+	} {
+		if column.value != "" {
+			where(column.name+" = ?", column.value)
+		}
+	}
+	if !filter.From.IsZero() {
+		where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		where("created_at < ?", filter.To)
+	}
+	if filter.BeforeID > 0 {
+		where("id < ?", filter.BeforeID)
+	}
+
+	query := `SELECT ` + entryColumns + ` FROM "BK_Audit_Log"`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT $%d`, len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectEntries(rows)
+}
+
+func (r *auditRepositoryImpl) GetChainHead(ctx context.Context) (Entry, error) {
+	entry, err := scanEntry(r.pool.QueryRow(ctx,
+		`SELECT `+entryColumns+` FROM "BK_Audit_Log"
+		WHERE seq IS NOT NULL
+		ORDER BY seq DESC
+		LIMIT 1`,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Entry{}, nil
+	}
+	return entry, err
+}
+
+func (r *auditRepositoryImpl) GetUnsealedEntries(ctx context.Context, limit int) ([]Entry, error) {
+	// Transactions older than the snapshot's xmin have all ended, so no entry
+	// of theirs can still appear before the ones sealed now.
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+entryColumns+` FROM "BK_Audit_Log"
+		WHERE seq IS NULL
+			AND xact_id < pg_snapshot_xmin(pg_current_snapshot())
+		ORDER BY id
+		LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return collectEntries(rows)
+}
+
+func (r *auditRepositoryImpl) SealEntries(ctx context.Context, entries []Entry) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	for _, entry := range entries {
+		batch.Queue(
+			`UPDATE "BK_Audit_Log"
+			SET seq = $2, prev_hash = $3, hash = $4
+			WHERE id = $1 AND seq IS NULL`,
+			entry.ID, entry.Seq, []byte(entry.PrevHash), []byte(entry.Hash),
+		)
+	}
+	results := tx.SendBatch(ctx, batch)
+	for _, entry := range entries {
+		tag, err := results.Exec()
+		if err != nil {
+			results.Close()
+			return err
+		}
+		if tag.RowsAffected() != 1 {
+			results.Close()
+			return fmt.Errorf("audit entry %d is sealed already", entry.ID)
+		}
+	}
+	if err := results.Close(); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *auditRepositoryImpl) GetSealedEntries(ctx context.Context, afterSeq int64, limit int) ([]Entry, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+entryColumns+` FROM "BK_Audit_Log"
+		WHERE seq > $1
+		ORDER BY seq
+		LIMIT $2`,
+		afterSeq, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return collectEntries(rows)
+}
+
+func collectEntries(rows pgx.Rows) ([]Entry, error) {
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func scanEntry(row pgx.Row) (Entry, error) {
+	var (
+		entry                           Entry
+		before, after, prevHash, hashed []byte
+	)
+	err := row.Scan(
+		&entry.ID,
+		&entry.Seq,
+		&entry.Actor,
+		&entry.Action,
+		&entry.Operation,
+		&entry.TargetTable,
+		&entry.TargetID,
+		&before,
+		&after,
+		&entry.RequestID,
+		&entry.ClientIP,
+		&entry.CreatedAt,
+		&prevHash,
+		&hashed,
+	)
+	entry.Before, entry.After = before, after
+	entry.PrevHash, entry.Hash = prevHash, hashed
+	return entry, err
+}
+
+// auditMetadataKey keys, in the CustomData of a connection, the metadata its
+// settings were last set to.
+const auditMetadataKey = "audit_metadata"
+
+// BeforeAcquire is a pgxpool hook that sets the app.audit_* settings of the
+// connection, which the audit triggers read, to the utils.AuditMetadata of
+// ctx. It only talks to the server when the connection was last used with
+// other metadata.
+func BeforeAcquire(ctx context.Context, conn *pgx.Conn) bool {
+	metadata := utils.AuditMetadataFrom(ctx)
+	data := conn.PgConn().CustomData()
+	if current, ok := data[auditMetadataKey].(utils.AuditMetadata); ok && current == metadata {
+		return true
+	}
+
+	_, err := conn.Exec(ctx,
+		`SELECT set_config('app.audit_actor', $1, false),
+			set_config('app.audit_action', $2, false),
+			set_config('app.audit_request_id', $3, false),
+			set_config('app.audit_client_ip', $4, false)`,
+		metadata.Actor, metadata.Action, metadata.RequestID, metadata.ClientIP,
+	)
+	if err != nil {
+		// The pool destroys the connection and tries another.
+		return false
+	}
+	data[auditMetadataKey] = metadata
+	return true
+}
@@ -0,0 +1,171 @@
+package audit
+
+import (
+	"bank_system/utils"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	OperationInsert = "INSERT"
+	OperationUpdate = "UPDATE"
+	OperationDelete = "DELETE"
+
+	DefaultLimit     = 100
+	MaxLimit         = 1000
+	DefaultBatchSize = 1000
+)
+
+type AuditService struct {
+	repo      AuditRepository
+	batchSize int
+}
+
+// NewAuditService creates the service. batchSize is the number of entries
+// sealed or verified per round trip, DefaultBatchSize when 0.
+func NewAuditService(repo AuditRepository, batchSize int) *AuditService {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	return &AuditService{
+		repo:      repo,
+		batchSize: batchSize,
+	}
+}
+
+// GetEntries returns the entries matching filter, newest first, and
+// DefaultLimit of them when filter.Limit is 0.
+func (s *AuditService) GetEntries(ctx context.Context, filter Filter) ([]Entry, error) {
+	if filter.Limit == 0 {
+		filter.Limit = DefaultLimit
+	}
+
+	verr := &utils.ValidationError{}
+	switch filter.Operation {
+	case "", OperationInsert, OperationUpdate, OperationDelete:
+	default:
+		verr.Add("operation", "must be one of INSERT, UPDATE, DELETE")
+	}
+	if filter.Limit < 1 || filter.Limit > MaxLimit {
+		verr.Add("limit", fmt.Sprintf("must be between 1 and %d", MaxLimit))
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		verr.Add("to", "must be after from")
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetEntries(ctx, filter)
+}
+
+// Seal appends the entries whose transaction ended to the hash chain, in id
+// order, and returns how many it sealed. Sealing on several instances at once
+// is safe: all but one fail on the seq they both took.
+func (s *AuditService) Seal(ctx context.Context) (int, error) {
+	head, err := s.repo.GetChainHead(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var sealed int
+	for {
+		entries, err := s.repo.GetUnsealedEntries(ctx, s.batchSize)
+		if err != nil {
+			return sealed, err
+		}
+		if len(entries) == 0 {
+			return sealed, nil
+		}
+
+		for i := range entries {
+			entries[i].Seq = pgtype.Int8{Int64: head.Seq.Int64 + 1, Valid: true}
+			entries[i].PrevHash = head.Hash
+			entries[i].Hash = hashEntry(entries[i])
+			head = entries[i]
+		}
+		if err := s.repo.SealEntries(ctx, entries); err != nil {
+			return sealed, err
+		}
+		sealed += len(entries)
+
+		if len(entries) < s.batchSize {
+			return sealed, nil
+		}
+	}
+}
+
+// Verification is the result of checking the hash chain. HeadSeq and
+// HeadHash are those of the last entry found intact; keeping them elsewhere
+// lets a later verification notice that entries were cut off the end.
+type Verification struct {
+	Valid    bool  `json:"valid"`
+	HeadSeq  int64 `json:"head_seq"`
+	HeadHash Hash  `json:"head_hash"`
+	// BrokenSeq is the first entry that is missing or was changed.
+	BrokenSeq int64  `json:"broken_seq,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Verify walks the hash chain from its first entry and recomputes every hash.
+func (s *AuditService) Verify(ctx context.Context) (Verification, error) {
+	var v Verification
+	for {
+		entries, err := s.repo.GetSealedEntries(ctx, v.HeadSeq, s.batchSize)
+		if err != nil {
+			return v, err
+		}
+
+		for _, entry := range entries {
+			reason := ""
+			switch {
+			case entry.Seq.Int64 != v.HeadSeq+1:
+				reason = "entry is missing"
+			case !bytes.Equal(entry.PrevHash, v.HeadHash):
+				reason = "prev_hash does not match the previous entry"
+			case !bytes.Equal(entry.Hash, hashEntry(entry)):
+				reason = "hash does not match the entry"
+			}
+			if reason != "" {
+				v.BrokenSeq, v.Reason = v.HeadSeq+1, reason
+				return v, nil
+			}
+			v.HeadSeq, v.HeadHash = entry.Seq.Int64, entry.Hash
+		}
+
+		if len(entries) < s.batchSize {
+			v.Valid = true
+			return v, nil
+		}
+	}
+}
+
+// hashEntry is the SHA-256 of the previous hash and the fields of entry,
+// each prefixed with its length so that different entries never hash alike.
+func hashEntry(entry Entry) Hash {
+	h := sha256.New()
+	write := func(b []byte) {
+		h.Write(binary.AppendUvarint(nil, uint64(len(b))))
+		h.Write(b)
+	}
+
+	write(entry.PrevHash)
+	write(strconv.AppendInt(nil, entry.Seq.Int64, 10))
+	write(strconv.AppendInt(nil, entry.ID, 10))
+	for _, field := range []string{entry.Actor, entry.Action, entry.Operation, entry.TargetTable, entry.TargetID} {
+		write([]byte(field))
+	}
+	write(entry.Before)
+	write(entry.After)
+	write([]byte(entry.RequestID))
+	write([]byte(entry.ClientIP))
+	write(strconv.AppendInt(nil, entry.CreatedAt.UnixMicro(), 10))
+	return h.Sum(nil)
+}
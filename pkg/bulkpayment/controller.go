@@ -0,0 +1,183 @@
+package bulkpayment
+
+import (
+	"bank_system/utils"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BulkPaymentController struct {
+	service *BulkPaymentService
+	logger  *log.Logger
+}
+
+func NewBulkPaymentController(service *BulkPaymentService, logger *log.Logger) *BulkPaymentController {
+	return &BulkPaymentController{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// CreateBulkPayment takes a multipart upload with the file, the mode, the
+// format (from the file extension when absent) and the OTP code.
+func (c *BulkPaymentController) CreateBulkPayment(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, MaxFileSize+1<<20)
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("file must not exceed %d bytes", MaxFileSize)})
+			return
+		}
+		verr := &utils.ValidationError{}
+		verr.Add("file", "is required")
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(verr))
+		return
+	}
+	if header.Size > MaxFileSize {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("file must not exceed %d bytes", MaxFileSize)})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	mode := ctx.DefaultPostForm("mode", ModeAllOrNothing)
+	format := ctx.PostForm("format")
+	if format == "" {
+		format = FormatCSV
+		if strings.EqualFold(filepath.Ext(header.Filename), ".xml") {
+			format = FormatPAIN001
+		}
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT_STREAM)
+	defer cancel()
+
+	payment, err := c.service.CreateBulkPayment(reqCtx, idNumber, format, mode, data, ctx.PostForm("otp_code"))
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, payment)
+}
+
+func (c *BulkPaymentController) GetAccountBulkPayments(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	payments, err := c.service.GetAccountBulkPayments(reqCtx, idNumber)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, payments)
+}
+
+func (c *BulkPaymentController) GetBulkPayment(ctx *gin.Context) {
+	payment, ok := c.getBulkPayment(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, payment)
+}
+
+// GetBulkPaymentReport sends the result of every line as a CSV download.
+func (c *BulkPaymentController) GetBulkPaymentReport(ctx *gin.Context) {
+	payment, ok := c.getBulkPayment(ctx)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, payment); err != nil {
+		c.logger.Printf("Failed to write the report of bulk payment %d: %v\n", payment.ID, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("bulk-payment-%d-report.csv", payment.ID)
+	ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	ctx.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+func (c *BulkPaymentController) getBulkPayment(ctx *gin.Context) (BulkPayment, bool) {
+	idNumber := ctx.Param("id_number")
+	paymentID, err := strconv.ParseInt(ctx.Param("payment_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bulk payment id"})
+		return BulkPayment{}, false
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	payment, err := c.service.GetBulkPayment(reqCtx, idNumber, paymentID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return BulkPayment{}, false
+	}
+	return payment, true
+}
+
+func errorStatus(err error) int {
+	switch {
+	case utils.IsValidationError(err):
+		return http.StatusBadRequest
+	case utils.IsBankSystemError(err, utils.ErrOTPRequired),
+		utils.IsBankSystemError(err, utils.ErrInvalidOTP):
+		return http.StatusUnauthorized
+	case utils.IsBankSystemError(err, utils.ErrTOTPNotEnabled):
+		return http.StatusForbidden
+	case utils.IsBankSystemError(err, utils.ErrAccountNotFound),
+		utils.IsBankSystemError(err, utils.ErrBulkPaymentNotFound):
+		return http.StatusNotFound
+	case utils.IsBankSystemError(err, utils.ErrBulkPaymentExists):
+		return http.StatusConflict
+	case utils.IsBankSystemError(err, utils.ErrAccountNotActive):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RegisterRoutes serves the bulk payments of a debtor account only to its
+// owner, behind the owner middleware.
+func (c *BulkPaymentController) RegisterRoutes(router *gin.Engine, owner gin.HandlerFunc) {
+	group := router.Group("/accounts/:id_number/bulk-payments", owner)
+	{
+		group.POST("", c.CreateBulkPayment)
+		group.GET("", c.GetAccountBulkPayments)
+		group.GET("/:payment_id", c.GetBulkPayment)
+		group.GET("/:payment_id/report", c.GetBulkPaymentReport)
+	}
+}
@@ -0,0 +1,244 @@
+package bulkpayment
+
+import (
+	"bank_system/pkg/memstore"
+	"bank_system/utils"
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// memoryBulkPaymentRepository is a BulkPaymentRepository backed by a memstore.Store.
+type memoryBulkPaymentRepository struct {
+	store *memstore.Store
+}
+
+func NewMemoryBulkPaymentRepository(store *memstore.Store) BulkPaymentRepository {
+	return &memoryBulkPaymentRepository{store: store}
+}
+
+func (r *memoryBulkPaymentRepository) CreateBulkPayment(ctx context.Context, payment BulkPayment) (BulkPayment, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	if _, ok := r.store.Accounts[payment.AccountID]; !ok {
+		return BulkPayment{}, errors.New(`insert on "BK_Bulk_Payment" violates a foreign key constraint to "BK_Account"`)
+	}
+	for _, record := range r.store.BulkPayments {
+		if record.AccountID == payment.AccountID && record.MessageID == payment.MessageID {
+			return BulkPayment{}, utils.NewBankSystemError(utils.ErrBulkPaymentExists, payment.MessageID)
+		}
+	}
+
+	now := time.Now()
+	record := &memstore.BulkPaymentRecord{
+		ID:          r.store.NextID("BK_Bulk_Payment"),
+		AccountID:   payment.AccountID,
+		MessageID:   payment.MessageID,
+		Format:      payment.Format,
+		Mode:        payment.Mode,
+		Status:      StatusPending,
+		LineCount:   len(payment.Lines),
+		TotalAmount: payment.TotalAmount,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	r.store.BulkPayments[record.ID] = record
+	r.store.Audit(ctx, "BK_Bulk_Payment", record.ID, nil, *record)
+
+	for _, line := range payment.Lines {
+		lineRecord := &memstore.BulkPaymentLineRecord{
+			ID:            r.store.NextID("BK_Bulk_Payment_Line"),
+			BulkPaymentID: record.ID,
+			LineNumber:    line.LineNumber,
+			ToAccount:     line.ToAccount,
+			ToAccountID:   line.ToAccountID,
+			Amount:        line.Amount,
+			Reference:     line.Reference,
+			EndToEndID:    line.EndToEndID,
+			Status:        line.Status,
+			Error:         line.Error,
+		}
+		r.store.BulkPaymentLines[lineRecord.ID] = lineRecord
+	}
+
+	return r.toBulkPayment(record, true), nil
+}
+
+func (r *memoryBulkPaymentRepository) GetBulkPayment(ctx context.Context, id int64) (BulkPayment, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.BulkPayments[id]
+	if !ok {
+		return BulkPayment{}, pgx.ErrNoRows
+	}
+	return r.toBulkPayment(record, true), nil
+}
+
+func (r *memoryBulkPaymentRepository) GetAccountBulkPayments(ctx context.Context, accountID int64) ([]BulkPayment, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	payments := []BulkPayment{}
+	for _, record := range r.store.BulkPayments {
+		if record.AccountID == accountID {
+			payments = append(payments, r.toBulkPayment(record, false))
+		}
+	}
+	sort.Slice(payments, func(i, j int) bool {
+		if !payments[i].CreatedAt.Equal(payments[j].CreatedAt) {
+			return payments[i].CreatedAt.After(payments[j].CreatedAt)
+		}
+		return payments[i].ID > payments[j].ID
+	})
+
+	return payments, nil
+}
+
+func (r *memoryBulkPaymentRepository) ClaimPendingBulkPayments(
+	ctx context.Context, now, claimUntil time.Time, limit int,
+) ([]BulkPayment, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	var pending []*memstore.BulkPaymentRecord
+	for _, record := range r.store.BulkPayments {
+		if record.Status == StatusPending ||
+			record.Status == StatusProcessing && record.ClaimedUntil.Valid && record.ClaimedUntil.Time.Before(now) {
+			pending = append(pending, record)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if !pending[i].CreatedAt.Equal(pending[j].CreatedAt) {
+			return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+		}
+		return pending[i].ID < pending[j].ID
+	})
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+
+	payments := make([]BulkPayment, 0, len(pending))
+	for _, record := range pending {
+		before := *record
+		record.Status = StatusProcessing
+		record.ClaimedUntil = pgtype.Timestamptz{Time: claimUntil, Valid: true}
+		record.UpdatedAt = time.Now()
+		r.store.Audit(ctx, "BK_Bulk_Payment", record.ID, before, *record)
+		payments = append(payments, r.toBulkPayment(record, true))
+	}
+	return payments, nil
+}
+
+func (r *memoryBulkPaymentRepository) RecordLines(ctx context.Context, lines []Line) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	for _, line := range lines {
+		record, ok := r.store.BulkPaymentLines[line.ID]
+		if !ok {
+			continue
+		}
+		record.Status = line.Status
+		record.Error = line.Error
+		record.TransactionID = line.TransactionID
+		record.DecisionID = line.DecisionID
+		record.ExecutedAt = line.ExecutedAt
+	}
+	return nil
+}
+
+func (r *memoryBulkPaymentRepository) SettleLine(ctx context.Context, decisionID int64, line Line) (int64, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	for _, record := range r.store.BulkPaymentLines {
+		if record.DecisionID.Valid && record.DecisionID.Int64 == decisionID && record.Status == LineHeld {
+			record.Status = line.Status
+			record.Error = line.Error
+			record.TransactionID = line.TransactionID
+			record.ExecutedAt = line.ExecutedAt
+			return record.BulkPaymentID, nil
+		}
+	}
+	return 0, pgx.ErrNoRows
+}
+
+func (r *memoryBulkPaymentRepository) FinishBulkPayment(ctx context.Context, payment BulkPayment) (BulkPayment, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.BulkPayments[payment.ID]
+	if !ok {
+		return BulkPayment{}, pgx.ErrNoRows
+	}
+
+	before := *record
+	now := time.Now()
+	record.Status = payment.Status
+	record.SucceededCount = payment.SucceededCount
+	record.FailedCount = payment.FailedCount
+	record.Error = payment.Error
+	record.CompletedAt = pgtype.Timestamptz{Time: now, Valid: true}
+	record.ClaimedUntil = pgtype.Timestamptz{}
+	record.UpdatedAt = now
+	r.store.Audit(ctx, "BK_Bulk_Payment", record.ID, before, *record)
+
+	return r.toBulkPayment(record, true), nil
+}
+
+// toBulkPayment joins the account and, with lines, the lines of the payment.
+// The caller must hold Mu.
+func (r *memoryBulkPaymentRepository) toBulkPayment(record *memstore.BulkPaymentRecord, lines bool) BulkPayment {
+	payment := BulkPayment{
+		ID:             record.ID,
+		AccountID:      record.AccountID,
+		MessageID:      record.MessageID,
+		Format:         record.Format,
+		Mode:           record.Mode,
+		Status:         record.Status,
+		LineCount:      record.LineCount,
+		TotalAmount:    record.TotalAmount,
+		SucceededCount: record.SucceededCount,
+		FailedCount:    record.FailedCount,
+		Error:          record.Error,
+		CreatedAt:      record.CreatedAt,
+		UpdatedAt:      record.UpdatedAt,
+		CompletedAt:    record.CompletedAt,
+	}
+	if account, ok := r.store.Accounts[record.AccountID]; ok {
+		payment.AccountNumber = account.IDNumber
+		payment.CurrencyCode = account.CurrencyCode
+	}
+	if !lines {
+		return payment
+	}
+
+	payment.Lines = []Line{}
+	for _, line := range r.store.BulkPaymentLines {
+		if line.BulkPaymentID == record.ID {
+			payment.Lines = append(payment.Lines, Line{
+				ID:            line.ID,
+				BulkPaymentID: line.BulkPaymentID,
+				LineNumber:    line.LineNumber,
+				ToAccount:     line.ToAccount,
+				ToAccountID:   line.ToAccountID,
+				Amount:        line.Amount,
+				Reference:     line.Reference,
+				EndToEndID:    line.EndToEndID,
+				Status:        line.Status,
+				Error:         line.Error,
+				TransactionID: line.TransactionID,
+				DecisionID:    line.DecisionID,
+				ExecutedAt:    line.ExecutedAt,
+			})
+		}
+	}
+	sort.Slice(payment.Lines, func(i, j int) bool { return payment.Lines[i].LineNumber < payment.Lines[j].LineNumber })
+	return payment
+}
@@ -0,0 +1,169 @@
+package bulkpayment
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// paymentFile is what an uploaded file says, before any of it is validated.
+type paymentFile struct {
+	MessageID string
+	// Debtor is the account the file pays from, empty when it does not say.
+	Debtor  string
+	Entries []entry
+	// NumberOfTxs and ControlSum are the checks of a pain.001 group header,
+	// empty when absent.
+	NumberOfTxs string
+	ControlSum  string
+}
+
+// entry is one transfer as the file gives it.
+type entry struct {
+	ToAccount string
+	Amount    string
+	// Currency is empty when the file does not say, as in CSV.
+	Currency   string
+	Reference  string
+	EndToEndID string
+}
+
+func parseFile(format string, data []byte) (paymentFile, error) {
+	switch format {
+	case FormatPAIN001:
+		return parsePAIN001(data)
+	case FormatCSV:
+		return parseCSV(data)
+	default:
+		return paymentFile{}, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// ISO 20022 customer credit transfer initiation. Element names are matched in
+// any namespace, so that every version of pain.001 is read.
+type painDocument struct {
+	XMLName    xml.Name        `xml:"Document"`
+	Initiation *painInitiation `xml:"CstmrCdtTrfInitn"`
+}
+
+type painInitiation struct {
+	MessageID    string            `xml:"GrpHdr>MsgId"`
+	NumberOfTxs  string            `xml:"GrpHdr>NbOfTxs"`
+	ControlSum   string            `xml:"GrpHdr>CtrlSum"`
+	PaymentInfos []painPaymentInfo `xml:"PmtInf"`
+}
+
+type painPaymentInfo struct {
+	DebtorAccount painAccount    `xml:"DbtrAcct"`
+	Transfers     []painTransfer `xml:"CdtTrfTxInf"`
+}
+
+type painAccount struct {
+	IBAN  string `xml:"Id>IBAN"`
+	Other string `xml:"Id>Othr>Id"`
+}
+
+// id returns the account number of the bank, given as an Othr identification,
+// or else the IBAN.
+func (a painAccount) id() string {
+	if a.Other != "" {
+		return strings.TrimSpace(a.Other)
+	}
+	return strings.TrimSpace(a.IBAN)
+}
+
+type painTransfer struct {
+	EndToEndID string `xml:"PmtId>EndToEndId"`
+	Amount     struct {
+		Currency string `xml:"Ccy,attr"`
+		Value    string `xml:",chardata"`
+	} `xml:"Amt>InstdAmt"`
+	CreditorAccount painAccount `xml:"CdtrAcct"`
+	Unstructured    []string    `xml:"RmtInf>Ustrd"`
+}
+
+func parsePAIN001(data []byte) (paymentFile, error) {
+	var doc painDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return paymentFile{}, fmt.Errorf("is not valid XML: %w", err)
+	}
+	if doc.Initiation == nil {
+		return paymentFile{}, errors.New("is not a pain.001 customer credit transfer initiation")
+	}
+
+	file := paymentFile{
+		MessageID:   strings.TrimSpace(doc.Initiation.MessageID),
+		NumberOfTxs: strings.TrimSpace(doc.Initiation.NumberOfTxs),
+		ControlSum:  strings.TrimSpace(doc.Initiation.ControlSum),
+	}
+	for _, info := range doc.Initiation.PaymentInfos {
+		debtor := info.DebtorAccount.id()
+		if file.Debtor != "" && debtor != file.Debtor {
+			return paymentFile{}, errors.New("must pay from a single debtor account")
+		}
+		file.Debtor = debtor
+
+		for _, transfer := range info.Transfers {
+			file.Entries = append(file.Entries, entry{
+				ToAccount:  transfer.CreditorAccount.id(),
+				Amount:     strings.TrimSpace(transfer.Amount.Value),
+				Currency:   strings.TrimSpace(transfer.Amount.Currency),
+				Reference:  strings.TrimSpace(strings.Join(transfer.Unstructured, " ")),
+				EndToEndID: strings.TrimSpace(transfer.EndToEndID),
+			})
+		}
+	}
+	return file, nil
+}
+
+// parseCSV reads rows of destination account, amount and an optional
+// reference, after an optional header row. The message id is the SHA-256 of
+// the file.
+func parseCSV(data []byte) (paymentFile, error) {
+	sum := sha256.Sum256(data)
+	file := paymentFile{MessageID: hex.EncodeToString(sum[:])}
+
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	for first := true; ; first = false {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return paymentFile{}, fmt.Errorf("is not valid CSV: %w", err)
+		}
+		if first && isHeader(record) {
+			continue
+		}
+		if len(record) < 2 || len(record) > 3 {
+			line, _ := r.FieldPos(0)
+			return paymentFile{}, fmt.Errorf("line %d must have to_account, amount and an optional reference", line)
+		}
+
+		e := entry{
+			ToAccount: strings.TrimSpace(record[0]),
+			Amount:    strings.TrimSpace(record[1]),
+		}
+		if len(record) == 3 {
+			e.Reference = strings.TrimSpace(record[2])
+		}
+		file.Entries = append(file.Entries, e)
+	}
+	return file, nil
+}
+
+// isHeader reports whether the first row names the columns rather than pays
+// an account: its first field has no digit. A mistyped account number is
+// still read as a line, and rejected.
+func isHeader(record []string) bool {
+	return !strings.ContainsAny(record[0], "0123456789")
+}
@@ -0,0 +1,171 @@
+package bulkpayment
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func painFile(namespace, paymentInfos string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="` + namespace + `">
+  <CstmrCdtTrfInitn>
+    <GrpHdr><MsgId> MSG-1 </MsgId><NbOfTxs>2</NbOfTxs><CtrlSum>30.50</CtrlSum></GrpHdr>` + paymentInfos + `
+  </CstmrCdtTrfInitn>
+</Document>`
+}
+
+const painTransfers = `
+    <PmtInf>
+      <DbtrAcct><Id><Othr><Id>11112222333344445555</Id></Othr></Id></DbtrAcct>
+      <CdtTrfTxInf>
+        <PmtId><EndToEndId>E2E-1</EndToEndId></PmtId>
+        <Amt><InstdAmt Ccy="USD">10.50</InstdAmt></Amt>
+        <CdtrAcct><Id><Othr><Id>22223333444455556666</Id></Othr></Id></CdtrAcct>
+        <RmtInf><Ustrd>Invoice 1</Ustrd><Ustrd>and 2</Ustrd></RmtInf>
+      </CdtTrfTxInf>
+    </PmtInf>`
+
+const painTransfersIBAN = `
+    <PmtInf>
+      <DbtrAcct><Id><Othr><Id>11112222333344445555</Id></Othr></Id></DbtrAcct>
+      <CdtTrfTxInf>
+        <Amt><InstdAmt Ccy="EUR"> 20 </InstdAmt></Amt>
+        <CdtrAcct><Id><IBAN>DE89370400440532013000</IBAN></Id></CdtrAcct>
+      </CdtTrfTxInf>
+    </PmtInf>`
+
+func TestParsePAIN001(t *testing.T) {
+	want := paymentFile{
+		MessageID:   "MSG-1",
+		Debtor:      "11112222333344445555",
+		NumberOfTxs: "2",
+		ControlSum:  "30.50",
+		Entries: []entry{
+			{ToAccount: "22223333444455556666", Amount: "10.50", Currency: "USD", Reference: "Invoice 1 and 2", EndToEndID: "E2E-1"},
+			{ToAccount: "DE89370400440532013000", Amount: "20", Currency: "EUR"},
+		},
+	}
+
+	for _, namespace := range []string{
+		"urn:iso:std:iso:20022:tech:xsd:pain.001.001.03",
+		"urn:iso:std:iso:20022:tech:xsd:pain.001.001.09",
+	} {
+		t.Run(namespace, func(t *testing.T) {
+			got, err := parseFile(FormatPAIN001, []byte(painFile(namespace, painTransfers+painTransfersIBAN)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parsed %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParsePAIN001Invalid(t *testing.T) {
+	otherDebtor := strings.Replace(painTransfersIBAN, "11112222333344445555", "99998888777766665555", 1)
+	tests := []struct {
+		name, data, want string
+	}{
+		{"not XML", "to_account,amount\n", "is not valid XML"},
+		{"truncated", painFile("urn:iso:std:iso:20022:tech:xsd:pain.001.001.03", painTransfers)[:200], "is not valid XML"},
+		{"another message", `<Document><CstmrPmtStsRpt/></Document>`, "is not a pain.001"},
+		{"another root", `<Invoice><CstmrCdtTrfInitn/></Invoice>`, "is not valid XML"},
+		{"two debtors", painFile("", painTransfers+otherDebtor), "single debtor account"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parsePAIN001([]byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []entry
+	}{
+		{
+			"header row",
+			"to_account,amount,reference\n22223333444455556666,10.50,Rent\n",
+			[]entry{{ToAccount: "22223333444455556666", Amount: "10.50", Reference: "Rent"}},
+		},
+		{
+			"no header and no reference",
+			"22223333444455556666,10.50\n33334444555566667777, 2\n",
+			[]entry{{ToAccount: "22223333444455556666", Amount: "10.50"}, {ToAccount: "33334444555566667777", Amount: "2"}},
+		},
+		{
+			"byte order mark and CRLF",
+			"\ufeffaccount,amount\r\n22223333444455556666,1\r\n",
+			[]entry{{ToAccount: "22223333444455556666", Amount: "1"}},
+		},
+		{
+			"quoted reference",
+			"22223333444455556666,1,\"Rent, \"\"May\"\"\"\n",
+			[]entry{{ToAccount: "22223333444455556666", Amount: "1", Reference: `Rent, "May"`}},
+		},
+		{
+			"a mistyped first account is a line",
+			"2222333344445555666O,1\n",
+			[]entry{{ToAccount: "2222333344445555666O", Amount: "1"}},
+		},
+		{
+			"mistyped account without digits is taken for a header",
+			"abc,1\n22223333444455556666,1\n",
+			[]entry{{ToAccount: "22223333444455556666", Amount: "1"}},
+		},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFile(FormatCSV, []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Entries, tt.want) {
+				t.Errorf("entries %+v, want %+v", got.Entries, tt.want)
+			}
+			if len(got.MessageID) != 64 || got.Debtor != "" {
+				t.Errorf("message id %q and debtor %q, want the SHA-256 and none", got.MessageID, got.Debtor)
+			}
+		})
+	}
+}
+
+func TestParseCSVInvalid(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"one field", "to_account,amount\n22223333444455556666,1\n22223333444455556666\n", "line 3 must have"},
+		{"four fields", "22223333444455556666,1,rent,extra\n", "line 1 must have"},
+		{"unterminated quote", "22223333444455556666,1,\"rent\n", "is not valid CSV"},
+		{"stray quote", "22223333444455556666,1,re\"nt\n", "is not valid CSV"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCSV([]byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseFile("xlsx", nil); err == nil {
+		t.Error("parseFile accepted an unknown format")
+	}
+}
+
+func TestParseCSVMessageID(t *testing.T) {
+	a, _ := parseCSV([]byte("22223333444455556666,1\n"))
+	b, _ := parseCSV([]byte("22223333444455556666,1\n"))
+	c, _ := parseCSV([]byte("22223333444455556666,2\n"))
+	if a.MessageID != b.MessageID || a.MessageID == c.MessageID {
+		t.Errorf("message ids %s, %s, %s: the same file must give the same id and another file another", a.MessageID, b.MessageID, c.MessageID)
+	}
+}
@@ -0,0 +1,44 @@
+package bulkpayment
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// WriteReport writes the result of every line of payment as CSV, in the order
+// of the uploaded file.
+func WriteReport(w io.Writer, payment BulkPayment) error {
+	units := minorUnits(payment.CurrencyCode)
+
+	cw := csv.NewWriter(w)
+	rows := [][]string{
+		{"line_number", "to_account", "amount", "reference", "end_to_end_id", "status", "transaction_id", "executed_at", "error"},
+	}
+	for _, line := range payment.Lines {
+		row := []string{
+			strconv.Itoa(line.LineNumber),
+			line.ToAccount,
+			strconv.FormatFloat(line.Amount, 'f', units, 64),
+			line.Reference,
+			line.EndToEndID,
+			line.Status,
+			"",
+			"",
+			line.Error,
+		}
+		if line.TransactionID.Valid {
+			row[6] = strconv.FormatInt(line.TransactionID.Int64, 10)
+		}
+		if line.ExecutedAt.Valid {
+			row[7] = line.ExecutedAt.Time.UTC().Format(time.RFC3339)
+		}
+		rows = append(rows, row)
+	}
+
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
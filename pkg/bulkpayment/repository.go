@@ -0,0 +1,320 @@
+package bulkpayment
+
+import (
+	"bank_system/utils"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	paymentColumns = `bp.id, bp.account_id, a.id_number, a.currency_code, bp.message_id, bp.format, bp.mode, bp.status,
+		bp.line_count, bp.total_amount, bp.succeeded_count, bp.failed_count, bp.error,
+		bp.created_at, bp.updated_at, bp.completed_at`
+	paymentJoins = `
+		JOIN "BK_Account" a ON a.id = bp.account_id`
+	paymentFrom = `"BK_Bulk_Payment" bp` + paymentJoins
+	lineColumns = `id, bulk_payment_id, line_number, to_account, to_account_id, amount, reference, end_to_end_id,
+		status, error, transaction_id, decision_id, executed_at`
+)
+
+// BulkPayment is a file of transfers from one account. TotalAmount sums the
+// lines that were not rejected on upload.
+type BulkPayment struct {
+	ID             int64              `json:"id"`
+	AccountID      int64              `json:"account_id"`
+	AccountNumber  string             `json:"account_number"`
+	CurrencyCode   string             `json:"currency_code"`
+	MessageID      string             `json:"message_id"`
+	Format         string             `json:"format"`
+	Mode           string             `json:"mode"`
+	Status         string             `json:"status"`
+	LineCount      int                `json:"line_count"`
+	TotalAmount    float64            `json:"total_amount"`
+	SucceededCount int                `json:"succeeded_count"`
+	FailedCount    int                `json:"failed_count"`
+	Error          string             `json:"error"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+	CompletedAt    pgtype.Timestamptz `json:"completed_at"`
+	Lines          []Line             `json:"lines,omitempty"`
+}
+
+// Line is one transfer of a bulk payment, numbered from 1 in the order of
+// the file. DecisionID is the risk decision a HELD line waits for.
+type Line struct {
+	ID            int64              `json:"id"`
+	BulkPaymentID int64              `json:"bulk_payment_id"`
+	LineNumber    int                `json:"line_number"`
+	ToAccount     string             `json:"to_account"`
+	ToAccountID   pgtype.Int8        `json:"to_account_id"`
+	Amount        float64            `json:"amount"`
+	Reference     string             `json:"reference"`
+	EndToEndID    string             `json:"end_to_end_id"`
+	Status        string             `json:"status"`
+	Error         string             `json:"error"`
+	TransactionID pgtype.Int8        `json:"transaction_id"`
+	DecisionID    pgtype.Int8        `json:"decision_id"`
+	ExecutedAt    pgtype.Timestamptz `json:"executed_at"`
+}
+
+type BulkPaymentRepository interface {
+	// CreateBulkPayment stores payment with its lines, and returns
+	// ErrBulkPaymentExists when the account already sent the same message id.
+	CreateBulkPayment(ctx context.Context, payment BulkPayment) (BulkPayment, error)
+	// GetBulkPayment returns the payment with its lines.
+	GetBulkPayment(ctx context.Context, id int64) (BulkPayment, error)
+	// GetAccountBulkPayments returns the payments of the account, newest
+	// first, without their lines.
+	GetAccountBulkPayments(ctx context.Context, accountID int64) ([]BulkPayment, error)
+	// ClaimPendingBulkPayments returns up to limit payments, with their lines,
+	// that are pending or whose claim expired, marks them PROCESSING and
+	// claims them until claimUntil so that other instances skip them.
+	ClaimPendingBulkPayments(ctx context.Context, now, claimUntil time.Time, limit int) ([]BulkPayment, error)
+	// RecordLines stores the status, error, transaction, decision and
+	// execution time of lines.
+	RecordLines(ctx context.Context, lines []Line) error
+	// SettleLine stores the status, error, transaction and execution time of
+	// line in the HELD line waiting for the decision, and returns the id of
+	// its payment, pgx.ErrNoRows when there is none.
+	SettleLine(ctx context.Context, decisionID int64, line Line) (int64, error)
+	// FinishBulkPayment stores the status, counts and error of payment,
+	// completes it and releases the claim.
+	FinishBulkPayment(ctx context.Context, payment BulkPayment) (BulkPayment, error)
+}
+
+type bulkPaymentRepositoryImpl struct {
+	pool *pgxpool.Pool
+}
+
+func NewBulkPaymentRepository(pool *pgxpool.Pool) BulkPaymentRepository {
+	return &bulkPaymentRepositoryImpl{pool: pool}
+}
+
+func (r *bulkPaymentRepositoryImpl) CreateBulkPayment(ctx context.Context, payment BulkPayment) (BulkPayment, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return BulkPayment{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int64
+	err = tx.QueryRow(ctx,
+		`INSERT INTO "BK_Bulk_Payment" (account_id, message_id, format, mode, line_count, total_amount)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		payment.AccountID, payment.MessageID, payment.Format, payment.Mode, len(payment.Lines), payment.TotalAmount,
+	).Scan(&id)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return BulkPayment{}, utils.NewBankSystemError(utils.ErrBulkPaymentExists, payment.MessageID)
+	}
+	if err != nil {
+		return BulkPayment{}, err
+	}
+
+	batch := &pgx.Batch{}
+	for _, line := range payment.Lines {
+		batch.Queue(
+			`INSERT INTO "BK_Bulk_Payment_Line" (
+				bulk_payment_id, line_number, to_account, to_account_id, amount, reference, end_to_end_id, status, error
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			id, line.LineNumber, line.ToAccount, line.ToAccountID, line.Amount, line.Reference, line.EndToEndID,
+			line.Status, line.Error,
+		)
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return BulkPayment{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return BulkPayment{}, err
+	}
+	return r.GetBulkPayment(ctx, id)
+}
+
+func (r *bulkPaymentRepositoryImpl) GetBulkPayment(ctx context.Context, id int64) (BulkPayment, error) {
+	payment, err := scanBulkPayment(r.pool.QueryRow(ctx, `SELECT `+paymentColumns+` FROM `+paymentFrom+` WHERE bp.id = $1`, id))
+	if err != nil {
+		return BulkPayment{}, err
+	}
+	payment.Lines, err = r.getLines(ctx, payment.ID)
+	return payment, err
+}
+
+func (r *bulkPaymentRepositoryImpl) GetAccountBulkPayments(ctx context.Context, accountID int64) ([]BulkPayment, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+paymentColumns+` FROM `+paymentFrom+`
+		WHERE bp.account_id = $1
+		ORDER BY bp.created_at DESC, bp.id DESC`,
+		accountID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return collectBulkPayments(rows)
+}
+
+func (r *bulkPaymentRepositoryImpl) ClaimPendingBulkPayments(
+	ctx context.Context, now, claimUntil time.Time, limit int,
+) ([]BulkPayment, error) {
+	rows, err := r.pool.Query(ctx,
+		`WITH claimed AS (
+			UPDATE "BK_Bulk_Payment"
+			SET status = 'PROCESSING', claimed_until = $2
+			WHERE id IN (
+				SELECT id FROM "BK_Bulk_Payment"
+				WHERE status = 'PENDING'
+					OR (status = 'PROCESSING' AND claimed_until < $1)
+				ORDER BY created_at
+				LIMIT $3
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT `+paymentColumns+` FROM claimed bp`+paymentJoins+`
+		ORDER BY bp.created_at`,
+		now, claimUntil, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := collectBulkPayments(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range payments {
+		if payments[i].Lines, err = r.getLines(ctx, payments[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return payments, nil
+}
+
+func (r *bulkPaymentRepositoryImpl) RecordLines(ctx context.Context, lines []Line) error {
+	batch := &pgx.Batch{}
+	for _, line := range lines {
+		batch.Queue(
+			`UPDATE "BK_Bulk_Payment_Line"
+			SET status = $2, error = $3, transaction_id = $4, decision_id = $5, executed_at = $6
+			WHERE id = $1`,
+			line.ID, line.Status, line.Error, line.TransactionID, line.DecisionID, line.ExecutedAt,
+		)
+	}
+	return r.pool.SendBatch(ctx, batch).Close()
+}
+
+func (r *bulkPaymentRepositoryImpl) SettleLine(ctx context.Context, decisionID int64, line Line) (int64, error) {
+	var paymentID int64
+	err := r.pool.QueryRow(ctx,
+		`UPDATE "BK_Bulk_Payment_Line"
+		SET status = $2, error = $3, transaction_id = $4, executed_at = $5
+		WHERE decision_id = $1 AND status = 'HELD'
+		RETURNING bulk_payment_id`,
+		decisionID, line.Status, line.Error, line.TransactionID, line.ExecutedAt,
+	).Scan(&paymentID)
+	return paymentID, err
+}
+
+func (r *bulkPaymentRepositoryImpl) FinishBulkPayment(ctx context.Context, payment BulkPayment) (BulkPayment, error) {
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE "BK_Bulk_Payment"
+		SET status = $2, succeeded_count = $3, failed_count = $4, error = $5,
+			completed_at = NOW(), claimed_until = NULL
+		WHERE id = $1`,
+		payment.ID, payment.Status, payment.SucceededCount, payment.FailedCount, payment.Error,
+	)
+	if err != nil {
+		return BulkPayment{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return BulkPayment{}, pgx.ErrNoRows
+	}
+	return r.GetBulkPayment(ctx, payment.ID)
+}
+
+func (r *bulkPaymentRepositoryImpl) getLines(ctx context.Context, paymentID int64) ([]Line, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+lineColumns+` FROM "BK_Bulk_Payment_Line"
+		WHERE bulk_payment_id = $1
+		ORDER BY line_number`,
+		paymentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []Line{}
+	for rows.Next() {
+		line, err := scanLine(rows)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
+
+func collectBulkPayments(rows pgx.Rows) ([]BulkPayment, error) {
+	defer rows.Close()
+
+	payments := []BulkPayment{}
+	for rows.Next() {
+		payment, err := scanBulkPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
+
+func scanBulkPayment(row pgx.Row) (BulkPayment, error) {
+	var payment BulkPayment
+	err := row.Scan(
+		&payment.ID,
+		&payment.AccountID,
+		&payment.AccountNumber,
+		&payment.CurrencyCode,
+		&payment.MessageID,
+		&payment.Format,
+		&payment.Mode,
+		&payment.Status,
+		&payment.LineCount,
+		&payment.TotalAmount,
+		&payment.SucceededCount,
+		&payment.FailedCount,
+		&payment.Error,
+		&payment.CreatedAt,
+		&payment.UpdatedAt,
+		&payment.CompletedAt,
+	)
+	return payment, err
+}
+
+func scanLine(row pgx.Row) (Line, error) {
+	var line Line
+	err := row.Scan(
+		&line.ID,
+		&line.BulkPaymentID,
+		&line.LineNumber,
+		&line.ToAccount,
+		&line.ToAccountID,
+		&line.Amount,
+		&line.Reference,
+		&line.EndToEndID,
+		&line.Status,
+		&line.Error,
+		&line.TransactionID,
+		&line.DecisionID,
+		&line.ExecutedAt,
+	)
+	return line, err
+}
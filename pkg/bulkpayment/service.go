@@ -0,0 +1,570 @@
+package bulkpayment
+
+import (
+	"bank_system/pkg/account"
+	"bank_system/postgres/sqlc"
+	"bank_system/utils"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	FormatPAIN001 = "pain001"
+	FormatCSV     = "csv"
+
+	// ModeAllOrNothing pays every line or none: a file with an invalid line
+	// is refused on upload. ModeBestEffort rejects the invalid lines and pays
+	// the others one by one.
+	ModeAllOrNothing = "ALL_OR_NOTHING"
+	ModeBestEffort   = "BEST_EFFORT"
+
+	StatusPending            = "PENDING"
+	StatusProcessing         = "PROCESSING"
+	StatusCompleted          = "COMPLETED"
+	StatusPartiallyCompleted = "PARTIALLY_COMPLETED"
+	StatusFailed             = "FAILED"
+
+	LinePending   = "PENDING"
+	LineSucceeded = "SUCCEEDED"
+	LineFailed    = "FAILED"
+	LineRejected  = "REJECTED"
+	// LineHeld is a line the risk engine held for review, paid if an
+	// operator approves it.
+	LineHeld = "HELD"
+
+	MaxFileSize      = 10 << 20
+	MaxLines         = 10000
+	DefaultBatchSize = 10
+
+	// ClaimTTL is how long an instance may take to execute a claimed payment
+	// before other instances consider it abandoned.
+	ClaimTTL = 10 * time.Minute
+
+	MESSAGE_ID_MAX_LENGTH    = 64  // "BK_Bulk_Payment".message_id VARCHAR(64)
+	REFERENCE_MAX_LENGTH     = 140 // "BK_Bulk_Payment_Line".reference VARCHAR(140)
+	END_TO_END_ID_MAX_LENGTH = 35  // "BK_Bulk_Payment_Line".end_to_end_id VARCHAR(35)
+)
+
+var accountNumberPattern = regexp.MustCompile(`^[0-9]{20}$`)
+
+// Accounts is what bulk payments need of account.AccountService.
+type Accounts interface {
+	GetAccountByIDNumber(ctx context.Context, idNumber string) (*sqlc.GetAccountByIDNumberRow, error)
+	AuthorizeStepUp(ctx context.Context, idNumber string, amount float64, code string) error
+	CheckRecipient(ctx context.Context, movement account.Movement) error
+	AuthorizeMovement(ctx context.Context, movement account.Movement, code string) (*account.Review, error)
+	CancelReview(ctx context.Context, idNumber string, review *account.Review) error
+	Transfer(ctx context.Context, fromIDNumber, toIDNumber string, amount float64, detail string) (int64, float64, error)
+	TransferBatch(ctx context.Context, idNumber string, transfers []account.BatchTransfer) ([]int64, float64, error)
+}
+
+type BulkPaymentService struct {
+	repo      BulkPaymentRepository
+	accounts  Accounts
+	batchSize int
+}
+
+// NewBulkPaymentService creates the service. batchSize is the number of
+// payments ExecutePending executes per call, DefaultBatchSize when 0.
+func NewBulkPaymentService(repo BulkPaymentRepository, accounts Accounts, batchSize int) *BulkPaymentService {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	return &BulkPaymentService{
+		repo:      repo,
+		accounts:  accounts,
+		batchSize: batchSize,
+	}
+}
+
+// CreateBulkPayment validates every line of a pain.001 or CSV file paying
+// from the account idNumber and stores it to be executed in the background.
+// A line whose recipient fails the recipient check is invalid. The total of
+// the lines to pay needs otpCode above the step-up threshold.
+func (s *BulkPaymentService) CreateBulkPayment(
+	ctx context.Context, idNumber, format, mode string, data []byte, otpCode string,
+) (BulkPayment, error) {
+	from, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return BulkPayment{}, err
+	}
+
+	verr := &utils.ValidationError{}
+	if format != FormatPAIN001 && format != FormatCSV {
+		verr.Add("format", "must be one of pain001, csv")
+	}
+	if mode != ModeAllOrNothing && mode != ModeBestEffort {
+		verr.Add("mode", "must be one of ALL_OR_NOTHING, BEST_EFFORT")
+	}
+	if err := verr.Err(); err != nil {
+		return BulkPayment{}, err
+	}
+
+	file, err := parseFile(format, data)
+	if err != nil {
+		verr.Add("file", err.Error())
+		return BulkPayment{}, verr
+	}
+	checkFile(verr, file, from)
+	if err := verr.Err(); err != nil {
+		return BulkPayment{}, err
+	}
+
+	payment := BulkPayment{
+		AccountID: from.ID,
+		MessageID: file.MessageID,
+		Format:    format,
+		Mode:      mode,
+		Lines:     make([]Line, 0, len(file.Entries)),
+	}
+	// Lines that fail are reported as lines[<line number>].<field>.
+	lineErrs := &utils.ValidationError{}
+	destinations := map[string]*sqlc.GetAccountByIDNumberRow{}
+	for i, e := range file.Entries {
+		line, fields, err := s.validateLine(ctx, from, e, destinations)
+		if err != nil {
+			return BulkPayment{}, err
+		}
+		line.LineNumber = i + 1
+		line.Status = LinePending
+		if len(fields) > 0 {
+			line.Status = LineRejected
+			messages := make([]string, 0, len(fields))
+			for _, field := range fields {
+				lineErrs.Add(fmt.Sprintf("lines[%d].%s", line.LineNumber, field.Field), field.Message)
+				messages = append(messages, field.Field+" "+field.Message)
+			}
+			line.Error = strings.Join(messages, "; ")
+		} else {
+			payment.TotalAmount += line.Amount
+		}
+		payment.Lines = append(payment.Lines, line)
+	}
+	payment.TotalAmount = round(payment.TotalAmount, minorUnits(from.CurrencyCode))
+
+	if len(lineErrs.Fields) > 0 && (mode == ModeAllOrNothing || payment.TotalAmount == 0) {
+		return BulkPayment{}, lineErrs
+	}
+
+	if err := s.accounts.AuthorizeStepUp(ctx, idNumber, payment.TotalAmount, otpCode); err != nil {
+		return BulkPayment{}, err
+	}
+
+	return s.repo.CreateBulkPayment(ctx, payment)
+}
+
+func (s *BulkPaymentService) GetAccountBulkPayments(ctx context.Context, idNumber string) ([]BulkPayment, error) {
+	from, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetAccountBulkPayments(ctx, from.ID)
+}
+
+// GetBulkPayment returns the payment with the result of every line if it
+// pays from the account idNumber.
+func (s *BulkPaymentService) GetBulkPayment(ctx context.Context, idNumber string, paymentID int64) (BulkPayment, error) {
+	from, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return BulkPayment{}, err
+	}
+
+	payment, err := s.repo.GetBulkPayment(ctx, paymentID)
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && payment.AccountID != from.ID {
+		return BulkPayment{}, utils.NewBankSystemError(utils.ErrBulkPaymentNotFound, strconv.FormatInt(paymentID, 10))
+	}
+	return payment, err
+}
+
+// ExecutePending executes the payments waiting to be executed, at most the
+// batch size per call, and returns how many it finished. A payment
+// interrupted by e.g. a lost connection is claimed again after ClaimTTL and
+// goes on with the lines it had not paid.
+func (s *BulkPaymentService) ExecutePending(ctx context.Context, now time.Time) (int, error) {
+	payments, err := s.repo.ClaimPendingBulkPayments(ctx, now, now.Add(ClaimTTL), s.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		finished int
+		errs     []error
+	)
+	for _, payment := range payments {
+		if err := s.execute(ctx, payment); err != nil {
+			errs = append(errs, fmt.Errorf("bulk payment %d: %w", payment.ID, err))
+			continue
+		}
+		finished++
+	}
+	return finished, errors.Join(errs...)
+}
+
+// execute pays the pending lines of a claimed payment and finishes it. Every
+// line is authorized first: in best effort mode a line held for review is
+// left to the review, which settles it, but an all-or-nothing payment is not
+// paid in part, so there a line held or refused fails them all. The review
+// is then cancelled.
+func (s *BulkPaymentService) execute(ctx context.Context, payment BulkPayment) error {
+	var pending []*Line
+	for i := range payment.Lines {
+		if payment.Lines[i].Status == LinePending {
+			pending = append(pending, &payment.Lines[i])
+		}
+	}
+
+	switch {
+	case len(pending) == 0:
+	case payment.Mode == ModeAllOrNothing:
+		if err := s.authorizeAll(ctx, payment, pending); err != nil {
+			if !final(err) {
+				return err
+			}
+			executedAt := timestamptz(time.Now())
+			for _, line := range pending {
+				line.ExecutedAt = executedAt
+				line.Status = LineFailed
+				line.Error = err.Error()
+			}
+			payment.Error = err.Error()
+			if err := s.repo.RecordLines(ctx, derefLines(pending)); err != nil {
+				return err
+			}
+			break
+		}
+
+		transfers := make([]account.BatchTransfer, 0, len(pending))
+		for _, line := range pending {
+			transfers = append(transfers, account.BatchTransfer{
+				ToIDNumber: line.ToAccount,
+				Amount:     line.Amount,
+				Detail:     line.Reference,
+			})
+		}
+
+		// The claim must not expire while the transfers run.
+		batchCtx, cancel := context.WithTimeout(ctx, ClaimTTL)
+		txIDs, _, err := s.accounts.TransferBatch(batchCtx, payment.AccountNumber, transfers)
+		cancel()
+		if err != nil && !final(err) {
+			return err
+		}
+
+		executedAt := timestamptz(time.Now())
+		for i, line := range pending {
+			line.ExecutedAt = executedAt
+			if err != nil {
+				line.Status = LineFailed
+				line.Error = err.Error()
+				continue
+			}
+			line.Status = LineSucceeded
+			line.TransactionID = pgtype.Int8{Int64: txIDs[i], Valid: true}
+		}
+		if err != nil {
+			payment.Error = err.Error()
+		}
+		if err := s.repo.RecordLines(ctx, derefLines(pending)); err != nil {
+			return err
+		}
+	default:
+		for _, line := range pending {
+			var txID int64
+			transferCtx, cancel := context.WithTimeout(ctx, utils.TIMEOUT)
+			review, err := s.accounts.AuthorizeMovement(transferCtx, movement(payment, line), "")
+			if err == nil && review == nil {
+				txID, _, err = s.accounts.Transfer(transferCtx, payment.AccountNumber, line.ToAccount, line.Amount, line.Reference)
+			}
+			cancel()
+			if err != nil && !final(err) {
+				return err
+			}
+
+			line.ExecutedAt = timestamptz(time.Now())
+			switch {
+			case err != nil:
+				line.Status = LineFailed
+				line.Error = err.Error()
+			case review != nil:
+				line.Status = LineHeld
+				line.Error = heldError(review).Error()
+				line.DecisionID = pgtype.Int8{Int64: review.DecisionID, Valid: true}
+			default:
+				line.Status = LineSucceeded
+				line.TransactionID = pgtype.Int8{Int64: txID, Valid: true}
+			}
+			if err := s.repo.RecordLines(ctx, []Line{*line}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.finish(ctx, payment)
+}
+
+// SettleReview is the risk.Settler of the lines held for review: an approved
+// one succeeded with the transaction of the review, a rejected one failed.
+// The counts and status of a payment that is finished are updated; one that
+// is still executing counts its lines when it finishes.
+func (s *BulkPaymentService) SettleReview(ctx context.Context, decisionID, txID int64, reviewErr error) error {
+	line := Line{
+		Status:        LineSucceeded,
+		TransactionID: pgtype.Int8{Int64: txID, Valid: true},
+		ExecutedAt:    timestamptz(time.Now()),
+	}
+	if reviewErr != nil {
+		line.Status = LineFailed
+		line.Error = reviewErr.Error()
+		line.TransactionID = pgtype.Int8{}
+	}
+
+	paymentID, err := s.repo.SettleLine(ctx, decisionID, line)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	payment, err := s.repo.GetBulkPayment(ctx, paymentID)
+	if err != nil || payment.Status == StatusProcessing {
+		return err
+	}
+	return s.finish(ctx, payment)
+}
+
+// finish counts the lines of payment as stored, which a review may have
+// settled in the meantime, and stores its status and counts.
+func (s *BulkPaymentService) finish(ctx context.Context, payment BulkPayment) error {
+	stored, err := s.repo.GetBulkPayment(ctx, payment.ID)
+	if err != nil {
+		return err
+	}
+	payment.Lines = stored.Lines
+
+	payment.SucceededCount, payment.FailedCount = 0, 0
+	for _, line := range payment.Lines {
+		switch line.Status {
+		case LineSucceeded:
+			payment.SucceededCount++
+		case LineHeld:
+		default:
+			payment.FailedCount++
+		}
+	}
+	switch {
+	case payment.SucceededCount == len(payment.Lines):
+		payment.Status = StatusCompleted
+	case payment.FailedCount == len(payment.Lines):
+		payment.Status = StatusFailed
+	default:
+		payment.Status = StatusPartiallyCompleted
+	}
+
+	_, err = s.repo.FinishBulkPayment(ctx, payment)
+	return err
+}
+
+// authorizeAll authorizes every line of an all-or-nothing payment and fails
+// at the first one refused or held for review, whose review it cancels.
+func (s *BulkPaymentService) authorizeAll(ctx context.Context, payment BulkPayment, lines []*Line) error {
+	for _, line := range lines {
+		authorizeCtx, cancel := context.WithTimeout(ctx, utils.TIMEOUT)
+		review, err := s.accounts.AuthorizeMovement(authorizeCtx, movement(payment, line), "")
+		cancel()
+		if err != nil {
+			return err
+		}
+		if review != nil {
+			if err := s.accounts.CancelReview(ctx, payment.AccountNumber, review); err != nil {
+				return err
+			}
+			return heldError(review)
+		}
+	}
+	return nil
+}
+
+// movement is the transfer of line.
+func movement(payment BulkPayment, line *Line) account.Movement {
+	return account.Movement{
+		Type:            account.MovementTransfer,
+		AccountNumber:   payment.AccountNumber,
+		Amount:          line.Amount,
+		Detail:          line.Reference,
+		ToAccountNumber: line.ToAccount,
+		Scheduled:       true,
+	}
+}
+
+func heldError(review *account.Review) error {
+	return utils.NewBankSystemError(utils.ErrTransactionHeld, strconv.FormatInt(review.DecisionID, 10))
+}
+
+// checkFile checks what a file says about itself: its id, that it pays from
+// the account and, in pain.001, the number of transactions and their sum.
+func checkFile(verr *utils.ValidationError, file paymentFile, from *sqlc.GetAccountByIDNumberRow) {
+	switch {
+	case file.MessageID == "":
+		verr.Add("file", "must have a message id")
+	case len(file.MessageID) > MESSAGE_ID_MAX_LENGTH:
+		verr.Add("file", fmt.Sprintf("message id must be at most %d characters", MESSAGE_ID_MAX_LENGTH))
+	}
+	if file.Debtor != "" && file.Debtor != from.IDNumber {
+		verr.Add("file", "must pay from account "+from.IDNumber)
+	}
+
+	switch {
+	case len(file.Entries) == 0:
+		verr.Add("file", "has no payment")
+		return
+	case len(file.Entries) > MaxLines:
+		verr.Add("file", fmt.Sprintf("must have at most %d payments", MaxLines))
+		return
+	}
+
+	if file.NumberOfTxs != "" && file.NumberOfTxs != strconv.Itoa(len(file.Entries)) {
+		verr.Add("file", fmt.Sprintf("NbOfTxs is %s but the file has %d transactions", file.NumberOfTxs, len(file.Entries)))
+	}
+	if file.ControlSum != "" {
+		sum := 0.0
+		for _, e := range file.Entries {
+			amount, _ := strconv.ParseFloat(e.Amount, 64)
+			sum += amount
+		}
+		sum = round(sum, utils.MAX_MINOR_UNITS)
+		controlSum, err := strconv.ParseFloat(file.ControlSum, 64)
+		if err != nil || round(controlSum, utils.MAX_MINOR_UNITS) != sum {
+			verr.Add("file", fmt.Sprintf("CtrlSum is %s but the amounts add up to %s", file.ControlSum, strconv.FormatFloat(sum, 'f', -1, 64)))
+		}
+	}
+}
+
+// validateLine turns an entry into a line and returns the fields that make it
+// invalid. destinations caches the accounts already looked up.
+func (s *BulkPaymentService) validateLine(
+	ctx context.Context, from *sqlc.GetAccountByIDNumberRow, e entry, destinations map[string]*sqlc.GetAccountByIDNumberRow,
+) (Line, []utils.FieldError, error) {
+	line := Line{
+		ToAccount:  e.ToAccount,
+		Reference:  e.Reference,
+		EndToEndID: e.EndToEndID,
+	}
+
+	verr := &utils.ValidationError{}
+	amount, err := strconv.ParseFloat(e.Amount, 64)
+	if err != nil {
+		verr.Add("amount", "must be a number")
+	} else {
+		line.Amount = amount
+		utils.ValidateAmount(verr, amount, from.CurrencyCode)
+	}
+	if e.Currency != "" && e.Currency != from.CurrencyCode {
+		verr.Add("currency", "must be "+from.CurrencyCode+", the currency of the account")
+	}
+	if len([]rune(e.Reference)) > REFERENCE_MAX_LENGTH {
+		verr.Add("reference", fmt.Sprintf("must be at most %d characters", REFERENCE_MAX_LENGTH))
+	}
+	if len([]rune(e.EndToEndID)) > END_TO_END_ID_MAX_LENGTH {
+		verr.Add("end_to_end_id", fmt.Sprintf("must be at most %d characters", END_TO_END_ID_MAX_LENGTH))
+	}
+
+	if !accountNumberPattern.MatchString(e.ToAccount) {
+		verr.Add("to_account", "must be 20 digits")
+		return line, verr.Fields, nil
+	}
+	to, ok := destinations[e.ToAccount]
+	if !ok {
+		to, err = s.accounts.GetAccountByIDNumber(ctx, e.ToAccount)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return Line{}, nil, err
+		}
+		destinations[e.ToAccount] = to
+	}
+	switch {
+	case to == nil:
+		verr.Add("to_account", "does not exist")
+	case to.ID == from.ID:
+		verr.Add("to_account", "must not be the paying account")
+	case to.Status != account.StatusActive:
+		verr.Add("to_account", "is not active")
+	case to.CurrencyCode != from.CurrencyCode:
+		verr.Add("to_account", "must be in "+from.CurrencyCode)
+	default:
+		line.ToAccountID = pgtype.Int8{Int64: to.ID, Valid: true}
+	}
+	if len(verr.Fields) > 0 {
+		return line, verr.Fields, nil
+	}
+
+	err = s.accounts.CheckRecipient(ctx, account.Movement{
+		Type:            account.MovementTransfer,
+		AccountNumber:   from.IDNumber,
+		Amount:          line.Amount,
+		ToAccountNumber: line.ToAccount,
+	})
+	var bsErr *utils.BankSystemError
+	if errors.As(err, &bsErr) {
+		verr.Add("to_account", bsErr.Error())
+	} else if err != nil {
+		return Line{}, nil, err
+	}
+	return line, verr.Fields, nil
+}
+
+func (s *BulkPaymentService) getAccount(ctx context.Context, idNumber string) (*sqlc.GetAccountByIDNumberRow, error) {
+	row, err := s.accounts.GetAccountByIDNumber(ctx, idNumber)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, utils.NewBankSystemError(utils.ErrAccountNotFound, idNumber)
+	}
+	return row, err
+}
+
+// final reports whether a transfer failed for a reason of its own, e.g. the
+// funds were insufficient, rather than a passing error like a lost connection
+// or a serialization failure, after which the payment is tried again.
+func final(err error) bool {
+	var (
+		bsErr *utils.BankSystemError
+		pgErr *pgconn.PgError
+	)
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "P0001" || strings.HasPrefix(pgErr.Code, "23")
+	}
+	return errors.As(err, &bsErr) || utils.IsValidationError(err)
+}
+
+func derefLines(lines []*Line) []Line {
+	values := make([]Line, 0, len(lines))
+	for _, line := range lines {
+		values = append(values, *line)
+	}
+	return values
+}
+
+func minorUnits(currency string) int {
+	if info, ok := utils.LookupCurrency(currency); ok {
+		return info.MinorUnits
+	}
+	return utils.DEFAULT_MINOR_UNITS
+}
+
+func round(amount float64, decimals int) float64 {
+	scale := math.Pow10(decimals)
+	return math.Round(amount*scale) / scale
+}
+
+func timestamptz(t time.Time) pgtype.Timestamptz {
+	return pgtype.Timestamptz{Time: t, Valid: true}
+}
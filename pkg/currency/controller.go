@@ -0,0 +1,134 @@
+package currency
+
+import (
+	"bank_system/utils"
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CurrencyController struct {
+	service *CurrencyService
+	logger  *log.Logger
+}
+
+func NewCurrencyController(service *CurrencyService, logger *log.Logger) *CurrencyController {
+	return &CurrencyController{
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (c *CurrencyController) ListCurrencies(ctx *gin.Context) {
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	currencies, err := c.service.ListCurrencies(reqCtx)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, currencies)
+}
+
+func (c *CurrencyController) GetCurrency(ctx *gin.Context) {
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	currency, err := c.service.GetCurrency(reqCtx, ctx.Param("code"))
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, currency)
+}
+
+func (c *CurrencyController) CreateCurrency(ctx *gin.Context) {
+	type CreateCurrencyRequest struct {
+		Code       string `json:"code" binding:"required"`
+		Name       string `json:"name"`
+		MinorUnits *int   `json:"minor_units" binding:"required"`
+		Symbol     string `json:"symbol"`
+		Enabled    *bool  `json:"enabled"`
+	}
+
+	var req CreateCurrencyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	currency, err := c.service.CreateCurrency(reqCtx, Currency{
+		Code:       req.Code,
+		Name:       req.Name,
+		MinorUnits: *req.MinorUnits,
+		Symbol:     req.Symbol,
+		Enabled:    req.Enabled == nil || *req.Enabled,
+	})
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, currency)
+}
+
+func (c *CurrencyController) UpdateCurrency(ctx *gin.Context) {
+	var req CurrencyUpdate
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	currency, err := c.service.UpdateCurrency(reqCtx, ctx.Param("code"), req)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, currency)
+}
+
+func errorStatus(err error) int {
+	switch {
+	case utils.IsValidationError(err):
+		return http.StatusBadRequest
+	case utils.IsBankSystemError(err, utils.ErrCurrencyNotFound):
+		return http.StatusNotFound
+	case utils.IsBankSystemError(err, utils.ErrCurrencyExists),
+		utils.IsBankSystemError(err, utils.ErrCurrencyInUse):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RegisterRoutes serves the catalogue publicly and the changes to it behind
+// the admin middleware.
+func (c *CurrencyController) RegisterRoutes(router *gin.Engine, admin gin.HandlerFunc) {
+	group := router.Group("/currencies")
+	{
+		group.GET("", c.ListCurrencies)
+		group.GET("/:code", c.GetCurrency)
+	}
+
+	adminGroup := router.Group("/admin/currencies", admin)
+	{
+		adminGroup.POST("", c.CreateCurrency)
+		adminGroup.PATCH("/:code", c.UpdateCurrency)
+	}
+}
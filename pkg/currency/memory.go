@@ -0,0 +1,107 @@
+package currency
+
+import (
+	"bank_system/pkg/memstore"
+	"bank_system/utils"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// memoryCurrencyRepository is a CurrencyRepository backed by a memstore.Store.
+type memoryCurrencyRepository struct {
+	store *memstore.Store
+}
+
+func NewMemoryCurrencyRepository(store *memstore.Store) CurrencyRepository {
+	return &memoryCurrencyRepository{store: store}
+}
+
+func (r *memoryCurrencyRepository) ListCurrencies(ctx context.Context) ([]Currency, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	currencies := make([]Currency, 0, len(r.store.Currencies))
+	for _, record := range r.store.Currencies {
+		currencies = append(currencies, toCurrency(record))
+	}
+	sort.Slice(currencies, func(i, j int) bool { return currencies[i].Code < currencies[j].Code })
+
+	return currencies, nil
+}
+
+func (r *memoryCurrencyRepository) GetCurrency(ctx context.Context, code string) (Currency, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.Currencies[code]
+	if !ok {
+		return Currency{}, pgx.ErrNoRows
+	}
+	return toCurrency(record), nil
+}
+
+func (r *memoryCurrencyRepository) CreateCurrency(ctx context.Context, currency Currency) (Currency, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	if _, exists := r.store.Currencies[currency.Code]; exists {
+		return Currency{}, utils.NewBankSystemError(utils.ErrCurrencyExists, currency.Code)
+	}
+
+	now := time.Now()
+	record := &memstore.CurrencyRecord{
+		Code:       currency.Code,
+		Name:       currency.Name,
+		MinorUnits: currency.MinorUnits,
+		Symbol:     currency.Symbol,
+		Enabled:    currency.Enabled,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	r.store.Currencies[record.Code] = record
+	r.store.Audit(ctx, "BK_Currency", record.Code, nil, *record)
+
+	return toCurrency(record), nil
+}
+
+func (r *memoryCurrencyRepository) UpdateCurrency(ctx context.Context, currency Currency) (Currency, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.Currencies[currency.Code]
+	if !ok {
+		return Currency{}, pgx.ErrNoRows
+	}
+	if record.MinorUnits != currency.MinorUnits {
+		for _, account := range r.store.Accounts {
+			if account.CurrencyCode == currency.Code {
+				return Currency{}, utils.NewBankSystemError(utils.ErrCurrencyInUse, currency.Code)
+			}
+		}
+	}
+
+	before := *record
+	record.Name = currency.Name
+	record.MinorUnits = currency.MinorUnits
+	record.Symbol = currency.Symbol
+	record.Enabled = currency.Enabled
+	record.UpdatedAt = time.Now()
+	r.store.Audit(ctx, "BK_Currency", record.Code, before, *record)
+
+	return toCurrency(record), nil
+}
+
+func toCurrency(record *memstore.CurrencyRecord) Currency {
+	return Currency{
+		Code:       record.Code,
+		Name:       record.Name,
+		MinorUnits: record.MinorUnits,
+		Symbol:     record.Symbol,
+		Enabled:    record.Enabled,
+		CreatedAt:  record.CreatedAt,
+		UpdatedAt:  record.UpdatedAt,
+	}
+}
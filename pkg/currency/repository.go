@@ -0,0 +1,112 @@
+package currency
+
+import (
+	"bank_system/utils"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const currencyColumns = `code, name, minor_units, symbol, enabled, created_at, updated_at`
+
+// Currency is an entry of the catalogue accounts can be opened in.
+type Currency struct {
+	Code       string    `json:"code"`
+	Name       string    `json:"name"`
+	MinorUnits int       `json:"minor_units"`
+	Symbol     string    `json:"symbol"`
+	Enabled    bool      `json:"enabled"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type CurrencyRepository interface {
+	ListCurrencies(ctx context.Context) ([]Currency, error)
+	GetCurrency(ctx context.Context, code string) (Currency, error)
+	CreateCurrency(ctx context.Context, currency Currency) (Currency, error)
+	// UpdateCurrency refuses to change the minor units of a currency that
+	// accounts are held in.
+	UpdateCurrency(ctx context.Context, currency Currency) (Currency, error)
+}
+
+type currencyRepositoryImpl struct {
+	pool *pgxpool.Pool
+}
+
+func NewCurrencyRepository(pool *pgxpool.Pool) CurrencyRepository {
+	return &currencyRepositoryImpl{pool: pool}
+}
+
+func (r *currencyRepositoryImpl) ListCurrencies(ctx context.Context) ([]Currency, error) {
+	rows, err := r.pool.Query(ctx, `SELECT `+currencyColumns+` FROM "BK_Currency" ORDER BY code`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	currencies := []Currency{}
+	for rows.Next() {
+		currency, err := scanCurrency(rows)
+		if err != nil {
+			return nil, err
+		}
+		currencies = append(currencies, currency)
+	}
+	return currencies, rows.Err()
+}
+
+func (r *currencyRepositoryImpl) GetCurrency(ctx context.Context, code string) (Currency, error) {
+	return scanCurrency(r.pool.QueryRow(ctx, `SELECT `+currencyColumns+` FROM "BK_Currency" WHERE code = $1`, code))
+}
+
+func (r *currencyRepositoryImpl) CreateCurrency(ctx context.Context, currency Currency) (Currency, error) {
+	created, err := scanCurrency(r.pool.QueryRow(ctx,
+		`INSERT INTO "BK_Currency" (code, name, minor_units, symbol, enabled)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+currencyColumns,
+		currency.Code, currency.Name, currency.MinorUnits, currency.Symbol, currency.Enabled,
+	))
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return Currency{}, utils.NewBankSystemError(utils.ErrCurrencyExists, currency.Code)
+	}
+	return created, err
+}
+
+func (r *currencyRepositoryImpl) UpdateCurrency(ctx context.Context, currency Currency) (Currency, error) {
+	updated, err := scanCurrency(r.pool.QueryRow(ctx,
+		`UPDATE "BK_Currency"
+		SET name = $2, minor_units = $3, symbol = $4, enabled = $5
+		WHERE code = $1
+			AND (minor_units = $3 OR NOT EXISTS (SELECT 1 FROM "BK_Account" WHERE currency_code = $1))
+		RETURNING `+currencyColumns,
+		currency.Code, currency.Name, currency.MinorUnits, currency.Symbol, currency.Enabled,
+	))
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return updated, err
+	}
+
+	if _, err := r.GetCurrency(ctx, currency.Code); err != nil {
+		return Currency{}, err
+	}
+	return Currency{}, utils.NewBankSystemError(utils.ErrCurrencyInUse, currency.Code)
+}
+
+func scanCurrency(row pgx.Row) (Currency, error) {
+	var currency Currency
+	err := row.Scan(
+		&currency.Code,
+		&currency.Name,
+		&currency.MinorUnits,
+		&currency.Symbol,
+		&currency.Enabled,
+		&currency.CreatedAt,
+		&currency.UpdatedAt,
+	)
+	return currency, err
+}
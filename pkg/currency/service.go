@@ -0,0 +1,127 @@
+package currency
+
+import (
+	"bank_system/utils"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	NAME_MAX_LENGTH   = 64
+	SYMBOL_MAX_LENGTH = 8 // "BK_Currency".symbol VARCHAR(8)
+)
+
+var codePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+type CurrencyService struct {
+	repo CurrencyRepository
+}
+
+func NewCurrencyService(repo CurrencyRepository) *CurrencyService {
+	return &CurrencyService{repo: repo}
+}
+
+// Refresh loads the catalogue into the registry that amount validation and
+// formatting read, see utils.SetCurrencies. Changes made through this service
+// are applied at once, changes made by other instances on the next Refresh.
+func (s *CurrencyService) Refresh(ctx context.Context) error {
+	currencies, err := s.repo.ListCurrencies(ctx)
+	if err != nil {
+		return err
+	}
+
+	byCode := make(map[string]utils.CurrencyInfo, len(currencies))
+	for _, c := range currencies {
+		byCode[c.Code] = utils.CurrencyInfo{MinorUnits: c.MinorUnits, Symbol: c.Symbol, Enabled: c.Enabled}
+	}
+	utils.SetCurrencies(byCode)
+	return nil
+}
+
+func (s *CurrencyService) ListCurrencies(ctx context.Context) ([]Currency, error) {
+	return s.repo.ListCurrencies(ctx)
+}
+
+func (s *CurrencyService) GetCurrency(ctx context.Context, code string) (Currency, error) {
+	currency, err := s.repo.GetCurrency(ctx, code)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Currency{}, utils.NewBankSystemError(utils.ErrCurrencyNotFound, code)
+	}
+	return currency, err
+}
+
+func (s *CurrencyService) CreateCurrency(ctx context.Context, currency Currency) (Currency, error) {
+	verr := &utils.ValidationError{}
+	if !codePattern.MatchString(currency.Code) {
+		verr.Add("code", "must be three upper case letters")
+	}
+	validate(verr, currency)
+	if err := verr.Err(); err != nil {
+		return Currency{}, err
+	}
+
+	created, err := s.repo.CreateCurrency(ctx, currency)
+	if err != nil {
+		return Currency{}, err
+	}
+	return created, s.Refresh(ctx)
+}
+
+// CurrencyUpdate changes the fields that are not nil.
+type CurrencyUpdate struct {
+	Name       *string `json:"name"`
+	MinorUnits *int    `json:"minor_units"`
+	Symbol     *string `json:"symbol"`
+	Enabled    *bool   `json:"enabled"`
+}
+
+func (s *CurrencyService) UpdateCurrency(ctx context.Context, code string, update CurrencyUpdate) (Currency, error) {
+	currency, err := s.GetCurrency(ctx, code)
+	if err != nil {
+		return Currency{}, err
+	}
+
+	if update.Name != nil {
+		currency.Name = *update.Name
+	}
+	if update.MinorUnits != nil {
+		currency.MinorUnits = *update.MinorUnits
+	}
+	if update.Symbol != nil {
+		currency.Symbol = *update.Symbol
+	}
+	if update.Enabled != nil {
+		currency.Enabled = *update.Enabled
+	}
+
+	verr := &utils.ValidationError{}
+	validate(verr, currency)
+	if err := verr.Err(); err != nil {
+		return Currency{}, err
+	}
+
+	updated, err := s.repo.UpdateCurrency(ctx, currency)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Currency{}, utils.NewBankSystemError(utils.ErrCurrencyNotFound, code)
+	}
+	if err != nil {
+		return Currency{}, err
+	}
+	return updated, s.Refresh(ctx)
+}
+
+func validate(verr *utils.ValidationError, currency Currency) {
+	if currency.MinorUnits < 0 || currency.MinorUnits > utils.MAX_MINOR_UNITS {
+		verr.Add("minor_units", fmt.Sprintf("must be between 0 and %d", utils.MAX_MINOR_UNITS))
+	}
+	if len([]rune(currency.Name)) > NAME_MAX_LENGTH {
+		verr.Add("name", fmt.Sprintf("must be at most %d characters", NAME_MAX_LENGTH))
+	}
+	if len([]rune(currency.Symbol)) > SYMBOL_MAX_LENGTH {
+		verr.Add("symbol", fmt.Sprintf("must be at most %d characters", SYMBOL_MAX_LENGTH))
+	}
+}
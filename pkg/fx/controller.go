@@ -0,0 +1,82 @@
+package fx
+
+import (
+	"bank_system/utils"
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FXController struct {
+	service *FXService
+	logger  *log.Logger
+}
+
+func NewFXController(service *FXService, logger *log.Logger) *FXController {
+	return &FXController{
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (c *FXController) CreateQuote(ctx *gin.Context) {
+	type CreateQuoteRequest struct {
+		FromCurrency string `json:"from_currency" binding:"required"`
+		ToCurrency   string `json:"to_currency" binding:"required"`
+	}
+
+	var req CreateQuoteRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	quote, err := c.service.Quote(reqCtx, req.FromCurrency, req.ToCurrency)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, quote)
+}
+
+func (c *FXController) GetQuote(ctx *gin.Context) {
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	quote, err := c.service.GetQuote(reqCtx, ctx.Param("quote_id"))
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, quote)
+}
+
+func errorStatus(err error) int {
+	switch {
+	case utils.IsValidationError(err):
+		return http.StatusBadRequest
+	case utils.IsBankSystemError(err, utils.ErrQuoteNotFound):
+		return http.StatusNotFound
+	case utils.IsBankSystemError(err, utils.ErrRateUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (c *FXController) RegisterRoutes(router *gin.Engine) {
+	group := router.Group("/fx")
+	{
+		group.POST("/quotes", c.CreateQuote)
+		group.GET("/quotes/:quote_id", c.GetQuote)
+	}
+}
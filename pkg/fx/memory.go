@@ -0,0 +1,66 @@
+package fx
+
+import (
+	"bank_system/pkg/memstore"
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// memoryQuoteRepository is a QuoteRepository backed by a memstore.Store. The
+// memory account repository uses the same quotes for transfers.
+type memoryQuoteRepository struct {
+	store *memstore.Store
+}
+
+func NewMemoryQuoteRepository(store *memstore.Store) QuoteRepository {
+	return &memoryQuoteRepository{store: store}
+}
+
+func (r *memoryQuoteRepository) CreateQuote(ctx context.Context, quote Quote) (Quote, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record := &memstore.FXQuoteRecord{
+		ID:           quote.ID,
+		FromCurrency: quote.FromCurrency,
+		ToCurrency:   quote.ToCurrency,
+		MidRate:      quote.MidRate,
+		Rate:         quote.Rate,
+		SpreadBps:    quote.SpreadBps,
+		Source:       quote.Source,
+		CreatedAt:    time.Now(),
+		ExpiresAt:    quote.ExpiresAt,
+	}
+	r.store.FXQuotes[record.ID] = record
+
+	return toQuote(record), nil
+}
+
+func (r *memoryQuoteRepository) GetQuote(ctx context.Context, id string) (Quote, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.FXQuotes[id]
+	if !ok {
+		return Quote{}, pgx.ErrNoRows
+	}
+	return toQuote(record), nil
+}
+
+func toQuote(record *memstore.FXQuoteRecord) Quote {
+	return Quote{
+		ID:            record.ID,
+		FromCurrency:  record.FromCurrency,
+		ToCurrency:    record.ToCurrency,
+		MidRate:       record.MidRate,
+		Rate:          record.Rate,
+		SpreadBps:     record.SpreadBps,
+		Source:        record.Source,
+		CreatedAt:     record.CreatedAt,
+		ExpiresAt:     record.ExpiresAt,
+		UsedAt:        record.UsedAt,
+		TransactionID: record.TransactionID,
+	}
+}
@@ -0,0 +1,217 @@
+// Package fx converts between the currencies accounts can hold. Rates come
+// from a RateProvider; the Service adds a spread and locks the resulting rate
+// in a Quote for a short time, which a transfer between accounts in different
+// currencies then uses.
+package fx
+
+import (
+	"bank_system/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Rate is the mid-market price of one unit of Base in Quote.
+type Rate struct {
+	Base   string
+	Quote  string
+	Rate   float64
+	Source string
+	AsOf   time.Time
+}
+
+type RateProvider interface {
+	// Rate returns the rate from base to quote, or ErrRateUnavailable.
+	Rate(ctx context.Context, base, quote string) (Rate, error)
+}
+
+// rateTable derives inverse and cross rates from the pairs it was given.
+type rateTable struct {
+	rates  map[string]map[string]float64
+	source string
+	asOf   time.Time
+}
+
+func newRateTable(source string, asOf time.Time) *rateTable {
+	return &rateTable{rates: map[string]map[string]float64{}, source: source, asOf: asOf}
+}
+
+func (t *rateTable) add(base, quote string, rate float64) {
+	if t.rates[base] == nil {
+		t.rates[base] = map[string]float64{}
+	}
+	t.rates[base][quote] = rate
+}
+
+// direct looks up base/quote or its inverse.
+func (t *rateTable) direct(base, quote string) (float64, bool) {
+	if base == quote {
+		return 1, true
+	}
+	if rate, ok := t.rates[base][quote]; ok {
+		return rate, true
+	}
+	if rate, ok := t.rates[quote][base]; ok {
+		return 1 / rate, true
+	}
+	return 0, false
+}
+
+// lookup falls back to crossing through a third currency.
+func (t *rateTable) lookup(base, quote string) (Rate, error) {
+	if rate, ok := t.direct(base, quote); ok {
+		return t.rate(base, quote, rate), nil
+	}
+	for via := range t.currencies() {
+		first, ok := t.direct(base, via)
+		if !ok {
+			continue
+		}
+		if second, ok := t.direct(via, quote); ok {
+			return t.rate(base, quote, first*second), nil
+		}
+	}
+	return Rate{}, utils.NewBankSystemError(utils.ErrRateUnavailable, base+"/"+quote)
+}
+
+func (t *rateTable) currencies() map[string]bool {
+	currencies := map[string]bool{}
+	for base, quotes := range t.rates {
+		currencies[base] = true
+		for quote := range quotes {
+			currencies[quote] = true
+		}
+	}
+	return currencies
+}
+
+func (t *rateTable) rate(base, quote string, rate float64) Rate {
+	return Rate{Base: base, Quote: quote, Rate: rate, Source: t.source, AsOf: t.asOf}
+}
+
+// RatesFile is the format read by NewFileRateProvider: the price of one unit
+// of Base in every currency of Rates.
+//
+//	{"base": "USD", "as_of": "2024-05-01T00:00:00Z", "rates": {"EUR": 0.93, "TWD": 32.4}}
+type RatesFile struct {
+	Base  string             `json:"base"`
+	AsOf  time.Time          `json:"as_of"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+type fileRateProvider struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	table   *rateTable
+}
+
+// NewFileRateProvider serves rates from a RatesFile, for running without a
+// market data feed. The file is read again whenever it changes.
+func NewFileRateProvider(path string) (RateProvider, error) {
+	p := &fileRateProvider{path: path}
+	if _, err := p.load(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *fileRateProvider) Rate(ctx context.Context, base, quote string) (Rate, error) {
+	table, err := p.load()
+	if err != nil {
+		return Rate{}, err
+	}
+	return table.lookup(base, quote)
+}
+
+func (p *fileRateProvider) load() (*rateTable, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, err
+	}
+	if p.table != nil && info.ModTime().Equal(p.modTime) {
+		return p.table, nil
+	}
+
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, err
+	}
+	var file RatesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("rates file %s: %w", p.path, err)
+	}
+	if file.Base == "" {
+		return nil, fmt.Errorf("rates file %s: base is missing", p.path)
+	}
+	if file.AsOf.IsZero() {
+		file.AsOf = info.ModTime()
+	}
+
+	table := newRateTable("file", file.AsOf)
+	for currency, rate := range file.Rates {
+		if rate <= 0 {
+			return nil, fmt.Errorf("rates file %s: rate of %s must be positive", p.path, currency)
+		}
+		table.add(file.Base, currency, rate)
+	}
+
+	p.table, p.modTime = table, info.ModTime()
+	return table, nil
+}
+
+type postgresRateProvider struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresRateProvider serves the rates stored in "BK_FX_Rate".
+func NewPostgresRateProvider(pool *pgxpool.Pool) RateProvider {
+	return &postgresRateProvider{pool: pool}
+}
+
+func (p *postgresRateProvider) Rate(ctx context.Context, base, quote string) (Rate, error) {
+	rows, err := p.pool.Query(ctx, `SELECT base_currency, quote_currency, rate, source, as_of FROM "BK_FX_Rate"`)
+	if err != nil {
+		return Rate{}, err
+	}
+	defer rows.Close()
+
+	table := newRateTable("database", time.Time{})
+	stored := map[[2]string]Rate{}
+	for rows.Next() {
+		var r Rate
+		if err := rows.Scan(&r.Base, &r.Quote, &r.Rate, &r.Source, &r.AsOf); err != nil {
+			return Rate{}, err
+		}
+		table.add(r.Base, r.Quote, r.Rate)
+		stored[[2]string{r.Base, r.Quote}] = r
+		if table.asOf.IsZero() || r.AsOf.Before(table.asOf) {
+			table.asOf = r.AsOf
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Rate{}, err
+	}
+
+	rate, err := table.lookup(base, quote)
+	if err != nil {
+		return Rate{}, err
+	}
+	// A stored pair keeps its own source and time, derived rates are
+	// reported as old as the oldest stored rate.
+	for _, pair := range [][2]string{{base, quote}, {quote, base}} {
+		if r, ok := stored[pair]; ok {
+			rate.Source, rate.AsOf = r.Source, r.AsOf
+		}
+	}
+	return rate, nil
+}
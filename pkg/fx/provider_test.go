@@ -0,0 +1,123 @@
+package fx
+
+import (
+	"bank_system/utils"
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateTableLookup(t *testing.T) {
+	table := newRateTable("test", time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC))
+	table.add("USD", "EUR", 0.8)
+	table.add("USD", "TWD", 32)
+	table.add("GBP", "JPY", 200)
+
+	tests := []struct {
+		base, quote string
+		rate        float64
+		ok          bool
+	}{
+		{"USD", "EUR", 0.8, true},
+		{"EUR", "USD", 1.25, true},
+		{"USD", "USD", 1, true},
+		{"EUR", "TWD", 40, true},
+		{"TWD", "EUR", 0.025, true},
+		{"JPY", "GBP", 0.005, true},
+		{"USD", "JPY", 0, false},
+		{"EUR", "CHF", 0, false},
+	}
+	for _, tt := range tests {
+		rate, err := table.lookup(tt.base, tt.quote)
+		if !tt.ok {
+			if !utils.IsBankSystemError(err, utils.ErrRateUnavailable) {
+				t.Errorf("%s/%s: err %v, want ErrRateUnavailable", tt.base, tt.quote, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s/%s: %v", tt.base, tt.quote, err)
+			continue
+		}
+		if math.Abs(rate.Rate-tt.rate) > 1e-12 {
+			t.Errorf("%s/%s = %v, want %v", tt.base, tt.quote, rate.Rate, tt.rate)
+		}
+		if rate.Base != tt.base || rate.Quote != tt.quote || rate.Source != "test" || !rate.AsOf.Equal(table.asOf) {
+			t.Errorf("%s/%s: rate %+v", tt.base, tt.quote, rate)
+		}
+	}
+}
+
+func writeRates(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileRateProviderInvalid(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{"malformed JSON", `{"base": "USD", "rates": {`, "rates file"},
+		{"missing base", `{"rates": {"EUR": 0.9}}`, "base is missing"},
+		{"zero rate", `{"base": "USD", "rates": {"EUR": 0}}`, "rate of EUR must be positive"},
+		{"negative rate", `{"base": "USD", "rates": {"EUR": -0.9}}`, "rate of EUR must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rates.json")
+			writeRates(t, path, tt.content, time.Now())
+			_, err := NewFileRateProvider(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewFileRateProvider: err %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewFileRateProvider(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("NewFileRateProvider accepted a missing file")
+	}
+}
+
+func TestFileRateProviderReload(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "rates.json")
+	modTime := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	writeRates(t, path, `{"base": "USD", "rates": {"EUR": 0.8}}`, modTime)
+
+	provider, err := NewFileRateProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rate, err := provider.Rate(ctx, "EUR", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate.Rate != 1.25 || rate.Source != "file" || !rate.AsOf.Equal(modTime) {
+		t.Errorf("rate %+v, want 1.25 from the file as of its modification time", rate)
+	}
+
+	// A new version of the file is picked up, with its own as_of.
+	writeRates(t, path, `{"base": "USD", "as_of": "2026-05-02T00:00:00Z", "rates": {"EUR": 0.5}}`, modTime.Add(time.Hour))
+	rate, err = provider.Rate(ctx, "EUR", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate.Rate != 2 || !rate.AsOf.Equal(time.Date(2026, 5, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("rate after the change %+v, want 2 as of 2026-05-02", rate)
+	}
+
+	// A broken version fails the lookups instead of serving stale rates.
+	writeRates(t, path, `{"base": "USD", "rates": {"EUR": -1}}`, modTime.Add(2*time.Hour))
+	if _, err := provider.Rate(ctx, "EUR", "USD"); err == nil {
+		t.Error("Rate served a file with a negative rate")
+	}
+}
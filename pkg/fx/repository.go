@@ -0,0 +1,77 @@
+package fx
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const quoteColumns = `id, from_currency, to_currency, mid_rate, rate, spread_bps, source, created_at, expires_at, used_at, transaction_id`
+
+// Quote locks Rate, the mid rate less the spread, for converting FromCurrency
+// into ToCurrency until ExpiresAt. It can be used for a single transfer.
+type Quote struct {
+	ID            string             `json:"id"`
+	FromCurrency  string             `json:"from_currency"`
+	ToCurrency    string             `json:"to_currency"`
+	MidRate       float64            `json:"mid_rate"`
+	Rate          float64            `json:"rate"`
+	SpreadBps     int                `json:"spread_bps"`
+	Source        string             `json:"source"`
+	CreatedAt     time.Time          `json:"created_at"`
+	ExpiresAt     time.Time          `json:"expires_at"`
+	UsedAt        pgtype.Timestamptz `json:"used_at"`
+	TransactionID pgtype.Int8        `json:"transaction_id"`
+}
+
+// Usable reports whether the quote can still be used for a transfer at now.
+func (q Quote) Usable(now time.Time) bool {
+	return !q.UsedAt.Valid && q.ExpiresAt.After(now)
+}
+
+type QuoteRepository interface {
+	CreateQuote(ctx context.Context, quote Quote) (Quote, error)
+	GetQuote(ctx context.Context, id string) (Quote, error)
+}
+
+type quoteRepositoryImpl struct {
+	pool *pgxpool.Pool
+}
+
+func NewQuoteRepository(pool *pgxpool.Pool) QuoteRepository {
+	return &quoteRepositoryImpl{pool: pool}
+}
+
+func (r *quoteRepositoryImpl) CreateQuote(ctx context.Context, quote Quote) (Quote, error) {
+	return scanQuote(r.pool.QueryRow(ctx,
+		`INSERT INTO "BK_FX_Quote" (id, from_currency, to_currency, mid_rate, rate, spread_bps, source, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+quoteColumns,
+		quote.ID, quote.FromCurrency, quote.ToCurrency, quote.MidRate, quote.Rate, quote.SpreadBps, quote.Source, quote.ExpiresAt,
+	))
+}
+
+func (r *quoteRepositoryImpl) GetQuote(ctx context.Context, id string) (Quote, error) {
+	return scanQuote(r.pool.QueryRow(ctx, `SELECT `+quoteColumns+` FROM "BK_FX_Quote" WHERE id = $1`, id))
+}
+
+func scanQuote(row pgx.Row) (Quote, error) {
+	var quote Quote
+	err := row.Scan(
+		&quote.ID,
+		&quote.FromCurrency,
+		&quote.ToCurrency,
+		&quote.MidRate,
+		&quote.Rate,
+		&quote.SpreadBps,
+		&quote.Source,
+		&quote.CreatedAt,
+		&quote.ExpiresAt,
+		&quote.UsedAt,
+		&quote.TransactionID,
+	)
+	return quote, err
+}
@@ -0,0 +1,101 @@
+package fx
+
+import (
+	"bank_system/utils"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	DefaultQuoteTTL  = 30 * time.Second
+	DefaultSpreadBps = 50
+
+	// rateScale matches the NUMERIC(20, 10) rate columns.
+	rateScale = 1e10
+)
+
+type FXService struct {
+	provider  RateProvider
+	repo      QuoteRepository
+	spreadBps int
+	quoteTTL  time.Duration
+}
+
+// NewFXService quotes rates from provider less spreadBps basis points, locked
+// for quoteTTL. Zero values take DefaultSpreadBps and DefaultQuoteTTL; use a
+// negative spread for none.
+func NewFXService(provider RateProvider, repo QuoteRepository, spreadBps int, quoteTTL time.Duration) *FXService {
+	if spreadBps == 0 {
+		spreadBps = DefaultSpreadBps
+	}
+	if spreadBps < 0 {
+		spreadBps = 0
+	}
+	if quoteTTL <= 0 {
+		quoteTTL = DefaultQuoteTTL
+	}
+
+	return &FXService{
+		provider:  provider,
+		repo:      repo,
+		spreadBps: min(spreadBps, 10000),
+		quoteTTL:  quoteTTL,
+	}
+}
+
+// Quote locks a rate for converting from into to.
+func (s *FXService) Quote(ctx context.Context, from, to string) (Quote, error) {
+	verr := &utils.ValidationError{}
+	if _, ok := utils.LookupCurrency(from); !ok {
+		verr.Add("from_currency", "is not a supported currency")
+	}
+	if _, ok := utils.LookupCurrency(to); !ok {
+		verr.Add("to_currency", "is not a supported currency")
+	}
+	if from == to {
+		verr.Add("to_currency", "must differ from from_currency")
+	}
+	if err := verr.Err(); err != nil {
+		return Quote{}, err
+	}
+
+	rate, err := s.provider.Rate(ctx, from, to)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return s.repo.CreateQuote(ctx, Quote{
+		ID:           newQuoteID(),
+		FromCurrency: from,
+		ToCurrency:   to,
+		MidRate:      roundRate(rate.Rate),
+		Rate:         roundRate(rate.Rate * (1 - float64(s.spreadBps)/10000)),
+		SpreadBps:    s.spreadBps,
+		Source:       rate.Source,
+		ExpiresAt:    time.Now().Add(s.quoteTTL),
+	})
+}
+
+func (s *FXService) GetQuote(ctx context.Context, id string) (Quote, error) {
+	quote, err := s.repo.GetQuote(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Quote{}, utils.NewBankSystemError(utils.ErrQuoteNotFound, id)
+	}
+	return quote, err
+}
+
+func roundRate(rate float64) float64 {
+	return math.Round(rate*rateScale) / rateScale
+}
+
+func newQuoteID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
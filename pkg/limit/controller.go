@@ -0,0 +1,280 @@
+package limit
+
+import (
+	"bank_system/utils"
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LimitController struct {
+	service *LimitService
+	logger  *log.Logger
+}
+
+func NewLimitController(service *LimitService, logger *log.Logger) *LimitController {
+	return &LimitController{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// ProfileRequest creates a profile or replaces one.
+type ProfileRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	IsDefault   bool   `json:"is_default"`
+	Rules       []Rule `json:"rules"`
+}
+
+func (r ProfileRequest) profile() Profile {
+	profile := Profile{
+		Name:        r.Name,
+		Description: r.Description,
+		IsDefault:   r.IsDefault,
+		Rules:       r.Rules,
+	}
+	for i := range profile.Rules {
+		profile.Rules[i].ID = 0
+	}
+	return profile
+}
+
+func (c *LimitController) GetProfiles(ctx *gin.Context) {
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	profiles, err := c.service.GetProfiles(reqCtx)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, profiles)
+}
+
+func (c *LimitController) GetProfile(ctx *gin.Context) {
+	id, ok := profileIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	profile, err := c.service.GetProfile(reqCtx, id)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, profile)
+}
+
+func (c *LimitController) CreateProfile(ctx *gin.Context) {
+	var req ProfileRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	profile, err := c.service.CreateProfile(reqCtx, req.profile())
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, profile)
+}
+
+// UpdateProfile replaces the profile, rules included.
+func (c *LimitController) UpdateProfile(ctx *gin.Context) {
+	id, ok := profileIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	var req ProfileRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	profile, err := c.service.UpdateProfile(reqCtx, id, req.profile())
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, profile)
+}
+
+func (c *LimitController) DeleteProfile(ctx *gin.Context) {
+	id, ok := profileIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	if err := c.service.DeleteProfile(reqCtx, id); err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *LimitController) AssignAccount(ctx *gin.Context) {
+	c.assign(ctx, func(reqCtx context.Context, profileID int64) (Assignment, error) {
+		return c.service.AssignAccount(reqCtx, ctx.Param("id_number"), profileID)
+	})
+}
+
+func (c *LimitController) AssignUser(ctx *gin.Context) {
+	userID, ok := userIDParam(ctx)
+	if !ok {
+		return
+	}
+	c.assign(ctx, func(reqCtx context.Context, profileID int64) (Assignment, error) {
+		return c.service.AssignUser(reqCtx, userID, profileID)
+	})
+}
+
+func (c *LimitController) assign(ctx *gin.Context, assign func(context.Context, int64) (Assignment, error)) {
+	type AssignRequest struct {
+		ProfileID int64 `json:"profile_id" binding:"required"`
+	}
+
+	var req AssignRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	assignment, err := assign(reqCtx, req.ProfileID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, assignment)
+}
+
+func (c *LimitController) UnassignAccount(ctx *gin.Context) {
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	if err := c.service.UnassignAccount(reqCtx, ctx.Param("id_number")); err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *LimitController) UnassignUser(ctx *gin.Context) {
+	userID, ok := userIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	if err := c.service.UnassignUser(reqCtx, userID); err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// GetRemaining responds with the limits of the account and what is left of
+// them.
+func (c *LimitController) GetRemaining(ctx *gin.Context) {
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	remaining, err := c.service.GetRemaining(reqCtx, ctx.Param("id_number"))
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, remaining)
+}
+
+func profileIDParam(ctx *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Param("profile_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid profile id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func userIDParam(ctx *gin.Context) (int64, bool) {
+	userID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return 0, false
+	}
+	return userID, true
+}
+
+func errorStatus(err error) int {
+	switch {
+	case utils.IsValidationError(err):
+		return http.StatusBadRequest
+	case utils.IsBankSystemError(err, utils.ErrLimitProfileNotFound),
+		utils.IsBankSystemError(err, utils.ErrAccountNotFound),
+		utils.IsBankSystemError(err, utils.ErrUserNotFound):
+		return http.StatusNotFound
+	case utils.IsBankSystemError(err, utils.ErrLimitProfileExists):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RegisterRoutes serves the limits of an account, and the profiles and
+// their assignments behind the admin middleware.
+func (c *LimitController) RegisterRoutes(router *gin.Engine, admin gin.HandlerFunc) {
+	router.GET("/accounts/:id_number/limits", c.GetRemaining)
+
+	group := router.Group("/admin/limits", admin)
+	{
+		group.GET("/profiles", c.GetProfiles)
+		group.POST("/profiles", c.CreateProfile)
+		group.GET("/profiles/:profile_id", c.GetProfile)
+		group.PUT("/profiles/:profile_id", c.UpdateProfile)
+		group.DELETE("/profiles/:profile_id", c.DeleteProfile)
+		group.PUT("/accounts/:id_number", c.AssignAccount)
+		group.DELETE("/accounts/:id_number", c.UnassignAccount)
+		group.PUT("/users/:id", c.AssignUser)
+		group.DELETE("/users/:id", c.UnassignUser)
+	}
+}
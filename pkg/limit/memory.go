@@ -0,0 +1,318 @@
+package limit
+
+import (
+	"bank_system/pkg/memstore"
+	"bank_system/utils"
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// memoryLimitRepository is a LimitRepository backed by a memstore.Store.
+type memoryLimitRepository struct {
+	store *memstore.Store
+}
+
+func NewMemoryLimitRepository(store *memstore.Store) LimitRepository {
+	return &memoryLimitRepository{store: store}
+}
+
+func (r *memoryLimitRepository) CreateProfile(ctx context.Context, profile Profile) (Profile, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	if r.nameTaken(0, profile.Name) {
+		return Profile{}, utils.NewBankSystemError(utils.ErrLimitProfileExists, profile.Name)
+	}
+
+	now := time.Now()
+	record := &memstore.LimitProfileRecord{
+		ID:          r.store.NextID("BK_Limit_Profile"),
+		Name:        profile.Name,
+		Description: profile.Description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	r.store.LimitProfiles[record.ID] = record
+	r.store.Audit(ctx, "BK_Limit_Profile", record.ID, nil, *record)
+	r.writeProfile(ctx, record, profile)
+
+	return r.toProfile(record), nil
+}
+
+func (r *memoryLimitRepository) GetProfile(ctx context.Context, id int64) (Profile, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.LimitProfiles[id]
+	if !ok {
+		return Profile{}, pgx.ErrNoRows
+	}
+	return r.toProfile(record), nil
+}
+
+func (r *memoryLimitRepository) GetProfiles(ctx context.Context) ([]Profile, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	profiles := []Profile{}
+	for _, record := range r.store.LimitProfiles {
+		profiles = append(profiles, r.toProfile(record))
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, nil
+}
+
+func (r *memoryLimitRepository) UpdateProfile(ctx context.Context, profile Profile) (Profile, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.LimitProfiles[profile.ID]
+	if !ok {
+		return Profile{}, pgx.ErrNoRows
+	}
+	if r.nameTaken(profile.ID, profile.Name) {
+		return Profile{}, utils.NewBankSystemError(utils.ErrLimitProfileExists, profile.Name)
+	}
+
+	before := *record
+	record.Name = profile.Name
+	record.Description = profile.Description
+	record.UpdatedAt = time.Now()
+	r.store.Audit(ctx, "BK_Limit_Profile", record.ID, before, *record)
+	for id, rule := range r.store.LimitRules {
+		if rule.ProfileID == record.ID {
+			delete(r.store.LimitRules, id)
+			r.store.Audit(ctx, "BK_Limit_Rule", id, *rule, nil)
+		}
+	}
+	r.writeProfile(ctx, record, profile)
+
+	return r.toProfile(record), nil
+}
+
+func (r *memoryLimitRepository) DeleteProfile(ctx context.Context, id int64) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.LimitProfiles[id]
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	// The rules and assignments go with the profile, like ON DELETE CASCADE.
+	for ruleID, rule := range r.store.LimitRules {
+		if rule.ProfileID == id {
+			delete(r.store.LimitRules, ruleID)
+			r.store.Audit(ctx, "BK_Limit_Rule", ruleID, *rule, nil)
+		}
+	}
+	for assignmentID, assignment := range r.store.LimitAssignments {
+		if assignment.ProfileID == id {
+			delete(r.store.LimitAssignments, assignmentID)
+			r.store.Audit(ctx, "BK_Limit_Assignment", assignmentID, *assignment, nil)
+		}
+	}
+	delete(r.store.LimitProfiles, id)
+	r.store.Audit(ctx, "BK_Limit_Profile", id, *record, nil)
+	return nil
+}
+
+func (r *memoryLimitRepository) Assign(ctx context.Context, assignment Assignment) (Assignment, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	if _, ok := r.store.LimitProfiles[assignment.ProfileID]; !ok {
+		return Assignment{}, utils.NewBankSystemError(utils.ErrLimitProfileNotFound, strconv.FormatInt(assignment.ProfileID, 10))
+	}
+	if _, ok := r.store.Users[assignment.UserID]; assignment.AccountID == 0 && !ok {
+		return Assignment{}, utils.NewBankSystemError(utils.ErrUserNotFound, strconv.FormatInt(assignment.UserID, 10))
+	}
+	if _, ok := r.store.Accounts[assignment.AccountID]; assignment.AccountID != 0 && !ok {
+		return Assignment{}, utils.NewBankSystemError(utils.ErrAccountNotFound, strconv.FormatInt(assignment.AccountID, 10))
+	}
+
+	now := time.Now()
+	if record := r.assignment(assignment); record != nil {
+		before := *record
+		record.ProfileID = assignment.ProfileID
+		record.UpdatedAt = now
+		r.store.Audit(ctx, "BK_Limit_Assignment", record.ID, before, *record)
+		return r.toAssignment(record), nil
+	}
+
+	record := &memstore.LimitAssignmentRecord{
+		ID:        r.store.NextID("BK_Limit_Assignment"),
+		ProfileID: assignment.ProfileID,
+		AccountID: pgtype.Int8{Int64: assignment.AccountID, Valid: assignment.AccountID != 0},
+		UserID:    pgtype.Int8{Int64: assignment.UserID, Valid: assignment.AccountID == 0},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	r.store.LimitAssignments[record.ID] = record
+	r.store.Audit(ctx, "BK_Limit_Assignment", record.ID, nil, *record)
+	return r.toAssignment(record), nil
+}
+
+func (r *memoryLimitRepository) Unassign(ctx context.Context, assignment Assignment) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	if record := r.assignment(assignment); record != nil {
+		delete(r.store.LimitAssignments, record.ID)
+		r.store.Audit(ctx, "BK_Limit_Assignment", record.ID, *record, nil)
+	}
+	return nil
+}
+
+func (r *memoryLimitRepository) GetAssignment(ctx context.Context, assignment Assignment) (Assignment, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record := r.assignment(assignment)
+	if record == nil {
+		return Assignment{}, pgx.ErrNoRows
+	}
+	return r.toAssignment(record), nil
+}
+
+func (r *memoryLimitRepository) GetRemaining(ctx context.Context, accountID int64, at time.Time) ([]Remaining, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	remaining := []Remaining{}
+	for _, applied := range r.store.AccountLimitRules(accountID) {
+		rule := applied.Rule
+		remaining = append(remaining, Remaining{
+			RuleID:         rule.ID,
+			ProfileID:      rule.ProfileID,
+			ProfileName:    applied.ProfileName,
+			Scope:          applied.Scope,
+			TxType:         rule.TxType.String,
+			CurrencyCode:   applied.CurrencyCode,
+			PerTransaction: fromFloat8(rule.PerTransaction),
+			Daily:          fromFloat8(rule.Daily),
+			DailyUsed:      r.store.LimitUsage(accountID, applied.Scope, rule.TxType, memstore.LimitPeriodStart("day", at)),
+			Monthly:        fromFloat8(rule.Monthly),
+			MonthlyUsed:    r.store.LimitUsage(accountID, applied.Scope, rule.TxType, memstore.LimitPeriodStart("month", at)),
+		}.withAvailable())
+	}
+	return remaining, nil
+}
+
+// writeProfile mirrors writeProfile of the Postgres repository. The caller
+// must hold Mu.
+func (r *memoryLimitRepository) writeProfile(ctx context.Context, record *memstore.LimitProfileRecord, profile Profile) {
+	for _, other := range r.store.LimitProfiles {
+		isDefault := other.IsDefault && !profile.IsDefault
+		if other.ID == record.ID {
+			isDefault = profile.IsDefault
+		}
+		if other.IsDefault != isDefault {
+			before := *other
+			other.IsDefault = isDefault
+			other.UpdatedAt = time.Now()
+			r.store.Audit(ctx, "BK_Limit_Profile", other.ID, before, *other)
+		}
+	}
+
+	for _, rule := range profile.Rules {
+		ruleRecord := &memstore.LimitRuleRecord{
+			ID:             r.store.NextID("BK_Limit_Rule"),
+			ProfileID:      record.ID,
+			TxType:         pgtype.Text{String: rule.TxType, Valid: rule.TxType != ""},
+			CurrencyCode:   pgtype.Text{String: rule.CurrencyCode, Valid: rule.CurrencyCode != ""},
+			PerTransaction: toFloat8(rule.PerTransaction),
+			Daily:          toFloat8(rule.Daily),
+			Monthly:        toFloat8(rule.Monthly),
+		}
+		r.store.LimitRules[ruleRecord.ID] = ruleRecord
+		r.store.Audit(ctx, "BK_Limit_Rule", ruleRecord.ID, nil, *ruleRecord)
+	}
+}
+
+// nameTaken reports whether a profile other than id is named name. The
+// caller must hold Mu.
+func (r *memoryLimitRepository) nameTaken(id int64, name string) bool {
+	for _, record := range r.store.LimitProfiles {
+		if record.ID != id && record.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// assignment returns the assignment of the account or the user of
+// assignment, nil when there is none. The caller must hold Mu.
+func (r *memoryLimitRepository) assignment(assignment Assignment) *memstore.LimitAssignmentRecord {
+	for _, record := range r.store.LimitAssignments {
+		if assignment.AccountID != 0 && record.AccountID.Int64 == assignment.AccountID ||
+			assignment.AccountID == 0 && record.UserID.Valid && record.UserID.Int64 == assignment.UserID {
+			return record
+		}
+	}
+	return nil
+}
+
+// toProfile joins the rules of record. The caller must hold Mu.
+func (r *memoryLimitRepository) toProfile(record *memstore.LimitProfileRecord) Profile {
+	profile := Profile{
+		ID:          record.ID,
+		Name:        record.Name,
+		Description: record.Description,
+		IsDefault:   record.IsDefault,
+		Rules:       []Rule{},
+		CreatedAt:   record.CreatedAt,
+		UpdatedAt:   record.UpdatedAt,
+	}
+	for _, rule := range r.store.LimitRules {
+		if rule.ProfileID == record.ID {
+			profile.Rules = append(profile.Rules, Rule{
+				ID:             rule.ID,
+				TxType:         rule.TxType.String,
+				CurrencyCode:   rule.CurrencyCode.String,
+				PerTransaction: fromFloat8(rule.PerTransaction),
+				Daily:          fromFloat8(rule.Daily),
+				Monthly:        fromFloat8(rule.Monthly),
+			})
+		}
+	}
+	sort.Slice(profile.Rules, func(i, j int) bool { return profile.Rules[i].ID < profile.Rules[j].ID })
+	return profile
+}
+
+// toAssignment joins the profile and account of record. The caller must
+// hold Mu.
+func (r *memoryLimitRepository) toAssignment(record *memstore.LimitAssignmentRecord) Assignment {
+	assignment := Assignment{
+		ProfileID: record.ProfileID,
+		AccountID: record.AccountID.Int64,
+		UserID:    record.UserID.Int64,
+		CreatedAt: record.CreatedAt,
+		UpdatedAt: record.UpdatedAt,
+	}
+	if profile, ok := r.store.LimitProfiles[record.ProfileID]; ok {
+		assignment.ProfileName = profile.Name
+	}
+	if account, ok := r.store.Accounts[record.AccountID.Int64]; ok {
+		assignment.AccountNumber = account.IDNumber
+	}
+	return assignment
+}
+
+func toFloat8(limit *float64) pgtype.Float8 {
+	if limit == nil {
+		return pgtype.Float8{}
+	}
+	return pgtype.Float8{Float64: *limit, Valid: true}
+}
+
+func fromFloat8(limit pgtype.Float8) *float64 {
+	if !limit.Valid {
+		return nil
+	}
+	return &limit.Float64
+}
@@ -0,0 +1,421 @@
+// Package limit caps how much accounts and users may move. Limit profiles hold
+// per-transaction, daily and monthly limits per transaction type and
+// currency; a profile assigned to an account limits that account, and one
+// assigned to a user, or else the default profile, limits all their accounts
+// in a currency together. The database enforces the limits in the
+// transaction of every posting.
+package limit
+
+import (
+	"bank_system/utils"
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const profileColumns = `id, name, description, is_default, created_at, updated_at`
+
+const ruleColumns = `id, profile_id, COALESCE(tx_type::TEXT, ''), COALESCE(currency_code, ''), per_transaction, daily, monthly`
+
+const assignmentColumns = `la.profile_id, p.name, COALESCE(la.account_id, 0), COALESCE(a.id_number, ''),
+	COALESCE(la.user_id, 0), la.created_at, la.updated_at`
+
+const assignmentTables = `"BK_Limit_Assignment" la
+	JOIN "BK_Limit_Profile" p ON p.id = la.profile_id
+	LEFT JOIN "BK_Account" a ON a.id = la.account_id`
+
+// Rule limits the postings of TxType, or withdrawals and transfers together
+// when it is empty, in CurrencyCode, or in any currency when it is empty. A
+// nil limit is not checked.
+type Rule struct {
+	ID             int64    `json:"id"`
+	TxType         string   `json:"tx_type,omitempty"`
+	CurrencyCode   string   `json:"currency_code,omitempty"`
+	PerTransaction *float64 `json:"per_transaction"`
+	Daily          *float64 `json:"daily"`
+	Monthly        *float64 `json:"monthly"`
+}
+
+type Profile struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	IsDefault   bool      `json:"is_default"`
+	Rules       []Rule    `json:"rules"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Assignment assigns a profile to the account AccountID, or to the user
+// UserID.
+type Assignment struct {
+	ProfileID     int64     `json:"profile_id"`
+	ProfileName   string    `json:"profile_name"`
+	AccountID     int64     `json:"account_id,omitempty"`
+	AccountNumber string    `json:"account_number,omitempty"`
+	UserID        int64     `json:"user_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Remaining is a rule that applies to an account and what is left of it.
+// Available is the most a single posting may move under the rule now.
+type Remaining struct {
+	RuleID           int64    `json:"rule_id"`
+	ProfileID        int64    `json:"profile_id"`
+	ProfileName      string   `json:"profile_name"`
+	Scope            string   `json:"scope"`
+	TxType           string   `json:"tx_type,omitempty"`
+	CurrencyCode     string   `json:"currency_code"`
+	PerTransaction   *float64 `json:"per_transaction"`
+	Daily            *float64 `json:"daily"`
+	DailyUsed        float64  `json:"daily_used"`
+	DailyRemaining   *float64 `json:"daily_remaining"`
+	Monthly          *float64 `json:"monthly"`
+	MonthlyUsed      float64  `json:"monthly_used"`
+	MonthlyRemaining *float64 `json:"monthly_remaining"`
+	Available        *float64 `json:"available"`
+}
+
+type LimitRepository interface {
+	// CreateProfile stores the profile and its rules. A default profile
+	// takes over from the previous one.
+	CreateProfile(ctx context.Context, profile Profile) (Profile, error)
+	GetProfile(ctx context.Context, id int64) (Profile, error)
+	GetProfiles(ctx context.Context) ([]Profile, error)
+	// UpdateProfile replaces the profile and its rules.
+	UpdateProfile(ctx context.Context, profile Profile) (Profile, error)
+	// DeleteProfile deletes the profile, its rules and its assignments.
+	DeleteProfile(ctx context.Context, id int64) error
+	// Assign assigns the profile to the account or the user, in place of
+	// the one they had.
+	Assign(ctx context.Context, assignment Assignment) (Assignment, error)
+	// Unassign removes the profile of the account or the user, if any.
+	Unassign(ctx context.Context, assignment Assignment) error
+	GetAssignment(ctx context.Context, assignment Assignment) (Assignment, error)
+	// GetRemaining returns the rules that apply to the account and what is
+	// left of them at that time.
+	GetRemaining(ctx context.Context, accountID int64, at time.Time) ([]Remaining, error)
+}
+
+type limitRepositoryImpl struct {
+	pool *pgxpool.Pool
+}
+
+func NewLimitRepository(pool *pgxpool.Pool) LimitRepository {
+	return &limitRepositoryImpl{pool: pool}
+}
+
+func (r *limitRepositoryImpl) CreateProfile(ctx context.Context, profile Profile) (Profile, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return Profile{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO "BK_Limit_Profile" (name, description) VALUES ($1, $2) RETURNING id`,
+		profile.Name, profile.Description,
+	).Scan(&profile.ID)
+	if err != nil {
+		return Profile{}, existsError(err, profile.Name)
+	}
+	if err := writeProfile(ctx, tx, profile); err != nil {
+		return Profile{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Profile{}, err
+	}
+	return r.GetProfile(ctx, profile.ID)
+}
+
+func (r *limitRepositoryImpl) GetProfile(ctx context.Context, id int64) (Profile, error) {
+	profile, err := scanProfile(r.pool.QueryRow(ctx,
+		`SELECT `+profileColumns+` FROM "BK_Limit_Profile" WHERE id = $1`, id,
+	))
+	if err != nil {
+		return Profile{}, err
+	}
+
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+ruleColumns+` FROM "BK_Limit_Rule" WHERE profile_id = $1 ORDER BY id`, id,
+	)
+	if err != nil {
+		return Profile{}, err
+	}
+	rules, err := pgx.CollectRows(rows, scanRule)
+	if err != nil {
+		return Profile{}, err
+	}
+	return withRules([]Profile{profile}, rules)[0], nil
+}
+
+func (r *limitRepositoryImpl) GetProfiles(ctx context.Context) ([]Profile, error) {
+	rows, err := r.pool.Query(ctx, `SELECT `+profileColumns+` FROM "BK_Limit_Profile" ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Profile, error) {
+		return scanProfile(row)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = r.pool.Query(ctx, `SELECT `+ruleColumns+` FROM "BK_Limit_Rule" ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := pgx.CollectRows(rows, scanRule)
+	if err != nil {
+		return nil, err
+	}
+	return withRules(profiles, rules), nil
+}
+
+func (r *limitRepositoryImpl) UpdateProfile(ctx context.Context, profile Profile) (Profile, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return Profile{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE "BK_Limit_Profile" SET name = $2, description = $3 WHERE id = $1`,
+		profile.ID, profile.Name, profile.Description,
+	)
+	if err != nil {
+		return Profile{}, existsError(err, profile.Name)
+	}
+	if tag.RowsAffected() == 0 {
+		return Profile{}, pgx.ErrNoRows
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM "BK_Limit_Rule" WHERE profile_id = $1`, profile.ID); err != nil {
+		return Profile{}, err
+	}
+	if err := writeProfile(ctx, tx, profile); err != nil {
+		return Profile{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Profile{}, err
+	}
+	return r.GetProfile(ctx, profile.ID)
+}
+
+func (r *limitRepositoryImpl) DeleteProfile(ctx context.Context, id int64) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM "BK_Limit_Profile" WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (r *limitRepositoryImpl) Assign(ctx context.Context, assignment Assignment) (Assignment, error) {
+	target, id := assignmentTarget(assignment)
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO "BK_Limit_Assignment" (profile_id, `+target+`) VALUES ($1, $2)
+		ON CONFLICT (`+target+`) DO UPDATE SET profile_id = EXCLUDED.profile_id`,
+		assignment.ProfileID, id,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		switch {
+		case strings.Contains(pgErr.ConstraintName, "profile_id"):
+			return Assignment{}, utils.NewBankSystemError(utils.ErrLimitProfileNotFound, strconv.FormatInt(assignment.ProfileID, 10))
+		case strings.Contains(pgErr.ConstraintName, "user_id"):
+			return Assignment{}, utils.NewBankSystemError(utils.ErrUserNotFound, strconv.FormatInt(id, 10))
+		default:
+			return Assignment{}, utils.NewBankSystemError(utils.ErrAccountNotFound, strconv.FormatInt(id, 10))
+		}
+	}
+	if err != nil {
+		return Assignment{}, err
+	}
+	return r.GetAssignment(ctx, assignment)
+}
+
+func (r *limitRepositoryImpl) Unassign(ctx context.Context, assignment Assignment) error {
+	target, id := assignmentTarget(assignment)
+	_, err := r.pool.Exec(ctx, `DELETE FROM "BK_Limit_Assignment" WHERE `+target+` = $1`, id)
+	return err
+}
+
+func (r *limitRepositoryImpl) GetAssignment(ctx context.Context, assignment Assignment) (Assignment, error) {
+	target, id := assignmentTarget(assignment)
+	return scanAssignment(r.pool.QueryRow(ctx,
+		`SELECT `+assignmentColumns+` FROM `+assignmentTables+` WHERE la.`+target+` = $1`, id,
+	))
+}
+
+func (r *limitRepositoryImpl) GetRemaining(ctx context.Context, accountID int64, at time.Time) ([]Remaining, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT r.rule_id, r.profile_id, r.profile_name, r.scope::TEXT, COALESCE(r.tx_type::TEXT, ''),
+			r.currency_code, r.per_transaction, r.daily, r.monthly,
+			limit_usage($1, r.scope, r.tx_type, limit_period_start('day', $2)),
+			limit_usage($1, r.scope, r.tx_type, limit_period_start('month', $2))
+		FROM account_limit_rules($1) r`,
+		accountID, at,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Remaining, error) {
+		var remaining Remaining
+		err := row.Scan(
+			&remaining.RuleID,
+			&remaining.ProfileID,
+			&remaining.ProfileName,
+			&remaining.Scope,
+			&remaining.TxType,
+			&remaining.CurrencyCode,
+			&remaining.PerTransaction,
+			&remaining.Daily,
+			&remaining.Monthly,
+			&remaining.DailyUsed,
+			&remaining.MonthlyUsed,
+		)
+		return remaining.withAvailable(), err
+	})
+}
+
+// writeProfile makes the profile the default when it is one and inserts its
+// rules.
+func writeProfile(ctx context.Context, tx pgx.Tx, profile Profile) error {
+	if profile.IsDefault {
+		_, err := tx.Exec(ctx,
+			`UPDATE "BK_Limit_Profile" SET is_default = FALSE WHERE is_default AND id <> $1`, profile.ID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(ctx,
+		`UPDATE "BK_Limit_Profile" SET is_default = $2 WHERE id = $1`, profile.ID, profile.IsDefault,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range profile.Rules {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO "BK_Limit_Rule" (profile_id, tx_type, currency_code, per_transaction, daily, monthly)
+			VALUES ($1, NULLIF($2, '')::TX_TYPE, NULLIF($3, ''), $4, $5, $6)`,
+			profile.ID, rule.TxType, rule.CurrencyCode, rule.PerTransaction, rule.Daily, rule.Monthly,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func assignmentTarget(assignment Assignment) (string, int64) {
+	if assignment.AccountID != 0 {
+		return "account_id", assignment.AccountID
+	}
+	return "user_id", assignment.UserID
+}
+
+// withAvailable fills in what is left of the daily and monthly limits and
+// the most a posting may move.
+func (r Remaining) withAvailable() Remaining {
+	r.DailyRemaining = left(r.Daily, r.DailyUsed)
+	r.MonthlyRemaining = left(r.Monthly, r.MonthlyUsed)
+	for _, limit := range []*float64{r.PerTransaction, r.DailyRemaining, r.MonthlyRemaining} {
+		if limit != nil && (r.Available == nil || *limit < *r.Available) {
+			available := *limit
+			r.Available = &available
+		}
+	}
+	return r
+}
+
+func left(limit *float64, used float64) *float64 {
+	if limit == nil {
+		return nil
+	}
+	remaining := max(math.Round((*limit-used)*100)/100, 0)
+	return &remaining
+}
+
+// withRules gives each profile its rules.
+func withRules(profiles []Profile, rules []ruleRow) []Profile {
+	byProfile := map[int64][]Rule{}
+	for _, rule := range rules {
+		byProfile[rule.profileID] = append(byProfile[rule.profileID], rule.Rule)
+	}
+	for i := range profiles {
+		profiles[i].Rules = byProfile[profiles[i].ID]
+		if profiles[i].Rules == nil {
+			profiles[i].Rules = []Rule{}
+		}
+	}
+	return profiles
+}
+
+func existsError(err error, name string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return utils.NewBankSystemError(utils.ErrLimitProfileExists, name)
+	}
+	return err
+}
+
+func scanProfile(row pgx.Row) (Profile, error) {
+	var profile Profile
+	err := row.Scan(
+		&profile.ID,
+		&profile.Name,
+		&profile.Description,
+		&profile.IsDefault,
+		&profile.CreatedAt,
+		&profile.UpdatedAt,
+	)
+	return profile, err
+}
+
+// ruleRow is a rule with the profile it belongs to.
+type ruleRow struct {
+	Rule
+	profileID int64
+}
+
+func scanRule(row pgx.CollectableRow) (ruleRow, error) {
+	var rule ruleRow
+	err := row.Scan(
+		&rule.ID,
+		&rule.profileID,
+		&rule.TxType,
+		&rule.CurrencyCode,
+		&rule.PerTransaction,
+		&rule.Daily,
+		&rule.Monthly,
+	)
+	return rule, err
+}
+
+func scanAssignment(row pgx.Row) (Assignment, error) {
+	var assignment Assignment
+	err := row.Scan(
+		&assignment.ProfileID,
+		&assignment.ProfileName,
+		&assignment.AccountID,
+		&assignment.AccountNumber,
+		&assignment.UserID,
+		&assignment.CreatedAt,
+		&assignment.UpdatedAt,
+	)
+	return assignment, err
+}
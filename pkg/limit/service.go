@@ -0,0 +1,201 @@
+package limit
+
+import (
+	"bank_system/pkg/transaction"
+	"bank_system/postgres/sqlc"
+	"bank_system/utils"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	NAME_MAX_LENGTH = 64 // "BK_Limit_Profile".name VARCHAR(64)
+
+	// MaxLimit is below the largest NUMERIC(22, 4).
+	MaxLimit = 1e17
+)
+
+// TxTypes are the transaction types rules may limit.
+var TxTypes = []string{transaction.TxType_WITHDRAW, transaction.TxType_DEPOSIT, transaction.TxType_TRANSFER}
+
+// Accounts is what limits need of account.AccountService.
+type Accounts interface {
+	GetAccountByIDNumber(ctx context.Context, idNumber string) (*sqlc.GetAccountByIDNumberRow, error)
+}
+
+// Users is what limits need of user.UserService.
+type Users interface {
+	GetUserByID(ctx context.Context, id int64) (*sqlc.GetUserByIDRow, error)
+}
+
+type LimitService struct {
+	repo     LimitRepository
+	accounts Accounts
+	users    Users
+}
+
+func NewLimitService(repo LimitRepository, accounts Accounts, users Users) *LimitService {
+	return &LimitService{
+		repo:     repo,
+		accounts: accounts,
+		users:    users,
+	}
+}
+
+func (s *LimitService) GetProfiles(ctx context.Context) ([]Profile, error) {
+	return s.repo.GetProfiles(ctx)
+}
+
+func (s *LimitService) GetProfile(ctx context.Context, id int64) (Profile, error) {
+	profile, err := s.repo.GetProfile(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Profile{}, profileNotFound(id)
+	}
+	return profile, err
+}
+
+func (s *LimitService) CreateProfile(ctx context.Context, profile Profile) (Profile, error) {
+	profile.Name = strings.TrimSpace(profile.Name)
+	if err := validate(profile); err != nil {
+		return Profile{}, err
+	}
+	return s.repo.CreateProfile(ctx, profile)
+}
+
+// UpdateProfile replaces the name, description, default flag and rules of
+// the profile.
+func (s *LimitService) UpdateProfile(ctx context.Context, id int64, profile Profile) (Profile, error) {
+	profile.ID = id
+	profile.Name = strings.TrimSpace(profile.Name)
+	if err := validate(profile); err != nil {
+		return Profile{}, err
+	}
+
+	profile, err := s.repo.UpdateProfile(ctx, profile)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Profile{}, profileNotFound(id)
+	}
+	return profile, err
+}
+
+// DeleteProfile deletes the profile and lifts it from the accounts and users
+// it was assigned to.
+func (s *LimitService) DeleteProfile(ctx context.Context, id int64) error {
+	err := s.repo.DeleteProfile(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return profileNotFound(id)
+	}
+	return err
+}
+
+// AssignAccount limits the account by the profile, on top of the profile of
+// its owner.
+func (s *LimitService) AssignAccount(ctx context.Context, idNumber string, profileID int64) (Assignment, error) {
+	account, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return Assignment{}, err
+	}
+	return s.repo.Assign(ctx, Assignment{ProfileID: profileID, AccountID: account.ID})
+}
+
+func (s *LimitService) UnassignAccount(ctx context.Context, idNumber string) error {
+	account, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return err
+	}
+	return s.repo.Unassign(ctx, Assignment{AccountID: account.ID})
+}
+
+// AssignUser limits all accounts of the user by the profile in place of the
+// default profile.
+func (s *LimitService) AssignUser(ctx context.Context, userID int64, profileID int64) (Assignment, error) {
+	if err := s.checkUser(ctx, userID); err != nil {
+		return Assignment{}, err
+	}
+	return s.repo.Assign(ctx, Assignment{ProfileID: profileID, UserID: userID})
+}
+
+func (s *LimitService) UnassignUser(ctx context.Context, userID int64) error {
+	if err := s.checkUser(ctx, userID); err != nil {
+		return err
+	}
+	return s.repo.Unassign(ctx, Assignment{UserID: userID})
+}
+
+// GetRemaining returns the rules that apply to the account and what is left
+// of them today and this month.
+func (s *LimitService) GetRemaining(ctx context.Context, idNumber string) ([]Remaining, error) {
+	account, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetRemaining(ctx, account.ID, time.Now())
+}
+
+func (s *LimitService) getAccount(ctx context.Context, idNumber string) (*sqlc.GetAccountByIDNumberRow, error) {
+	account, err := s.accounts.GetAccountByIDNumber(ctx, idNumber)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, utils.NewBankSystemError(utils.ErrAccountNotFound, idNumber)
+	}
+	return account, err
+}
+
+func (s *LimitService) checkUser(ctx context.Context, userID int64) error {
+	_, err := s.users.GetUserByID(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return utils.NewBankSystemError(utils.ErrUserNotFound, strconv.FormatInt(userID, 10))
+	}
+	return err
+}
+
+func validate(profile Profile) error {
+	verr := &utils.ValidationError{}
+	if profile.Name == "" || len(profile.Name) > NAME_MAX_LENGTH {
+		verr.Add("name", fmt.Sprintf("must be between 1 and %d characters", NAME_MAX_LENGTH))
+	}
+
+	seen := map[[2]string]int{}
+	for i, rule := range profile.Rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		if rule.TxType != "" && !slices.Contains(TxTypes, rule.TxType) {
+			verr.Add(field+".tx_type", "must be one of "+strings.Join(TxTypes, ", ")+" or empty")
+		}
+		if rule.CurrencyCode != "" {
+			utils.ValidateCurrency(verr, field+".currency_code", rule.CurrencyCode)
+		}
+		if rule.PerTransaction == nil && rule.Daily == nil && rule.Monthly == nil {
+			verr.Add(field, "must set per_transaction, daily or monthly")
+		}
+		for _, limit := range []struct {
+			name  string
+			value *float64
+		}{
+			{"per_transaction", rule.PerTransaction},
+			{"daily", rule.Daily},
+			{"monthly", rule.Monthly},
+		} {
+			if limit.value != nil && (*limit.value <= 0 || *limit.value > MaxLimit) {
+				verr.Add(field+"."+limit.name, fmt.Sprintf("must be above 0 and at most %.0f", MaxLimit))
+			}
+		}
+
+		key := [2]string{rule.TxType, rule.CurrencyCode}
+		if first, ok := seen[key]; ok {
+			verr.Add(field, fmt.Sprintf("limits the same transaction type and currency as rules[%d]", first))
+		} else {
+			seen[key] = i
+		}
+	}
+	return verr.Err()
+}
+
+func profileNotFound(id int64) error {
+	return utils.NewBankSystemError(utils.ErrLimitProfileNotFound, strconv.FormatInt(id, 10))
+}
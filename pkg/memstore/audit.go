@@ -0,0 +1,175 @@
+package memstore
+
+import (
+	"bank_system/utils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// AuditRecord is a row of "BK_Audit_Log".
+type AuditRecord struct {
+	ID          int64
+	Actor       string
+	Action      string
+	Operation   string
+	TargetTable string
+	TargetID    string
+	Before      json.RawMessage
+	After       json.RawMessage
+	RequestID   string
+	ClientIP    string
+	CreatedAt   time.Time
+	Seq         pgtype.Int8
+	PrevHash    []byte
+	Hash        []byte
+}
+
+type auditedTable struct {
+	ignored  []string
+	redacted []string
+}
+
+// auditedTables mirrors the audit triggers of the migration that creates
+// "BK_Audit_Log".
+var auditedTables = map[string]auditedTable{
+	"BK_User":             {ignored: []string{"updated_at"}, redacted: []string{"password"}},
+	"BK_User_TOTP":        {ignored: []string{"updated_at"}, redacted: []string{"secret", "recovery_codes"}},
+	"BK_Account":          {ignored: []string{"balance", "held_balance", "updated_at"}},
+	"BK_Transaction":      {},
+	"BK_Account_Hold":     {ignored: []string{"updated_at"}},
+	"BK_Currency":         {ignored: []string{"updated_at"}},
+	"BK_Standing_Order":   {ignored: []string{"updated_at", "claimed_until"}},
+	"BK_Payee":            {ignored: []string{"updated_at"}},
+	"BK_Bulk_Payment":     {ignored: []string{"updated_at", "claimed_until"}},
+	"BK_Webhook":          {ignored: []string{"updated_at"}, redacted: []string{"secret"}},
+	"BK_Risk_Decision":    {ignored: []string{"updated_at"}},
+	"BK_Limit_Profile":    {ignored: []string{"updated_at"}},
+	"BK_Limit_Rule":       {},
+	"BK_Limit_Assignment": {ignored: []string{"updated_at"}},
+	"BK_AML_Report":       {},
+	"BK_AML_Case":         {ignored: []string{"updated_at"}},
+	"BK_AML_Case_Note":    {},
+	"BK_Screening_Hit":    {ignored: []string{"updated_at"}},
+}
+
+// Audit records the change of the row key of table from before to after,
+// either nil for inserts and deletes, like the audit triggers do. Rows are
+// compared by their fields, named in snake case. The caller must hold Mu.
+func (s *Store) Audit(ctx context.Context, table string, key any, before, after any) {
+	config, ok := auditedTables[table]
+	if !ok {
+		panic(fmt.Sprintf("memstore: %s is not audited", table))
+	}
+
+	oldRow, newRow := auditRow(before), auditRow(after)
+	operation := "UPDATE"
+	switch {
+	case oldRow == nil:
+		operation = "INSERT"
+	case newRow == nil:
+		operation = "DELETE"
+	default:
+		for column := range newRow {
+			if contains(config.ignored, column) || reflect.DeepEqual(oldRow[column], newRow[column]) {
+				delete(oldRow, column)
+				delete(newRow, column)
+			}
+		}
+		if len(newRow) == 0 {
+			return
+		}
+	}
+	for _, column := range config.redacted {
+		for _, row := range []map[string]any{oldRow, newRow} {
+			if _, ok := row[column]; ok {
+				row[column] = "[redacted]"
+			}
+		}
+	}
+
+	metadata := utils.AuditMetadataFrom(ctx)
+	s.AuditLog = append(s.AuditLog, &AuditRecord{
+		ID:          s.NextID("BK_Audit_Log"),
+		Actor:       metadata.Actor,
+		Action:      metadata.Action,
+		Operation:   operation,
+		TargetTable: table,
+		TargetID:    fmt.Sprint(key),
+		Before:      marshalRow(oldRow),
+		After:       marshalRow(newRow),
+		RequestID:   metadata.RequestID,
+		ClientIP:    metadata.ClientIP,
+		CreatedAt:   time.Now().Truncate(time.Microsecond),
+	})
+}
+
+// auditRow turns a record into its columns, nil for a nil record.
+func auditRow(record any) map[string]any {
+	if record == nil {
+		return nil
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		panic(err)
+	}
+	var fields map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		panic(err)
+	}
+
+	row := make(map[string]any, len(fields))
+	for name, value := range fields {
+		row[snakeCase(name)] = value
+	}
+	return row
+}
+
+func marshalRow(row map[string]any) json.RawMessage {
+	if row == nil {
+		return nil
+	}
+	data, err := json.Marshal(row)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// snakeCase turns a Go field name into a column name: "IDNumber" is
+// "id_number" and "TransactionIDs" "transaction_ids". Names already in snake
+// case are kept.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			plural := i+2 == len(runes) && runes[i+1] == 's'
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]) && !plural) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
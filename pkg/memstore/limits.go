@@ -0,0 +1,211 @@
+package memstore
+
+import (
+	"bank_system/utils"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// LimitProfileRecord is a row of "BK_Limit_Profile".
+type LimitProfileRecord struct {
+	ID          int64
+	Name        string
+	Description string
+	IsDefault   bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// LimitRuleRecord is a row of "BK_Limit_Rule".
+type LimitRuleRecord struct {
+	ID             int64
+	ProfileID      int64
+	TxType         pgtype.Text
+	CurrencyCode   pgtype.Text
+	PerTransaction pgtype.Float8
+	Daily          pgtype.Float8
+	Monthly        pgtype.Float8
+}
+
+// LimitAssignmentRecord is a row of "BK_Limit_Assignment".
+type LimitAssignmentRecord struct {
+	ID        int64
+	ProfileID int64
+	AccountID pgtype.Int8
+	UserID    pgtype.Int8
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// AccountLimitRule is a row of account_limit_rules().
+type AccountLimitRule struct {
+	Rule         LimitRuleRecord
+	ProfileName  string
+	Scope        string
+	CurrencyCode string
+}
+
+// AccountLimitRules mirrors account_limit_rules(). The caller must hold Mu.
+func (s *Store) AccountLimitRules(accountID int64) []AccountLimitRule {
+	account, ok := s.Accounts[accountID]
+	if !ok {
+		return nil
+	}
+
+	var userProfileID, defaultProfileID int64
+	assigned := map[string]int64{}
+	for _, assignment := range s.LimitAssignments {
+		switch {
+		case assignment.AccountID.Valid && assignment.AccountID.Int64 == accountID:
+			assigned["ACCOUNT"] = assignment.ProfileID
+		case assignment.UserID.Valid && assignment.UserID.Int64 == account.UserID:
+			userProfileID = assignment.ProfileID
+		}
+	}
+	for _, profile := range s.LimitProfiles {
+		if profile.IsDefault {
+			defaultProfileID = profile.ID
+		}
+	}
+	if userProfileID != 0 {
+		assigned["USER"] = userProfileID
+	} else if defaultProfileID != 0 {
+		assigned["USER"] = defaultProfileID
+	}
+
+	rules := []AccountLimitRule{}
+	for scope, profileID := range assigned {
+		profile, ok := s.LimitProfiles[profileID]
+		if !ok {
+			continue
+		}
+		for _, rule := range s.LimitRules {
+			if rule.ProfileID != profileID || rule.CurrencyCode.Valid && rule.CurrencyCode.String != account.CurrencyCode {
+				continue
+			}
+			rules = append(rules, AccountLimitRule{
+				Rule:         *rule,
+				ProfileName:  profile.Name,
+				Scope:        scope,
+				CurrencyCode: account.CurrencyCode,
+			})
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Scope != rules[j].Scope {
+			return rules[i].Scope < rules[j].Scope
+		}
+		return rules[i].Rule.ID < rules[j].Rule.ID
+	})
+	return rules
+}
+
+// LimitUsage mirrors limit_usage(). The caller must hold Mu.
+func (s *Store) LimitUsage(accountID int64, scope string, txType pgtype.Text, since time.Time) float64 {
+	account, ok := s.Accounts[accountID]
+	if !ok {
+		return 0
+	}
+
+	var used float64
+	for _, tx := range s.Transactions {
+		from, ok := s.Accounts[tx.AccountFrom]
+		if !ok || tx.CreatedAt.Time.Before(since) || !limitCovers(txType, string(tx.TxType)) {
+			continue
+		}
+		if from.ID == accountID ||
+			scope == "USER" && from.UserID == account.UserID && from.CurrencyCode == account.CurrencyCode {
+			used += tx.Amount
+		}
+	}
+	return roundAmount(used)
+}
+
+// LimitPeriodStart mirrors limit_period_start(): days and months start at
+// midnight UTC.
+func LimitPeriodStart(period string, at time.Time) time.Time {
+	at = at.UTC()
+	if period == "month" {
+		return time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// CheckLimits mirrors enforce_transaction_limits() for a posting of amount
+// from the account. pending is the amount of the postings of the same type
+// from the account made before it in the same operation. The caller must
+// hold Mu.
+func (s *Store) CheckLimits(accountID int64, txType string, amount, pending float64) error {
+	if txType != "WITHDRAW" && txType != "DEPOSIT" && txType != "TRANSFER" {
+		return nil
+	}
+
+	now := time.Now()
+	for _, applied := range s.AccountLimitRules(accountID) {
+		rule := applied.Rule
+		if !limitCovers(rule.TxType, txType) {
+			continue
+		}
+		for _, period := range []struct {
+			name  string
+			limit pgtype.Float8
+			start string
+		}{
+			{"per-transaction", rule.PerTransaction, ""},
+			{"daily", rule.Daily, "day"},
+			{"monthly", rule.Monthly, "month"},
+		} {
+			if !period.limit.Valid {
+				continue
+			}
+
+			remaining := period.limit.Float64
+			if period.start != "" {
+				used := s.LimitUsage(accountID, applied.Scope, rule.TxType, LimitPeriodStart(period.start, now)) + pending
+				remaining = max(roundAmount(remaining-used), 0)
+			}
+			if amount > remaining {
+				label := "outgoing"
+				if rule.TxType.Valid {
+					label = strings.ToLower(rule.TxType.String)
+				}
+				return utils.NewBankSystemError(utils.ErrLimitExceeded, fmt.Sprintf(
+					"%s %s limit of %s %s per %s (profile %s), %s remaining",
+					period.name, label, formatLimit(period.limit.Float64), applied.CurrencyCode,
+					strings.ToLower(applied.Scope), applied.ProfileName, formatLimit(remaining),
+				))
+			}
+		}
+	}
+	return nil
+}
+
+// limitCovers reports whether a rule for ruleType limits postings of txType:
+// a rule without a type limits withdrawals and transfers.
+func limitCovers(ruleType pgtype.Text, txType string) bool {
+	if ruleType.Valid {
+		return ruleType.String == txType
+	}
+	return txType == "WITHDRAW" || txType == "TRANSFER"
+}
+
+// roundAmount rounds to the 4 decimals of NUMERIC(22, 4).
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*1e4) / 1e4
+}
+
+// formatLimit formats like to_char(amount, 'FM999999999999999990.0099'):
+// at least 2 and at most 4 decimals.
+func formatLimit(amount float64) string {
+	formatted := strings.TrimRight(strconv.FormatFloat(amount, 'f', 4, 64), "0")
+	if dot := strings.IndexByte(formatted, '.'); len(formatted)-dot < 3 {
+		formatted += strings.Repeat("0", 3-(len(formatted)-dot))
+	}
+	return formatted
+}
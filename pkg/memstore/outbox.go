@@ -0,0 +1,114 @@
+package memstore
+
+import (
+	"bank_system/postgres/sqlc"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// OutboxRecord is a row of "BK_Outbox".
+type OutboxRecord struct {
+	ID          int64
+	EventID     string
+	EventType   string
+	Version     int
+	AccountID   int64
+	Payload     json.RawMessage
+	OccurredAt  time.Time
+	CreatedAt   time.Time
+	PublishedAt pgtype.Timestamptz
+}
+
+// outboxEventTypes mirrors outbox_transaction_recorded().
+var outboxEventTypes = map[string]string{
+	"DEPOSIT":  "deposit.completed",
+	"WITHDRAW": "withdrawal.completed",
+	"TRANSFER": "transfer.completed",
+	"FEE":      "fee.charged",
+	"INTEREST": "interest.charged",
+}
+
+// recordTransactionEvent mirrors the outbox trigger of "BK_Transaction";
+// fx is the conversion of an FX transfer. The caller must hold Mu.
+func (s *Store) recordTransactionEvent(tx sqlc.BKTransaction, fx *FXTransferRecord) {
+	eventType, ok := outboxEventTypes[string(tx.TxType)]
+	if !ok {
+		eventType = "transaction.completed"
+	}
+
+	payload := map[string]any{
+		"transaction_id":    tx.ID,
+		"tx_type":           tx.TxType,
+		"account_id":        tx.AccountFrom,
+		"account_number":    nil,
+		"currency_code":     nil,
+		"amount":            tx.Amount,
+		"balance_after":     tx.BalanceAfter,
+		"detail":            tx.Detail,
+		"to_account_id":     nil,
+		"to_account_number": nil,
+		"to_currency_code":  nil,
+		"credited_amount":   nil,
+	}
+	if from, ok := s.Accounts[tx.AccountFrom]; ok {
+		payload["account_number"] = from.IDNumber
+		payload["currency_code"] = from.CurrencyCode
+	}
+	if tx.AccountTo.Valid {
+		payload["to_account_id"] = tx.AccountTo.Int64
+		payload["credited_amount"] = tx.Amount
+		if to, ok := s.Accounts[tx.AccountTo.Int64]; ok {
+			payload["to_account_number"] = to.IDNumber
+			payload["to_currency_code"] = to.CurrencyCode
+		}
+		if fx != nil {
+			payload["credited_amount"] = fx.ConvertedAmount
+		}
+	}
+
+	s.recordEvent(eventType, tx.AccountFrom, payload, tx.CreatedAt.Time)
+}
+
+// RecordStatusChange mirrors the outbox trigger of the status of
+// "BK_Account". The caller must hold Mu.
+func (s *Store) RecordStatusChange(account sqlc.BKAccount, oldStatus string) {
+	if account.Status == oldStatus {
+		return
+	}
+	s.recordEvent("account.status_changed", account.ID, map[string]any{
+		"account_id":     account.ID,
+		"account_number": account.IDNumber,
+		"old_status":     oldStatus,
+		"new_status":     account.Status,
+	}, time.Now())
+}
+
+func (s *Store) recordEvent(eventType string, accountID int64, payload map[string]any, occurredAt time.Time) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		panic(err)
+	}
+	s.Outbox = append(s.Outbox, &OutboxRecord{
+		ID:         s.NextID("BK_Outbox"),
+		EventID:    newUUID(),
+		EventType:  eventType,
+		Version:    1,
+		AccountID:  accountID,
+		Payload:    data,
+		OccurredAt: occurredAt.Truncate(time.Microsecond),
+		CreatedAt:  time.Now().Truncate(time.Microsecond),
+	})
+}
+
+// newUUID returns a random version 4 UUID, like gen_random_uuid().
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,482 @@
+package memstore
+
+import (
+	"bank_system/postgres/sqlc"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Store holds the rows shared by the in-memory repositories of the user,
+// account and transaction packages. Repositories must hold Mu while they read
+// or change any of the maps, which makes every operation atomic.
+type Store struct {
+	Mu sync.Mutex
+
+	Users        map[int64]*sqlc.BKUser
+	UserTOTP     map[int64]*TOTPRecord
+	Accounts     map[int64]*sqlc.BKAccount
+	Transactions map[int64]*sqlc.BKTransaction
+	Holds        map[int64]*HoldRecord
+	Overdrafts   map[int64]*OverdraftRecord
+	// OverdraftCharges records the days each account was charged for.
+	OverdraftCharges        map[OverdraftCharge]bool
+	FXQuotes                map[string]*FXQuoteRecord
+	FXTransfers             map[int64]*FXTransferRecord
+	Currencies              map[string]*CurrencyRecord
+	StandingOrders          map[int64]*StandingOrderRecord
+	StandingOrderExecutions map[int64]*StandingOrderExecutionRecord
+	Payees                  map[int64]*PayeeRecord
+	Statements              map[int64]*StatementRecord
+	BulkPayments            map[int64]*BulkPaymentRecord
+	BulkPaymentLines        map[int64]*BulkPaymentLineRecord
+	Webhooks                map[int64]*WebhookRecord
+	WebhookDeliveries       map[int64]*WebhookDeliveryRecord
+	WebhookAttempts         map[int64]*WebhookAttemptRecord
+	RiskDecisions           map[int64]*RiskDecisionRecord
+	LimitProfiles           map[int64]*LimitProfileRecord
+	LimitRules              map[int64]*LimitRuleRecord
+	LimitAssignments        map[int64]*LimitAssignmentRecord
+	AMLReports              map[int64]*AMLReportRecord
+	AMLCases                map[int64]*AMLCaseRecord
+	AMLCaseNotes            map[int64]*AMLCaseNoteRecord
+	ScreeningHits           map[int64]*ScreeningHitRecord
+	// AuditLog is in id order; Audit appends to it.
+	AuditLog []*AuditRecord
+	// Outbox is in id order; transactions and status changes append to it.
+	Outbox []*OutboxRecord
+
+	sequences map[string]int64
+}
+
+type TOTPRecord struct {
+	Secret        []byte
+	RecoveryCodes []string
+	Confirmed     bool
+	LastStep      int64
+}
+
+// HoldRecord is a row of "BK_Account_Hold".
+type HoldRecord struct {
+	ID             int64
+	AccountID      int64
+	Amount         float64
+	CapturedAmount float64
+	Status         string
+	Detail         string
+	TransactionID  pgtype.Int8
+	ExpiresAt      time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// OverdraftRecord holds the overdraft columns of "BK_Account".
+type OverdraftRecord struct {
+	Limit        float64
+	InterestRate float64
+	DailyFee     float64
+}
+
+type OverdraftCharge struct {
+	AccountID int64
+	Date      string // YYYY-MM-DD
+}
+
+// FXQuoteRecord is a row of "BK_FX_Quote".
+type FXQuoteRecord struct {
+	ID            string
+	FromCurrency  string
+	ToCurrency    string
+	MidRate       float64
+	Rate          float64
+	SpreadBps     int
+	Source        string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	UsedAt        pgtype.Timestamptz
+	TransactionID pgtype.Int8
+}
+
+// FXTransferRecord is a row of "BK_FX_Transfer", keyed by transaction id.
+type FXTransferRecord struct {
+	QuoteID         string
+	FromCurrency    string
+	ToCurrency      string
+	Amount          float64
+	ConvertedAmount float64
+	MidRate         float64
+	Rate            float64
+	SpreadBps       int
+}
+
+// CurrencyRecord is a row of "BK_Currency".
+type CurrencyRecord struct {
+	Code       string
+	Name       string
+	MinorUnits int
+	Symbol     string
+	Enabled    bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// StandingOrderRecord is a row of "BK_Standing_Order".
+type StandingOrderRecord struct {
+	ID             int64
+	FromAccountID  int64
+	ToAccountID    int64
+	Amount         float64
+	Detail         string
+	Schedule       string
+	TimeZone       string
+	Status         string
+	StartAt        time.Time
+	EndAt          pgtype.Timestamptz
+	MaxOccurrences pgtype.Int4
+	Occurrences    int
+	Attempts       int
+	ScheduledAt    pgtype.Timestamptz
+	NextRunAt      pgtype.Timestamptz
+	ClaimedUntil   pgtype.Timestamptz
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// StandingOrderExecutionRecord is a row of "BK_Standing_Order_Execution".
+type StandingOrderExecutionRecord struct {
+	ID              int64
+	StandingOrderID int64
+	ScheduledAt     time.Time
+	Attempt         int
+	Status          string
+	TransactionID   pgtype.Int8
+	Error           string
+	DecisionID      pgtype.Int8
+	ExecutedAt      time.Time
+}
+
+// PayeeRecord is a row of "BK_Payee".
+type PayeeRecord struct {
+	ID         int64
+	UserID     int64
+	Nickname   string
+	AccountID  int64
+	Verified   bool
+	VerifiedAt pgtype.Timestamptz
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// StatementRecord is a row of "BK_Statement".
+type StatementRecord struct {
+	ID             int64
+	AccountID      int64
+	PeriodStart    time.Time
+	PeriodEnd      time.Time
+	OpeningBalance float64
+	ClosingBalance float64
+	Data           []byte
+	CreatedAt      time.Time
+}
+
+// BulkPaymentRecord is a row of "BK_Bulk_Payment".
+type BulkPaymentRecord struct {
+	ID             int64
+	AccountID      int64
+	MessageID      string
+	Format         string
+	Mode           string
+	Status         string
+	LineCount      int
+	TotalAmount    float64
+	SucceededCount int
+	FailedCount    int
+	Error          string
+	ClaimedUntil   pgtype.Timestamptz
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	CompletedAt    pgtype.Timestamptz
+}
+
+// BulkPaymentLineRecord is a row of "BK_Bulk_Payment_Line".
+type BulkPaymentLineRecord struct {
+	ID            int64
+	BulkPaymentID int64
+	LineNumber    int
+	ToAccount     string
+	ToAccountID   pgtype.Int8
+	Amount        float64
+	Reference     string
+	EndToEndID    string
+	Status        string
+	Error         string
+	TransactionID pgtype.Int8
+	DecisionID    pgtype.Int8
+	ExecutedAt    pgtype.Timestamptz
+}
+
+// WebhookRecord is a row of "BK_Webhook".
+type WebhookRecord struct {
+	ID         int64
+	UserID     pgtype.Int8
+	Partner    pgtype.Text
+	URL        string
+	EventTypes []string
+	Secret     string
+	Active     bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// WebhookDeliveryRecord is a row of "BK_Webhook_Delivery".
+type WebhookDeliveryRecord struct {
+	ID            int64
+	WebhookID     int64
+	EventID       string
+	EventType     string
+	Payload       []byte
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	ClaimedUntil  pgtype.Timestamptz
+	DeliveredAt   pgtype.Timestamptz
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// WebhookAttemptRecord is a row of "BK_Webhook_Attempt".
+type WebhookAttemptRecord struct {
+	ID          int64
+	DeliveryID  int64
+	Attempt     int
+	StatusCode  int
+	Error       string
+	DurationMS  int
+	AttemptedAt time.Time
+}
+
+// RiskDecisionRecord is a row of "BK_Risk_Decision".
+type RiskDecisionRecord struct {
+	ID            int64
+	UserID        int64
+	AccountID     int64
+	MovementType  string
+	Amount        float64
+	Detail        string
+	ToAccountID   pgtype.Int8
+	PayeeID       pgtype.Int8
+	ClientIP      string
+	Network       string
+	Outcome       string
+	Reasons       json.RawMessage
+	HoldID        pgtype.Int8
+	ReviewStatus  pgtype.Text
+	ReviewedBy    string
+	ReviewNote    string
+	ReviewedAt    pgtype.Timestamptz
+	TransactionID pgtype.Int8
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// AMLReportRecord is a row of "BK_AML_Report".
+type AMLReportRecord struct {
+	ID                       int64
+	PeriodStart              time.Time
+	PeriodEnd                time.Time
+	Thresholds               map[string]float64
+	UnscannedCurrencies      []string
+	StructuringMargin        float64
+	StructuringCount         int
+	StructuringWindowSeconds int64
+	FilesWrittenAt           pgtype.Timestamptz
+	CreatedAt                time.Time
+}
+
+// AMLCaseRecord is a row of "BK_AML_Case".
+type AMLCaseRecord struct {
+	ID             int64
+	ReportID       int64
+	UserID         int64
+	Kind           string
+	TxType         string
+	CurrencyCode   string
+	Total          float64
+	TransactionIDs []int64
+	AccountNumbers []string
+	PeriodStart    time.Time
+	PeriodEnd      time.Time
+	Status         string
+	Resolution     string
+	ClosedBy       string
+	ClosedAt       pgtype.Timestamptz
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// AMLCaseNoteRecord is a row of "BK_AML_Case_Note".
+type AMLCaseNoteRecord struct {
+	ID        int64
+	CaseID    int64
+	Author    string
+	Note      string
+	CreatedAt time.Time
+}
+
+// ScreeningHitRecord is a row of "BK_Screening_Hit".
+type ScreeningHitRecord struct {
+	ID          int64
+	UserID      pgtype.Int8
+	Name        string
+	EntryID     string
+	EntryName   string
+	MatchedName string
+	Program     string
+	Score       float64
+	Status      string
+	ReviewedBy  string
+	ReviewNote  string
+	ReviewedAt  pgtype.Timestamptz
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func New() *Store {
+	now := time.Now()
+	currencies := map[string]*CurrencyRecord{}
+	// Seeded like the migration that creates "BK_Currency".
+	for _, c := range []CurrencyRecord{
+		{Code: "USD", Name: "US Dollar", MinorUnits: 2, Symbol: "$"},
+		{Code: "EUR", Name: "Euro", MinorUnits: 2, Symbol: "€"},
+		{Code: "TWD", Name: "New Taiwan Dollar", MinorUnits: 2, Symbol: "NT$"},
+	} {
+		c.Enabled, c.CreatedAt, c.UpdatedAt = true, now, now
+		currencies[c.Code] = &c
+	}
+
+	return &Store{
+		Users:        map[int64]*sqlc.BKUser{},
+		UserTOTP:     map[int64]*TOTPRecord{},
+		Accounts:     map[int64]*sqlc.BKAccount{},
+		Transactions: map[int64]*sqlc.BKTransaction{},
+		Holds:        map[int64]*HoldRecord{},
+		Overdrafts:   map[int64]*OverdraftRecord{},
+		sequences:    map[string]int64{},
+
+		OverdraftCharges:        map[OverdraftCharge]bool{},
+		FXQuotes:                map[string]*FXQuoteRecord{},
+		FXTransfers:             map[int64]*FXTransferRecord{},
+		Currencies:              currencies,
+		StandingOrders:          map[int64]*StandingOrderRecord{},
+		StandingOrderExecutions: map[int64]*StandingOrderExecutionRecord{},
+		Payees:                  map[int64]*PayeeRecord{},
+		Statements:              map[int64]*StatementRecord{},
+		BulkPayments:            map[int64]*BulkPaymentRecord{},
+		BulkPaymentLines:        map[int64]*BulkPaymentLineRecord{},
+		Webhooks:                map[int64]*WebhookRecord{},
+		WebhookDeliveries:       map[int64]*WebhookDeliveryRecord{},
+		WebhookAttempts:         map[int64]*WebhookAttemptRecord{},
+		RiskDecisions:           map[int64]*RiskDecisionRecord{},
+		LimitProfiles:           map[int64]*LimitProfileRecord{},
+		LimitRules:              map[int64]*LimitRuleRecord{},
+		LimitAssignments:        map[int64]*LimitAssignmentRecord{},
+		AMLReports:              map[int64]*AMLReportRecord{},
+		AMLCases:                map[int64]*AMLCaseRecord{},
+		AMLCaseNotes:            map[int64]*AMLCaseNoteRecord{},
+		ScreeningHits:           map[int64]*ScreeningHitRecord{},
+	}
+}
+
+// NextID works like a BIGSERIAL column. The caller must hold Mu.
+func (s *Store) NextID(table string) int64 {
+	s.sequences[table]++
+	return s.sequences[table]
+}
+
+// AccountByIDNumber returns the account with the id_number. The caller must hold Mu.
+func (s *Store) AccountByIDNumber(idNumber string) (*sqlc.BKAccount, bool) {
+	for _, account := range s.Accounts {
+		if account.IDNumber == idNumber {
+			return account, true
+		}
+	}
+	return nil, false
+}
+
+// NewAccountNumber mirrors generate_account_number(). The caller must hold Mu.
+func (s *Store) NewAccountNumber() string {
+	for {
+		digits := make([]byte, 20)
+		for i := range digits {
+			n, _ := rand.Int(rand.Reader, big.NewInt(10))
+			digits[i] = byte('0' + n.Int64())
+		}
+		if _, exists := s.AccountByIDNumber(string(digits)); !exists {
+			return string(digits)
+		}
+	}
+}
+
+func Now() pgtype.Timestamptz {
+	return pgtype.Timestamptz{Time: time.Now(), Valid: true}
+}
+
+// InsertTransaction assigns the id and creation time of tx, stores it,
+// audits it and records its event in the outbox. The caller must hold Mu.
+func (s *Store) InsertTransaction(ctx context.Context, tx sqlc.BKTransaction) sqlc.BKTransaction {
+	tx = s.insertTransaction(ctx, tx)
+	s.recordTransactionEvent(tx, nil)
+	return tx
+}
+
+// InsertFXTransaction works like InsertTransaction for a transfer between
+// currencies and stores its conversion. The caller must hold Mu.
+func (s *Store) InsertFXTransaction(ctx context.Context, tx sqlc.BKTransaction, fx FXTransferRecord) sqlc.BKTransaction {
+	tx = s.insertTransaction(ctx, tx)
+	s.FXTransfers[tx.ID] = &fx
+	s.recordTransactionEvent(tx, &fx)
+	return tx
+}
+
+func (s *Store) insertTransaction(ctx context.Context, tx sqlc.BKTransaction) sqlc.BKTransaction {
+	tx.ID = s.NextID("BK_Transaction")
+	tx.CreatedAt = Now()
+	s.Transactions[tx.ID] = &tx
+	s.Audit(ctx, "BK_Transaction", tx.ID, nil, tx)
+	return tx
+}
+
+// HeldBalance is the held_balance of the account: the sum of its active
+// holds. The caller must hold Mu.
+func (s *Store) HeldBalance(accountID int64) float64 {
+	var held float64
+	for _, hold := range s.Holds {
+		if hold.AccountID == accountID && hold.Status == "ACTIVE" {
+			held += hold.Amount
+		}
+	}
+	return held
+}
+
+// Overdraft returns the overdraft terms of the account, zero when none were
+// set. The caller must hold Mu.
+func (s *Store) Overdraft(accountID int64) OverdraftRecord {
+	if overdraft, ok := s.Overdrafts[accountID]; ok {
+		return *overdraft
+	}
+	return OverdraftRecord{}
+}
+
+// MinorUnits returns the minor units of the currency, 2 when it is unknown.
+// The caller must hold Mu.
+func (s *Store) MinorUnits(code string) int {
+	if currency, ok := s.Currencies[code]; ok {
+		return currency.MinorUnits
+	}
+	return 2
+}
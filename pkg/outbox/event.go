@@ -0,0 +1,101 @@
+// Package outbox publishes the domain events of accounts. Triggers write the
+// events to "BK_Outbox" in the database transaction that causes them, and a
+// relay publishes them to a Redis stream, at least once and in the order they
+// happened for every account.
+package outbox
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The event types. The schema of the data of each type is versioned: a
+// change that is not backwards compatible, removing or changing a field,
+// publishes a new version instead.
+const (
+	EventDepositCompleted    = "deposit.completed"
+	EventWithdrawalCompleted = "withdrawal.completed"
+	EventTransferCompleted   = "transfer.completed"
+	EventFeeCharged          = "fee.charged"
+	EventInterestCharged     = "interest.charged"
+	EventStatusChanged       = "account.status_changed"
+)
+
+// SchemaVersion is the version of the data of the events written today.
+const SchemaVersion = 1
+
+// Event is the envelope of every event. ID is unique and stays the same when
+// the event is published again, so consumers can drop duplicates. Data holds
+// a TransactionData or a StatusChangedData, depending on Type.
+type Event struct {
+	Seq        int64           `json:"-"`
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	AccountID  int64           `json:"account_id"`
+	Data       json.RawMessage `json:"data"`
+	OccurredAt time.Time       `json:"occurred_at"`
+}
+
+// TransactionData is version 1 of the data of the deposit, withdrawal,
+// transfer, fee and interest events. The To fields and CreditedAmount, what
+// the recipient was credited in its currency, are only set for transfers.
+type TransactionData struct {
+	TransactionID   int64    `json:"transaction_id"`
+	TxType          string   `json:"tx_type"`
+	AccountID       int64    `json:"account_id"`
+	AccountNumber   string   `json:"account_number"`
+	CurrencyCode    string   `json:"currency_code"`
+	Amount          float64  `json:"amount"`
+	BalanceAfter    float64  `json:"balance_after"`
+	Detail          string   `json:"detail"`
+	ToAccountID     *int64   `json:"to_account_id"`
+	ToAccountNumber *string  `json:"to_account_number"`
+	ToCurrencyCode  *string  `json:"to_currency_code"`
+	CreditedAmount  *float64 `json:"credited_amount"`
+}
+
+// ReceivedData is what the owner of the recipient account of a transfer is
+// shown of its TransactionData: the transaction and what was credited, but
+// nothing of the sender's account, its balance or the detail.
+type ReceivedData struct {
+	TransactionID   int64   `json:"transaction_id"`
+	TxType          string  `json:"tx_type"`
+	CurrencyCode    string  `json:"currency_code"`
+	Amount          float64 `json:"amount"`
+	ToAccountID     int64   `json:"to_account_id"`
+	ToAccountNumber string  `json:"to_account_number"`
+	ToCurrencyCode  string  `json:"to_currency_code"`
+	CreditedAmount  float64 `json:"credited_amount"`
+}
+
+// Received returns the recipient's side of a transfer.
+func (d TransactionData) Received() ReceivedData {
+	received := ReceivedData{
+		TransactionID: d.TransactionID,
+		TxType:        d.TxType,
+		CurrencyCode:  d.CurrencyCode,
+		Amount:        d.Amount,
+	}
+	if d.ToAccountID != nil {
+		received.ToAccountID = *d.ToAccountID
+	}
+	if d.ToAccountNumber != nil {
+		received.ToAccountNumber = *d.ToAccountNumber
+	}
+	if d.ToCurrencyCode != nil {
+		received.ToCurrencyCode = *d.ToCurrencyCode
+	}
+	if d.CreditedAmount != nil {
+		received.CreditedAmount = *d.CreditedAmount
+	}
+	return received
+}
+
+// StatusChangedData is version 1 of the data of EventStatusChanged.
+type StatusChangedData struct {
+	AccountID     int64  `json:"account_id"`
+	AccountNumber string `json:"account_number"`
+	OldStatus     string `json:"old_status"`
+	NewStatus     string `json:"new_status"`
+}
@@ -0,0 +1,90 @@
+package outbox
+
+import (
+	"bank_system/pkg/memstore"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// memoryOutboxRepository is an OutboxRepository backed by a memstore.Store,
+// whose repositories write the events.
+type memoryOutboxRepository struct {
+	store *memstore.Store
+	// relayMu stands in for the advisory lock; the store's Mu is not held
+	// while publishing.
+	relayMu sync.Mutex
+}
+
+func NewMemoryOutboxRepository(store *memstore.Store) OutboxRepository {
+	return &memoryOutboxRepository{store: store}
+}
+
+func (r *memoryOutboxRepository) PublishPending(ctx context.Context, limit int, publish PublishFunc) (int, error) {
+	if !r.relayMu.TryLock() {
+		return 0, nil
+	}
+	defer r.relayMu.Unlock()
+
+	r.store.Mu.Lock()
+	var (
+		records []*memstore.OutboxRecord
+		events  []Event
+	)
+	for _, record := range r.store.Outbox {
+		if len(records) == limit {
+			break
+		}
+		if !record.PublishedAt.Valid {
+			records = append(records, record)
+			events = append(events, Event{
+				Seq:        record.ID,
+				ID:         record.EventID,
+				Type:       record.EventType,
+				Version:    record.Version,
+				AccountID:  record.AccountID,
+				Data:       record.Payload,
+				OccurredAt: record.OccurredAt,
+			})
+		}
+	}
+	r.store.Mu.Unlock()
+
+	if len(events) == 0 {
+		return 0, nil
+	}
+	if err := publish(ctx, events); err != nil {
+		return 0, err
+	}
+
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	now := memstore.Now()
+	for _, record := range records {
+		record.PublishedAt = now
+	}
+	return len(events), nil
+}
+
+func (r *memoryOutboxRepository) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	kept := r.store.Outbox[:0]
+	for _, record := range r.store.Outbox {
+		if !publishedBefore(record.PublishedAt, before) {
+			kept = append(kept, record)
+		}
+	}
+	deleted := int64(len(r.store.Outbox) - len(kept))
+	clear(r.store.Outbox[len(kept):])
+	r.store.Outbox = kept
+	return deleted, nil
+}
+
+func publishedBefore(publishedAt pgtype.Timestamptz, before time.Time) bool {
+	return publishedAt.Valid && publishedAt.Time.Before(before)
+}
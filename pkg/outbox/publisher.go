@@ -0,0 +1,80 @@
+package outbox
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultStream is the Redis stream events are published to.
+const DefaultStream = "bank:events"
+
+// Publisher delivers events in order. An error may come after some of them
+// were delivered; they are delivered again.
+type Publisher interface {
+	Publish(ctx context.Context, events []Event) error
+}
+
+type redisStreamPublisher struct {
+	client *redis.Client
+	stream string
+	maxLen int64
+}
+
+// NewRedisStreamPublisher appends every event to stream, DefaultStream when
+// empty, with the fields of Event: id, type, version, account_id,
+// occurred_at and data, the JSON of its data. A positive maxLen trims the
+// stream to about that many entries.
+func NewRedisStreamPublisher(client *redis.Client, stream string, maxLen int64) Publisher {
+	if stream == "" {
+		stream = DefaultStream
+	}
+
+	return &redisStreamPublisher{
+		client: client,
+		stream: stream,
+		maxLen: maxLen,
+	}
+}
+
+func (p *redisStreamPublisher) Publish(ctx context.Context, events []Event) error {
+	// A pipeline sends the XADDs in order on one connection.
+	pipe := p.client.Pipeline()
+	for _, event := range events {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: p.stream,
+			MaxLen: p.maxLen,
+			Approx: p.maxLen > 0,
+			Values: []any{
+				"id", event.ID,
+				"type", event.Type,
+				"version", strconv.Itoa(event.Version),
+				"account_id", strconv.FormatInt(event.AccountID, 10),
+				"occurred_at", event.OccurredAt.UTC().Format(time.RFC3339Nano),
+				"data", string(event.Data),
+			},
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+type multiPublisher []Publisher
+
+// MultiPublisher publishes events with each of the publishers in turn,
+// stopping at the first error. The events are published again to all of
+// them, so they must tolerate duplicates.
+func MultiPublisher(publishers ...Publisher) Publisher {
+	return multiPublisher(publishers)
+}
+
+func (m multiPublisher) Publish(ctx context.Context, events []Event) error {
+	for _, publisher := range m {
+		if err := publisher.Publish(ctx, events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
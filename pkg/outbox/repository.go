@@ -0,0 +1,113 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// relayLockKey is the advisory lock a relay holds while it publishes.
+const relayLockKey = 0x6f7574626f78 // "outbox"
+
+const eventColumns = `id, event_id::TEXT, event_type, version, account_id, payload, occurred_at`
+
+// PublishFunc publishes events, in order.
+type PublishFunc func(ctx context.Context, events []Event) error
+
+type OutboxRepository interface {
+	// PublishPending hands the oldest unpublished events, at most limit, to
+	// publish and marks them published once it returns nil. Only one relay
+	// publishes at a time, across instances; PublishPending returns 0 while
+	// another one does.
+	PublishPending(ctx context.Context, limit int, publish PublishFunc) (int, error)
+	// DeletePublished deletes the events published before the time.
+	DeletePublished(ctx context.Context, before time.Time) (int64, error)
+}
+
+type outboxRepositoryImpl struct {
+	pool *pgxpool.Pool
+}
+
+func NewOutboxRepository(pool *pgxpool.Pool) OutboxRepository {
+	return &outboxRepositoryImpl{pool: pool}
+}
+
+func (r *outboxRepositoryImpl) PublishPending(ctx context.Context, limit int, publish PublishFunc) (int, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var locked bool
+	if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, relayLockKey).Scan(&locked); err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT `+eventColumns+` FROM "BK_Outbox"
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Event, error) {
+		var (
+			event Event
+			data  []byte
+		)
+		err := row.Scan(
+			&event.Seq,
+			&event.ID,
+			&event.Type,
+			&event.Version,
+			&event.AccountID,
+			&data,
+			&event.OccurredAt,
+		)
+		event.Data = data
+		return event, err
+	})
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	if err := publish(ctx, events); err != nil {
+		return 0, err
+	}
+
+	seqs := make([]int64, len(events))
+	for i, event := range events {
+		seqs[i] = event.Seq
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE "BK_Outbox" SET published_at = NOW() WHERE id = ANY($1)`,
+		seqs,
+	); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
+
+func (r *outboxRepositoryImpl) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.pool.Exec(ctx,
+		`DELETE FROM "BK_Outbox" WHERE published_at < $1`,
+		before,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,65 @@
+package outbox
+
+import (
+	"context"
+	"expvar"
+	"time"
+)
+
+const (
+	DefaultBatchSize = 100
+	DefaultRetention = 7 * 24 * time.Hour
+)
+
+var relayMetrics = expvar.NewMap("outbox")
+
+type OutboxService struct {
+	repo      OutboxRepository
+	publisher Publisher
+	batchSize int
+	retention time.Duration
+}
+
+// NewOutboxService creates the relay. batchSize is the number of events
+// published per round trip and retention how long published events are kept;
+// zero values fall back to DefaultBatchSize and DefaultRetention.
+func NewOutboxService(repo OutboxRepository, publisher Publisher, batchSize int, retention time.Duration) *OutboxService {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+
+	return &OutboxService{
+		repo:      repo,
+		publisher: publisher,
+		batchSize: batchSize,
+		retention: retention,
+	}
+}
+
+// Relay publishes the pending events until none is left, or another relay
+// holds the lock, and returns how many it published. Events that failed to
+// publish stay pending and are tried again, in order, by the next Relay.
+func (s *OutboxService) Relay(ctx context.Context) (int, error) {
+	var published int
+	for {
+		n, err := s.repo.PublishPending(ctx, s.batchSize, s.publisher.Publish)
+		if err != nil {
+			relayMetrics.Add("errors", 1)
+			return published, err
+		}
+		published += n
+		relayMetrics.Add("published", int64(n))
+
+		if n < s.batchSize {
+			return published, nil
+		}
+	}
+}
+
+// Purge deletes the events published longer than the retention ago.
+func (s *OutboxService) Purge(ctx context.Context, now time.Time) (int64, error) {
+	return s.repo.DeletePublished(ctx, now.Add(-s.retention))
+}
@@ -0,0 +1,282 @@
+package payee
+
+import (
+	"bank_system/utils"
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PayeeController struct {
+	service *PayeeService
+	logger  *log.Logger
+}
+
+func NewPayeeController(service *PayeeService, logger *log.Logger) *PayeeController {
+	return &PayeeController{
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (c *PayeeController) AddPayee(ctx *gin.Context) {
+	userID, ok := userIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	type AddPayeeRequest struct {
+		Nickname      string `json:"nickname" binding:"required"`
+		AccountNumber string `json:"account_number" binding:"required"`
+		OTPCode       string `json:"otp_code"`
+	}
+
+	var req AddPayeeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	payee, err := c.service.AddPayee(reqCtx, userID, req.Nickname, req.AccountNumber, req.OTPCode)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, payee)
+}
+
+func (c *PayeeController) GetUserPayees(ctx *gin.Context) {
+	userID, ok := userIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	payees, err := c.service.GetUserPayees(reqCtx, userID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, payees)
+}
+
+func (c *PayeeController) GetPayee(ctx *gin.Context) {
+	userID, payeeID, ok := payeeParams(ctx)
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	payee, err := c.service.GetPayee(reqCtx, userID, payeeID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, payee)
+}
+
+func (c *PayeeController) RenamePayee(ctx *gin.Context) {
+	userID, payeeID, ok := payeeParams(ctx)
+	if !ok {
+		return
+	}
+
+	type RenamePayeeRequest struct {
+		Nickname string `json:"nickname" binding:"required"`
+	}
+
+	var req RenamePayeeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	payee, err := c.service.RenamePayee(reqCtx, userID, payeeID, req.Nickname)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, payee)
+}
+
+func (c *PayeeController) VerifyPayee(ctx *gin.Context) {
+	userID, payeeID, ok := payeeParams(ctx)
+	if !ok {
+		return
+	}
+
+	type VerifyPayeeRequest struct {
+		OTPCode string `json:"otp_code" binding:"required"`
+	}
+
+	var req VerifyPayeeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	payee, err := c.service.VerifyPayee(reqCtx, userID, payeeID, req.OTPCode)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, payee)
+}
+
+func (c *PayeeController) DeletePayee(ctx *gin.Context) {
+	userID, payeeID, ok := payeeParams(ctx)
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	if err := c.service.DeletePayee(reqCtx, userID, payeeID); err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *PayeeController) TransferToPayee(ctx *gin.Context) {
+	userID, payeeID, ok := payeeParams(ctx)
+	if !ok {
+		return
+	}
+
+	type TransferRequest struct {
+		FromAccount string  `json:"from_account" binding:"required"`
+		Amount      float64 `json:"amount" binding:"required"`
+		Detail      string  `json:"detail"`
+		OTPCode     string  `json:"otp_code"`
+		QuoteID     string  `json:"quote_id"`
+	}
+
+	var req TransferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	txID, balance, conversion, review, err := c.service.TransferToPayee(
+		reqCtx, userID, payeeID, req.FromAccount, req.Amount, req.Detail, req.OTPCode, req.QuoteID,
+	)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+	if review != nil {
+		ctx.JSON(http.StatusAccepted, review)
+		return
+	}
+
+	response := gin.H{"transaction_id": txID, "balance": balance}
+	if conversion != nil {
+		response["conversion"] = conversion
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func userIDParam(ctx *gin.Context) (int64, bool) {
+	userID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return 0, false
+	}
+	return userID, true
+}
+
+func payeeParams(ctx *gin.Context) (int64, int64, bool) {
+	userID, ok := userIDParam(ctx)
+	if !ok {
+		return 0, 0, false
+	}
+	payeeID, err := strconv.ParseInt(ctx.Param("payee_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payee id"})
+		return 0, 0, false
+	}
+	return userID, payeeID, true
+}
+
+func errorStatus(err error) int {
+	switch {
+	case utils.IsValidationError(err):
+		return http.StatusBadRequest
+	case utils.IsBankSystemError(err, utils.ErrOTPRequired),
+		utils.IsBankSystemError(err, utils.ErrInvalidOTP):
+		return http.StatusUnauthorized
+	case utils.IsBankSystemError(err, utils.ErrTOTPNotEnabled),
+		utils.IsBankSystemError(err, utils.ErrPayeeCoolingOff),
+		utils.IsBankSystemError(err, utils.ErrPayeeRequired),
+		utils.IsBankSystemError(err, utils.ErrTransactionBlocked):
+		return http.StatusForbidden
+	case utils.IsBankSystemError(err, utils.ErrUserNotFound),
+		utils.IsBankSystemError(err, utils.ErrAccountNotFound),
+		utils.IsBankSystemError(err, utils.ErrPayeeNotFound),
+		utils.IsBankSystemError(err, utils.ErrQuoteNotFound):
+		return http.StatusNotFound
+	case utils.IsBankSystemError(err, utils.ErrPayeeExists),
+		utils.IsBankSystemError(err, utils.ErrQuoteExpired):
+		return http.StatusConflict
+	case utils.IsBankSystemError(err, utils.ErrAccountNotActive),
+		utils.IsBankSystemError(err, utils.ErrSameAccountTransfer),
+		utils.IsBankSystemError(err, utils.ErrCurrencyMismatch):
+		return http.StatusBadRequest
+	case utils.IsBankSystemError(err, utils.ErrRateUnavailable):
+		return http.StatusServiceUnavailable
+	case utils.IsBankSystemError(err, utils.ErrInsufficientBalance),
+		utils.IsBankSystemError(err, utils.ErrLimitExceeded):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RegisterRoutes serves the payee book of a user, and the transfers to it,
+// only to the user, behind the owner middleware.
+func (c *PayeeController) RegisterRoutes(router *gin.Engine, owner gin.HandlerFunc) {
+	group := router.Group("/users/:id/payees", owner)
+	{
+		group.POST("", c.AddPayee)
+		group.GET("", c.GetUserPayees)
+		group.GET("/:payee_id", c.GetPayee)
+		group.PUT("/:payee_id", c.RenamePayee)
+		group.DELETE("/:payee_id", c.DeletePayee)
+		group.POST("/:payee_id/verify", c.VerifyPayee)
+		group.POST("/:payee_id/transfer", c.TransferToPayee)
+	}
+}
@@ -0,0 +1,161 @@
+package payee
+
+import (
+	"bank_system/pkg/memstore"
+	"bank_system/utils"
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// memoryPayeeRepository is a PayeeRepository backed by a memstore.Store.
+type memoryPayeeRepository struct {
+	store *memstore.Store
+}
+
+func NewMemoryPayeeRepository(store *memstore.Store) PayeeRepository {
+	return &memoryPayeeRepository{store: store}
+}
+
+func (r *memoryPayeeRepository) CreatePayee(ctx context.Context, payee Payee) (Payee, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	if _, ok := r.store.Users[payee.UserID]; !ok {
+		return Payee{}, errors.New(`insert on "BK_Payee" violates a foreign key constraint to "BK_User"`)
+	}
+	if _, ok := r.store.Accounts[payee.AccountID]; !ok {
+		return Payee{}, errors.New(`insert on "BK_Payee" violates a foreign key constraint to "BK_Account"`)
+	}
+	if r.conflicts(0, payee.UserID, payee.AccountID, payee.Nickname) {
+		return Payee{}, utils.NewBankSystemError(utils.ErrPayeeExists, payee.Nickname)
+	}
+
+	now := time.Now()
+	record := &memstore.PayeeRecord{
+		ID:         r.store.NextID("BK_Payee"),
+		UserID:     payee.UserID,
+		Nickname:   payee.Nickname,
+		AccountID:  payee.AccountID,
+		Verified:   payee.Verified,
+		VerifiedAt: payee.VerifiedAt,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	r.store.Payees[record.ID] = record
+	r.store.Audit(ctx, "BK_Payee", record.ID, nil, *record)
+
+	return r.toPayee(record), nil
+}
+
+func (r *memoryPayeeRepository) GetPayee(ctx context.Context, id int64) (Payee, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.Payees[id]
+	if !ok {
+		return Payee{}, pgx.ErrNoRows
+	}
+	return r.toPayee(record), nil
+}
+
+func (r *memoryPayeeRepository) GetUserPayees(ctx context.Context, userID int64) ([]Payee, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	payees := []Payee{}
+	for _, record := range r.store.Payees {
+		if record.UserID == userID {
+			payees = append(payees, r.toPayee(record))
+		}
+	}
+	sort.Slice(payees, func(i, j int) bool { return payees[i].Nickname < payees[j].Nickname })
+
+	return payees, nil
+}
+
+func (r *memoryPayeeRepository) RenamePayee(ctx context.Context, id int64, nickname string) (Payee, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.Payees[id]
+	if !ok {
+		return Payee{}, pgx.ErrNoRows
+	}
+	if r.conflicts(id, record.UserID, 0, nickname) {
+		return Payee{}, utils.NewBankSystemError(utils.ErrPayeeExists, nickname)
+	}
+
+	before := *record
+	record.Nickname = nickname
+	record.UpdatedAt = time.Now()
+	r.store.Audit(ctx, "BK_Payee", record.ID, before, *record)
+	return r.toPayee(record), nil
+}
+
+func (r *memoryPayeeRepository) VerifyPayee(ctx context.Context, id int64) (Payee, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.Payees[id]
+	if !ok {
+		return Payee{}, pgx.ErrNoRows
+	}
+
+	before := *record
+	now := time.Now()
+	record.Verified = true
+	if !record.VerifiedAt.Valid {
+		record.VerifiedAt = pgtype.Timestamptz{Time: now, Valid: true}
+	}
+	record.UpdatedAt = now
+	r.store.Audit(ctx, "BK_Payee", record.ID, before, *record)
+	return r.toPayee(record), nil
+}
+
+func (r *memoryPayeeRepository) DeletePayee(ctx context.Context, id int64) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.Payees[id]
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	delete(r.store.Payees, id)
+	r.store.Audit(ctx, "BK_Payee", id, *record, nil)
+	return nil
+}
+
+// conflicts mirrors the unique constraints on (user_id, account_id) and
+// (user_id, nickname), ignoring the payee id. The caller must hold Mu.
+func (r *memoryPayeeRepository) conflicts(id, userID, accountID int64, nickname string) bool {
+	for _, record := range r.store.Payees {
+		if record.ID != id && record.UserID == userID &&
+			(record.AccountID == accountID || record.Nickname == nickname) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryPayeeRepository) toPayee(record *memstore.PayeeRecord) Payee {
+	payee := Payee{
+		ID:         record.ID,
+		UserID:     record.UserID,
+		Nickname:   record.Nickname,
+		AccountID:  record.AccountID,
+		Verified:   record.Verified,
+		VerifiedAt: record.VerifiedAt,
+		CreatedAt:  record.CreatedAt,
+		UpdatedAt:  record.UpdatedAt,
+	}
+	if account, ok := r.store.Accounts[record.AccountID]; ok {
+		payee.AccountNumber = account.IDNumber
+		payee.CurrencyCode = account.CurrencyCode
+	}
+	return payee
+}
@@ -0,0 +1,45 @@
+package payee
+
+import (
+	"bank_system/utils"
+	"context"
+	"time"
+)
+
+// RecipientCheck applies the cooling-off to the transfers that do not name a
+// payee, see account.RecipientChecker.
+type RecipientCheck struct {
+	repo       PayeeRepository
+	coolingOff CoolingOff
+}
+
+func NewRecipientCheck(repo PayeeRepository, coolingOff CoolingOff) *RecipientCheck {
+	return &RecipientCheck{
+		repo:       repo,
+		coolingOff: coolingOff,
+	}
+}
+
+// CheckRecipient refuses a transfer above the cooling-off amount from the user
+// to toIDNumber unless the user saved it as a payee that is verified or past
+// its cooling-off period.
+func (c *RecipientCheck) CheckRecipient(ctx context.Context, userID int64, toIDNumber string, amount float64) error {
+	if c.coolingOff.Period <= 0 || amount <= c.coolingOff.Amount {
+		return nil
+	}
+
+	payees, err := c.repo.GetUserPayees(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, payee := range payees {
+		if payee.AccountNumber != toIDNumber {
+			continue
+		}
+		if until, cooling := c.coolingOff.until(payee, time.Now()); cooling {
+			return utils.NewBankSystemError(utils.ErrPayeeCoolingOff, until.UTC().Format(time.RFC3339))
+		}
+		return nil
+	}
+	return utils.NewBankSystemError(utils.ErrPayeeRequired, toIDNumber)
+}
@@ -0,0 +1,152 @@
+package payee
+
+import (
+	"bank_system/utils"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	payeeColumns = `p.id, p.user_id, p.nickname, p.account_id, a.id_number, a.currency_code,
+		p.verified, p.verified_at, p.created_at, p.updated_at`
+	payeeFrom = `"BK_Payee" p JOIN "BK_Account" a ON a.id = p.account_id`
+)
+
+// Payee is an account a user saved under Nickname to transfer to.
+type Payee struct {
+	ID            int64              `json:"id"`
+	UserID        int64              `json:"user_id"`
+	Nickname      string             `json:"nickname"`
+	AccountID     int64              `json:"account_id"`
+	AccountNumber string             `json:"account_number"`
+	CurrencyCode  string             `json:"currency_code"`
+	Verified      bool               `json:"verified"`
+	VerifiedAt    pgtype.Timestamptz `json:"verified_at"`
+	CreatedAt     time.Time          `json:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+}
+
+type PayeeRepository interface {
+	// CreatePayee returns utils.ErrPayeeExists when the user already saved
+	// the account or the nickname.
+	CreatePayee(ctx context.Context, payee Payee) (Payee, error)
+	GetPayee(ctx context.Context, id int64) (Payee, error)
+	GetUserPayees(ctx context.Context, userID int64) ([]Payee, error)
+	RenamePayee(ctx context.Context, id int64, nickname string) (Payee, error)
+	VerifyPayee(ctx context.Context, id int64) (Payee, error)
+	DeletePayee(ctx context.Context, id int64) error
+}
+
+type payeeRepositoryImpl struct {
+	pool *pgxpool.Pool
+}
+
+func NewPayeeRepository(pool *pgxpool.Pool) PayeeRepository {
+	return &payeeRepositoryImpl{pool: pool}
+}
+
+func (r *payeeRepositoryImpl) CreatePayee(ctx context.Context, payee Payee) (Payee, error) {
+	var id int64
+	err := r.pool.QueryRow(ctx,
+		`INSERT INTO "BK_Payee" (user_id, nickname, account_id, verified, verified_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`,
+		payee.UserID, payee.Nickname, payee.AccountID, payee.Verified, payee.VerifiedAt,
+	).Scan(&id)
+	if err != nil {
+		return Payee{}, existsError(err, payee.Nickname)
+	}
+	return r.GetPayee(ctx, id)
+}
+
+func (r *payeeRepositoryImpl) GetPayee(ctx context.Context, id int64) (Payee, error) {
+	return scanPayee(r.pool.QueryRow(ctx, `SELECT `+payeeColumns+` FROM `+payeeFrom+` WHERE p.id = $1`, id))
+}
+
+func (r *payeeRepositoryImpl) GetUserPayees(ctx context.Context, userID int64) ([]Payee, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+payeeColumns+` FROM `+payeeFrom+` WHERE p.user_id = $1 ORDER BY p.nickname`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payees := []Payee{}
+	for rows.Next() {
+		payee, err := scanPayee(rows)
+		if err != nil {
+			return nil, err
+		}
+		payees = append(payees, payee)
+	}
+	return payees, rows.Err()
+}
+
+func (r *payeeRepositoryImpl) RenamePayee(ctx context.Context, id int64, nickname string) (Payee, error) {
+	tag, err := r.pool.Exec(ctx, `UPDATE "BK_Payee" SET nickname = $2 WHERE id = $1`, id, nickname)
+	if err != nil {
+		return Payee{}, existsError(err, nickname)
+	}
+	if tag.RowsAffected() == 0 {
+		return Payee{}, pgx.ErrNoRows
+	}
+	return r.GetPayee(ctx, id)
+}
+
+func (r *payeeRepositoryImpl) VerifyPayee(ctx context.Context, id int64) (Payee, error) {
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE "BK_Payee" SET verified = TRUE, verified_at = COALESCE(verified_at, NOW()) WHERE id = $1`,
+		id,
+	)
+	if err != nil {
+		return Payee{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return Payee{}, pgx.ErrNoRows
+	}
+	return r.GetPayee(ctx, id)
+}
+
+func (r *payeeRepositoryImpl) DeletePayee(ctx context.Context, id int64) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM "BK_Payee" WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func existsError(err error, nickname string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return utils.NewBankSystemError(utils.ErrPayeeExists, nickname)
+	}
+	return err
+}
+
+func scanPayee(row pgx.Row) (Payee, error) {
+	var payee Payee
+	err := row.Scan(
+		&payee.ID,
+		&payee.UserID,
+		&payee.Nickname,
+		&payee.AccountID,
+		&payee.AccountNumber,
+		&payee.CurrencyCode,
+		&payee.Verified,
+		&payee.VerifiedAt,
+		&payee.CreatedAt,
+		&payee.UpdatedAt,
+	)
+	return payee, err
+}
@@ -0,0 +1,229 @@
+package payee
+
+import (
+	"bank_system/pkg/account"
+	"bank_system/postgres/sqlc"
+	"bank_system/utils"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const NICKNAME_MAX_LENGTH = 64 // "BK_Payee".nickname VARCHAR(64)
+
+var accountNumberPattern = regexp.MustCompile(`^[0-9]{20}$`)
+
+// Accounts is what payees need of account.AccountService.
+type Accounts interface {
+	GetAccountByIDNumber(ctx context.Context, idNumber string) (*sqlc.GetAccountByIDNumberRow, error)
+	AuthorizeMovement(ctx context.Context, movement account.Movement, code string) (*account.Review, error)
+	TransferWithQuote(
+		ctx context.Context, fromIDNumber, toIDNumber string, amount float64, detail, quoteID string,
+	) (int64, float64, *account.Conversion, error)
+}
+
+// Users is what payees need of user.UserService.
+type Users interface {
+	GetUserByID(ctx context.Context, id int64) (*sqlc.GetUserByIDRow, error)
+	account.StepUpVerifier
+}
+
+// CoolingOff holds back transfers above Amount to a payee for Period after
+// it was added, unless the user verified it, and to accounts of other users
+// that are no payee at all. A Period of 0 disables it.
+type CoolingOff struct {
+	Period time.Duration
+	Amount float64
+}
+
+// until returns when the cooling-off period of payee ends and whether it
+// still applies at now.
+func (c CoolingOff) until(payee Payee, now time.Time) (time.Time, bool) {
+	if c.Period <= 0 || payee.Verified {
+		return time.Time{}, false
+	}
+	until := payee.CreatedAt.Add(c.Period)
+	return until, now.Before(until)
+}
+
+type PayeeService struct {
+	repo       PayeeRepository
+	accounts   Accounts
+	users      Users
+	coolingOff CoolingOff
+}
+
+func NewPayeeService(repo PayeeRepository, accounts Accounts, users Users, coolingOff CoolingOff) *PayeeService {
+	return &PayeeService{
+		repo:       repo,
+		accounts:   accounts,
+		users:      users,
+		coolingOff: coolingOff,
+	}
+}
+
+// AddPayee saves the active account accountNumber under nickname for the
+// user. With otpCode the payee is verified right away.
+func (s *PayeeService) AddPayee(
+	ctx context.Context, userID int64, nickname, accountNumber, otpCode string,
+) (Payee, error) {
+	if err := s.checkUser(ctx, userID); err != nil {
+		return Payee{}, err
+	}
+
+	nickname = strings.TrimSpace(nickname)
+	verr := &utils.ValidationError{}
+	validateNickname(verr, nickname)
+	if !accountNumberPattern.MatchString(accountNumber) {
+		verr.Add("account_number", "must be 20 digits")
+	}
+	if err := verr.Err(); err != nil {
+		return Payee{}, err
+	}
+
+	target, err := s.accounts.GetAccountByIDNumber(ctx, accountNumber)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Payee{}, utils.NewBankSystemError(utils.ErrAccountNotFound, accountNumber)
+	}
+	if err != nil {
+		return Payee{}, err
+	}
+	if target.Status != account.StatusActive {
+		return Payee{}, utils.NewBankSystemError(utils.ErrAccountNotActive, accountNumber)
+	}
+
+	payee := Payee{UserID: userID, Nickname: nickname, AccountID: target.ID}
+	if otpCode != "" {
+		if err := s.users.VerifyStepUp(ctx, userID, otpCode); err != nil {
+			return Payee{}, err
+		}
+		payee.Verified = true
+		payee.VerifiedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	}
+	return s.repo.CreatePayee(ctx, payee)
+}
+
+func (s *PayeeService) GetUserPayees(ctx context.Context, userID int64) ([]Payee, error) {
+	if err := s.checkUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetUserPayees(ctx, userID)
+}
+
+func (s *PayeeService) GetPayee(ctx context.Context, userID, payeeID int64) (Payee, error) {
+	return s.getPayee(ctx, userID, payeeID)
+}
+
+func (s *PayeeService) RenamePayee(ctx context.Context, userID, payeeID int64, nickname string) (Payee, error) {
+	if _, err := s.getPayee(ctx, userID, payeeID); err != nil {
+		return Payee{}, err
+	}
+
+	nickname = strings.TrimSpace(nickname)
+	verr := &utils.ValidationError{}
+	validateNickname(verr, nickname)
+	if err := verr.Err(); err != nil {
+		return Payee{}, err
+	}
+	return s.repo.RenamePayee(ctx, payeeID, nickname)
+}
+
+// VerifyPayee confirms a payee with the user's second factor, which lifts
+// the cooling-off period.
+func (s *PayeeService) VerifyPayee(ctx context.Context, userID, payeeID int64, otpCode string) (Payee, error) {
+	payee, err := s.getPayee(ctx, userID, payeeID)
+	if err != nil {
+		return Payee{}, err
+	}
+	if payee.Verified {
+		return payee, nil
+	}
+
+	if otpCode == "" {
+		return Payee{}, utils.NewBankSystemError(utils.ErrOTPRequired)
+	}
+	if err := s.users.VerifyStepUp(ctx, userID, otpCode); err != nil {
+		return Payee{}, err
+	}
+	return s.repo.VerifyPayee(ctx, payeeID)
+}
+
+func (s *PayeeService) DeletePayee(ctx context.Context, userID, payeeID int64) error {
+	if _, err := s.getPayee(ctx, userID, payeeID); err != nil {
+		return err
+	}
+	return s.repo.DeletePayee(ctx, payeeID)
+}
+
+// TransferToPayee moves amount from the user's account fromIDNumber to the
+// payee, like account.AccountService.TransferWithQuote. A transfer held for
+// review is not made and its review is returned instead.
+func (s *PayeeService) TransferToPayee(
+	ctx context.Context, userID, payeeID int64, fromIDNumber string, amount float64, detail, otpCode, quoteID string,
+) (int64, float64, *account.Conversion, *account.Review, error) {
+	payee, err := s.getPayee(ctx, userID, payeeID)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	from, err := s.accounts.GetAccountByIDNumber(ctx, fromIDNumber)
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && from.UserID != userID {
+		return 0, 0, nil, nil, utils.NewBankSystemError(utils.ErrAccountNotFound, fromIDNumber)
+	}
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	if until, cooling := s.coolingOff.until(payee, time.Now()); cooling && amount > s.coolingOff.Amount {
+		return 0, 0, nil, nil, utils.NewBankSystemError(utils.ErrPayeeCoolingOff, until.UTC().Format(time.RFC3339))
+	}
+
+	review, err := s.accounts.AuthorizeMovement(ctx, account.Movement{
+		Type:            account.MovementTransfer,
+		AccountNumber:   fromIDNumber,
+		Amount:          amount,
+		Detail:          detail,
+		ToAccountNumber: payee.AccountNumber,
+		PayeeID:         payee.ID,
+		PayeeCreatedAt:  payee.CreatedAt,
+		PayeeVerified:   payee.Verified,
+	}, otpCode)
+	if err != nil || review != nil {
+		return 0, 0, nil, review, err
+	}
+	txID, balance, conversion, err := s.accounts.TransferWithQuote(ctx, fromIDNumber, payee.AccountNumber, amount, detail, quoteID)
+	return txID, balance, conversion, nil, err
+}
+
+func (s *PayeeService) checkUser(ctx context.Context, userID int64) error {
+	_, err := s.users.GetUserByID(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return utils.NewBankSystemError(utils.ErrUserNotFound, strconv.FormatInt(userID, 10))
+	}
+	return err
+}
+
+// getPayee returns the payee if it belongs to the user.
+func (s *PayeeService) getPayee(ctx context.Context, userID, payeeID int64) (Payee, error) {
+	payee, err := s.repo.GetPayee(ctx, payeeID)
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && payee.UserID != userID {
+		return Payee{}, utils.NewBankSystemError(utils.ErrPayeeNotFound, strconv.FormatInt(payeeID, 10))
+	}
+	return payee, err
+}
+
+func validateNickname(verr *utils.ValidationError, nickname string) {
+	switch n := len([]rune(nickname)); {
+	case n == 0:
+		verr.Add("nickname", "is required")
+	case n > NICKNAME_MAX_LENGTH:
+		verr.Add("nickname", fmt.Sprintf("must be at most %d characters", NICKNAME_MAX_LENGTH))
+	}
+}
@@ -0,0 +1,71 @@
+package repotest
+
+import (
+	"bank_system/pkg/account"
+	"bank_system/pkg/aml"
+	"bank_system/pkg/audit"
+	"bank_system/pkg/bulkpayment"
+	"bank_system/pkg/currency"
+	"bank_system/pkg/fx"
+	"bank_system/pkg/limit"
+	"bank_system/pkg/memstore"
+	"bank_system/pkg/outbox"
+	"bank_system/pkg/payee"
+	"bank_system/pkg/risk"
+	"bank_system/pkg/screening"
+	"bank_system/pkg/standingorder"
+	"bank_system/pkg/statement"
+	"bank_system/pkg/stream"
+	"bank_system/pkg/transaction"
+	"bank_system/pkg/user"
+	"bank_system/pkg/webhook"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Memory returns the in-memory repositories, all backed by store.
+func Memory(store *memstore.Store) Repositories {
+	return Repositories{
+		Users:        user.NewMemoryUserRepository(store),
+		Accounts:     account.NewMemoryAccountRepository(store),
+		Transactions: transaction.NewMemoryTxRepository(store),
+		Quotes:       fx.NewMemoryQuoteRepository(store),
+		Currencies:   currency.NewMemoryCurrencyRepository(store),
+		Orders:       standingorder.NewMemoryStandingOrderRepository(store),
+		Payees:       payee.NewMemoryPayeeRepository(store),
+		Statements:   statement.NewMemoryStatementRepository(store),
+		BulkPayments: bulkpayment.NewMemoryBulkPaymentRepository(store),
+		Audit:        audit.NewMemoryAuditRepository(store),
+		Outbox:       outbox.NewMemoryOutboxRepository(store),
+		Webhooks:     webhook.NewMemoryWebhookRepository(store),
+		Streams:      stream.NewMemoryStreamRepository(store),
+		Risk:         risk.NewMemoryRiskRepository(store),
+		Limits:       limit.NewMemoryLimitRepository(store),
+		AML:          aml.NewMemoryAMLRepository(store),
+		Screening:    screening.NewMemoryScreeningRepository(store),
+	}
+}
+
+// Postgres returns the Postgres repositories on pool, which must be migrated
+// to the latest version.
+func Postgres(pool *pgxpool.Pool) Repositories {
+	return Repositories{
+		Users:        user.NewUserRepository(pool),
+		Accounts:     account.NewAccountRepository(pool),
+		Transactions: transaction.NewTxRepository(pool),
+		Quotes:       fx.NewQuoteRepository(pool),
+		Currencies:   currency.NewCurrencyRepository(pool),
+		Orders:       standingorder.NewStandingOrderRepository(pool),
+		Payees:       payee.NewPayeeRepository(pool),
+		Statements:   statement.NewStatementRepository(pool),
+		BulkPayments: bulkpayment.NewBulkPaymentRepository(pool),
+		Audit:        audit.NewAuditRepository(pool),
+		Outbox:       outbox.NewOutboxRepository(pool),
+		Webhooks:     webhook.NewWebhookRepository(pool),
+		Streams:      stream.NewStreamRepository(pool),
+		Risk:         risk.NewRiskRepository(pool),
+		Limits:       limit.NewLimitRepository(pool),
+		AML:          aml.NewAMLRepository(pool),
+		Screening:    screening.NewScreeningRepository(pool),
+	}
+}
@@ -0,0 +1,2368 @@
+// Package repotest checks that an implementation of the user, account and
+// transaction repositories behaves like the Postgres schema. Like
+// testing/fstest.TestFS it reports problems as an error instead of depending on
+// package testing, so the same suite can run against the in-memory and the
+// Postgres repositories from a test, the integration harness or a command.
+package repotest
+
+import (
+	"bank_system/pkg/account"
+	"bank_system/pkg/aml"
+	"bank_system/pkg/audit"
+	"bank_system/pkg/bulkpayment"
+	"bank_system/pkg/currency"
+	"bank_system/pkg/fx"
+	"bank_system/pkg/limit"
+	"bank_system/pkg/outbox"
+	"bank_system/pkg/payee"
+	"bank_system/pkg/risk"
+	"bank_system/pkg/screening"
+	"bank_system/pkg/standingorder"
+	"bank_system/pkg/statement"
+	"bank_system/pkg/stream"
+	"bank_system/pkg/transaction"
+	"bank_system/pkg/user"
+	"bank_system/pkg/webhook"
+	"bank_system/utils"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Repositories must share one backend, e.g. the same memstore.Store or pool.
+type Repositories struct {
+	Users        user.UserRepository
+	Accounts     account.AccountRepository
+	Transactions transaction.TxRepository
+	Quotes       fx.QuoteRepository
+	Currencies   currency.CurrencyRepository
+	Orders       standingorder.StandingOrderRepository
+	Payees       payee.PayeeRepository
+	Statements   statement.StatementRepository
+	BulkPayments bulkpayment.BulkPaymentRepository
+	Audit        audit.AuditRepository
+	Outbox       outbox.OutboxRepository
+	Webhooks     webhook.WebhookRepository
+	Streams      stream.StreamRepository
+	Risk         risk.RiskRepository
+	Limits       limit.LimitRepository
+	AML          aml.AMLRepository
+	Screening    screening.ScreeningRepository
+}
+
+type checker struct {
+	errs []error
+}
+
+func (c *checker) errorf(format string, args ...any) {
+	c.errs = append(c.errs, fmt.Errorf(format, args...))
+}
+
+// Run executes the whole suite. It only creates new rows, with random emails,
+// so it can run against a database that already holds data.
+func Run(ctx context.Context, repos Repositories) error {
+	c := &checker{}
+
+	for _, check := range []struct {
+		name string
+		fn   func(ctx context.Context, c *checker, repos Repositories) error
+	}{
+		{"users", checkUsers},
+		{"accounts", checkAccounts},
+		{"deposit and withdraw", checkDepositWithdraw},
+		{"inactive accounts", checkInactiveAccounts},
+		{"transfers", checkTransfers},
+		{"holds", checkHolds},
+		{"overdraft", checkOverdraft},
+		{"fx", checkFX},
+		{"currencies", checkCurrencies},
+		{"standing orders", checkStandingOrders},
+		{"payees", checkPayees},
+		{"statements", checkStatements},
+		{"bulk payments", checkBulkPayments},
+		{"totp", checkTOTP},
+		{"audit", checkAudit},
+		{"outbox", checkOutbox},
+		{"webhooks", checkWebhooks},
+		{"streams", checkStreams},
+		{"risk", checkRisk},
+		{"limits", checkLimits},
+		{"aml", checkAML},
+		{"screening", checkScreening},
+	} {
+		sub := &checker{}
+		if err := check.fn(ctx, sub, repos); err != nil {
+			sub.errorf("aborted: %v", err)
+		}
+		for _, err := range sub.errs {
+			c.errs = append(c.errs, fmt.Errorf("%s: %w", check.name, err))
+		}
+	}
+
+	return errors.Join(c.errs...)
+}
+
+func checkUsers(ctx context.Context, c *checker, repos Repositories) error {
+	email := randomEmail()
+	created, err := repos.Users.CreateUser(ctx, "conformance", email, "hash")
+	if err != nil {
+		return err
+	}
+
+	got, err := repos.Users.GetUserByID(ctx, created.ID)
+	if err != nil {
+		return err
+	}
+	if got.Email != email || got.Username != "conformance" {
+		c.errorf("GetUserByID returned %q/%q, want %q/%q", got.Username, got.Email, "conformance", email)
+	}
+
+	byEmail, err := repos.Users.GetUserByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if byEmail.ID != created.ID || byEmail.Password != "hash" {
+		c.errorf("GetUserByEmail returned user %d, want %d with its password hash", byEmail.ID, created.ID)
+	}
+
+	exists, err := repos.Users.CheckUserEmailExists(ctx, email)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		c.errorf("CheckUserEmailExists(%q) = false after CreateUser", email)
+	}
+
+	if _, err := repos.Users.CreateUser(ctx, "duplicate", email, "hash"); err == nil {
+		c.errorf("CreateUser accepted a duplicate email")
+	}
+
+	other, err := repos.Users.CreateUser(ctx, "other", randomEmail(), "hash")
+	if err != nil {
+		return err
+	}
+	if err := repos.Users.UpdateUser(ctx, other.ID, "other", email, "hash"); err == nil {
+		c.errorf("UpdateUser accepted another user's email")
+	}
+
+	newEmail := randomEmail()
+	if err := repos.Users.UpdateUser(ctx, other.ID, "renamed", newEmail, "hash2"); err != nil {
+		return err
+	}
+	renamed, err := repos.Users.GetUserByID(ctx, other.ID)
+	if err != nil {
+		return err
+	}
+	if renamed.Username != "renamed" || renamed.Email != newEmail {
+		c.errorf("UpdateUser did not persist username and email")
+	}
+
+	if _, err := repos.Users.GetUserByID(ctx, math.MaxInt64); err == nil {
+		c.errorf("GetUserByID found a user that does not exist")
+	}
+
+	return nil
+}
+
+func checkAccounts(ctx context.Context, c *checker, repos Repositories) error {
+	owner, err := repos.Users.CreateUser(ctx, "conformance", randomEmail(), "hash")
+	if err != nil {
+		return err
+	}
+
+	created, err := repos.Accounts.CreateAccount(ctx, owner.ID, "EUR")
+	if err != nil {
+		return err
+	}
+	if created.Balance != 0 || created.Status != account.StatusActive || created.CurrencyCode != "EUR" {
+		c.errorf("new account has balance %v, status %q and currency %q, want 0, ACTIVE and EUR",
+			created.Balance, created.Status, created.CurrencyCode)
+	}
+	if len(created.IDNumber) != 20 {
+		c.errorf("account number %q is not 20 digits", created.IDNumber)
+	}
+
+	exists, err := repos.Accounts.CheckAccountIDNumberExists(ctx, created.IDNumber)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		c.errorf("CheckAccountIDNumberExists = false for a new account")
+	}
+
+	exists, err = repos.Accounts.CheckAccountIDNumberExists(ctx, "no-such-account")
+	if err != nil {
+		return err
+	}
+	if exists {
+		c.errorf("CheckAccountIDNumberExists = true for an unknown account")
+	}
+
+	if _, err := repos.Accounts.GetAccountByIDNumber(ctx, "no-such-account"); err == nil {
+		c.errorf("GetAccountByIDNumber found an unknown account")
+	}
+
+	if _, err := repos.Accounts.CreateAccount(ctx, math.MaxInt64, "USD"); err == nil {
+		c.errorf("CreateAccount accepted an unknown user")
+	}
+	if _, err := repos.Accounts.CreateAccount(ctx, owner.ID, "XXX"); err == nil {
+		c.errorf("CreateAccount accepted an unknown currency")
+	}
+
+	accounts, err := repos.Users.GetUserAccounts(ctx, owner.ID)
+	if err != nil {
+		return err
+	}
+	if len(accounts) != 1 || accounts[0].ID != created.ID {
+		c.errorf("GetUserAccounts returned %d accounts, want the created one", len(accounts))
+	}
+
+	return nil
+}
+
+func checkDepositWithdraw(ctx context.Context, c *checker, repos Repositories) error {
+	acc, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+
+	txID, balance, err := repos.Accounts.DepositToAccount(ctx, acc.ID, 100.50, "deposit")
+	if err != nil {
+		return err
+	}
+	if balance != 100.50 {
+		c.errorf("balance after deposit = %v, want 100.50", balance)
+	}
+
+	tx, err := repos.Transactions.GetTransactionByID(ctx, txID)
+	if err != nil {
+		return err
+	}
+	if tx.AccountFrom != acc.ID || tx.Amount != 100.50 || tx.BalanceAfter != 100.50 ||
+		string(tx.TxType) != transaction.TxType_DEPOSIT {
+		c.errorf("deposit transaction = %+v", tx)
+	}
+
+	if _, _, err := repos.Accounts.WithdrawFromAccount(ctx, acc.ID, 200, "too much"); err == nil {
+		c.errorf("WithdrawFromAccount allowed a negative balance")
+	}
+	for _, amount := range []float64{0, -10} {
+		if _, _, err := repos.Accounts.DepositToAccount(ctx, acc.ID, amount, ""); err == nil {
+			c.errorf("DepositToAccount accepted amount %v", amount)
+		}
+		if _, _, err := repos.Accounts.WithdrawFromAccount(ctx, acc.ID, amount, ""); err == nil {
+			c.errorf("WithdrawFromAccount accepted amount %v", amount)
+		}
+	}
+
+	_, balance, err = repos.Accounts.WithdrawFromAccount(ctx, acc.ID, 40.25, "withdraw")
+	if err != nil {
+		return err
+	}
+	if balance != 60.25 {
+		c.errorf("balance after withdrawal = %v, want 60.25", balance)
+	}
+
+	expectBalance(ctx, c, repos, acc.IDNumber, 60.25)
+
+	txs, err := repos.Accounts.GetAccountTransactionsByIDNumber(ctx, acc.IDNumber)
+	if err != nil {
+		return err
+	}
+	if len(txs) != 2 {
+		c.errorf("account has %d transactions, want 2 (failed operations must not be recorded)", len(txs))
+	}
+
+	return nil
+}
+
+func checkInactiveAccounts(ctx context.Context, c *checker, repos Repositories) error {
+	acc, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	other, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	if _, _, err := repos.Accounts.DepositToAccount(ctx, acc.ID, 50, ""); err != nil {
+		return err
+	}
+
+	if err := repos.Accounts.UpdateAccountStatus(ctx, acc.IDNumber, account.StatusFrozen); err != nil {
+		return err
+	}
+
+	if _, _, err := repos.Accounts.DepositToAccount(ctx, acc.ID, 10, ""); err == nil {
+		c.errorf("DepositToAccount accepted a FROZEN account")
+	}
+	if _, _, err := repos.Accounts.WithdrawFromAccount(ctx, acc.ID, 10, ""); err == nil {
+		c.errorf("WithdrawFromAccount accepted a FROZEN account")
+	}
+	if _, _, err := repos.Accounts.TransferBetweenAccounts(ctx, acc.ID, other.ID, 10, ""); err == nil {
+		c.errorf("TransferBetweenAccounts accepted a FROZEN source account")
+	}
+	if _, _, err := repos.Accounts.TransferBetweenAccounts(ctx, other.ID, acc.ID, 10, ""); err == nil {
+		c.errorf("TransferBetweenAccounts accepted a FROZEN destination account")
+	}
+
+	expectBalance(ctx, c, repos, acc.IDNumber, 50)
+	return nil
+}
+
+func checkTransfers(ctx context.Context, c *checker, repos Repositories) error {
+	from, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	to, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	if _, _, err := repos.Accounts.DepositToAccount(ctx, from.ID, 100, ""); err != nil {
+		return err
+	}
+
+	txID, balance, err := repos.Accounts.TransferBetweenAccounts(ctx, from.ID, to.ID, 30, "rent")
+	if err != nil {
+		return err
+	}
+	if balance != 70 {
+		c.errorf("source balance after transfer = %v, want 70", balance)
+	}
+	expectBalance(ctx, c, repos, from.IDNumber, 70)
+	expectBalance(ctx, c, repos, to.IDNumber, 30)
+
+	tx, err := repos.Transactions.GetTransactionByID(ctx, txID)
+	if err != nil {
+		return err
+	}
+	if !tx.AccountTo.Valid || tx.AccountTo.Int64 != to.ID || string(tx.TxType) != transaction.TxType_TRANSFER {
+		c.errorf("transfer transaction = %+v", tx)
+	}
+
+	if _, _, err := repos.Accounts.TransferBetweenAccounts(ctx, from.ID, to.ID, 1000, ""); err == nil {
+		c.errorf("TransferBetweenAccounts allowed a negative balance")
+	}
+	if _, _, err := repos.Accounts.TransferBetweenAccounts(ctx, from.ID, from.ID, 10, ""); err == nil {
+		c.errorf("TransferBetweenAccounts allowed a transfer to the same account")
+	}
+	expectBalance(ctx, c, repos, from.IDNumber, 70)
+	expectBalance(ctx, c, repos, to.IDNumber, 30)
+
+	received, err := repos.Accounts.GetAccountTransactionsByIDNumber(ctx, to.IDNumber)
+	if err != nil {
+		return err
+	}
+	if len(received) != 1 || received[0].ID != txID {
+		c.errorf("destination lists %d transactions, want the transfer", len(received))
+	}
+
+	other, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	txIDs, balance, err := repos.Accounts.TransferBatch(ctx, from.ID, []account.BatchTransfer{
+		{ToAccountID: to.ID, Amount: 20, Detail: "first"},
+		{ToAccountID: other.ID, Amount: 10, Detail: "second"},
+	})
+	if err != nil {
+		return err
+	}
+	if len(txIDs) != 2 || balance != 40 {
+		c.errorf("TransferBatch = %v, %v, want 2 transactions and balance 40", txIDs, balance)
+	}
+	expectBalance(ctx, c, repos, to.IDNumber, 50)
+	expectBalance(ctx, c, repos, other.IDNumber, 10)
+
+	if _, _, err := repos.Accounts.TransferBatch(ctx, from.ID, []account.BatchTransfer{
+		{ToAccountID: to.ID, Amount: 30},
+		{ToAccountID: other.ID, Amount: 30},
+	}); err == nil {
+		c.errorf("TransferBatch allowed a negative balance")
+	}
+	expectBalance(ctx, c, repos, from.IDNumber, 40)
+	expectBalance(ctx, c, repos, to.IDNumber, 50)
+	expectBalance(ctx, c, repos, other.IDNumber, 10)
+
+	return nil
+}
+
+func checkHolds(ctx context.Context, c *checker, repos Repositories) error {
+	acc, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	to, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	if _, _, err := repos.Accounts.DepositToAccount(ctx, acc.ID, 100, ""); err != nil {
+		return err
+	}
+
+	expectBalances := func(ledger, held float64) {
+		balances, err := repos.Accounts.GetAccountBalances(ctx, acc.IDNumber)
+		if err != nil {
+			c.errorf("GetAccountBalances(%s): %v", acc.IDNumber, err)
+			return
+		}
+		if balances.Ledger != ledger || balances.Held != held || balances.Available != ledger-held {
+			c.errorf("balances = %+v, want ledger %v and held %v", balances, ledger, held)
+		}
+	}
+
+	expires := time.Now().Add(time.Hour)
+	hold, err := repos.Accounts.PlaceHold(ctx, acc.ID, 60, "card", expires)
+	if err != nil {
+		return err
+	}
+	if hold.Status != account.HoldActive || hold.Amount != 60 || hold.AccountID != acc.ID {
+		c.errorf("PlaceHold returned %+v", hold)
+	}
+	expectBalances(100, 60)
+
+	if _, err := repos.Accounts.PlaceHold(ctx, acc.ID, 50, "", expires); err == nil {
+		c.errorf("PlaceHold reserved more than the available balance")
+	}
+	if _, _, err := repos.Accounts.WithdrawFromAccount(ctx, acc.ID, 50, ""); err == nil {
+		c.errorf("WithdrawFromAccount spent held money")
+	}
+	if _, _, err := repos.Accounts.TransferBetweenAccounts(ctx, acc.ID, to.ID, 50, ""); err == nil {
+		c.errorf("TransferBetweenAccounts spent held money")
+	}
+
+	// A partial capture settles the amount and releases the rest.
+	txID, balance, err := repos.Accounts.CaptureHold(ctx, acc.ID, hold.ID, 45, to.ID)
+	if err != nil {
+		return err
+	}
+	if balance != 55 {
+		c.errorf("balance after capture = %v, want 55", balance)
+	}
+	expectBalances(55, 0)
+	expectBalance(ctx, c, repos, to.IDNumber, 45)
+
+	captured, err := repos.Accounts.GetHold(ctx, hold.ID)
+	if err != nil {
+		return err
+	}
+	if captured.Status != account.HoldCaptured || captured.CapturedAmount != 45 ||
+		!captured.TransactionID.Valid || captured.TransactionID.Int64 != txID {
+		c.errorf("captured hold = %+v", captured)
+	}
+	tx, err := repos.Transactions.GetTransactionByID(ctx, txID)
+	if err != nil {
+		return err
+	}
+	if string(tx.TxType) != transaction.TxType_TRANSFER || tx.Amount != 45 || tx.Detail != "card" {
+		c.errorf("capture transaction = %+v", tx)
+	}
+	if _, _, err := repos.Accounts.CaptureHold(ctx, acc.ID, hold.ID, 1, 0); err == nil {
+		c.errorf("CaptureHold captured a hold twice")
+	}
+
+	released, err := repos.Accounts.PlaceHold(ctx, acc.ID, 20, "", expires)
+	if err != nil {
+		return err
+	}
+	if _, _, err := repos.Accounts.CaptureHold(ctx, acc.ID, released.ID, 21, 0); err == nil {
+		c.errorf("CaptureHold captured more than the hold")
+	}
+	if _, err := repos.Accounts.ReleaseHold(ctx, to.ID, released.ID); err == nil {
+		c.errorf("ReleaseHold released a hold of another account")
+	}
+	available, err := repos.Accounts.ReleaseHold(ctx, acc.ID, released.ID)
+	if err != nil {
+		return err
+	}
+	if available != 55 {
+		c.errorf("available after release = %v, want 55", available)
+	}
+
+	expired, err := repos.Accounts.PlaceHold(ctx, acc.ID, 10, "", time.Now().Add(-time.Second))
+	if err != nil {
+		return err
+	}
+	if _, _, err := repos.Accounts.CaptureHold(ctx, acc.ID, expired.ID, 10, 0); err == nil {
+		c.errorf("CaptureHold captured an expired hold")
+	}
+	if _, err := repos.Accounts.ExpireHolds(ctx); err != nil {
+		return err
+	}
+	if got, err := repos.Accounts.GetHold(ctx, expired.ID); err != nil || got.Status != account.HoldExpired {
+		c.errorf("hold past its expiry has status %q (%v), want EXPIRED", got.Status, err)
+	}
+	expectBalances(55, 0)
+
+	holds, err := repos.Accounts.GetAccountHolds(ctx, acc.ID)
+	if err != nil {
+		return err
+	}
+	if len(holds) != 3 {
+		c.errorf("GetAccountHolds returned %d holds, want 3", len(holds))
+	}
+
+	return nil
+}
+
+func checkOverdraft(ctx context.Context, c *checker, repos Repositories) error {
+	acc, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	to, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	if _, _, err := repos.Accounts.DepositToAccount(ctx, acc.ID, 10, ""); err != nil {
+		return err
+	}
+
+	if _, _, err := repos.Accounts.WithdrawFromAccount(ctx, acc.ID, 20, ""); err == nil {
+		c.errorf("WithdrawFromAccount overdrew an account without an overdraft")
+	}
+
+	terms := account.Overdraft{Limit: 100, InterestRate: 0.365, DailyFee: 2.5}
+	if err := repos.Accounts.UpdateOverdraft(ctx, acc.IDNumber, terms); err != nil {
+		return err
+	}
+	if got, err := repos.Accounts.GetOverdraft(ctx, acc.IDNumber); err != nil || got != terms {
+		c.errorf("GetOverdraft = %+v (%v), want %+v", got, err, terms)
+	}
+
+	if _, balance, err := repos.Accounts.WithdrawFromAccount(ctx, acc.ID, 60, ""); err != nil {
+		return err
+	} else if balance != -50 {
+		c.errorf("balance after overdrawing = %v, want -50", balance)
+	}
+	if _, _, err := repos.Accounts.TransferBetweenAccounts(ctx, acc.ID, to.ID, 40, ""); err != nil {
+		return err
+	}
+	if _, _, err := repos.Accounts.TransferBetweenAccounts(ctx, acc.ID, to.ID, 20, ""); err == nil {
+		c.errorf("TransferBetweenAccounts went beyond the overdraft limit")
+	}
+	if _, err := repos.Accounts.PlaceHold(ctx, acc.ID, 20, "", time.Now().Add(time.Hour)); err == nil {
+		c.errorf("PlaceHold went beyond the overdraft limit")
+	}
+
+	balances, err := repos.Accounts.GetAccountBalances(ctx, acc.IDNumber)
+	if err != nil {
+		return err
+	}
+	if balances.Ledger != -90 || balances.OverdraftLimit != 100 || balances.Available != 10 {
+		c.errorf("balances = %+v, want ledger -90, limit 100 and available 10", balances)
+	}
+
+	if err := repos.Accounts.UpdateOverdraft(ctx, acc.IDNumber, account.Overdraft{Limit: 50}); err == nil {
+		c.errorf("UpdateOverdraft lowered the limit below the amount in use")
+	}
+
+	// 0.365 a year on 90 is 0.09 a day, plus the daily fee.
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	charged, err := repos.Accounts.PostOverdraftCharges(ctx, day)
+	if err != nil {
+		return err
+	}
+	if !containsID(charged, acc.ID) || containsID(charged, to.ID) {
+		c.errorf("PostOverdraftCharges charged %v, want %d but not %d", charged, acc.ID, to.ID)
+	}
+	expectBalance(ctx, c, repos, acc.IDNumber, -92.59)
+
+	charged, err = repos.Accounts.PostOverdraftCharges(ctx, day)
+	if err != nil {
+		return err
+	}
+	if containsID(charged, acc.ID) {
+		c.errorf("PostOverdraftCharges charged the same day twice")
+	}
+	expectBalance(ctx, c, repos, acc.IDNumber, -92.59)
+
+	transactions, err := repos.Accounts.GetAccountTransactionsByIDNumber(ctx, acc.IDNumber)
+	if err != nil {
+		return err
+	}
+	var interest, fee int
+	for _, tx := range transactions {
+		switch string(tx.TxType) {
+		case transaction.TxType_INTEREST:
+			interest++
+			if tx.Amount != 0.09 {
+				c.errorf("interest posting of %v, want 0.09", tx.Amount)
+			}
+		case transaction.TxType_FEE:
+			fee++
+			if tx.Amount != 2.5 || tx.BalanceAfter != -92.59 {
+				c.errorf("fee posting of %v leaving %v, want 2.5 leaving -92.59", tx.Amount, tx.BalanceAfter)
+			}
+		}
+	}
+	if interest != 1 || fee != 1 {
+		c.errorf("%d interest and %d fee postings, want one each", interest, fee)
+	}
+
+	return nil
+}
+
+// checkFX is skipped when Repositories has no Quotes.
+func checkFX(ctx context.Context, c *checker, repos Repositories) error {
+	if repos.Quotes == nil {
+		return nil
+	}
+
+	from, err := newAccountIn(ctx, repos, "USD")
+	if err != nil {
+		return err
+	}
+	to, err := newAccountIn(ctx, repos, "EUR")
+	if err != nil {
+		return err
+	}
+	if _, _, err := repos.Accounts.DepositToAccount(ctx, from.ID, 100, ""); err != nil {
+		return err
+	}
+
+	if _, _, err := repos.Accounts.TransferBetweenAccounts(ctx, from.ID, to.ID, 10, ""); err == nil {
+		c.errorf("TransferBetweenAccounts moved money between USD and EUR without converting")
+	}
+
+	quote, err := repos.Quotes.CreateQuote(ctx, fx.Quote{
+		ID:           randomQuoteID(),
+		FromCurrency: "USD",
+		ToCurrency:   "EUR",
+		MidRate:      0.9,
+		Rate:         0.8955,
+		SpreadBps:    50,
+		Source:       "conformance",
+		ExpiresAt:    time.Now().Add(time.Minute),
+	})
+	if err != nil {
+		return err
+	}
+	if got, err := repos.Quotes.GetQuote(ctx, quote.ID); err != nil || got.Rate != 0.8955 || got.UsedAt.Valid {
+		c.errorf("GetQuote = %+v, %v", got, err)
+	}
+	if _, err := repos.Quotes.GetQuote(ctx, "no-such-quote"); err == nil {
+		c.errorf("GetQuote found an unknown quote")
+	}
+
+	if _, _, _, err := repos.Accounts.TransferFX(ctx, to.ID, from.ID, 10, quote.ID, ""); err == nil {
+		c.errorf("TransferFX used a USD/EUR quote from EUR to USD")
+	}
+
+	txID, balance, converted, err := repos.Accounts.TransferFX(ctx, from.ID, to.ID, 20, quote.ID, "fx")
+	if err != nil {
+		return err
+	}
+	if balance != 80 || converted != 17.91 {
+		c.errorf("TransferFX returned balance %v and converted %v, want 80 and 17.91", balance, converted)
+	}
+	expectBalance(ctx, c, repos, from.IDNumber, 80)
+	expectBalance(ctx, c, repos, to.IDNumber, 17.91)
+
+	used, err := repos.Quotes.GetQuote(ctx, quote.ID)
+	if err != nil {
+		return err
+	}
+	if !used.UsedAt.Valid || !used.TransactionID.Valid || used.TransactionID.Int64 != txID {
+		c.errorf("quote after the transfer = %+v, want it used by transaction %d", used, txID)
+	}
+
+	if _, _, _, err := repos.Accounts.TransferFX(ctx, from.ID, to.ID, 20, quote.ID, ""); err == nil {
+		c.errorf("TransferFX used a quote twice")
+	}
+
+	expired, err := repos.Quotes.CreateQuote(ctx, fx.Quote{
+		ID:           randomQuoteID(),
+		FromCurrency: "USD",
+		ToCurrency:   "EUR",
+		MidRate:      0.9,
+		Rate:         0.9,
+		Source:       "conformance",
+		ExpiresAt:    time.Now().Add(-time.Second),
+	})
+	if err != nil {
+		return err
+	}
+	if _, _, _, err := repos.Accounts.TransferFX(ctx, from.ID, to.ID, 20, expired.ID, ""); err == nil {
+		c.errorf("TransferFX used an expired quote")
+	}
+	expectBalance(ctx, c, repos, from.IDNumber, 80)
+	expectBalance(ctx, c, repos, to.IDNumber, 17.91)
+
+	return nil
+}
+
+// checkCurrencies is skipped when Repositories has no Currencies. It adds
+// currencies with random codes, which stay in the catalogue.
+func checkCurrencies(ctx context.Context, c *checker, repos Repositories) error {
+	if repos.Currencies == nil {
+		return nil
+	}
+
+	for _, code := range []string{"USD", "EUR", "TWD"} {
+		if got, err := repos.Currencies.GetCurrency(ctx, code); err != nil || got.MinorUnits != 2 || !got.Enabled {
+			c.errorf("seeded currency %s = %+v, %v", code, got, err)
+		}
+	}
+	if _, err := repos.Currencies.GetCurrency(ctx, "ZZZZ"); err == nil {
+		c.errorf("GetCurrency found an unknown currency")
+	}
+
+	dinar, err := newCurrency(ctx, repos, 3)
+	if err != nil {
+		return err
+	}
+	if _, err := repos.Currencies.CreateCurrency(ctx, dinar); err == nil {
+		c.errorf("CreateCurrency accepted %s twice", dinar.Code)
+	}
+
+	listed, err := repos.Currencies.ListCurrencies(ctx)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, currency := range listed {
+		found = found || currency.Code == dinar.Code
+	}
+	if !found {
+		c.errorf("ListCurrencies does not list %s", dinar.Code)
+	}
+
+	acc, err := newAccountIn(ctx, repos, dinar.Code)
+	if err != nil {
+		return err
+	}
+	if _, _, err := repos.Accounts.DepositToAccount(ctx, acc.ID, 1.234, ""); err != nil {
+		return err
+	}
+	expectBalance(ctx, c, repos, acc.IDNumber, 1.234)
+
+	dinar.MinorUnits = 2
+	if _, err := repos.Currencies.UpdateCurrency(ctx, dinar); err == nil {
+		c.errorf("UpdateCurrency changed the minor units of %s while an account uses it", dinar.Code)
+	}
+
+	dinar.MinorUnits = 3
+	dinar.Enabled = false
+	dinar.Symbol = "KD"
+	updated, err := repos.Currencies.UpdateCurrency(ctx, dinar)
+	if err != nil {
+		return err
+	}
+	if updated.Enabled || updated.Symbol != "KD" {
+		c.errorf("UpdateCurrency returned %+v, want it disabled with symbol KD", updated)
+	}
+	if _, err := newAccountIn(ctx, repos, dinar.Code); err == nil {
+		c.errorf("CreateAccount opened an account in the disabled currency %s", dinar.Code)
+	}
+	if _, _, err := repos.Accounts.DepositToAccount(ctx, acc.ID, 1, ""); err != nil {
+		c.errorf("deposit to an account in a disabled currency: %v", err)
+	}
+
+	unused, err := newCurrency(ctx, repos, 0)
+	if err != nil {
+		return err
+	}
+	unused.MinorUnits = 2
+	if _, err := repos.Currencies.UpdateCurrency(ctx, unused); err != nil {
+		c.errorf("UpdateCurrency could not change the minor units of an unused currency: %v", err)
+	}
+
+	return nil
+}
+
+// newCurrency creates an enabled currency with a random code starting with Z.
+func newCurrency(ctx context.Context, repos Repositories, minorUnits int) (currency.Currency, error) {
+	var err error
+	for range 10 {
+		b := make([]byte, 2)
+		rand.Read(b)
+		created := currency.Currency{
+			Code:       "Z" + string(rune('A'+b[0]%26)) + string(rune('A'+b[1]%26)),
+			Name:       "Conformance",
+			MinorUnits: minorUnits,
+			Enabled:    true,
+		}
+		if created, err = repos.Currencies.CreateCurrency(ctx, created); err == nil {
+			return created, nil
+		}
+	}
+	return currency.Currency{}, err
+}
+
+// checkStandingOrders is skipped when Repositories has no Orders. Its order
+// is due in 2001, so that claiming at that time leaves other orders alone.
+func checkStandingOrders(ctx context.Context, c *checker, repos Repositories) error {
+	if repos.Orders == nil {
+		return nil
+	}
+
+	from, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	to, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	if _, _, err := repos.Accounts.DepositToAccount(ctx, from.ID, 100, ""); err != nil {
+		return err
+	}
+
+	day := func(d int) pgtype.Timestamptz {
+		return pgtype.Timestamptz{Time: time.Date(2001, 1, d, 0, 0, 0, 0, time.UTC), Valid: true}
+	}
+	order, err := repos.Orders.CreateStandingOrder(ctx, standingorder.StandingOrder{
+		FromAccountID:  from.ID,
+		ToAccountID:    to.ID,
+		Amount:         5,
+		Detail:         "conformance",
+		Schedule:       "@daily",
+		TimeZone:       "UTC",
+		StartAt:        day(1).Time,
+		MaxOccurrences: pgtype.Int4{Int32: 3, Valid: true},
+		ScheduledAt:    day(1),
+	})
+	if err != nil {
+		return err
+	}
+	if order.Status != standingorder.StatusActive || order.FromAccount != from.IDNumber || order.ToAccount != to.IDNumber ||
+		!order.NextRunAt.Time.Equal(day(1).Time) || order.MaxOccurrences.Int32 != 3 || order.EndAt.Valid {
+		c.errorf("CreateStandingOrder returned %+v", order)
+	}
+	if _, err := repos.Orders.GetStandingOrder(ctx, -1); err == nil {
+		c.errorf("GetStandingOrder found an unknown order")
+	}
+
+	listed, err := repos.Orders.GetAccountStandingOrders(ctx, from.ID)
+	if err != nil {
+		return err
+	}
+	if len(listed) != 1 || listed[0].ID != order.ID {
+		c.errorf("GetAccountStandingOrders = %+v, want order %d", listed, order.ID)
+	}
+
+	claim := func(d int) (bool, error) {
+		now := day(d).Time.Add(time.Second)
+		claimed, err := repos.Orders.ClaimDueStandingOrders(ctx, now, now.Add(standingorder.ClaimTTL), 100)
+		for _, o := range claimed {
+			if o.ID == order.ID {
+				return true, err
+			}
+		}
+		return false, err
+	}
+	if found, err := claim(1); err != nil || !found {
+		c.errorf("ClaimDueStandingOrders did not claim the due order: %v", err)
+	}
+	if found, err := claim(1); err != nil || found {
+		c.errorf("ClaimDueStandingOrders claimed an order twice: %v", err)
+	}
+
+	txID, _, err := repos.Accounts.TransferBetweenAccounts(ctx, from.ID, to.ID, 5, "conformance")
+	if err != nil {
+		return err
+	}
+	order.Occurrences = 1
+	order.ScheduledAt, order.NextRunAt = day(2), day(2)
+	execution, err := repos.Orders.RecordExecution(ctx, order, standingorder.Execution{
+		StandingOrderID: order.ID,
+		ScheduledAt:     day(1).Time,
+		Attempt:         1,
+		Status:          standingorder.ExecutionSucceeded,
+		TransactionID:   pgtype.Int8{Int64: txID, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	if execution.ID == 0 || execution.TransactionID.Int64 != txID {
+		c.errorf("RecordExecution returned %+v", execution)
+	}
+
+	if found, err := claim(1); err != nil || found {
+		c.errorf("ClaimDueStandingOrders claimed an order before its next run: %v", err)
+	}
+	if found, err := claim(2); err != nil || !found {
+		c.errorf("ClaimDueStandingOrders did not claim the order at its next run: %v", err)
+	}
+
+	order.Status = standingorder.StatusPaused
+	order.ScheduledAt, order.NextRunAt = pgtype.Timestamptz{}, pgtype.Timestamptz{}
+	if _, err := repos.Orders.UpdateStandingOrder(ctx, order, standingorder.StatusActive); err != nil {
+		return err
+	}
+	if _, err := repos.Orders.UpdateStandingOrder(ctx, order, standingorder.StatusActive); err == nil {
+		c.errorf("UpdateStandingOrder changed an order that is no longer active")
+	}
+
+	// The execution claimed before the pause finishes after it.
+	order.Status = standingorder.StatusActive
+	order.Attempts = 1
+	order.NextRunAt = day(3)
+	if _, err := repos.Orders.RecordExecution(ctx, order, standingorder.Execution{
+		StandingOrderID: order.ID,
+		ScheduledAt:     day(2).Time,
+		Attempt:         1,
+		Status:          standingorder.ExecutionRetrying,
+		Error:           "insufficient balance",
+	}); err != nil {
+		return err
+	}
+	paused, err := repos.Orders.GetStandingOrder(ctx, order.ID)
+	if err != nil {
+		return err
+	}
+	if paused.Status != standingorder.StatusPaused || paused.NextRunAt.Valid || paused.Attempts != 1 {
+		c.errorf("order recorded after its pause = %+v, want it paused without a next run", paused)
+	}
+
+	executions, err := repos.Orders.GetExecutions(ctx, order.ID)
+	if err != nil {
+		return err
+	}
+	if len(executions) != 2 || executions[0].Status != standingorder.ExecutionSucceeded ||
+		executions[1].Status != standingorder.ExecutionRetrying || executions[1].Error != "insufficient balance" {
+		c.errorf("GetExecutions = %+v", executions)
+	}
+
+	if repos.Risk == nil {
+		return nil
+	}
+	decisionID, err := newReviewDecision(ctx, repos, from)
+	if err != nil {
+		return err
+	}
+	order.Attempts = 0
+	if _, err := repos.Orders.RecordExecution(ctx, order, standingorder.Execution{
+		StandingOrderID: order.ID,
+		ScheduledAt:     day(3).Time,
+		Attempt:         1,
+		Status:          standingorder.ExecutionHeld,
+		DecisionID:      pgtype.Int8{Int64: decisionID, Valid: true},
+	}); err != nil {
+		return err
+	}
+	settled := standingorder.Execution{Status: standingorder.ExecutionSucceeded, TransactionID: pgtype.Int8{Int64: txID, Valid: true}}
+	if err := repos.Orders.SettleExecution(ctx, decisionID, settled); err != nil {
+		return err
+	}
+	if err := repos.Orders.SettleExecution(ctx, decisionID, settled); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("SettleExecution of a settled execution = %v, want pgx.ErrNoRows", err)
+	}
+	executions, err = repos.Orders.GetExecutions(ctx, order.ID)
+	if err != nil {
+		return err
+	}
+	if len(executions) != 3 || executions[2].Status != standingorder.ExecutionSucceeded ||
+		executions[2].TransactionID.Int64 != txID || executions[2].DecisionID.Int64 != decisionID {
+		c.errorf("GetExecutions after SettleExecution = %+v", executions)
+	}
+
+	return nil
+}
+
+// checkPayees is skipped when Repositories has no Payees.
+func checkPayees(ctx context.Context, c *checker, repos Repositories) error {
+	if repos.Payees == nil {
+		return nil
+	}
+
+	owner, err := repos.Users.CreateUser(ctx, "conformance", randomEmail(), "hash")
+	if err != nil {
+		return err
+	}
+	first, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	second, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+
+	created, err := repos.Payees.CreatePayee(ctx, payee.Payee{UserID: owner.ID, Nickname: "rent", AccountID: first.ID})
+	if err != nil {
+		return err
+	}
+	if created.AccountNumber != first.IDNumber || created.CurrencyCode != account.DefaultCurrencyCode ||
+		created.Verified || created.VerifiedAt.Valid {
+		c.errorf("CreatePayee returned %+v", created)
+	}
+
+	_, err = repos.Payees.CreatePayee(ctx, payee.Payee{UserID: owner.ID, Nickname: "again", AccountID: first.ID})
+	if !utils.IsBankSystemError(err, utils.ErrPayeeExists) {
+		c.errorf("CreatePayee of a saved account: err = %v, want ErrPayeeExists", err)
+	}
+	_, err = repos.Payees.CreatePayee(ctx, payee.Payee{UserID: owner.ID, Nickname: "rent", AccountID: second.ID})
+	if !utils.IsBankSystemError(err, utils.ErrPayeeExists) {
+		c.errorf("CreatePayee of a used nickname: err = %v, want ErrPayeeExists", err)
+	}
+
+	other, err := repos.Payees.CreatePayee(ctx, payee.Payee{UserID: owner.ID, Nickname: "gym", AccountID: second.ID})
+	if err != nil {
+		return err
+	}
+	if _, err := repos.Payees.RenamePayee(ctx, other.ID, "rent"); !utils.IsBankSystemError(err, utils.ErrPayeeExists) {
+		c.errorf("RenamePayee to a used nickname: err = %v, want ErrPayeeExists", err)
+	}
+	renamed, err := repos.Payees.RenamePayee(ctx, other.ID, "club")
+	if err != nil {
+		return err
+	}
+	if renamed.Nickname != "club" {
+		c.errorf("RenamePayee returned nickname %q, want %q", renamed.Nickname, "club")
+	}
+
+	verified, err := repos.Payees.VerifyPayee(ctx, created.ID)
+	if err != nil {
+		return err
+	}
+	if !verified.Verified || !verified.VerifiedAt.Valid {
+		c.errorf("VerifyPayee returned %+v", verified)
+	}
+
+	listed, err := repos.Payees.GetUserPayees(ctx, owner.ID)
+	if err != nil {
+		return err
+	}
+	if len(listed) != 2 || listed[0].ID != other.ID || listed[1].ID != created.ID {
+		c.errorf("GetUserPayees = %+v, want payees %d and %d by nickname", listed, other.ID, created.ID)
+	}
+
+	if err := repos.Payees.DeletePayee(ctx, other.ID); err != nil {
+		return err
+	}
+	if _, err := repos.Payees.GetPayee(ctx, other.ID); err == nil {
+		c.errorf("GetPayee found a deleted payee")
+	}
+	if err := repos.Payees.DeletePayee(ctx, other.ID); err == nil {
+		c.errorf("DeletePayee deleted a payee twice")
+	}
+
+	return nil
+}
+
+// checkStatements is skipped when Repositories has no Statements.
+func checkStatements(ctx context.Context, c *checker, repos Repositories) error {
+	if repos.Statements == nil {
+		return nil
+	}
+
+	acc, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	other, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now().Add(-time.Minute)
+	if _, _, err := repos.Accounts.DepositToAccount(ctx, acc.ID, 100, "salary"); err != nil {
+		return err
+	}
+	if _, _, err := repos.Accounts.TransferBetweenAccounts(ctx, acc.ID, other.ID, 30, "rent"); err != nil {
+		return err
+	}
+	if _, _, err := repos.Accounts.TransferBetweenAccounts(ctx, other.ID, acc.ID, 5, "refund"); err != nil {
+		return err
+	}
+	end := time.Now().Add(time.Minute)
+
+	entries, err := repos.Statements.GetEntries(ctx, acc.ID, start, end)
+	if err != nil {
+		return err
+	}
+	want := []struct {
+		amount       float64
+		counterparty string
+	}{{100, ""}, {-30, other.IDNumber}, {5, other.IDNumber}}
+	if len(entries) != len(want) {
+		c.errorf("GetEntries returned %d entries, want %d", len(entries), len(want))
+	} else {
+		for i, w := range want {
+			if entries[i].Amount != w.amount || entries[i].Counterparty != w.counterparty {
+				c.errorf("entry %d = %+v, want amount %v from %q", i, entries[i], w.amount, w.counterparty)
+			}
+		}
+	}
+
+	for _, check := range []struct {
+		at   time.Time
+		want float64
+	}{{start, 0}, {end, 75}} {
+		balance, err := repos.Statements.GetBalanceAt(ctx, acc.ID, check.at)
+		if err != nil {
+			return err
+		}
+		if balance != check.want {
+			c.errorf("GetBalanceAt(%v) = %v, want %v", check.at, balance, check.want)
+		}
+	}
+
+	period := statement.Statement{Summary: statement.Summary{
+		AccountID:      acc.ID,
+		PeriodStart:    start.UTC().Truncate(time.Second),
+		PeriodEnd:      end.UTC().Truncate(time.Second),
+		OpeningBalance: 0,
+		ClosingBalance: 75,
+	}, Entries: entries}
+	created, err := repos.Statements.CreateStatement(ctx, period)
+	if err != nil {
+		return err
+	}
+	if created.ID == 0 || created.AccountNumber != acc.IDNumber || created.ClosingBalance != 75 || len(created.Entries) != len(entries) {
+		c.errorf("CreateStatement returned %+v", created.Summary)
+	}
+	again, err := repos.Statements.CreateStatement(ctx, period)
+	if err != nil {
+		return err
+	}
+	if again.ID != created.ID {
+		c.errorf("CreateStatement of a stored period returned statement %d, want %d", again.ID, created.ID)
+	}
+
+	listed, err := repos.Statements.GetAccountStatements(ctx, acc.ID)
+	if err != nil {
+		return err
+	}
+	if len(listed) != 1 || listed[0].ID != created.ID {
+		c.errorf("GetAccountStatements = %+v, want statement %d", listed, created.ID)
+	}
+
+	missing, err := repos.Statements.GetAccountsWithoutStatement(ctx, period.PeriodStart, period.PeriodEnd, math.MaxInt32)
+	if err != nil {
+		return err
+	}
+	for _, idNumber := range missing {
+		if idNumber == acc.IDNumber {
+			c.errorf("GetAccountsWithoutStatement returned an account with a statement")
+		}
+	}
+
+	return nil
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, got := range ids {
+		if got == id {
+			return true
+		}
+	}
+	return false
+}
+
+func checkBulkPayments(ctx context.Context, c *checker, repos Repositories) error {
+	if repos.BulkPayments == nil {
+		return nil
+	}
+
+	acc, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	to, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+
+	messageID := fmt.Sprintf("repotest-%d", time.Now().UnixNano())
+	created, err := repos.BulkPayments.CreateBulkPayment(ctx, bulkpayment.BulkPayment{
+		AccountID:   acc.ID,
+		MessageID:   messageID,
+		Format:      bulkpayment.FormatCSV,
+		Mode:        bulkpayment.ModeBestEffort,
+		TotalAmount: 15,
+		Lines: []bulkpayment.Line{
+			{LineNumber: 1, ToAccount: to.IDNumber, ToAccountID: pgtype.Int8{Int64: to.ID, Valid: true}, Amount: 15, Status: bulkpayment.LinePending},
+			{LineNumber: 2, ToAccount: "unknown", Amount: 5, Status: bulkpayment.LineRejected, Error: "account not found"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if created.Status != bulkpayment.StatusPending || created.AccountNumber != acc.IDNumber || created.LineCount != 2 ||
+		len(created.Lines) != 2 || created.Lines[0].LineNumber != 1 || created.Lines[1].Status != bulkpayment.LineRejected {
+		c.errorf("CreateBulkPayment returned %+v", created)
+	}
+
+	_, err = repos.BulkPayments.CreateBulkPayment(ctx, bulkpayment.BulkPayment{
+		AccountID: acc.ID,
+		MessageID: messageID,
+		Format:    bulkpayment.FormatCSV,
+		Mode:      bulkpayment.ModeBestEffort,
+		Lines:     []bulkpayment.Line{{LineNumber: 1, ToAccount: to.IDNumber, Amount: 1, Status: bulkpayment.LinePending}},
+	})
+	if !utils.IsBankSystemError(err, utils.ErrBulkPaymentExists) {
+		c.errorf("CreateBulkPayment of a stored message id = %v, want ErrBulkPaymentExists", err)
+	}
+
+	listed, err := repos.BulkPayments.GetAccountBulkPayments(ctx, acc.ID)
+	if err != nil {
+		return err
+	}
+	if len(listed) != 1 || listed[0].ID != created.ID || listed[0].Lines != nil {
+		c.errorf("GetAccountBulkPayments = %+v, want payment %d without lines", listed, created.ID)
+	}
+
+	now := time.Now()
+	claimed, err := repos.BulkPayments.ClaimPendingBulkPayments(ctx, now, now.Add(time.Minute), 1000)
+	if err != nil {
+		return err
+	}
+	var found *bulkpayment.BulkPayment
+	for i := range claimed {
+		if claimed[i].ID == created.ID {
+			found = &claimed[i]
+		}
+	}
+	if found == nil || found.Status != bulkpayment.StatusProcessing || len(found.Lines) != 2 {
+		c.errorf("ClaimPendingBulkPayments did not claim payment %d with its lines", created.ID)
+	}
+	again, err := repos.BulkPayments.ClaimPendingBulkPayments(ctx, now, now.Add(time.Minute), 1000)
+	if err != nil {
+		return err
+	}
+	for _, payment := range again {
+		if payment.ID == created.ID {
+			c.errorf("ClaimPendingBulkPayments claimed payment %d twice", created.ID)
+		}
+	}
+
+	line := created.Lines[0]
+	line.Status = bulkpayment.LineSucceeded
+	line.TransactionID = pgtype.Int8{Int64: 1, Valid: true}
+	line.ExecutedAt = pgtype.Timestamptz{Time: now, Valid: true}
+	if err := repos.BulkPayments.RecordLines(ctx, []bulkpayment.Line{line}); err != nil {
+		return err
+	}
+
+	created.Status = bulkpayment.StatusCompleted
+	created.SucceededCount = 1
+	finished, err := repos.BulkPayments.FinishBulkPayment(ctx, created)
+	if err != nil {
+		return err
+	}
+	if finished.Status != bulkpayment.StatusCompleted || finished.SucceededCount != 1 || !finished.CompletedAt.Valid ||
+		finished.Lines[0].Status != bulkpayment.LineSucceeded || !finished.Lines[0].ExecutedAt.Valid {
+		c.errorf("FinishBulkPayment returned %+v", finished)
+	}
+
+	later := now.Add(time.Hour)
+	claimed, err = repos.BulkPayments.ClaimPendingBulkPayments(ctx, later, later.Add(time.Minute), 1000)
+	if err != nil {
+		return err
+	}
+	for _, payment := range claimed {
+		if payment.ID == created.ID {
+			c.errorf("ClaimPendingBulkPayments claimed finished payment %d", created.ID)
+		}
+	}
+
+	if repos.Risk == nil {
+		return nil
+	}
+	decisionID, err := newReviewDecision(ctx, repos, acc)
+	if err != nil {
+		return err
+	}
+	line = finished.Lines[0]
+	line.Status = bulkpayment.LineHeld
+	line.TransactionID = pgtype.Int8{}
+	line.DecisionID = pgtype.Int8{Int64: decisionID, Valid: true}
+	if err := repos.BulkPayments.RecordLines(ctx, []bulkpayment.Line{line}); err != nil {
+		return err
+	}
+	line.Status = bulkpayment.LineFailed
+	line.Error = "rejected in review"
+	if paymentID, err := repos.BulkPayments.SettleLine(ctx, decisionID, line); err != nil || paymentID != created.ID {
+		c.errorf("SettleLine = %d, %v, want payment %d", paymentID, err, created.ID)
+	}
+	if _, err := repos.BulkPayments.SettleLine(ctx, decisionID, line); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("SettleLine of a settled line = %v, want pgx.ErrNoRows", err)
+	}
+	settled, err := repos.BulkPayments.GetBulkPayment(ctx, created.ID)
+	if err != nil {
+		return err
+	}
+	if got := settled.Lines[0]; got.Status != bulkpayment.LineFailed || got.Error != "rejected in review" ||
+		got.DecisionID.Int64 != decisionID || got.TransactionID.Valid {
+		c.errorf("line after SettleLine = %+v", got)
+	}
+
+	return nil
+}
+
+func checkTOTP(ctx context.Context, c *checker, repos Repositories) error {
+	owner, err := repos.Users.CreateUser(ctx, "conformance", randomEmail(), "hash")
+	if err != nil {
+		return err
+	}
+
+	if _, err := repos.Users.GetUserTOTP(ctx, owner.ID); err == nil {
+		c.errorf("GetUserTOTP found an enrolment before UpsertUserTOTP")
+	}
+
+	if err := repos.Users.UpsertUserTOTP(ctx, owner.ID, []byte("secret"), []string{"a", "b"}); err != nil {
+		return err
+	}
+	if err := repos.Users.ConfirmUserTOTP(ctx, owner.ID, 10); err != nil {
+		return err
+	}
+	if err := repos.Users.ConfirmUserTOTP(ctx, owner.ID, 11); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("ConfirmUserTOTP of a confirmed enrolment: err = %v, want pgx.ErrNoRows", err)
+	}
+	for _, step := range []int64{5, 10} {
+		if err := repos.Users.UseTOTPStep(ctx, owner.ID, step); !errors.Is(err, pgx.ErrNoRows) {
+			c.errorf("UseTOTPStep(%d) after step 10: err = %v, want pgx.ErrNoRows", step, err)
+		}
+	}
+	if err := repos.Users.UseTOTPStep(ctx, owner.ID, 12); err != nil {
+		return err
+	}
+	if err := repos.Users.UseRecoveryCode(ctx, owner.ID, "a"); err != nil {
+		return err
+	}
+	if err := repos.Users.UseRecoveryCode(ctx, owner.ID, "a"); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("UseRecoveryCode of a used code: err = %v, want pgx.ErrNoRows", err)
+	}
+
+	totp, err := repos.Users.GetUserTOTP(ctx, owner.ID)
+	if err != nil {
+		return err
+	}
+	if string(totp.Secret) != "secret" || !totp.Confirmed || totp.LastStep != 12 ||
+		len(totp.RecoveryCodes) != 1 || totp.RecoveryCodes[0] != "b" {
+		c.errorf("GetUserTOTP = %+v", totp)
+	}
+
+	if err := repos.Users.DeleteUserTOTP(ctx, owner.ID); err != nil {
+		return err
+	}
+	if _, err := repos.Users.GetUserTOTP(ctx, owner.ID); err == nil {
+		c.errorf("GetUserTOTP found an enrolment after DeleteUserTOTP")
+	}
+
+	return nil
+}
+
+type testAccount struct {
+	ID       int64
+	IDNumber string
+}
+
+func newAccount(ctx context.Context, repos Repositories) (testAccount, error) {
+	return newAccountIn(ctx, repos, account.DefaultCurrencyCode)
+}
+
+func newAccountIn(ctx context.Context, repos Repositories, currencyCode string) (testAccount, error) {
+	owner, err := repos.Users.CreateUser(ctx, "conformance", randomEmail(), "hash")
+	if err != nil {
+		return testAccount{}, err
+	}
+	acc, err := repos.Accounts.CreateAccount(ctx, owner.ID, currencyCode)
+	if err != nil {
+		return testAccount{}, err
+	}
+	return testAccount{ID: acc.ID, IDNumber: acc.IDNumber}, nil
+}
+
+func expectBalance(ctx context.Context, c *checker, repos Repositories, idNumber string, want float64) {
+	acc, err := repos.Accounts.GetAccountByIDNumber(ctx, idNumber)
+	if err != nil {
+		c.errorf("GetAccountByIDNumber(%s): %v", idNumber, err)
+		return
+	}
+	if acc.Balance != want {
+		c.errorf("account %s has balance %v, want %v", idNumber, acc.Balance, want)
+	}
+}
+
+// checkAudit is skipped when Repositories has no Audit.
+func checkAudit(ctx context.Context, c *checker, repos Repositories) error {
+	if repos.Audit == nil {
+		return nil
+	}
+
+	created, err := repos.Users.CreateUser(ctx, "conformance", randomEmail(), "hash")
+	if err != nil {
+		return err
+	}
+
+	requestID := randomQuoteID()
+	metadata := utils.AuditMetadata{Actor: "repotest", Action: "update user", RequestID: requestID, ClientIP: "192.0.2.1"}
+	if err := repos.Users.UpdateUser(utils.WithAuditMetadata(ctx, metadata), created.ID, "audited", created.Email, "hash2"); err != nil {
+		return err
+	}
+
+	entries, err := repos.Audit.GetEntries(ctx, audit.Filter{RequestID: requestID, Limit: 10})
+	if err != nil {
+		return err
+	}
+	if len(entries) != 1 {
+		return fmt.Errorf("GetEntries by request id returned %d entries, want the update", len(entries))
+	}
+	entry := entries[0]
+	if entry.Actor != metadata.Actor || entry.Action != metadata.Action || entry.ClientIP != metadata.ClientIP ||
+		entry.Operation != audit.OperationUpdate || entry.TargetTable != "BK_User" || entry.TargetID != fmt.Sprint(created.ID) {
+		c.errorf("update entry = %+v, want the metadata of its context", entry)
+	}
+
+	var before, after map[string]any
+	if err := json.Unmarshal(entry.Before, &before); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(entry.After, &after); err != nil {
+		return err
+	}
+	if len(after) != 2 || after["username"] != "audited" || after["password"] != "[redacted]" || before["username"] != "conformance" {
+		c.errorf("update entry holds %v -> %v, want only the changed username and a redacted password", before, after)
+	}
+
+	service := audit.NewAuditService(repos.Audit, 0)
+	if _, err := service.Seal(ctx); err != nil {
+		return err
+	}
+	entries, err = repos.Audit.GetEntries(ctx, audit.Filter{RequestID: requestID, Limit: 10})
+	if err != nil {
+		return err
+	}
+	if len(entries) != 1 || !entries[0].Seq.Valid || len(entries[0].Hash) == 0 {
+		c.errorf("Seal did not seal the entry of a committed change")
+	}
+
+	verification, err := service.Verify(ctx)
+	if err != nil {
+		return err
+	}
+	if !verification.Valid {
+		c.errorf("Verify = %+v after Seal", verification)
+	}
+
+	return nil
+}
+
+// checkOutbox is skipped when Repositories has no Outbox. It publishes every
+// pending event, including those of other tests.
+func checkOutbox(ctx context.Context, c *checker, repos Repositories) error {
+	if repos.Outbox == nil {
+		return nil
+	}
+
+	acc, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	to, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	if _, _, err := repos.Accounts.DepositToAccount(ctx, acc.ID, 100, "outbox deposit"); err != nil {
+		return err
+	}
+	txID, _, err := repos.Accounts.TransferBetweenAccounts(ctx, acc.ID, to.ID, 30, "outbox transfer")
+	if err != nil {
+		return err
+	}
+	if err := repos.Accounts.UpdateAccountStatus(ctx, to.IDNumber, account.StatusFrozen); err != nil {
+		return err
+	}
+
+	failed := errors.New("publish failed")
+	if _, err := repos.Outbox.PublishPending(ctx, 1000, func(ctx context.Context, events []outbox.Event) error {
+		return failed
+	}); !errors.Is(err, failed) {
+		c.errorf("PublishPending = %v, want the error of publish", err)
+	}
+
+	var events []outbox.Event
+	for {
+		n, err := repos.Outbox.PublishPending(ctx, 1000, func(ctx context.Context, published []outbox.Event) error {
+			for _, event := range published {
+				if event.AccountID == acc.ID || event.AccountID == to.ID {
+					events = append(events, event)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+		if event.ID == "" || event.Version != outbox.SchemaVersion || event.OccurredAt.IsZero() {
+			c.errorf("event %+v has no id, version or time", event)
+		}
+	}
+	want := []string{outbox.EventDepositCompleted, outbox.EventTransferCompleted, outbox.EventStatusChanged}
+	if fmt.Sprint(types) != fmt.Sprint(want) {
+		return fmt.Errorf("published events %v after the publish failed, want %v", types, want)
+	}
+
+	var transfer outbox.TransactionData
+	if err := json.Unmarshal(events[1].Data, &transfer); err != nil {
+		return err
+	}
+	if transfer.TransactionID != txID || transfer.AccountNumber != acc.IDNumber || transfer.Amount != 30 || transfer.BalanceAfter != 70 ||
+		transfer.ToAccountNumber == nil || *transfer.ToAccountNumber != to.IDNumber ||
+		transfer.CreditedAmount == nil || *transfer.CreditedAmount != 30 {
+		c.errorf("transfer event data = %s", events[1].Data)
+	}
+
+	var status outbox.StatusChangedData
+	if err := json.Unmarshal(events[2].Data, &status); err != nil {
+		return err
+	}
+	if status.AccountID != to.ID || status.OldStatus != account.StatusActive || status.NewStatus != account.StatusFrozen {
+		c.errorf("status event data = %s", events[2].Data)
+	}
+
+	return nil
+}
+
+// checkWebhooks is skipped when Repositories has no Webhooks.
+func checkWebhooks(ctx context.Context, c *checker, repos Repositories) error {
+	if repos.Webhooks == nil {
+		return nil
+	}
+
+	owner, err := repos.Users.CreateUser(ctx, "conformance", randomEmail(), "hash")
+	if err != nil {
+		return err
+	}
+	acc, err := repos.Accounts.CreateAccount(ctx, owner.ID, account.DefaultCurrencyCode)
+	if err != nil {
+		return err
+	}
+	other, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+
+	hook, err := repos.Webhooks.CreateWebhook(ctx, webhook.Webhook{
+		UserID:     pgtype.Int8{Int64: owner.ID, Valid: true},
+		URL:        "https://example.com/hook",
+		EventTypes: []string{outbox.EventDepositCompleted},
+		Secret:     "whsec_conformance",
+		Active:     true,
+	})
+	if err != nil {
+		return err
+	}
+	if hook.ID == 0 || hook.Partner != "" || hook.Secret != "whsec_conformance" || !hook.Active {
+		c.errorf("CreateWebhook = %+v", hook)
+	}
+
+	deposit := webhook.Notification{
+		EventID:    randomUUID(),
+		EventType:  outbox.EventDepositCompleted,
+		AccountIDs: []int64{acc.ID},
+		Payload:    []byte(`{"type":"deposit.completed"}`),
+	}
+	notifications := []webhook.Notification{
+		deposit,
+		// Not a type the webhook receives.
+		{EventID: randomUUID(), EventType: outbox.EventWithdrawalCompleted, AccountIDs: []int64{acc.ID}, Payload: []byte(`{}`)},
+		// Not an account of the owner.
+		{EventID: randomUUID(), EventType: outbox.EventDepositCompleted, AccountIDs: []int64{other.ID}, Payload: []byte(`{}`)},
+	}
+	for range 2 {
+		if _, err := repos.Webhooks.EnqueueNotifications(ctx, notifications); err != nil {
+			return err
+		}
+	}
+
+	deliveries, err := repos.Webhooks.GetDeliveries(ctx, hook.ID, "", 0, 10)
+	if err != nil {
+		return err
+	}
+	if len(deliveries) != 1 || deliveries[0].EventID != deposit.EventID || deliveries[0].Status != webhook.StatusPending ||
+		deliveries[0].Attempts != 0 || string(deliveries[0].Payload) != string(deposit.Payload) {
+		return fmt.Errorf("deliveries after enqueueing twice = %+v, want one pending deposit", deliveries)
+	}
+	delivery := deliveries[0]
+
+	claim := func() (*webhook.Delivery, error) {
+		now := time.Now().Add(time.Second)
+		claimed, err := repos.Webhooks.ClaimDueDeliveries(ctx, now, now.Add(time.Minute), 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range claimed {
+			if d.ID == delivery.ID {
+				return &d, nil
+			}
+		}
+		return nil, nil
+	}
+
+	claimed, err := claim()
+	if err != nil {
+		return err
+	}
+	if claimed == nil {
+		return fmt.Errorf("ClaimDueDeliveries did not return the pending delivery")
+	}
+	if again, err := claim(); err != nil {
+		return err
+	} else if again != nil {
+		c.errorf("ClaimDueDeliveries returned a claimed delivery")
+	}
+
+	claimed.Attempts = 1
+	claimed.NextAttemptAt = time.Now().Add(time.Hour)
+	if err := repos.Webhooks.RecordAttempt(ctx, *claimed, webhook.Attempt{
+		Attempt: 1, StatusCode: 500, Error: "unexpected status 500", DurationMS: 12, AttemptedAt: time.Now(),
+	}); err != nil {
+		return err
+	}
+	if again, err := claim(); err != nil {
+		return err
+	} else if again != nil {
+		c.errorf("ClaimDueDeliveries returned a delivery before its next attempt")
+	}
+
+	replayed, err := repos.Webhooks.ReplayDelivery(ctx, delivery.ID)
+	if err != nil {
+		return err
+	}
+	if replayed.Status != webhook.StatusPending || replayed.Attempts != 0 {
+		c.errorf("ReplayDelivery = %+v, want pending with no attempts", replayed)
+	}
+	claimed, err = claim()
+	if err != nil {
+		return err
+	}
+	if claimed == nil {
+		return fmt.Errorf("ClaimDueDeliveries did not return the replayed delivery")
+	}
+	claimed.Status = webhook.StatusDelivered
+	claimed.Attempts = 1
+	claimed.DeliveredAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	if err := repos.Webhooks.RecordAttempt(ctx, *claimed, webhook.Attempt{
+		Attempt: 1, StatusCode: 204, DurationMS: 3, AttemptedAt: time.Now(),
+	}); err != nil {
+		return err
+	}
+
+	got, err := repos.Webhooks.GetDelivery(ctx, delivery.ID)
+	if err != nil {
+		return err
+	}
+	if got.Status != webhook.StatusDelivered || !got.DeliveredAt.Valid || len(got.Log) != 2 ||
+		got.Log[0].StatusCode != 500 || got.Log[0].Error == "" || got.Log[1].StatusCode != 204 {
+		c.errorf("GetDelivery = %+v, want delivered after a failed attempt", got)
+	}
+	if pending, err := repos.Webhooks.GetDeliveries(ctx, hook.ID, webhook.StatusPending, 0, 10); err != nil {
+		return err
+	} else if len(pending) != 0 {
+		c.errorf("GetDeliveries(PENDING) = %+v, want none", pending)
+	}
+
+	if err := repos.Webhooks.DeleteWebhook(ctx, hook.ID); err != nil {
+		return err
+	}
+	if _, err := repos.Webhooks.GetDelivery(ctx, delivery.ID); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("GetDelivery after DeleteWebhook = %v, want pgx.ErrNoRows", err)
+	}
+
+	return nil
+}
+
+// checkStreams is skipped when Repositories has no Streams.
+func checkStreams(ctx context.Context, c *checker, repos Repositories) error {
+	if repos.Streams == nil {
+		return nil
+	}
+
+	acc, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	other, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	depositID, _, err := repos.Accounts.DepositToAccount(ctx, acc.ID, 100, "stream deposit")
+	if err != nil {
+		return err
+	}
+	if _, _, err := repos.Accounts.DepositToAccount(ctx, other.ID, 50, "not streamed"); err != nil {
+		return err
+	}
+	inID, _, err := repos.Accounts.TransferBetweenAccounts(ctx, other.ID, acc.ID, 20, "stream transfer")
+	if err != nil {
+		return err
+	}
+	outID, _, err := repos.Accounts.WithdrawFromAccount(ctx, acc.ID, 5, "stream withdraw")
+	if err != nil {
+		return err
+	}
+
+	transactions, err := repos.Streams.GetTransactionsAfter(ctx, []int64{acc.ID}, 0, 10)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for _, tx := range transactions {
+		ids = append(ids, tx.TransactionID)
+	}
+	if want := []int64{depositID, inID, outID}; fmt.Sprint(ids) != fmt.Sprint(want) {
+		return fmt.Errorf("GetTransactionsAfter = %v, want %v", ids, want)
+	}
+	in := transactions[1]
+	if in.AccountID != other.ID || in.AccountNumber != other.IDNumber || in.Amount != 20 || in.BalanceAfter != 30 ||
+		in.ToAccountID == nil || *in.ToAccountID != acc.ID || in.ToAccountNumber == nil || *in.ToAccountNumber != acc.IDNumber ||
+		in.CreditedAmount == nil || *in.CreditedAmount != 20 || in.Detail != "stream transfer" {
+		c.errorf("incoming transfer = %+v", in)
+	}
+	if out := transactions[2]; out.TxType != "WITHDRAW" || out.BalanceAfter != 115 || out.ToAccountID != nil {
+		c.errorf("withdrawal = %+v", out)
+	}
+
+	after, err := repos.Streams.GetTransactionsAfter(ctx, []int64{acc.ID}, depositID, 1)
+	if err != nil {
+		return err
+	}
+	if len(after) != 1 || after[0].TransactionID != inID {
+		c.errorf("GetTransactionsAfter(%d, limit 1) = %+v, want transaction %d", depositID, after, inID)
+	}
+
+	return nil
+}
+
+func checkRisk(ctx context.Context, c *checker, repos Repositories) error {
+	if repos.Risk == nil {
+		return nil
+	}
+
+	acc, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	other, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	owner, err := repos.Accounts.GetAccountByIDNumber(ctx, acc.IDNumber)
+	if err != nil {
+		return err
+	}
+	hourAgo := time.Now().Add(-time.Hour)
+
+	if last, err := repos.Risk.LastMovement(ctx, acc.ID); err != nil || !last.IsZero() {
+		c.errorf("LastMovement of a new account = %v, %v, want the zero time", last, err)
+	}
+	if _, _, err := repos.Accounts.DepositToAccount(ctx, acc.ID, 100, "risk deposit"); err != nil {
+		return err
+	}
+	if count, err := repos.Risk.CountMovements(ctx, acc.ID, hourAgo); err != nil || count != 0 {
+		c.errorf("CountMovements after a deposit = %d, %v, want 0", count, err)
+	}
+	if _, _, err := repos.Accounts.WithdrawFromAccount(ctx, acc.ID, 10, "risk withdraw"); err != nil {
+		return err
+	}
+	if _, _, err := repos.Accounts.TransferBetweenAccounts(ctx, acc.ID, other.ID, 5, "risk transfer"); err != nil {
+		return err
+	}
+
+	if count, err := repos.Risk.CountMovements(ctx, acc.ID, hourAgo); err != nil || count != 2 {
+		c.errorf("CountMovements = %d, %v, want 2", count, err)
+	}
+	if count, err := repos.Risk.CountMovements(ctx, acc.ID, time.Now().Add(time.Hour)); err != nil || count != 0 {
+		c.errorf("CountMovements since a future time = %d, %v, want 0", count, err)
+	}
+	if last, err := repos.Risk.LastMovement(ctx, acc.ID); err != nil || last.Before(hourAgo) {
+		c.errorf("LastMovement = %v, %v, want the time of the transfer", last, err)
+	}
+	if paid, err := repos.Risk.HasTransferred(ctx, acc.ID, other.IDNumber); err != nil || !paid {
+		c.errorf("HasTransferred to the recipient = %v, %v, want true", paid, err)
+	}
+	if paid, err := repos.Risk.HasTransferred(ctx, other.ID, acc.IDNumber); err != nil || paid {
+		c.errorf("HasTransferred the other way = %v, %v, want false", paid, err)
+	}
+
+	reasons := []risk.Reason{{Rule: "amount", Outcome: risk.OutcomeReview, Reason: "amount 50.00 USD is above 40.00"}}
+	decision, err := repos.Risk.CreateDecision(ctx, risk.Decision{
+		UserID:          owner.UserID,
+		AccountID:       acc.ID,
+		MovementType:    account.MovementTransfer,
+		Amount:          50,
+		Detail:          "risk review",
+		ToAccountNumber: other.IDNumber,
+		ClientIP:        "203.0.113.7",
+		Network:         "203.0.113.0/24",
+		Outcome:         risk.OutcomeReview,
+		Reasons:         reasons,
+	})
+	if err != nil {
+		return err
+	}
+	if decision.AccountNumber != acc.IDNumber || decision.CurrencyCode != account.DefaultCurrencyCode ||
+		decision.ToAccountID.Int64 != other.ID || decision.ToAccountNumber != other.IDNumber ||
+		decision.Amount != 50 || decision.Outcome != risk.OutcomeReview || decision.ReviewStatus != "" ||
+		fmt.Sprint(decision.Reasons) != fmt.Sprint(reasons) {
+		c.errorf("CreateDecision returned %+v", decision)
+	}
+	// Currencies with three minor units, such as KWD, keep every decimal.
+	fils, err := repos.Risk.CreateDecision(ctx, risk.Decision{
+		UserID:       owner.UserID,
+		AccountID:    acc.ID,
+		MovementType: account.MovementWithdrawal,
+		Amount:       12.345,
+		Outcome:      risk.OutcomeAllow,
+		Reasons:      []risk.Reason{},
+	})
+	if err != nil {
+		return err
+	}
+	if got, err := repos.Risk.GetDecision(ctx, fils.ID); err != nil || fils.Amount != 12.345 || got.Amount != 12.345 {
+		c.errorf("decision of 12.345 stored as %v and read as %v, %v", fils.Amount, got.Amount, err)
+	}
+
+	if networks, err := repos.Risk.GetNetworks(ctx, owner.UserID, hourAgo); err != nil || fmt.Sprint(networks) != "[203.0.113.0/24]" {
+		c.errorf("GetNetworks = %v, %v, want [203.0.113.0/24]", networks, err)
+	}
+
+	hold, err := repos.Accounts.PlaceHold(ctx, acc.ID, 50, "risk review", time.Now().Add(time.Hour))
+	if err != nil {
+		return err
+	}
+	if err := repos.Risk.HoldForReview(ctx, decision.ID, hold.ID); err != nil {
+		return err
+	}
+	if err := repos.Risk.HoldForReview(ctx, decision.ID+1_000_000, hold.ID); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("HoldForReview of an unknown decision = %v, want pgx.ErrNoRows", err)
+	}
+	pending, err := repos.Risk.GetDecisions(ctx, risk.Filter{AccountNumber: acc.IDNumber, ReviewStatus: risk.ReviewPending, Limit: 10})
+	if err != nil {
+		return err
+	}
+	if len(pending) != 1 || pending[0].ID != decision.ID || pending[0].HoldID.Int64 != hold.ID {
+		c.errorf("GetDecisions pending review = %+v, want decision %d with hold %d", pending, decision.ID, hold.ID)
+	}
+
+	decision.ReviewStatus = risk.ReviewRejected
+	decision.ReviewedBy = "conformance"
+	decision.ReviewNote = "not the customer"
+	reviewed, err := repos.Risk.ReviewDecision(ctx, decision)
+	if err != nil {
+		return err
+	}
+	if reviewed.ReviewStatus != risk.ReviewRejected || reviewed.ReviewedBy != "conformance" ||
+		reviewed.ReviewNote != "not the customer" || !reviewed.ReviewedAt.Valid || reviewed.TransactionID.Valid {
+		c.errorf("ReviewDecision returned %+v", reviewed)
+	}
+	if _, err := repos.Risk.ReviewDecision(ctx, decision); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("ReviewDecision of a reviewed decision = %v, want pgx.ErrNoRows", err)
+	}
+	if pending, err := repos.Risk.GetDecisions(ctx, risk.Filter{AccountNumber: acc.IDNumber, ReviewStatus: risk.ReviewPending, Limit: 10}); err != nil || len(pending) != 0 {
+		c.errorf("GetDecisions pending review after the review = %+v, %v, want none", pending, err)
+	}
+	if _, err := repos.Risk.GetDecision(ctx, decision.ID+1_000_000); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("GetDecision of an unknown decision = %v, want pgx.ErrNoRows", err)
+	}
+
+	cancelledID, err := newReviewDecision(ctx, repos, acc)
+	if err != nil {
+		return err
+	}
+	cancelled, err := repos.Risk.ReviewDecision(ctx, risk.Decision{ID: cancelledID, ReviewStatus: risk.ReviewCancelled})
+	if err != nil {
+		return err
+	}
+	if cancelled.ReviewStatus != risk.ReviewCancelled || !cancelled.ReviewedAt.Valid {
+		c.errorf("ReviewDecision cancelling returned %+v", cancelled)
+	}
+	if listed, err := repos.Risk.GetDecisions(ctx, risk.Filter{AccountNumber: acc.IDNumber, ReviewStatus: risk.ReviewCancelled, Limit: 10}); err != nil ||
+		len(listed) != 1 || listed[0].ID != cancelledID {
+		c.errorf("GetDecisions cancelled = %+v, %v, want decision %d", listed, err, cancelledID)
+	}
+
+	return nil
+}
+
+// newReviewDecision stores a decision on a withdrawal from acc that is pending
+// review with a hold, and returns its id.
+func newReviewDecision(ctx context.Context, repos Repositories, acc testAccount) (int64, error) {
+	owner, err := repos.Accounts.GetAccountByIDNumber(ctx, acc.IDNumber)
+	if err != nil {
+		return 0, err
+	}
+	if _, _, err := repos.Accounts.DepositToAccount(ctx, acc.ID, 1, "review deposit"); err != nil {
+		return 0, err
+	}
+	decision, err := repos.Risk.CreateDecision(ctx, risk.Decision{
+		UserID:       owner.UserID,
+		AccountID:    acc.ID,
+		MovementType: account.MovementWithdrawal,
+		Amount:       1,
+		Outcome:      risk.OutcomeReview,
+		Reasons:      []risk.Reason{},
+	})
+	if err != nil {
+		return 0, err
+	}
+	hold, err := repos.Accounts.PlaceHold(ctx, acc.ID, 1, "review", time.Now().Add(time.Hour))
+	if err != nil {
+		return 0, err
+	}
+	return decision.ID, repos.Risk.HoldForReview(ctx, decision.ID, hold.ID)
+}
+
+// checkLimits assigns no default profile, which would limit the accounts
+// already in the database.
+func checkLimits(ctx context.Context, c *checker, repos Repositories) error {
+	if repos.Limits == nil {
+		return nil
+	}
+
+	acc, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	owner, err := repos.Accounts.GetAccountByIDNumber(ctx, acc.IDNumber)
+	if err != nil {
+		return err
+	}
+	sibling, err := repos.Accounts.CreateAccount(ctx, owner.UserID, account.DefaultCurrencyCode)
+	if err != nil {
+		return err
+	}
+	other, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+
+	amount := func(v float64) *float64 { return &v }
+	name := "conformance-" + randomQuoteID()
+	userProfile, err := repos.Limits.CreateProfile(ctx, limit.Profile{
+		Name: name,
+		Rules: []limit.Rule{
+			{PerTransaction: amount(60), Daily: amount(100)},
+			{TxType: transaction.TxType_DEPOSIT, PerTransaction: amount(1000)},
+			{CurrencyCode: "EUR", Monthly: amount(1)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer repos.Limits.DeleteProfile(ctx, userProfile.ID)
+	if len(userProfile.Rules) != 3 || userProfile.Rules[0].TxType != "" || *userProfile.Rules[0].Daily != 100 ||
+		userProfile.Rules[0].Monthly != nil || userProfile.Rules[2].CurrencyCode != "EUR" || userProfile.IsDefault {
+		c.errorf("CreateProfile returned %+v", userProfile)
+	}
+	if _, err := repos.Limits.CreateProfile(ctx, limit.Profile{Name: name}); !utils.IsBankSystemError(err, utils.ErrLimitProfileExists) {
+		c.errorf("CreateProfile with a taken name = %v, want ErrLimitProfileExists", err)
+	}
+	if _, err := repos.Limits.Assign(ctx, limit.Assignment{ProfileID: userProfile.ID + 1_000_000, UserID: owner.UserID}); !utils.IsBankSystemError(err, utils.ErrLimitProfileNotFound) {
+		c.errorf("Assign of an unknown profile = %v, want ErrLimitProfileNotFound", err)
+	}
+	assigned, err := repos.Limits.Assign(ctx, limit.Assignment{ProfileID: userProfile.ID, UserID: owner.UserID})
+	if err != nil {
+		return err
+	}
+	if assigned.ProfileID != userProfile.ID || assigned.ProfileName != name || assigned.UserID != owner.UserID || assigned.AccountID != 0 {
+		c.errorf("Assign to the user returned %+v", assigned)
+	}
+
+	if _, _, err := repos.Accounts.DepositToAccount(ctx, acc.ID, 2000, "limits deposit"); !utils.IsBankSystemError(err, utils.ErrLimitExceeded) {
+		c.errorf("deposit above the per-transaction limit = %v, want ErrLimitExceeded", err)
+	}
+	for _, id := range []int64{acc.ID, sibling.ID} {
+		if _, _, err := repos.Accounts.DepositToAccount(ctx, id, 500, "limits deposit"); err != nil {
+			return err
+		}
+	}
+	if _, _, err := repos.Accounts.WithdrawFromAccount(ctx, acc.ID, 70, "limits withdraw"); !utils.IsBankSystemError(err, utils.ErrLimitExceeded) {
+		c.errorf("withdrawal above the per-transaction limit = %v, want ErrLimitExceeded", err)
+	}
+	if _, _, err := repos.Accounts.WithdrawFromAccount(ctx, acc.ID, 50, "limits withdraw"); err != nil {
+		return err
+	}
+	// The daily limit of the user counts the withdrawal from the other account.
+	if _, _, err := repos.Accounts.TransferBetweenAccounts(ctx, sibling.ID, other.ID, 60, "limits transfer"); !utils.IsBankSystemError(err, utils.ErrLimitExceeded) {
+		c.errorf("transfer above what is left of the daily limit = %v, want ErrLimitExceeded", err)
+	}
+	if _, _, err := repos.Accounts.TransferBetweenAccounts(ctx, sibling.ID, other.ID, 50, "limits transfer"); err != nil {
+		return err
+	}
+	expectBalance(ctx, c, repos, acc.IDNumber, 450)
+	expectBalance(ctx, c, repos, sibling.IDNumber, 450)
+
+	remaining, err := repos.Limits.GetRemaining(ctx, acc.ID, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(remaining) != 2 || remaining[0].Scope != "USER" || remaining[0].DailyUsed != 100 ||
+		*remaining[0].DailyRemaining != 0 || *remaining[0].Available != 0 || remaining[0].MonthlyRemaining != nil ||
+		remaining[1].TxType != transaction.TxType_DEPOSIT || remaining[1].DailyUsed != 1000 || *remaining[1].Available != 1000 {
+		c.errorf("GetRemaining = %+v", remaining)
+	}
+
+	accountProfile, err := repos.Limits.CreateProfile(ctx, limit.Profile{
+		Name:  "conformance-" + randomQuoteID(),
+		Rules: []limit.Rule{{TxType: transaction.TxType_TRANSFER, PerTransaction: amount(10)}},
+	})
+	if err != nil {
+		return err
+	}
+	defer repos.Limits.DeleteProfile(ctx, accountProfile.ID)
+	if _, err := repos.Limits.Assign(ctx, limit.Assignment{ProfileID: accountProfile.ID, AccountID: other.ID}); err != nil {
+		return err
+	}
+	if got, err := repos.Limits.GetAssignment(ctx, limit.Assignment{AccountID: other.ID}); err != nil ||
+		got.ProfileID != accountProfile.ID || got.AccountNumber != other.IDNumber {
+		c.errorf("GetAssignment of the account = %+v, %v", got, err)
+	}
+	if _, _, err := repos.Accounts.TransferBatch(ctx, other.ID, []account.BatchTransfer{
+		{ToAccountID: acc.ID, Amount: 5},
+		{ToAccountID: acc.ID, Amount: 11},
+	}); !utils.IsBankSystemError(err, utils.ErrLimitExceeded) {
+		c.errorf("batch with a transfer above the limit of the account = %v, want ErrLimitExceeded", err)
+	}
+	expectBalance(ctx, c, repos, other.IDNumber, 50)
+	if _, _, err := repos.Accounts.TransferBatch(ctx, other.ID, []account.BatchTransfer{
+		{ToAccountID: acc.ID, Amount: 5},
+		{ToAccountID: acc.ID, Amount: 10},
+	}); err != nil {
+		return err
+	}
+	if _, _, err := repos.Accounts.WithdrawFromAccount(ctx, other.ID, 20, "limits withdraw"); err != nil {
+		c.errorf("withdrawal from an account limiting transfers: %v", err)
+	}
+
+	if err := repos.Limits.Unassign(ctx, limit.Assignment{UserID: owner.UserID}); err != nil {
+		return err
+	}
+	if _, _, err := repos.Accounts.WithdrawFromAccount(ctx, acc.ID, 70, "limits withdraw"); err != nil {
+		c.errorf("withdrawal after the profile was unassigned: %v", err)
+	}
+
+	userProfile.Rules = []limit.Rule{{TxType: transaction.TxType_WITHDRAW, Monthly: amount(5)}}
+	userProfile.IsDefault = false
+	updated, err := repos.Limits.UpdateProfile(ctx, userProfile)
+	if err != nil {
+		return err
+	}
+	if len(updated.Rules) != 1 || updated.Rules[0].TxType != transaction.TxType_WITHDRAW || *updated.Rules[0].Monthly != 5 {
+		c.errorf("UpdateProfile returned %+v", updated)
+	}
+	if _, err := repos.Limits.UpdateProfile(ctx, limit.Profile{ID: userProfile.ID + 1_000_000, Name: "missing"}); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("UpdateProfile of an unknown profile = %v, want pgx.ErrNoRows", err)
+	}
+
+	if err := repos.Limits.DeleteProfile(ctx, accountProfile.ID); err != nil {
+		return err
+	}
+	if _, err := repos.Limits.GetAssignment(ctx, limit.Assignment{AccountID: other.ID}); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("GetAssignment after the profile was deleted = %v, want pgx.ErrNoRows", err)
+	}
+	if _, err := repos.Limits.GetProfile(ctx, accountProfile.ID); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("GetProfile of a deleted profile = %v, want pgx.ErrNoRows", err)
+	}
+
+	return nil
+}
+
+// checkAML stores its report for a random day long past, so that it runs
+// beside the reports of a database that already holds data.
+func checkAML(ctx context.Context, c *checker, repos Repositories) error {
+	if repos.AML == nil {
+		return nil
+	}
+
+	acc, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	owner, err := repos.Accounts.GetAccountByIDNumber(ctx, acc.IDNumber)
+	if err != nil {
+		return err
+	}
+	sibling, err := repos.Accounts.CreateAccount(ctx, owner.UserID, account.DefaultCurrencyCode)
+	if err != nil {
+		return err
+	}
+	other, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	from := time.Now().Add(-time.Minute)
+
+	var ids []int64
+	for _, step := range []struct {
+		accountID int64
+		deposit   bool
+		amount    float64
+	}{
+		{acc.ID, true, 700},
+		{sibling.ID, true, 90},
+		{acc.ID, false, 150},
+	} {
+		move := repos.Accounts.WithdrawFromAccount
+		if step.deposit {
+			move = repos.Accounts.DepositToAccount
+		}
+		txID, _, err := move(ctx, step.accountID, step.amount, "aml")
+		if err != nil {
+			return err
+		}
+		ids = append(ids, txID)
+	}
+	if _, _, err := repos.Accounts.TransferBetweenAccounts(ctx, acc.ID, other.ID, 50, "aml transfer"); err != nil {
+		return err
+	}
+	to := time.Now().Add(time.Minute)
+
+	own := func(movements []aml.Movement) []aml.Movement {
+		var mine []aml.Movement
+		for _, movement := range movements {
+			if movement.UserID == owner.UserID {
+				mine = append(mine, movement)
+			}
+		}
+		return mine
+	}
+	movements, err := repos.AML.GetCashMovements(ctx, from, to, 0)
+	if err != nil {
+		return err
+	}
+	if mine := own(movements); len(mine) != 3 || mine[0].TransactionID != ids[0] ||
+		mine[0].TxType != transaction.TxType_DEPOSIT || mine[0].AccountNumber != acc.IDNumber ||
+		mine[1].AccountNumber != sibling.IDNumber || mine[1].Amount != 90 ||
+		mine[2].TxType != transaction.TxType_WITHDRAW || mine[2].CurrencyCode != account.DefaultCurrencyCode {
+		c.errorf("GetCashMovements = %+v, want the deposits and the withdrawal in order", mine)
+	}
+	if movements, err := repos.AML.GetCashMovements(ctx, from, to, 100); err != nil || len(own(movements)) != 2 {
+		c.errorf("GetCashMovements of at least 100 = %+v, %v, want 2", own(movements), err)
+	}
+	if movements, err := repos.AML.GetCashMovements(ctx, to, to.Add(time.Hour), 0); err != nil || len(own(movements)) != 0 {
+		c.errorf("GetCashMovements after the movements = %+v, %v, want none", own(movements), err)
+	}
+
+	b := make([]byte, 2)
+	rand.Read(b)
+	day := time.Date(1800, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(b[0])<<8|int(b[1]))
+	report := aml.Report{
+		PeriodStart:              day,
+		PeriodEnd:                day.AddDate(0, 0, 1),
+		Thresholds:               map[string]float64{account.DefaultCurrencyCode: 750},
+		UnscannedCurrencies:      []string{"JPY"},
+		StructuringMargin:        0.1,
+		StructuringCount:         3,
+		StructuringWindowSeconds: 7 * 24 * 3600,
+		Cases: []aml.Case{{
+			UserID:         owner.UserID,
+			Kind:           aml.KindLargeCash,
+			TxType:         transaction.TxType_DEPOSIT,
+			CurrencyCode:   account.DefaultCurrencyCode,
+			Total:          790,
+			TransactionIDs: ids[:2],
+			AccountNumbers: []string{acc.IDNumber, sibling.IDNumber},
+			PeriodStart:    day,
+			PeriodEnd:      day.AddDate(0, 0, 1),
+		}},
+	}
+	created, err := repos.AML.CreateReport(ctx, report)
+	if err != nil {
+		return err
+	}
+	if created.ID == 0 || !created.PeriodStart.Equal(day) || created.Thresholds[account.DefaultCurrencyCode] != 750 ||
+		fmt.Sprint(created.UnscannedCurrencies) != "[JPY]" || created.StructuringMargin != 0.1 || created.StructuringCount != 3 ||
+		created.StructuringWindowSeconds != 7*24*3600 || created.FilesWrittenAt.Valid || len(created.Cases) != 1 {
+		c.errorf("CreateReport returned %+v", created)
+		return nil
+	}
+	flagged := created.Cases[0]
+	if flagged.ReportID != created.ID || flagged.Status != aml.CaseOpen || flagged.Total != 790 ||
+		fmt.Sprint(flagged.TransactionIDs) != fmt.Sprint(ids[:2]) || len(flagged.AccountNumbers) != 2 ||
+		flagged.Resolution != "" || flagged.ClosedAt.Valid {
+		c.errorf("CreateReport stored the case %+v", flagged)
+	}
+	report.Cases = nil
+	if again, err := repos.AML.CreateReport(ctx, report); err != nil || again.ID != created.ID || len(again.Cases) != 1 {
+		c.errorf("CreateReport of the same period = %+v, %v, want the stored report", again, err)
+	}
+	if periods, err := repos.AML.GetReportPeriods(ctx, day); err != nil || len(periods) == 0 || !periods[0].Equal(day) {
+		c.errorf("GetReportPeriods = %v, %v, want %v first", periods, err, day)
+	}
+	if reports, err := repos.AML.GetReports(ctx, created.ID+1, 1); err != nil || len(reports) != 1 || reports[0].ID != created.ID {
+		c.errorf("GetReports before the next id = %+v, %v, want the report", reports, err)
+	}
+	if ids, err := repos.AML.GetReportsWithoutFiles(ctx); err != nil || !slices.Contains(ids, created.ID) {
+		c.errorf("GetReportsWithoutFiles = %v, %v, want the report among them", ids, err)
+	}
+	if err := repos.AML.SetFilesWritten(ctx, created.ID); err != nil {
+		return err
+	}
+	if ids, err := repos.AML.GetReportsWithoutFiles(ctx); err != nil || slices.Contains(ids, created.ID) {
+		c.errorf("GetReportsWithoutFiles after SetFilesWritten = %v, %v, want the report left out", ids, err)
+	}
+	if written, err := repos.AML.GetReport(ctx, created.ID); err != nil || !written.FilesWrittenAt.Valid {
+		c.errorf("GetReport after SetFilesWritten = %+v, %v, want files_written_at set", written, err)
+	}
+	if err := repos.AML.SetFilesWritten(ctx, created.ID+1_000_000); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("SetFilesWritten of an unknown report = %v, want pgx.ErrNoRows", err)
+	}
+	if cases, err := repos.AML.GetCases(ctx, aml.Filter{ReportID: created.ID, Limit: 10}); err != nil ||
+		len(cases) != 1 || cases[0].ID != flagged.ID {
+		c.errorf("GetCases of the report = %+v, %v, want the case", cases, err)
+	}
+	if cases, err := repos.AML.GetCases(ctx, aml.Filter{UserID: owner.UserID, Status: aml.CaseClosed, Limit: 10}); err != nil || len(cases) != 0 {
+		c.errorf("GetCases closed = %+v, %v, want none", cases, err)
+	}
+
+	note, err := repos.AML.AddNote(ctx, aml.Note{CaseID: flagged.ID, Author: "conformance", Note: "called the customer"})
+	if err != nil {
+		return err
+	}
+	if note.ID == 0 || note.CaseID != flagged.ID || note.Author != "conformance" {
+		c.errorf("AddNote returned %+v", note)
+	}
+	closed, err := repos.AML.CloseCase(ctx, aml.Case{ID: flagged.ID, Resolution: aml.ResolutionReported, ClosedBy: "conformance"})
+	if err != nil {
+		return err
+	}
+	if closed.Status != aml.CaseClosed || closed.Resolution != aml.ResolutionReported || closed.ClosedBy != "conformance" ||
+		!closed.ClosedAt.Valid || len(closed.Notes) != 1 || closed.Notes[0].Note != "called the customer" {
+		c.errorf("CloseCase returned %+v", closed)
+	}
+	if _, err := repos.AML.CloseCase(ctx, aml.Case{ID: flagged.ID, Resolution: aml.ResolutionDismissed}); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("CloseCase of a closed case = %v, want pgx.ErrNoRows", err)
+	}
+	if _, err := repos.AML.AddNote(ctx, aml.Note{CaseID: flagged.ID, Note: "late"}); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("AddNote to a closed case = %v, want pgx.ErrNoRows", err)
+	}
+	if _, err := repos.AML.GetCase(ctx, flagged.ID+1_000_000); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("GetCase of an unknown case = %v, want pgx.ErrNoRows", err)
+	}
+	if _, err := repos.AML.GetReport(ctx, created.ID+1_000_000); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("GetReport of an unknown report = %v, want pgx.ErrNoRows", err)
+	}
+
+	return nil
+}
+
+func checkScreening(ctx context.Context, c *checker, repos Repositories) error {
+	if repos.Screening == nil {
+		return nil
+	}
+
+	acc, err := newAccount(ctx, repos)
+	if err != nil {
+		return err
+	}
+	owner, err := repos.Accounts.GetAccountByIDNumber(ctx, acc.IDNumber)
+	if err != nil {
+		return err
+	}
+
+	hit := screening.Hit{
+		Name:        "conformance",
+		EntryID:     "conformance-entry",
+		EntryName:   "Conformance Entry",
+		MatchedName: "Conformance",
+		Program:     "TEST",
+		Score:       0.9,
+		Status:      screening.HitPending,
+	}
+	pending, err := repos.Screening.CreateHit(ctx, hit)
+	if err != nil {
+		return err
+	}
+	if pending.ID == 0 || pending.UserID.Valid || pending.Status != screening.HitPending || pending.Score != 0.9 ||
+		pending.ReviewedAt.Valid || pending.CreatedAt.IsZero() {
+		c.errorf("CreateHit returned %+v", pending)
+	}
+	if err := repos.Screening.AttachUser(ctx, pending.ID, owner.UserID); err != nil {
+		return err
+	}
+	if err := repos.Screening.AttachUser(ctx, pending.ID+1_000_000, owner.UserID); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("AttachUser of an unknown hit = %v, want pgx.ErrNoRows", err)
+	}
+
+	hit.UserID = pgtype.Int8{Int64: owner.UserID, Valid: true}
+	hit.Status = screening.HitBlocked
+	blocked, err := repos.Screening.CreateHit(ctx, hit)
+	if err != nil {
+		return err
+	}
+
+	if hits, err := repos.Screening.GetUserHits(ctx, owner.UserID); err != nil || len(hits) != 2 ||
+		hits[0].ID != pending.ID || hits[0].UserID.Int64 != owner.UserID || hits[1].ID != blocked.ID {
+		c.errorf("GetUserHits = %+v, %v, want the pending and the blocked hit", hits, err)
+	}
+	if hits, err := repos.Screening.GetHits(ctx, screening.Filter{UserID: owner.UserID, Status: screening.HitPending, Limit: 10}); err != nil ||
+		len(hits) != 1 || hits[0].ID != pending.ID {
+		c.errorf("GetHits pending = %+v, %v, want the pending hit", hits, err)
+	}
+	if hits, err := repos.Screening.GetHits(ctx, screening.Filter{UserID: owner.UserID, BeforeID: blocked.ID, Limit: 10}); err != nil ||
+		len(hits) != 1 || hits[0].ID != pending.ID {
+		c.errorf("GetHits before the blocked hit = %+v, %v, want the pending hit", hits, err)
+	}
+
+	reviewed, err := repos.Screening.ReviewHit(ctx, screening.Hit{
+		ID:         pending.ID,
+		Status:     screening.HitCleared,
+		ReviewedBy: "conformance",
+		ReviewNote: "another person",
+	})
+	if err != nil {
+		return err
+	}
+	if reviewed.Status != screening.HitCleared || reviewed.ReviewedBy != "conformance" ||
+		reviewed.ReviewNote != "another person" || !reviewed.ReviewedAt.Valid {
+		c.errorf("ReviewHit returned %+v", reviewed)
+	}
+	if got, err := repos.Screening.GetHit(ctx, pending.ID); err != nil || got.Status != screening.HitCleared {
+		c.errorf("GetHit after the review = %+v, %v, want it cleared", got, err)
+	}
+	if _, err := repos.Screening.ReviewHit(ctx, screening.Hit{ID: pending.ID, Status: screening.HitConfirmed}); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("ReviewHit of a reviewed hit = %v, want pgx.ErrNoRows", err)
+	}
+	if _, err := repos.Screening.ReviewHit(ctx, screening.Hit{ID: blocked.ID, Status: screening.HitCleared}); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("ReviewHit of a blocked hit = %v, want pgx.ErrNoRows", err)
+	}
+	if _, err := repos.Screening.GetHit(ctx, blocked.ID+1_000_000); !errors.Is(err, pgx.ErrNoRows) {
+		c.errorf("GetHit of an unknown hit = %v, want pgx.ErrNoRows", err)
+	}
+
+	return nil
+}
+
+func randomEmail() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "conformance-" + hex.EncodeToString(b) + "@example.com"
+}
+
+func randomUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func randomQuoteID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
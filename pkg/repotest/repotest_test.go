@@ -0,0 +1,49 @@
+package repotest_test
+
+import (
+	"bank_system/pkg/memstore"
+	"bank_system/pkg/repotest"
+	"bank_system/pkg/testenv"
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	repos := repotest.Memory(memstore.New())
+
+	if err := repotest.Run(ctx, repos); err != nil {
+		t.Error(err)
+	}
+	if err := repotest.Stress(ctx, repos, repotest.StressOptions{}); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestPostgres runs the suites against a fresh database on the server of
+// BANK_TEST_POSTGRES_URL.
+func TestPostgres(t *testing.T) {
+	if os.Getenv("BANK_TEST_POSTGRES_URL") == "" {
+		t.Skip("BANK_TEST_POSTGRES_URL not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	env, err := testenv.StartPostgres(ctx, log.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Close()
+
+	repos := repotest.Postgres(env.Pool)
+	if err := repotest.Run(ctx, repos); err != nil {
+		t.Error(err)
+	}
+	if err := repotest.Stress(ctx, repos, repotest.StressOptions{}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,172 @@
+package repotest
+
+import (
+	"bank_system/pkg/account"
+	"bank_system/pkg/transaction"
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// StressOptions sizes a Stress run. Zero fields take the defaults.
+type StressOptions struct {
+	Accounts       int     // shared accounts, default 4
+	Workers        int     // concurrent goroutines, default 16
+	Operations     int     // operations per worker, default 200
+	InitialBalance float64 // deposited into every account first, default 100
+}
+
+func (o StressOptions) withDefaults() StressOptions {
+	if o.Accounts < 2 {
+		o.Accounts = 4
+	}
+	if o.Workers <= 0 {
+		o.Workers = 16
+	}
+	if o.Operations <= 0 {
+		o.Operations = 200
+	}
+	if o.InitialBalance <= 0 {
+		o.InitialBalance = 100
+	}
+	return o
+}
+
+// Stress hammers a few shared accounts with deposits, withdrawals and
+// transfers from many goroutines through AccountService, which checks the
+// balance before calling the repository just like the withdraw cron job does.
+// Operations may fail, e.g. on insufficient balance or a serialization
+// failure, but afterwards:
+//   - money is conserved: the balances add up to what was deposited minus
+//     what was withdrawn successfully,
+//   - no balance is negative,
+//   - replaying the transactions of each account in id order reproduces every
+//     balance_after and the final balance.
+func Stress(ctx context.Context, repos Repositories, opts StressOptions) error {
+	opts = opts.withDefaults()
+	c := &checker{}
+	service := account.NewAccountService(repos.Accounts, nil, 0, nil, nil, nil, nil)
+
+	accounts := make([]testAccount, opts.Accounts)
+	for i := range accounts {
+		acc, err := newAccount(ctx, repos)
+		if err != nil {
+			return err
+		}
+		if _, _, err := service.Deposit(ctx, acc.ID, opts.InitialBalance, "stress seed"); err != nil {
+			return err
+		}
+		accounts[i] = acc
+	}
+
+	// Successful deposits minus withdrawals, in cents.
+	var net atomic.Int64
+	net.Add(cents(opts.InitialBalance) * int64(opts.Accounts))
+
+	var wg sync.WaitGroup
+	for range opts.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for range opts.Operations {
+				if ctx.Err() != nil {
+					return
+				}
+				from := accounts[rand.IntN(len(accounts))]
+				amount := float64(rand.IntN(2000)+1) / 100
+
+				switch rand.IntN(3) {
+				case 0:
+					if _, _, err := service.Deposit(ctx, from.ID, amount, "stress"); err == nil {
+						net.Add(cents(amount))
+					}
+				case 1:
+					if _, _, err := service.Withdraw(ctx, from.IDNumber, amount, "stress"); err == nil {
+						net.Add(-cents(amount))
+					}
+				default:
+					to := accounts[rand.IntN(len(accounts))]
+					if to.ID == from.ID {
+						continue
+					}
+					service.Transfer(ctx, from.IDNumber, to.IDNumber, amount, "stress")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var total int64
+	for _, acc := range accounts {
+		balance, err := checkLedger(ctx, c, repos, acc)
+		if err != nil {
+			return err
+		}
+		total += cents(balance)
+	}
+	if want := net.Load(); total != want {
+		c.errorf("money not conserved: balances add up to %.2f, want %.2f", float64(total)/100, float64(want)/100)
+	}
+
+	return errors.Join(c.errs...)
+}
+
+// checkLedger replays the transactions of acc and returns its balance.
+func checkLedger(ctx context.Context, c *checker, repos Repositories, acc testAccount) (float64, error) {
+	got, err := repos.Accounts.GetAccountByIDNumber(ctx, acc.IDNumber)
+	if err != nil {
+		return 0, err
+	}
+	if got.Balance < 0 {
+		c.errorf("account %s has a negative balance %.2f", acc.IDNumber, got.Balance)
+	}
+
+	transactions, err := repos.Accounts.GetAccountTransactionsByIDNumber(ctx, acc.IDNumber)
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(transactions, func(i, j int) bool { return transactions[i].ID < transactions[j].ID })
+
+	var running int64
+	for _, tx := range transactions {
+		outgoing := tx.AccountFrom == acc.ID
+		switch {
+		case tx.TxType == transaction.TxType_DEPOSIT:
+			running += cents(tx.Amount)
+		case tx.TxType == transaction.TxType_WITHDRAW,
+			tx.TxType == transaction.TxType_INTEREST,
+			tx.TxType == transaction.TxType_FEE,
+			tx.TxType == transaction.TxType_TRANSFER && outgoing:
+			running -= cents(tx.Amount)
+		case tx.TxType == transaction.TxType_TRANSFER:
+			running += cents(tx.Amount)
+		}
+
+		if running < 0 {
+			c.errorf("account %s went negative (%.2f) at transaction %d", acc.IDNumber, float64(running)/100, tx.ID)
+		}
+		// balance_after belongs to account_from, also for transfers.
+		if outgoing && cents(tx.BalanceAfter) != running {
+			c.errorf("account %s transaction %d has balance_after %.2f, want %.2f",
+				acc.IDNumber, tx.ID, tx.BalanceAfter, float64(running)/100)
+		}
+	}
+
+	if cents(got.Balance) != running {
+		c.errorf("account %s has balance %.2f, its transactions add up to %.2f",
+			acc.IDNumber, got.Balance, float64(running)/100)
+	}
+	return got.Balance, nil
+}
+
+func cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
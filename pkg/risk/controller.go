@@ -0,0 +1,181 @@
+package risk
+
+import (
+	"bank_system/utils"
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RiskController struct {
+	service *RiskService
+	logger  *log.Logger
+}
+
+func NewRiskController(service *RiskService, logger *log.Logger) *RiskController {
+	return &RiskController{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// GetDecisions filters by the user_id, account_number, outcome and
+// review_status query parameters and pages backwards with before_id and
+// limit.
+func (c *RiskController) GetDecisions(ctx *gin.Context) {
+	c.getDecisions(ctx, ctx.Query("review_status"))
+}
+
+// GetReviews is the review queue: the decisions pending review, filtered and
+// paged like GetDecisions.
+func (c *RiskController) GetReviews(ctx *gin.Context) {
+	c.getDecisions(ctx, ReviewPending)
+}
+
+func (c *RiskController) getDecisions(ctx *gin.Context, reviewStatus string) {
+	filter := Filter{
+		AccountNumber: ctx.Query("account_number"),
+		Outcome:       ctx.Query("outcome"),
+		ReviewStatus:  reviewStatus,
+	}
+
+	verr := &utils.ValidationError{}
+	var err error
+	if userID := ctx.Query("user_id"); userID != "" {
+		if filter.UserID, err = strconv.ParseInt(userID, 10, 64); err != nil {
+			verr.Add("user_id", "must be a user id")
+		}
+	}
+	if beforeID := ctx.Query("before_id"); beforeID != "" {
+		if filter.BeforeID, err = strconv.ParseInt(beforeID, 10, 64); err != nil {
+			verr.Add("before_id", "must be a decision id")
+		}
+	}
+	if limit := ctx.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			verr.Add("limit", "must be a number")
+		}
+	}
+	if err := verr.Err(); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	decisions, err := c.service.GetDecisions(reqCtx, filter)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, decisions)
+}
+
+func (c *RiskController) GetDecision(ctx *gin.Context) {
+	id, ok := decisionIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	decision, err := c.service.GetDecision(reqCtx, id)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, decision)
+}
+
+func (c *RiskController) Approve(ctx *gin.Context) {
+	c.review(ctx, c.service.Approve)
+}
+
+func (c *RiskController) Reject(ctx *gin.Context) {
+	c.review(ctx, c.service.Reject)
+}
+
+func (c *RiskController) review(ctx *gin.Context, review func(context.Context, int64, string) (Decision, error)) {
+	id, ok := decisionIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	type ReviewRequest struct {
+		Note string `json:"note"`
+	}
+
+	var req ReviewRequest
+	// The body is optional.
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+			return
+		}
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	decision, err := review(reqCtx, id, req.Note)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, decision)
+}
+
+func decisionIDParam(ctx *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Param("decision_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid decision id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func errorStatus(err error) int {
+	switch {
+	case utils.IsValidationError(err):
+		return http.StatusBadRequest
+	case utils.IsBankSystemError(err, utils.ErrRiskDecisionNotFound),
+		utils.IsBankSystemError(err, utils.ErrAccountNotFound),
+		utils.IsBankSystemError(err, utils.ErrHoldNotFound):
+		return http.StatusNotFound
+	case utils.IsBankSystemError(err, utils.ErrRiskDecisionNotPending),
+		utils.IsBankSystemError(err, utils.ErrHoldNotActive),
+		utils.IsBankSystemError(err, utils.ErrAccountNotActive):
+		return http.StatusConflict
+	case utils.IsBankSystemError(err, utils.ErrRateUnavailable):
+		return http.StatusServiceUnavailable
+	case utils.IsBankSystemError(err, utils.ErrInsufficientBalance),
+		utils.IsBankSystemError(err, utils.ErrLimitExceeded):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RegisterRoutes serves the risk decisions and the review queue behind the
+// admin middleware.
+func (c *RiskController) RegisterRoutes(router *gin.Engine, admin gin.HandlerFunc) {
+	group := router.Group("/admin/risk", admin)
+	{
+		group.GET("/decisions", c.GetDecisions)
+		group.GET("/decisions/:decision_id", c.GetDecision)
+		group.POST("/decisions/:decision_id/approve", c.Approve)
+		group.POST("/decisions/:decision_id/reject", c.Reject)
+		group.GET("/reviews", c.GetReviews)
+	}
+}
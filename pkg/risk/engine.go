@@ -0,0 +1,114 @@
+package risk
+
+import (
+	"bank_system/pkg/account"
+	"bank_system/utils"
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// DefaultReviewTTL is how long a movement to review stays held when no
+// review TTL is configured; an operator who misses it must ask for the
+// movement again.
+const DefaultReviewTTL = 3 * 24 * time.Hour
+
+// Engine is the account.RiskAssessor that runs rules. The strictest outcome
+// the rules ask for is the decision.
+type Engine struct {
+	repo      RiskRepository
+	rules     []Rule
+	reviewTTL time.Duration
+}
+
+// NewEngine creates an engine running rules. reviewTTL is how long movements
+// to review stay held, DefaultReviewTTL when 0 and at most
+// account.MaxHoldTTL.
+func NewEngine(repo RiskRepository, reviewTTL time.Duration, rules ...Rule) *Engine {
+	if reviewTTL <= 0 {
+		reviewTTL = DefaultReviewTTL
+	}
+	reviewTTL = min(reviewTTL, account.MaxHoldTTL)
+
+	return &Engine{
+		repo:      repo,
+		rules:     rules,
+		reviewTTL: reviewTTL,
+	}
+}
+
+// Rules returns the names of the rules the engine runs.
+func (e *Engine) Rules() []string {
+	names := make([]string, len(e.rules))
+	for i, rule := range e.rules {
+		names[i] = rule.Name()
+	}
+	return names
+}
+
+// Assess runs the rules over movement and records the decision. A rule that
+// fails fails the assessment, and so the movement.
+func (e *Engine) Assess(ctx context.Context, movement account.Movement) (account.RiskDecision, error) {
+	outcome, reasons := OutcomeAllow, []Reason{}
+	for _, rule := range e.rules {
+		ruleOutcome, reason, err := rule.Evaluate(ctx, movement, e.repo)
+		if err != nil {
+			return account.RiskDecision{}, err
+		}
+		if ruleOutcome == OutcomeAllow {
+			continue
+		}
+		reasons = append(reasons, Reason{Rule: rule.Name(), Outcome: ruleOutcome, Reason: reason})
+		if severity(ruleOutcome) > severity(outcome) {
+			outcome = ruleOutcome
+		}
+	}
+
+	decision, err := e.repo.CreateDecision(ctx, Decision{
+		UserID:          movement.UserID,
+		AccountID:       movement.AccountID,
+		MovementType:    movement.Type,
+		Amount:          movement.Amount,
+		Detail:          movement.Detail,
+		ToAccountNumber: movement.ToAccountNumber,
+		PayeeID:         pgtype.Int8{Int64: movement.PayeeID, Valid: movement.PayeeID != 0},
+		ClientIP:        movement.ClientIP,
+		Network:         Network(movement.ClientIP),
+		Outcome:         outcome,
+		Reasons:         reasons,
+	})
+	if err != nil {
+		return account.RiskDecision{}, err
+	}
+
+	messages := make([]string, len(reasons))
+	for i, reason := range reasons {
+		messages[i] = reason.Rule + ": " + reason.Reason
+	}
+	return account.RiskDecision{
+		ID:      decision.ID,
+		Outcome: outcome,
+		Reasons: messages,
+		HoldFor: e.reviewTTL,
+	}, nil
+}
+
+func (e *Engine) HoldForReview(ctx context.Context, decisionID, holdID int64) error {
+	return e.repo.HoldForReview(ctx, decisionID, holdID)
+}
+
+func (e *Engine) CancelReview(ctx context.Context, decisionID int64) error {
+	_, err := e.repo.ReviewDecision(ctx, Decision{
+		ID:           decisionID,
+		ReviewStatus: ReviewCancelled,
+		ReviewedBy:   utils.AuditMetadataFrom(ctx).Actor,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return utils.NewBankSystemError(utils.ErrRiskDecisionNotPending, strconv.FormatInt(decisionID, 10))
+	}
+	return err
+}
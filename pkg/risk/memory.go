@@ -0,0 +1,234 @@
+package risk
+
+import (
+	"bank_system/pkg/memstore"
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// memoryRiskRepository is a RiskRepository backed by a memstore.Store.
+type memoryRiskRepository struct {
+	store *memstore.Store
+}
+
+func NewMemoryRiskRepository(store *memstore.Store) RiskRepository {
+	return &memoryRiskRepository{store: store}
+}
+
+func (r *memoryRiskRepository) CountMovements(ctx context.Context, accountID int64, since time.Time) (int, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	var count int
+	for _, tx := range r.store.Transactions {
+		if isMovement(string(tx.TxType)) && tx.AccountFrom == accountID && !tx.CreatedAt.Time.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryRiskRepository) LastMovement(ctx context.Context, accountID int64) (time.Time, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	var last time.Time
+	for _, tx := range r.store.Transactions {
+		if isMovement(string(tx.TxType)) && tx.AccountFrom == accountID && tx.CreatedAt.Time.After(last) {
+			last = tx.CreatedAt.Time
+		}
+	}
+	return last, nil
+}
+
+func (r *memoryRiskRepository) HasTransferred(ctx context.Context, accountID int64, toIDNumber string) (bool, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	to, ok := r.store.AccountByIDNumber(toIDNumber)
+	if !ok {
+		return false, nil
+	}
+	for _, tx := range r.store.Transactions {
+		if tx.AccountFrom == accountID && tx.AccountTo.Valid && tx.AccountTo.Int64 == to.ID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryRiskRepository) GetNetworks(ctx context.Context, userID int64, since time.Time) ([]string, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	seen := map[string]bool{}
+	networks := []string{}
+	for _, record := range r.store.RiskDecisions {
+		if record.UserID == userID && !record.CreatedAt.Before(since) && record.Network != "" && !seen[record.Network] {
+			seen[record.Network] = true
+			networks = append(networks, record.Network)
+		}
+	}
+	return networks, nil
+}
+
+func (r *memoryRiskRepository) CreateDecision(ctx context.Context, decision Decision) (Decision, error) {
+	reasons, err := json.Marshal(decision.Reasons)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	if _, ok := r.store.Users[decision.UserID]; !ok {
+		return Decision{}, errors.New(`insert on "BK_Risk_Decision" violates a foreign key constraint to "BK_User"`)
+	}
+	if _, ok := r.store.Accounts[decision.AccountID]; !ok {
+		return Decision{}, errors.New(`insert on "BK_Risk_Decision" violates a foreign key constraint to "BK_Account"`)
+	}
+
+	now := time.Now()
+	record := &memstore.RiskDecisionRecord{
+		ID:           r.store.NextID("BK_Risk_Decision"),
+		UserID:       decision.UserID,
+		AccountID:    decision.AccountID,
+		MovementType: decision.MovementType,
+		Amount:       decision.Amount,
+		Detail:       decision.Detail,
+		PayeeID:      decision.PayeeID,
+		ClientIP:     decision.ClientIP,
+		Network:      decision.Network,
+		Outcome:      decision.Outcome,
+		Reasons:      reasons,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if to, ok := r.store.AccountByIDNumber(decision.ToAccountNumber); ok {
+		record.ToAccountID = pgtype.Int8{Int64: to.ID, Valid: true}
+	}
+	r.store.RiskDecisions[record.ID] = record
+	r.store.Audit(ctx, "BK_Risk_Decision", record.ID, nil, *record)
+
+	return r.toDecision(record)
+}
+
+func (r *memoryRiskRepository) GetDecision(ctx context.Context, id int64) (Decision, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.RiskDecisions[id]
+	if !ok {
+		return Decision{}, pgx.ErrNoRows
+	}
+	return r.toDecision(record)
+}
+
+func (r *memoryRiskRepository) GetDecisions(ctx context.Context, filter Filter) ([]Decision, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	decisions := []Decision{}
+	for _, record := range r.store.RiskDecisions {
+		decision, err := r.toDecision(record)
+		if err != nil {
+			return nil, err
+		}
+		if filter.UserID > 0 && decision.UserID != filter.UserID ||
+			filter.AccountNumber != "" && decision.AccountNumber != filter.AccountNumber ||
+			filter.Outcome != "" && decision.Outcome != filter.Outcome ||
+			filter.ReviewStatus != "" && decision.ReviewStatus != filter.ReviewStatus ||
+			filter.BeforeID > 0 && decision.ID >= filter.BeforeID {
+			continue
+		}
+		decisions = append(decisions, decision)
+	}
+	sort.Slice(decisions, func(i, j int) bool { return decisions[i].ID > decisions[j].ID })
+	if len(decisions) > filter.Limit {
+		decisions = decisions[:filter.Limit]
+	}
+	return decisions, nil
+}
+
+func (r *memoryRiskRepository) HoldForReview(ctx context.Context, id, holdID int64) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.RiskDecisions[id]
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	before := *record
+	record.HoldID = pgtype.Int8{Int64: holdID, Valid: true}
+	record.ReviewStatus = pgtype.Text{String: ReviewPending, Valid: true}
+	record.UpdatedAt = time.Now()
+	r.store.Audit(ctx, "BK_Risk_Decision", record.ID, before, *record)
+	return nil
+}
+
+func (r *memoryRiskRepository) ReviewDecision(ctx context.Context, decision Decision) (Decision, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.RiskDecisions[decision.ID]
+	if !ok || record.ReviewStatus.String != ReviewPending {
+		return Decision{}, pgx.ErrNoRows
+	}
+	before := *record
+	record.ReviewStatus = pgtype.Text{String: decision.ReviewStatus, Valid: true}
+	record.ReviewedBy = decision.ReviewedBy
+	record.ReviewNote = decision.ReviewNote
+	record.ReviewedAt = memstore.Now()
+	record.TransactionID = decision.TransactionID
+	record.UpdatedAt = time.Now()
+	r.store.Audit(ctx, "BK_Risk_Decision", record.ID, before, *record)
+	return r.toDecision(record)
+}
+
+// toDecision joins the accounts of record. The caller must hold Mu.
+func (r *memoryRiskRepository) toDecision(record *memstore.RiskDecisionRecord) (Decision, error) {
+	decision := Decision{
+		ID:            record.ID,
+		UserID:        record.UserID,
+		AccountID:     record.AccountID,
+		MovementType:  record.MovementType,
+		Amount:        record.Amount,
+		Detail:        record.Detail,
+		ToAccountID:   record.ToAccountID,
+		PayeeID:       record.PayeeID,
+		ClientIP:      record.ClientIP,
+		Network:       record.Network,
+		Outcome:       record.Outcome,
+		HoldID:        record.HoldID,
+		ReviewStatus:  record.ReviewStatus.String,
+		ReviewedBy:    record.ReviewedBy,
+		ReviewNote:    record.ReviewNote,
+		ReviewedAt:    record.ReviewedAt,
+		TransactionID: record.TransactionID,
+		CreatedAt:     record.CreatedAt,
+		UpdatedAt:     record.UpdatedAt,
+	}
+	if account, ok := r.store.Accounts[record.AccountID]; ok {
+		decision.AccountNumber = account.IDNumber
+		decision.CurrencyCode = account.CurrencyCode
+	}
+	if record.ToAccountID.Valid {
+		if to, ok := r.store.Accounts[record.ToAccountID.Int64]; ok {
+			decision.ToAccountNumber = to.IDNumber
+		}
+	}
+	if err := json.Unmarshal(record.Reasons, &decision.Reasons); err != nil {
+		return Decision{}, err
+	}
+	return decision, nil
+}
+
+func isMovement(txType string) bool {
+	return txType == "WITHDRAW" || txType == "TRANSFER"
+}
@@ -0,0 +1,294 @@
+// Package risk judges withdrawals and transfers before they are made. An
+// Engine runs configurable rules over a movement and its history and lets it
+// through, asks for a second factor, holds it for an operator to review or
+// blocks it, and records every decision.
+package risk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const decisionColumns = `d.id, d.user_id, d.account_id, a.id_number, a.currency_code, d.movement_type, d.amount, d.detail,
+	d.to_account_id, COALESCE(t.id_number, ''), d.payee_id, d.client_ip, d.network, d.outcome, d.reasons, d.hold_id,
+	COALESCE(d.review_status::TEXT, ''), d.reviewed_by, d.review_note, d.reviewed_at, d.transaction_id,
+	d.created_at, d.updated_at`
+
+const decisionTables = `"BK_Risk_Decision" d
+	JOIN "BK_Account" a ON a.id = d.account_id
+	LEFT JOIN "BK_Account" t ON t.id = d.to_account_id`
+
+// Reason is the objection of a rule to a movement.
+type Reason struct {
+	Rule    string `json:"rule"`
+	Outcome string `json:"outcome"`
+	Reason  string `json:"reason"`
+}
+
+// Decision is the judgement of a movement. ReviewStatus is empty unless the
+// movement was held for review, by HoldID.
+type Decision struct {
+	ID              int64              `json:"id"`
+	UserID          int64              `json:"user_id"`
+	AccountID       int64              `json:"account_id"`
+	AccountNumber   string             `json:"account_number"`
+	CurrencyCode    string             `json:"currency_code"`
+	MovementType    string             `json:"movement_type"`
+	Amount          float64            `json:"amount"`
+	Detail          string             `json:"detail"`
+	ToAccountID     pgtype.Int8        `json:"to_account_id"`
+	ToAccountNumber string             `json:"to_account_number,omitempty"`
+	PayeeID         pgtype.Int8        `json:"payee_id"`
+	ClientIP        string             `json:"client_ip"`
+	Network         string             `json:"network"`
+	Outcome         string             `json:"outcome"`
+	Reasons         []Reason           `json:"reasons"`
+	HoldID          pgtype.Int8        `json:"hold_id"`
+	ReviewStatus    string             `json:"review_status,omitempty"`
+	ReviewedBy      string             `json:"reviewed_by,omitempty"`
+	ReviewNote      string             `json:"review_note,omitempty"`
+	ReviewedAt      pgtype.Timestamptz `json:"reviewed_at"`
+	TransactionID   pgtype.Int8        `json:"transaction_id"`
+	CreatedAt       time.Time          `json:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at"`
+}
+
+type Filter struct {
+	UserID        int64
+	AccountNumber string
+	Outcome       string
+	ReviewStatus  string
+	BeforeID      int64
+	Limit         int
+}
+
+// History is what rules read of the past of an account and its owner.
+type History interface {
+	// CountMovements returns how many withdrawals and transfers were made
+	// from the account since then.
+	CountMovements(ctx context.Context, accountID int64, since time.Time) (int, error)
+	// LastMovement returns when the last withdrawal or transfer from the
+	// account was made, the zero time when none was.
+	LastMovement(ctx context.Context, accountID int64) (time.Time, error)
+	// HasTransferred reports whether the account ever transferred to the
+	// account toIDNumber.
+	HasTransferred(ctx context.Context, accountID int64, toIDNumber string) (bool, error)
+	// GetNetworks returns the networks the user's movements were decided
+	// from since then.
+	GetNetworks(ctx context.Context, userID int64, since time.Time) ([]string, error)
+}
+
+type RiskRepository interface {
+	History
+	// CreateDecision stores decision; its ToAccountID is looked up from
+	// ToAccountNumber.
+	CreateDecision(ctx context.Context, decision Decision) (Decision, error)
+	GetDecision(ctx context.Context, id int64) (Decision, error)
+	// GetDecisions returns up to filter.Limit decisions matching filter,
+	// newest first.
+	GetDecisions(ctx context.Context, filter Filter) ([]Decision, error)
+	// HoldForReview makes the decision pending review with the hold.
+	HoldForReview(ctx context.Context, id, holdID int64) error
+	// ReviewDecision stores the review status, reviewer, note and
+	// transaction of a decision pending review. It returns pgx.ErrNoRows
+	// when the decision is not pending.
+	ReviewDecision(ctx context.Context, decision Decision) (Decision, error)
+}
+
+type riskRepositoryImpl struct {
+	pool *pgxpool.Pool
+}
+
+func NewRiskRepository(pool *pgxpool.Pool) RiskRepository {
+	return &riskRepositoryImpl{pool: pool}
+}
+
+func (r *riskRepositoryImpl) CountMovements(ctx context.Context, accountID int64, since time.Time) (int, error) {
+	var count int
+	err := r.pool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM "BK_Transaction"
+		WHERE account_from = $1 AND tx_type IN ('WITHDRAW', 'TRANSFER') AND created_at >= $2`,
+		accountID, since,
+	).Scan(&count)
+	return count, err
+}
+
+func (r *riskRepositoryImpl) LastMovement(ctx context.Context, accountID int64) (time.Time, error) {
+	var last pgtype.Timestamptz
+	err := r.pool.QueryRow(ctx,
+		`SELECT MAX(created_at) FROM "BK_Transaction"
+		WHERE account_from = $1 AND tx_type IN ('WITHDRAW', 'TRANSFER')`,
+		accountID,
+	).Scan(&last)
+	return last.Time, err
+}
+
+func (r *riskRepositoryImpl) HasTransferred(ctx context.Context, accountID int64, toIDNumber string) (bool, error) {
+	var exists bool
+	err := r.pool.QueryRow(ctx,
+		`SELECT EXISTS (
+			SELECT 1 FROM "BK_Transaction" t
+			JOIN "BK_Account" a ON a.id = t.account_to
+			WHERE t.account_from = $1 AND a.id_number = $2
+		)`,
+		accountID, toIDNumber,
+	).Scan(&exists)
+	return exists, err
+}
+
+func (r *riskRepositoryImpl) GetNetworks(ctx context.Context, userID int64, since time.Time) ([]string, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT DISTINCT network FROM "BK_Risk_Decision"
+		WHERE user_id = $1 AND created_at >= $2 AND network <> ''`,
+		userID, since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func (r *riskRepositoryImpl) CreateDecision(ctx context.Context, decision Decision) (Decision, error) {
+	reasons, err := json.Marshal(decision.Reasons)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	var id int64
+	err = r.pool.QueryRow(ctx,
+		`INSERT INTO "BK_Risk_Decision" (
+			user_id, account_id, movement_type, amount, detail, to_account_id, payee_id,
+			client_ip, network, outcome, reasons
+		)
+		VALUES (
+			$1, $2, $3, $4, $5, (SELECT id FROM "BK_Account" WHERE id_number = NULLIF($6, '')), $7,
+			$8, $9, $10, $11
+		)
+		RETURNING id`,
+		decision.UserID, decision.AccountID, decision.MovementType, decision.Amount, decision.Detail,
+		decision.ToAccountNumber, decision.PayeeID, decision.ClientIP, decision.Network, decision.Outcome, reasons,
+	).Scan(&id)
+	if err != nil {
+		return Decision{}, err
+	}
+	return r.GetDecision(ctx, id)
+}
+
+func (r *riskRepositoryImpl) GetDecision(ctx context.Context, id int64) (Decision, error) {
+	return scanDecision(r.pool.QueryRow(ctx, `SELECT `+decisionColumns+` FROM `+decisionTables+` WHERE d.id = $1`, id))
+}
+
+func (r *riskRepositoryImpl) GetDecisions(ctx context.Context, filter Filter) ([]Decision, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if filter.UserID > 0 {
+		where("d.user_id = ?", filter.UserID)
+	}
+	if filter.AccountNumber != "" {
+		where("a.id_number = ?", filter.AccountNumber)
+	}
+	if filter.Outcome != "" {
+		where("d.outcome::TEXT = ?", filter.Outcome)
+	}
+	if filter.ReviewStatus != "" {
+		where("d.review_status::TEXT = ?", filter.ReviewStatus)
+	}
+	if filter.BeforeID > 0 {
+		where("d.id < ?", filter.BeforeID)
+	}
+
+	query := `SELECT ` + decisionColumns + ` FROM ` + decisionTables
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(` ORDER BY d.id DESC LIMIT $%d`, len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Decision, error) {
+		return scanDecision(row)
+	})
+}
+
+func (r *riskRepositoryImpl) HoldForReview(ctx context.Context, id, holdID int64) error {
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE "BK_Risk_Decision" SET hold_id = $2, review_status = 'PENDING' WHERE id = $1`,
+		id, holdID,
+	)
+	if err == nil && tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return err
+}
+
+func (r *riskRepositoryImpl) ReviewDecision(ctx context.Context, decision Decision) (Decision, error) {
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE "BK_Risk_Decision"
+		SET review_status = $2, reviewed_by = $3, review_note = $4, reviewed_at = NOW(), transaction_id = $5
+		WHERE id = $1 AND review_status = 'PENDING'`,
+		decision.ID, decision.ReviewStatus, decision.ReviewedBy, decision.ReviewNote, decision.TransactionID,
+	)
+	if err != nil {
+		return Decision{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return Decision{}, pgx.ErrNoRows
+	}
+	return r.GetDecision(ctx, decision.ID)
+}
+
+func scanDecision(row pgx.Row) (Decision, error) {
+	var (
+		decision Decision
+		reasons  []byte
+	)
+	err := row.Scan(
+		&decision.ID,
+		&decision.UserID,
+		&decision.AccountID,
+		&decision.AccountNumber,
+		&decision.CurrencyCode,
+		&decision.MovementType,
+		&decision.Amount,
+		&decision.Detail,
+		&decision.ToAccountID,
+		&decision.ToAccountNumber,
+		&decision.PayeeID,
+		&decision.ClientIP,
+		&decision.Network,
+		&decision.Outcome,
+		&reasons,
+		&decision.HoldID,
+		&decision.ReviewStatus,
+		&decision.ReviewedBy,
+		&decision.ReviewNote,
+		&decision.ReviewedAt,
+		&decision.TransactionID,
+		&decision.CreatedAt,
+		&decision.UpdatedAt,
+	)
+	if err != nil {
+		return Decision{}, err
+	}
+	if err := json.Unmarshal(reasons, &decision.Reasons); err != nil {
+		return Decision{}, err
+	}
+	return decision, nil
+}
@@ -0,0 +1,175 @@
+package risk
+
+import (
+	"bank_system/pkg/account"
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"time"
+)
+
+// The outcomes of rules and decisions, from the mildest.
+const (
+	OutcomeAllow  = account.RiskAllow
+	OutcomeStepUp = account.RiskStepUp
+	OutcomeReview = account.RiskReview
+	OutcomeBlock  = account.RiskBlock
+)
+
+// Outcomes lists the outcomes from the mildest.
+var Outcomes = []string{OutcomeAllow, OutcomeStepUp, OutcomeReview, OutcomeBlock}
+
+// severity orders outcomes; the strictest outcome of the rules wins.
+func severity(outcome string) int {
+	return slices.Index(Outcomes, outcome)
+}
+
+// Rule judges a movement. It returns the outcome it asks for and why, or
+// OutcomeAllow when it has no objection.
+type Rule interface {
+	Name() string
+	Evaluate(ctx context.Context, movement account.Movement, history History) (string, string, error)
+}
+
+// AmountRule asks for a step-up, a review or a block when the amount is above
+// the respective threshold, in the currency of the account. A threshold of 0
+// is not checked.
+type AmountRule struct {
+	StepUp float64
+	Review float64
+	Block  float64
+}
+
+func (AmountRule) Name() string { return "amount" }
+
+func (r AmountRule) Evaluate(ctx context.Context, movement account.Movement, history History) (string, string, error) {
+	for _, threshold := range []struct {
+		limit   float64
+		outcome string
+	}{
+		{r.Block, OutcomeBlock},
+		{r.Review, OutcomeReview},
+		{r.StepUp, OutcomeStepUp},
+	} {
+		if threshold.limit > 0 && movement.Amount > threshold.limit {
+			return threshold.outcome, fmt.Sprintf("amount %.2f %s is above %.2f",
+				movement.Amount, movement.CurrencyCode, threshold.limit), nil
+		}
+	}
+	return OutcomeAllow, "", nil
+}
+
+// VelocityRule asks for Outcome when the account already made Count
+// withdrawals and transfers within Window.
+type VelocityRule struct {
+	Count   int
+	Window  time.Duration
+	Outcome string
+}
+
+func (VelocityRule) Name() string { return "velocity" }
+
+func (r VelocityRule) Evaluate(ctx context.Context, movement account.Movement, history History) (string, string, error) {
+	count, err := history.CountMovements(ctx, movement.AccountID, time.Now().Add(-r.Window))
+	if err != nil || count < r.Count {
+		return OutcomeAllow, "", err
+	}
+	return r.Outcome, fmt.Sprintf("%d withdrawals and transfers in the last %s", count, r.Window), nil
+}
+
+// NewPayeeRule asks for Outcome when more than Amount is transferred to a new
+// recipient: a payee added within Age and not verified, or an account that
+// is no payee and was never transferred to.
+type NewPayeeRule struct {
+	Age     time.Duration
+	Amount  float64
+	Outcome string
+}
+
+func (NewPayeeRule) Name() string { return "new_payee" }
+
+func (r NewPayeeRule) Evaluate(ctx context.Context, movement account.Movement, history History) (string, string, error) {
+	if movement.Type != account.MovementTransfer || movement.Amount <= r.Amount {
+		return OutcomeAllow, "", nil
+	}
+
+	if movement.PayeeID != 0 {
+		if movement.PayeeVerified || movement.PayeeCreatedAt.Before(time.Now().Add(-r.Age)) {
+			return OutcomeAllow, "", nil
+		}
+		return r.Outcome, fmt.Sprintf("transfer above %.2f to a payee added %s",
+			r.Amount, movement.PayeeCreatedAt.UTC().Format(time.RFC3339)), nil
+	}
+
+	paid, err := history.HasTransferred(ctx, movement.AccountID, movement.ToAccountNumber)
+	if err != nil || paid {
+		return OutcomeAllow, "", err
+	}
+	return r.Outcome, fmt.Sprintf("transfer above %.2f to an account never paid before", r.Amount), nil
+}
+
+// NetworkRule asks for Outcome when the user moves money from a network none
+// of their movements came from within Lookback, a stand-in for a change of
+// location. Users with no movements in Lookback are not checked.
+type NetworkRule struct {
+	Lookback time.Duration
+	Outcome  string
+}
+
+func (NetworkRule) Name() string { return "network" }
+
+func (r NetworkRule) Evaluate(ctx context.Context, movement account.Movement, history History) (string, string, error) {
+	network := Network(movement.ClientIP)
+	if network == "" {
+		return OutcomeAllow, "", nil
+	}
+
+	networks, err := history.GetNetworks(ctx, movement.UserID, time.Now().Add(-r.Lookback))
+	if err != nil || len(networks) == 0 || slices.Contains(networks, network) {
+		return OutcomeAllow, "", err
+	}
+	return r.Outcome, fmt.Sprintf("first movement from %s in the last %s", network, r.Lookback), nil
+}
+
+// DormantRule asks for Outcome when the account made no withdrawal or
+// transfer, or was opened, more than After ago.
+type DormantRule struct {
+	After   time.Duration
+	Outcome string
+}
+
+func (DormantRule) Name() string { return "dormant" }
+
+func (r DormantRule) Evaluate(ctx context.Context, movement account.Movement, history History) (string, string, error) {
+	last, err := history.LastMovement(ctx, movement.AccountID)
+	if err != nil {
+		return OutcomeAllow, "", err
+	}
+	if last.IsZero() {
+		last = movement.AccountCreatedAt
+	}
+	if last.IsZero() || time.Since(last) <= r.After {
+		return OutcomeAllow, "", nil
+	}
+	return r.Outcome, fmt.Sprintf("no withdrawal or transfer since %s", last.UTC().Format(time.RFC3339)), nil
+}
+
+// Network returns the network of ip the network rule compares: its /24 for
+// IPv4 and its /48 for IPv6. It is empty when ip is not an address.
+func Network(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.String()
+}
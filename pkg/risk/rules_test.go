@@ -0,0 +1,157 @@
+package risk
+
+import (
+	"bank_system/pkg/account"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// history is a History with fixed answers.
+type history struct {
+	count       int
+	last        time.Time
+	transferred bool
+	networks    []string
+	err         error
+}
+
+func (h history) CountMovements(ctx context.Context, accountID int64, since time.Time) (int, error) {
+	return h.count, h.err
+}
+
+func (h history) LastMovement(ctx context.Context, accountID int64) (time.Time, error) {
+	return h.last, h.err
+}
+
+func (h history) HasTransferred(ctx context.Context, accountID int64, toIDNumber string) (bool, error) {
+	return h.transferred, h.err
+}
+
+func (h history) GetNetworks(ctx context.Context, userID int64, since time.Time) ([]string, error) {
+	return h.networks, h.err
+}
+
+func TestRules(t *testing.T) {
+	now := time.Now()
+	transfer := func(amount float64) account.Movement {
+		return account.Movement{Type: account.MovementTransfer, Amount: amount, CurrencyCode: "USD", ToAccountNumber: "22223333444455556666"}
+	}
+	toPayee := func(amount float64, added time.Time, verified bool) account.Movement {
+		movement := transfer(amount)
+		movement.PayeeID, movement.PayeeCreatedAt, movement.PayeeVerified = 1, added, verified
+		return movement
+	}
+	from := func(ip string) account.Movement {
+		movement := transfer(1)
+		movement.ClientIP = ip
+		return movement
+	}
+	openedAt := func(created time.Time) account.Movement {
+		movement := transfer(1)
+		movement.AccountCreatedAt = created
+		return movement
+	}
+
+	amount := AmountRule{StepUp: 100, Review: 500, Block: 1000}
+	velocity := VelocityRule{Count: 3, Window: time.Hour, Outcome: OutcomeReview}
+	newPayee := NewPayeeRule{Age: 72 * time.Hour, Amount: 1000, Outcome: OutcomeStepUp}
+	network := NetworkRule{Lookback: 30 * 24 * time.Hour, Outcome: OutcomeStepUp}
+	dormant := DormantRule{After: 180 * 24 * time.Hour, Outcome: OutcomeReview}
+	lastUsed := history{networks: []string{"203.0.113.0/24"}}
+
+	tests := []struct {
+		name     string
+		rule     Rule
+		movement account.Movement
+		history  history
+		outcome  string
+		reason   string
+	}{
+		{"amount at the step-up threshold", amount, transfer(100), history{}, OutcomeAllow, ""},
+		{"amount above the step-up threshold", amount, transfer(100.01), history{}, OutcomeStepUp, "amount 100.01 USD is above 100.00"},
+		{"amount at the review threshold", amount, transfer(500), history{}, OutcomeStepUp, ""},
+		{"amount above the review threshold", amount, transfer(500.01), history{}, OutcomeReview, "above 500.00"},
+		{"amount above the block threshold", amount, transfer(1000.01), history{}, OutcomeBlock, "above 1000.00"},
+		{"amount threshold of 0 is not checked", AmountRule{Block: 1000}, transfer(999), history{}, OutcomeAllow, ""},
+
+		{"velocity under the count", velocity, transfer(1), history{count: 2}, OutcomeAllow, ""},
+		{"velocity at the count", velocity, transfer(1), history{count: 3}, OutcomeReview, "3 withdrawals and transfers in the last 1h0m0s"},
+
+		{"new account at the amount", newPayee, transfer(1000), history{}, OutcomeAllow, ""},
+		{"new account above the amount", newPayee, transfer(1000.01), history{}, OutcomeStepUp, "account never paid before"},
+		{"account paid before", newPayee, transfer(5000), history{transferred: true}, OutcomeAllow, ""},
+		{"withdrawal is no transfer", newPayee, account.Movement{Type: account.MovementWithdrawal, Amount: 5000}, history{}, OutcomeAllow, ""},
+		{"new payee", newPayee, toPayee(5000, now.Add(-time.Hour), false), history{}, OutcomeStepUp, "to a payee added"},
+		{"new verified payee", newPayee, toPayee(5000, now.Add(-time.Hour), true), history{}, OutcomeAllow, ""},
+		{"old payee", newPayee, toPayee(5000, now.Add(-73*time.Hour), false), history{}, OutcomeAllow, ""},
+
+		{"network used before", network, from("203.0.113.200"), lastUsed, OutcomeAllow, ""},
+		{"network not used before", network, from("198.51.100.7"), lastUsed, OutcomeStepUp, "first movement from 198.51.100.0/24"},
+		{"IPv4-mapped address", network, from("::ffff:203.0.113.9"), lastUsed, OutcomeAllow, ""},
+		{"no movement in the lookback", network, from("198.51.100.7"), history{}, OutcomeAllow, ""},
+		{"no client address", network, from(""), lastUsed, OutcomeAllow, ""},
+
+		{"recent movement", dormant, transfer(1), history{last: now.Add(-24 * time.Hour)}, OutcomeAllow, ""},
+		{"no movement for long", dormant, transfer(1), history{last: now.Add(-181 * 24 * time.Hour)}, OutcomeReview, "no withdrawal or transfer since"},
+		{"never used, opened long ago", dormant, openedAt(now.Add(-181 * 24 * time.Hour)), history{}, OutcomeReview, "since"},
+		{"never used, opened recently", dormant, openedAt(now.Add(-time.Hour)), history{}, OutcomeAllow, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcome, reason, err := tt.rule.Evaluate(context.Background(), tt.movement, tt.history)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if outcome != tt.outcome || !strings.Contains(reason, tt.reason) {
+				t.Errorf("%s rule = %s %q, want %s %q", tt.rule.Name(), outcome, reason, tt.outcome, tt.reason)
+			}
+		})
+	}
+}
+
+func TestRulesFailWithTheirHistory(t *testing.T) {
+	failing := history{err: errors.New("connection lost")}
+	for _, rule := range []Rule{
+		VelocityRule{Count: 1, Window: time.Hour, Outcome: OutcomeReview},
+		NewPayeeRule{Amount: 1, Outcome: OutcomeReview},
+		NetworkRule{Lookback: time.Hour, Outcome: OutcomeReview},
+		DormantRule{After: time.Hour, Outcome: OutcomeReview},
+	} {
+		movement := account.Movement{Type: account.MovementTransfer, Amount: 10, ClientIP: "203.0.113.7"}
+		if outcome, _, err := rule.Evaluate(context.Background(), movement, failing); err == nil || outcome != OutcomeAllow {
+			t.Errorf("%s rule = %s, %v, want the error of the history", rule.Name(), outcome, err)
+		}
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	tests := []struct {
+		ip, network string
+	}{
+		{"203.0.113.7", "203.0.113.0/24"},
+		{"::ffff:203.0.113.7", "203.0.113.0/24"},
+		{"2001:db8:1234:5678::1", "2001:db8:1234::/48"},
+		{"", ""},
+		{"localhost", ""},
+		{"203.0.113.7:8080", ""},
+	}
+	for _, tt := range tests {
+		if got := Network(tt.ip); got != tt.network {
+			t.Errorf("Network(%q) = %q, want %q", tt.ip, got, tt.network)
+		}
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	for i := 1; i < len(Outcomes); i++ {
+		if severity(Outcomes[i]) <= severity(Outcomes[i-1]) {
+			t.Errorf("%s is not stricter than %s", Outcomes[i], Outcomes[i-1])
+		}
+	}
+	if severity("MAYBE") >= 0 {
+		t.Error("an unknown outcome has a severity")
+	}
+}
@@ -0,0 +1,194 @@
+package risk
+
+import (
+	"bank_system/pkg/account"
+	"bank_system/utils"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// The review statuses of decisions held for review.
+const (
+	ReviewPending  = "PENDING"
+	ReviewApproved = "APPROVED"
+	ReviewRejected = "REJECTED"
+	// ReviewCancelled is a decision whose movement was given up on before
+	// it was reviewed, see account.AccountService.CancelReview.
+	ReviewCancelled = "CANCELLED"
+
+	DefaultLimit           = 100
+	MaxLimit               = 1000
+	REVIEW_NOTE_MAX_LENGTH = 1000
+)
+
+// Accounts is what reviews need of account.AccountService.
+type Accounts interface {
+	CaptureHold(ctx context.Context, idNumber string, holdID int64, amount float64, toIDNumber string) (int64, float64, error)
+	ReleaseHold(ctx context.Context, idNumber string, holdID int64) (float64, error)
+	Transfer(ctx context.Context, fromIDNumber, toIDNumber string, amount float64, detail string) (int64, float64, error)
+}
+
+// Settler settles what a movement held for review was made for, such as a
+// standing order execution or a bulk payment line, once its decision is
+// reviewed: with the transaction of an approved movement, with reviewErr for
+// a rejected one. A decision that is not its own is no error.
+type Settler interface {
+	SettleReview(ctx context.Context, decisionID, txID int64, reviewErr error) error
+}
+
+// RiskService is the review queue of the movements the engine held.
+type RiskService struct {
+	repo     RiskRepository
+	accounts Accounts
+	settlers []Settler
+}
+
+func NewRiskService(repo RiskRepository, accounts Accounts, settlers ...Settler) *RiskService {
+	return &RiskService{
+		repo:     repo,
+		accounts: accounts,
+		settlers: settlers,
+	}
+}
+
+// GetDecisions returns the decisions matching filter, newest first, and
+// DefaultLimit of them when filter.Limit is 0.
+func (s *RiskService) GetDecisions(ctx context.Context, filter Filter) ([]Decision, error) {
+	if filter.Limit == 0 {
+		filter.Limit = DefaultLimit
+	}
+
+	verr := &utils.ValidationError{}
+	if filter.Outcome != "" && severity(filter.Outcome) < 0 {
+		verr.Add("outcome", "must be one of ALLOW, STEP_UP, REVIEW, BLOCK")
+	}
+	switch filter.ReviewStatus {
+	case "", ReviewPending, ReviewApproved, ReviewRejected, ReviewCancelled:
+	default:
+		verr.Add("review_status", "must be one of PENDING, APPROVED, REJECTED, CANCELLED")
+	}
+	if filter.Limit < 1 || filter.Limit > MaxLimit {
+		verr.Add("limit", fmt.Sprintf("must be between 1 and %d", MaxLimit))
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetDecisions(ctx, filter)
+}
+
+func (s *RiskService) GetDecision(ctx context.Context, id int64) (Decision, error) {
+	decision, err := s.repo.GetDecision(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Decision{}, utils.NewBankSystemError(utils.ErrRiskDecisionNotFound, strconv.FormatInt(id, 10))
+	}
+	return decision, err
+}
+
+// Approve makes the held movement of a decision pending review. A transfer
+// between currencies is converted at a fresh quote, after its hold is
+// released. It fails with ErrHoldNotActive when the hold expired, in which
+// case the decision can only be rejected. The settlers are told of the
+// transaction.
+func (s *RiskService) Approve(ctx context.Context, id int64, note string) (Decision, error) {
+	decision, err := s.getPending(ctx, id, note)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	if decision.MovementType == account.MovementTransfer && decision.ToAccountNumber == "" {
+		// The recipient was deleted; capturing would withdraw instead.
+		return Decision{}, utils.NewBankSystemError(utils.ErrAccountNotFound, strconv.FormatInt(decision.ToAccountID.Int64, 10))
+	}
+	holdID := decision.HoldID.Int64
+	txID, _, err := s.accounts.CaptureHold(ctx, decision.AccountNumber, holdID, 0, decision.ToAccountNumber)
+	if utils.IsBankSystemError(err, utils.ErrCurrencyMismatch) {
+		if _, err = s.accounts.ReleaseHold(ctx, decision.AccountNumber, holdID); err == nil {
+			txID, _, err = s.accounts.Transfer(
+				ctx, decision.AccountNumber, decision.ToAccountNumber, decision.Amount, decision.Detail,
+			)
+		}
+	}
+	if err != nil {
+		return Decision{}, err
+	}
+
+	decision.ReviewStatus = ReviewApproved
+	decision.TransactionID = pgtype.Int8{Int64: txID, Valid: true}
+	reviewed, err := s.review(ctx, decision)
+	if err != nil {
+		return Decision{}, err
+	}
+	return reviewed, s.settle(ctx, reviewed, nil)
+}
+
+// Reject releases the held movement of a decision pending review and tells
+// the settlers it failed. A hold that expired already is left as it is.
+func (s *RiskService) Reject(ctx context.Context, id int64, note string) (Decision, error) {
+	decision, err := s.getPending(ctx, id, note)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	_, err = s.accounts.ReleaseHold(ctx, decision.AccountNumber, decision.HoldID.Int64)
+	if err != nil && !utils.IsBankSystemError(err, utils.ErrHoldNotActive) {
+		return Decision{}, err
+	}
+
+	decision.ReviewStatus = ReviewRejected
+	reviewed, err := s.review(ctx, decision)
+	if err != nil {
+		return Decision{}, err
+	}
+	return reviewed, s.settle(ctx, reviewed, utils.NewBankSystemError(utils.ErrTransactionRejected, strconv.FormatInt(id, 10)))
+}
+
+// getPending returns the decision pending review with the reviewer and note
+// set.
+func (s *RiskService) getPending(ctx context.Context, id int64, note string) (Decision, error) {
+	verr := &utils.ValidationError{}
+	if len([]rune(note)) > REVIEW_NOTE_MAX_LENGTH {
+		verr.Add("note", fmt.Sprintf("must be at most %d characters", REVIEW_NOTE_MAX_LENGTH))
+	}
+	if err := verr.Err(); err != nil {
+		return Decision{}, err
+	}
+
+	decision, err := s.GetDecision(ctx, id)
+	if err != nil {
+		return Decision{}, err
+	}
+	if decision.ReviewStatus != ReviewPending || !decision.HoldID.Valid {
+		return Decision{}, utils.NewBankSystemError(utils.ErrRiskDecisionNotPending, strconv.FormatInt(id, 10))
+	}
+	decision.ReviewedBy = utils.AuditMetadataFrom(ctx).Actor
+	decision.ReviewNote = note
+	return decision, nil
+}
+
+// review stores the review of decision; another review that came first
+// makes it fail.
+func (s *RiskService) review(ctx context.Context, decision Decision) (Decision, error) {
+	reviewed, err := s.repo.ReviewDecision(ctx, decision)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Decision{}, utils.NewBankSystemError(utils.ErrRiskDecisionNotPending, strconv.FormatInt(decision.ID, 10))
+	}
+	return reviewed, err
+}
+
+// settle tells every settler of the review of decision, which is stored
+// already.
+func (s *RiskService) settle(ctx context.Context, decision Decision, reviewErr error) error {
+	var errs []error
+	for _, settler := range s.settlers {
+		if err := settler.SettleReview(ctx, decision.ID, decision.TransactionID.Int64, reviewErr); err != nil {
+			errs = append(errs, fmt.Errorf("settling reviewed decision %d: %w", decision.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
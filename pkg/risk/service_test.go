@@ -0,0 +1,218 @@
+package risk_test
+
+import (
+	"bank_system/pkg/account"
+	"bank_system/pkg/bulkpayment"
+	"bank_system/pkg/memstore"
+	"bank_system/pkg/risk"
+	"bank_system/pkg/standingorder"
+	"bank_system/pkg/user"
+	"bank_system/postgres/sqlc"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// fixture reviews every movement above 50 and settles the standing orders
+// and bulk payments it held.
+type fixture struct {
+	accountRepo account.AccountRepository
+	riskRepo    risk.RiskRepository
+	orderRepo   standingorder.StandingOrderRepository
+	accounts    *account.AccountService
+	orders      *standingorder.StandingOrderService
+	payments    *bulkpayment.BulkPaymentService
+	service     *risk.RiskService
+	fromNumber  string
+	toNumber    string
+}
+
+func newFixture(t *testing.T) *fixture {
+	ctx := context.Background()
+	store := memstore.New()
+	f := &fixture{
+		accountRepo: account.NewMemoryAccountRepository(store),
+		riskRepo:    risk.NewMemoryRiskRepository(store),
+		orderRepo:   standingorder.NewMemoryStandingOrderRepository(store),
+	}
+	engine := risk.NewEngine(f.riskRepo, 0, risk.AmountRule{Review: 50})
+	f.accounts = account.NewAccountService(f.accountRepo, nil, 0, nil, nil, engine, nil)
+	f.orders = standingorder.NewStandingOrderService(f.orderRepo, f.accounts, standingorder.RetryPolicy{}, 0)
+	f.payments = bulkpayment.NewBulkPaymentService(bulkpayment.NewMemoryBulkPaymentRepository(store), f.accounts, 0)
+	f.service = risk.NewRiskService(f.riskRepo, f.accounts, f.orders, f.payments)
+
+	users := user.NewMemoryUserRepository(store)
+	open := func(name string) sqlc.BKAccount {
+		owner, err := users.CreateUser(ctx, name, name+"@example.com", "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		opened, err := f.accountRepo.CreateAccount(ctx, owner.ID, "USD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return opened
+	}
+	from, to := open("payer"), open("payee")
+	f.fromNumber, f.toNumber = from.IDNumber, to.IDNumber
+	if _, _, err := f.accountRepo.DepositToAccount(ctx, from.ID, 1000, ""); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func (f *fixture) balances(t *testing.T, idNumber string) account.Balances {
+	t.Helper()
+	balances, err := f.accounts.GetAccountBalances(context.Background(), idNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return balances
+}
+
+func (f *fixture) bulkPayment(t *testing.T, mode string, amounts ...string) bulkpayment.BulkPayment {
+	t.Helper()
+	ctx := context.Background()
+	var csv strings.Builder
+	for _, amount := range amounts {
+		csv.WriteString(f.toNumber + "," + amount + "\n")
+	}
+	created, err := f.payments.CreateBulkPayment(ctx, f.fromNumber, bulkpayment.FormatCSV, mode, []byte(csv.String()), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.payments.ExecutePending(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	payment, err := f.payments.GetBulkPayment(ctx, f.fromNumber, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payment
+}
+
+func TestReviewSettlesBulkPaymentLines(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+
+	payment := f.bulkPayment(t, bulkpayment.ModeBestEffort, "60", "70", "5")
+	if payment.Status != bulkpayment.StatusPartiallyCompleted || payment.SucceededCount != 1 || payment.FailedCount != 0 {
+		t.Fatalf("payment before the reviews %+v, want 1 line paid and 2 held", payment)
+	}
+	for _, line := range payment.Lines[:2] {
+		if line.Status != bulkpayment.LineHeld || !line.DecisionID.Valid {
+			t.Fatalf("line %d is %s with decision %v, want it held", line.LineNumber, line.Status, line.DecisionID)
+		}
+	}
+
+	approved, err := f.service.Approve(ctx, payment.Lines[0].DecisionID.Int64, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.Reject(ctx, payment.Lines[1].DecisionID.Int64, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	payment, err = f.payments.GetBulkPayment(ctx, f.fromNumber, payment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := payment.Lines[0]; line.Status != bulkpayment.LineSucceeded || line.TransactionID != approved.TransactionID {
+		t.Errorf("approved line %+v, want it paid by transaction %d", line, approved.TransactionID.Int64)
+	}
+	if line := payment.Lines[1]; line.Status != bulkpayment.LineFailed ||
+		!strings.Contains(line.Error, "rejected in review") || line.TransactionID.Valid {
+		t.Errorf("rejected line %+v, want it failed", line)
+	}
+	if payment.Status != bulkpayment.StatusPartiallyCompleted || payment.SucceededCount != 2 || payment.FailedCount != 1 {
+		t.Errorf("payment after the reviews %+v, want 2 lines paid and 1 failed", payment)
+	}
+	if balances := f.balances(t, f.toNumber); balances.Ledger != 65 {
+		t.Errorf("recipient balances %+v, want 65", balances)
+	}
+}
+
+func TestAllOrNothingCancelsTheReview(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+
+	payment := f.bulkPayment(t, bulkpayment.ModeAllOrNothing, "5", "60")
+	if payment.Status != bulkpayment.StatusFailed {
+		t.Fatalf("payment %+v, want it failed", payment)
+	}
+	for _, line := range payment.Lines {
+		if line.Status != bulkpayment.LineFailed || !strings.Contains(line.Error, "held for review") {
+			t.Errorf("line %+v, want it failed on the review", line)
+		}
+	}
+
+	cancelled, err := f.service.GetDecisions(ctx, risk.Filter{AccountNumber: f.fromNumber, ReviewStatus: risk.ReviewCancelled})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cancelled) != 1 || cancelled[0].Amount != 60 {
+		t.Errorf("cancelled decisions %+v, want the review of 60", cancelled)
+	}
+	if pending, err := f.service.GetDecisions(ctx, risk.Filter{ReviewStatus: risk.ReviewPending}); err != nil || len(pending) != 0 {
+		t.Errorf("decisions pending review %+v, %v, want none", pending, err)
+	}
+	if balances := f.balances(t, f.fromNumber); balances.Held != 0 || balances.Available != 1000 {
+		t.Errorf("balances %+v, want the hold released", balances)
+	}
+}
+
+func TestReviewSettlesStandingOrderExecutions(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+
+	from, err := f.accountRepo.GetAccountByIDNumber(ctx, f.fromNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := f.accountRepo.GetAccountByIDNumber(ctx, f.toNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(-time.Minute)
+	order, err := f.orderRepo.CreateStandingOrder(ctx, standingorder.StandingOrder{
+		FromAccountID: from.ID,
+		ToAccountID:   to.ID,
+		Amount:        80,
+		Schedule:      "@daily",
+		TimeZone:      "UTC",
+		StartAt:       start,
+		ScheduledAt:   pgtype.Timestamptz{Time: start, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.orders.ExecuteDue(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	executions, err := f.orders.GetExecutions(ctx, f.fromNumber, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(executions) != 1 || executions[0].Status != standingorder.ExecutionHeld || !executions[0].DecisionID.Valid {
+		t.Fatalf("executions %+v, want one held", executions)
+	}
+
+	approved, err := f.service.Approve(ctx, executions[0].DecisionID.Int64, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	executions, err = f.orders.GetExecutions(ctx, f.fromNumber, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if executions[0].Status != standingorder.ExecutionSucceeded || executions[0].TransactionID != approved.TransactionID {
+		t.Errorf("execution after the approval %+v, want it paid by transaction %d", executions[0], approved.TransactionID.Int64)
+	}
+	if balances := f.balances(t, f.toNumber); balances.Ledger != 80 {
+		t.Errorf("recipient balances %+v, want 80", balances)
+	}
+}
@@ -0,0 +1,200 @@
+package screening
+
+import (
+	"bank_system/utils"
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ScreeningController struct {
+	service *ScreeningService
+	logger  *log.Logger
+}
+
+func NewScreeningController(service *ScreeningService, logger *log.Logger) *ScreeningController {
+	return &ScreeningController{
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (c *ScreeningController) GetList(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.service.Status())
+}
+
+// ReloadList reads the list file again on this instance; the others reload
+// it within a minute of the file changing.
+func (c *ScreeningController) ReloadList(ctx *gin.Context) {
+	status, err := c.service.Reload()
+	if err != nil {
+		c.logger.Printf("Failed to reload the sanctions list: %v\n", err)
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, status)
+}
+
+// Search screens the name query parameter, returning up to limit matches.
+func (c *ScreeningController) Search(ctx *gin.Context) {
+	limit := 0
+	if value := ctx.Query("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil {
+			verr := &utils.ValidationError{}
+			verr.Add("limit", "must be a number")
+			ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(verr))
+			return
+		}
+	}
+
+	matches, err := c.service.Search(ctx.Query("name"), limit)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, matches)
+}
+
+// GetHits filters by the user_id and status query parameters and pages
+// backwards with before_id and limit.
+func (c *ScreeningController) GetHits(ctx *gin.Context) {
+	filter := Filter{Status: ctx.Query("status")}
+
+	verr := &utils.ValidationError{}
+	var err error
+	if userID := ctx.Query("user_id"); userID != "" {
+		if filter.UserID, err = strconv.ParseInt(userID, 10, 64); err != nil {
+			verr.Add("user_id", "must be a user id")
+		}
+	}
+	if beforeID := ctx.Query("before_id"); beforeID != "" {
+		if filter.BeforeID, err = strconv.ParseInt(beforeID, 10, 64); err != nil {
+			verr.Add("before_id", "must be a hit id")
+		}
+	}
+	if limit := ctx.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			verr.Add("limit", "must be a number")
+		}
+	}
+	if err := verr.Err(); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	hits, err := c.service.GetHits(reqCtx, filter)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, hits)
+}
+
+func (c *ScreeningController) GetHit(ctx *gin.Context) {
+	id, ok := hitIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	hit, err := c.service.GetHit(reqCtx, id)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, hit)
+}
+
+func (c *ScreeningController) Clear(ctx *gin.Context) {
+	c.review(ctx, c.service.Clear)
+}
+
+func (c *ScreeningController) Confirm(ctx *gin.Context) {
+	c.review(ctx, c.service.Confirm)
+}
+
+func (c *ScreeningController) review(ctx *gin.Context, review func(context.Context, int64, string) (Hit, error)) {
+	id, ok := hitIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	type ReviewRequest struct {
+		Note string `json:"note"`
+	}
+
+	var req ReviewRequest
+	// The body is optional.
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+			return
+		}
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	hit, err := review(reqCtx, id, req.Note)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, hit)
+}
+
+func hitIDParam(ctx *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Param("hit_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hit id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func errorStatus(err error) int {
+	switch {
+	case utils.IsValidationError(err):
+		return http.StatusBadRequest
+	case utils.IsBankSystemError(err, utils.ErrScreeningHitNotFound):
+		return http.StatusNotFound
+	case utils.IsBankSystemError(err, utils.ErrScreeningHitNotPending):
+		return http.StatusConflict
+	case utils.IsBankSystemError(err, utils.ErrScreeningListInvalid):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RegisterRoutes serves the list, the screening of names and the hits
+// behind the admin middleware.
+func (c *ScreeningController) RegisterRoutes(router *gin.Engine, admin gin.HandlerFunc) {
+	group := router.Group("/admin/screening", admin)
+	{
+		group.GET("/list", c.GetList)
+		group.POST("/list/reload", c.ReloadList)
+		group.GET("/search", c.Search)
+		group.GET("/hits", c.GetHits)
+		group.GET("/hits/:hit_id", c.GetHit)
+		group.POST("/hits/:hit_id/clear", c.Clear)
+		group.POST("/hits/:hit_id/confirm", c.Confirm)
+	}
+}
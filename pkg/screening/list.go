@@ -0,0 +1,192 @@
+package screening
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Entry is a sanctioned person or organisation of the list.
+type Entry struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+	Program string   `json:"program,omitempty"`
+}
+
+// List is the sanctions list as last loaded, with its names normalized for
+// matching.
+type List struct {
+	Source     string
+	ModifiedAt time.Time
+	Size       int64
+	LoadedAt   time.Time
+	Entries    []Entry
+	names      []listName
+}
+
+// listName is a name or alias of an entry, normalized.
+type listName struct {
+	entry  int
+	name   string
+	tokens []string
+}
+
+// LoadList reads the sanctions list at path, a CSV file when it ends in .csv
+// and an XML file otherwise.
+//
+// A CSV file starts with a header naming its columns: name is required, id,
+// aliases (separated by semicolons) and program are read when present and
+// other columns are ignored. An XML file holds entry elements anywhere below
+// its root, each with an id and a program attribute, a name element and any
+// number of alias elements. An entry without an id is identified by its
+// normalized name.
+func LoadList(path string) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		entries, err = readCSV(f)
+	} else {
+		entries, err = readXML(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return newList(path, info.ModTime(), info.Size(), entries)
+}
+
+func newList(source string, modifiedAt time.Time, size int64, entries []Entry) (*List, error) {
+	list := &List{
+		Source:     source,
+		ModifiedAt: modifiedAt,
+		Size:       size,
+		LoadedAt:   time.Now(),
+		Entries:    entries,
+	}
+	ids := map[string]bool{}
+	for i := range list.Entries {
+		entry := &list.Entries[i]
+		entry.Name = strings.TrimSpace(entry.Name)
+		if Normalize(entry.Name) == "" {
+			return nil, fmt.Errorf("%s: entry %d has no name", source, i+1)
+		}
+		if entry.ID = strings.TrimSpace(entry.ID); entry.ID == "" {
+			entry.ID = Normalize(entry.Name)
+		}
+		if ids[entry.ID] {
+			return nil, fmt.Errorf("%s: duplicate entry id %q", source, entry.ID)
+		}
+		ids[entry.ID] = true
+
+		for _, name := range append([]string{entry.Name}, entry.Aliases...) {
+			if normalized := Normalize(name); normalized != "" {
+				list.names = append(list.names, listName{
+					entry:  i,
+					name:   name,
+					tokens: strings.Fields(normalized),
+				})
+			}
+		}
+	}
+	return list, nil
+}
+
+func readCSV(r io.Reader) ([]Entry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("missing header")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, errors.New(`header has no "name" column`)
+	}
+	field := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var entries []Entry
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entry := Entry{
+			ID:      field(record, "id"),
+			Name:    field(record, "name"),
+			Program: field(record, "program"),
+		}
+		for _, alias := range strings.Split(field(record, "aliases"), ";") {
+			if alias = strings.TrimSpace(alias); alias != "" {
+				entry.Aliases = append(entry.Aliases, alias)
+			}
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func readXML(r io.Reader) ([]Entry, error) {
+	type xmlEntry struct {
+		ID      string   `xml:"id,attr"`
+		Program string   `xml:"program,attr"`
+		Name    string   `xml:"name"`
+		Aliases []string `xml:"alias"`
+	}
+
+	var entries []Entry
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "entry" {
+			continue
+		}
+		var entry xmlEntry
+		if err := decoder.DecodeElement(&entry, &start); err != nil {
+			return nil, err
+		}
+		entries = append(entries, Entry{
+			ID:      entry.ID,
+			Name:    entry.Name,
+			Aliases: entry.Aliases,
+			Program: entry.Program,
+		})
+	}
+}
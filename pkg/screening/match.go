@@ -0,0 +1,162 @@
+package screening
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Match is a name that resembles an entry of the list.
+type Match struct {
+	Entry Entry `json:"entry"`
+	// Name is the name screened and MatchedName the name or alias of the
+	// entry it resembles most.
+	Name        string  `json:"name"`
+	MatchedName string  `json:"matched_name"`
+	Score       float64 `json:"score"`
+}
+
+// folded spells out the letters that do not decompose into a base letter and
+// marks.
+var folded = strings.NewReplacer(
+	"ß", "ss", "æ", "ae", "œ", "oe", "ø", "o", "ł", "l", "đ", "d", "ð", "d", "þ", "th", "ı", "i",
+)
+
+// Normalize lowercases name, strips its accents and apostrophes and turns
+// every other run of characters that are neither letters nor digits into a
+// single space, so that "Ó'Brien-Núñez" and "obrien nunez" compare equal.
+func Normalize(name string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range folded.Replace(norm.NFKD.String(strings.ToLower(name))) {
+		switch {
+		case unicode.Is(unicode.Mn, r), r == '\'', r == '’', r == '`':
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteRune(r)
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// Score rates how much name resembles a listed name, from 0 to 1 for the
+// same words. Each word of the listed name is paired with the closest word
+// of name left, so that the order of the words and extra middle names do not
+// count; names written as one word, as usernames often are, are also
+// compared without their spaces.
+func Score(name, listed string) float64 {
+	return score(strings.Fields(Normalize(name)), strings.Fields(Normalize(listed)))
+}
+
+func score(tokens, listed []string) float64 {
+	if len(tokens) == 0 || len(listed) == 0 {
+		return 0
+	}
+
+	used := make([]bool, len(tokens))
+	total := 0.0
+	for _, want := range listed {
+		best, bestAt := 0.0, -1
+		for i, token := range tokens {
+			if used[i] {
+				continue
+			}
+			if s := similarity(token, want); s > best {
+				best, bestAt = s, i
+			}
+		}
+		if bestAt >= 0 {
+			used[bestAt] = true
+			total += best
+		}
+	}
+
+	compact := similarity(strings.Join(tokens, ""), strings.Join(listed, ""))
+	return round(max(total/float64(len(listed)), compact))
+}
+
+// similarity is 1 less the edit distance of a and b over the length of the
+// longer one.
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// Match returns the entries that any of names resembles with a score of at
+// least minScore, best first, and up to limit of them unless it is 0. Each
+// entry is matched once, by its closest name or alias.
+func (l *List) Match(minScore float64, limit int, names ...string) []Match {
+	best := map[int]Match{}
+	for _, name := range names {
+		tokens := strings.Fields(Normalize(name))
+		if len(tokens) == 0 {
+			continue
+		}
+		for _, listed := range l.names {
+			s := score(tokens, listed.tokens)
+			if s < minScore || s <= best[listed.entry].Score {
+				continue
+			}
+			best[listed.entry] = Match{
+				Entry:       l.Entries[listed.entry],
+				Name:        name,
+				MatchedName: listed.name,
+				Score:       s,
+			}
+		}
+	}
+
+	matches := make([]Match, 0, len(best))
+	for _, match := range best {
+		matches = append(matches, match)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Entry.ID < matches[j].Entry.ID
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+func round(score float64) float64 {
+	return math.Round(score*10000) / 10000
+}
@@ -0,0 +1,97 @@
+package screening
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"Ó'Brien-Núñez", "obrien nunez"},
+		{"  Jean--Luc   PICARD ", "jean luc picard"},
+		{"Straße Øster Łódź", "strasse oster lodz"},
+		{"ｉｖａｎ", "ivan"},
+		{"agent_007", "agent 007"},
+		{"D’Arcy", "darcy"},
+		{"--", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.name); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name, listed string
+		score        float64
+	}{
+		{"Ivan Petrov", "Ivan Petrov", 1},
+		{"petrov ivan", "Ivan Petrov", 1},
+		{"Ivan Sergeyevich Petrov", "Ivan Petrov", 1},
+		{"ivanpetrov", "Ivan Petrov", 1},
+		{"Jose Garcia", "José García", 1},
+		{"Ivan Petrof", "Ivan Petrov", 0.9167},
+		{"ivan_petrov99", "Ivan Petrov", 0.875},
+		{"Ivan Petrovsky", "Ivan Petrov", 0.8333},
+		{"Ivana Petrova", "Ivan Petrov", 0.8333},
+		{"Ivan Petrov", "Ivan Petrov Ivanovich", 0.6667},
+		{"Ivan", "Ivan Petrov", 0.5},
+		{"John Smith", "Ivan Petrov", 0.125},
+		{"", "Ivan Petrov", 0},
+		{"Ivan Petrov", "--", 0},
+	}
+	for _, tt := range tests {
+		if got := Score(tt.name, tt.listed); got != tt.score {
+			t.Errorf("Score(%q, %q) = %v, want %v", tt.name, tt.listed, got, tt.score)
+		}
+	}
+}
+
+func TestListMatch(t *testing.T) {
+	list, err := newList("test", time.Now(), 0, []Entry{
+		{ID: "1", Name: "Ivan Petrov", Aliases: []string{"Ivan Petroff", "Vanya"}},
+		{ID: "2", Name: "Ivana Petrova"},
+		{ID: "3", Name: "Maria Lopez"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		minScore float64
+		limit    int
+		names    []string
+		want     []string // entry id and matched name
+	}{
+		{"best first", 0.8, 0, []string{"Ivan Petrov"}, []string{"1 Ivan Petrov", "2 Ivana Petrova"}},
+		{"under the score", 0.85, 0, []string{"Ivan Petrov"}, []string{"1 Ivan Petrov"}},
+		{"limit", 0.8, 1, []string{"Ivan Petrov"}, []string{"1 Ivan Petrov"}},
+		{"an alias", 0.85, 0, []string{"vanya"}, []string{"1 Vanya"}},
+		{"once per entry by its closest name", 0.85, 0, []string{"Ivan Petroff", "I. Petrov"}, []string{"1 Ivan Petroff"}},
+		{"any of the names", 0.85, 0, []string{"nobody", "maria_lopez"}, []string{"3 Maria Lopez"}},
+		{"no name", 0.5, 0, []string{"", "--"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := list.Match(tt.minScore, tt.limit, tt.names...)
+			var got []string
+			for _, match := range matches {
+				got = append(got, match.Entry.ID+" "+match.MatchedName)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("matches %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("matches %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package screening
+
+import (
+	"bank_system/pkg/memstore"
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// memoryScreeningRepository is a ScreeningRepository backed by a
+// memstore.Store.
+type memoryScreeningRepository struct {
+	store *memstore.Store
+}
+
+func NewMemoryScreeningRepository(store *memstore.Store) ScreeningRepository {
+	return &memoryScreeningRepository{store: store}
+}
+
+func (r *memoryScreeningRepository) CreateHit(ctx context.Context, hit Hit) (Hit, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	if hit.UserID.Valid {
+		if _, ok := r.store.Users[hit.UserID.Int64]; !ok {
+			return Hit{}, errors.New(`insert on "BK_Screening_Hit" violates a foreign key constraint to "BK_User"`)
+		}
+	}
+
+	now := time.Now()
+	record := &memstore.ScreeningHitRecord{
+		ID:          r.store.NextID("BK_Screening_Hit"),
+		UserID:      hit.UserID,
+		Name:        hit.Name,
+		EntryID:     hit.EntryID,
+		EntryName:   hit.EntryName,
+		MatchedName: hit.MatchedName,
+		Program:     hit.Program,
+		Score:       hit.Score,
+		Status:      hit.Status,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	r.store.ScreeningHits[record.ID] = record
+	r.store.Audit(ctx, "BK_Screening_Hit", record.ID, nil, *record)
+
+	return toHit(record), nil
+}
+
+func (r *memoryScreeningRepository) AttachUser(ctx context.Context, id, userID int64) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.ScreeningHits[id]
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	if _, ok := r.store.Users[userID]; !ok {
+		return errors.New(`update on "BK_Screening_Hit" violates a foreign key constraint to "BK_User"`)
+	}
+
+	before := *record
+	record.UserID = pgtype.Int8{Int64: userID, Valid: true}
+	record.UpdatedAt = time.Now()
+	r.store.Audit(ctx, "BK_Screening_Hit", record.ID, before, *record)
+	return nil
+}
+
+func (r *memoryScreeningRepository) GetHit(ctx context.Context, id int64) (Hit, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.ScreeningHits[id]
+	if !ok {
+		return Hit{}, pgx.ErrNoRows
+	}
+	return toHit(record), nil
+}
+
+func (r *memoryScreeningRepository) GetHits(ctx context.Context, filter Filter) ([]Hit, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	hits := []Hit{}
+	for _, record := range r.store.ScreeningHits {
+		if filter.UserID > 0 && (!record.UserID.Valid || record.UserID.Int64 != filter.UserID) ||
+			filter.Status != "" && record.Status != filter.Status ||
+			filter.BeforeID > 0 && record.ID >= filter.BeforeID {
+			continue
+		}
+		hits = append(hits, toHit(record))
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].ID > hits[j].ID })
+	if len(hits) > filter.Limit {
+		hits = hits[:filter.Limit]
+	}
+	return hits, nil
+}
+
+func (r *memoryScreeningRepository) GetUserHits(ctx context.Context, userID int64) ([]Hit, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	hits := []Hit{}
+	for _, record := range r.store.ScreeningHits {
+		if record.UserID.Valid && record.UserID.Int64 == userID {
+			hits = append(hits, toHit(record))
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].ID < hits[j].ID })
+	return hits, nil
+}
+
+func (r *memoryScreeningRepository) ReviewHit(ctx context.Context, hit Hit) (Hit, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.ScreeningHits[hit.ID]
+	if !ok || record.Status != HitPending {
+		return Hit{}, pgx.ErrNoRows
+	}
+
+	before := *record
+	now := time.Now()
+	record.Status = hit.Status
+	record.ReviewedBy = hit.ReviewedBy
+	record.ReviewNote = hit.ReviewNote
+	record.ReviewedAt = pgtype.Timestamptz{Time: now, Valid: true}
+	record.UpdatedAt = now
+	r.store.Audit(ctx, "BK_Screening_Hit", record.ID, before, *record)
+
+	return toHit(record), nil
+}
+
+func toHit(record *memstore.ScreeningHitRecord) Hit {
+	return Hit{
+		ID:          record.ID,
+		UserID:      record.UserID,
+		Name:        record.Name,
+		EntryID:     record.EntryID,
+		EntryName:   record.EntryName,
+		MatchedName: record.MatchedName,
+		Program:     record.Program,
+		Score:       record.Score,
+		Status:      record.Status,
+		ReviewedBy:  record.ReviewedBy,
+		ReviewNote:  record.ReviewNote,
+		ReviewedAt:  record.ReviewedAt,
+		CreatedAt:   record.CreatedAt,
+		UpdatedAt:   record.UpdatedAt,
+	}
+}
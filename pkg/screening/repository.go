@@ -0,0 +1,172 @@
+// Package screening screens names against a sanctions list loaded from a
+// local file: those of new users, and of the owners of the accounts money is
+// transferred to. Users whose names match are held for compliance to review,
+// or refused when the match is close enough, and the list can be reloaded
+// while the server runs.
+package screening
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const hitColumns = `id, user_id, name, entry_id, entry_name, matched_name, program, score, status,
+	reviewed_by, review_note, reviewed_at, created_at, updated_at`
+
+// Hit is a user's name that matched an entry of the list. UserID is not
+// valid for the names that were refused.
+type Hit struct {
+	ID          int64              `json:"id"`
+	UserID      pgtype.Int8        `json:"user_id"`
+	Name        string             `json:"name"`
+	EntryID     string             `json:"entry_id"`
+	EntryName   string             `json:"entry_name"`
+	MatchedName string             `json:"matched_name"`
+	Program     string             `json:"program"`
+	Score       float64            `json:"score"`
+	Status      string             `json:"status"`
+	ReviewedBy  string             `json:"reviewed_by,omitempty"`
+	ReviewNote  string             `json:"review_note,omitempty"`
+	ReviewedAt  pgtype.Timestamptz `json:"reviewed_at"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+}
+
+type Filter struct {
+	UserID   int64
+	Status   string
+	BeforeID int64
+	Limit    int
+}
+
+type ScreeningRepository interface {
+	CreateHit(ctx context.Context, hit Hit) (Hit, error)
+	// AttachUser sets the user of a hit recorded before the user was
+	// created.
+	AttachUser(ctx context.Context, id, userID int64) error
+	GetHit(ctx context.Context, id int64) (Hit, error)
+	// GetHits returns up to filter.Limit hits matching filter, newest first.
+	GetHits(ctx context.Context, filter Filter) ([]Hit, error)
+	// GetUserHits returns every hit of the user, oldest first.
+	GetUserHits(ctx context.Context, userID int64) ([]Hit, error)
+	// ReviewHit stores the status and review of a pending hit. It returns
+	// pgx.ErrNoRows when the hit is not pending.
+	ReviewHit(ctx context.Context, hit Hit) (Hit, error)
+}
+
+type screeningRepositoryImpl struct {
+	pool *pgxpool.Pool
+}
+
+func NewScreeningRepository(pool *pgxpool.Pool) ScreeningRepository {
+	return &screeningRepositoryImpl{pool: pool}
+}
+
+func (r *screeningRepositoryImpl) CreateHit(ctx context.Context, hit Hit) (Hit, error) {
+	return scanHit(r.pool.QueryRow(ctx,
+		`INSERT INTO "BK_Screening_Hit" (user_id, name, entry_id, entry_name, matched_name, program, score, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+hitColumns,
+		hit.UserID, hit.Name, hit.EntryID, hit.EntryName, hit.MatchedName, hit.Program, hit.Score, hit.Status,
+	))
+}
+
+func (r *screeningRepositoryImpl) AttachUser(ctx context.Context, id, userID int64) error {
+	tag, err := r.pool.Exec(ctx, `UPDATE "BK_Screening_Hit" SET user_id = $2 WHERE id = $1`, id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (r *screeningRepositoryImpl) GetHit(ctx context.Context, id int64) (Hit, error) {
+	return scanHit(r.pool.QueryRow(ctx, `SELECT `+hitColumns+` FROM "BK_Screening_Hit" WHERE id = $1`, id))
+}
+
+func (r *screeningRepositoryImpl) GetHits(ctx context.Context, filter Filter) ([]Hit, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if filter.UserID > 0 {
+		where("user_id = ?", filter.UserID)
+	}
+	if filter.Status != "" {
+		where("status::TEXT = ?", filter.Status)
+	}
+	if filter.BeforeID > 0 {
+		where("id < ?", filter.BeforeID)
+	}
+
+	query := `SELECT ` + hitColumns + ` FROM "BK_Screening_Hit"`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT $%d`, len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Hit, error) {
+		return scanHit(row)
+	})
+}
+
+func (r *screeningRepositoryImpl) GetUserHits(ctx context.Context, userID int64) ([]Hit, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+hitColumns+` FROM "BK_Screening_Hit" WHERE user_id = $1 ORDER BY id`, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Hit, error) {
+		return scanHit(row)
+	})
+}
+
+func (r *screeningRepositoryImpl) ReviewHit(ctx context.Context, hit Hit) (Hit, error) {
+	return scanHit(r.pool.QueryRow(ctx,
+		`UPDATE "BK_Screening_Hit"
+		SET status = $2, reviewed_by = $3, review_note = $4, reviewed_at = NOW()
+		WHERE id = $1 AND status = 'PENDING'
+		RETURNING `+hitColumns,
+		hit.ID, hit.Status, hit.ReviewedBy, hit.ReviewNote,
+	))
+}
+
+func scanHit(row pgx.Row) (Hit, error) {
+	var hit Hit
+	err := row.Scan(
+		&hit.ID,
+		&hit.UserID,
+		&hit.Name,
+		&hit.EntryID,
+		&hit.EntryName,
+		&hit.MatchedName,
+		&hit.Program,
+		&hit.Score,
+		&hit.Status,
+		&hit.ReviewedBy,
+		&hit.ReviewNote,
+		&hit.ReviewedAt,
+		&hit.CreatedAt,
+		&hit.UpdatedAt,
+	)
+	return hit, err
+}
@@ -0,0 +1,114 @@
+package screening
+
+import (
+	"bank_system/pkg/account"
+	"bank_system/pkg/risk"
+	"bank_system/postgres/sqlc"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Accounts finds the account money is transferred to.
+type Accounts interface {
+	GetAccountByIDNumber(ctx context.Context, idNumber string) (sqlc.GetAccountByIDNumberRow, error)
+}
+
+// Users finds the owner of the account money is transferred to.
+type Users interface {
+	GetUserByID(ctx context.Context, id int64) (*sqlc.GetUserByIDRow, error)
+}
+
+// Rule is the risk rule that holds back the movements of users with a
+// pending hit for review and blocks those of users with a confirmed one. A
+// transfer is judged by the hits of the recipient's owner too, and by their
+// names against the list as it is now, which catches the users listed after
+// they signed up.
+type Rule struct {
+	service  *ScreeningService
+	accounts Accounts
+	users    Users
+}
+
+func NewRule(service *ScreeningService, accounts Accounts, users Users) *Rule {
+	return &Rule{
+		service:  service,
+		accounts: accounts,
+		users:    users,
+	}
+}
+
+func (*Rule) Name() string { return "sanctions" }
+
+func (r *Rule) Evaluate(ctx context.Context, movement account.Movement, history risk.History) (string, string, error) {
+	outcome, reason, err := r.judgeHits(ctx, movement.UserID, "the user")
+	if err != nil || outcome == risk.OutcomeBlock || movement.Type != account.MovementTransfer {
+		return outcome, reason, err
+	}
+
+	recipient, err := r.accounts.GetAccountByIDNumber(ctx, movement.ToAccountNumber)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The transfer fails later on.
+		return outcome, reason, nil
+	}
+	if err != nil || recipient.UserID == movement.UserID {
+		return outcome, reason, err
+	}
+
+	recipientOutcome, recipientReason, err := r.judgeRecipient(ctx, recipient.UserID)
+	if err != nil {
+		return risk.OutcomeAllow, "", err
+	}
+	if recipientOutcome == risk.OutcomeBlock || outcome == risk.OutcomeAllow {
+		return recipientOutcome, recipientReason, nil
+	}
+	return outcome, reason, nil
+}
+
+// judgeHits asks for a block when the user has a confirmed hit and for a
+// review when they have a pending one.
+func (r *Rule) judgeHits(ctx context.Context, userID int64, who string) (string, string, error) {
+	hits, err := r.service.repo.GetUserHits(ctx, userID)
+	if err != nil {
+		return risk.OutcomeAllow, "", err
+	}
+
+	outcome, reason := risk.OutcomeAllow, ""
+	for _, hit := range hits {
+		switch hit.Status {
+		case HitConfirmed:
+			return risk.OutcomeBlock, fmt.Sprintf("%s matched the sanctions list, hit %d", who, hit.ID), nil
+		case HitPending:
+			if outcome == risk.OutcomeAllow {
+				outcome, reason = risk.OutcomeReview, fmt.Sprintf("%s is pending sanctions review, hit %d", who, hit.ID)
+			}
+		}
+	}
+	return outcome, reason, nil
+}
+
+// judgeRecipient judges the hits of the recipient's owner and then screens
+// their names for the entries they have no hit for.
+func (r *Rule) judgeRecipient(ctx context.Context, userID int64) (string, string, error) {
+	outcome, reason, err := r.judgeHits(ctx, userID, "the recipient")
+	if err != nil || outcome != risk.OutcomeAllow {
+		return outcome, reason, err
+	}
+
+	owner, err := r.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return risk.OutcomeAllow, "", err
+	}
+	match, ok, err := r.service.screen(ctx, userID, owner.Username, owner.Email)
+	if err != nil || !ok {
+		return risk.OutcomeAllow, "", err
+	}
+	outcome = risk.OutcomeReview
+	if r.service.blocks(match) {
+		outcome = risk.OutcomeBlock
+	}
+	return outcome, fmt.Sprintf("the recipient's name matches %q of the sanctions list, score %.2f",
+		match.MatchedName, match.Score), nil
+}
@@ -0,0 +1,309 @@
+package screening
+
+import (
+	"bank_system/utils"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// The statuses of hits.
+const (
+	HitPending   = "PENDING"
+	HitCleared   = "CLEARED"
+	HitConfirmed = "CONFIRMED"
+	HitBlocked   = "BLOCKED"
+)
+
+const (
+	DefaultLimit           = 100
+	MaxLimit               = 1000
+	DefaultSearchLimit     = 10
+	NAME_MAX_LENGTH        = 200
+	REVIEW_NOTE_MAX_LENGTH = 1000
+)
+
+// DefaultReviewScore is the score from which names are held for review when
+// no review score is configured.
+const DefaultReviewScore = 0.85
+
+type Config struct {
+	// ListFile is the sanctions list, see LoadList.
+	ListFile string
+	// Names that score ReviewScore against an entry are held for review,
+	// DefaultReviewScore when 0. Those that score BlockScore are refused,
+	// none when it is 0.
+	ReviewScore float64
+	BlockScore  float64
+}
+
+// Status describes the list in use.
+type Status struct {
+	Source     string    `json:"source"`
+	Entries    int       `json:"entries"`
+	Names      int       `json:"names"`
+	ModifiedAt time.Time `json:"modified_at"`
+	LoadedAt   time.Time `json:"loaded_at"`
+}
+
+type ScreeningService struct {
+	repo   ScreeningRepository
+	config Config
+
+	mu   sync.RWMutex
+	list *List
+}
+
+// NewScreeningService creates a service without a list; Reload loads it.
+func NewScreeningService(repo ScreeningRepository, config Config) *ScreeningService {
+	if config.ReviewScore <= 0 || config.ReviewScore > 1 {
+		config.ReviewScore = DefaultReviewScore
+	}
+
+	return &ScreeningService{
+		repo:   repo,
+		config: config,
+	}
+}
+
+// Reload reads the list file again. The list in use is kept when the file
+// cannot be read.
+func (s *ScreeningService) Reload() (Status, error) {
+	list, err := LoadList(s.config.ListFile)
+	if err != nil {
+		return Status{}, utils.NewBankSystemError(utils.ErrScreeningListInvalid, err.Error())
+	}
+
+	s.mu.Lock()
+	s.list = list
+	s.mu.Unlock()
+	return s.Status(), nil
+}
+
+// ReloadIfChanged reloads the list when its file was modified since it was
+// loaded, and reports whether it did.
+func (s *ScreeningService) ReloadIfChanged() (bool, error) {
+	info, err := os.Stat(s.config.ListFile)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	list := s.list
+	s.mu.RUnlock()
+	if list != nil && info.ModTime().Equal(list.ModifiedAt) && info.Size() == list.Size {
+		return false, nil
+	}
+
+	if _, err := s.Reload(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *ScreeningService) Status() Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.list == nil {
+		return Status{Source: s.config.ListFile}
+	}
+	return Status{
+		Source:     s.list.Source,
+		Entries:    len(s.list.Entries),
+		Names:      len(s.list.names),
+		ModifiedAt: s.list.ModifiedAt,
+		LoadedAt:   s.list.LoadedAt,
+	}
+}
+
+// Search returns the entries name resembles enough to be reviewed, best
+// first, and DefaultSearchLimit of them when limit is 0.
+func (s *ScreeningService) Search(name string, limit int) ([]Match, error) {
+	if limit == 0 {
+		limit = DefaultSearchLimit
+	}
+
+	verr := &utils.ValidationError{}
+	if n := len([]rune(name)); n < 1 || n > NAME_MAX_LENGTH {
+		verr.Add("name", fmt.Sprintf("must be between 1 and %d characters", NAME_MAX_LENGTH))
+	}
+	if limit < 1 || limit > MaxLimit {
+		verr.Add("limit", fmt.Sprintf("must be between 1 and %d", MaxLimit))
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.match(limit, name), nil
+}
+
+// match returns the entries that names resemble enough to be reviewed.
+func (s *ScreeningService) match(limit int, names ...string) []Match {
+	s.mu.RLock()
+	list := s.list
+	s.mu.RUnlock()
+
+	if list == nil {
+		return []Match{}
+	}
+	return list.Match(s.config.ReviewScore, limit, names...)
+}
+
+// blocks reports whether a match is close enough to refuse the name.
+func (s *ScreeningService) blocks(match Match) bool {
+	return s.config.BlockScore > 0 && match.Score >= s.config.BlockScore
+}
+
+// ScreenUser screens the username and email address, without its domain, of
+// a new user, when userID is 0, or of one changing them. The closest match
+// to an entry the user has no hit for yet is recorded as a hit: a blocked one
+// fails with ErrUserScreeningBlocked, and the id of a pending one is
+// returned, 0 when there is none. A new user's hit has no user until
+// AttachUser.
+func (s *ScreeningService) ScreenUser(ctx context.Context, userID int64, username, email string) (int64, error) {
+	match, ok, err := s.screen(ctx, userID, username, email)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	hit := Hit{
+		UserID:      pgtype.Int8{Int64: userID, Valid: userID != 0},
+		Name:        match.Name,
+		EntryID:     match.Entry.ID,
+		EntryName:   match.Entry.Name,
+		MatchedName: match.MatchedName,
+		Program:     match.Entry.Program,
+		Score:       match.Score,
+		Status:      HitPending,
+	}
+	if s.blocks(match) {
+		hit.Status = HitBlocked
+	}
+	hit, err = s.repo.CreateHit(ctx, hit)
+	if err != nil {
+		return 0, err
+	}
+	if hit.Status == HitBlocked {
+		return 0, utils.NewBankSystemError(utils.ErrUserScreeningBlocked, strconv.FormatInt(hit.ID, 10))
+	}
+	return hit.ID, nil
+}
+
+// screen returns the closest match of the user's names to an entry the user
+// has no hit for.
+func (s *ScreeningService) screen(ctx context.Context, userID int64, username, email string) (Match, bool, error) {
+	matches := s.match(0, screenedNames(username, email)...)
+	if len(matches) == 0 {
+		return Match{}, false, nil
+	}
+
+	known := map[string]bool{}
+	if userID != 0 {
+		hits, err := s.repo.GetUserHits(ctx, userID)
+		if err != nil {
+			return Match{}, false, err
+		}
+		for _, hit := range hits {
+			if hit.Status != HitBlocked {
+				known[hit.EntryID] = true
+			}
+		}
+	}
+	for _, match := range matches {
+		if !known[match.Entry.ID] {
+			return match, true, nil
+		}
+	}
+	return Match{}, false, nil
+}
+
+// screenedNames are the names of a user: the username and the part of the
+// email address before the domain.
+func screenedNames(username, email string) []string {
+	names := []string{username}
+	if at := strings.LastIndex(email, "@"); at > 0 {
+		names = append(names, email[:at])
+	}
+	return names
+}
+
+// AttachUser sets the user of the hit ScreenUser recorded for a new user.
+func (s *ScreeningService) AttachUser(ctx context.Context, hitID, userID int64) error {
+	return s.repo.AttachUser(ctx, hitID, userID)
+}
+
+// GetHits returns the hits matching filter, newest first, and DefaultLimit
+// of them when filter.Limit is 0.
+func (s *ScreeningService) GetHits(ctx context.Context, filter Filter) ([]Hit, error) {
+	if filter.Limit == 0 {
+		filter.Limit = DefaultLimit
+	}
+
+	verr := &utils.ValidationError{}
+	switch filter.Status {
+	case "", HitPending, HitCleared, HitConfirmed, HitBlocked:
+	default:
+		verr.Add("status", "must be one of PENDING, CLEARED, CONFIRMED, BLOCKED")
+	}
+	if filter.Limit < 1 || filter.Limit > MaxLimit {
+		verr.Add("limit", fmt.Sprintf("must be between 1 and %d", MaxLimit))
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetHits(ctx, filter)
+}
+
+func (s *ScreeningService) GetHit(ctx context.Context, id int64) (Hit, error) {
+	hit, err := s.repo.GetHit(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Hit{}, utils.NewBankSystemError(utils.ErrScreeningHitNotFound, strconv.FormatInt(id, 10))
+	}
+	return hit, err
+}
+
+// Clear closes a pending hit as a false positive, which lets the user move
+// money again unless another hit holds it back.
+func (s *ScreeningService) Clear(ctx context.Context, id int64, note string) (Hit, error) {
+	return s.review(ctx, id, HitCleared, note)
+}
+
+// Confirm closes a pending hit as a true match, which blocks the user's
+// withdrawals and transfers, and transfers to them.
+func (s *ScreeningService) Confirm(ctx context.Context, id int64, note string) (Hit, error) {
+	return s.review(ctx, id, HitConfirmed, note)
+}
+
+func (s *ScreeningService) review(ctx context.Context, id int64, status, note string) (Hit, error) {
+	verr := &utils.ValidationError{}
+	if len([]rune(note)) > REVIEW_NOTE_MAX_LENGTH {
+		verr.Add("note", fmt.Sprintf("must be at most %d characters", REVIEW_NOTE_MAX_LENGTH))
+	}
+	if err := verr.Err(); err != nil {
+		return Hit{}, err
+	}
+
+	if _, err := s.GetHit(ctx, id); err != nil {
+		return Hit{}, err
+	}
+	hit, err := s.repo.ReviewHit(ctx, Hit{
+		ID:         id,
+		Status:     status,
+		ReviewedBy: utils.AuditMetadataFrom(ctx).Actor,
+		ReviewNote: note,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Hit{}, utils.NewBankSystemError(utils.ErrScreeningHitNotPending, strconv.FormatInt(id, 10))
+	}
+	return hit, err
+}
@@ -0,0 +1,190 @@
+package standingorder
+
+import (
+	"bank_system/utils"
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type StandingOrderController struct {
+	service *StandingOrderService
+	logger  *log.Logger
+}
+
+func NewStandingOrderController(service *StandingOrderService, logger *log.Logger) *StandingOrderController {
+	return &StandingOrderController{
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (c *StandingOrderController) CreateStandingOrder(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+
+	// StartAt defaults to now, MaxOccurrences 0 means no limit.
+	type CreateStandingOrderRequest struct {
+		ToAccount      string     `json:"to_account" binding:"required"`
+		Amount         float64    `json:"amount" binding:"required"`
+		Detail         string     `json:"detail"`
+		Schedule       string     `json:"schedule" binding:"required"`
+		TimeZone       string     `json:"time_zone"`
+		StartAt        *time.Time `json:"start_at"`
+		EndAt          *time.Time `json:"end_at"`
+		MaxOccurrences int32      `json:"max_occurrences"`
+		OTPCode        string     `json:"otp_code"`
+	}
+
+	var req CreateStandingOrderRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	order := StandingOrder{
+		ToAccount:      req.ToAccount,
+		Amount:         req.Amount,
+		Detail:         req.Detail,
+		Schedule:       req.Schedule,
+		TimeZone:       req.TimeZone,
+		MaxOccurrences: pgtype.Int4{Int32: req.MaxOccurrences, Valid: req.MaxOccurrences != 0},
+	}
+	if req.StartAt != nil {
+		order.StartAt = *req.StartAt
+	}
+	if req.EndAt != nil {
+		order.EndAt = timestamptz(*req.EndAt)
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	created, err := c.service.CreateStandingOrder(reqCtx, idNumber, order, req.OTPCode)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, created)
+}
+
+func (c *StandingOrderController) GetAccountStandingOrders(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	orders, err := c.service.GetAccountStandingOrders(reqCtx, idNumber)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, orders)
+}
+
+func (c *StandingOrderController) GetStandingOrder(ctx *gin.Context) {
+	c.withOrder(ctx, c.service.GetStandingOrder)
+}
+
+func (c *StandingOrderController) PauseStandingOrder(ctx *gin.Context) {
+	c.withOrder(ctx, c.service.PauseStandingOrder)
+}
+
+func (c *StandingOrderController) ResumeStandingOrder(ctx *gin.Context) {
+	c.withOrder(ctx, c.service.ResumeStandingOrder)
+}
+
+func (c *StandingOrderController) CancelStandingOrder(ctx *gin.Context) {
+	c.withOrder(ctx, c.service.CancelStandingOrder)
+}
+
+func (c *StandingOrderController) GetExecutions(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+	orderID, err := strconv.ParseInt(ctx.Param("order_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	executions, err := c.service.GetExecutions(reqCtx, idNumber, orderID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, executions)
+}
+
+// withOrder serves the routes of a single order that respond with it.
+func (c *StandingOrderController) withOrder(
+	ctx *gin.Context, fn func(ctx context.Context, idNumber string, orderID int64) (StandingOrder, error),
+) {
+	idNumber := ctx.Param("id_number")
+	orderID, err := strconv.ParseInt(ctx.Param("order_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	order, err := fn(reqCtx, idNumber, orderID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, order)
+}
+
+func errorStatus(err error) int {
+	switch {
+	case utils.IsValidationError(err):
+		return http.StatusBadRequest
+	case utils.IsBankSystemError(err, utils.ErrOTPRequired),
+		utils.IsBankSystemError(err, utils.ErrInvalidOTP):
+		return http.StatusUnauthorized
+	case utils.IsBankSystemError(err, utils.ErrTOTPNotEnabled),
+		utils.IsBankSystemError(err, utils.ErrPayeeCoolingOff),
+		utils.IsBankSystemError(err, utils.ErrPayeeRequired):
+		return http.StatusForbidden
+	case utils.IsBankSystemError(err, utils.ErrAccountNotFound),
+		utils.IsBankSystemError(err, utils.ErrStandingOrderNotFound):
+		return http.StatusNotFound
+	case utils.IsBankSystemError(err, utils.ErrStandingOrderStatus):
+		return http.StatusConflict
+	case utils.IsBankSystemError(err, utils.ErrSameAccountTransfer):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RegisterRoutes serves the standing orders of an account only to its owner,
+// behind the owner middleware.
+func (c *StandingOrderController) RegisterRoutes(router *gin.Engine, owner gin.HandlerFunc) {
+	group := router.Group("/accounts/:id_number/standing-orders", owner)
+	{
+		group.POST("", c.CreateStandingOrder)
+		group.GET("", c.GetAccountStandingOrders)
+		group.GET("/:order_id", c.GetStandingOrder)
+		group.GET("/:order_id/executions", c.GetExecutions)
+		group.POST("/:order_id/pause", c.PauseStandingOrder)
+		group.POST("/:order_id/resume", c.ResumeStandingOrder)
+		group.POST("/:order_id/cancel", c.CancelStandingOrder)
+	}
+}
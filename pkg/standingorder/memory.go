@@ -0,0 +1,246 @@
+package standingorder
+
+import (
+	"bank_system/pkg/memstore"
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// memoryStandingOrderRepository is a StandingOrderRepository backed by a memstore.Store.
+type memoryStandingOrderRepository struct {
+	store *memstore.Store
+}
+
+func NewMemoryStandingOrderRepository(store *memstore.Store) StandingOrderRepository {
+	return &memoryStandingOrderRepository{store: store}
+}
+
+func (r *memoryStandingOrderRepository) CreateStandingOrder(ctx context.Context, order StandingOrder) (StandingOrder, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	_, fromExists := r.store.Accounts[order.FromAccountID]
+	_, toExists := r.store.Accounts[order.ToAccountID]
+	if !fromExists || !toExists {
+		return StandingOrder{}, errors.New(`insert on "BK_Standing_Order" violates a foreign key constraint to "BK_Account"`)
+	}
+
+	now := time.Now()
+	record := &memstore.StandingOrderRecord{
+		ID:             r.store.NextID("BK_Standing_Order"),
+		FromAccountID:  order.FromAccountID,
+		ToAccountID:    order.ToAccountID,
+		Amount:         order.Amount,
+		Detail:         order.Detail,
+		Schedule:       order.Schedule,
+		TimeZone:       order.TimeZone,
+		Status:         StatusActive,
+		StartAt:        order.StartAt,
+		EndAt:          order.EndAt,
+		MaxOccurrences: order.MaxOccurrences,
+		ScheduledAt:    order.ScheduledAt,
+		NextRunAt:      order.ScheduledAt,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	r.store.StandingOrders[record.ID] = record
+	r.store.Audit(ctx, "BK_Standing_Order", record.ID, nil, *record)
+
+	return r.toStandingOrder(record), nil
+}
+
+func (r *memoryStandingOrderRepository) GetStandingOrder(ctx context.Context, id int64) (StandingOrder, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.StandingOrders[id]
+	if !ok {
+		return StandingOrder{}, pgx.ErrNoRows
+	}
+	return r.toStandingOrder(record), nil
+}
+
+func (r *memoryStandingOrderRepository) GetAccountStandingOrders(ctx context.Context, accountID int64) ([]StandingOrder, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	orders := []StandingOrder{}
+	for _, record := range r.store.StandingOrders {
+		if record.FromAccountID == accountID {
+			orders = append(orders, r.toStandingOrder(record))
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+
+	return orders, nil
+}
+
+func (r *memoryStandingOrderRepository) UpdateStandingOrder(
+	ctx context.Context, order StandingOrder, fromStatus string,
+) (StandingOrder, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.StandingOrders[order.ID]
+	if !ok || record.Status != fromStatus {
+		return StandingOrder{}, pgx.ErrNoRows
+	}
+
+	before := *record
+	record.Status = order.Status
+	record.Attempts = order.Attempts
+	record.ScheduledAt = order.ScheduledAt
+	record.NextRunAt = order.NextRunAt
+	record.UpdatedAt = time.Now()
+	r.store.Audit(ctx, "BK_Standing_Order", record.ID, before, *record)
+
+	return r.toStandingOrder(record), nil
+}
+
+func (r *memoryStandingOrderRepository) ClaimDueStandingOrders(
+	ctx context.Context, now, claimUntil time.Time, limit int,
+) ([]StandingOrder, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	var due []*memstore.StandingOrderRecord
+	for _, record := range r.store.StandingOrders {
+		if record.Status == StatusActive &&
+			record.NextRunAt.Valid && !record.NextRunAt.Time.After(now) &&
+			(!record.ClaimedUntil.Valid || record.ClaimedUntil.Time.Before(now)) {
+			due = append(due, record)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextRunAt.Time.Before(due[j].NextRunAt.Time) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	orders := make([]StandingOrder, 0, len(due))
+	for _, record := range due {
+		record.ClaimedUntil = pgtype.Timestamptz{Time: claimUntil, Valid: true}
+		orders = append(orders, r.toStandingOrder(record))
+	}
+	return orders, nil
+}
+
+func (r *memoryStandingOrderRepository) RecordExecution(
+	ctx context.Context, order StandingOrder, execution Execution,
+) (Execution, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.StandingOrders[order.ID]
+	if !ok {
+		return Execution{}, pgx.ErrNoRows
+	}
+
+	before := *record
+	record.Occurrences = order.Occurrences
+	record.Attempts = order.Attempts
+	if record.Status == StatusActive {
+		record.Status = order.Status
+		record.ScheduledAt = order.ScheduledAt
+		record.NextRunAt = order.NextRunAt
+	} else {
+		record.ScheduledAt = pgtype.Timestamptz{}
+		record.NextRunAt = pgtype.Timestamptz{}
+	}
+	record.ClaimedUntil = pgtype.Timestamptz{}
+	record.UpdatedAt = time.Now()
+	r.store.Audit(ctx, "BK_Standing_Order", record.ID, before, *record)
+
+	executionRecord := &memstore.StandingOrderExecutionRecord{
+		ID:              r.store.NextID("BK_Standing_Order_Execution"),
+		StandingOrderID: execution.StandingOrderID,
+		ScheduledAt:     execution.ScheduledAt,
+		Attempt:         execution.Attempt,
+		Status:          execution.Status,
+		TransactionID:   execution.TransactionID,
+		Error:           execution.Error,
+		DecisionID:      execution.DecisionID,
+		ExecutedAt:      time.Now(),
+	}
+	r.store.StandingOrderExecutions[executionRecord.ID] = executionRecord
+
+	return toExecution(executionRecord), nil
+}
+
+func (r *memoryStandingOrderRepository) GetExecutions(ctx context.Context, orderID int64) ([]Execution, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	executions := []Execution{}
+	for _, record := range r.store.StandingOrderExecutions {
+		if record.StandingOrderID == orderID {
+			executions = append(executions, toExecution(record))
+		}
+	}
+	sort.Slice(executions, func(i, j int) bool { return executions[i].ID < executions[j].ID })
+
+	return executions, nil
+}
+
+func (r *memoryStandingOrderRepository) SettleExecution(ctx context.Context, decisionID int64, execution Execution) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	for _, record := range r.store.StandingOrderExecutions {
+		if record.DecisionID.Valid && record.DecisionID.Int64 == decisionID && record.Status == ExecutionHeld {
+			record.Status = execution.Status
+			record.TransactionID = execution.TransactionID
+			record.Error = execution.Error
+			return nil
+		}
+	}
+	return pgx.ErrNoRows
+}
+
+// toStandingOrder joins the id numbers of the accounts. The caller must hold Mu.
+func (r *memoryStandingOrderRepository) toStandingOrder(record *memstore.StandingOrderRecord) StandingOrder {
+	order := StandingOrder{
+		ID:             record.ID,
+		FromAccountID:  record.FromAccountID,
+		ToAccountID:    record.ToAccountID,
+		Amount:         record.Amount,
+		Detail:         record.Detail,
+		Schedule:       record.Schedule,
+		TimeZone:       record.TimeZone,
+		Status:         record.Status,
+		StartAt:        record.StartAt,
+		EndAt:          record.EndAt,
+		MaxOccurrences: record.MaxOccurrences,
+		Occurrences:    record.Occurrences,
+		Attempts:       record.Attempts,
+		ScheduledAt:    record.ScheduledAt,
+		NextRunAt:      record.NextRunAt,
+		CreatedAt:      record.CreatedAt,
+		UpdatedAt:      record.UpdatedAt,
+	}
+	if from, ok := r.store.Accounts[record.FromAccountID]; ok {
+		order.FromAccount = from.IDNumber
+	}
+	if to, ok := r.store.Accounts[record.ToAccountID]; ok {
+		order.ToAccount = to.IDNumber
+	}
+	return order
+}
+
+func toExecution(record *memstore.StandingOrderExecutionRecord) Execution {
+	return Execution{
+		ID:              record.ID,
+		StandingOrderID: record.StandingOrderID,
+		ScheduledAt:     record.ScheduledAt,
+		Attempt:         record.Attempt,
+		Status:          record.Status,
+		TransactionID:   record.TransactionID,
+		Error:           record.Error,
+		DecisionID:      record.DecisionID,
+		ExecutedAt:      record.ExecutedAt,
+	}
+}
@@ -0,0 +1,302 @@
+package standingorder
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	orderColumns = `so.id, so.from_account_id, f.id_number, so.to_account_id, t.id_number, so.amount, so.detail,
+		so.schedule, so.time_zone, so.status, so.start_at, so.end_at, so.max_occurrences, so.occurrences,
+		so.attempts, so.scheduled_at, so.next_run_at, so.created_at, so.updated_at`
+	orderJoins = `
+		JOIN "BK_Account" f ON f.id = so.from_account_id
+		JOIN "BK_Account" t ON t.id = so.to_account_id`
+	orderFrom        = `"BK_Standing_Order" so` + orderJoins
+	executionColumns = `id, standing_order_id, scheduled_at, attempt, status, transaction_id, error, decision_id,
+		executed_at`
+)
+
+// StandingOrder transfers Amount from FromAccount to ToAccount at every
+// occurrence of Schedule between StartAt and EndAt, at most MaxOccurrences times.
+type StandingOrder struct {
+	ID             int64              `json:"id"`
+	FromAccountID  int64              `json:"from_account_id"`
+	FromAccount    string             `json:"from_account"`
+	ToAccountID    int64              `json:"to_account_id"`
+	ToAccount      string             `json:"to_account"`
+	Amount         float64            `json:"amount"`
+	Detail         string             `json:"detail"`
+	Schedule       string             `json:"schedule"`
+	TimeZone       string             `json:"time_zone"`
+	Status         string             `json:"status"`
+	StartAt        time.Time          `json:"start_at"`
+	EndAt          pgtype.Timestamptz `json:"end_at"`
+	MaxOccurrences pgtype.Int4        `json:"max_occurrences"`
+	// Occurrences counts the occurrences that were paid or given up on.
+	Occurrences int `json:"occurrences"`
+	// Attempts counts the failed attempts at the occurrence at ScheduledAt.
+	Attempts    int                `json:"attempts"`
+	ScheduledAt pgtype.Timestamptz `json:"scheduled_at"`
+	NextRunAt   pgtype.Timestamptz `json:"next_run_at"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+}
+
+// Execution is one attempt at an occurrence of a standing order. DecisionID
+// is the risk decision a HELD execution waits for.
+type Execution struct {
+	ID              int64       `json:"id"`
+	StandingOrderID int64       `json:"standing_order_id"`
+	ScheduledAt     time.Time   `json:"scheduled_at"`
+	Attempt         int         `json:"attempt"`
+	Status          string      `json:"status"`
+	TransactionID   pgtype.Int8 `json:"transaction_id"`
+	Error           string      `json:"error"`
+	DecisionID      pgtype.Int8 `json:"decision_id"`
+	ExecutedAt      time.Time   `json:"executed_at"`
+}
+
+type StandingOrderRepository interface {
+	CreateStandingOrder(ctx context.Context, order StandingOrder) (StandingOrder, error)
+	GetStandingOrder(ctx context.Context, id int64) (StandingOrder, error)
+	GetAccountStandingOrders(ctx context.Context, accountID int64) ([]StandingOrder, error)
+	// UpdateStandingOrder stores the status, attempts, scheduled_at and
+	// next_run_at of order if its status is still fromStatus, and returns
+	// pgx.ErrNoRows otherwise.
+	UpdateStandingOrder(ctx context.Context, order StandingOrder, fromStatus string) (StandingOrder, error)
+	// ClaimDueStandingOrders returns up to limit active orders whose next run
+	// is due at now and that are not claimed, and claims them until
+	// claimUntil so that other instances skip them.
+	ClaimDueStandingOrders(ctx context.Context, now, claimUntil time.Time, limit int) ([]StandingOrder, error)
+	// RecordExecution stores execution and the state order moves to, and
+	// releases the claim. An order paused or cancelled in the meantime keeps
+	// its status and has no next run.
+	RecordExecution(ctx context.Context, order StandingOrder, execution Execution) (Execution, error)
+	GetExecutions(ctx context.Context, orderID int64) ([]Execution, error)
+	// SettleExecution stores the status, transaction and error of the HELD
+	// execution waiting for the decision, and returns pgx.ErrNoRows when
+	// there is none.
+	SettleExecution(ctx context.Context, decisionID int64, execution Execution) error
+}
+
+type standingOrderRepositoryImpl struct {
+	pool *pgxpool.Pool
+}
+
+func NewStandingOrderRepository(pool *pgxpool.Pool) StandingOrderRepository {
+	return &standingOrderRepositoryImpl{pool: pool}
+}
+
+func (r *standingOrderRepositoryImpl) CreateStandingOrder(ctx context.Context, order StandingOrder) (StandingOrder, error) {
+	var id int64
+	err := r.pool.QueryRow(ctx,
+		`INSERT INTO "BK_Standing_Order" (
+			from_account_id, to_account_id, amount, detail, schedule, time_zone,
+			start_at, end_at, max_occurrences, scheduled_at, next_run_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10)
+		RETURNING id`,
+		order.FromAccountID, order.ToAccountID, order.Amount, order.Detail, order.Schedule, order.TimeZone,
+		order.StartAt, order.EndAt, order.MaxOccurrences, order.ScheduledAt,
+	).Scan(&id)
+	if err != nil {
+		return StandingOrder{}, err
+	}
+	return r.GetStandingOrder(ctx, id)
+}
+
+func (r *standingOrderRepositoryImpl) GetStandingOrder(ctx context.Context, id int64) (StandingOrder, error) {
+	return scanStandingOrder(r.pool.QueryRow(ctx, `SELECT `+orderColumns+` FROM `+orderFrom+` WHERE so.id = $1`, id))
+}
+
+func (r *standingOrderRepositoryImpl) GetAccountStandingOrders(ctx context.Context, accountID int64) ([]StandingOrder, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+orderColumns+` FROM `+orderFrom+` WHERE so.from_account_id = $1 ORDER BY so.id`,
+		accountID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return collectStandingOrders(rows)
+}
+
+func (r *standingOrderRepositoryImpl) UpdateStandingOrder(
+	ctx context.Context, order StandingOrder, fromStatus string,
+) (StandingOrder, error) {
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE "BK_Standing_Order"
+		SET status = $3, attempts = $4, scheduled_at = $5, next_run_at = $6
+		WHERE id = $1 AND status = $2`,
+		order.ID, fromStatus, order.Status, order.Attempts, order.ScheduledAt, order.NextRunAt,
+	)
+	if err != nil {
+		return StandingOrder{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return StandingOrder{}, pgx.ErrNoRows
+	}
+	return r.GetStandingOrder(ctx, order.ID)
+}
+
+func (r *standingOrderRepositoryImpl) ClaimDueStandingOrders(
+	ctx context.Context, now, claimUntil time.Time, limit int,
+) ([]StandingOrder, error) {
+	rows, err := r.pool.Query(ctx,
+		`WITH claimed AS (
+			UPDATE "BK_Standing_Order"
+			SET claimed_until = $2
+			WHERE id IN (
+				SELECT id FROM "BK_Standing_Order"
+				WHERE status = 'ACTIVE'
+					AND next_run_at <= $1
+					AND (claimed_until IS NULL OR claimed_until < $1)
+				ORDER BY next_run_at
+				LIMIT $3
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT `+orderColumns+` FROM claimed so`+orderJoins+`
+		ORDER BY so.next_run_at`,
+		now, claimUntil, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return collectStandingOrders(rows)
+}
+
+func (r *standingOrderRepositoryImpl) RecordExecution(
+	ctx context.Context, order StandingOrder, execution Execution,
+) (Execution, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return Execution{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`UPDATE "BK_Standing_Order"
+		SET occurrences = $2,
+			attempts = $3,
+			status = CASE WHEN status = 'ACTIVE' THEN $4::STANDING_ORDER_STATUS ELSE status END,
+			scheduled_at = CASE WHEN status = 'ACTIVE' THEN $5::TIMESTAMPTZ END,
+			next_run_at = CASE WHEN status = 'ACTIVE' THEN $6::TIMESTAMPTZ END,
+			claimed_until = NULL
+		WHERE id = $1`,
+		order.ID, order.Occurrences, order.Attempts, order.Status, order.ScheduledAt, order.NextRunAt,
+	)
+	if err != nil {
+		return Execution{}, err
+	}
+
+	recorded, err := scanExecution(tx.QueryRow(ctx,
+		`INSERT INTO "BK_Standing_Order_Execution" (
+			standing_order_id, scheduled_at, attempt, status, transaction_id, error, decision_id
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+executionColumns,
+		execution.StandingOrderID, execution.ScheduledAt, execution.Attempt, execution.Status,
+		execution.TransactionID, execution.Error, execution.DecisionID,
+	))
+	if err != nil {
+		return Execution{}, err
+	}
+
+	return recorded, tx.Commit(ctx)
+}
+
+func (r *standingOrderRepositoryImpl) GetExecutions(ctx context.Context, orderID int64) ([]Execution, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+executionColumns+` FROM "BK_Standing_Order_Execution"
+		WHERE standing_order_id = $1
+		ORDER BY executed_at, id`,
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	executions := []Execution{}
+	for rows.Next() {
+		execution, err := scanExecution(rows)
+		if err != nil {
+			return nil, err
+		}
+		executions = append(executions, execution)
+	}
+	return executions, rows.Err()
+}
+
+func (r *standingOrderRepositoryImpl) SettleExecution(ctx context.Context, decisionID int64, execution Execution) error {
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE "BK_Standing_Order_Execution"
+		SET status = $2, transaction_id = $3, error = $4
+		WHERE decision_id = $1 AND status = 'HELD'`,
+		decisionID, execution.Status, execution.TransactionID, execution.Error,
+	)
+	if err == nil && tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return err
+}
+
+func collectStandingOrders(rows pgx.Rows) ([]StandingOrder, error) {
+	defer rows.Close()
+
+	orders := []StandingOrder{}
+	for rows.Next() {
+		order, err := scanStandingOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+func scanStandingOrder(row pgx.Row) (StandingOrder, error) {
+	var order StandingOrder
+	err := row.Scan(
+		&order.ID,
+		&order.FromAccountID,
+		&order.FromAccount,
+		&order.ToAccountID,
+		&order.ToAccount,
+		&order.Amount,
+		&order.Detail,
+		&order.Schedule,
+		&order.TimeZone,
+		&order.Status,
+		&order.StartAt,
+		&order.EndAt,
+		&order.MaxOccurrences,
+		&order.Occurrences,
+		&order.Attempts,
+		&order.ScheduledAt,
+		&order.NextRunAt,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+	)
+	return order, err
+}
+
+func scanExecution(row pgx.Row) (Execution, error) {
+	var execution Execution
+	err := row.Scan(
+		&execution.ID,
+		&execution.StandingOrderID,
+		&execution.ScheduledAt,
+		&execution.Attempt,
+		&execution.Status,
+		&execution.TransactionID,
+		&execution.Error,
+		&execution.DecisionID,
+		&execution.ExecutedAt,
+	)
+	return execution, err
+}
@@ -0,0 +1,226 @@
+package standingorder
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// MinInterval is the shortest time allowed between two occurrences.
+	MinInterval = time.Hour
+
+	// maxPeriods bounds the search for the next occurrence of an RRULE, e.g.
+	// FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=30 started in February never occurs.
+	maxPeriods = 10000
+)
+
+// Schedule yields the occurrences of a standing order.
+type Schedule interface {
+	// Next returns the first occurrence after t, the zero time when there is none.
+	Next(t time.Time) time.Time
+}
+
+// ParseSchedule accepts a cron expression with five fields or a descriptor
+// such as @monthly, e.g. "0 9 1 * *", or an RRULE, e.g.
+// "RRULE:FREQ=MONTHLY;BYMONTHDAY=-1". Both are evaluated in loc unless a cron
+// expression sets CRON_TZ. An RRULE starts at start and repeats its time of
+// day; FREQ, INTERVAL, BYDAY (weekly) and BYMONTHDAY (monthly) are supported.
+func ParseSchedule(spec string, loc *time.Location, start time.Time) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	var (
+		schedule Schedule
+		err      error
+	)
+	if rule, ok := strings.CutPrefix(strings.ToUpper(spec), "RRULE:"); ok {
+		schedule, err = parseRRule(rule, start.In(loc))
+	} else if strings.HasPrefix(strings.ToUpper(spec), "FREQ=") {
+		schedule, err = parseRRule(strings.ToUpper(spec), start.In(loc))
+	} else {
+		if !strings.HasPrefix(spec, "CRON_TZ=") && !strings.HasPrefix(spec, "TZ=") {
+			spec = "CRON_TZ=" + loc.String() + " " + spec
+		}
+		schedule, err = cron.ParseStandard(spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Sample the first occurrences, the gaps of a cron expression vary.
+	prev := schedule.Next(start.Add(-time.Second))
+	for range 10 {
+		if prev.IsZero() {
+			break
+		}
+		next := schedule.Next(prev)
+		if !next.IsZero() && next.Sub(prev) < MinInterval {
+			return nil, fmt.Errorf("occurrences must be at least %v apart", MinInterval)
+		}
+		prev = next
+	}
+	return schedule, nil
+}
+
+type rrule struct {
+	freq       string
+	interval   int
+	byDay      []time.Weekday
+	byMonthDay []int
+	start      time.Time
+}
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+func parseRRule(rule string, start time.Time) (*rrule, error) {
+	r := &rrule{interval: 1, start: start}
+
+	for _, part := range strings.Split(strings.TrimSuffix(rule, ";"), ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid RRULE part %q", part)
+		}
+
+		switch name {
+		case "FREQ":
+			switch value {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				r.freq = value
+			default:
+				return nil, fmt.Errorf("unsupported FREQ %s, use DAILY, WEEKLY, MONTHLY or YEARLY", value)
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 {
+				return nil, fmt.Errorf("INTERVAL must be a positive number")
+			}
+			r.interval = interval
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := weekdays[day]
+				if !ok {
+					return nil, fmt.Errorf("invalid BYDAY %s", day)
+				}
+				r.byDay = append(r.byDay, weekday)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("invalid BYMONTHDAY %s", day)
+				}
+				r.byMonthDay = append(r.byMonthDay, n)
+			}
+		case "COUNT", "UNTIL":
+			return nil, fmt.Errorf("%s is not supported, use max_occurrences and end_at", name)
+		default:
+			return nil, fmt.Errorf("unsupported RRULE part %s", name)
+		}
+	}
+
+	switch {
+	case r.freq == "":
+		return nil, errors.New("RRULE needs a FREQ")
+	case r.byDay != nil && r.freq != "WEEKLY":
+		return nil, errors.New("BYDAY is only supported with FREQ=WEEKLY")
+	case r.byMonthDay != nil && r.freq != "MONTHLY":
+		return nil, errors.New("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	}
+	if r.freq == "WEEKLY" && r.byDay == nil {
+		r.byDay = []time.Weekday{start.Weekday()}
+	}
+	if r.freq == "MONTHLY" && r.byMonthDay == nil {
+		r.byMonthDay = []int{start.Day()}
+	}
+	return r, nil
+}
+
+func (r *rrule) Next(t time.Time) time.Time {
+	first := r.period(t) - 1
+	first = max(first-first%r.interval, 0)
+
+	for period := first; period < first+maxPeriods*r.interval; period += r.interval {
+		for _, occurrence := range r.occurrences(period) {
+			if !occurrence.Before(r.start) && occurrence.After(t) {
+				return occurrence
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// period returns how many periods of the frequency lie between the start and t.
+func (r *rrule) period(t time.Time) int {
+	t = t.In(r.start.Location())
+	switch r.freq {
+	case "DAILY":
+		return int(t.Sub(r.start).Hours() / 24)
+	case "WEEKLY":
+		return int(t.Sub(r.start).Hours() / 24 / 7)
+	case "MONTHLY":
+		return (t.Year()-r.start.Year())*12 + int(t.Month()-r.start.Month())
+	default:
+		return t.Year() - r.start.Year()
+	}
+}
+
+// occurrences returns the sorted occurrences in the nth period after the start.
+func (r *rrule) occurrences(n int) []time.Time {
+	s := r.start
+	at := func(year int, month time.Month, day int) time.Time {
+		t := time.Date(year, month, day, s.Hour(), s.Minute(), s.Second(), 0, s.Location())
+		if t.Hour() != s.Hour() || t.Minute() != s.Minute() {
+			// The clocks skip the time, e.g. 02:30 when DST starts: take it
+			// at the offset before the change, 03:30 after it.
+			_, offset := t.Zone()
+			wall := time.Date(t.Year(), t.Month(), t.Day(), s.Hour(), s.Minute(), s.Second(), 0, time.UTC)
+			t = wall.Add(-time.Duration(offset) * time.Second).In(s.Location())
+		}
+		return t
+	}
+
+	var occurrences []time.Time
+	switch r.freq {
+	case "DAILY":
+		occurrences = append(occurrences, at(s.Year(), s.Month(), s.Day()+n))
+	case "WEEKLY":
+		monday := s.Day() - (int(s.Weekday())+6)%7 + 7*n
+		for _, weekday := range r.byDay {
+			occurrences = append(occurrences, at(s.Year(), s.Month(), monday+(int(weekday)+6)%7))
+		}
+	case "MONTHLY":
+		month := time.Date(s.Year(), s.Month()+time.Month(n), 1, 0, 0, 0, 0, s.Location())
+		days := time.Date(month.Year(), month.Month()+1, 0, 0, 0, 0, 0, s.Location()).Day()
+		for _, day := range r.byMonthDay {
+			if day < 0 {
+				day += days + 1
+			}
+			// Days the month does not have are skipped.
+			if day >= 1 && day <= days {
+				occurrences = append(occurrences, at(month.Year(), month.Month(), day))
+			}
+		}
+	case "YEARLY":
+		occurrence := at(s.Year()+n, s.Month(), s.Day())
+		// 29 February only occurs in leap years.
+		if occurrence.Day() == s.Day() {
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+
+	sort.Slice(occurrences, func(i, j int) bool { return occurrences[i].Before(occurrences[j]) })
+	return occurrences
+}
@@ -0,0 +1,146 @@
+package standingorder
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// occurrences returns the first n occurrences of spec from start.
+func occurrences(t *testing.T, spec string, loc *time.Location, start time.Time, n int) []time.Time {
+	t.Helper()
+	schedule, err := ParseSchedule(spec, loc, start)
+	if err != nil {
+		t.Fatalf("ParseSchedule(%q): %v", spec, err)
+	}
+	var got []time.Time
+	for next := schedule.Next(start.Add(-time.Second)); !next.IsZero() && len(got) < n; next = schedule.Next(next) {
+		got = append(got, next)
+	}
+	return got
+}
+
+func TestScheduleOccurrences(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(loc *time.Location, year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name  string
+		spec  string
+		loc   *time.Location
+		start time.Time
+		want  []time.Time
+	}{
+		{
+			"cron in the location",
+			"0 9 1 * *", newYork, at(newYork, 2026, 1, 15, 0, 0),
+			[]time.Time{at(newYork, 2026, 2, 1, 9, 0), at(newYork, 2026, 3, 1, 9, 0)},
+		},
+		{
+			"cron with its own CRON_TZ",
+			"CRON_TZ=UTC 0 9 * * 1", newYork, at(time.UTC, 2026, 6, 1, 0, 0),
+			[]time.Time{at(time.UTC, 2026, 6, 1, 9, 0), at(time.UTC, 2026, 6, 8, 9, 0)},
+		},
+		{
+			"cron keeps the local time across the spring DST change",
+			"0 9 * * *", newYork, at(newYork, 2026, 3, 7, 0, 0),
+			[]time.Time{at(newYork, 2026, 3, 7, 9, 0), at(newYork, 2026, 3, 8, 9, 0), at(newYork, 2026, 3, 9, 9, 0)},
+		},
+		{
+			"daily RRULE keeps the local time across the autumn DST change",
+			"RRULE:FREQ=DAILY", newYork, at(newYork, 2026, 10, 31, 9, 0),
+			[]time.Time{at(newYork, 2026, 10, 31, 9, 0), at(newYork, 2026, 11, 1, 9, 0), at(newYork, 2026, 11, 2, 9, 0)},
+		},
+		{
+			"daily RRULE at a time the spring DST change skips",
+			"RRULE:FREQ=DAILY", newYork, at(newYork, 2026, 3, 7, 2, 30),
+			// 02:30 does not exist on 8 March and becomes 03:30 EDT.
+			[]time.Time{at(newYork, 2026, 3, 7, 2, 30), at(newYork, 2026, 3, 8, 3, 30), at(newYork, 2026, 3, 9, 2, 30)},
+		},
+		{
+			"weekly RRULE on two days",
+			"RRULE:FREQ=WEEKLY;BYDAY=MO,FR", time.UTC, at(time.UTC, 2026, 6, 3, 8, 0),
+			[]time.Time{at(time.UTC, 2026, 6, 5, 8, 0), at(time.UTC, 2026, 6, 8, 8, 0), at(time.UTC, 2026, 6, 12, 8, 0)},
+		},
+		{
+			"fortnightly RRULE",
+			"FREQ=WEEKLY;INTERVAL=2", time.UTC, at(time.UTC, 2026, 6, 3, 8, 0),
+			[]time.Time{at(time.UTC, 2026, 6, 3, 8, 0), at(time.UTC, 2026, 6, 17, 8, 0), at(time.UTC, 2026, 7, 1, 8, 0)},
+		},
+		{
+			"last day of the month",
+			"RRULE:FREQ=MONTHLY;BYMONTHDAY=-1", time.UTC, at(time.UTC, 2027, 12, 31, 12, 0),
+			[]time.Time{at(time.UTC, 2027, 12, 31, 12, 0), at(time.UTC, 2028, 1, 31, 12, 0),
+				at(time.UTC, 2028, 2, 29, 12, 0), at(time.UTC, 2028, 3, 31, 12, 0), at(time.UTC, 2028, 4, 30, 12, 0)},
+		},
+		{
+			"the 31st skips shorter months",
+			"RRULE:FREQ=MONTHLY;BYMONTHDAY=31", time.UTC, at(time.UTC, 2026, 1, 31, 12, 0),
+			[]time.Time{at(time.UTC, 2026, 1, 31, 12, 0), at(time.UTC, 2026, 3, 31, 12, 0), at(time.UTC, 2026, 5, 31, 12, 0)},
+		},
+		{
+			"monthly RRULE repeats the day of the start",
+			"rrule:freq=monthly", time.UTC, at(time.UTC, 2026, 1, 15, 12, 0),
+			[]time.Time{at(time.UTC, 2026, 1, 15, 12, 0), at(time.UTC, 2026, 2, 15, 12, 0)},
+		},
+		{
+			"29 February only in leap years",
+			"RRULE:FREQ=YEARLY", time.UTC, at(time.UTC, 2024, 2, 29, 12, 0),
+			[]time.Time{at(time.UTC, 2024, 2, 29, 12, 0), at(time.UTC, 2028, 2, 29, 12, 0), at(time.UTC, 2032, 2, 29, 12, 0)},
+		},
+		{
+			"a rule that never occurs again",
+			"RRULE:FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=30", time.UTC, at(time.UTC, 2026, 2, 1, 12, 0),
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := occurrences(t, tt.spec, tt.loc, tt.start, len(tt.want))
+			if len(got) != len(tt.want) {
+				t.Fatalf("occurrences %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("occurrence %d at %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	start := time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		spec, want string
+	}{
+		{"* * * * *", "at least"},
+		{"*/30 * * * *", "at least"},
+		{"61 * * * *", ""},
+		{"0 9 * *", ""},
+		{"RRULE:", "invalid RRULE part"},
+		{"RRULE:INTERVAL=2", "needs a FREQ"},
+		{"RRULE:FREQ=HOURLY", "unsupported FREQ"},
+		{"RRULE:FREQ=DAILY;INTERVAL=0", "INTERVAL"},
+		{"RRULE:FREQ=WEEKLY;BYDAY=XX", "invalid BYDAY"},
+		{"RRULE:FREQ=MONTHLY;BYDAY=MO", "BYDAY is only supported"},
+		{"RRULE:FREQ=MONTHLY;BYMONTHDAY=32", "invalid BYMONTHDAY"},
+		{"RRULE:FREQ=MONTHLY;BYMONTHDAY=0", "invalid BYMONTHDAY"},
+		{"RRULE:FREQ=WEEKLY;BYMONTHDAY=1", "BYMONTHDAY is only supported"},
+		{"RRULE:FREQ=DAILY;COUNT=3", "max_occurrences"},
+		{"RRULE:FREQ=DAILY;UNTIL=20270101", "end_at"},
+		{"RRULE:FREQ=DAILY;BYHOUR=9", "unsupported RRULE part"},
+	}
+	for _, tt := range tests {
+		_, err := ParseSchedule(tt.spec, time.UTC, start)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseSchedule(%q): err %v, want %q", tt.spec, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package standingorder
+
+import (
+	"bank_system/pkg/account"
+	"bank_system/postgres/sqlc"
+	"bank_system/utils"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	StatusActive    = "ACTIVE"
+	StatusPaused    = "PAUSED"
+	StatusCancelled = "CANCELLED"
+	StatusCompleted = "COMPLETED"
+
+	ExecutionSucceeded = "SUCCEEDED"
+	ExecutionRetrying  = "RETRYING"
+	ExecutionFailed    = "FAILED"
+	// ExecutionHeld is an occurrence the risk engine held for review, made
+	// if an operator approves it.
+	ExecutionHeld = "HELD"
+
+	DefaultTimeZone      = "UTC"
+	DefaultMaxAttempts   = 3
+	DefaultRetryInterval = time.Hour
+	DefaultBatchSize     = 100
+
+	// ClaimTTL is how long an instance may take to execute a claimed order
+	// before other instances consider it abandoned.
+	ClaimTTL = 5 * time.Minute
+
+	SCHEDULE_MAX_LENGTH  = 256 // "BK_Standing_Order".schedule VARCHAR(256)
+	TIME_ZONE_MAX_LENGTH = 64  // "BK_Standing_Order".time_zone VARCHAR(64)
+)
+
+// Accounts is what standing orders need of account.AccountService.
+type Accounts interface {
+	GetAccountByIDNumber(ctx context.Context, idNumber string) (*sqlc.GetAccountByIDNumberRow, error)
+	AuthorizeStepUp(ctx context.Context, idNumber string, amount float64, code string) error
+	CheckRecipient(ctx context.Context, movement account.Movement) error
+	AuthorizeMovement(ctx context.Context, movement account.Movement, code string) (*account.Review, error)
+	Transfer(ctx context.Context, fromIDNumber, toIDNumber string, amount float64, detail string) (int64, float64, error)
+}
+
+// RetryPolicy applies to occurrences that fail for lack of funds or a passing
+// error, e.g. a lost connection. An occurrence is tried MaxAttempts times,
+// Interval apart, before it is given up on.
+type RetryPolicy struct {
+	MaxAttempts int
+	Interval    time.Duration
+}
+
+type StandingOrderService struct {
+	repo      StandingOrderRepository
+	accounts  Accounts
+	retry     RetryPolicy
+	batchSize int
+}
+
+// NewStandingOrderService creates the service. Zero values of retry and
+// batchSize, the number of orders executed per ExecuteDue, use the defaults.
+func NewStandingOrderService(
+	repo StandingOrderRepository, accounts Accounts, retry RetryPolicy, batchSize int,
+) *StandingOrderService {
+	if retry.MaxAttempts <= 0 {
+		retry.MaxAttempts = DefaultMaxAttempts
+	}
+	if retry.Interval <= 0 {
+		retry.Interval = DefaultRetryInterval
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	return &StandingOrderService{
+		repo:      repo,
+		accounts:  accounts,
+		retry:     retry,
+		batchSize: batchSize,
+	}
+}
+
+// CreateStandingOrder sets up order from the account idNumber. order.StartAt
+// defaults to now and order.TimeZone to DefaultTimeZone; amounts above the
+// step-up threshold need otpCode. The recipient must pass the recipient check
+// now, and every occurrence is authorized again when it is made.
+func (s *StandingOrderService) CreateStandingOrder(
+	ctx context.Context, idNumber string, order StandingOrder, otpCode string,
+) (StandingOrder, error) {
+	from, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return StandingOrder{}, err
+	}
+
+	now := time.Now()
+	if order.StartAt.IsZero() {
+		order.StartAt = now
+	}
+	if order.TimeZone == "" {
+		order.TimeZone = DefaultTimeZone
+	}
+
+	verr := &utils.ValidationError{}
+	utils.ValidateAmount(verr, order.Amount, from.CurrencyCode)
+	utils.ValidateDetail(verr, order.Detail)
+	if order.StartAt.Before(now.Add(-time.Minute)) {
+		verr.Add("start_at", "must not be in the past")
+	}
+	if order.EndAt.Valid && !order.EndAt.Time.After(order.StartAt) {
+		verr.Add("end_at", "must be after start_at")
+	}
+	if order.MaxOccurrences.Valid && order.MaxOccurrences.Int32 <= 0 {
+		verr.Add("max_occurrences", "must be positive")
+	}
+
+	var schedule Schedule
+	loc, err := loadLocation(order.TimeZone)
+	if err != nil {
+		verr.Add("time_zone", "is not a known time zone")
+	}
+	switch {
+	case order.Schedule == "":
+		verr.Add("schedule", "is required")
+	case len(order.Schedule) > SCHEDULE_MAX_LENGTH:
+		verr.Add("schedule", fmt.Sprintf("must be at most %d characters", SCHEDULE_MAX_LENGTH))
+	case loc != nil:
+		if schedule, err = ParseSchedule(order.Schedule, loc, order.StartAt); err != nil {
+			verr.Add("schedule", err.Error())
+		}
+	}
+	if err := verr.Err(); err != nil {
+		return StandingOrder{}, err
+	}
+
+	first, ok := nextOccurrence(order, schedule, order.StartAt.Add(-time.Second))
+	if !ok {
+		verr.Add("schedule", "has no occurrence between start_at and end_at")
+		return StandingOrder{}, verr
+	}
+
+	to, err := s.getAccount(ctx, order.ToAccount)
+	if err != nil {
+		return StandingOrder{}, err
+	}
+	if to.ID == from.ID {
+		return StandingOrder{}, utils.NewBankSystemError(utils.ErrSameAccountTransfer, idNumber)
+	}
+
+	if err := s.accounts.CheckRecipient(ctx, s.movement(order, idNumber)); err != nil {
+		return StandingOrder{}, err
+	}
+	if err := s.accounts.AuthorizeStepUp(ctx, idNumber, order.Amount, otpCode); err != nil {
+		return StandingOrder{}, err
+	}
+
+	order.FromAccountID = from.ID
+	order.ToAccountID = to.ID
+	order.ScheduledAt = timestamptz(first)
+	return s.repo.CreateStandingOrder(ctx, order)
+}
+
+func (s *StandingOrderService) GetAccountStandingOrders(ctx context.Context, idNumber string) ([]StandingOrder, error) {
+	account, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetAccountStandingOrders(ctx, account.ID)
+}
+
+func (s *StandingOrderService) GetStandingOrder(ctx context.Context, idNumber string, orderID int64) (StandingOrder, error) {
+	return s.getOrder(ctx, idNumber, orderID)
+}
+
+func (s *StandingOrderService) GetExecutions(ctx context.Context, idNumber string, orderID int64) ([]Execution, error) {
+	order, err := s.getOrder(ctx, idNumber, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetExecutions(ctx, order.ID)
+}
+
+// PauseStandingOrder stops an active order until it is resumed.
+func (s *StandingOrderService) PauseStandingOrder(ctx context.Context, idNumber string, orderID int64) (StandingOrder, error) {
+	order, err := s.getOrder(ctx, idNumber, orderID)
+	if err != nil {
+		return StandingOrder{}, err
+	}
+	if order.Status != StatusActive {
+		return StandingOrder{}, statusError(order)
+	}
+
+	order.Status = StatusPaused
+	return s.update(ctx, order, StatusActive)
+}
+
+// ResumeStandingOrder continues a paused order with its next occurrence after
+// now; the occurrences it missed while paused are skipped.
+func (s *StandingOrderService) ResumeStandingOrder(ctx context.Context, idNumber string, orderID int64) (StandingOrder, error) {
+	order, err := s.getOrder(ctx, idNumber, orderID)
+	if err != nil {
+		return StandingOrder{}, err
+	}
+	if order.Status != StatusPaused {
+		return StandingOrder{}, statusError(order)
+	}
+
+	schedule, err := parseOrderSchedule(order)
+	if err != nil {
+		return StandingOrder{}, err
+	}
+	order.Status = StatusActive
+	if next, ok := nextOccurrence(order, schedule, time.Now()); ok {
+		order.ScheduledAt = timestamptz(next)
+		order.NextRunAt = timestamptz(next)
+	} else {
+		order.Status = StatusCompleted
+	}
+	return s.update(ctx, order, StatusPaused)
+}
+
+// CancelStandingOrder ends an active or paused order for good.
+func (s *StandingOrderService) CancelStandingOrder(ctx context.Context, idNumber string, orderID int64) (StandingOrder, error) {
+	order, err := s.getOrder(ctx, idNumber, orderID)
+	if err != nil {
+		return StandingOrder{}, err
+	}
+	if order.Status != StatusActive && order.Status != StatusPaused {
+		return StandingOrder{}, statusError(order)
+	}
+
+	from := order.Status
+	order.Status = StatusCancelled
+	return s.update(ctx, order, from)
+}
+
+// ExecuteDue executes the orders whose next run is due at now, at most the
+// batch size per call, and returns how many transfers succeeded. Orders that
+// could not be executed are left to a later call.
+func (s *StandingOrderService) ExecuteDue(ctx context.Context, now time.Time) (int, error) {
+	orders, err := s.repo.ClaimDueStandingOrders(ctx, now, now.Add(ClaimTTL), s.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		succeeded int
+		errs      []error
+	)
+	for _, order := range orders {
+		execution, err := s.execute(ctx, order, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("standing order %d: %w", order.ID, err))
+			continue
+		}
+		if execution.Status == ExecutionSucceeded {
+			succeeded++
+		}
+	}
+	return succeeded, errors.Join(errs...)
+}
+
+// execute makes one attempt at the current occurrence of a claimed order and
+// records it. After a success, a hold for review or the last failed attempt,
+// the order moves on to its next occurrence, which catches up one missed
+// occurrence at a time.
+func (s *StandingOrderService) execute(ctx context.Context, order StandingOrder, now time.Time) (Execution, error) {
+	schedule, err := parseOrderSchedule(order)
+	if err != nil {
+		return Execution{}, err
+	}
+
+	execution := Execution{
+		StandingOrderID: order.ID,
+		ScheduledAt:     order.ScheduledAt.Time,
+		Attempt:         order.Attempts + 1,
+	}
+
+	var txID int64
+	transferCtx, cancel := context.WithTimeout(ctx, utils.TIMEOUT)
+	review, err := s.accounts.AuthorizeMovement(transferCtx, s.movement(order, order.FromAccount), "")
+	if err == nil && review == nil {
+		txID, _, err = s.accounts.Transfer(transferCtx, order.FromAccount, order.ToAccount, order.Amount, order.Detail)
+	}
+	cancel()
+
+	switch {
+	case err == nil && review != nil:
+		execution.Status = ExecutionHeld
+		execution.Error = utils.NewBankSystemError(utils.ErrTransactionHeld, strconv.FormatInt(review.DecisionID, 10)).Error()
+		execution.DecisionID = pgtype.Int8{Int64: review.DecisionID, Valid: true}
+	case err == nil:
+		execution.Status = ExecutionSucceeded
+		execution.TransactionID = pgtype.Int8{Int64: txID, Valid: true}
+	case retryable(err) && execution.Attempt < s.retry.MaxAttempts:
+		execution.Status = ExecutionRetrying
+		execution.Error = err.Error()
+		order.Attempts = execution.Attempt
+		order.NextRunAt = timestamptz(now.Add(s.retry.Interval))
+		return s.repo.RecordExecution(ctx, order, execution)
+	default:
+		execution.Status = ExecutionFailed
+		execution.Error = err.Error()
+	}
+
+	order.Occurrences++
+	order.Attempts = 0
+	if next, ok := nextOccurrence(order, schedule, order.ScheduledAt.Time); ok {
+		order.ScheduledAt = timestamptz(next)
+		order.NextRunAt = timestamptz(next)
+	} else {
+		order.Status = StatusCompleted
+		order.ScheduledAt = pgtype.Timestamptz{}
+		order.NextRunAt = pgtype.Timestamptz{}
+	}
+	return s.repo.RecordExecution(ctx, order, execution)
+}
+
+// SettleReview is the risk.Settler of the executions held for review: an
+// approved one succeeded with the transaction of the review, a rejected one
+// failed. The occurrence was counted when it was held.
+func (s *StandingOrderService) SettleReview(ctx context.Context, decisionID, txID int64, reviewErr error) error {
+	execution := Execution{
+		Status:        ExecutionSucceeded,
+		TransactionID: pgtype.Int8{Int64: txID, Valid: true},
+	}
+	if reviewErr != nil {
+		execution = Execution{Status: ExecutionFailed, Error: reviewErr.Error()}
+	}
+
+	err := s.repo.SettleExecution(ctx, decisionID, execution)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+// movement is an occurrence of order from the account idNumber.
+func (s *StandingOrderService) movement(order StandingOrder, idNumber string) account.Movement {
+	return account.Movement{
+		Type:            account.MovementTransfer,
+		AccountNumber:   idNumber,
+		Amount:          order.Amount,
+		Detail:          order.Detail,
+		ToAccountNumber: order.ToAccount,
+		Scheduled:       true,
+	}
+}
+
+// update stores a status change. Orders that are no longer active, paused or
+// finished have no next run.
+func (s *StandingOrderService) update(ctx context.Context, order StandingOrder, fromStatus string) (StandingOrder, error) {
+	order.Attempts = 0
+	if order.Status != StatusActive {
+		order.ScheduledAt = pgtype.Timestamptz{}
+		order.NextRunAt = pgtype.Timestamptz{}
+	}
+
+	updated, err := s.repo.UpdateStandingOrder(ctx, order, fromStatus)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The status changed since the order was read.
+		return StandingOrder{}, utils.NewBankSystemError(utils.ErrStandingOrderStatus, strconv.FormatInt(order.ID, 10))
+	}
+	return updated, err
+}
+
+func (s *StandingOrderService) getAccount(ctx context.Context, idNumber string) (*sqlc.GetAccountByIDNumberRow, error) {
+	account, err := s.accounts.GetAccountByIDNumber(ctx, idNumber)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, utils.NewBankSystemError(utils.ErrAccountNotFound, idNumber)
+	}
+	return account, err
+}
+
+// getOrder returns the order if it belongs to the account idNumber.
+func (s *StandingOrderService) getOrder(ctx context.Context, idNumber string, orderID int64) (StandingOrder, error) {
+	account, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return StandingOrder{}, err
+	}
+
+	order, err := s.repo.GetStandingOrder(ctx, orderID)
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && order.FromAccountID != account.ID {
+		return StandingOrder{}, utils.NewBankSystemError(utils.ErrStandingOrderNotFound, strconv.FormatInt(orderID, 10))
+	}
+	return order, err
+}
+
+// nextOccurrence returns the first occurrence of order after t, false when
+// the order is finished.
+func nextOccurrence(order StandingOrder, schedule Schedule, t time.Time) (time.Time, bool) {
+	if order.MaxOccurrences.Valid && order.Occurrences >= int(order.MaxOccurrences.Int32) {
+		return time.Time{}, false
+	}
+	next := schedule.Next(t)
+	if next.IsZero() || order.EndAt.Valid && next.After(order.EndAt.Time) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+func parseOrderSchedule(order StandingOrder) (Schedule, error) {
+	loc, err := loadLocation(order.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSchedule(order.Schedule, loc, order.StartAt)
+}
+
+// loadLocation rejects "Local", which would depend on the server.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "Local" || len(name) > TIME_ZONE_MAX_LENGTH {
+		return nil, fmt.Errorf("unknown time zone %s", name)
+	}
+	return time.LoadLocation(name)
+}
+
+// retryable reports whether a failed transfer may succeed later: the funds
+// were insufficient, a daily or monthly limit was reached or the error is not
+// a validation or business error.
+func retryable(err error) bool {
+	var bsErr *utils.BankSystemError
+	return utils.IsBankSystemError(err, utils.ErrInsufficientBalance) ||
+		utils.IsBankSystemError(err, utils.ErrLimitExceeded) ||
+		!errors.As(err, &bsErr) && !utils.IsValidationError(err)
+}
+
+func statusError(order StandingOrder) error {
+	return utils.NewBankSystemError(utils.ErrStandingOrderStatus, strconv.FormatInt(order.ID, 10), order.Status)
+}
+
+func timestamptz(t time.Time) pgtype.Timestamptz {
+	return pgtype.Timestamptz{Time: t, Valid: true}
+}
@@ -0,0 +1,199 @@
+package statement
+
+import (
+	"bank_system/utils"
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type StatementController struct {
+	service *StatementService
+	logger  *log.Logger
+}
+
+func NewStatementController(service *StatementService, logger *log.Logger) *StatementController {
+	return &StatementController{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// GenerateStatement serves the statement of the days from and to, both
+// included, as YYYY-MM-DD in UTC.
+func (c *StatementController) GenerateStatement(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+	format, ok := formatParam(ctx)
+	if !ok {
+		return
+	}
+	from, to, ok := periodParams(ctx)
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	statement, err := c.service.GenerateStatement(reqCtx, idNumber, from, to)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	c.render(ctx, statement, format)
+}
+
+// ExportTransactions streams the transactions of the days from and to, both
+// included, as YYYY-MM-DD in UTC, in the format of the format query
+// parameter: ofx, qif or camt053.
+func (c *StatementController) ExportTransactions(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+	format := ctx.Query("format")
+	contentType, ok := ExportContentType(format)
+	if !ok {
+		verr := &utils.ValidationError{}
+		verr.Add("format", "must be one of ofx, qif, camt053")
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(verr))
+		return
+	}
+	from, to, ok := periodParams(ctx)
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	summary, err := c.service.PrepareExport(reqCtx, idNumber, from, to)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	// The status is sent with the first bytes, a failure after them can only
+	// cut the download short.
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("Content-Disposition", `attachment; filename="`+ExportFilename(summary, format)+`"`)
+	ctx.Status(http.StatusOK)
+	if err := c.service.WriteExport(reqCtx, ctx.Writer, summary, format); err != nil {
+		c.logger.Printf("Failed to export transactions of %s: %v\n", idNumber, err)
+	}
+}
+
+func (c *StatementController) GetAccountStatements(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	statements, err := c.service.GetAccountStatements(reqCtx, idNumber)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, statements)
+}
+
+func (c *StatementController) GetStatement(ctx *gin.Context) {
+	idNumber := ctx.Param("id_number")
+	statementID, err := strconv.ParseInt(ctx.Param("statement_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	format, ok := formatParam(ctx)
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	statement, err := c.service.GetStatement(reqCtx, idNumber, statementID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	c.render(ctx, statement, format)
+}
+
+// render sends statement as a download in format.
+func (c *StatementController) render(ctx *gin.Context, statement Statement, format string) {
+	var buf bytes.Buffer
+	if err := Render(&buf, statement, format); err != nil {
+		c.logger.Printf("Failed to render statement: %v\n", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	contentType, _ := ContentType(format)
+	ctx.Header("Content-Disposition", `attachment; filename="`+Filename(statement, format)+`"`)
+	ctx.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// formatParam reads the format query parameter, FormatJSON by default.
+func formatParam(ctx *gin.Context) (string, bool) {
+	format := ctx.DefaultQuery("format", FormatJSON)
+	if _, ok := ContentType(format); !ok {
+		verr := &utils.ValidationError{}
+		verr.Add("format", "must be one of json, csv, pdf")
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(verr))
+		return "", false
+	}
+	return format, true
+}
+
+// periodParams reads the from and to query parameters, the first and the last
+// day of a period, and returns the period as [from, to + 1 day).
+func periodParams(ctx *gin.Context) (time.Time, time.Time, bool) {
+	verr := &utils.ValidationError{}
+	from, err := time.Parse(time.DateOnly, ctx.Query("from"))
+	if err != nil {
+		verr.Add("from", "must be a date as YYYY-MM-DD")
+	}
+	to, err := time.Parse(time.DateOnly, ctx.Query("to"))
+	if err != nil {
+		verr.Add("to", "must be a date as YYYY-MM-DD")
+	}
+	if err := verr.Err(); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to.AddDate(0, 0, 1), true
+}
+
+func errorStatus(err error) int {
+	switch {
+	case utils.IsValidationError(err):
+		return http.StatusBadRequest
+	case utils.IsBankSystemError(err, utils.ErrAccountNotFound),
+		utils.IsBankSystemError(err, utils.ErrStatementNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RegisterRoutes serves the statements and exports of an account only to its
+// owner, behind the owner middleware.
+func (c *StatementController) RegisterRoutes(router *gin.Engine, owner gin.HandlerFunc) {
+	group := router.Group("/accounts/:id_number", owner)
+	{
+		group.GET("/statement", c.GenerateStatement)
+		group.GET("/statements", c.GetAccountStatements)
+		group.GET("/statements/:statement_id", c.GetStatement)
+		group.GET("/export", c.ExportTransactions)
+	}
+}
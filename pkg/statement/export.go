@@ -0,0 +1,387 @@
+package statement
+
+import (
+	"bank_system/pkg/transaction"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatOFX     = "ofx"
+	FormatQIF     = "qif"
+	FormatCAMT053 = "camt053"
+
+	camt053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.08"
+)
+
+// exporter writes the transactions of an account in a banking interchange
+// format: begin once, entry for every transaction in order, then end.
+type exporter interface {
+	begin() error
+	entry(entry Entry) error
+	end() error
+}
+
+type exportFormat struct {
+	contentType string
+	extension   string
+	new         func(w io.Writer, summary Summary, bankID string) exporter
+}
+
+var exportFormats = map[string]exportFormat{
+	FormatOFX:     {"application/x-ofx", "ofx", newOFXExporter},
+	FormatQIF:     {"application/qif", "qif", newQIFExporter},
+	FormatCAMT053: {"application/xml", "xml", newCAMT053Exporter},
+}
+
+// ExportContentType returns the MIME type of an export format, and false for
+// unknown formats.
+func ExportContentType(format string) (string, bool) {
+	f, ok := exportFormats[format]
+	return f.contentType, ok
+}
+
+// ExportFilename names the download of an export, e.g.
+// "transactions-12345678901234567890-2026-09-01-2026-09-30.ofx".
+func ExportFilename(summary Summary, format string) string {
+	first, last := periodDates(Statement{Summary: summary})
+	return fmt.Sprintf("transactions-%s-%s-%s.%s", summary.AccountNumber, first, last, exportFormats[format].extension)
+}
+
+// amountString formats amount, with its sign, in the minor units of the
+// statement's currency.
+func amountString(summary Summary, amount float64) string {
+	return strconv.FormatFloat(amount, 'f', minorUnits(summary.CurrencyCode), 64)
+}
+
+// oneLine removes line breaks and repeated spaces, which most formats do not
+// allow inside a field, and cuts s to n characters.
+func oneLine(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// OFX 2.2, the XML flavour of Open Financial Exchange. TRNAMT is signed:
+// positive for money received, negative for money paid.
+type ofxExporter struct {
+	w       io.Writer
+	summary Summary
+	bankID  string
+}
+
+func newOFXExporter(w io.Writer, summary Summary, bankID string) exporter {
+	return &ofxExporter{w: w, summary: summary, bankID: bankID}
+}
+
+func ofxTime(t time.Time) string {
+	return t.UTC().Format("20060102150405.000") + "[0:UTC]"
+}
+
+func ofxText(s string, n int) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(oneLine(s, n)))
+	return b.String()
+}
+
+var ofxTypes = map[string]string{
+	transaction.TxType_DEPOSIT:  "DEP",
+	transaction.TxType_WITHDRAW: "DEBIT",
+	transaction.TxType_TRANSFER: "XFER",
+	transaction.TxType_INTEREST: "INT",
+	transaction.TxType_FEE:      "FEE",
+}
+
+func (e *ofxExporter) begin() error {
+	summary := e.summary
+	_, err := fmt.Fprintf(e.w, `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+<SIGNONMSGSRSV1>
+<SONRS>
+<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<DTSERVER>%s</DTSERVER>
+<LANGUAGE>ENG</LANGUAGE>
+</SONRS>
+</SIGNONMSGSRSV1>
+<BANKMSGSRSV1>
+<STMTTRNRS>
+<TRNUID>0</TRNUID>
+<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<STMTRS>
+<CURDEF>%s</CURDEF>
+<BANKACCTFROM>
+<BANKID>%s</BANKID>
+<ACCTID>%s</ACCTID>
+<ACCTTYPE>CHECKING</ACCTTYPE>
+</BANKACCTFROM>
+<BANKTRANLIST>
+<DTSTART>%s</DTSTART>
+<DTEND>%s</DTEND>
+`,
+		ofxTime(summary.GeneratedAt), summary.CurrencyCode, ofxText(e.bankID, 9), summary.AccountNumber,
+		ofxTime(summary.PeriodStart), ofxTime(summary.PeriodEnd),
+	)
+	return err
+}
+
+func (e *ofxExporter) entry(entry Entry) error {
+	trnType, ok := ofxTypes[entry.TxType]
+	if !ok {
+		trnType = "OTHER"
+	}
+	name := entry.Counterparty
+	if name == "" {
+		name = entry.TxType
+	}
+
+	_, err := fmt.Fprintf(e.w, `<STMTTRN>
+<TRNTYPE>%s</TRNTYPE>
+<DTPOSTED>%s</DTPOSTED>
+<TRNAMT>%s</TRNAMT>
+<FITID>%d</FITID>
+<NAME>%s</NAME>
+<MEMO>%s</MEMO>
+</STMTTRN>
+`,
+		trnType, ofxTime(entry.CreatedAt), amountString(e.summary, entry.Amount), entry.TransactionID,
+		ofxText(name, 32), ofxText(entry.Detail, 255),
+	)
+	return err
+}
+
+func (e *ofxExporter) end() error {
+	_, err := fmt.Fprintf(e.w, `</BANKTRANLIST>
+<LEDGERBAL>
+<BALAMT>%s</BALAMT>
+<DTASOF>%s</DTASOF>
+</LEDGERBAL>
+</STMTRS>
+</STMTTRNRS>
+</BANKMSGSRSV1>
+</OFX>
+`,
+		amountString(e.summary, e.summary.ClosingBalance), ofxTime(e.summary.PeriodEnd),
+	)
+	return err
+}
+
+// QIF, the Quicken Interchange Format. T is signed like TRNAMT in OFX; QIF
+// has no balances.
+type qifExporter struct {
+	w       io.Writer
+	summary Summary
+}
+
+func newQIFExporter(w io.Writer, summary Summary, bankID string) exporter {
+	return &qifExporter{w: w, summary: summary}
+}
+
+func (e *qifExporter) begin() error {
+	_, err := io.WriteString(e.w, "!Type:Bank\n")
+	return err
+}
+
+func (e *qifExporter) entry(entry Entry) error {
+	payee := entry.Counterparty
+	if payee == "" {
+		payee = entry.TxType
+	}
+
+	_, err := fmt.Fprintf(e.w, "D%s\nT%s\nN%d\nP%s\nM%s\nL%s\n^\n",
+		entry.CreatedAt.UTC().Format("01/02/2006"), amountString(e.summary, entry.Amount), entry.TransactionID,
+		oneLine(payee, 64), oneLine(entry.Detail, 255), entry.TxType,
+	)
+	return err
+}
+
+func (e *qifExporter) end() error {
+	return nil
+}
+
+// ISO 20022 camt.053.001.08, the bank to customer statement. Amounts are
+// unsigned and CdtDbtInd says whether money was received (CRDT) or paid (DBIT).
+type camt053Exporter struct {
+	enc     *xml.Encoder
+	summary Summary
+}
+
+func newCAMT053Exporter(w io.Writer, summary Summary, bankID string) exporter {
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return &camt053Exporter{enc: enc, summary: summary}
+}
+
+type camtAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type camtAccount struct {
+	ID       string `xml:"Id>Othr>Id"`
+	Currency string `xml:"Ccy,omitempty"`
+}
+
+type camtBalance struct {
+	Code      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount    camtAmount `xml:"Amt"`
+	CreditDeb string     `xml:"CdtDbtInd"`
+	Date      string     `xml:"Dt>Dt"`
+}
+
+type camtBankTxCode struct {
+	Domain    string `xml:"Domn>Cd"`
+	Family    string `xml:"Domn>Fmly>Cd"`
+	SubFamily string `xml:"Domn>Fmly>SubFmlyCd"`
+}
+
+type camtEntry struct {
+	XMLName      xml.Name       `xml:"Ntry"`
+	Reference    string         `xml:"NtryRef"`
+	Amount       camtAmount     `xml:"Amt"`
+	CreditDebit  string         `xml:"CdtDbtInd"`
+	Status       string         `xml:"Sts>Cd"`
+	BookingDate  string         `xml:"BookgDt>DtTm"`
+	ValueDate    string         `xml:"ValDt>DtTm"`
+	ServicerRef  string         `xml:"AcctSvcrRef"`
+	BankTxCode   camtBankTxCode `xml:"BkTxCd"`
+	TxServicerRf string         `xml:"NtryDtls>TxDtls>Refs>AcctSvcrRef"`
+	DebtorAcct   *camtAccount   `xml:"NtryDtls>TxDtls>RltdPties>DbtrAcct,omitempty"`
+	CreditorAcct *camtAccount   `xml:"NtryDtls>TxDtls>RltdPties>CdtrAcct,omitempty"`
+	Remittance   string         `xml:"NtryDtls>TxDtls>RmtInf>Ustrd,omitempty"`
+}
+
+// camtCodes are the bank transaction codes (domain, family, sub-family) of
+// each tx_type, for money received and for money paid.
+var camtCodes = map[string][2]camtBankTxCode{
+	transaction.TxType_DEPOSIT:  {{"PMNT", "CNTR", "CDPT"}, {"PMNT", "CNTR", "CDPT"}},
+	transaction.TxType_WITHDRAW: {{"PMNT", "CNTR", "CWDL"}, {"PMNT", "CNTR", "CWDL"}},
+	transaction.TxType_TRANSFER: {{"PMNT", "RCDT", "BOOK"}, {"PMNT", "ICDT", "BOOK"}},
+	transaction.TxType_INTEREST: {{"ACMT", "MCOP", "INTR"}, {"ACMT", "MDOP", "INTR"}},
+	transaction.TxType_FEE:      {{"ACMT", "MCOP", "CHRG"}, {"ACMT", "MDOP", "CHRG"}},
+}
+
+func camtTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+func (e *camt053Exporter) amount(value float64) (camtAmount, string) {
+	indicator := "CRDT"
+	if value < 0 {
+		indicator = "DBIT"
+	}
+	return camtAmount{Currency: e.summary.CurrencyCode, Value: amountString(e.summary, math.Abs(value))}, indicator
+}
+
+func (e *camt053Exporter) balance(code string, value float64, date string) camtBalance {
+	amount, indicator := e.amount(value)
+	return camtBalance{Code: code, Amount: amount, CreditDeb: indicator, Date: date}
+}
+
+func (e *camt053Exporter) begin() error {
+	summary := e.summary
+	first, last := periodDates(Statement{Summary: summary})
+	created := camtTime(summary.GeneratedAt)
+
+	type groupHeader struct {
+		XMLName   xml.Name `xml:"GrpHdr"`
+		MessageID string   `xml:"MsgId"`
+		Created   string   `xml:"CreDtTm"`
+	}
+
+	for _, token := range []xml.Token{
+		xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0" encoding="UTF-8"`)},
+		xml.StartElement{Name: xml.Name{Local: "Document"}, Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: camt053Namespace}}},
+		xml.StartElement{Name: xml.Name{Local: "BkToCstmrStmt"}},
+	} {
+		if err := e.enc.EncodeToken(token); err != nil {
+			return err
+		}
+	}
+	err := e.enc.Encode(groupHeader{
+		MessageID: summary.AccountNumber + "-" + summary.GeneratedAt.UTC().Format("20060102150405"),
+		Created:   created,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := e.enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "Stmt"}}); err != nil {
+		return err
+	}
+	// Stmt stays open after its header so that the entries can follow.
+	for _, element := range []struct {
+		name  string
+		value any
+	}{
+		{"Id", summary.AccountNumber + "-" + summary.PeriodStart.UTC().Format("20060102")},
+		{"CreDtTm", created},
+		{"FrToDt", struct {
+			From string `xml:"FrDtTm"`
+			To   string `xml:"ToDtTm"`
+		}{camtTime(summary.PeriodStart), camtTime(summary.PeriodEnd)}},
+		{"Acct", camtAccount{ID: summary.AccountNumber, Currency: summary.CurrencyCode}},
+		{"Bal", e.balance("OPBD", summary.OpeningBalance, first)},
+		{"Bal", e.balance("CLBD", summary.ClosingBalance, last)},
+	} {
+		err := e.enc.EncodeElement(element.value, xml.StartElement{Name: xml.Name{Local: element.name}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *camt053Exporter) entry(entry Entry) error {
+	amount, indicator := e.amount(entry.Amount)
+	ref := strconv.FormatInt(entry.TransactionID, 10)
+
+	codes, ok := camtCodes[entry.TxType]
+	if !ok {
+		codes = [2]camtBankTxCode{{"PMNT", "OTHR", "OTHR"}, {"PMNT", "OTHR", "OTHR"}}
+	}
+	code := codes[0]
+	if indicator == "DBIT" {
+		code = codes[1]
+	}
+
+	ntry := camtEntry{
+		Reference:    ref,
+		Amount:       amount,
+		CreditDebit:  indicator,
+		Status:       "BOOK",
+		BookingDate:  camtTime(entry.CreatedAt),
+		ValueDate:    camtTime(entry.CreatedAt),
+		ServicerRef:  ref,
+		BankTxCode:   code,
+		TxServicerRf: ref,
+		Remittance:   oneLine(entry.Detail, 140),
+	}
+	if entry.Counterparty != "" {
+		if indicator == "DBIT" {
+			ntry.CreditorAcct = &camtAccount{ID: entry.Counterparty}
+		} else {
+			ntry.DebtorAcct = &camtAccount{ID: entry.Counterparty}
+		}
+	}
+	if err := e.enc.Encode(ntry); err != nil {
+		return err
+	}
+	return e.enc.Flush()
+}
+
+func (e *camt053Exporter) end() error {
+	for _, name := range []string{"Stmt", "BkToCstmrStmt", "Document"} {
+		if err := e.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}}); err != nil {
+			return err
+		}
+	}
+	return e.enc.Close()
+}
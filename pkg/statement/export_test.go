@@ -0,0 +1,72 @@
+package statement
+
+import (
+	"bank_system/pkg/transaction"
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// exportSummary and exportEntries are a month of an account that covers
+// every tx_type, a counterparty on both sides and text the formats escape.
+var (
+	exportSummary = Summary{
+		AccountID:      1,
+		AccountNumber:  "12345678901234567890",
+		CurrencyCode:   "USD",
+		PeriodStart:    time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:      time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		OpeningBalance: 100,
+		ClosingBalance: 1023.46,
+		GeneratedAt:    time.Date(2026, 10, 1, 2, 3, 4, 0, time.UTC),
+	}
+	exportEntries = []Entry{
+		{1, time.Date(2026, 9, 1, 8, 0, 0, 0, time.UTC), transaction.TxType_DEPOSIT, "Salary", "", 1500, 0},
+		{2, time.Date(2026, 9, 2, 9, 30, 0, 0, time.UTC), transaction.TxType_WITHDRAW, "ATM", "", -200, 0},
+		{3, time.Date(2026, 9, 3, 12, 15, 30, 0, time.UTC), transaction.TxType_TRANSFER,
+			"Rent <September>\n& utilities", "09876543210987654321", -400.5, 0},
+		{4, time.Date(2026, 9, 10, 18, 45, 0, 0, time.UTC), transaction.TxType_TRANSFER,
+			"Dinner, \"thanks\"", "11112222333344445555", 23.99, 0},
+		{5, time.Date(2026, 9, 30, 23, 0, 0, 0, time.UTC), transaction.TxType_INTEREST, "", "", 0.12, 0},
+		{6, time.Date(2026, 9, 30, 23, 0, 1, 0, time.UTC), transaction.TxType_FEE, "Monthly fee", "", -0.15, 0},
+	}
+)
+
+func TestExportGolden(t *testing.T) {
+	for _, format := range []string{FormatOFX, FormatQIF, FormatCAMT053} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			exp := exportFormats[format].new(&buf, exportSummary, "BANKSYS")
+			if err := exp.begin(); err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range exportEntries {
+				if err := exp.entry(entry); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := exp.end(); err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", format+".golden")
+			if *update {
+				if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("%s export differs from %s:\n%s", format, golden, buf.Bytes())
+			}
+		})
+	}
+}
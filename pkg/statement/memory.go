@@ -0,0 +1,237 @@
+package statement
+
+import (
+	"bank_system/pkg/memstore"
+	"bank_system/pkg/transaction"
+	"bank_system/postgres/sqlc"
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// memoryStatementRepository is a StatementRepository backed by a memstore.Store.
+type memoryStatementRepository struct {
+	store *memstore.Store
+}
+
+func NewMemoryStatementRepository(store *memstore.Store) StatementRepository {
+	return &memoryStatementRepository{store: store}
+}
+
+func (r *memoryStatementRepository) GetEntries(ctx context.Context, accountID int64, from, to time.Time) ([]Entry, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	entries := []Entry{}
+	for _, tx := range r.accountTransactions(accountID) {
+		created := tx.CreatedAt.Time
+		if created.Before(from) || !created.Before(to) {
+			continue
+		}
+
+		entry := Entry{
+			TransactionID: tx.ID,
+			CreatedAt:     created,
+			TxType:        string(tx.TxType),
+			Detail:        tx.Detail,
+			Amount:        r.signedAmount(tx, accountID),
+		}
+		counterparty := tx.AccountFrom
+		if tx.AccountFrom == accountID {
+			counterparty = tx.AccountTo.Int64
+		}
+		if account, ok := r.store.Accounts[counterparty]; ok {
+			entry.Counterparty = account.IDNumber
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (r *memoryStatementRepository) EachEntry(
+	ctx context.Context, accountID int64, from, to time.Time, fn func(Entry) error,
+) error {
+	// Read everything first, fn must not run while Mu is held.
+	entries, err := r.GetEntries(ctx, accountID, from, to)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryStatementRepository) GetBalanceAt(ctx context.Context, accountID int64, at time.Time) (float64, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	account, ok := r.store.Accounts[accountID]
+	if !ok {
+		return 0, pgx.ErrNoRows
+	}
+
+	balance := account.Balance
+	for _, tx := range r.accountTransactions(accountID) {
+		if !tx.CreatedAt.Time.Before(at) {
+			balance -= r.signedAmount(tx, accountID)
+		}
+	}
+	return balance, nil
+}
+
+func (r *memoryStatementRepository) CreateStatement(ctx context.Context, statement Statement) (Statement, error) {
+	data, err := json.Marshal(statement)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	for _, record := range r.store.Statements {
+		if record.AccountID == statement.AccountID &&
+			record.PeriodStart.Equal(statement.PeriodStart) && record.PeriodEnd.Equal(statement.PeriodEnd) {
+			return r.toStatement(record)
+		}
+	}
+
+	record := &memstore.StatementRecord{
+		ID:             r.store.NextID("BK_Statement"),
+		AccountID:      statement.AccountID,
+		PeriodStart:    statement.PeriodStart,
+		PeriodEnd:      statement.PeriodEnd,
+		OpeningBalance: statement.OpeningBalance,
+		ClosingBalance: statement.ClosingBalance,
+		Data:           data,
+		CreatedAt:      time.Now(),
+	}
+	r.store.Statements[record.ID] = record
+
+	return r.toStatement(record)
+}
+
+func (r *memoryStatementRepository) GetStatement(ctx context.Context, id int64) (Statement, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.Statements[id]
+	if !ok {
+		return Statement{}, pgx.ErrNoRows
+	}
+	return r.toStatement(record)
+}
+
+func (r *memoryStatementRepository) GetAccountStatements(ctx context.Context, accountID int64) ([]Summary, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	summaries := []Summary{}
+	for _, record := range r.store.Statements {
+		if record.AccountID == accountID {
+			summaries = append(summaries, r.toSummary(record))
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if !summaries[i].PeriodStart.Equal(summaries[j].PeriodStart) {
+			return summaries[i].PeriodStart.After(summaries[j].PeriodStart)
+		}
+		return summaries[i].ID > summaries[j].ID
+	})
+
+	return summaries, nil
+}
+
+func (r *memoryStatementRepository) GetAccountsWithoutStatement(
+	ctx context.Context, periodStart, periodEnd time.Time, limit int,
+) ([]string, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	done := map[int64]bool{}
+	for _, record := range r.store.Statements {
+		if record.PeriodStart.Equal(periodStart) && record.PeriodEnd.Equal(periodEnd) {
+			done[record.AccountID] = true
+		}
+	}
+
+	var accounts []*sqlc.BKAccount
+	for _, account := range r.store.Accounts {
+		if !done[account.ID] && account.CreatedAt.Time.Before(periodEnd) {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+	if len(accounts) > limit {
+		accounts = accounts[:limit]
+	}
+
+	idNumbers := make([]string, 0, len(accounts))
+	for _, account := range accounts {
+		idNumbers = append(idNumbers, account.IDNumber)
+	}
+	return idNumbers, nil
+}
+
+// accountTransactions returns the transactions from or to the account in the
+// order they were made. The caller must hold Mu.
+func (r *memoryStatementRepository) accountTransactions(accountID int64) []*sqlc.BKTransaction {
+	var transactions []*sqlc.BKTransaction
+	for _, tx := range r.store.Transactions {
+		if tx.AccountFrom == accountID || tx.AccountTo.Valid && tx.AccountTo.Int64 == accountID {
+			transactions = append(transactions, tx)
+		}
+	}
+	sort.Slice(transactions, func(i, j int) bool {
+		if !transactions[i].CreatedAt.Time.Equal(transactions[j].CreatedAt.Time) {
+			return transactions[i].CreatedAt.Time.Before(transactions[j].CreatedAt.Time)
+		}
+		return transactions[i].ID < transactions[j].ID
+	})
+	return transactions
+}
+
+// signedAmount mirrors the SQL of the same name. The caller must hold Mu.
+func (r *memoryStatementRepository) signedAmount(tx *sqlc.BKTransaction, accountID int64) float64 {
+	switch {
+	case tx.AccountFrom == accountID && string(tx.TxType) == transaction.TxType_DEPOSIT:
+		return tx.Amount
+	case tx.AccountFrom == accountID:
+		return -tx.Amount
+	}
+	if fx, ok := r.store.FXTransfers[tx.ID]; ok {
+		return fx.ConvertedAmount
+	}
+	return tx.Amount
+}
+
+func (r *memoryStatementRepository) toSummary(record *memstore.StatementRecord) Summary {
+	summary := Summary{
+		ID:             record.ID,
+		AccountID:      record.AccountID,
+		PeriodStart:    record.PeriodStart,
+		PeriodEnd:      record.PeriodEnd,
+		OpeningBalance: record.OpeningBalance,
+		ClosingBalance: record.ClosingBalance,
+		GeneratedAt:    record.CreatedAt,
+	}
+	if account, ok := r.store.Accounts[record.AccountID]; ok {
+		summary.AccountNumber = account.IDNumber
+		summary.CurrencyCode = account.CurrencyCode
+	}
+	return summary
+}
+
+func (r *memoryStatementRepository) toStatement(record *memstore.StatementRecord) (Statement, error) {
+	var statement Statement
+	if err := json.Unmarshal(record.Data, &statement); err != nil {
+		return Statement{}, err
+	}
+	statement.Summary = r.toSummary(record)
+	return statement, nil
+}
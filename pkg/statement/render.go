@@ -0,0 +1,150 @@
+package statement
+
+import (
+	"bank_system/utils"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatPDF  = "pdf"
+)
+
+var contentTypes = map[string]string{
+	FormatJSON: "application/json",
+	FormatCSV:  "text/csv; charset=utf-8",
+	FormatPDF:  "application/pdf",
+}
+
+// ContentType returns the MIME type of format, and false for unknown formats.
+func ContentType(format string) (string, bool) {
+	contentType, ok := contentTypes[format]
+	return contentType, ok
+}
+
+// Filename names the download of statement in format, e.g.
+// "statement-12345678901234567890-2026-09-01-2026-09-30.pdf".
+func Filename(statement Statement, format string) string {
+	first, last := periodDates(statement)
+	return fmt.Sprintf("statement-%s-%s-%s.%s", statement.AccountNumber, first, last, format)
+}
+
+// Render writes statement to w in format.
+func Render(w io.Writer, statement Statement, format string) error {
+	switch format {
+	case FormatJSON:
+		return json.NewEncoder(w).Encode(statement)
+	case FormatCSV:
+		return renderCSV(w, statement)
+	case FormatPDF:
+		return renderPDF(w, statement)
+	default:
+		return fmt.Errorf("unknown statement format %q", format)
+	}
+}
+
+// renderCSV writes one row per transaction between an opening and a closing
+// balance row.
+func renderCSV(w io.Writer, statement Statement) error {
+	units := minorUnits(statement.CurrencyCode)
+	amount := func(v float64) string { return strconv.FormatFloat(v, 'f', units, 64) }
+
+	cw := csv.NewWriter(w)
+	rows := [][]string{
+		{"date", "transaction_id", "tx_type", "detail", "counterparty", "amount", "balance"},
+		{statement.PeriodStart.Format(time.RFC3339), "", "OPENING_BALANCE", "", "", "", amount(statement.OpeningBalance)},
+	}
+	for _, entry := range statement.Entries {
+		rows = append(rows, []string{
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			strconv.FormatInt(entry.TransactionID, 10),
+			entry.TxType,
+			entry.Detail,
+			entry.Counterparty,
+			amount(entry.Amount),
+			amount(entry.Balance),
+		})
+	}
+	rows = append(rows,
+		[]string{statement.PeriodEnd.Format(time.RFC3339), "", "CLOSING_BALANCE", "", "", "", amount(statement.ClosingBalance)},
+	)
+
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func renderPDF(w io.Writer, statement Statement) error {
+	money := func(v float64) string { return utils.FormatAmount(v, statement.CurrencyCode) }
+	first, last := periodDates(statement)
+
+	doc := &pdfDocument{}
+	doc.heading("Account statement")
+	doc.text("")
+	doc.text(fmt.Sprintf("Account          %s (%s)", statement.AccountNumber, statement.CurrencyCode))
+	doc.text(fmt.Sprintf("Period           %s to %s", first, last))
+	doc.text(fmt.Sprintf("Generated        %s", statement.GeneratedAt.UTC().Format("2006-01-02 15:04 MST")))
+	doc.text("")
+	doc.text(fmt.Sprintf("Opening balance  %18s", money(statement.OpeningBalance)))
+	doc.text(fmt.Sprintf("Total credits    %18s", money(statement.TotalCredits)))
+	doc.text(fmt.Sprintf("Total debits     %18s", money(statement.TotalDebits)))
+	doc.text(fmt.Sprintf("Closing balance  %18s", money(statement.ClosingBalance)))
+
+	doc.text("")
+	doc.heading("Totals by type")
+	doc.text(fmt.Sprintf("%-10s %6s %18s %18s", "Type", "Count", "Credits", "Debits"))
+	for _, total := range statement.Totals {
+		doc.text(fmt.Sprintf("%-10s %6d %18s %18s", total.TxType, total.Count, money(total.Credits), money(total.Debits)))
+	}
+
+	doc.text("")
+	doc.heading("Transactions")
+	row := "%-10s %-8s %-24s %-20s %16s %16s"
+	doc.text(fmt.Sprintf(row, "Date", "Type", "Detail", "Counterparty", "Amount", "Balance"))
+	if len(statement.Entries) == 0 {
+		doc.text("No transactions in this period.")
+	}
+	for _, entry := range statement.Entries {
+		doc.text(fmt.Sprintf(row,
+			entry.CreatedAt.UTC().Format(time.DateOnly),
+			entry.TxType,
+			truncate(entry.Detail, 24),
+			entry.Counterparty,
+			money(entry.Amount),
+			money(entry.Balance),
+		))
+	}
+
+	_, err := w.Write(doc.bytes())
+	return err
+}
+
+// periodDates returns the first and the last day of the period, in UTC.
+func periodDates(statement Statement) (string, string) {
+	first := statement.PeriodStart.UTC().Format(time.DateOnly)
+	last := statement.PeriodEnd.UTC().Add(-time.Nanosecond).Format(time.DateOnly)
+	return first, last
+}
+
+func minorUnits(currency string) int {
+	if info, ok := utils.LookupCurrency(currency); ok {
+		return info.MinorUnits
+	}
+	return utils.DEFAULT_MINOR_UNITS
+}
+
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-3]) + "..."
+	}
+	return s
+}
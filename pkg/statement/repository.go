@@ -0,0 +1,288 @@
+package statement
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// signedAmount is the amount of transaction t as seen from account $1:
+	// negative when money left it, and in its currency for incoming
+	// transfers between currencies.
+	signedAmount = `CASE
+			WHEN t.account_from = $1 AND t.tx_type = 'DEPOSIT' THEN t.amount
+			WHEN t.account_from = $1 THEN -t.amount
+			ELSE COALESCE(fx.converted_amount, t.amount)
+		END`
+	transactionsFrom = `"BK_Transaction" t
+		LEFT JOIN "BK_FX_Transfer" fx ON fx.transaction_id = t.id`
+	accountTransactions = `(t.account_from = $1 OR t.account_to = $1)`
+	summaryColumns      = `s.id, s.account_id, a.id_number, a.currency_code, s.period_start, s.period_end,
+		s.opening_balance, s.closing_balance, s.created_at`
+	summaryFrom = `"BK_Statement" s JOIN "BK_Account" a ON a.id = s.account_id`
+)
+
+// Summary describes a statement without its transactions.
+type Summary struct {
+	ID             int64     `json:"id,omitempty"`
+	AccountID      int64     `json:"account_id"`
+	AccountNumber  string    `json:"account_number"`
+	CurrencyCode   string    `json:"currency_code"`
+	PeriodStart    time.Time `json:"period_start"`
+	PeriodEnd      time.Time `json:"period_end"`
+	OpeningBalance float64   `json:"opening_balance"`
+	ClosingBalance float64   `json:"closing_balance"`
+	GeneratedAt    time.Time `json:"generated_at"`
+}
+
+// Statement lists the transactions of an account from PeriodStart up to, but
+// not including, PeriodEnd.
+type Statement struct {
+	Summary
+	TotalCredits float64     `json:"total_credits"`
+	TotalDebits  float64     `json:"total_debits"`
+	Totals       []TypeTotal `json:"totals"`
+	Entries      []Entry     `json:"transactions"`
+}
+
+// TypeTotal sums the transactions of one tx_type.
+type TypeTotal struct {
+	TxType  string  `json:"tx_type"`
+	Count   int     `json:"count"`
+	Credits float64 `json:"credits"`
+	Debits  float64 `json:"debits"`
+}
+
+// Entry is a transaction on a statement. Amount is negative for debits and
+// Balance is the balance of the account after it.
+type Entry struct {
+	TransactionID int64     `json:"transaction_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	TxType        string    `json:"tx_type"`
+	Detail        string    `json:"detail"`
+	Counterparty  string    `json:"counterparty"`
+	Amount        float64   `json:"amount"`
+	Balance       float64   `json:"balance"`
+}
+
+type StatementRepository interface {
+	// GetEntries returns the transactions of the account in [from, to) in
+	// the order they were made, without Balance.
+	GetEntries(ctx context.Context, accountID int64, from, to time.Time) ([]Entry, error)
+	// EachEntry calls fn with the entries GetEntries returns as they are
+	// read, and stops at the first error fn returns.
+	EachEntry(ctx context.Context, accountID int64, from, to time.Time, fn func(Entry) error) error
+	// GetBalanceAt returns the balance of the account just before at.
+	GetBalanceAt(ctx context.Context, accountID int64, at time.Time) (float64, error)
+	// CreateStatement stores statement, or returns the one already stored for
+	// the account and period.
+	CreateStatement(ctx context.Context, statement Statement) (Statement, error)
+	GetStatement(ctx context.Context, id int64) (Statement, error)
+	GetAccountStatements(ctx context.Context, accountID int64) ([]Summary, error)
+	// GetAccountsWithoutStatement returns the id_number of up to limit
+	// accounts opened before periodEnd that have no statement for the period.
+	GetAccountsWithoutStatement(ctx context.Context, periodStart, periodEnd time.Time, limit int) ([]string, error)
+}
+
+type statementRepositoryImpl struct {
+	pool *pgxpool.Pool
+}
+
+func NewStatementRepository(pool *pgxpool.Pool) StatementRepository {
+	return &statementRepositoryImpl{pool: pool}
+}
+
+func (r *statementRepositoryImpl) GetEntries(ctx context.Context, accountID int64, from, to time.Time) ([]Entry, error) {
+	entries := []Entry{}
+	err := r.EachEntry(ctx, accountID, from, to, func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *statementRepositoryImpl) EachEntry(
+	ctx context.Context, accountID int64, from, to time.Time, fn func(Entry) error,
+) error {
+	rows, err := r.pool.Query(ctx,
+		`SELECT t.id, t.created_at, t.tx_type, COALESCE(t.detail, ''), COALESCE(c.id_number, ''), `+signedAmount+`
+		FROM `+transactionsFrom+`
+		LEFT JOIN "BK_Account" c
+			ON c.id = CASE WHEN t.account_from = $1 THEN t.account_to ELSE t.account_from END
+		WHERE `+accountTransactions+`
+			AND t.created_at >= $2 AND t.created_at < $3
+		ORDER BY t.created_at, t.id`,
+		accountID, from, to,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry Entry
+		err := rows.Scan(
+			&entry.TransactionID,
+			&entry.CreatedAt,
+			&entry.TxType,
+			&entry.Detail,
+			&entry.Counterparty,
+			&entry.Amount,
+		)
+		if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *statementRepositoryImpl) GetBalanceAt(ctx context.Context, accountID int64, at time.Time) (float64, error) {
+	// One statement, so that the balance and the later transactions are
+	// read from the same snapshot.
+	var balance float64
+	err := r.pool.QueryRow(ctx,
+		`SELECT a.balance - COALESCE((
+			SELECT SUM(`+signedAmount+`) FROM `+transactionsFrom+`
+			WHERE `+accountTransactions+` AND t.created_at >= $2
+		), 0)
+		FROM "BK_Account" a
+		WHERE a.id = $1`,
+		accountID, at,
+	).Scan(&balance)
+	return balance, err
+}
+
+func (r *statementRepositoryImpl) CreateStatement(ctx context.Context, statement Statement) (Statement, error) {
+	data, err := json.Marshal(statement)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	var id int64
+	err = r.pool.QueryRow(ctx,
+		`INSERT INTO "BK_Statement" (account_id, period_start, period_end, opening_balance, closing_balance, data)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (account_id, period_start, period_end) DO NOTHING
+		RETURNING id`,
+		statement.AccountID, statement.PeriodStart, statement.PeriodEnd,
+		statement.OpeningBalance, statement.ClosingBalance, data,
+	).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = r.pool.QueryRow(ctx,
+			`SELECT id FROM "BK_Statement" WHERE account_id = $1 AND period_start = $2 AND period_end = $3`,
+			statement.AccountID, statement.PeriodStart, statement.PeriodEnd,
+		).Scan(&id)
+	}
+	if err != nil {
+		return Statement{}, err
+	}
+	return r.GetStatement(ctx, id)
+}
+
+func (r *statementRepositoryImpl) GetStatement(ctx context.Context, id int64) (Statement, error) {
+	var (
+		statement Statement
+		data      []byte
+	)
+	err := r.pool.QueryRow(ctx,
+		`SELECT s.data, `+summaryColumns+` FROM `+summaryFrom+` WHERE s.id = $1`,
+		id,
+	).Scan(
+		&data,
+		&statement.ID,
+		&statement.AccountID,
+		&statement.AccountNumber,
+		&statement.CurrencyCode,
+		&statement.PeriodStart,
+		&statement.PeriodEnd,
+		&statement.OpeningBalance,
+		&statement.ClosingBalance,
+		&statement.GeneratedAt,
+	)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	// The columns override the copies in data, which has no id.
+	summary := statement.Summary
+	if err := json.Unmarshal(data, &statement); err != nil {
+		return Statement{}, err
+	}
+	statement.Summary = summary
+	return statement, nil
+}
+
+func (r *statementRepositoryImpl) GetAccountStatements(ctx context.Context, accountID int64) ([]Summary, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+summaryColumns+` FROM `+summaryFrom+`
+		WHERE s.account_id = $1
+		ORDER BY s.period_start DESC, s.id DESC`,
+		accountID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []Summary{}
+	for rows.Next() {
+		var summary Summary
+		err := rows.Scan(
+			&summary.ID,
+			&summary.AccountID,
+			&summary.AccountNumber,
+			&summary.CurrencyCode,
+			&summary.PeriodStart,
+			&summary.PeriodEnd,
+			&summary.OpeningBalance,
+			&summary.ClosingBalance,
+			&summary.GeneratedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
+
+func (r *statementRepositoryImpl) GetAccountsWithoutStatement(
+	ctx context.Context, periodStart, periodEnd time.Time, limit int,
+) ([]string, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT a.id_number FROM "BK_Account" a
+		WHERE a.created_at < $2
+			AND NOT EXISTS (
+				SELECT 1 FROM "BK_Statement" s
+				WHERE s.account_id = a.id AND s.period_start = $1 AND s.period_end = $2
+			)
+		ORDER BY a.id
+		LIMIT $3`,
+		periodStart, periodEnd, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	idNumbers := []string{}
+	for rows.Next() {
+		var idNumber string
+		if err := rows.Scan(&idNumber); err != nil {
+			return nil, err
+		}
+		idNumbers = append(idNumbers, idNumber)
+	}
+	return idNumbers, rows.Err()
+}
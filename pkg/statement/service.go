@@ -0,0 +1,272 @@
+package statement
+
+import (
+	"bank_system/postgres/sqlc"
+	"bank_system/utils"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// MaxPeriod bounds the statements generated on request.
+	MaxPeriod = 366 * 24 * time.Hour
+
+	DefaultBatchSize = 100
+)
+
+// Accounts is what statements need of account.AccountService.
+type Accounts interface {
+	GetAccountByIDNumber(ctx context.Context, idNumber string) (*sqlc.GetAccountByIDNumberRow, error)
+}
+
+type StatementService struct {
+	repo      StatementRepository
+	accounts  Accounts
+	batchSize int
+	bankID    string
+}
+
+// NewStatementService creates the service. batchSize is the number of
+// accounts GenerateMonthlyStatements reads at a time, DefaultBatchSize when 0.
+// bankID identifies the bank in OFX exports.
+func NewStatementService(repo StatementRepository, accounts Accounts, batchSize int, bankID string) *StatementService {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	return &StatementService{
+		repo:      repo,
+		accounts:  accounts,
+		batchSize: batchSize,
+		bankID:    bankID,
+	}
+}
+
+// GenerateStatement computes the statement of the account over [from, to)
+// without storing it.
+func (s *StatementService) GenerateStatement(ctx context.Context, idNumber string, from, to time.Time) (Statement, error) {
+	account, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return Statement{}, err
+	}
+	if err := validatePeriod(from, to); err != nil {
+		return Statement{}, err
+	}
+
+	return s.build(ctx, account, from, to)
+}
+
+// PrepareExport checks an export of the transactions of the account over
+// [from, to) and returns its balances, before anything is written.
+func (s *StatementService) PrepareExport(ctx context.Context, idNumber string, from, to time.Time) (Summary, error) {
+	account, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return Summary{}, err
+	}
+	if err := validatePeriod(from, to); err != nil {
+		return Summary{}, err
+	}
+
+	opening, err := s.repo.GetBalanceAt(ctx, account.ID, from)
+	if err != nil {
+		return Summary{}, err
+	}
+	closing, err := s.repo.GetBalanceAt(ctx, account.ID, to)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	units := minorUnits(account.CurrencyCode)
+	return Summary{
+		AccountID:      account.ID,
+		AccountNumber:  account.IDNumber,
+		CurrencyCode:   account.CurrencyCode,
+		PeriodStart:    from.UTC(),
+		PeriodEnd:      to.UTC(),
+		OpeningBalance: round(opening, units),
+		ClosingBalance: round(closing, units),
+		GeneratedAt:    time.Now().UTC(),
+	}, nil
+}
+
+// WriteExport streams the transactions of a summary from PrepareExport to w
+// in format, one at a time as they are read.
+func (s *StatementService) WriteExport(ctx context.Context, w io.Writer, summary Summary, format string) error {
+	f, ok := exportFormats[format]
+	if !ok {
+		return fmt.Errorf("unknown export format %q", format)
+	}
+
+	exp := f.new(w, summary, s.bankID)
+	if err := exp.begin(); err != nil {
+		return err
+	}
+
+	units := minorUnits(summary.CurrencyCode)
+	balance := summary.OpeningBalance
+	err := s.repo.EachEntry(ctx, summary.AccountID, summary.PeriodStart, summary.PeriodEnd, func(entry Entry) error {
+		balance += entry.Amount
+		entry.Balance = round(balance, units)
+		return exp.entry(entry)
+	})
+	if err != nil {
+		return err
+	}
+	return exp.end()
+}
+
+// GenerateMonthlyStatements stores the statement of the calendar month, in
+// UTC, before now for every account that has none yet, and returns how many
+// it stored.
+func (s *StatementService) GenerateMonthlyStatements(ctx context.Context, now time.Time) (int, error) {
+	from, to := previousMonth(now)
+
+	generated := 0
+	for {
+		idNumbers, err := s.repo.GetAccountsWithoutStatement(ctx, from, to, s.batchSize)
+		if err != nil || len(idNumbers) == 0 {
+			return generated, err
+		}
+
+		for _, idNumber := range idNumbers {
+			account, err := s.getAccount(ctx, idNumber)
+			if err != nil {
+				return generated, err
+			}
+			statement, err := s.build(ctx, account, from, to)
+			if err != nil {
+				return generated, err
+			}
+			if _, err := s.repo.CreateStatement(ctx, statement); err != nil {
+				return generated, err
+			}
+			generated++
+		}
+	}
+}
+
+func (s *StatementService) GetAccountStatements(ctx context.Context, idNumber string) ([]Summary, error) {
+	account, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetAccountStatements(ctx, account.ID)
+}
+
+func (s *StatementService) GetStatement(ctx context.Context, idNumber string, statementID int64) (Statement, error) {
+	account, err := s.getAccount(ctx, idNumber)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	statement, err := s.repo.GetStatement(ctx, statementID)
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && statement.AccountID != account.ID {
+		return Statement{}, utils.NewBankSystemError(utils.ErrStatementNotFound, strconv.FormatInt(statementID, 10))
+	}
+	return statement, err
+}
+
+func (s *StatementService) build(
+	ctx context.Context, account *sqlc.GetAccountByIDNumberRow, from, to time.Time,
+) (Statement, error) {
+	opening, err := s.repo.GetBalanceAt(ctx, account.ID, from)
+	if err != nil {
+		return Statement{}, err
+	}
+	entries, err := s.repo.GetEntries(ctx, account.ID, from, to)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	units := utils.DEFAULT_MINOR_UNITS
+	if info, ok := utils.LookupCurrency(account.CurrencyCode); ok {
+		units = info.MinorUnits
+	}
+
+	statement := Statement{
+		Summary: Summary{
+			AccountID:      account.ID,
+			AccountNumber:  account.IDNumber,
+			CurrencyCode:   account.CurrencyCode,
+			PeriodStart:    from.UTC(),
+			PeriodEnd:      to.UTC(),
+			OpeningBalance: round(opening, units),
+			GeneratedAt:    time.Now().UTC(),
+		},
+		Totals:  []TypeTotal{},
+		Entries: entries,
+	}
+
+	balance := opening
+	totals := map[string]*TypeTotal{}
+	for i := range statement.Entries {
+		entry := &statement.Entries[i]
+		balance += entry.Amount
+		entry.Balance = round(balance, units)
+
+		total, ok := totals[entry.TxType]
+		if !ok {
+			total = &TypeTotal{TxType: entry.TxType}
+			totals[entry.TxType] = total
+		}
+		total.Count++
+		if entry.Amount >= 0 {
+			total.Credits += entry.Amount
+			statement.TotalCredits += entry.Amount
+		} else {
+			total.Debits -= entry.Amount
+			statement.TotalDebits -= entry.Amount
+		}
+	}
+
+	for _, total := range totals {
+		total.Credits = round(total.Credits, units)
+		total.Debits = round(total.Debits, units)
+		statement.Totals = append(statement.Totals, *total)
+	}
+	sort.Slice(statement.Totals, func(i, j int) bool { return statement.Totals[i].TxType < statement.Totals[j].TxType })
+
+	statement.TotalCredits = round(statement.TotalCredits, units)
+	statement.TotalDebits = round(statement.TotalDebits, units)
+	statement.ClosingBalance = round(balance, units)
+	return statement, nil
+}
+
+func (s *StatementService) getAccount(ctx context.Context, idNumber string) (*sqlc.GetAccountByIDNumberRow, error) {
+	account, err := s.accounts.GetAccountByIDNumber(ctx, idNumber)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, utils.NewBankSystemError(utils.ErrAccountNotFound, idNumber)
+	}
+	return account, err
+}
+
+func validatePeriod(from, to time.Time) error {
+	verr := &utils.ValidationError{}
+	switch {
+	case !to.After(from):
+		verr.Add("to", "must be after from")
+	case to.Sub(from) > MaxPeriod:
+		verr.Add("to", "must be at most a year after from")
+	}
+	return verr.Err()
+}
+
+// previousMonth returns the calendar month, in UTC, before the one of now.
+func previousMonth(now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	to := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return to.AddDate(0, -1, 0), to
+}
+
+func round(amount float64, decimals int) float64 {
+	scale := math.Pow10(decimals)
+	return math.Round(amount*scale) / scale
+}
@@ -0,0 +1,185 @@
+package stream
+
+import (
+	"bank_system/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+type StreamController struct {
+	service        *StreamService
+	allowedOrigins []string
+	logger         *log.Logger
+}
+
+// NewStreamController creates the controller. allowedOrigins are the origins
+// of the pages that may open a WebSocket, only the API's own when empty.
+func NewStreamController(service *StreamService, allowedOrigins []string, logger *log.Logger) *StreamController {
+	return &StreamController{
+		service:        service,
+		allowedOrigins: allowedOrigins,
+		logger:         logger,
+	}
+}
+
+// StreamEvents serves the stream as Server-Sent Events: each frame is an
+// event named after its type whose data is the JSON of Frame.Data, and
+// transaction events carry the transaction id as their id. Browsers resume
+// with the Last-Event-ID header when they reconnect, other clients may pass
+// the last_event_id query parameter.
+func (c *StreamController) StreamEvents(ctx *gin.Context) {
+	sub, ok := c.subscribe(ctx, ctx.GetHeader("Last-Event-ID"))
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	// Keeps proxies such as nginx from buffering the stream.
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.Flush()
+
+	err := sub.Run(ctx.Request.Context(), func(frame Frame) error {
+		data, err := json.Marshal(frame.Data)
+		if err != nil {
+			return err
+		}
+		if frame.ID != 0 {
+			if _, err := fmt.Fprintf(ctx.Writer, "id: %d\n", frame.ID); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(ctx.Writer, "event: %s\ndata: %s\n\n", frame.Type, data); err != nil {
+			return err
+		}
+		ctx.Writer.Flush()
+		return nil
+	})
+	c.logEnd(ctx, err)
+}
+
+// StreamWebSocket serves the stream over a WebSocket, a JSON Frame per text
+// message. Clients resume with the last_event_id query parameter; what they
+// send is ignored.
+func (c *StreamController) StreamWebSocket(ctx *gin.Context) {
+	sub, ok := c.subscribe(ctx, "")
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	server := websocket.Server{
+		Handshake: c.checkOrigin,
+		Handler: func(ws *websocket.Conn) {
+			runCtx, cancel := context.WithCancel(ctx.Request.Context())
+			defer cancel()
+
+			// Reading is how a closed connection is noticed.
+			go func() {
+				defer cancel()
+				var discard []byte
+				for websocket.Message.Receive(ws, &discard) == nil {
+				}
+			}()
+
+			err := sub.Run(runCtx, func(frame Frame) error {
+				return websocket.JSON.Send(ws, frame)
+			})
+			c.logEnd(ctx, err)
+		},
+	}
+	server.ServeHTTP(ctx.Writer, ctx.Request)
+}
+
+// checkOrigin refuses the WebSockets of pages from origins that are not
+// allowed, with 403. Clients other than browsers send no Origin.
+func (c *StreamController) checkOrigin(config *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	if len(c.allowedOrigins) == 0 {
+		if parsed, err := url.Parse(origin); err == nil && parsed.Host == req.Host {
+			return nil
+		}
+	} else if slices.Contains(c.allowedOrigins, origin) {
+		return nil
+	}
+	return fmt.Errorf("origin %s is not allowed", origin)
+}
+
+// subscribe subscribes to the stream of the user of the route, resuming after
+// lastEventID, or the last_event_id query parameter when empty, and responds
+// with the error when it cannot.
+func (c *StreamController) subscribe(ctx *gin.Context, lastEventID string) (*Subscription, bool) {
+	userID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return nil, false
+	}
+
+	var afterID int64
+	if lastEventID == "" {
+		lastEventID = ctx.Query("last_event_id")
+	}
+	if lastEventID != "" {
+		if afterID, err = strconv.ParseInt(lastEventID, 10, 64); err != nil {
+			verr := &utils.ValidationError{}
+			verr.Add("last_event_id", "must be a transaction id")
+			ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(verr.Err()))
+			return nil, false
+		}
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	sub, err := c.service.Subscribe(reqCtx, userID, afterID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return nil, false
+	}
+	return sub, true
+}
+
+func (c *StreamController) logEnd(ctx *gin.Context, err error) {
+	if err != nil && !errors.Is(err, context.Canceled) && ctx.Request.Context().Err() == nil {
+		c.logger.Printf("Stream of user %s ended: %v\n", ctx.Param("id"), err)
+	}
+}
+
+func errorStatus(err error) int {
+	switch {
+	case utils.IsValidationError(err):
+		return http.StatusBadRequest
+	case utils.IsBankSystemError(err, utils.ErrUserNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RegisterRoutes serves the stream of a user as Server-Sent Events and over
+// a WebSocket, only to the user, behind the owner middleware. query
+// authenticates the clients that cannot set headers, such as EventSource.
+func (c *StreamController) RegisterRoutes(router *gin.Engine, query, owner gin.HandlerFunc) {
+	group := router.Group("/users/:id/stream", query, owner)
+	{
+		group.GET("", c.StreamEvents)
+		group.GET("/ws", c.StreamWebSocket)
+	}
+}
@@ -0,0 +1,65 @@
+package stream
+
+import (
+	"bank_system/pkg/memstore"
+	"bank_system/pkg/outbox"
+	"context"
+	"slices"
+	"sort"
+)
+
+type memoryStreamRepository struct {
+	store *memstore.Store
+}
+
+func NewMemoryStreamRepository(store *memstore.Store) StreamRepository {
+	return &memoryStreamRepository{store: store}
+}
+
+func (r *memoryStreamRepository) GetTransactionsAfter(
+	ctx context.Context, accountIDs []int64, afterID int64, limit int,
+) ([]outbox.TransactionData, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	transactions := []outbox.TransactionData{}
+	for _, tx := range r.store.Transactions {
+		if tx.ID <= afterID ||
+			!slices.Contains(accountIDs, tx.AccountFrom) && !(tx.AccountTo.Valid && slices.Contains(accountIDs, tx.AccountTo.Int64)) {
+			continue
+		}
+
+		data := outbox.TransactionData{
+			TransactionID: tx.ID,
+			TxType:        string(tx.TxType),
+			AccountID:     tx.AccountFrom,
+			Amount:        tx.Amount,
+			BalanceAfter:  tx.BalanceAfter,
+			Detail:        tx.Detail,
+		}
+		if from, ok := r.store.Accounts[tx.AccountFrom]; ok {
+			data.AccountNumber = from.IDNumber
+			data.CurrencyCode = from.CurrencyCode
+		}
+		if tx.AccountTo.Valid {
+			toID, credited := tx.AccountTo.Int64, tx.Amount
+			data.ToAccountID = &toID
+			if to, ok := r.store.Accounts[toID]; ok {
+				number, currencyCode := to.IDNumber, to.CurrencyCode
+				data.ToAccountNumber = &number
+				data.ToCurrencyCode = &currencyCode
+			}
+			if fx, ok := r.store.FXTransfers[tx.ID]; ok {
+				credited = fx.ConvertedAmount
+			}
+			data.CreditedAmount = &credited
+		}
+		transactions = append(transactions, data)
+	}
+	sort.Slice(transactions, func(i, j int) bool { return transactions[i].TransactionID < transactions[j].TransactionID })
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+	}
+
+	return transactions, nil
+}
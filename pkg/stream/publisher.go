@@ -0,0 +1,48 @@
+package stream
+
+import (
+	"bank_system/pkg/outbox"
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// AccountChannel is the Redis Pub/Sub channel the events of an account are
+// published on.
+func AccountChannel(accountID int64) string {
+	return "account:events:" + strconv.FormatInt(accountID, 10)
+}
+
+type redisPubSubPublisher struct {
+	client *redis.Client
+}
+
+// NewRedisPubSubPublisher publishes every event as JSON on the channel of its
+// account and, for transfers, on the channel of the recipient. Pub/Sub keeps
+// nothing, a stream that was not listening reads what it missed from the
+// transactions.
+func NewRedisPubSubPublisher(client *redis.Client) outbox.Publisher {
+	return &redisPubSubPublisher{client: client}
+}
+
+func (p *redisPubSubPublisher) Publish(ctx context.Context, events []outbox.Event) error {
+	pipe := p.client.Pipeline()
+	for _, event := range events {
+		message, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		pipe.Publish(ctx, AccountChannel(event.AccountID), message)
+
+		var data struct {
+			ToAccountID *int64 `json:"to_account_id"`
+		}
+		if err := json.Unmarshal(event.Data, &data); err == nil && data.ToAccountID != nil && *data.ToAccountID != event.AccountID {
+			pipe.Publish(ctx, AccountChannel(*data.ToAccountID), message)
+		}
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,69 @@
+// Package stream pushes the new transactions and balances of a user's
+// accounts to the user over Server-Sent Events or a WebSocket. The outbox
+// relay publishes every event on the Redis channel of its accounts, so a
+// stream served by any instance sees the changes made by all of them.
+package stream
+
+import (
+	"bank_system/pkg/outbox"
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type StreamRepository interface {
+	// GetTransactionsAfter returns up to limit transactions from or to the
+	// accounts whose id is above afterID, by id, as the data of their
+	// outbox events.
+	GetTransactionsAfter(ctx context.Context, accountIDs []int64, afterID int64, limit int) ([]outbox.TransactionData, error)
+}
+
+type streamRepositoryImpl struct {
+	pool *pgxpool.Pool
+}
+
+func NewStreamRepository(pool *pgxpool.Pool) StreamRepository {
+	return &streamRepositoryImpl{pool: pool}
+}
+
+func (r *streamRepositoryImpl) GetTransactionsAfter(
+	ctx context.Context, accountIDs []int64, afterID int64, limit int,
+) ([]outbox.TransactionData, error) {
+	// The same data as outbox_transaction_recorded().
+	rows, err := r.pool.Query(ctx,
+		`SELECT t.id, t.tx_type::TEXT, t.account_from, f.id_number, f.currency_code, t.amount, t.balance_after,
+			COALESCE(t.detail, ''), t.account_to, a.id_number, a.currency_code,
+			CASE WHEN t.account_to IS NOT NULL THEN COALESCE(fx.converted_amount, t.amount) END
+		FROM "BK_Transaction" t
+		JOIN "BK_Account" f ON f.id = t.account_from
+		LEFT JOIN "BK_Account" a ON a.id = t.account_to
+		LEFT JOIN "BK_FX_Transfer" fx ON fx.transaction_id = t.id
+		WHERE (t.account_from = ANY($1) OR t.account_to = ANY($1))
+			AND t.id > $2
+		ORDER BY t.id
+		LIMIT $3`,
+		accountIDs, afterID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (outbox.TransactionData, error) {
+		var tx outbox.TransactionData
+		err := row.Scan(
+			&tx.TransactionID,
+			&tx.TxType,
+			&tx.AccountID,
+			&tx.AccountNumber,
+			&tx.CurrencyCode,
+			&tx.Amount,
+			&tx.BalanceAfter,
+			&tx.Detail,
+			&tx.ToAccountID,
+			&tx.ToAccountNumber,
+			&tx.ToCurrencyCode,
+			&tx.CreditedAmount,
+		)
+		return tx, err
+	})
+}
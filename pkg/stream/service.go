@@ -0,0 +1,254 @@
+package stream
+
+import (
+	"bank_system/pkg/outbox"
+	"bank_system/postgres/sqlc"
+	"bank_system/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// The types of frames.
+const (
+	FrameTransaction = "transaction"
+	FrameBalance     = "balance"
+	FrameHeartbeat   = "heartbeat"
+)
+
+const (
+	// DefaultHeartbeat is below utils.TIMEOUT_STREAM, so that clients that
+	// time out a silent stream after it keep theirs open.
+	DefaultHeartbeat = 15 * time.Second
+	// backfillPageSize is how many missed transactions are read at a time.
+	backfillPageSize = 500
+)
+
+// Frame is a message of a stream. ID is the transaction id of transaction
+// frames, the id a client resumes from. Data is an outbox.TransactionData,
+// an outbox.ReceivedData for a transfer from another user, a Balance or a
+// Heartbeat.
+type Frame struct {
+	Type string `json:"type"`
+	ID   int64  `json:"id,omitempty"`
+	Data any    `json:"data"`
+}
+
+// Balance is the balance of an account when the frame was sent.
+type Balance struct {
+	AccountID     int64   `json:"account_id"`
+	AccountNumber string  `json:"account_number"`
+	CurrencyCode  string  `json:"currency_code"`
+	Balance       float64 `json:"balance"`
+}
+
+type Heartbeat struct {
+	Time time.Time `json:"time"`
+}
+
+// Users is what streams need of user.UserService.
+type Users interface {
+	GetUserByID(ctx context.Context, id int64) (*sqlc.GetUserByIDRow, error)
+	GetUserAccounts(ctx context.Context, id int64) (*[]sqlc.GetUserAccountsRow, error)
+}
+
+type StreamService struct {
+	repo      StreamRepository
+	users     Users
+	client    *redis.Client
+	heartbeat time.Duration
+}
+
+// NewStreamService creates the service; heartbeat is how often a quiet
+// stream sends a heartbeat frame, DefaultHeartbeat when 0.
+func NewStreamService(repo StreamRepository, users Users, client *redis.Client, heartbeat time.Duration) *StreamService {
+	if heartbeat <= 0 {
+		heartbeat = DefaultHeartbeat
+	}
+
+	return &StreamService{
+		repo:      repo,
+		users:     users,
+		client:    client,
+		heartbeat: heartbeat,
+	}
+}
+
+// Subscription is the stream of a user, listening to the accounts the user
+// has when it subscribed.
+type Subscription struct {
+	service    *StreamService
+	userID     int64
+	afterID    int64
+	accountIDs []int64
+	pubsub     *redis.PubSub
+}
+
+// Subscribe starts listening to the accounts of the user. The stream resumes
+// after the transaction afterID, the last one the client received, or starts
+// from now when it is 0. The caller runs the subscription and closes it.
+func (s *StreamService) Subscribe(ctx context.Context, userID, afterID int64) (*Subscription, error) {
+	if afterID < 0 {
+		verr := &utils.ValidationError{}
+		verr.Add("last_event_id", "must be a transaction id")
+		return nil, verr.Err()
+	}
+	if _, err := s.users.GetUserByID(ctx, userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.NewBankSystemError(utils.ErrUserNotFound, strconv.FormatInt(userID, 10))
+		}
+		return nil, err
+	}
+
+	accounts, err := s.users.GetUserAccounts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(*accounts) == 0 {
+		verr := &utils.ValidationError{}
+		verr.Add("id", "user has no accounts")
+		return nil, verr.Err()
+	}
+
+	sub := &Subscription{service: s, userID: userID, afterID: afterID}
+	channels := make([]string, len(*accounts))
+	for i, account := range *accounts {
+		sub.accountIDs = append(sub.accountIDs, account.ID)
+		channels[i] = AccountChannel(account.ID)
+	}
+
+	// Listen before reading the missed transactions, so that none falls in
+	// between; Receive waits for Redis to confirm.
+	sub.pubsub = s.client.Subscribe(ctx, channels...)
+	if _, err := sub.pubsub.Receive(ctx); err != nil {
+		sub.pubsub.Close()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Run sends the transactions missed since the subscription's afterID and the
+// balances of the accounts, then every new transaction followed by the new
+// balances of the accounts it moved, with a heartbeat when the stream is
+// quiet. It returns when ctx is done or send fails.
+func (sub *Subscription) Run(ctx context.Context, send func(Frame) error) error {
+	// The missed transactions may arrive from the subscription as well.
+	// Events are published about in the order their transactions committed,
+	// so once one arrives that was not caught up on, the others have arrived
+	// and the set is dropped; at worst a transaction is sent twice, which its
+	// id lets clients notice.
+	backfilled := map[int64]bool{}
+	for afterID := sub.afterID; afterID > 0; {
+		transactions, err := sub.service.repo.GetTransactionsAfter(ctx, sub.accountIDs, afterID, backfillPageSize)
+		if err != nil {
+			return err
+		}
+		for _, tx := range transactions {
+			if err := send(sub.transactionFrame(tx)); err != nil {
+				return err
+			}
+			backfilled[tx.TransactionID] = true
+			afterID = tx.TransactionID
+		}
+		if len(transactions) < backfillPageSize {
+			break
+		}
+	}
+	if err := sub.sendBalances(ctx, sub.accountIDs, send); err != nil {
+		return err
+	}
+
+	heartbeat := time.NewTicker(sub.service.heartbeat)
+	defer heartbeat.Stop()
+	messages := sub.pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-heartbeat.C:
+			if err := send(Frame{Type: FrameHeartbeat, Data: Heartbeat{Time: now.UTC()}}); err != nil {
+				return err
+			}
+		case message, ok := <-messages:
+			if !ok {
+				return errors.New("subscription closed")
+			}
+
+			var event outbox.Event
+			if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+				return err
+			}
+			if event.Type == outbox.EventStatusChanged {
+				continue
+			}
+			var tx outbox.TransactionData
+			if err := json.Unmarshal(event.Data, &tx); err != nil {
+				return err
+			}
+			// A transfer between two of the user's accounts is published on
+			// the channels of both and sent from the sender's.
+			if message.Channel != AccountChannel(tx.AccountID) && slices.Contains(sub.accountIDs, tx.AccountID) {
+				continue
+			}
+			if backfilled != nil {
+				if backfilled[tx.TransactionID] {
+					continue
+				}
+				backfilled = nil
+			}
+
+			if err := send(sub.transactionFrame(tx)); err != nil {
+				return err
+			}
+			moved := []int64{tx.AccountID}
+			if tx.ToAccountID != nil {
+				moved = append(moved, *tx.ToAccountID)
+			}
+			if err := sub.sendBalances(ctx, moved, send); err != nil {
+				return err
+			}
+			heartbeat.Reset(sub.service.heartbeat)
+		}
+	}
+}
+
+// transactionFrame shows the user the whole transaction when it moved money
+// from one of the user's accounts, and only the recipient's side otherwise.
+func (sub *Subscription) transactionFrame(tx outbox.TransactionData) Frame {
+	if !slices.Contains(sub.accountIDs, tx.AccountID) {
+		return Frame{Type: FrameTransaction, ID: tx.TransactionID, Data: tx.Received()}
+	}
+	return Frame{Type: FrameTransaction, ID: tx.TransactionID, Data: tx}
+}
+
+// sendBalances sends the balances of the user's accounts among accountIDs.
+func (sub *Subscription) sendBalances(ctx context.Context, accountIDs []int64, send func(Frame) error) error {
+	accounts, err := sub.service.users.GetUserAccounts(ctx, sub.userID)
+	if err != nil {
+		return err
+	}
+	for _, account := range *accounts {
+		if !slices.Contains(accountIDs, account.ID) || !slices.Contains(sub.accountIDs, account.ID) {
+			continue
+		}
+		if err := send(Frame{Type: FrameBalance, Data: Balance{
+			AccountID:     account.ID,
+			AccountNumber: account.IDNumber,
+			CurrencyCode:  account.CurrencyCode,
+			Balance:       account.Balance,
+		}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sub *Subscription) Close() error {
+	return sub.pubsub.Close()
+}
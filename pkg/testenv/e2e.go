@@ -0,0 +1,1415 @@
+package testenv
+
+import (
+	"bank_system/pkg/account"
+	"bank_system/pkg/aml"
+	"bank_system/pkg/limit"
+	"bank_system/pkg/outbox"
+	"bank_system/pkg/repotest"
+	"bank_system/pkg/risk"
+	"bank_system/pkg/screening"
+	"bank_system/pkg/stream"
+	"bank_system/pkg/webhook"
+	"bank_system/server"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/spf13/viper"
+)
+
+// rlsProbeRole is a role without BYPASSRLS used to check the row level
+// security policies; the application itself connects as the table owner.
+const rlsProbeRole = "bank_rls_probe"
+
+// Configure points the server configuration at the environment, with rate
+// limits high enough for the scenarios, the account cache enabled, plain
+// http webhooks allowed, a random admin token, risk rules that only act on
+// amounts no other scenario moves and the sanctions list of the environment,
+// whose exact matches are refused.
+func (e *Env) Configure() {
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	viper.Set("storage.backend", server.BackendPostgres)
+	viper.Set("postgres.connection_string", e.DatabaseURL)
+	viper.Set("redis.addr", e.RedisAddr)
+	viper.Set("security.totp.encryption_key", base64.StdEncoding.EncodeToString(key))
+	viper.Set("security.step_up.threshold", 0)
+	viper.Set("rate_limit.default.limit", 100000)
+	viper.Set("rate_limit.routes.login.limit", 100000)
+	viper.Set("rate_limit.routes.create_user.limit", 100000)
+	viper.Set("cache.account.enabled", true)
+	viper.Set("webhooks.allow_insecure", true)
+	viper.Set("webhooks.allow_private", true)
+	viper.Set("admin.token", randomHex(16))
+	viper.Set("risk.enabled", true)
+	viper.Set("risk.amount.review", 500)
+	viper.Set("risk.amount.block", 100000)
+	viper.Set("risk.velocity.count", 1000)
+	viper.Set("screening.list_file", e.SanctionsList)
+	viper.Set("screening.block_score", 0.99)
+}
+
+// Scenario is one end-to-end check against the running API.
+type Scenario struct {
+	Name string
+	Run  func(ctx context.Context, c *Client) error
+}
+
+var Scenarios = []Scenario{
+	{"create user", scenarioCreateUser},
+	{"deposit and withdraw", scenarioDepositWithdraw},
+	{"transfer", scenarioTransfer},
+	{"row level security", scenarioRLS},
+	{"concurrent withdrawals", scenarioConcurrentWithdrawals},
+	{"webhooks", scenarioWebhooks},
+	{"balance stream", scenarioStream},
+	{"risk review", scenarioRisk},
+	{"limits", scenarioLimits},
+	{"aml reports", scenarioAML},
+	{"sanctions screening", scenarioScreening},
+}
+
+// RunAll runs the repository conformance and stress suites against the
+// Postgres repositories and every scenario through the gin router. It returns the
+// joined failures.
+func (e *Env) RunAll(ctx context.Context) error {
+	e.Configure()
+
+	srv, err := server.NewServer()
+	if err != nil {
+		return fmt.Errorf("start server: %w", err)
+	}
+	defer srv.Stop()
+
+	httpServer := httptest.NewServer(srv.Handler())
+	defer httpServer.Close()
+
+	client := &Client{BaseURL: httpServer.URL, HTTP: httpServer.Client(), env: e}
+
+	var errs []error
+	repos := repotest.Postgres(e.Pool)
+	if err := repotest.Run(ctx, repos); err != nil {
+		errs = append(errs, fmt.Errorf("repositories: %w", err))
+	}
+	if err := repotest.Stress(ctx, repos, repotest.StressOptions{}); err != nil {
+		errs = append(errs, fmt.Errorf("stress: %w", err))
+	}
+	for _, scenario := range Scenarios {
+		e.Logger.Printf("testenv: running %q\n", scenario.Name)
+		if err := scenario.Run(ctx, client); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", scenario.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Client calls the API of the server under test.
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+
+	env *Env
+
+	mu       sync.Mutex
+	sessions map[int64]string // session tokens by user id
+	owners   map[string]int64 // users by account number
+}
+
+// Do sends body as JSON, or as a form when it is url.Values, and decodes the
+// response into out when out is not nil. Requests to /admin carry the admin
+// token, and those to /users/:id and /accounts/:id_number the session token
+// of the user, or the account's owner, when the client created them.
+func (c *Client) Do(ctx context.Context, method, path string, body, out any) (int, error) {
+	return c.do(ctx, c.sessionFor(path), method, path, body, out)
+}
+
+func (c *Client) do(ctx context.Context, token, method, path string, body, out any) (int, error) {
+	var (
+		reader      io.Reader
+		contentType string
+	)
+	switch body := body.(type) {
+	case nil:
+	case url.Values:
+		reader = strings.NewReader(body.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if strings.HasPrefix(path, "/admin/") {
+		req.Header.Set("X-Admin-Token", viper.GetString("admin.token"))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("decode %s %s: %w: %s", method, path, err, data)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func (c *Client) expect(ctx context.Context, want int, method, path string, body, out any) error {
+	return c.expectAs(ctx, c.sessionFor(path), want, method, path, body, out)
+}
+
+// expectAs is expect with the session token of another user, or none.
+func (c *Client) expectAs(ctx context.Context, token string, want int, method, path string, body, out any) error {
+	status, err := c.do(ctx, token, method, path, body, out)
+	if err != nil {
+		return err
+	}
+	if status != want {
+		return fmt.Errorf("%s %s: status %d, want %d", method, path, status, want)
+	}
+	return nil
+}
+
+// sessionFor returns the session token of the user a path belongs to, "" when
+// the client did not create them.
+func (c *Client) sessionFor(path string) string {
+	segments := strings.Split(strings.TrimPrefix(strings.SplitN(path, "?", 2)[0], "/"), "/")
+	if len(segments) < 2 {
+		return ""
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch segments[0] {
+	case "users":
+		if userID, err := strconv.ParseInt(segments[1], 10, 64); err == nil {
+			return c.sessions[userID]
+		}
+	case "accounts":
+		if userID, ok := c.owners[segments[1]]; ok {
+			return c.sessions[userID]
+		}
+	}
+	return ""
+}
+
+// session returns the session token of a user the client created.
+func (c *Client) session(userID int64) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessions[userID]
+}
+
+// login starts a session for the user, which Do then uses on their paths.
+func (c *Client) login(ctx context.Context, user userResponse, password string) error {
+	var session struct {
+		Token string `json:"token"`
+	}
+	if err := c.expect(ctx, http.StatusOK, http.MethodPost, "/users/login", map[string]string{
+		"email":    user.Email,
+		"password": password,
+	}, &session); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sessions == nil {
+		c.sessions = map[int64]string{}
+	}
+	c.sessions[user.ID] = session.Token
+	return nil
+}
+
+type userResponse struct {
+	ID    int64  `json:"id"`
+	Email string `json:"email"`
+}
+
+type accountResponse struct {
+	ID       int64   `json:"id"`
+	UserID   int64   `json:"user_id"`
+	IDNumber string  `json:"id_number"`
+	Balance  float64 `json:"balance"`
+}
+
+type moneyResponse struct {
+	TransactionID int64   `json:"transaction_id"`
+	Balance       float64 `json:"balance"`
+}
+
+func (c *Client) createUser(ctx context.Context) (userResponse, error) {
+	var user userResponse
+	name := "e2e" + randomHex(4)
+	if err := c.expect(ctx, http.StatusCreated, http.MethodPost, "/users", map[string]string{
+		"username": name,
+		"email":    name + "@example.com",
+		"password": "Password123",
+	}, &user); err != nil {
+		return user, err
+	}
+	return user, c.login(ctx, user, "Password123")
+}
+
+func (c *Client) createAccount(ctx context.Context, userID int64) (accountResponse, error) {
+	var account accountResponse
+	if err := c.expect(ctx, http.StatusCreated, http.MethodPost, "/accounts", url.Values{
+		"user_id": {strconv.FormatInt(userID, 10)},
+	}, &account); err != nil {
+		return account, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.owners == nil {
+		c.owners = map[string]int64{}
+	}
+	c.owners[account.IDNumber] = userID
+	return account, nil
+}
+
+func (c *Client) balance(ctx context.Context, idNumber string) (float64, error) {
+	var resp struct {
+		Balance float64 `json:"balance"`
+	}
+	err := c.expect(ctx, http.StatusOK, http.MethodGet, "/accounts/"+idNumber+"/balance", nil, &resp)
+	return resp.Balance, err
+}
+
+func (c *Client) move(ctx context.Context, want int, idNumber, op string, body map[string]any) (moneyResponse, error) {
+	var resp moneyResponse
+	err := c.expect(ctx, want, http.MethodPost, "/accounts/"+idNumber+"/"+op, body, &resp)
+	return resp, err
+}
+
+// newFundedAccount creates a user with one account holding amount.
+func (c *Client) newFundedAccount(ctx context.Context, amount float64) (userResponse, accountResponse, error) {
+	user, err := c.createUser(ctx)
+	if err != nil {
+		return user, accountResponse{}, err
+	}
+	account, err := c.createAccount(ctx, user.ID)
+	if err != nil {
+		return user, account, err
+	}
+	if amount > 0 {
+		if _, err := c.move(ctx, http.StatusOK, account.IDNumber, "deposit", map[string]any{"amount": amount}); err != nil {
+			return user, account, err
+		}
+	}
+	return user, account, nil
+}
+
+func scenarioCreateUser(ctx context.Context, c *Client) error {
+	user, err := c.createUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var got userResponse
+	if err := c.expect(ctx, http.StatusOK, http.MethodGet, "/users/"+strconv.FormatInt(user.ID, 10), nil, &got); err != nil {
+		return err
+	}
+	if got.Email != user.Email {
+		return fmt.Errorf("GET /users/%d: email %q, want %q", user.ID, got.Email, user.Email)
+	}
+
+	// Only the user changes their names and password, with the current one.
+	stranger, err := c.createUser(ctx)
+	if err != nil {
+		return err
+	}
+	path := "/users/" + strconv.FormatInt(user.ID, 10)
+	update := map[string]string{
+		"current_password": "Password123",
+		"username":         "e2e" + randomHex(4),
+		"email":            user.Email,
+		"password":         "Password456",
+	}
+	if err := c.expectAs(ctx, c.session(stranger.ID), http.StatusForbidden, http.MethodPut, path, update, nil); err != nil {
+		return err
+	}
+	if err := c.expectAs(ctx, c.session(stranger.ID), http.StatusForbidden, http.MethodGet, path+"/accounts", nil, nil); err != nil {
+		return err
+	}
+	update["current_password"] = "Wrong12345"
+	if err := c.expect(ctx, http.StatusUnauthorized, http.MethodPut, path, update, nil); err != nil {
+		return err
+	}
+	update["current_password"] = "Password123"
+	if err := c.expect(ctx, http.StatusOK, http.MethodPut, path, update, nil); err != nil {
+		return err
+	}
+
+	// The same email with different casing must be rejected.
+	return c.expect(ctx, http.StatusConflict, http.MethodPost, "/users", map[string]string{
+		"username": "e2e" + randomHex(4),
+		"email":    strings.ToUpper(user.Email),
+		"password": "Password123",
+	}, nil)
+}
+
+func scenarioDepositWithdraw(ctx context.Context, c *Client) error {
+	owner, account, err := c.newFundedAccount(ctx, 100)
+	if err != nil {
+		return err
+	}
+
+	// Only the owner moves money and enrols a second factor.
+	stranger, err := c.createUser(ctx)
+	if err != nil {
+		return err
+	}
+	withdraw := "/accounts/" + account.IDNumber + "/withdraw"
+	for token, want := range map[string]int{
+		"":                     http.StatusUnauthorized,
+		"1.1.forged":           http.StatusUnauthorized,
+		c.session(stranger.ID): http.StatusForbidden,
+	} {
+		if err := c.expectAs(ctx, token, want, http.MethodPost, withdraw, map[string]any{"amount": 1}, nil); err != nil {
+			return err
+		}
+	}
+	for _, path := range []string{"/totp", "/payees", "/payees/1/transfer"} {
+		if err := c.expectAs(ctx, c.session(stranger.ID), http.StatusForbidden, http.MethodPost,
+			"/users/"+strconv.FormatInt(owner.ID, 10)+path, map[string]any{}, nil); err != nil {
+			return err
+		}
+	}
+	base := "/accounts/" + account.IDNumber
+	for _, req := range []struct {
+		method, path string
+		body         any
+	}{
+		{http.MethodPost, base + "/holds", map[string]any{"amount": 1}},
+		{http.MethodPost, base + "/holds/1/capture", map[string]any{"to_account": account.IDNumber}},
+		{http.MethodPost, base + "/holds/1/release", nil},
+		{http.MethodGet, base + "/holds", nil},
+		{http.MethodGet, base + "/balances", nil},
+		{http.MethodPut, base + "/status", map[string]any{"status": "FROZEN"}},
+		{http.MethodPost, base + "/standing-orders", map[string]any{}},
+		{http.MethodGet, base + "/standing-orders", nil},
+		{http.MethodGet, base + "/statements", nil},
+		{http.MethodGet, base + "/statement", nil},
+		{http.MethodGet, base + "/export?format=ofx", nil},
+		{http.MethodPost, base + "/bulk-payments", nil},
+		{http.MethodGet, base + "/bulk-payments", nil},
+	} {
+		if err := c.expectAs(ctx, c.session(stranger.ID), http.StatusForbidden, req.method, req.path, req.body, nil); err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.move(ctx, http.StatusOK, account.IDNumber, "withdraw", map[string]any{"amount": 30.25})
+	if err != nil {
+		return err
+	}
+	if resp.Balance != 69.75 {
+		return fmt.Errorf("balance after withdraw %v, want 69.75", resp.Balance)
+	}
+
+	if _, err := c.move(ctx, http.StatusUnprocessableEntity, account.IDNumber, "withdraw", map[string]any{"amount": 1000}); err != nil {
+		return err
+	}
+	if _, err := c.move(ctx, http.StatusBadRequest, account.IDNumber, "deposit", map[string]any{"amount": -5}); err != nil {
+		return err
+	}
+
+	balance, err := c.balance(ctx, account.IDNumber)
+	if err != nil {
+		return err
+	}
+	if balance != 69.75 {
+		return fmt.Errorf("balance %v, want 69.75", balance)
+	}
+	return nil
+}
+
+func scenarioTransfer(ctx context.Context, c *Client) error {
+	_, from, err := c.newFundedAccount(ctx, 50)
+	if err != nil {
+		return err
+	}
+	_, to, err := c.newFundedAccount(ctx, 0)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.move(ctx, http.StatusOK, from.IDNumber, "transfer", map[string]any{
+		"to_account": to.IDNumber,
+		"amount":     20,
+		"detail":     "e2e transfer",
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Balance != 30 {
+		return fmt.Errorf("sender balance %v, want 30", resp.Balance)
+	}
+
+	balance, err := c.balance(ctx, to.IDNumber)
+	if err != nil {
+		return err
+	}
+	if balance != 20 {
+		return fmt.Errorf("recipient balance %v, want 20", balance)
+	}
+
+	_, err = c.move(ctx, http.StatusUnprocessableEntity, from.IDNumber, "transfer", map[string]any{
+		"to_account": to.IDNumber,
+		"amount":     31,
+	})
+	return err
+}
+
+// scenarioRLS creates two users through the API and checks, as a role that
+// is subject to row level security, that each only sees its own rows.
+func scenarioRLS(ctx context.Context, c *Client) error {
+	alice, aliceAccount, err := c.newFundedAccount(ctx, 10)
+	if err != nil {
+		return err
+	}
+	bob, bobAccount, err := c.newFundedAccount(ctx, 10)
+	if err != nil {
+		return err
+	}
+
+	pool := c.env.Pool
+	if _, err := pool.Exec(ctx, `
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = '`+rlsProbeRole+`') THEN
+				CREATE ROLE `+rlsProbeRole+` NOLOGIN;
+			END IF;
+		END
+		$$`); err != nil {
+		return err
+	}
+	if _, err := pool.Exec(ctx, `GRANT SELECT ON "BK_User", "BK_Account", "BK_Transaction" TO `+rlsProbeRole); err != nil {
+		return err
+	}
+
+	visible := func(userID int64) (map[string]bool, error) {
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback(ctx)
+
+		if _, err := tx.Exec(ctx, "SET LOCAL ROLE "+rlsProbeRole); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(ctx, "SELECT set_config('app.current_user_id', $1, true)", strconv.FormatInt(userID, 10)); err != nil {
+			return nil, err
+		}
+
+		rows, err := tx.Query(ctx, `SELECT id_number FROM "BK_Account"`)
+		if err != nil {
+			return nil, err
+		}
+		idNumbers, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return nil, err
+		}
+
+		var users int
+		if err := tx.QueryRow(ctx, `SELECT count(*) FROM "BK_User"`).Scan(&users); err != nil {
+			return nil, err
+		}
+		if users != 1 {
+			return nil, fmt.Errorf("user %d sees %d users, want 1", userID, users)
+		}
+
+		var foreign int
+		if err := tx.QueryRow(ctx, `
+			SELECT count(*) FROM "BK_Transaction" t
+			WHERE NOT EXISTS (SELECT 1 FROM "BK_Account" a WHERE a.id = t.account_from)`,
+		).Scan(&foreign); err != nil {
+			return nil, err
+		}
+		if foreign != 0 {
+			return nil, fmt.Errorf("user %d sees %d transactions of other users", userID, foreign)
+		}
+
+		seen := map[string]bool{}
+		for _, idNumber := range idNumbers {
+			seen[idNumber] = true
+		}
+		return seen, nil
+	}
+
+	for _, check := range []struct {
+		user         userResponse
+		own, foreign accountResponse
+	}{
+		{alice, aliceAccount, bobAccount},
+		{bob, bobAccount, aliceAccount},
+	} {
+		seen, err := visible(check.user.ID)
+		if err != nil {
+			return err
+		}
+		if !seen[check.own.IDNumber] {
+			return fmt.Errorf("user %d cannot see its account %s", check.user.ID, check.own.IDNumber)
+		}
+		if seen[check.foreign.IDNumber] {
+			return fmt.Errorf("user %d can see account %s of another user", check.user.ID, check.foreign.IDNumber)
+		}
+	}
+	return nil
+}
+
+// scenarioConcurrentWithdrawals races more withdrawals than the balance can
+// cover. Some may fail with a serialization error, but the balance must never
+// go negative and must match the withdrawals that succeeded.
+func scenarioConcurrentWithdrawals(ctx context.Context, c *Client) error {
+	const (
+		initial  = 100.0
+		amount   = 10.0
+		attempts = 25
+	)
+
+	_, account, err := c.newFundedAccount(ctx, initial)
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+		errs      []error
+	)
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			status, err := c.Do(ctx, http.MethodPost, "/accounts/"+account.IDNumber+"/withdraw", map[string]any{"amount": amount}, nil)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				errs = append(errs, err)
+			case status == http.StatusOK:
+				succeeded++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if succeeded > int(initial/amount) {
+		return fmt.Errorf("%d withdrawals of %v succeeded on a balance of %v", succeeded, amount, initial)
+	}
+
+	var balance float64
+	if err := c.env.Pool.QueryRow(ctx, `SELECT balance FROM "BK_Account" WHERE id = $1`, account.ID).Scan(&balance); err != nil {
+		return err
+	}
+	if want := initial - float64(succeeded)*amount; math.Abs(balance-want) > 0.001 || balance < 0 {
+		return fmt.Errorf("balance %v after %d withdrawals, want %v", balance, succeeded, want)
+	}
+
+	var withdrawals int
+	if err := c.env.Pool.QueryRow(ctx,
+		`SELECT count(*) FROM "BK_Transaction" WHERE account_from = $1 AND tx_type = 'WITHDRAW'`, account.ID,
+	).Scan(&withdrawals); err != nil {
+		return err
+	}
+	if withdrawals != succeeded {
+		return fmt.Errorf("%d withdraw transactions recorded, want %d", withdrawals, succeeded)
+	}
+	return nil
+}
+
+// scenarioWebhooks registers a webhook through the API with a local
+// receiver that checks the signature. The receiver fails the first delivery,
+// which is then dead, and accepts it once replayed. The cron jobs do not run
+// under httptest, so the scenario relays the outbox and delivers itself.
+func scenarioWebhooks(ctx context.Context, c *Client) error {
+	var (
+		mu       sync.Mutex
+		secret   string
+		fail     = true
+		received []outbox.Event
+		errs     []error
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		if err == nil {
+			err = webhook.VerifySignature(
+				secret, r.Header.Get(webhook.HeaderTimestamp), r.Header.Get(webhook.HeaderSignature), body, time.Minute, time.Now(),
+			)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("receiver: %w", err))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var event outbox.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			errs = append(errs, fmt.Errorf("receiver: %w", err))
+		}
+		if r.Header.Get(webhook.HeaderEvent) != event.Type {
+			errs = append(errs, fmt.Errorf("receiver: %s header %q, want %q", webhook.HeaderEvent, r.Header.Get(webhook.HeaderEvent), event.Type))
+		}
+		received = append(received, event)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	// The service only relays and delivers here, which needs no users.
+	deliverer := webhook.NewWebhookService(webhook.NewWebhookRepository(c.env.Pool), nil, webhook.Config{
+		MaxAttempts:   1,
+		AllowInsecure: true,
+		AllowPrivate:  true,
+	})
+	relay := outbox.NewOutboxService(outbox.NewOutboxRepository(c.env.Pool), deliverer, 0, 0)
+	deliver := func() error {
+		if _, err := relay.Relay(ctx); err != nil {
+			return err
+		}
+		_, err := deliverer.DeliverDue(ctx, time.Now())
+		return err
+	}
+
+	user, account, err := c.newFundedAccount(ctx, 0)
+	if err != nil {
+		return err
+	}
+	stranger, err := c.createUser(ctx)
+	if err != nil {
+		return err
+	}
+	base := "/users/" + strconv.FormatInt(user.ID, 10) + "/webhooks"
+
+	if err := c.expect(ctx, http.StatusBadRequest, http.MethodPost, base, map[string]any{
+		"url":         receiver.URL,
+		"event_types": []string{"account.opened"},
+	}, nil); err != nil {
+		return err
+	}
+	var created struct {
+		ID     int64  `json:"id"`
+		Secret string `json:"secret"`
+	}
+	if err := c.expect(ctx, http.StatusCreated, http.MethodPost, base, map[string]any{
+		"url":         receiver.URL,
+		"event_types": []string{outbox.EventDepositCompleted},
+	}, &created); err != nil {
+		return err
+	}
+	if created.Secret == "" {
+		return fmt.Errorf("POST %s: no secret in the response", base)
+	}
+	mu.Lock()
+	secret = created.Secret
+	mu.Unlock()
+	hook := base + "/" + strconv.FormatInt(created.ID, 10)
+	if err := c.expect(ctx, http.StatusNotFound, http.MethodGet,
+		"/users/"+strconv.FormatInt(stranger.ID, 10)+"/webhooks/"+strconv.FormatInt(created.ID, 10), nil, nil); err != nil {
+		return err
+	}
+
+	if _, err := c.move(ctx, http.StatusOK, account.IDNumber, "deposit", map[string]any{"amount": 25}); err != nil {
+		return err
+	}
+	if err := deliver(); err != nil {
+		return err
+	}
+
+	var dead []webhook.Delivery
+	if err := c.expect(ctx, http.StatusOK, http.MethodGet, hook+"/deliveries?status="+webhook.StatusDead, nil, &dead); err != nil {
+		return err
+	}
+	if len(dead) != 1 || dead[0].EventType != outbox.EventDepositCompleted || dead[0].Attempts != 1 {
+		return fmt.Errorf("dead deliveries %+v, want the deposit after one attempt", dead)
+	}
+	path := hook + "/deliveries/" + strconv.FormatInt(dead[0].ID, 10)
+	var delivery webhook.Delivery
+	if err := c.expect(ctx, http.StatusOK, http.MethodGet, path, nil, &delivery); err != nil {
+		return err
+	}
+	if len(delivery.Log) != 1 || delivery.Log[0].StatusCode != http.StatusServiceUnavailable {
+		return fmt.Errorf("delivery log %+v, want one 503", delivery.Log)
+	}
+
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	if err := c.expect(ctx, http.StatusAccepted, http.MethodPost, path+"/replay", nil, nil); err != nil {
+		return err
+	}
+	if err := deliver(); err != nil {
+		return err
+	}
+	if err := c.expect(ctx, http.StatusOK, http.MethodGet, path, nil, &delivery); err != nil {
+		return err
+	}
+	if delivery.Status != webhook.StatusDelivered || len(delivery.Log) != 2 {
+		return fmt.Errorf("replayed delivery %+v, want delivered after two attempts", delivery)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if len(received) != 1 || received[0].Type != outbox.EventDepositCompleted || received[0].AccountID != account.ID {
+		return fmt.Errorf("receiver got %+v, want the deposit to account %d", received, account.ID)
+	}
+	var data outbox.TransactionData
+	if err := json.Unmarshal(received[0].Data, &data); err != nil {
+		return err
+	}
+	if data.Amount != 25 || data.AccountNumber != account.IDNumber {
+		return fmt.Errorf("deposit event data %s", received[0].Data)
+	}
+	return nil
+}
+
+// sseFrame is an event read from a Server-Sent Events stream.
+type sseFrame struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// readFrame returns the next event of the stream that is not a heartbeat.
+func readFrame(r *bufio.Reader) (sseFrame, error) {
+	var frame sseFrame
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return frame, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if frame.Event != "" && frame.Event != stream.FrameHeartbeat {
+				return frame, nil
+			}
+			frame = sseFrame{}
+		case strings.HasPrefix(line, "id: "):
+			frame.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			frame.Event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			frame.Data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// scenarioStream follows the Server-Sent Events of a user while money is
+// deposited, then reconnects with Last-Event-ID and checks that the missed
+// transaction is sent again. The scenario relays the outbox itself.
+func scenarioStream(ctx context.Context, c *Client) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	relay := outbox.NewOutboxService(outbox.NewOutboxRepository(c.env.Pool), stream.NewRedisPubSubPublisher(c.env.Redis), 0, 0)
+
+	user, err := c.createUser(ctx)
+	if err != nil {
+		return err
+	}
+	account, err := c.createAccount(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	first, err := c.move(ctx, http.StatusOK, account.IDNumber, "deposit", map[string]any{"amount": 10})
+	if err != nil {
+		return err
+	}
+	path := "/users/" + strconv.FormatInt(user.ID, 10) + "/stream"
+
+	if err := c.expect(ctx, http.StatusBadRequest, http.MethodGet, path+"?last_event_id=x", nil, nil); err != nil {
+		return err
+	}
+	// Only the user streams their accounts.
+	if err := c.expectAs(ctx, "", http.StatusUnauthorized, http.MethodGet, path, nil, nil); err != nil {
+		return err
+	}
+	if err := c.expectAs(ctx, c.session(user.ID), http.StatusForbidden, http.MethodGet, "/users/0/stream", nil, nil); err != nil {
+		return err
+	}
+	if err := c.expectAs(ctx, "", http.StatusUnauthorized, http.MethodGet, path+"?access_token=1.1.forged", nil, nil); err != nil {
+		return err
+	}
+
+	// A WebSocket of a page of another site is refused before it upgrades.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+path+"/ws", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.session(user.ID))
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Origin", "https://attacker.example")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		return fmt.Errorf("GET %s/ws from another origin: status %d, want %d", path, resp.StatusCode, http.StatusForbidden)
+	}
+
+	// The first stream authenticates with the header, the resumed one like
+	// EventSource, with the query parameter.
+	open := func(lastEventID int64) (*bufio.Reader, func(), error) {
+		streamCtx, stop := context.WithCancel(ctx)
+		target := c.BaseURL + path
+		if lastEventID != 0 {
+			target += "?access_token=" + c.session(user.ID)
+		}
+		req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, target, nil)
+		if err != nil {
+			stop()
+			return nil, nil, err
+		}
+		if lastEventID != 0 {
+			req.Header.Set("Last-Event-ID", strconv.FormatInt(lastEventID, 10))
+		} else {
+			req.Header.Set("Authorization", "Bearer "+c.session(user.ID))
+		}
+		resp, err := c.HTTP.Do(req)
+		if err != nil {
+			stop()
+			return nil, nil, err
+		}
+		closeStream := func() {
+			stop()
+			resp.Body.Close()
+		}
+		if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+			closeStream()
+			return nil, nil, fmt.Errorf("GET %s: status %d, content type %q", path, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		return bufio.NewReader(resp.Body), closeStream, nil
+	}
+	expectFrame := func(r *bufio.Reader, event, id string, check func(data []byte) error) error {
+		frame, err := readFrame(r)
+		if err != nil {
+			return err
+		}
+		if frame.Event != event || frame.ID != id {
+			return fmt.Errorf("frame %+v, want event %q with id %q", frame, event, id)
+		}
+		return check([]byte(frame.Data))
+	}
+	balanceIs := func(want float64) func([]byte) error {
+		return func(data []byte) error {
+			var balance stream.Balance
+			if err := json.Unmarshal(data, &balance); err != nil {
+				return err
+			}
+			if balance.AccountID != account.ID || balance.Balance != want {
+				return fmt.Errorf("balance frame %s, want %v on account %d", data, want, account.ID)
+			}
+			return nil
+		}
+	}
+
+	r, closeStream, err := open(0)
+	if err != nil {
+		return err
+	}
+	defer closeStream()
+	if err := expectFrame(r, stream.FrameBalance, "", balanceIs(10)); err != nil {
+		return err
+	}
+
+	second, err := c.move(ctx, http.StatusOK, account.IDNumber, "deposit", map[string]any{"amount": 5})
+	if err != nil {
+		return err
+	}
+	if _, err := relay.Relay(ctx); err != nil {
+		return err
+	}
+	secondID := strconv.FormatInt(second.TransactionID, 10)
+	transactionIs := func(data []byte) error {
+		var tx outbox.TransactionData
+		if err := json.Unmarshal(data, &tx); err != nil {
+			return err
+		}
+		if tx.TransactionID != second.TransactionID || tx.Amount != 5 || tx.BalanceAfter != 15 {
+			return fmt.Errorf("transaction frame %s, want the deposit of 5", data)
+		}
+		return nil
+	}
+	if err := expectFrame(r, stream.FrameTransaction, secondID, transactionIs); err != nil {
+		return err
+	}
+	if err := expectFrame(r, stream.FrameBalance, "", balanceIs(15)); err != nil {
+		return err
+	}
+	closeStream()
+
+	r, closeResumed, err := open(first.TransactionID)
+	if err != nil {
+		return err
+	}
+	defer closeResumed()
+	if err := expectFrame(r, stream.FrameTransaction, secondID, transactionIs); err != nil {
+		return fmt.Errorf("resumed: %w", err)
+	}
+	return expectFrame(r, stream.FrameBalance, "", balanceIs(15))
+}
+
+// scenarioRisk moves amounts the risk rules of Configure review or block.
+// An approved withdrawal is made from its hold, a rejected transfer releases
+// it, and a blocked withdrawal is refused before the balance is checked.
+func scenarioRisk(ctx context.Context, c *Client) error {
+	_, from, err := c.newFundedAccount(ctx, 2000)
+	if err != nil {
+		return err
+	}
+	_, to, err := c.newFundedAccount(ctx, 0)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.move(ctx, http.StatusOK, from.IDNumber, "withdraw", map[string]any{"amount": 10}); err != nil {
+		return err
+	}
+
+	var review account.Review
+	if err := c.expect(ctx, http.StatusAccepted, http.MethodPost, "/accounts/"+from.IDNumber+"/withdraw",
+		map[string]any{"amount": 600, "detail": "e2e review"}, &review); err != nil {
+		return err
+	}
+	if review.DecisionID == 0 || review.HoldID == 0 || len(review.Reasons) != 1 {
+		return fmt.Errorf("withdrawal review %+v, want a decision, a hold and the amount rule", review)
+	}
+	available := func(want float64) error {
+		var balances account.Balances
+		if err := c.expect(ctx, http.StatusOK, http.MethodGet, "/accounts/"+from.IDNumber+"/balances", nil, &balances); err != nil {
+			return err
+		}
+		if balances.Available != want {
+			return fmt.Errorf("balances %+v, want %v available", balances, want)
+		}
+		return nil
+	}
+	if err := available(1390); err != nil {
+		return err
+	}
+
+	var queue []risk.Decision
+	if err := c.expect(ctx, http.StatusOK, http.MethodGet, "/admin/risk/reviews?account_number="+from.IDNumber, nil, &queue); err != nil {
+		return err
+	}
+	if len(queue) != 1 || queue[0].ID != review.DecisionID || queue[0].Outcome != risk.OutcomeReview {
+		return fmt.Errorf("review queue %+v, want decision %d", queue, review.DecisionID)
+	}
+
+	decisionPath := "/admin/risk/decisions/" + strconv.FormatInt(review.DecisionID, 10)
+	var approved risk.Decision
+	if err := c.expect(ctx, http.StatusOK, http.MethodPost, decisionPath+"/approve", nil, &approved); err != nil {
+		return err
+	}
+	if approved.ReviewStatus != risk.ReviewApproved || approved.ReviewedBy != "admin" || !approved.TransactionID.Valid {
+		return fmt.Errorf("approved decision %+v", approved)
+	}
+	if err := c.expect(ctx, http.StatusConflict, http.MethodPost, decisionPath+"/reject", nil, nil); err != nil {
+		return err
+	}
+	if balance, err := c.balance(ctx, from.IDNumber); err != nil || balance != 1390 {
+		return fmt.Errorf("balance after the approval %v, %v, want 1390", balance, err)
+	}
+
+	if err := c.expect(ctx, http.StatusAccepted, http.MethodPost, "/accounts/"+from.IDNumber+"/transfer",
+		map[string]any{"to_account": to.IDNumber, "amount": 700}, &review); err != nil {
+		return err
+	}
+	var rejected risk.Decision
+	if err := c.expect(ctx, http.StatusOK, http.MethodPost,
+		"/admin/risk/decisions/"+strconv.FormatInt(review.DecisionID, 10)+"/reject",
+		map[string]any{"note": "e2e"}, &rejected); err != nil {
+		return err
+	}
+	if rejected.ReviewStatus != risk.ReviewRejected || rejected.ReviewNote != "e2e" || rejected.ToAccountNumber != to.IDNumber {
+		return fmt.Errorf("rejected decision %+v", rejected)
+	}
+	if err := available(1390); err != nil {
+		return err
+	}
+	if balance, err := c.balance(ctx, to.IDNumber); err != nil || balance != 0 {
+		return fmt.Errorf("recipient balance after the rejection %v, %v, want 0", balance, err)
+	}
+
+	if _, err := c.move(ctx, http.StatusForbidden, from.IDNumber, "withdraw", map[string]any{"amount": 200000}); err != nil {
+		return err
+	}
+	var blocked []risk.Decision
+	if err := c.expect(ctx, http.StatusOK, http.MethodGet,
+		"/admin/risk/decisions?outcome=BLOCK&account_number="+from.IDNumber, nil, &blocked); err != nil {
+		return err
+	}
+	if len(blocked) != 1 || blocked[0].Amount != 200000 {
+		return fmt.Errorf("blocked decisions %+v, want the withdrawal of 200000", blocked)
+	}
+
+	var all []risk.Decision
+	if err := c.expect(ctx, http.StatusOK, http.MethodGet, "/admin/risk/decisions?account_number="+from.IDNumber, nil, &all); err != nil {
+		return err
+	}
+	if len(all) != 4 || all[3].Outcome != risk.OutcomeAllow {
+		return fmt.Errorf("%d decisions, want 4 from the allowed withdrawal on", len(all))
+	}
+	return nil
+}
+
+// scenarioLimits assigns a limit profile to an account through the admin API
+// and checks that the database turns away withdrawals beyond it.
+func scenarioLimits(ctx context.Context, c *Client) error {
+	_, acc, err := c.newFundedAccount(ctx, 400)
+	if err != nil {
+		return err
+	}
+
+	var profile limit.Profile
+	if err := c.expect(ctx, http.StatusCreated, http.MethodPost, "/admin/limits/profiles", map[string]any{
+		"name":  "e2e-" + acc.IDNumber,
+		"rules": []map[string]any{{"per_transaction": 100, "daily": 150}},
+	}, &profile); err != nil {
+		return err
+	}
+	profilePath := "/admin/limits/profiles/" + strconv.FormatInt(profile.ID, 10)
+	if err := c.expect(ctx, http.StatusOK, http.MethodPut, "/admin/limits/accounts/"+acc.IDNumber,
+		map[string]any{"profile_id": profile.ID}, nil); err != nil {
+		return err
+	}
+
+	for _, step := range []struct {
+		amount float64
+		want   int
+	}{
+		{120, http.StatusUnprocessableEntity},
+		{100, http.StatusOK},
+		{60, http.StatusUnprocessableEntity},
+		{50, http.StatusOK},
+	} {
+		if _, err := c.move(ctx, step.want, acc.IDNumber, "withdraw", map[string]any{"amount": step.amount}); err != nil {
+			return err
+		}
+	}
+
+	var remaining []limit.Remaining
+	if err := c.expect(ctx, http.StatusOK, http.MethodGet, "/accounts/"+acc.IDNumber+"/limits", nil, &remaining); err != nil {
+		return err
+	}
+	if len(remaining) != 1 || remaining[0].Scope != "ACCOUNT" || remaining[0].DailyUsed != 150 ||
+		remaining[0].Available == nil || *remaining[0].Available != 0 {
+		return fmt.Errorf("remaining limits %+v, want the daily limit used up", remaining)
+	}
+
+	if err := c.expect(ctx, http.StatusNoContent, http.MethodDelete, profilePath, nil, nil); err != nil {
+		return err
+	}
+	if _, err := c.move(ctx, http.StatusOK, acc.IDNumber, "withdraw", map[string]any{"amount": 60}); err != nil {
+		return err
+	}
+	if balance, err := c.balance(ctx, acc.IDNumber); err != nil || balance != 190 {
+		return fmt.Errorf("balance %v, %v, want 190", balance, err)
+	}
+	return nil
+}
+
+// scenarioAML deposits cash just below a low threshold three times, reports
+// the day as tomorrow's job would, first failing to write the files, and
+// works the cases through the admin API.
+func scenarioAML(ctx context.Context, c *Client) error {
+	user, acc, err := c.newFundedAccount(ctx, 950)
+	if err != nil {
+		return err
+	}
+	sibling, err := c.createAccount(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, step := range []struct {
+		idNumber string
+		amount   float64
+	}{{acc.IDNumber, 960}, {sibling.IDNumber, 970}} {
+		if _, err := c.move(ctx, http.StatusOK, step.idNumber, "deposit", map[string]any{"amount": step.amount}); err != nil {
+			return err
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "bank-aml-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	config := aml.Config{
+		Thresholds: map[string]float64{account.DefaultCurrencyCode: 1000},
+		// A file where the directory should be.
+		ReportDir: filepath.Join(dir, "file", "reports"),
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file"), nil, 0o600); err != nil {
+		return err
+	}
+	service := aml.NewAMLService(aml.NewAMLRepository(c.env.Pool), config)
+	if _, err := service.GenerateReports(ctx, time.Now().AddDate(0, 0, 1)); err == nil {
+		return errors.New("generate reports into a file: no error")
+	}
+	config.ReportDir = dir
+	service = aml.NewAMLService(aml.NewAMLRepository(c.env.Pool), config)
+	if generated, err := service.GenerateReports(ctx, time.Now().AddDate(0, 0, 1)); err != nil || generated != 0 {
+		return fmt.Errorf("generate reports again: %d, %v, want the files of the reports made before", generated, err)
+	}
+
+	var cases []aml.Case
+	if err := c.expect(ctx, http.StatusOK, http.MethodGet,
+		"/admin/aml/cases?user_id="+strconv.FormatInt(user.ID, 10), nil, &cases); err != nil {
+		return err
+	}
+	kinds := map[string]aml.Case{}
+	for _, found := range cases {
+		kinds[found.Kind] = found
+	}
+	large, structuring := kinds[aml.KindLargeCash], kinds[aml.KindStructuring]
+	if len(cases) != 2 || large.Total != 2880 || len(large.AccountNumbers) != 2 ||
+		len(structuring.TransactionIDs) != 3 {
+		return fmt.Errorf("cases %+v, want a large cash and a structuring case of 2880", cases)
+	}
+
+	casePath := "/admin/aml/cases/" + strconv.FormatInt(structuring.ID, 10)
+	if err := c.expect(ctx, http.StatusCreated, http.MethodPost, casePath+"/notes",
+		map[string]any{"note": "asked the customer"}, nil); err != nil {
+		return err
+	}
+	var closed aml.Case
+	if err := c.expect(ctx, http.StatusOK, http.MethodPost, casePath+"/close",
+		map[string]any{"resolution": aml.ResolutionReported, "note": "filed"}, &closed); err != nil {
+		return err
+	}
+	if closed.Status != aml.CaseClosed || len(closed.Notes) != 2 {
+		return fmt.Errorf("closed case %+v, want it closed with 2 notes", closed)
+	}
+	if err := c.expect(ctx, http.StatusConflict, http.MethodPost, casePath+"/close",
+		map[string]any{"resolution": aml.ResolutionDismissed}, nil); err != nil {
+		return err
+	}
+
+	status, err := c.Do(ctx, http.MethodGet,
+		"/admin/aml/reports/"+strconv.FormatInt(large.ReportID, 10)+"?format=csv", nil, nil)
+	if err != nil || status != http.StatusOK {
+		return fmt.Errorf("csv download: status %d, %v", status, err)
+	}
+	report, err := service.GetReport(ctx, large.ReportID)
+	if err != nil {
+		return err
+	}
+	if !report.FilesWrittenAt.Valid {
+		return fmt.Errorf("report %+v, want its files written", report)
+	}
+	for _, format := range []string{aml.FormatCSV, aml.FormatJSON} {
+		if _, err := os.Stat(filepath.Join(dir, aml.ReportFilename(report, format))); err != nil {
+			return fmt.Errorf("report file: %w", err)
+		}
+	}
+	return nil
+}
+
+// scenarioScreening signs up users whose names resemble the sanctions list,
+// works their hits through the admin API and checks what their movements,
+// and transfers to them, are let through. It then lists a name after its
+// user signed up and reloads the list.
+func scenarioScreening(ctx context.Context, c *Client) error {
+	if status, err := c.Do(ctx, http.MethodPost, "/users", map[string]string{
+		"username": "Ivan.Sanctionov",
+		"email":    "e2e" + randomHex(4) + "@example.com",
+		"password": "Password123",
+	}, nil); err != nil || status != http.StatusForbidden {
+		return fmt.Errorf("sign-up of a listed name: status %d, %v, want 403", status, err)
+	}
+
+	newUser := func(username string) (userResponse, accountResponse, error) {
+		var user userResponse
+		if err := c.expect(ctx, http.StatusCreated, http.MethodPost, "/users", map[string]string{
+			"username": username,
+			"email":    "e2e" + randomHex(4) + "@example.com",
+			"password": "Password123",
+		}, &user); err != nil {
+			return user, accountResponse{}, err
+		}
+		if err := c.login(ctx, user, "Password123"); err != nil {
+			return user, accountResponse{}, err
+		}
+		acc, err := c.createAccount(ctx, user.ID)
+		if err != nil {
+			return user, acc, err
+		}
+		_, err = c.move(ctx, http.StatusOK, acc.IDNumber, "deposit", map[string]any{"amount": 400})
+		return user, acc, err
+	}
+	pendingHit := func(userID int64) (screening.Hit, error) {
+		var hits []screening.Hit
+		if err := c.expect(ctx, http.StatusOK, http.MethodGet,
+			"/admin/screening/hits?status=PENDING&user_id="+strconv.FormatInt(userID, 10), nil, &hits); err != nil {
+			return screening.Hit{}, err
+		}
+		if len(hits) != 1 || hits[0].EntryID != "E2E-1" {
+			return screening.Hit{}, fmt.Errorf("pending hits of user %d: %+v, want one of E2E-1", userID, hits)
+		}
+		return hits[0], nil
+	}
+
+	cleared, clearedAcc, err := newUser("ivan_sanctionof")
+	if err != nil {
+		return err
+	}
+	confirmed, confirmedAcc, err := newUser("ivan-sanktsionow")
+	if err != nil {
+		return err
+	}
+	_, sender, err := c.newFundedAccount(ctx, 400)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.move(ctx, http.StatusAccepted, clearedAcc.IDNumber, "withdraw", map[string]any{"amount": 100}); err != nil {
+		return err
+	}
+	if _, err := c.move(ctx, http.StatusAccepted, sender.IDNumber, "transfer",
+		map[string]any{"to_account": confirmedAcc.IDNumber, "amount": 20}); err != nil {
+		return err
+	}
+
+	hit, err := pendingHit(cleared.ID)
+	if err != nil {
+		return err
+	}
+	hitPath := "/admin/screening/hits/" + strconv.FormatInt(hit.ID, 10)
+	if err := c.expect(ctx, http.StatusOK, http.MethodPost, hitPath+"/clear", map[string]any{"note": "another person"}, nil); err != nil {
+		return err
+	}
+	if err := c.expect(ctx, http.StatusConflict, http.MethodPost, hitPath+"/confirm", nil, nil); err != nil {
+		return err
+	}
+	if _, err := c.move(ctx, http.StatusOK, clearedAcc.IDNumber, "withdraw", map[string]any{"amount": 100}); err != nil {
+		return err
+	}
+	if _, err := c.move(ctx, http.StatusOK, sender.IDNumber, "transfer",
+		map[string]any{"to_account": clearedAcc.IDNumber, "amount": 20}); err != nil {
+		return err
+	}
+
+	hit, err = pendingHit(confirmed.ID)
+	if err != nil {
+		return err
+	}
+	if err := c.expect(ctx, http.StatusOK, http.MethodPost,
+		"/admin/screening/hits/"+strconv.FormatInt(hit.ID, 10)+"/confirm", nil, nil); err != nil {
+		return err
+	}
+	if _, err := c.move(ctx, http.StatusForbidden, confirmedAcc.IDNumber, "withdraw", map[string]any{"amount": 10}); err != nil {
+		return err
+	}
+	if _, err := c.move(ctx, http.StatusForbidden, sender.IDNumber, "transfer",
+		map[string]any{"to_account": confirmedAcc.IDNumber, "amount": 20}); err != nil {
+		return err
+	}
+	// Capturing a hold to the user is a transfer to them too.
+	var hold account.Hold
+	if err := c.expect(ctx, http.StatusCreated, http.MethodPost, "/accounts/"+sender.IDNumber+"/holds",
+		map[string]any{"amount": 20}, &hold); err != nil {
+		return err
+	}
+	if err := c.expect(ctx, http.StatusForbidden, http.MethodPost,
+		"/accounts/"+sender.IDNumber+"/holds/"+strconv.FormatInt(hold.ID, 10)+"/capture",
+		map[string]any{"to_account": confirmedAcc.IDNumber}, nil); err != nil {
+		return err
+	}
+
+	// A user listed after signing up is caught when paid.
+	_, later, err := newUser("petra.listedlatter")
+	if err != nil {
+		return err
+	}
+	if _, err := c.move(ctx, http.StatusOK, sender.IDNumber, "transfer",
+		map[string]any{"to_account": later.IDNumber, "amount": 20}); err != nil {
+		return err
+	}
+	list := sanctionsList + "E2E-2,Petra Listedlater,,E2E\n"
+	if err := os.WriteFile(c.env.SanctionsList, []byte(list), 0o600); err != nil {
+		return err
+	}
+	var status screening.Status
+	if err := c.expect(ctx, http.StatusOK, http.MethodPost, "/admin/screening/list/reload", nil, &status); err != nil {
+		return err
+	}
+	if status.Entries != 2 {
+		return fmt.Errorf("reloaded list %+v, want 2 entries", status)
+	}
+	if _, err := c.move(ctx, http.StatusAccepted, sender.IDNumber, "transfer",
+		map[string]any{"to_account": later.IDNumber, "amount": 20}); err != nil {
+		return err
+	}
+
+	var matches []screening.Match
+	if err := c.expect(ctx, http.StatusOK, http.MethodGet,
+		"/admin/screening/search?name="+url.QueryEscape("Petra Listed-Later"), nil, &matches); err != nil {
+		return err
+	}
+	if len(matches) != 1 || matches[0].Entry.ID != "E2E-2" {
+		return fmt.Errorf("search matches %+v, want E2E-2", matches)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package testenv_test
+
+import (
+	"bank_system/pkg/testenv"
+	"context"
+	"errors"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestE2E runs the end-to-end scenarios, like go run ./cmd/integration, and
+// skips when neither BANK_TEST_POSTGRES_URL and BANK_TEST_REDIS_ADDR nor the
+// local binaries are available.
+func TestE2E(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the end-to-end scenarios in short mode")
+	}
+	gin.SetMode(gin.ReleaseMode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	env, err := testenv.Start(ctx, log.Default())
+	if errors.Is(err, testenv.ErrUnavailable) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Close()
+
+	if err := env.RunAll(ctx); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,306 @@
+// Package testenv provisions a throwaway Postgres database and Redis server
+// for integration tests and applies the schema migrations to it.
+//
+// Postgres and Redis are taken from, in order:
+//   - BANK_TEST_POSTGRES_URL / BANK_TEST_REDIS_ADDR, e.g. the services of
+//     docker-compose.test.yml. A fresh database is created on that server and
+//     dropped again by Close.
+//   - initdb/pg_ctl and redis-server found on PATH (or POSTGRES_BIN for the
+//     Postgres binaries), started on free ports in a temporary directory.
+package testenv
+
+import (
+	"bank_system/postgres"
+	"bank_system/server"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+)
+
+const startTimeout = 30 * time.Second
+
+var ErrUnavailable = errors.New("no Postgres or Redis available for integration tests")
+
+type Env struct {
+	// DatabaseURL points at the throwaway database, migrated to the latest version.
+	DatabaseURL string
+	RedisAddr   string
+	Pool        *pgxpool.Pool
+	Redis       *redis.Client
+	Logger      *log.Logger
+	// SanctionsList is the sanctions list file the server screens names
+	// against, which scenarios may rewrite.
+	SanctionsList string
+
+	cleanups []func()
+}
+
+// Start provisions Postgres and Redis. Call Close when done, also on error paths.
+func Start(ctx context.Context, logger *log.Logger) (*Env, error) {
+	env, err := StartPostgres(ctx, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err := env.startRedis(ctx); err != nil {
+		env.Close()
+		return nil, err
+	}
+
+	if err := env.writeSanctionsList(); err != nil {
+		env.Close()
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// StartPostgres only provisions the database, e.g. for the repository
+// conformance suite. Call Close when done, also on error paths.
+func StartPostgres(ctx context.Context, logger *log.Logger) (*Env, error) {
+	env := &Env{Logger: logger}
+
+	adminURL, err := env.startPostgres(ctx)
+	if err != nil {
+		env.Close()
+		return nil, err
+	}
+	if err := env.createDatabase(ctx, adminURL); err != nil {
+		env.Close()
+		return nil, err
+	}
+
+	env.Pool, err = server.SetPGConn(ctx, env.DatabaseURL)
+	if err != nil {
+		env.Close()
+		return nil, err
+	}
+	env.defer_(env.Pool.Close)
+
+	migrator, err := postgres.NewMigrator(env.Pool, logger)
+	if err != nil {
+		env.Close()
+		return nil, err
+	}
+	if err := migrator.Up(ctx); err != nil {
+		env.Close()
+		return nil, fmt.Errorf("apply migrations: %w", err)
+	}
+
+	return env, nil
+}
+
+// Close stops everything Start created, in reverse order.
+func (e *Env) Close() {
+	for i := len(e.cleanups) - 1; i >= 0; i-- {
+		e.cleanups[i]()
+	}
+	e.cleanups = nil
+}
+
+func (e *Env) defer_(fn func()) {
+	e.cleanups = append(e.cleanups, fn)
+}
+
+// sanctionsList is the list the scenarios start with; no name they make up
+// otherwise comes close to it.
+const sanctionsList = `id,name,aliases,program
+E2E-1,Ivan Sanctionov,Ivan Sanktsionov,E2E
+`
+
+func (e *Env) writeSanctionsList() error {
+	dir, err := os.MkdirTemp("", "bank-system-screening-")
+	if err != nil {
+		return err
+	}
+	e.defer_(func() { os.RemoveAll(dir) })
+
+	e.SanctionsList = filepath.Join(dir, "sanctions.csv")
+	return os.WriteFile(e.SanctionsList, []byte(sanctionsList), 0o600)
+}
+
+func (e *Env) startPostgres(ctx context.Context) (string, error) {
+	if adminURL := os.Getenv("BANK_TEST_POSTGRES_URL"); adminURL != "" {
+		return adminURL, nil
+	}
+
+	initdb, err := lookPostgresBinary("initdb")
+	if err != nil {
+		return "", err
+	}
+	pgCtl, err := lookPostgresBinary("pg_ctl")
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := os.MkdirTemp("", "bank-system-pg-")
+	if err != nil {
+		return "", err
+	}
+	e.defer_(func() { os.RemoveAll(dir) })
+
+	port, err := freePort()
+	if err != nil {
+		return "", err
+	}
+
+	data := filepath.Join(dir, "data")
+	if err := e.run(ctx, initdb, "-D", data, "-U", "postgres", "-A", "trust", "--no-sync"); err != nil {
+		return "", fmt.Errorf("initdb: %w", err)
+	}
+
+	options := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -c fsync=off", port, dir)
+	if err := e.run(ctx, pgCtl, "-D", data, "-o", options, "-l", filepath.Join(dir, "postgres.log"), "-w", "start"); err != nil {
+		return "", fmt.Errorf("pg_ctl start: %w", err)
+	}
+	e.defer_(func() {
+		e.run(context.Background(), pgCtl, "-D", data, "-m", "immediate", "-w", "stop")
+	})
+
+	return fmt.Sprintf("postgres://postgres@127.0.0.1:%d/postgres?sslmode=disable", port), nil
+}
+
+// createDatabase creates a randomly named database through adminURL and
+// points DatabaseURL at it.
+func (e *Env) createDatabase(ctx context.Context, adminURL string) error {
+	admin, err := pgx.Connect(ctx, adminURL)
+	if err != nil {
+		return err
+	}
+	defer admin.Close(ctx)
+
+	name := "bank_test_" + randomHex(6)
+	if _, err := admin.Exec(ctx, "CREATE DATABASE "+name); err != nil {
+		return err
+	}
+	e.defer_(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+		defer cancel()
+
+		conn, err := pgx.Connect(ctx, adminURL)
+		if err != nil {
+			e.Logger.Printf("testenv: drop database %s: %v\n", name, err)
+			return
+		}
+		defer conn.Close(ctx)
+		if _, err := conn.Exec(ctx, "DROP DATABASE IF EXISTS "+name+" WITH (FORCE)"); err != nil {
+			e.Logger.Printf("testenv: drop database %s: %v\n", name, err)
+		}
+	})
+
+	u, err := url.Parse(adminURL)
+	if err != nil {
+		return err
+	}
+	u.Path = "/" + name
+	e.DatabaseURL = u.String()
+	return nil
+}
+
+func (e *Env) startRedis(ctx context.Context) error {
+	addr := os.Getenv("BANK_TEST_REDIS_ADDR")
+	local := addr == ""
+
+	if local {
+		bin, err := exec.LookPath("redis-server")
+		if err != nil {
+			return fmt.Errorf("%w: redis-server not found and BANK_TEST_REDIS_ADDR not set", ErrUnavailable)
+		}
+		port, err := freePort()
+		if err != nil {
+			return err
+		}
+
+		cmd := exec.Command(bin, "--port", strconv.Itoa(port), "--bind", "127.0.0.1", "--save", "", "--appendonly", "no")
+		cmd.Stdout, cmd.Stderr = io.Discard, io.Discard
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		e.defer_(func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		})
+		addr = "127.0.0.1:" + strconv.Itoa(port)
+	}
+
+	e.RedisAddr = addr
+	e.Redis = redis.NewClient(&redis.Options{Addr: addr})
+	e.defer_(func() { e.Redis.Close() })
+
+	deadline := time.Now().Add(startTimeout)
+	for {
+		err := e.Redis.Ping(ctx).Err()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("redis at %s: %w", addr, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if local {
+		return e.Redis.FlushDB(ctx).Err()
+	}
+	return nil
+}
+
+func (e *Env) run(ctx context.Context, name string, args ...string) error {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w\n%s", err, out)
+	}
+	return nil
+}
+
+func lookPostgresBinary(name string) (string, error) {
+	if dir := os.Getenv("POSTGRES_BIN"); dir != "" {
+		return filepath.Join(dir, name), nil
+	}
+	if path, err := exec.LookPath(name); err == nil {
+		return path, nil
+	}
+	if out, err := exec.Command("pg_config", "--bindir").Output(); err == nil {
+		path := filepath.Join(string(trimNewline(out)), name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s not found and BANK_TEST_POSTGRES_URL not set", ErrUnavailable, name)
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func trimNewline(b []byte) []byte {
+	for len(b) > 0 && (b[len(b)-1] == '\n' || b[len(b)-1] == '\r') {
+		b = b[:len(b)-1]
+	}
+	return b
+}
@@ -0,0 +1,55 @@
+package transaction
+
+import (
+	"bank_system/pkg/memstore"
+	"bank_system/postgres/sqlc"
+	"bank_system/utils"
+	"context"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// memoryTxRepository is a TxRepository backed by a memstore.Store.
+type memoryTxRepository struct {
+	store *memstore.Store
+}
+
+func NewMemoryTxRepository(store *memstore.Store) TxRepository {
+	return &memoryTxRepository{store: store}
+}
+
+func (r *memoryTxRepository) CreateTransaction(ctx context.Context, accountID int64, amount float64, txType, detail string) (sqlc.BKTransaction, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	account, ok := r.store.Accounts[accountID]
+	if !ok {
+		return sqlc.BKTransaction{}, utils.NewBankSystemError(utils.ErrAccountNotFound, strconv.FormatInt(accountID, 10))
+	}
+
+	switch txType {
+	case TxType_DEPOSIT, TxType_WITHDRAW, TxType_TRANSFER, TxType_INTEREST, TxType_FEE:
+	default:
+		return sqlc.BKTransaction{}, utils.NewBankSystemError(utils.ErrInvalidTransactionType, txType)
+	}
+
+	return r.store.InsertTransaction(ctx, sqlc.BKTransaction{
+		AccountFrom:  accountID,
+		Amount:       amount,
+		BalanceAfter: account.Balance,
+		TxType:       sqlc.TxType(txType),
+		Detail:       detail,
+	}), nil
+}
+
+func (r *memoryTxRepository) GetTransactionByID(ctx context.Context, id int64) (sqlc.BKTransaction, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	tx, ok := r.store.Transactions[id]
+	if !ok {
+		return sqlc.BKTransaction{}, pgx.ErrNoRows
+	}
+	return *tx, nil
+}
@@ -3,6 +3,9 @@ package transaction
 const (
 	TxType_DEPOSIT  = "DEPOSIT"
 	TxType_WITHDRAW = "WITHDRAW"
+	TxType_TRANSFER = "TRANSFER"
+	TxType_INTEREST = "INTEREST"
+	TxType_FEE      = "FEE"
 )
 
 func GetTxType(txTypeCode int) string {
@@ -11,6 +14,12 @@ func GetTxType(txTypeCode int) string {
 		return TxType_DEPOSIT
 	case 1:
 		return TxType_WITHDRAW
+	case 2:
+		return TxType_TRANSFER
+	case 3:
+		return TxType_INTEREST
+	case 4:
+		return TxType_FEE
 	default:
 		return ""
 	}
@@ -1,6 +1,7 @@
 package user
 
 import (
+	"bank_system/utils"
 	"context"
 	"log"
 	"net/http"
@@ -31,7 +32,7 @@ func (u *UserController) CreateUser(ctx *gin.Context) {
 
 	var user CreateUserRequest
 	if err := ctx.ShouldBindJSON(&user); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
 		return
 	}
 
@@ -41,7 +42,7 @@ func (u *UserController) CreateUser(ctx *gin.Context) {
 
 	createdUser, err := u.service.CreateUser(reqCtx, user.Username, user.Email, user.Password)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
 		return
 	}
 
@@ -113,14 +114,16 @@ func (u *UserController) UpdateUser(ctx *gin.Context) {
 	}
 
 	type UpdateUserRequest struct {
-		Username string `json:"username" binding:"required"`
-		Email    string `json:"email" binding:"required"`
-		Password string `json:"password" binding:"required"`
+		CurrentPassword string `json:"current_password" binding:"required"`
+		OTPCode         string `json:"otp_code"`
+		Username        string `json:"username" binding:"required"`
+		Email           string `json:"email" binding:"required"`
+		Password        string `json:"password" binding:"required"`
 	}
 
 	var user UpdateUserRequest
 	if err := ctx.ShouldBindJSON(&user); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
 		return
 	}
 
@@ -128,22 +131,143 @@ func (u *UserController) UpdateUser(ctx *gin.Context) {
 	reqCtx, cancel := context.WithTimeout(reqCtx, 5*time.Second)
 	defer cancel()
 
-	err = u.service.UpdateUser(reqCtx, userID, user.Username, user.Email, user.Password)
+	err = u.service.UpdateUser(reqCtx, userID, user.CurrentPassword, user.OTPCode, user.Username, user.Email, user.Password)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
 }
 
-func (u *UserController) RegisterRoutes(router *gin.Engine) {
+func (u *UserController) Login(ctx *gin.Context) {
+	type LoginRequest struct {
+		Email    string `json:"email" binding:"required"`
+		Password string `json:"password" binding:"required"`
+		OTPCode  string `json:"otp_code"`
+	}
+
+	var req LoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, 5*time.Second)
+	defer cancel()
+
+	session, err := u.service.Login(reqCtx, req.Email, req.Password, req.OTPCode)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, session)
+}
+
+func (u *UserController) EnrollTOTP(ctx *gin.Context) {
+	id := ctx.Param("id")
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, 5*time.Second)
+	defer cancel()
+
+	enrollment, err := u.service.EnrollTOTP(reqCtx, userID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, enrollment)
+}
+
+func (u *UserController) ConfirmTOTP(ctx *gin.Context) {
+	u.handleTOTPCode(ctx, u.service.ConfirmTOTP, "Two-factor authentication enabled")
+}
+
+func (u *UserController) DisableTOTP(ctx *gin.Context) {
+	u.handleTOTPCode(ctx, u.service.DisableTOTP, "Two-factor authentication disabled")
+}
+
+func (u *UserController) handleTOTPCode(
+	ctx *gin.Context,
+	action func(ctx context.Context, userID int64, code string) error,
+	message string,
+) {
+	id := ctx.Param("id")
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	type TOTPCodeRequest struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	var req TOTPCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, 5*time.Second)
+	defer cancel()
+
+	if err := action(reqCtx, userID, req.Code); err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+func errorStatus(err error) int {
+	switch {
+	case utils.IsValidationError(err):
+		return http.StatusBadRequest
+	case utils.IsBankSystemError(err, utils.ErrEmailExists):
+		return http.StatusConflict
+	case utils.IsBankSystemError(err, utils.ErrInvalidCredentials),
+		utils.IsBankSystemError(err, utils.ErrOTPRequired),
+		utils.IsBankSystemError(err, utils.ErrInvalidOTP):
+		return http.StatusUnauthorized
+	case utils.IsBankSystemError(err, utils.ErrTOTPNotEnabled),
+		utils.IsBankSystemError(err, utils.ErrTOTPAlreadyEnabled):
+		return http.StatusConflict
+	case utils.IsBankSystemError(err, utils.ErrUserScreeningBlocked):
+		return http.StatusForbidden
+	case utils.IsBankSystemError(err, utils.ErrLoginLocked):
+		return http.StatusTooManyRequests
+	case utils.IsBankSystemError(err, utils.ErrSecurityUnavailable):
+		return http.StatusServiceUnavailable
+	case utils.IsBankSystemError(err, utils.ErrTOTPNotConfigured):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RegisterRoutes serves the two-factor enrolment, the accounts and the update
+// of a user only to the user, behind the owner middleware.
+func (u *UserController) RegisterRoutes(router *gin.Engine, owner gin.HandlerFunc) {
 	group := router.Group("/users")
 	{
 		group.POST("", u.CreateUser)
+		group.POST("/login", u.Login)
+		group.POST("/:id/totp", owner, u.EnrollTOTP)
+		group.POST("/:id/totp/confirm", owner, u.ConfirmTOTP)
+		group.POST("/:id/totp/disable", owner, u.DisableTOTP)
 		group.GET("/:id", u.GetUserByID)
-		group.GET("/:id/accounts", u.GetUserAccounts)
+		group.GET("/:id/accounts", owner, u.GetUserAccounts)
 		group.GET("", u.GetAllUsers)
-		group.PUT("/:id", u.UpdateUser)
+		group.PUT("/:id", owner, u.UpdateUser)
 	}
 }
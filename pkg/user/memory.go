@@ -0,0 +1,254 @@
+package user
+
+import (
+	"bank_system/pkg/memstore"
+	"bank_system/postgres/sqlc"
+	"bank_system/utils"
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// memoryUserRepository is a UserRepository backed by a memstore.Store. It
+// enforces the same constraints as the "BK_User" table.
+type memoryUserRepository struct {
+	store *memstore.Store
+}
+
+func NewMemoryUserRepository(store *memstore.Store) UserRepository {
+	return &memoryUserRepository{store: store}
+}
+
+func (r *memoryUserRepository) CreateUser(ctx context.Context, username, email, password string) (sqlc.BKUser, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	if r.emailTaken(email, 0) {
+		return sqlc.BKUser{}, utils.NewBankSystemError(utils.ErrEmailExists, email)
+	}
+
+	now := memstore.Now()
+	user := &sqlc.BKUser{
+		ID:        r.store.NextID("BK_User"),
+		Username:  username,
+		Email:     email,
+		Password:  password,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	r.store.Users[user.ID] = user
+	r.store.Audit(ctx, "BK_User", user.ID, nil, *user)
+
+	return *user, nil
+}
+
+func (r *memoryUserRepository) GetUserByID(ctx context.Context, id int64) (sqlc.GetUserByIDRow, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	user, ok := r.store.Users[id]
+	if !ok {
+		return sqlc.GetUserByIDRow{}, pgx.ErrNoRows
+	}
+	return sqlc.GetUserByIDRow{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}, nil
+}
+
+func (r *memoryUserRepository) GetUserAccounts(ctx context.Context, id int64) ([]sqlc.GetUserAccountsRow, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	accounts := []sqlc.GetUserAccountsRow{}
+	for _, account := range r.store.Accounts {
+		if account.UserID != id {
+			continue
+		}
+		accounts = append(accounts, sqlc.GetUserAccountsRow{
+			ID:           account.ID,
+			UserID:       account.UserID,
+			IDNumber:     account.IDNumber,
+			CurrencyCode: account.CurrencyCode,
+			Balance:      account.Balance,
+			Status:       account.Status,
+			CreatedAt:    account.CreatedAt,
+			UpdatedAt:    account.UpdatedAt,
+		})
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+
+	return accounts, nil
+}
+
+func (r *memoryUserRepository) GetAllUsers(ctx context.Context) ([]sqlc.GetAllUsersRow, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	users := []sqlc.GetAllUsersRow{}
+	for _, user := range r.store.Users {
+		users = append(users, sqlc.GetAllUsersRow{
+			ID:        user.ID,
+			Username:  user.Username,
+			Email:     user.Email,
+			CreatedAt: user.CreatedAt,
+			UpdatedAt: user.UpdatedAt,
+		})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return users, nil
+}
+
+func (r *memoryUserRepository) CheckUserEmailExists(ctx context.Context, email string) (bool, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	return r.emailTaken(email, 0), nil
+}
+
+func (r *memoryUserRepository) UpdateUser(ctx context.Context, id int64, username, email, password string) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	user, ok := r.store.Users[id]
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	if r.emailTaken(email, id) {
+		return utils.NewBankSystemError(utils.ErrEmailExists, email)
+	}
+
+	before := *user
+	user.Username = username
+	user.Email = email
+	user.Password = password
+	user.UpdatedAt = memstore.Now()
+	r.store.Audit(ctx, "BK_User", user.ID, before, *user)
+
+	return nil
+}
+
+func (r *memoryUserRepository) GetUserByEmail(ctx context.Context, email string) (sqlc.BKUser, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	for _, user := range r.store.Users {
+		if user.Email == email {
+			return *user, nil
+		}
+	}
+	return sqlc.BKUser{}, pgx.ErrNoRows
+}
+
+func (r *memoryUserRepository) GetUserTOTP(ctx context.Context, userID int64) (UserTOTP, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.UserTOTP[userID]
+	if !ok {
+		return UserTOTP{}, pgx.ErrNoRows
+	}
+	return UserTOTP{
+		UserID:        userID,
+		Secret:        append([]byte(nil), record.Secret...),
+		RecoveryCodes: append([]string(nil), record.RecoveryCodes...),
+		Confirmed:     record.Confirmed,
+		LastStep:      record.LastStep,
+	}, nil
+}
+
+func (r *memoryUserRepository) UpsertUserTOTP(ctx context.Context, userID int64, secret []byte, recoveryCodes []string) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	if _, ok := r.store.Users[userID]; !ok {
+		return utils.NewBankSystemError(utils.ErrUserNotFound, strconv.FormatInt(userID, 10))
+	}
+	var before any
+	if record, ok := r.store.UserTOTP[userID]; ok {
+		before = *record
+	}
+	record := &memstore.TOTPRecord{
+		Secret:        append([]byte(nil), secret...),
+		RecoveryCodes: append([]string(nil), recoveryCodes...),
+	}
+	r.store.UserTOTP[userID] = record
+	r.store.Audit(ctx, "BK_User_TOTP", userID, before, *record)
+	return nil
+}
+
+func (r *memoryUserRepository) ConfirmUserTOTP(ctx context.Context, userID int64, lastStep int64) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.UserTOTP[userID]
+	if !ok || record.Confirmed {
+		return pgx.ErrNoRows
+	}
+	before := *record
+	record.Confirmed = true
+	record.LastStep = lastStep
+	r.store.Audit(ctx, "BK_User_TOTP", userID, before, *record)
+	return nil
+}
+
+func (r *memoryUserRepository) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.UserTOTP[userID]
+	if !ok || record.LastStep >= step {
+		return pgx.ErrNoRows
+	}
+	before := *record
+	record.LastStep = step
+	r.store.Audit(ctx, "BK_User_TOTP", userID, before, *record)
+	return nil
+}
+
+func (r *memoryUserRepository) UseRecoveryCode(ctx context.Context, userID int64, hash string) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.UserTOTP[userID]
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	for i, code := range record.RecoveryCodes {
+		if code == hash {
+			before := *record
+			record.RecoveryCodes = append(record.RecoveryCodes[:i:i], record.RecoveryCodes[i+1:]...)
+			r.store.Audit(ctx, "BK_User_TOTP", userID, before, *record)
+			return nil
+		}
+	}
+	return pgx.ErrNoRows
+}
+
+func (r *memoryUserRepository) DeleteUserTOTP(ctx context.Context, userID int64) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	if record, ok := r.store.UserTOTP[userID]; ok {
+		delete(r.store.UserTOTP, userID)
+		r.store.Audit(ctx, "BK_User_TOTP", userID, *record, nil)
+	}
+	return nil
+}
+
+// emailTaken reports whether another user than exceptID uses email. The
+// caller must hold the store lock.
+func (r *memoryUserRepository) emailTaken(email string, exceptID int64) bool {
+	for _, user := range r.store.Users {
+		if user.Email == email && user.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
@@ -4,6 +4,7 @@ import (
 	"bank_system/postgres/sqlc"
 	"context"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -14,6 +15,30 @@ type UserRepository interface {
 	GetAllUsers(ctx context.Context) ([]sqlc.GetAllUsersRow, error)
 	CheckUserEmailExists(ctx context.Context, email string) (bool, error)
 	UpdateUser(ctx context.Context, id int64, username, email, password string) error
+	GetUserByEmail(ctx context.Context, email string) (sqlc.BKUser, error)
+	GetUserTOTP(ctx context.Context, userID int64) (UserTOTP, error)
+	UpsertUserTOTP(ctx context.Context, userID int64, secret []byte, recoveryCodes []string) error
+	// ConfirmUserTOTP activates a pending enrolment. It returns
+	// pgx.ErrNoRows when there is none.
+	ConfirmUserTOTP(ctx context.Context, userID int64, lastStep int64) error
+	// UseTOTPStep records the time step of a code as used. It returns
+	// pgx.ErrNoRows when the step, or a later one, was used already, so that
+	// concurrent requests cannot both accept a code.
+	UseTOTPStep(ctx context.Context, userID int64, step int64) error
+	// UseRecoveryCode removes the recovery code hash. It returns
+	// pgx.ErrNoRows when the hash is not, or no longer, among the codes.
+	UseRecoveryCode(ctx context.Context, userID int64, hash string) error
+	DeleteUserTOTP(ctx context.Context, userID int64) error
+}
+
+// UserTOTP is the stored two-factor enrolment of a user. Secret is encrypted
+// and RecoveryCodes holds bcrypt hashes of the unused recovery codes.
+type UserTOTP struct {
+	UserID        int64
+	Secret        []byte
+	RecoveryCodes []string
+	Confirmed     bool
+	LastStep      int64
 }
 
 type userRepositoryImpl struct {
@@ -65,3 +90,92 @@ func (r *userRepositoryImpl) UpdateUser(ctx context.Context, id int64, username,
 	})
 	return err
 }
+
+func (r *userRepositoryImpl) GetUserByEmail(ctx context.Context, email string) (sqlc.BKUser, error) {
+	var user sqlc.BKUser
+	err := r.pool.QueryRow(ctx, `
+		SELECT id, username, email, password, created_at, updated_at
+		FROM "BK_User"
+		WHERE email = $1`,
+		email,
+	).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	return user, err
+}
+
+func (r *userRepositoryImpl) GetUserTOTP(ctx context.Context, userID int64) (UserTOTP, error) {
+	totp := UserTOTP{UserID: userID}
+	err := r.pool.QueryRow(ctx, `
+		SELECT secret, recovery_codes, confirmed_at IS NOT NULL, last_used_step
+		FROM "BK_User_TOTP"
+		WHERE user_id = $1`,
+		userID,
+	).Scan(&totp.Secret, &totp.RecoveryCodes, &totp.Confirmed, &totp.LastStep)
+	return totp, err
+}
+
+func (r *userRepositoryImpl) UpsertUserTOTP(ctx context.Context, userID int64, secret []byte, recoveryCodes []string) error {
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO "BK_User_TOTP" (user_id, secret, recovery_codes)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret,
+			recovery_codes = EXCLUDED.recovery_codes,
+			confirmed_at = NULL,
+			last_used_step = 0`,
+		userID, secret, recoveryCodes,
+	)
+	return err
+}
+
+func (r *userRepositoryImpl) ConfirmUserTOTP(ctx context.Context, userID int64, lastStep int64) error {
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE "BK_User_TOTP"
+		SET confirmed_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NULL`,
+		userID, lastStep,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (r *userRepositoryImpl) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE "BK_User_TOTP"
+		SET last_used_step = $2
+		WHERE user_id = $1 AND last_used_step < $2`,
+		userID, step,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (r *userRepositoryImpl) UseRecoveryCode(ctx context.Context, userID int64, hash string) error {
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE "BK_User_TOTP"
+		SET recovery_codes = array_remove(recovery_codes, $2)
+		WHERE user_id = $1 AND $2 = ANY(recovery_codes)`,
+		userID, hash,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (r *userRepositoryImpl) DeleteUserTOTP(ctx context.Context, userID int64) error {
+	_, err := r.pool.Exec(ctx, `DELETE FROM "BK_User_TOTP" WHERE user_id = $1`, userID)
+	return err
+}
@@ -4,19 +4,57 @@ import (
 	"bank_system/postgres/sqlc"
 	"bank_system/utils"
 	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
+// LoginGuard tracks failed logins and locks out identities under attack.
+type LoginGuard interface {
+	LockedFor(ctx context.Context, identity string) (time.Duration, error)
+	RecordFailure(ctx context.Context, identity string) error
+	RecordSuccess(ctx context.Context, identity string) error
+}
+
+// Screener screens the names of users against a sanctions list.
+type Screener interface {
+	// ScreenUser screens a new user, userID 0, or new names of a user. It
+	// returns the id of a hit to review, 0 when there is none, and fails
+	// with ErrUserScreeningBlocked when the names are refused.
+	ScreenUser(ctx context.Context, userID int64, username, email string) (int64, error)
+	// AttachUser sets the user of the hit of a new user once created.
+	AttachUser(ctx context.Context, hitID, userID int64) error
+}
+
 type UserService struct {
-	repo UserRepository
+	repo     UserRepository
+	totp     TOTPConfig
+	sessions SessionConfig
+	guard    LoginGuard
+	screener Screener
 }
 
-func NewUserService(repo UserRepository) *UserService {
+// NewUserService creates the user service. Names are not screened when
+// screener is nil.
+func NewUserService(
+	repo UserRepository, totp TOTPConfig, sessions SessionConfig, guard LoginGuard, screener Screener,
+) *UserService {
 	return &UserService{
-		repo: repo,
+		repo:     repo,
+		totp:     totp,
+		sessions: sessions,
+		guard:    guard,
+		screener: screener,
 	}
 }
 
 func (s *UserService) CreateUser(ctx context.Context, username, email, password string) (*sqlc.BKUser, error) {
+	email = utils.NormalizeEmail(email)
+	if err := validateUser(username, email, password); err != nil {
+		return nil, err
+	}
+
 	exists, err := s.repo.CheckUserEmailExists(ctx, email)
 
 	if err != nil {
@@ -32,11 +70,24 @@ func (s *UserService) CreateUser(ctx context.Context, username, email, password
 		return nil, err
 	}
 
+	var hitID int64
+	if s.screener != nil {
+		if hitID, err = s.screener.ScreenUser(ctx, 0, username, email); err != nil {
+			return nil, err
+		}
+	}
+
 	user, err := s.repo.CreateUser(ctx, username, email, hashPassword)
 	if err != nil {
 		return nil, err
 	}
 
+	if hitID != 0 {
+		if err := s.screener.AttachUser(ctx, hitID, user.ID); err != nil {
+			return nil, err
+		}
+	}
+
 	return &user, nil
 }
 
@@ -65,13 +116,126 @@ func (s *UserService) GetAllUsers(ctx context.Context) (*[]sqlc.GetAllUsersRow,
 }
 
 func (s *UserService) CheckUserEmailExists(ctx context.Context, email string) (bool, error) {
-	return s.repo.CheckUserEmailExists(ctx, email)
+	return s.repo.CheckUserEmailExists(ctx, utils.NormalizeEmail(email))
 }
 
-func (s *UserService) UpdateUser(ctx context.Context, id int64, username, email, password string) error {
+// UpdateUser replaces the names and password of a user after checking the
+// current password and, when two-factor authentication is enabled, a TOTP or
+// recovery code, so that a stolen session cannot take the user over.
+func (s *UserService) UpdateUser(
+	ctx context.Context, id int64, currentPassword, otpCode, username, email, password string,
+) error {
+	email = utils.NormalizeEmail(email)
+	if err := validateUser(username, email, password); err != nil {
+		return err
+	}
+
+	current, err := s.repo.GetUserByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return utils.NewBankSystemError(utils.ErrInvalidCredentials)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := s.authenticate(ctx, current.Email, currentPassword, otpCode); err != nil {
+		return err
+	}
+
 	hashPassword, err := utils.HashPassword(password)
 	if err != nil {
 		return err
 	}
+
+	if s.screener != nil {
+		if _, err := s.screener.ScreenUser(ctx, id, username, email); err != nil {
+			return err
+		}
+	}
 	return s.repo.UpdateUser(ctx, id, username, email, hashPassword)
 }
+
+// Login checks the password and, when two-factor authentication is enabled,
+// the TOTP or recovery code, and starts a session. Repeated failures lock the
+// email out. Like the rate limits, the lockout fails closed: logins fail with
+// ErrSecurityUnavailable while it cannot be checked.
+func (s *UserService) Login(ctx context.Context, email, password, otpCode string) (*Session, error) {
+	email = utils.NormalizeEmail(email)
+
+	if s.guard != nil {
+		lockedFor, err := s.guard.LockedFor(ctx, email)
+		if err != nil {
+			return nil, guardUnavailable(err)
+		}
+		if lockedFor > 0 {
+			return nil, utils.NewBankSystemError(utils.ErrLoginLocked, lockedFor.Round(time.Second).String())
+		}
+	}
+
+	user, err := s.authenticate(ctx, email, password, otpCode)
+	if err != nil {
+		if s.guard != nil && isAuthFailure(err) {
+			if guardErr := s.guard.RecordFailure(ctx, email); guardErr != nil {
+				return nil, guardUnavailable(guardErr)
+			}
+		}
+		return nil, err
+	}
+
+	if s.guard != nil {
+		if err := s.guard.RecordSuccess(ctx, email); err != nil {
+			return nil, guardUnavailable(err)
+		}
+	}
+
+	row, err := s.GetUserByID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return s.newSession(row), nil
+}
+
+func guardUnavailable(err error) error {
+	return utils.NewBankSystemError(utils.ErrSecurityUnavailable, "login lockout: "+err.Error())
+}
+
+func (s *UserService) authenticate(ctx context.Context, email, password, otpCode string) (*sqlc.BKUser, error) {
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, utils.NewBankSystemError(utils.ErrInvalidCredentials)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !utils.CheckPasswordHash(password, user.Password) {
+		return nil, utils.NewBankSystemError(utils.ErrInvalidCredentials)
+	}
+
+	enabled, err := s.IsTOTPEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		if otpCode == "" {
+			return nil, utils.NewBankSystemError(utils.ErrOTPRequired)
+		}
+		if err := s.VerifyTOTP(ctx, user.ID, otpCode); err != nil {
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func isAuthFailure(err error) bool {
+	return utils.IsBankSystemError(err, utils.ErrInvalidCredentials) ||
+		utils.IsBankSystemError(err, utils.ErrInvalidOTP)
+}
+
+func validateUser(username, email, password string) error {
+	verr := &utils.ValidationError{}
+	utils.ValidateUsername(verr, username)
+	utils.ValidateEmail(verr, email)
+	utils.ValidatePassword(verr, password)
+	return verr.Err()
+}
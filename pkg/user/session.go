@@ -0,0 +1,44 @@
+package user
+
+import (
+	"bank_system/postgres/sqlc"
+	"bank_system/utils"
+	"time"
+)
+
+// DefaultSessionTTL is how long a session lasts when no TTL is configured.
+const DefaultSessionTTL = 12 * time.Hour
+
+type SessionConfig struct {
+	// Key signs the session tokens, see utils.NewSessionToken.
+	Key []byte
+	TTL time.Duration
+}
+
+// Session is what Login returns: the user and the bearer token that
+// authenticates their requests until ExpiresAt.
+type Session struct {
+	sqlc.GetUserByIDRow
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (s *UserService) newSession(user *sqlc.GetUserByIDRow) *Session {
+	ttl := s.sessions.TTL
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+
+	return &Session{
+		GetUserByIDRow: *user,
+		Token:          utils.NewSessionToken(s.sessions.Key, user.ID, expiresAt),
+		ExpiresAt:      expiresAt,
+	}
+}
+
+// Authenticate returns the user of a session token Login handed out, or
+// utils.ErrInvalidSession.
+func (s *UserService) Authenticate(token string) (int64, error) {
+	return utils.ParseSessionToken(s.sessions.Key, token, time.Now())
+}
@@ -0,0 +1,194 @@
+package user
+
+import (
+	"bank_system/utils"
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const recoveryCodeCount = 10
+
+type TOTPConfig struct {
+	Issuer string
+	// EncryptionKey is the AES key (16, 24 or 32 bytes) used to encrypt secrets at rest.
+	EncryptionKey []byte
+}
+
+type TOTPEnrollment struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"otpauth_uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// EnrollTOTP generates a new secret and recovery codes for the user. The
+// enrolment stays inactive until it is confirmed with a valid code.
+func (s *UserService) EnrollTOTP(ctx context.Context, userID int64) (*TOTPEnrollment, error) {
+	if len(s.totp.EncryptionKey) == 0 {
+		return nil, utils.NewBankSystemError(utils.ErrTOTPNotConfigured)
+	}
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.GetUserTOTP(ctx, userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	if err == nil && existing.Confirmed {
+		return nil, utils.NewBankSystemError(utils.ErrTOTPAlreadyEnabled)
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := utils.Encrypt(s.totp.EncryptionKey, []byte(secret))
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hash, err := utils.HashPassword(code)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	if err := s.repo.UpsertUserTOTP(ctx, userID, encrypted, hashes); err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret:        secret,
+		URI:           utils.TOTPURI(s.totp.Issuer, user.Email, secret),
+		RecoveryCodes: codes,
+	}, nil
+}
+
+// ConfirmTOTP activates a pending enrolment once the user proves possession of the secret.
+func (s *UserService) ConfirmTOTP(ctx context.Context, userID int64, code string) error {
+	totp, err := s.getUserTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if totp.Confirmed {
+		return utils.NewBankSystemError(utils.ErrTOTPAlreadyEnabled)
+	}
+
+	secret, err := s.decryptSecret(totp.Secret)
+	if err != nil {
+		return err
+	}
+
+	step, ok := utils.ValidateTOTP(secret, code, time.Now(), totp.LastStep)
+	if !ok {
+		return utils.NewBankSystemError(utils.ErrInvalidOTP)
+	}
+
+	err = s.repo.ConfirmUserTOTP(ctx, userID, step)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Confirmed by a concurrent request, or enrolled again meanwhile.
+		return utils.NewBankSystemError(utils.ErrInvalidOTP)
+	}
+	return err
+}
+
+// DisableTOTP removes the enrolment after verifying a current code or recovery code.
+func (s *UserService) DisableTOTP(ctx context.Context, userID int64, code string) error {
+	if err := s.VerifyTOTP(ctx, userID, code); err != nil {
+		return err
+	}
+	return s.repo.DeleteUserTOTP(ctx, userID)
+}
+
+func (s *UserService) IsTOTPEnabled(ctx context.Context, userID int64) (bool, error) {
+	totp, err := s.repo.GetUserTOTP(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return totp.Confirmed, nil
+}
+
+// VerifyTOTP accepts either a current TOTP code or an unused recovery code.
+// Codes are consumed on use: a time step, or a recovery code, only ever
+// passes one request, however many race for it.
+func (s *UserService) VerifyTOTP(ctx context.Context, userID int64, code string) error {
+	totp, err := s.getUserTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !totp.Confirmed {
+		return utils.NewBankSystemError(utils.ErrTOTPNotEnabled, strconv.FormatInt(userID, 10))
+	}
+	if code == "" {
+		return utils.NewBankSystemError(utils.ErrOTPRequired)
+	}
+
+	secret, err := s.decryptSecret(totp.Secret)
+	if err != nil {
+		return err
+	}
+
+	if step, ok := utils.ValidateTOTP(secret, code, time.Now(), totp.LastStep); ok {
+		return usedOTP(s.repo.UseTOTPStep(ctx, userID, step))
+	}
+
+	for _, hash := range totp.RecoveryCodes {
+		if utils.CheckPasswordHash(code, hash) {
+			return usedOTP(s.repo.UseRecoveryCode(ctx, userID, hash))
+		}
+	}
+
+	return utils.NewBankSystemError(utils.ErrInvalidOTP)
+}
+
+// usedOTP turns the failure to consume a code another request consumed first
+// into ErrInvalidOTP.
+func usedOTP(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return utils.NewBankSystemError(utils.ErrInvalidOTP)
+	}
+	return err
+}
+
+// VerifyStepUp is called before high-value operations. Users above the
+// threshold must have two-factor authentication enabled and supply a code.
+func (s *UserService) VerifyStepUp(ctx context.Context, userID int64, code string) error {
+	return s.VerifyTOTP(ctx, userID, code)
+}
+
+func (s *UserService) getUserTOTP(ctx context.Context, userID int64) (UserTOTP, error) {
+	totp, err := s.repo.GetUserTOTP(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return UserTOTP{}, utils.NewBankSystemError(utils.ErrTOTPNotEnabled, strconv.FormatInt(userID, 10))
+	}
+	return totp, err
+}
+
+func (s *UserService) decryptSecret(encrypted []byte) (string, error) {
+	if len(s.totp.EncryptionKey) == 0 {
+		return "", utils.NewBankSystemError(utils.ErrTOTPNotConfigured)
+	}
+	secret, err := utils.Decrypt(s.totp.EncryptionKey, encrypted)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
@@ -0,0 +1,295 @@
+package webhook
+
+import (
+	"bank_system/utils"
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookController struct {
+	service *WebhookService
+	logger  *log.Logger
+}
+
+func NewWebhookController(service *WebhookService, logger *log.Logger) *WebhookController {
+	return &WebhookController{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// The handlers serve both the webhooks of a user, under /users/:id, and
+// those of the partners, under /admin, where there is no :id.
+
+// CreateWebhook responds with the webhook and its secret, which is not
+// shown again.
+func (c *WebhookController) CreateWebhook(ctx *gin.Context) {
+	userID, ok := ownerParam(ctx)
+	if !ok {
+		return
+	}
+
+	type CreateWebhookRequest struct {
+		URL        string   `json:"url" binding:"required"`
+		EventTypes []string `json:"event_types"`
+		Partner    string   `json:"partner"`
+	}
+
+	var req CreateWebhookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	webhook, err := c.service.CreateWebhook(reqCtx, userID, req.Partner, req.URL, req.EventTypes)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, struct {
+		Webhook
+		Secret string `json:"secret"`
+	}{webhook, webhook.Secret})
+}
+
+func (c *WebhookController) GetWebhooks(ctx *gin.Context) {
+	userID, ok := ownerParam(ctx)
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	webhooks, err := c.service.GetWebhooks(reqCtx, userID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, webhooks)
+}
+
+func (c *WebhookController) GetWebhook(ctx *gin.Context) {
+	userID, webhookID, ok := webhookParams(ctx)
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	webhook, err := c.service.GetWebhook(reqCtx, userID, webhookID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, webhook)
+}
+
+// UpdateWebhook changes the url, event_types and active fields of the body
+// that are set.
+func (c *WebhookController) UpdateWebhook(ctx *gin.Context) {
+	userID, webhookID, ok := webhookParams(ctx)
+	if !ok {
+		return
+	}
+
+	var req WebhookUpdate
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(utils.BindingError(err)))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	webhook, err := c.service.UpdateWebhook(reqCtx, userID, webhookID, req)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, webhook)
+}
+
+func (c *WebhookController) DeleteWebhook(ctx *gin.Context) {
+	userID, webhookID, ok := webhookParams(ctx)
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	if err := c.service.DeleteWebhook(reqCtx, userID, webhookID); err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// GetDeliveries filters by the status query parameter and pages backwards
+// with before_id and limit.
+func (c *WebhookController) GetDeliveries(ctx *gin.Context) {
+	userID, webhookID, ok := webhookParams(ctx)
+	if !ok {
+		return
+	}
+
+	verr := &utils.ValidationError{}
+	var (
+		beforeID int64
+		limit    int
+		err      error
+	)
+	if value := ctx.Query("before_id"); value != "" {
+		if beforeID, err = strconv.ParseInt(value, 10, 64); err != nil {
+			verr.Add("before_id", "must be a delivery id")
+		}
+	}
+	if value := ctx.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil {
+			verr.Add("limit", "must be a number")
+		}
+	}
+	if err := verr.Err(); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	deliveries, err := c.service.GetDeliveries(reqCtx, userID, webhookID, ctx.Query("status"), beforeID, limit)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, deliveries)
+}
+
+func (c *WebhookController) GetDelivery(ctx *gin.Context) {
+	userID, webhookID, deliveryID, ok := deliveryParams(ctx)
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	delivery, err := c.service.GetDelivery(reqCtx, userID, webhookID, deliveryID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, delivery)
+}
+
+func (c *WebhookController) ReplayDelivery(ctx *gin.Context) {
+	userID, webhookID, deliveryID, ok := deliveryParams(ctx)
+	if !ok {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	reqCtx, cancel := context.WithTimeout(reqCtx, utils.TIMEOUT)
+	defer cancel()
+
+	delivery, err := c.service.ReplayDelivery(reqCtx, userID, webhookID, deliveryID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, delivery)
+}
+
+// ownerParam returns the user of the route, or 0 on the admin routes.
+func ownerParam(ctx *gin.Context) (int64, bool) {
+	if ctx.Param("id") == "" {
+		return 0, true
+	}
+	userID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil || userID == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return 0, false
+	}
+	return userID, true
+}
+
+func webhookParams(ctx *gin.Context) (int64, int64, bool) {
+	userID, ok := ownerParam(ctx)
+	if !ok {
+		return 0, 0, false
+	}
+	webhookID, err := strconv.ParseInt(ctx.Param("webhook_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook id"})
+		return 0, 0, false
+	}
+	return userID, webhookID, true
+}
+
+func deliveryParams(ctx *gin.Context) (int64, int64, int64, bool) {
+	userID, webhookID, ok := webhookParams(ctx)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	deliveryID, err := strconv.ParseInt(ctx.Param("delivery_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery id"})
+		return 0, 0, 0, false
+	}
+	return userID, webhookID, deliveryID, true
+}
+
+func errorStatus(err error) int {
+	switch {
+	case utils.IsValidationError(err):
+		return http.StatusBadRequest
+	case utils.IsBankSystemError(err, utils.ErrUserNotFound),
+		utils.IsBankSystemError(err, utils.ErrWebhookNotFound),
+		utils.IsBankSystemError(err, utils.ErrWebhookDeliveryNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (c *WebhookController) register(group *gin.RouterGroup) {
+	group.POST("", c.CreateWebhook)
+	group.GET("", c.GetWebhooks)
+	group.GET("/:webhook_id", c.GetWebhook)
+	group.PATCH("/:webhook_id", c.UpdateWebhook)
+	group.DELETE("/:webhook_id", c.DeleteWebhook)
+	group.GET("/:webhook_id/deliveries", c.GetDeliveries)
+	group.GET("/:webhook_id/deliveries/:delivery_id", c.GetDelivery)
+	group.POST("/:webhook_id/deliveries/:delivery_id/replay", c.ReplayDelivery)
+}
+
+// RegisterRoutes serves the webhooks of the users only to themselves, behind
+// the owner middleware, and those of the partners behind the admin middleware.
+func (c *WebhookController) RegisterRoutes(router *gin.Engine, owner, admin gin.HandlerFunc) {
+	c.register(router.Group("/users/:id/webhooks", owner))
+	c.register(router.Group("/admin/webhooks", admin))
+}
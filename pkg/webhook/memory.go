@@ -0,0 +1,361 @@
+package webhook
+
+import (
+	"bank_system/pkg/memstore"
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// memoryWebhookRepository is a WebhookRepository backed by a memstore.Store.
+type memoryWebhookRepository struct {
+	store *memstore.Store
+}
+
+func NewMemoryWebhookRepository(store *memstore.Store) WebhookRepository {
+	return &memoryWebhookRepository{store: store}
+}
+
+func (r *memoryWebhookRepository) CreateWebhook(ctx context.Context, webhook Webhook) (Webhook, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	if webhook.UserID.Valid {
+		if _, ok := r.store.Users[webhook.UserID.Int64]; !ok {
+			return Webhook{}, errors.New(`insert on "BK_Webhook" violates a foreign key constraint to "BK_User"`)
+		}
+	}
+	if webhook.UserID.Valid == (webhook.Partner != "") {
+		return Webhook{}, errors.New(`new row for "BK_Webhook" violates check constraint "webhook_has_one_owner"`)
+	}
+
+	now := time.Now()
+	record := &memstore.WebhookRecord{
+		ID:         r.store.NextID("BK_Webhook"),
+		UserID:     webhook.UserID,
+		Partner:    pgtype.Text{String: webhook.Partner, Valid: webhook.Partner != ""},
+		URL:        webhook.URL,
+		EventTypes: slices.Clone(webhook.EventTypes),
+		Secret:     webhook.Secret,
+		Active:     webhook.Active,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	r.store.Webhooks[record.ID] = record
+	r.store.Audit(ctx, "BK_Webhook", record.ID, nil, *record)
+
+	return toWebhook(record), nil
+}
+
+func (r *memoryWebhookRepository) GetWebhook(ctx context.Context, id int64) (Webhook, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.Webhooks[id]
+	if !ok {
+		return Webhook{}, pgx.ErrNoRows
+	}
+	return toWebhook(record), nil
+}
+
+func (r *memoryWebhookRepository) GetUserWebhooks(ctx context.Context, userID int64) ([]Webhook, error) {
+	return r.webhooks(func(record *memstore.WebhookRecord) bool {
+		return record.UserID.Valid && record.UserID.Int64 == userID
+	}), nil
+}
+
+func (r *memoryWebhookRepository) GetPartnerWebhooks(ctx context.Context) ([]Webhook, error) {
+	return r.webhooks(func(record *memstore.WebhookRecord) bool {
+		return record.Partner.Valid
+	}), nil
+}
+
+func (r *memoryWebhookRepository) webhooks(match func(*memstore.WebhookRecord) bool) []Webhook {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	webhooks := []Webhook{}
+	for _, record := range r.store.Webhooks {
+		if match(record) {
+			webhooks = append(webhooks, toWebhook(record))
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks
+}
+
+func (r *memoryWebhookRepository) UpdateWebhook(ctx context.Context, webhook Webhook) (Webhook, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.Webhooks[webhook.ID]
+	if !ok {
+		return Webhook{}, pgx.ErrNoRows
+	}
+
+	before := *record
+	record.URL = webhook.URL
+	record.EventTypes = slices.Clone(webhook.EventTypes)
+	record.Active = webhook.Active
+	record.UpdatedAt = time.Now()
+	r.store.Audit(ctx, "BK_Webhook", record.ID, before, *record)
+	return toWebhook(record), nil
+}
+
+func (r *memoryWebhookRepository) DeleteWebhook(ctx context.Context, id int64) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.Webhooks[id]
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	for deliveryID, delivery := range r.store.WebhookDeliveries {
+		if delivery.WebhookID == id {
+			r.deleteAttempts(deliveryID)
+			delete(r.store.WebhookDeliveries, deliveryID)
+		}
+	}
+	delete(r.store.Webhooks, id)
+	r.store.Audit(ctx, "BK_Webhook", id, *record, nil)
+	return nil
+}
+
+func (r *memoryWebhookRepository) deleteAttempts(deliveryID int64) {
+	for id, attempt := range r.store.WebhookAttempts {
+		if attempt.DeliveryID == deliveryID {
+			delete(r.store.WebhookAttempts, id)
+		}
+	}
+}
+
+func (r *memoryWebhookRepository) EnqueueNotifications(ctx context.Context, notifications []Notification) (int, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	webhooks := make([]*memstore.WebhookRecord, 0, len(r.store.Webhooks))
+	for _, record := range r.store.Webhooks {
+		webhooks = append(webhooks, record)
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+
+	var enqueued int
+	now := time.Now()
+	for _, notification := range notifications {
+		owners := map[int64]bool{}
+		for _, accountID := range notification.AccountIDs {
+			if account, ok := r.store.Accounts[accountID]; ok {
+				owners[account.UserID] = true
+			}
+		}
+
+		for _, webhook := range webhooks {
+			if !webhook.Active ||
+				len(webhook.EventTypes) > 0 && !slices.Contains(webhook.EventTypes, notification.EventType) ||
+				webhook.Partner.Valid && !notification.Partners ||
+				!webhook.Partner.Valid && !owners[webhook.UserID.Int64] ||
+				r.delivered(webhook.ID, notification.EventID) {
+				continue
+			}
+
+			record := &memstore.WebhookDeliveryRecord{
+				ID:            r.store.NextID("BK_Webhook_Delivery"),
+				WebhookID:     webhook.ID,
+				EventID:       notification.EventID,
+				EventType:     notification.EventType,
+				Payload:       slices.Clone(notification.Payload),
+				Status:        StatusPending,
+				NextAttemptAt: now,
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			}
+			r.store.WebhookDeliveries[record.ID] = record
+			enqueued++
+		}
+	}
+	return enqueued, nil
+}
+
+// delivered reports whether the event has a delivery to the webhook.
+func (r *memoryWebhookRepository) delivered(webhookID int64, eventID string) bool {
+	for _, delivery := range r.store.WebhookDeliveries {
+		if delivery.WebhookID == webhookID && delivery.EventID == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryWebhookRepository) GetDeliveries(
+	ctx context.Context, webhookID int64, status string, beforeID int64, limit int,
+) ([]Delivery, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	var records []*memstore.WebhookDeliveryRecord
+	for _, record := range r.store.WebhookDeliveries {
+		if record.WebhookID == webhookID &&
+			(status == "" || record.Status == status) &&
+			(beforeID == 0 || record.ID < beforeID) {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID > records[j].ID })
+	if len(records) > limit {
+		records = records[:limit]
+	}
+
+	deliveries := make([]Delivery, 0, len(records))
+	for _, record := range records {
+		deliveries = append(deliveries, toDelivery(record))
+	}
+	return deliveries, nil
+}
+
+func (r *memoryWebhookRepository) GetDelivery(ctx context.Context, id int64) (Delivery, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.WebhookDeliveries[id]
+	if !ok {
+		return Delivery{}, pgx.ErrNoRows
+	}
+
+	var attempts []*memstore.WebhookAttemptRecord
+	for _, attempt := range r.store.WebhookAttempts {
+		if attempt.DeliveryID == id {
+			attempts = append(attempts, attempt)
+		}
+	}
+	sort.Slice(attempts, func(i, j int) bool { return attempts[i].ID < attempts[j].ID })
+
+	delivery := toDelivery(record)
+	delivery.Log = make([]Attempt, 0, len(attempts))
+	for _, attempt := range attempts {
+		delivery.Log = append(delivery.Log, Attempt{
+			Attempt:     attempt.Attempt,
+			StatusCode:  attempt.StatusCode,
+			Error:       attempt.Error,
+			DurationMS:  attempt.DurationMS,
+			AttemptedAt: attempt.AttemptedAt,
+		})
+	}
+	return delivery, nil
+}
+
+func (r *memoryWebhookRepository) ClaimDueDeliveries(
+	ctx context.Context, now, claimUntil time.Time, limit int,
+) ([]Delivery, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	var due []*memstore.WebhookDeliveryRecord
+	for _, record := range r.store.WebhookDeliveries {
+		webhook := r.store.Webhooks[record.WebhookID]
+		if record.Status == StatusPending && !record.NextAttemptAt.After(now) &&
+			(!record.ClaimedUntil.Valid || record.ClaimedUntil.Time.Before(now)) &&
+			webhook != nil && webhook.Active {
+			due = append(due, record)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	deliveries := make([]Delivery, 0, len(due))
+	for _, record := range due {
+		record.ClaimedUntil = pgtype.Timestamptz{Time: claimUntil, Valid: true}
+		record.UpdatedAt = time.Now()
+		deliveries = append(deliveries, toDelivery(record))
+	}
+	return deliveries, nil
+}
+
+func (r *memoryWebhookRepository) RecordAttempt(ctx context.Context, delivery Delivery, attempt Attempt) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.WebhookDeliveries[delivery.ID]
+	if !ok {
+		return pgx.ErrNoRows
+	}
+
+	id := r.store.NextID("BK_Webhook_Attempt")
+	r.store.WebhookAttempts[id] = &memstore.WebhookAttemptRecord{
+		ID:          id,
+		DeliveryID:  delivery.ID,
+		Attempt:     attempt.Attempt,
+		StatusCode:  attempt.StatusCode,
+		Error:       attempt.Error,
+		DurationMS:  attempt.DurationMS,
+		AttemptedAt: attempt.AttemptedAt,
+	}
+
+	record.Status = delivery.Status
+	record.Attempts = delivery.Attempts
+	record.NextAttemptAt = delivery.NextAttemptAt
+	record.DeliveredAt = delivery.DeliveredAt
+	record.ClaimedUntil = pgtype.Timestamptz{}
+	record.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *memoryWebhookRepository) ReplayDelivery(ctx context.Context, id int64) (Delivery, error) {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	record, ok := r.store.WebhookDeliveries[id]
+	if !ok {
+		return Delivery{}, pgx.ErrNoRows
+	}
+
+	now := time.Now()
+	record.Status = StatusPending
+	record.Attempts = 0
+	record.NextAttemptAt = now
+	record.DeliveredAt = pgtype.Timestamptz{}
+	record.ClaimedUntil = pgtype.Timestamptz{}
+	record.UpdatedAt = now
+	return toDelivery(record), nil
+}
+
+func toWebhook(record *memstore.WebhookRecord) Webhook {
+	return Webhook{
+		ID:         record.ID,
+		UserID:     record.UserID,
+		Partner:    record.Partner.String,
+		URL:        record.URL,
+		EventTypes: slices.Clone(record.EventTypes),
+		Secret:     record.Secret,
+		Active:     record.Active,
+		CreatedAt:  record.CreatedAt,
+		UpdatedAt:  record.UpdatedAt,
+	}
+}
+
+func toDelivery(record *memstore.WebhookDeliveryRecord) Delivery {
+	return Delivery{
+		ID:            record.ID,
+		WebhookID:     record.WebhookID,
+		EventID:       record.EventID,
+		EventType:     record.EventType,
+		Payload:       slices.Clone(record.Payload),
+		Status:        record.Status,
+		Attempts:      record.Attempts,
+		NextAttemptAt: record.NextAttemptAt,
+		DeliveredAt:   record.DeliveredAt,
+		CreatedAt:     record.CreatedAt,
+		UpdatedAt:     record.UpdatedAt,
+	}
+}
@@ -0,0 +1,393 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	webhookColumns  = `id, user_id, partner, url, event_types, secret, active, created_at, updated_at`
+	deliveryColumns = `id, webhook_id, event_id::TEXT, event_type, payload, status, attempts, next_attempt_at,
+		delivered_at, created_at, updated_at`
+	attemptColumns = `attempt, status_code, error, duration_ms, attempted_at`
+)
+
+// Webhook posts events to URL. It belongs to UserID, and receives the events
+// of the user's accounts, or to Partner, and receives the events of every
+// account. An empty EventTypes receives every type.
+type Webhook struct {
+	ID         int64       `json:"id"`
+	UserID     pgtype.Int8 `json:"user_id"`
+	Partner    string      `json:"partner,omitempty"`
+	URL        string      `json:"url"`
+	EventTypes []string    `json:"event_types"`
+	Secret     string      `json:"-"`
+	Active     bool        `json:"active"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// Delivery is an event posted, or to post, to a webhook. Payload is the
+// outbox.Event as it is posted. Log lists the attempts, oldest first, and
+// is only set by GetDelivery.
+type Delivery struct {
+	ID            int64              `json:"id"`
+	WebhookID     int64              `json:"webhook_id"`
+	EventID       string             `json:"event_id"`
+	EventType     string             `json:"event_type"`
+	Payload       json.RawMessage    `json:"payload"`
+	Status        string             `json:"status"`
+	Attempts      int                `json:"attempts"`
+	NextAttemptAt time.Time          `json:"next_attempt_at"`
+	DeliveredAt   pgtype.Timestamptz `json:"delivered_at"`
+	CreatedAt     time.Time          `json:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+	Log           []Attempt          `json:"log,omitempty"`
+}
+
+// Attempt is an attempt to post a delivery. StatusCode is 0 when no
+// response came back.
+type Attempt struct {
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"status_code"`
+	Error       string    `json:"error,omitempty"`
+	DurationMS  int       `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// Notification is an event to deliver to the webhooks that subscribe to its
+// type: those of the owners of AccountIDs, and those of partners when
+// Partners is set. A webhook gets an event once, from the first notification
+// that reaches it.
+type Notification struct {
+	EventID    string
+	EventType  string
+	AccountIDs []int64
+	Partners   bool
+	Payload    []byte
+}
+
+type WebhookRepository interface {
+	CreateWebhook(ctx context.Context, webhook Webhook) (Webhook, error)
+	GetWebhook(ctx context.Context, id int64) (Webhook, error)
+	GetUserWebhooks(ctx context.Context, userID int64) ([]Webhook, error)
+	GetPartnerWebhooks(ctx context.Context) ([]Webhook, error)
+	// UpdateWebhook stores the URL, event types and active flag of webhook.
+	UpdateWebhook(ctx context.Context, webhook Webhook) (Webhook, error)
+	DeleteWebhook(ctx context.Context, id int64) error
+	// EnqueueNotifications creates a pending delivery of every notification
+	// to every active webhook that receives it, once per webhook and event,
+	// and returns how many it created.
+	EnqueueNotifications(ctx context.Context, notifications []Notification) (int, error)
+	// GetDeliveries returns the deliveries of the webhook with the status,
+	// any when empty, newest first, from before beforeID when it is not 0.
+	GetDeliveries(ctx context.Context, webhookID int64, status string, beforeID int64, limit int) ([]Delivery, error)
+	GetDelivery(ctx context.Context, id int64) (Delivery, error)
+	// ClaimDueDeliveries returns up to limit pending deliveries of active
+	// webhooks whose next attempt is due and claims them until claimUntil
+	// so that other instances skip them.
+	ClaimDueDeliveries(ctx context.Context, now, claimUntil time.Time, limit int) ([]Delivery, error)
+	// RecordAttempt logs attempt, stores the status, attempts, next attempt
+	// and delivery time of delivery and releases the claim.
+	RecordAttempt(ctx context.Context, delivery Delivery, attempt Attempt) error
+	// ReplayDelivery makes the delivery pending again, due now, with no
+	// attempts.
+	ReplayDelivery(ctx context.Context, id int64) (Delivery, error)
+}
+
+type webhookRepositoryImpl struct {
+	pool *pgxpool.Pool
+}
+
+func NewWebhookRepository(pool *pgxpool.Pool) WebhookRepository {
+	return &webhookRepositoryImpl{pool: pool}
+}
+
+func (r *webhookRepositoryImpl) CreateWebhook(ctx context.Context, webhook Webhook) (Webhook, error) {
+	return scanWebhook(r.pool.QueryRow(ctx,
+		`INSERT INTO "BK_Webhook" (user_id, partner, url, event_types, secret, active)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6)
+		RETURNING `+webhookColumns,
+		webhook.UserID, webhook.Partner, webhook.URL, webhook.EventTypes, webhook.Secret, webhook.Active,
+	))
+}
+
+func (r *webhookRepositoryImpl) GetWebhook(ctx context.Context, id int64) (Webhook, error) {
+	return scanWebhook(r.pool.QueryRow(ctx, `SELECT `+webhookColumns+` FROM "BK_Webhook" WHERE id = $1`, id))
+}
+
+func (r *webhookRepositoryImpl) GetUserWebhooks(ctx context.Context, userID int64) ([]Webhook, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+webhookColumns+` FROM "BK_Webhook" WHERE user_id = $1 ORDER BY id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return collectWebhooks(rows)
+}
+
+func (r *webhookRepositoryImpl) GetPartnerWebhooks(ctx context.Context) ([]Webhook, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+webhookColumns+` FROM "BK_Webhook" WHERE partner IS NOT NULL ORDER BY id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return collectWebhooks(rows)
+}
+
+func (r *webhookRepositoryImpl) UpdateWebhook(ctx context.Context, webhook Webhook) (Webhook, error) {
+	return scanWebhook(r.pool.QueryRow(ctx,
+		`UPDATE "BK_Webhook" SET url = $2, event_types = $3, active = $4
+		WHERE id = $1
+		RETURNING `+webhookColumns,
+		webhook.ID, webhook.URL, webhook.EventTypes, webhook.Active,
+	))
+}
+
+func (r *webhookRepositoryImpl) DeleteWebhook(ctx context.Context, id int64) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM "BK_Webhook" WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (r *webhookRepositoryImpl) EnqueueNotifications(ctx context.Context, notifications []Notification) (int, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	for _, notification := range notifications {
+		batch.Queue(
+			`INSERT INTO "BK_Webhook_Delivery" (webhook_id, event_id, event_type, payload)
+			SELECT w.id, $1::UUID, $2::TEXT, $3::JSONB FROM "BK_Webhook" w
+			WHERE w.active
+				AND (cardinality(w.event_types) = 0 OR $2 = ANY(w.event_types))
+				AND (w.partner IS NOT NULL AND $5
+					OR w.user_id IN (SELECT user_id FROM "BK_Account" WHERE id = ANY($4)))
+			ON CONFLICT (webhook_id, event_id) DO NOTHING`,
+			notification.EventID, notification.EventType, notification.Payload, notification.AccountIDs,
+			notification.Partners,
+		)
+	}
+	results := tx.SendBatch(ctx, batch)
+	var enqueued int
+	for range notifications {
+		tag, err := results.Exec()
+		if err != nil {
+			results.Close()
+			return 0, err
+		}
+		enqueued += int(tag.RowsAffected())
+	}
+	if err := results.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return enqueued, nil
+}
+
+func (r *webhookRepositoryImpl) GetDeliveries(
+	ctx context.Context, webhookID int64, status string, beforeID int64, limit int,
+) ([]Delivery, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+deliveryColumns+` FROM "BK_Webhook_Delivery"
+		WHERE webhook_id = $1
+			AND ($2 = '' OR status::TEXT = $2)
+			AND ($3 = 0 OR id < $3)
+		ORDER BY id DESC
+		LIMIT $4`,
+		webhookID, status, beforeID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return collectDeliveries(rows)
+}
+
+func (r *webhookRepositoryImpl) GetDelivery(ctx context.Context, id int64) (Delivery, error) {
+	delivery, err := scanDelivery(r.pool.QueryRow(ctx,
+		`SELECT `+deliveryColumns+` FROM "BK_Webhook_Delivery" WHERE id = $1`,
+		id,
+	))
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+attemptColumns+` FROM "BK_Webhook_Attempt" WHERE delivery_id = $1 ORDER BY id`,
+		id,
+	)
+	if err != nil {
+		return Delivery{}, err
+	}
+	delivery.Log, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (Attempt, error) {
+		var attempt Attempt
+		err := row.Scan(
+			&attempt.Attempt,
+			&attempt.StatusCode,
+			&attempt.Error,
+			&attempt.DurationMS,
+			&attempt.AttemptedAt,
+		)
+		return attempt, err
+	})
+	return delivery, err
+}
+
+func (r *webhookRepositoryImpl) ClaimDueDeliveries(
+	ctx context.Context, now, claimUntil time.Time, limit int,
+) ([]Delivery, error) {
+	rows, err := r.pool.Query(ctx,
+		`WITH claimed AS (
+			UPDATE "BK_Webhook_Delivery"
+			SET claimed_until = $2
+			WHERE id IN (
+				SELECT d.id FROM "BK_Webhook_Delivery" d
+				JOIN "BK_Webhook" w ON w.id = d.webhook_id
+				WHERE d.status = 'PENDING'
+					AND d.next_attempt_at <= $1
+					AND (d.claimed_until IS NULL OR d.claimed_until < $1)
+					AND w.active
+				ORDER BY d.next_attempt_at
+				LIMIT $3
+				FOR UPDATE OF d SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT `+deliveryColumns+` FROM claimed
+		ORDER BY next_attempt_at, id`,
+		now, claimUntil, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return collectDeliveries(rows)
+}
+
+func (r *webhookRepositoryImpl) RecordAttempt(ctx context.Context, delivery Delivery, attempt Attempt) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO "BK_Webhook_Attempt" (delivery_id, attempt, status_code, error, duration_ms, attempted_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		delivery.ID, attempt.Attempt, attempt.StatusCode, attempt.Error, attempt.DurationMS, attempt.AttemptedAt,
+	); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE "BK_Webhook_Delivery"
+		SET status = $2, attempts = $3, next_attempt_at = $4, delivered_at = $5, claimed_until = NULL
+		WHERE id = $1`,
+		delivery.ID, delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.DeliveredAt,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *webhookRepositoryImpl) ReplayDelivery(ctx context.Context, id int64) (Delivery, error) {
+	return scanDelivery(r.pool.QueryRow(ctx,
+		`UPDATE "BK_Webhook_Delivery"
+		SET status = 'PENDING', attempts = 0, next_attempt_at = NOW(), delivered_at = NULL, claimed_until = NULL
+		WHERE id = $1
+		RETURNING `+deliveryColumns,
+		id,
+	))
+}
+
+func collectWebhooks(rows pgx.Rows) ([]Webhook, error) {
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func scanWebhook(row pgx.Row) (Webhook, error) {
+	var (
+		webhook Webhook
+		partner pgtype.Text
+	)
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.UserID,
+		&partner,
+		&webhook.URL,
+		&webhook.EventTypes,
+		&webhook.Secret,
+		&webhook.Active,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	webhook.Partner = partner.String
+	return webhook, err
+}
+
+func collectDeliveries(rows pgx.Rows) ([]Delivery, error) {
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanDelivery(row pgx.Row) (Delivery, error) {
+	var (
+		delivery Delivery
+		payload  []byte
+	)
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.EventID,
+		&delivery.EventType,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.DeliveredAt,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+	)
+	delivery.Payload = payload
+	return delivery, err
+}
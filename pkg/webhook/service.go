@@ -0,0 +1,470 @@
+package webhook
+
+import (
+	"bank_system/pkg/outbox"
+	"bank_system/postgres/sqlc"
+	"bank_system/utils"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	StatusPending   = "PENDING"
+	StatusDelivered = "DELIVERED"
+	StatusDead      = "DEAD"
+
+	URL_MAX_LENGTH     = 2048
+	PARTNER_MAX_LENGTH = 64 // "BK_Webhook".partner VARCHAR(64)
+
+	DefaultLimit = 100
+	MaxLimit     = 1000
+
+	// ClaimTTL is how long an instance has to deliver a claimed batch.
+	ClaimTTL = 5 * time.Minute
+	// concurrency is how many deliveries of a batch are posted at once.
+	concurrency = 8
+)
+
+// EventTypes are the event types webhooks can subscribe to.
+var EventTypes = []string{
+	outbox.EventDepositCompleted,
+	outbox.EventWithdrawalCompleted,
+	outbox.EventTransferCompleted,
+	outbox.EventFeeCharged,
+	outbox.EventInterestCharged,
+	outbox.EventStatusChanged,
+}
+
+// Users is what webhooks need of user.UserService.
+type Users interface {
+	GetUserByID(ctx context.Context, id int64) (*sqlc.GetUserByIDRow, error)
+}
+
+// Config sets how deliveries are posted. The delay before retry n is
+// Backoff * 2^(n-1), at most MaxBackoff; a delivery that failed MaxAttempts
+// times is DEAD. AllowInsecure accepts http URLs and AllowPrivate URLs of
+// hosts on loopback, private and link-local addresses, for local receivers.
+type Config struct {
+	MaxAttempts   int
+	Backoff       time.Duration
+	MaxBackoff    time.Duration
+	Timeout       time.Duration
+	BatchSize     int
+	AllowInsecure bool
+	AllowPrivate  bool
+}
+
+type WebhookService struct {
+	repo   WebhookRepository
+	users  Users
+	config Config
+	client *http.Client
+}
+
+// NewWebhookService creates the service. Zero values of config fall back to
+// 10 attempts, a 30 second backoff up to 6 hours, a 10 second timeout and
+// batches of 50.
+func NewWebhookService(repo WebhookRepository, users Users, config Config) *WebhookService {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 10
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = 30 * time.Second
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 6 * time.Hour
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 50
+	}
+
+	return &WebhookService{
+		repo:   repo,
+		users:  users,
+		config: config,
+		client: &http.Client{
+			Transport: newTransport(config.AllowPrivate),
+			Timeout:   config.Timeout,
+			// A redirect is a failed delivery, the receiver fixes its URL.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// WebhookUpdate holds the fields UpdateWebhook changes, those that are set.
+type WebhookUpdate struct {
+	URL        *string   `json:"url"`
+	EventTypes *[]string `json:"event_types"`
+	Active     *bool     `json:"active"`
+}
+
+// The methods that manage webhooks take the user they belong to; a userID
+// of 0 stands for the partners, whose webhooks the admin manages.
+
+// CreateWebhook creates an active webhook with a new secret, the only time
+// the secret is returned. partner names the owner of a partner webhook.
+func (s *WebhookService) CreateWebhook(
+	ctx context.Context, userID int64, partner, rawURL string, eventTypes []string,
+) (Webhook, error) {
+	webhook := Webhook{URL: strings.TrimSpace(rawURL), EventTypes: eventTypes, Active: true}
+	verr := &utils.ValidationError{}
+	if userID != 0 {
+		if err := s.checkUser(ctx, userID); err != nil {
+			return Webhook{}, err
+		}
+		webhook.UserID = pgtype.Int8{Int64: userID, Valid: true}
+	} else {
+		webhook.Partner = strings.TrimSpace(partner)
+		if webhook.Partner == "" || len(webhook.Partner) > PARTNER_MAX_LENGTH {
+			verr.Add("partner", fmt.Sprintf("must be between 1 and %d characters", PARTNER_MAX_LENGTH))
+		}
+	}
+	s.validate(ctx, verr, &webhook)
+	if err := verr.Err(); err != nil {
+		return Webhook{}, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Webhook{}, err
+	}
+	webhook.Secret = "whsec_" + hex.EncodeToString(secret)
+
+	return s.repo.CreateWebhook(ctx, webhook)
+}
+
+func (s *WebhookService) GetWebhooks(ctx context.Context, userID int64) ([]Webhook, error) {
+	if userID == 0 {
+		return s.repo.GetPartnerWebhooks(ctx)
+	}
+	if err := s.checkUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetUserWebhooks(ctx, userID)
+}
+
+func (s *WebhookService) GetWebhook(ctx context.Context, userID, webhookID int64) (Webhook, error) {
+	return s.getWebhook(ctx, userID, webhookID)
+}
+
+func (s *WebhookService) UpdateWebhook(
+	ctx context.Context, userID, webhookID int64, update WebhookUpdate,
+) (Webhook, error) {
+	webhook, err := s.getWebhook(ctx, userID, webhookID)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	if update.URL != nil {
+		webhook.URL = strings.TrimSpace(*update.URL)
+	}
+	if update.EventTypes != nil {
+		webhook.EventTypes = *update.EventTypes
+	}
+	if update.Active != nil {
+		webhook.Active = *update.Active
+	}
+	verr := &utils.ValidationError{}
+	s.validate(ctx, verr, &webhook)
+	if err := verr.Err(); err != nil {
+		return Webhook{}, err
+	}
+
+	return s.repo.UpdateWebhook(ctx, webhook)
+}
+
+// DeleteWebhook deletes the webhook and its deliveries.
+func (s *WebhookService) DeleteWebhook(ctx context.Context, userID, webhookID int64) error {
+	if _, err := s.getWebhook(ctx, userID, webhookID); err != nil {
+		return err
+	}
+	return s.repo.DeleteWebhook(ctx, webhookID)
+}
+
+// GetDeliveries returns the deliveries of the webhook with the status, any
+// when empty, newest first, DefaultLimit of them when limit is 0.
+func (s *WebhookService) GetDeliveries(
+	ctx context.Context, userID, webhookID int64, status string, beforeID int64, limit int,
+) ([]Delivery, error) {
+	if _, err := s.getWebhook(ctx, userID, webhookID); err != nil {
+		return nil, err
+	}
+
+	verr := &utils.ValidationError{}
+	switch status {
+	case "", StatusPending, StatusDelivered, StatusDead:
+	default:
+		verr.Add("status", "must be one of PENDING, DELIVERED, DEAD")
+	}
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+	if limit < 0 || limit > MaxLimit {
+		verr.Add("limit", fmt.Sprintf("must be between 1 and %d", MaxLimit))
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetDeliveries(ctx, webhookID, status, beforeID, limit)
+}
+
+// GetDelivery returns the delivery with the log of its attempts.
+func (s *WebhookService) GetDelivery(ctx context.Context, userID, webhookID, deliveryID int64) (Delivery, error) {
+	if _, err := s.getWebhook(ctx, userID, webhookID); err != nil {
+		return Delivery{}, err
+	}
+	return s.getDelivery(ctx, webhookID, deliveryID)
+}
+
+// ReplayDelivery posts the delivery again, whatever its status, with all its
+// attempts: a DEAD delivery once the receiver is fixed, or a DELIVERED one
+// that the receiver lost.
+func (s *WebhookService) ReplayDelivery(ctx context.Context, userID, webhookID, deliveryID int64) (Delivery, error) {
+	if _, err := s.getWebhook(ctx, userID, webhookID); err != nil {
+		return Delivery{}, err
+	}
+	if _, err := s.getDelivery(ctx, webhookID, deliveryID); err != nil {
+		return Delivery{}, err
+	}
+	return s.repo.ReplayDelivery(ctx, deliveryID)
+}
+
+// Publish queues a delivery of the events to the webhooks that receive them,
+// which makes the service an outbox.Publisher. Events published again are
+// only queued once. Partners and the owner of the account receive the event
+// as it is; the owner of the recipient account of a transfer receives it with
+// outbox.ReceivedData, under the recipient account's id.
+func (s *WebhookService) Publish(ctx context.Context, events []outbox.Event) error {
+	notifications := make([]Notification, 0, len(events))
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		notifications = append(notifications, Notification{
+			EventID:    event.ID,
+			EventType:  event.Type,
+			AccountIDs: []int64{event.AccountID},
+			Partners:   true,
+			Payload:    payload,
+		})
+
+		var data outbox.TransactionData
+		if err := json.Unmarshal(event.Data, &data); err != nil || data.ToAccountID == nil {
+			continue
+		}
+		received := event
+		received.AccountID = *data.ToAccountID
+		if received.Data, err = json.Marshal(data.Received()); err != nil {
+			return err
+		}
+		if payload, err = json.Marshal(received); err != nil {
+			return err
+		}
+		notifications = append(notifications, Notification{
+			EventID:    event.ID,
+			EventType:  event.Type,
+			AccountIDs: []int64{received.AccountID},
+			Payload:    payload,
+		})
+	}
+
+	_, err := s.repo.EnqueueNotifications(ctx, notifications)
+	return err
+}
+
+// DeliverDue posts the deliveries that are due, a batch at a time, and
+// returns how many were delivered.
+func (s *WebhookService) DeliverDue(ctx context.Context, now time.Time) (int, error) {
+	deliveries, err := s.repo.ClaimDueDeliveries(ctx, now, now.Add(ClaimTTL), s.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	webhooks := map[int64]Webhook{}
+	for _, delivery := range deliveries {
+		if _, ok := webhooks[delivery.WebhookID]; ok {
+			continue
+		}
+		webhook, err := s.repo.GetWebhook(ctx, delivery.WebhookID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return 0, err
+		}
+		webhooks[delivery.WebhookID] = webhook
+	}
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		delivered int
+		errs      []error
+		sem       = make(chan struct{}, concurrency)
+	)
+	for _, delivery := range deliveries {
+		webhook := webhooks[delivery.WebhookID]
+		if webhook.ID == 0 {
+			// Deleted since it was claimed, with its deliveries.
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			ok, err := s.deliver(ctx, webhook, delivery)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("webhook delivery %d: %w", delivery.ID, err))
+			}
+			if ok {
+				delivered++
+			}
+		}()
+	}
+	wg.Wait()
+
+	return delivered, errors.Join(errs...)
+}
+
+// deliver posts a delivery once and records the attempt. It reports
+// whether the receiver accepted it; err is only set when the attempt could
+// not be recorded.
+func (s *WebhookService) deliver(ctx context.Context, webhook Webhook, delivery Delivery) (bool, error) {
+	start := time.Now()
+	attempt := Attempt{Attempt: delivery.Attempts + 1, AttemptedAt: start}
+	attempt.StatusCode, attempt.Error = s.post(ctx, webhook, delivery, start)
+	attempt.DurationMS = int(time.Since(start).Milliseconds())
+
+	delivery.Attempts = attempt.Attempt
+	accepted := attempt.Error == ""
+	switch {
+	case accepted:
+		delivery.Status = StatusDelivered
+		delivery.DeliveredAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	case delivery.Attempts >= s.config.MaxAttempts:
+		delivery.Status = StatusDead
+	default:
+		delivery.NextAttemptAt = time.Now().Add(s.backoff(delivery.Attempts))
+	}
+
+	return accepted, s.repo.RecordAttempt(ctx, delivery, attempt)
+}
+
+// post sends the delivery and returns the response status and why it
+// failed, empty on a 2xx response.
+func (s *WebhookService) post(ctx context.Context, webhook Webhook, delivery Delivery, now time.Time) (int, string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "bank-system-webhooks/1")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, "unexpected status " + resp.Status
+	}
+	return resp.StatusCode, ""
+}
+
+// backoff is the delay after the failed attempt n.
+func (s *WebhookService) backoff(n int) time.Duration {
+	delay := s.config.Backoff
+	for i := 1; i < n && delay < s.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, s.config.MaxBackoff)
+}
+
+// validate checks the webhook and resolves the host of its URL, which must
+// be public unless AllowPrivate is set; deliveries check the address again
+// when they connect.
+func (s *WebhookService) validate(ctx context.Context, verr *utils.ValidationError, webhook *Webhook) {
+	parsed, err := url.Parse(webhook.URL)
+	switch {
+	case err != nil || parsed.Hostname() == "" || len(webhook.URL) > URL_MAX_LENGTH:
+		verr.Add("url", fmt.Sprintf("must be an absolute URL of at most %d characters", URL_MAX_LENGTH))
+	case parsed.Scheme == "http" && !s.config.AllowInsecure:
+		verr.Add("url", "must use https")
+	case parsed.Scheme != "https" && parsed.Scheme != "http":
+		verr.Add("url", "must use https")
+	case !s.config.AllowPrivate:
+		if err := checkHost(ctx, parsed.Hostname()); err != nil {
+			verr.Add("url", err.Error())
+		}
+	}
+
+	if webhook.EventTypes == nil {
+		webhook.EventTypes = []string{}
+	}
+	for i, eventType := range webhook.EventTypes {
+		if !slices.Contains(EventTypes, eventType) {
+			verr.Add(fmt.Sprintf("event_types[%d]", i), "must be one of "+strings.Join(EventTypes, ", "))
+		}
+	}
+}
+
+func (s *WebhookService) checkUser(ctx context.Context, userID int64) error {
+	_, err := s.users.GetUserByID(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return utils.NewBankSystemError(utils.ErrUserNotFound, strconv.FormatInt(userID, 10))
+	}
+	return err
+}
+
+// getWebhook returns the webhook if it belongs to the user, or to a partner
+// when userID is 0.
+func (s *WebhookService) getWebhook(ctx context.Context, userID, webhookID int64) (Webhook, error) {
+	webhook, err := s.repo.GetWebhook(ctx, webhookID)
+	owned := userID == 0 && !webhook.UserID.Valid || userID != 0 && webhook.UserID.Int64 == userID
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && !owned {
+		return Webhook{}, utils.NewBankSystemError(utils.ErrWebhookNotFound, strconv.FormatInt(webhookID, 10))
+	}
+	return webhook, err
+}
+
+func (s *WebhookService) getDelivery(ctx context.Context, webhookID, deliveryID int64) (Delivery, error) {
+	delivery, err := s.repo.GetDelivery(ctx, deliveryID)
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && delivery.WebhookID != webhookID {
+		return Delivery{}, utils.NewBankSystemError(utils.ErrWebhookDeliveryNotFound, strconv.FormatInt(deliveryID, 10))
+	}
+	return delivery, err
+}
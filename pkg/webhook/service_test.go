@@ -0,0 +1,248 @@
+package webhook_test
+
+import (
+	"bank_system/pkg/account"
+	"bank_system/pkg/memstore"
+	"bank_system/pkg/outbox"
+	"bank_system/pkg/user"
+	"bank_system/pkg/webhook"
+	"bank_system/utils"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// receiver is a local webhook receiver that keeps the verified events it
+// was posted by path.
+type receiver struct {
+	*httptest.Server
+	mu     sync.Mutex
+	secret map[string]string
+	events map[string][]outbox.Event
+}
+
+func newReceiver(t *testing.T) *receiver {
+	r := &receiver{secret: map[string]string{}, events: map[string][]outbox.Event{}}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		err := webhook.VerifySignature(r.secret[req.URL.Path], req.Header.Get(webhook.HeaderTimestamp),
+			req.Header.Get(webhook.HeaderSignature), body, time.Minute, time.Now())
+		if err != nil {
+			t.Errorf("%s: %v", req.URL.Path, err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event outbox.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("%s: %v", req.URL.Path, err)
+		}
+		r.events[req.URL.Path] = append(r.events[req.URL.Path], event)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// register stores a webhook posting to path on the receiver, bypassing the
+// checks of CreateWebhook.
+func (r *receiver) register(t *testing.T, repo webhook.WebhookRepository, path string, userID int64) webhook.Webhook {
+	hook := webhook.Webhook{URL: r.URL + path, EventTypes: []string{}, Secret: "whsec_" + path, Active: true}
+	if userID != 0 {
+		hook.UserID = pgtype.Int8{Int64: userID, Valid: true}
+	} else {
+		hook.Partner = "partner"
+	}
+	hook, err := repo.CreateWebhook(context.Background(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.mu.Lock()
+	r.secret[path] = hook.Secret
+	r.mu.Unlock()
+	return hook
+}
+
+func (r *receiver) received(path string) []outbox.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.events[path]
+}
+
+type fixture struct {
+	store    *memstore.Store
+	repo     webhook.WebhookRepository
+	from, to int64
+	fromUser int64
+	toUser   int64
+}
+
+func newFixture(t *testing.T) fixture {
+	ctx := context.Background()
+	store := memstore.New()
+	users := user.NewMemoryUserRepository(store)
+	accounts := account.NewMemoryAccountRepository(store)
+
+	f := fixture{store: store, repo: webhook.NewMemoryWebhookRepository(store)}
+	for _, side := range []struct {
+		name    string
+		user    *int64
+		account *int64
+	}{{"sender", &f.fromUser, &f.from}, {"recipient", &f.toUser, &f.to}} {
+		created, err := users.CreateUser(ctx, side.name, side.name+"@example.com", "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		opened, err := accounts.CreateAccount(ctx, created.ID, "USD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		*side.user, *side.account = created.ID, opened.ID
+	}
+	return f
+}
+
+func (f fixture) transfer(t *testing.T) outbox.Event {
+	toNumber, toCurrency, credited := "09876543210987654321", "USD", 40.0
+	data, err := json.Marshal(outbox.TransactionData{
+		TransactionID:   7,
+		TxType:          "TRANSFER",
+		AccountID:       f.from,
+		AccountNumber:   "12345678901234567890",
+		CurrencyCode:    "USD",
+		Amount:          40,
+		BalanceAfter:    960,
+		Detail:          "rent",
+		ToAccountID:     &f.to,
+		ToAccountNumber: &toNumber,
+		ToCurrencyCode:  &toCurrency,
+		CreditedAmount:  &credited,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return outbox.Event{
+		ID:         "5f0b6c1e-2a8e-4a43-9d55-0b1d1c0e7a11",
+		Type:       outbox.EventTransferCompleted,
+		Version:    outbox.SchemaVersion,
+		AccountID:  f.from,
+		Data:       data,
+		OccurredAt: time.Now(),
+	}
+}
+
+func TestDeliverToLocalReceiver(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	r := newReceiver(t)
+	r.register(t, f.repo, "/sender", f.fromUser)
+	r.register(t, f.repo, "/recipient", f.toUser)
+	r.register(t, f.repo, "/partner", 0)
+
+	service := webhook.NewWebhookService(f.repo, nil, webhook.Config{AllowInsecure: true, AllowPrivate: true})
+	if err := service.Publish(ctx, []outbox.Event{f.transfer(t)}); err != nil {
+		t.Fatal(err)
+	}
+	delivered, err := service.DeliverDue(ctx, time.Now())
+	if err != nil || delivered != 3 {
+		t.Fatalf("DeliverDue = %d, %v, want 3 deliveries", delivered, err)
+	}
+
+	for _, path := range []string{"/sender", "/partner"} {
+		events := r.received(path)
+		if len(events) != 1 || events[0].AccountID != f.from {
+			t.Fatalf("%s received %+v, want the transfer from account %d", path, events, f.from)
+		}
+		var data outbox.TransactionData
+		if err := json.Unmarshal(events[0].Data, &data); err != nil {
+			t.Fatal(err)
+		}
+		if data.BalanceAfter != 960 || data.Detail != "rent" {
+			t.Errorf("%s received %s, want the whole event", path, events[0].Data)
+		}
+	}
+
+	events := r.received("/recipient")
+	if len(events) != 1 || events[0].AccountID != f.to {
+		t.Fatalf("/recipient received %+v, want the transfer to account %d", events, f.to)
+	}
+	var data map[string]any
+	if err := json.Unmarshal(events[0].Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"account_id", "account_number", "balance_after", "detail"} {
+		if _, ok := data[field]; ok {
+			t.Errorf("/recipient received the sender's %s: %s", field, events[0].Data)
+		}
+	}
+	if data["credited_amount"] != 40.0 || data["to_account_number"] != "09876543210987654321" {
+		t.Errorf("/recipient received %s, want what was credited", events[0].Data)
+	}
+}
+
+func TestDeliverRefusesPrivateAddress(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	r := newReceiver(t)
+	hook := r.register(t, f.repo, "/sender", f.fromUser)
+
+	// The receiver listens on loopback, like a service of the bank's network.
+	service := webhook.NewWebhookService(f.repo, nil, webhook.Config{MaxAttempts: 1, AllowInsecure: true})
+	if err := service.Publish(ctx, []outbox.Event{f.transfer(t)}); err != nil {
+		t.Fatal(err)
+	}
+	if delivered, err := service.DeliverDue(ctx, time.Now()); err != nil || delivered != 0 {
+		t.Fatalf("DeliverDue = %d, %v, want no delivery", delivered, err)
+	}
+	if events := r.received("/sender"); len(events) != 0 {
+		t.Fatalf("receiver got %+v", events)
+	}
+
+	deliveries, err := f.repo.GetDeliveries(ctx, hook.ID, webhook.StatusDead, 0, 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("dead deliveries %+v, %v, want the transfer", deliveries, err)
+	}
+	delivery, err := f.repo.GetDelivery(ctx, deliveries[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delivery.Log) != 1 || !strings.Contains(delivery.Log[0].Error, "not a public address") {
+		t.Errorf("delivery log %+v, want the address refused", delivery.Log)
+	}
+}
+
+func TestCreateWebhookRejectsPrivateHosts(t *testing.T) {
+	ctx := context.Background()
+	service := webhook.NewWebhookService(webhook.NewMemoryWebhookRepository(memstore.New()), nil, webhook.Config{})
+
+	for _, url := range []string{
+		"https://127.0.0.1/hook",
+		"https://localhost:8443/hook",
+		"https://10.0.0.8/hook",
+		"https://172.16.5.4/hook",
+		"https://192.168.1.1/hook",
+		"https://169.254.169.254/latest/meta-data",
+		"https://[::1]/hook",
+		"https://[fd00::1]/hook",
+		"https://[::ffff:10.0.0.1]/hook",
+		"https://0.0.0.0/hook",
+	} {
+		_, err := service.CreateWebhook(ctx, 0, "partner", url, nil)
+		if !utils.IsValidationError(err) {
+			t.Errorf("CreateWebhook(%s) = %v, want a validation error", url, err)
+		}
+	}
+
+	if _, err := service.CreateWebhook(ctx, 0, "partner", "https://93.184.215.14/hook", nil); err != nil {
+		t.Errorf("CreateWebhook of a public address: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+-- Queries of the generated package postgres/sqlc; run `sqlc generate` after
+-- changing them or the migrations.
+
+-- name: CreateUser :one
+INSERT INTO "BK_User" (username, email, password)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetUserByID :one
+SELECT id, username, email, created_at, updated_at
+FROM "BK_User"
+WHERE id = $1;
+
+-- name: GetAllUsers :many
+SELECT id, username, email, created_at, updated_at
+FROM "BK_User"
+ORDER BY id;
+
+-- name: CheckUserEmailExists :one
+SELECT EXISTS (SELECT 1 FROM "BK_User" WHERE email = $1);
+
+-- name: UpdateUser :one
+UPDATE "BK_User"
+SET username = $2, email = $3, password = $4
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUserAccounts :many
+SELECT id, user_id, id_number, currency_code, balance, status, created_at, updated_at
+FROM "BK_Account"
+WHERE user_id = $1
+ORDER BY id;
+
+-- name: CheckAccountIDNumberExists :one
+SELECT EXISTS (SELECT 1 FROM "BK_Account" WHERE id_number = $1);
+
+-- name: GetAccountByIDNumber :one
+SELECT id, user_id, id_number, currency_code, balance, status, created_at, updated_at
+FROM "BK_Account"
+WHERE id_number = $1;
+
+-- name: GetAllAccounts :many
+SELECT id, user_id, id_number, currency_code, balance, status, created_at, updated_at
+FROM "BK_Account"
+ORDER BY id;
+
+-- name: GetAccountTransactionsByIDNumber :many
+-- The transactions from and to the account, newest first.
+SELECT t.id, t.account_from, t.account_to, t.amount, t.balance_after, t.tx_type, t.detail, t.created_at
+FROM "BK_Transaction" t
+JOIN "BK_Account" a ON a.id = t.account_from OR a.id = t.account_to
+WHERE a.id_number = $1
+ORDER BY t.id DESC;
+
+-- name: WithdrawFromAccount :one
+SELECT new_balance::NUMERIC AS new_balance, transaction_id::BIGINT AS transaction_id
+FROM withdraw_from_account(@account_id::BIGINT, @amount::NUMERIC, @tx_detail::TEXT);
+
+-- name: DepositToAccount :one
+SELECT new_balance::NUMERIC AS new_balance, transaction_id::BIGINT AS transaction_id
+FROM deposit_to_account(@account_id::BIGINT, @amount::NUMERIC, @tx_detail::TEXT);
+
+-- name: CreateTransaction :one
+-- Records a transaction of the account without moving money, at its current
+-- balance.
+INSERT INTO "BK_Transaction" (account_from, amount, balance_after, tx_type, detail)
+SELECT id, @amount::NUMERIC, balance, @tx_type::TEXT::TX_TYPE, @detail::TEXT
+FROM "BK_Account"
+WHERE id = @account_id::BIGINT
+RETURNING *;
+
+-- name: GetTransactionByID :one
+SELECT * FROM "BK_Transaction"
+WHERE id = $1;
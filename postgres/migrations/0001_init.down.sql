@@ -0,0 +1,14 @@
+DROP FUNCTION IF EXISTS transfer_between_accounts(BIGINT, BIGINT, NUMERIC, TEXT);
+DROP FUNCTION IF EXISTS deposit_to_account(BIGINT, NUMERIC, TEXT);
+DROP FUNCTION IF EXISTS withdraw_from_account(BIGINT, NUMERIC, TEXT);
+
+DROP VIEW IF EXISTS v_user_transactions;
+
+DROP TABLE IF EXISTS "BK_Transaction";
+DROP TYPE IF EXISTS TX_TYPE;
+DROP TABLE IF EXISTS "BK_Account";
+DROP TABLE IF EXISTS "BK_User";
+
+DROP FUNCTION IF EXISTS before_insert_bk_account();
+DROP FUNCTION IF EXISTS generate_account_number();
+DROP FUNCTION IF EXISTS update_updated_at();
@@ -9,9 +9,23 @@ CREATE TABLE IF NOT EXISTS "BK_User" (
 
 ALTER TABLE "BK_User" ENABLE ROW LEVEL SECURITY;
 
-CREATE POLICY "BK_User_policy"
+CREATE POLICY "BK_User_select_policy"
 ON "BK_User"
-FOR SELECT, UPDATE, DELETE
+FOR SELECT
+USING (
+    id = current_setting('app.current_user_id')::BIGINT
+);
+
+CREATE POLICY "BK_User_update_policy"
+ON "BK_User"
+FOR UPDATE
+USING (
+    id = current_setting('app.current_user_id')::BIGINT
+);
+
+CREATE POLICY "BK_User_delete_policy"
+ON "BK_User"
+FOR DELETE
 USING (
     id = current_setting('app.current_user_id')::BIGINT
 );
@@ -38,9 +52,23 @@ CREATE TABLE IF NOT EXISTS "BK_Account" (
 
 ALTER TABLE "BK_Account" ENABLE ROW LEVEL SECURITY;
 
-CREATE POLICY "BK_Account_policy"
+CREATE POLICY "BK_Account_select_policy"
+ON "BK_Account"
+FOR SELECT
+USING (
+    user_id = current_setting('app.current_user_id')::BIGINT
+);
+
+CREATE POLICY "BK_Account_update_policy"
+ON "BK_Account"
+FOR UPDATE
+USING (
+    user_id = current_setting('app.current_user_id')::BIGINT
+);
+
+CREATE POLICY "BK_Account_delete_policy"
 ON "BK_Account"
-FOR SELECT, UPDATE, DELETE
+FOR DELETE
 USING (
     user_id = current_setting('app.current_user_id')::BIGINT
 );
@@ -52,7 +80,7 @@ CREATE TYPE TX_TYPE AS ENUM (
     'WITHDRAW',
     'DEPOSIT',
     'TRANSFER',
-    'INTEREST',
+    'INTEREST'
 );
 
 CREATE TABLE IF NOT EXISTS "BK_Transaction" (
@@ -73,9 +101,39 @@ CREATE TABLE IF NOT EXISTS "BK_Transaction" (
 
 ALTER TABLE "BK_Transaction" ENABLE ROW LEVEL SECURITY;
 
-CREATE POLICY "BK_Transaction_policy"
+CREATE POLICY "BK_Transaction_select_policy"
+ON "BK_Transaction"
+FOR SELECT
+USING (
+    EXISTS (
+        SELECT 1 FROM "BK_Account" 
+        WHERE id = account_from 
+            AND user_id = current_setting('app.current_user_id')::BIGINT
+    ) OR EXISTS (
+        SELECT 1 FROM "BK_Account" 
+        WHERE id = account_to 
+            AND user_id = current_setting('app.current_user_id')::BIGINT
+    )
+);
+
+CREATE POLICY "BK_Transaction_update_policy"
+ON "BK_Transaction"
+FOR UPDATE
+USING (
+    EXISTS (
+        SELECT 1 FROM "BK_Account" 
+        WHERE id = account_from 
+            AND user_id = current_setting('app.current_user_id')::BIGINT
+    ) OR EXISTS (
+        SELECT 1 FROM "BK_Account" 
+        WHERE id = account_to 
+            AND user_id = current_setting('app.current_user_id')::BIGINT
+    )
+);
+
+CREATE POLICY "BK_Transaction_delete_policy"
 ON "BK_Transaction"
-FOR SELECT, UPDATE, DELETE
+FOR DELETE
 USING (
     EXISTS (
         SELECT 1 FROM "BK_Account" 
@@ -164,8 +222,6 @@ CREATE OR REPLACE FUNCTION withdraw_from_account(
     new_balance NUMERIC(100, 2),
     transaction_id BIGINT
 ) AS $$
-DECLARE
-    tx_id BIGINT;
 BEGIN
     IF NOT EXISTS (
         SELECT 1 FROM "BK_Account" 
@@ -179,34 +235,31 @@ BEGIN
         RAISE EXCEPTION 'Amount must be positive, got %', amount USING ERRCODE = 'P0001';
     END IF;
 
-    WITH updated AS (
-        UPDATE "BK_Account"
-        SET balance = balance - amount
-        WHERE id = input_account_id 
-            AND balance >= amount
-        RETURNING balance
-    )
+    UPDATE "BK_Account"
+    SET balance = balance - amount
+    WHERE id = input_account_id 
+        AND balance >= amount
+    RETURNING balance INTO new_balance;
 
     IF NOT FOUND THEN
-        RAISE EXCEPTION 'Insufficient funds for account %', account_id USING ERRCODE = 'P0001';
+        RAISE EXCEPTION 'Insufficient funds for account %', input_account_id USING ERRCODE = 'P0001';
     END IF;
 
-    SELECT balance INTO new_balance FROM updated;
-
     INSERT INTO "BK_Transaction" (
-        account_id, 
+        account_from, 
         amount, 
         balance_after, 
-        tx_type, detail
+        tx_type, 
+        detail
     ) VALUES (
         input_account_id, 
         amount, 
         new_balance, 
         'WITHDRAW', 
         tx_detail
-    ) RETURNING id INTO tx_id;
+    ) RETURNING id INTO transaction_id;
 
-    RETURN new_balance, tx_id;
+    RETURN NEXT;
 END;
 $$ LANGUAGE plpgsql;
 
@@ -219,9 +272,6 @@ CREATE OR REPLACE FUNCTION deposit_to_account(
     new_balance NUMERIC(100, 2),
     transaction_id BIGINT
 ) AS $$
-DECLARE
-    new_balance NUMERIC(100, 2);
-    tx_id BIGINT;
 BEGIN
     IF NOT EXISTS (
         SELECT 1 FROM "BK_Account" 
@@ -237,11 +287,11 @@ BEGIN
 
     UPDATE "BK_Account"
     SET balance = balance + amount
-    WHERE id = account_id
+    WHERE id = input_account_id
     RETURNING balance INTO new_balance;
 
     INSERT INTO "BK_Transaction" (
-        account_id, 
+        account_from, 
         amount, 
         balance_after, 
         tx_type, 
@@ -252,9 +302,9 @@ BEGIN
         new_balance, 
         'DEPOSIT', 
         tx_detail
-    ) RETURNING id INTO tx_id;
+    ) RETURNING id INTO transaction_id;
 
-    RETURN new_balance, tx_id;
+    RETURN NEXT;
 END;
 $$ LANGUAGE plpgsql;
 
@@ -268,9 +318,6 @@ CREATE OR REPLACE FUNCTION transfer_between_accounts(
     new_balance_from NUMERIC(100, 2),
     transaction_id BIGINT
 ) AS $$
-DECLARE
-    new_balance_from NUMERIC(100, 2);
-    tx_id BIGINT;
 BEGIN
     IF NOT EXISTS (
         SELECT 1 FROM "BK_Account" 
@@ -295,25 +342,26 @@ BEGIN
         RAISE EXCEPTION 'Amount must be positive, got %', amount USING ERRCODE = 'P0001';
     END IF;
 
-    WITH updated_from AS (
-        UPDATE "BK_Account"
-        SET balance = balance - amount
-        WHERE id = from_account_id 
-            AND balance >= amount
-        RETURNING balance
-    ),
-    updated_to AS (
-        UPDATE "BK_Account"
-        SET balance = balance + amount
-        WHERE id = to_account_id
-        RETURNING balance
-    )
-    SELECT updated_from.balance INTO new_balance_from FROM updated_from;
+    -- Lock both rows in id order so concurrent opposite transfers cannot deadlock
+    PERFORM 1 FROM "BK_Account"
+    WHERE id IN (from_account_id, to_account_id)
+    ORDER BY id
+    FOR UPDATE;
+
+    UPDATE "BK_Account"
+    SET balance = balance - amount
+    WHERE id = from_account_id 
+        AND balance >= amount
+    RETURNING balance INTO new_balance_from;
 
     IF NOT FOUND THEN
         RAISE EXCEPTION 'Insufficient funds for account %', from_account_id USING ERRCODE = 'P0001';
     END IF;
 
+    UPDATE "BK_Account"
+    SET balance = balance + amount
+    WHERE id = to_account_id;
+
     INSERT INTO "BK_Transaction" (
         account_from, 
         account_to, 
@@ -328,8 +376,8 @@ BEGIN
         new_balance_from, 
         'TRANSFER', 
         tx_detail
-    ) RETURNING id INTO tx_id;
+    ) RETURNING id INTO transaction_id;
 
-    RETURN new_balance_from, tx_id;
+    RETURN NEXT;
 END;
-$$ LANGUAGE plpgsql;
\ No newline at end of file
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,41 @@
+-- TOTP secrets are encrypted by the application, recovery codes are bcrypt hashes
+CREATE TABLE IF NOT EXISTS "BK_User_TOTP" (
+    user_id BIGINT PRIMARY KEY,
+    secret BYTEA NOT NULL,
+    recovery_codes TEXT[] NOT NULL DEFAULT '{}',
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    confirmed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id)
+        REFERENCES "BK_User"(id) ON DELETE CASCADE
+);
+
+ALTER TABLE "BK_User_TOTP" ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "BK_User_TOTP_select_policy"
+ON "BK_User_TOTP"
+FOR SELECT
+USING (
+    user_id = current_setting('app.current_user_id')::BIGINT
+);
+
+CREATE POLICY "BK_User_TOTP_update_policy"
+ON "BK_User_TOTP"
+FOR UPDATE
+USING (
+    user_id = current_setting('app.current_user_id')::BIGINT
+);
+
+CREATE POLICY "BK_User_TOTP_delete_policy"
+ON "BK_User_TOTP"
+FOR DELETE
+USING (
+    user_id = current_setting('app.current_user_id')::BIGINT
+);
+
+CREATE TRIGGER trig_bk_user_totp_update
+BEFORE UPDATE ON "BK_User_TOTP"
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at();
@@ -0,0 +1,133 @@
+DROP FUNCTION IF EXISTS expire_holds();
+DROP FUNCTION IF EXISTS release_hold(BIGINT, BIGINT);
+DROP FUNCTION IF EXISTS capture_hold(BIGINT, BIGINT, NUMERIC, BIGINT);
+DROP FUNCTION IF EXISTS place_hold(BIGINT, NUMERIC, TEXT, TIMESTAMPTZ);
+
+DROP TABLE IF EXISTS "BK_Account_Hold";
+DROP TYPE IF EXISTS HOLD_STATUS;
+
+ALTER TABLE "BK_Account" DROP COLUMN IF EXISTS held_balance;
+
+-- Withdraw from account
+CREATE OR REPLACE FUNCTION withdraw_from_account(
+    input_account_id BIGINT, 
+    amount NUMERIC(20,2), 
+    tx_detail TEXT
+) RETURNS TABLE (
+    new_balance NUMERIC(100, 2),
+    transaction_id BIGINT
+) AS $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account" 
+        WHERE id = input_account_id     
+            AND status = 'ACTIVE'
+    ) THEN
+        RAISE EXCEPTION 'Account % not active', input_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF amount <= 0 THEN
+        RAISE EXCEPTION 'Amount must be positive, got %', amount USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET balance = balance - amount
+    WHERE id = input_account_id 
+        AND balance >= amount
+    RETURNING balance INTO new_balance;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Insufficient funds for account %', input_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    INSERT INTO "BK_Transaction" (
+        account_from, 
+        amount, 
+        balance_after, 
+        tx_type, 
+        detail
+    ) VALUES (
+        input_account_id, 
+        amount, 
+        new_balance, 
+        'WITHDRAW', 
+        tx_detail
+    ) RETURNING id INTO transaction_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Transfer from one account to another
+CREATE OR REPLACE FUNCTION transfer_between_accounts(
+    from_account_id BIGINT, 
+    to_account_id BIGINT, 
+    amount NUMERIC(20, 2), 
+    tx_detail TEXT
+) RETURNS TABLE (
+    new_balance_from NUMERIC(100, 2),
+    transaction_id BIGINT
+) AS $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account" 
+        WHERE id IN (from_account_id, to_account_id) 
+        AND status = 'ACTIVE'
+        HAVING COUNT(DISTINCT id) = 2
+    ) THEN
+        IF NOT EXISTS (
+            SELECT 1 FROM "BK_Account" 
+            WHERE id = from_account_id AND status = 'ACTIVE'
+        ) THEN
+            RAISE EXCEPTION 'Account % not active', from_account_id USING ERRCODE = 'P0001';
+        END IF;
+        RAISE EXCEPTION 'Account % not active', to_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF from_account_id = to_account_id THEN
+        RAISE EXCEPTION 'Cannot transfer to the same account %', from_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF amount <= 0 THEN
+        RAISE EXCEPTION 'Amount must be positive, got %', amount USING ERRCODE = 'P0001';
+    END IF;
+
+    -- Lock both rows in id order so concurrent opposite transfers cannot deadlock
+    PERFORM 1 FROM "BK_Account"
+    WHERE id IN (from_account_id, to_account_id)
+    ORDER BY id
+    FOR UPDATE;
+
+    UPDATE "BK_Account"
+    SET balance = balance - amount
+    WHERE id = from_account_id 
+        AND balance >= amount
+    RETURNING balance INTO new_balance_from;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Insufficient funds for account %', from_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET balance = balance + amount
+    WHERE id = to_account_id;
+
+    INSERT INTO "BK_Transaction" (
+        account_from, 
+        account_to, 
+        amount, 
+        balance_after, 
+        tx_type, 
+        detail
+    ) VALUES (
+        from_account_id, 
+        to_account_id, 
+        amount, 
+        new_balance_from, 
+        'TRANSFER', 
+        tx_detail
+    ) RETURNING id INTO transaction_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
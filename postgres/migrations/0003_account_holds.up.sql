@@ -0,0 +1,407 @@
+-- Holds reserve money without moving it. The ledger balance stays in balance,
+-- the reserved part in held_balance, and the available balance is the
+-- difference between the two.
+ALTER TABLE "BK_Account"
+    ADD COLUMN held_balance NUMERIC(100, 2) NOT NULL DEFAULT 0,
+    ADD CONSTRAINT held_within_balance
+        CHECK (held_balance >= 0 AND held_balance <= balance);
+
+CREATE TYPE HOLD_STATUS AS ENUM (
+    'ACTIVE',
+    'CAPTURED',
+    'RELEASED',
+    'EXPIRED'
+);
+
+CREATE TABLE IF NOT EXISTS "BK_Account_Hold" (
+    id BIGSERIAL PRIMARY KEY,
+    account_id BIGINT NOT NULL,
+    amount NUMERIC(100, 2) NOT NULL,
+    captured_amount NUMERIC(100, 2) NOT NULL DEFAULT 0,
+    status HOLD_STATUS NOT NULL DEFAULT 'ACTIVE',
+    detail TEXT NOT NULL DEFAULT '',
+    transaction_id BIGINT,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (account_id)
+        REFERENCES "BK_Account"(id) ON DELETE CASCADE,
+    FOREIGN KEY (transaction_id)
+        REFERENCES "BK_Transaction"(id),
+    CONSTRAINT positive_hold_amount
+        CHECK (amount > 0),
+    CONSTRAINT valid_captured_amount
+        CHECK (captured_amount >= 0 AND captured_amount <= amount)
+);
+
+CREATE INDEX idx_bk_account_hold_account_id ON "BK_Account_Hold" (account_id);
+CREATE INDEX idx_bk_account_hold_expires_at ON "BK_Account_Hold" (expires_at)
+    WHERE status = 'ACTIVE';
+
+ALTER TABLE "BK_Account_Hold" ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "BK_Account_Hold_select_policy"
+ON "BK_Account_Hold"
+FOR SELECT
+USING (
+    EXISTS (
+        SELECT 1 FROM "BK_Account"
+        WHERE id = account_id
+            AND user_id = current_setting('app.current_user_id')::BIGINT
+    )
+);
+
+CREATE POLICY "BK_Account_Hold_update_policy"
+ON "BK_Account_Hold"
+FOR UPDATE
+USING (
+    EXISTS (
+        SELECT 1 FROM "BK_Account"
+        WHERE id = account_id
+            AND user_id = current_setting('app.current_user_id')::BIGINT
+    )
+);
+
+CREATE POLICY "BK_Account_Hold_delete_policy"
+ON "BK_Account_Hold"
+FOR DELETE
+USING (
+    EXISTS (
+        SELECT 1 FROM "BK_Account"
+        WHERE id = account_id
+            AND user_id = current_setting('app.current_user_id')::BIGINT
+    )
+);
+
+CREATE TRIGGER trig_bk_account_hold_update
+BEFORE UPDATE ON "BK_Account_Hold"
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at();
+
+-- Withdraw from account, only from the available balance
+CREATE OR REPLACE FUNCTION withdraw_from_account(
+    input_account_id BIGINT, 
+    amount NUMERIC(20,2), 
+    tx_detail TEXT
+) RETURNS TABLE (
+    new_balance NUMERIC(100, 2),
+    transaction_id BIGINT
+) AS $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account" 
+        WHERE id = input_account_id     
+            AND status = 'ACTIVE'
+    ) THEN
+        RAISE EXCEPTION 'Account % not active', input_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF amount <= 0 THEN
+        RAISE EXCEPTION 'Amount must be positive, got %', amount USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET balance = balance - amount
+    WHERE id = input_account_id 
+        AND balance - held_balance >= amount
+    RETURNING balance INTO new_balance;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Insufficient funds for account %', input_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    INSERT INTO "BK_Transaction" (
+        account_from, 
+        amount, 
+        balance_after, 
+        tx_type, 
+        detail
+    ) VALUES (
+        input_account_id, 
+        amount, 
+        new_balance, 
+        'WITHDRAW', 
+        tx_detail
+    ) RETURNING id INTO transaction_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Transfer from one account to another, only from the available balance
+CREATE OR REPLACE FUNCTION transfer_between_accounts(
+    from_account_id BIGINT, 
+    to_account_id BIGINT, 
+    amount NUMERIC(20, 2), 
+    tx_detail TEXT
+) RETURNS TABLE (
+    new_balance_from NUMERIC(100, 2),
+    transaction_id BIGINT
+) AS $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account" 
+        WHERE id IN (from_account_id, to_account_id) 
+        AND status = 'ACTIVE'
+        HAVING COUNT(DISTINCT id) = 2
+    ) THEN
+        IF NOT EXISTS (
+            SELECT 1 FROM "BK_Account" 
+            WHERE id = from_account_id AND status = 'ACTIVE'
+        ) THEN
+            RAISE EXCEPTION 'Account % not active', from_account_id USING ERRCODE = 'P0001';
+        END IF;
+        RAISE EXCEPTION 'Account % not active', to_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF from_account_id = to_account_id THEN
+        RAISE EXCEPTION 'Cannot transfer to the same account %', from_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF amount <= 0 THEN
+        RAISE EXCEPTION 'Amount must be positive, got %', amount USING ERRCODE = 'P0001';
+    END IF;
+
+    -- Lock both rows in id order so concurrent opposite transfers cannot deadlock
+    PERFORM 1 FROM "BK_Account"
+    WHERE id IN (from_account_id, to_account_id)
+    ORDER BY id
+    FOR UPDATE;
+
+    UPDATE "BK_Account"
+    SET balance = balance - amount
+    WHERE id = from_account_id 
+        AND balance - held_balance >= amount
+    RETURNING balance INTO new_balance_from;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Insufficient funds for account %', from_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET balance = balance + amount
+    WHERE id = to_account_id;
+
+    INSERT INTO "BK_Transaction" (
+        account_from, 
+        account_to, 
+        amount, 
+        balance_after, 
+        tx_type, 
+        detail
+    ) VALUES (
+        from_account_id, 
+        to_account_id, 
+        amount, 
+        new_balance_from, 
+        'TRANSFER', 
+        tx_detail
+    ) RETURNING id INTO transaction_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Reserve amount of the available balance until hold_expires_at
+CREATE OR REPLACE FUNCTION place_hold(
+    input_account_id BIGINT,
+    amount NUMERIC(20, 2),
+    hold_detail TEXT,
+    hold_expires_at TIMESTAMPTZ
+) RETURNS TABLE (
+    hold_id BIGINT,
+    new_available NUMERIC(100, 2)
+) AS $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account"
+        WHERE id = input_account_id
+            AND status = 'ACTIVE'
+    ) THEN
+        RAISE EXCEPTION 'Account % not active', input_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF amount <= 0 THEN
+        RAISE EXCEPTION 'Amount must be positive, got %', amount USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET held_balance = held_balance + amount
+    WHERE id = input_account_id
+        AND balance - held_balance >= amount
+    RETURNING balance - held_balance INTO new_available;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Insufficient funds for account %', input_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    INSERT INTO "BK_Account_Hold" (
+        account_id,
+        amount,
+        detail,
+        expires_at
+    ) VALUES (
+        input_account_id,
+        amount,
+        hold_detail,
+        hold_expires_at
+    ) RETURNING id INTO hold_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Settle capture_amount of an active hold as a WITHDRAW, or as a TRANSFER when
+-- to_account_id is not NULL. The rest of the hold is released.
+CREATE OR REPLACE FUNCTION capture_hold(
+    input_account_id BIGINT,
+    input_hold_id BIGINT,
+    capture_amount NUMERIC(20, 2),
+    to_account_id BIGINT
+) RETURNS TABLE (
+    new_balance NUMERIC(100, 2),
+    transaction_id BIGINT
+) AS $$
+DECLARE
+    hold "BK_Account_Hold"%ROWTYPE;
+BEGIN
+    SELECT * INTO hold FROM "BK_Account_Hold"
+    WHERE id = input_hold_id
+        AND account_id = input_account_id
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Hold % not found', input_hold_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF hold.status <> 'ACTIVE' OR hold.expires_at <= NOW() THEN
+        RAISE EXCEPTION 'Hold % is not active', input_hold_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF capture_amount <= 0 OR capture_amount > hold.amount THEN
+        RAISE EXCEPTION 'Capture amount % must be positive and at most %', capture_amount, hold.amount
+            USING ERRCODE = 'P0001';
+    END IF;
+
+    IF to_account_id = input_account_id THEN
+        RAISE EXCEPTION 'Cannot transfer to the same account %', input_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF (
+        SELECT COUNT(*) FROM "BK_Account"
+        WHERE id IN (input_account_id, to_account_id)
+            AND status = 'ACTIVE'
+    ) <> CASE WHEN to_account_id IS NULL THEN 1 ELSE 2 END THEN
+        RAISE EXCEPTION 'Account % not active', COALESCE(to_account_id, input_account_id) USING ERRCODE = 'P0001';
+    END IF;
+
+    PERFORM 1 FROM "BK_Account"
+    WHERE id IN (input_account_id, to_account_id)
+    ORDER BY id
+    FOR UPDATE;
+
+    -- balance >= held_balance before and capture_amount <= hold.amount, so
+    -- the constraint on held_balance still holds afterwards
+    UPDATE "BK_Account"
+    SET balance = balance - capture_amount,
+        held_balance = held_balance - hold.amount
+    WHERE id = input_account_id
+    RETURNING balance INTO new_balance;
+
+    IF to_account_id IS NOT NULL THEN
+        UPDATE "BK_Account"
+        SET balance = balance + capture_amount
+        WHERE id = to_account_id;
+    END IF;
+
+    INSERT INTO "BK_Transaction" (
+        account_from,
+        account_to,
+        amount,
+        balance_after,
+        tx_type,
+        detail
+    ) VALUES (
+        input_account_id,
+        to_account_id,
+        capture_amount,
+        new_balance,
+        CASE WHEN to_account_id IS NULL THEN 'WITHDRAW' ELSE 'TRANSFER' END::TX_TYPE,
+        hold.detail
+    ) RETURNING id INTO transaction_id;
+
+    UPDATE "BK_Account_Hold"
+    SET status = 'CAPTURED',
+        captured_amount = capture_amount,
+        transaction_id = capture_hold.transaction_id
+    WHERE id = input_hold_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Give the whole amount of an active hold back to the available balance
+CREATE OR REPLACE FUNCTION release_hold(
+    input_account_id BIGINT,
+    input_hold_id BIGINT
+) RETURNS NUMERIC(100, 2) AS $$
+DECLARE
+    hold "BK_Account_Hold"%ROWTYPE;
+    new_available NUMERIC(100, 2);
+BEGIN
+    SELECT * INTO hold FROM "BK_Account_Hold"
+    WHERE id = input_hold_id
+        AND account_id = input_account_id
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Hold % not found', input_hold_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF hold.status <> 'ACTIVE' THEN
+        RAISE EXCEPTION 'Hold % is not active', input_hold_id USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET held_balance = held_balance - hold.amount
+    WHERE id = input_account_id
+    RETURNING balance - held_balance INTO new_available;
+
+    UPDATE "BK_Account_Hold"
+    SET status = 'RELEASED'
+    WHERE id = input_hold_id;
+
+    RETURN new_available;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Release every active hold past its expiry and return how many expired.
+-- Holds locked by a concurrent capture or release are left for the next run.
+CREATE OR REPLACE FUNCTION expire_holds()
+RETURNS INTEGER AS $$
+DECLARE
+    hold RECORD;
+    expired INTEGER := 0;
+BEGIN
+    FOR hold IN
+        SELECT id, account_id, amount FROM "BK_Account_Hold"
+        WHERE status = 'ACTIVE'
+            AND expires_at <= NOW()
+        ORDER BY account_id, id
+        FOR UPDATE SKIP LOCKED
+    LOOP
+        UPDATE "BK_Account"
+        SET held_balance = held_balance - hold.amount
+        WHERE id = hold.account_id;
+
+        UPDATE "BK_Account_Hold"
+        SET status = 'EXPIRED'
+        WHERE id = hold.id;
+
+        expired := expired + 1;
+    END LOOP;
+
+    RETURN expired;
+END;
+$$ LANGUAGE plpgsql;
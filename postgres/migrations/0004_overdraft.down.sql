@@ -0,0 +1,225 @@
+DROP FUNCTION IF EXISTS post_overdraft_charges(DATE);
+DROP FUNCTION IF EXISTS update_overdraft(VARCHAR, NUMERIC, NUMERIC, NUMERIC);
+
+DROP TABLE IF EXISTS "BK_Overdraft_Charge";
+
+-- Enum values cannot be dropped, FEE stays in TX_TYPE. Accounts still
+-- overdrawn make the positive_balance constraint fail, settle them first.
+ALTER TABLE "BK_Account"
+    DROP CONSTRAINT IF EXISTS valid_overdraft,
+    DROP CONSTRAINT IF EXISTS positive_held_balance,
+    DROP COLUMN IF EXISTS overdraft_daily_fee,
+    DROP COLUMN IF EXISTS overdraft_interest_rate,
+    DROP COLUMN IF EXISTS overdraft_limit,
+    ADD CONSTRAINT positive_balance
+        CHECK (balance >= 0),
+    ADD CONSTRAINT held_within_balance
+        CHECK (held_balance >= 0 AND held_balance <= balance);
+
+-- Withdraw from account, only from the available balance
+CREATE OR REPLACE FUNCTION withdraw_from_account(
+    input_account_id BIGINT, 
+    amount NUMERIC(20,2), 
+    tx_detail TEXT
+) RETURNS TABLE (
+    new_balance NUMERIC(100, 2),
+    transaction_id BIGINT
+) AS $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account" 
+        WHERE id = input_account_id     
+            AND status = 'ACTIVE'
+    ) THEN
+        RAISE EXCEPTION 'Account % not active', input_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF amount <= 0 THEN
+        RAISE EXCEPTION 'Amount must be positive, got %', amount USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET balance = balance - amount
+    WHERE id = input_account_id 
+        AND balance - held_balance >= amount
+    RETURNING balance INTO new_balance;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Insufficient funds for account %', input_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    INSERT INTO "BK_Transaction" (
+        account_from, 
+        amount, 
+        balance_after, 
+        tx_type, 
+        detail
+    ) VALUES (
+        input_account_id, 
+        amount, 
+        new_balance, 
+        'WITHDRAW', 
+        tx_detail
+    ) RETURNING id INTO transaction_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Transfer from one account to another, only from the available balance
+CREATE OR REPLACE FUNCTION transfer_between_accounts(
+    from_account_id BIGINT, 
+    to_account_id BIGINT, 
+    amount NUMERIC(20, 2), 
+    tx_detail TEXT
+) RETURNS TABLE (
+    new_balance_from NUMERIC(100, 2),
+    transaction_id BIGINT
+) AS $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account" 
+        WHERE id IN (from_account_id, to_account_id) 
+        AND status = 'ACTIVE'
+        HAVING COUNT(DISTINCT id) = 2
+    ) THEN
+        IF NOT EXISTS (
+            SELECT 1 FROM "BK_Account" 
+            WHERE id = from_account_id AND status = 'ACTIVE'
+        ) THEN
+            RAISE EXCEPTION 'Account % not active', from_account_id USING ERRCODE = 'P0001';
+        END IF;
+        RAISE EXCEPTION 'Account % not active', to_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF from_account_id = to_account_id THEN
+        RAISE EXCEPTION 'Cannot transfer to the same account %', from_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF amount <= 0 THEN
+        RAISE EXCEPTION 'Amount must be positive, got %', amount USING ERRCODE = 'P0001';
+    END IF;
+
+    -- Lock both rows in id order so concurrent opposite transfers cannot deadlock
+    PERFORM 1 FROM "BK_Account"
+    WHERE id IN (from_account_id, to_account_id)
+    ORDER BY id
+    FOR UPDATE;
+
+    UPDATE "BK_Account"
+    SET balance = balance - amount
+    WHERE id = from_account_id 
+        AND balance - held_balance >= amount
+    RETURNING balance INTO new_balance_from;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Insufficient funds for account %', from_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET balance = balance + amount
+    WHERE id = to_account_id;
+
+    INSERT INTO "BK_Transaction" (
+        account_from, 
+        account_to, 
+        amount, 
+        balance_after, 
+        tx_type, 
+        detail
+    ) VALUES (
+        from_account_id, 
+        to_account_id, 
+        amount, 
+        new_balance_from, 
+        'TRANSFER', 
+        tx_detail
+    ) RETURNING id INTO transaction_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Reserve amount of the available balance until hold_expires_at
+CREATE OR REPLACE FUNCTION place_hold(
+    input_account_id BIGINT,
+    amount NUMERIC(20, 2),
+    hold_detail TEXT,
+    hold_expires_at TIMESTAMPTZ
+) RETURNS TABLE (
+    hold_id BIGINT,
+    new_available NUMERIC(100, 2)
+) AS $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account"
+        WHERE id = input_account_id
+            AND status = 'ACTIVE'
+    ) THEN
+        RAISE EXCEPTION 'Account % not active', input_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF amount <= 0 THEN
+        RAISE EXCEPTION 'Amount must be positive, got %', amount USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET held_balance = held_balance + amount
+    WHERE id = input_account_id
+        AND balance - held_balance >= amount
+    RETURNING balance - held_balance INTO new_available;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Insufficient funds for account %', input_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    INSERT INTO "BK_Account_Hold" (
+        account_id,
+        amount,
+        detail,
+        expires_at
+    ) VALUES (
+        input_account_id,
+        amount,
+        hold_detail,
+        hold_expires_at
+    ) RETURNING id INTO hold_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Give the whole amount of an active hold back to the available balance
+CREATE OR REPLACE FUNCTION release_hold(
+    input_account_id BIGINT,
+    input_hold_id BIGINT
+) RETURNS NUMERIC(100, 2) AS $$
+DECLARE
+    hold "BK_Account_Hold"%ROWTYPE;
+    new_available NUMERIC(100, 2);
+BEGIN
+    SELECT * INTO hold FROM "BK_Account_Hold"
+    WHERE id = input_hold_id
+        AND account_id = input_account_id
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Hold % not found', input_hold_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF hold.status <> 'ACTIVE' THEN
+        RAISE EXCEPTION 'Hold % is not active', input_hold_id USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET held_balance = held_balance - hold.amount
+    WHERE id = input_account_id
+    RETURNING balance - held_balance INTO new_available;
+
+    UPDATE "BK_Account_Hold"
+    SET status = 'RELEASED'
+    WHERE id = input_hold_id;
+
+    RETURN new_available;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,368 @@
+-- Accounts may go below zero down to -overdraft_limit. Withdrawals,
+-- transfers and holds enforce the limit; daily interest and fees may take an
+-- account beyond it, so the balance itself is no longer constrained.
+ALTER TABLE "BK_Account"
+    DROP CONSTRAINT positive_balance,
+    DROP CONSTRAINT held_within_balance,
+    ADD COLUMN overdraft_limit NUMERIC(100, 2) NOT NULL DEFAULT 0,
+    -- Yearly rate, charged daily on the overdrawn amount
+    ADD COLUMN overdraft_interest_rate NUMERIC(7, 6) NOT NULL DEFAULT 0,
+    -- Charged for every day the account is overdrawn
+    ADD COLUMN overdraft_daily_fee NUMERIC(100, 2) NOT NULL DEFAULT 0,
+    ADD CONSTRAINT positive_held_balance
+        CHECK (held_balance >= 0),
+    ADD CONSTRAINT valid_overdraft
+        CHECK (overdraft_limit >= 0 AND overdraft_interest_rate BETWEEN 0 AND 1 AND overdraft_daily_fee >= 0);
+
+ALTER TYPE TX_TYPE ADD VALUE IF NOT EXISTS 'FEE';
+
+-- One row per account and day charged, so that charges are posted at most once
+CREATE TABLE IF NOT EXISTS "BK_Overdraft_Charge" (
+    account_id BIGINT NOT NULL,
+    charge_date DATE NOT NULL,
+    balance NUMERIC(100, 2) NOT NULL,
+    interest NUMERIC(100, 2) NOT NULL,
+    fee NUMERIC(100, 2) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (account_id, charge_date),
+    FOREIGN KEY (account_id)
+        REFERENCES "BK_Account"(id) ON DELETE CASCADE
+);
+
+ALTER TABLE "BK_Overdraft_Charge" ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "BK_Overdraft_Charge_select_policy"
+ON "BK_Overdraft_Charge"
+FOR SELECT
+USING (
+    EXISTS (
+        SELECT 1 FROM "BK_Account"
+        WHERE id = account_id
+            AND user_id = current_setting('app.current_user_id')::BIGINT
+    )
+);
+
+-- Withdraw from account, only from the available balance including the overdraft limit
+CREATE OR REPLACE FUNCTION withdraw_from_account(
+    input_account_id BIGINT, 
+    amount NUMERIC(20,2), 
+    tx_detail TEXT
+) RETURNS TABLE (
+    new_balance NUMERIC(100, 2),
+    transaction_id BIGINT
+) AS $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account" 
+        WHERE id = input_account_id     
+            AND status = 'ACTIVE'
+    ) THEN
+        RAISE EXCEPTION 'Account % not active', input_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF amount <= 0 THEN
+        RAISE EXCEPTION 'Amount must be positive, got %', amount USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET balance = balance - amount
+    WHERE id = input_account_id 
+        AND balance + overdraft_limit - held_balance >= amount
+    RETURNING balance INTO new_balance;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Insufficient funds for account %', input_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    INSERT INTO "BK_Transaction" (
+        account_from, 
+        amount, 
+        balance_after, 
+        tx_type, 
+        detail
+    ) VALUES (
+        input_account_id, 
+        amount, 
+        new_balance, 
+        'WITHDRAW', 
+        tx_detail
+    ) RETURNING id INTO transaction_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Transfer from one account to another, only from the available balance including
+-- the overdraft limit
+CREATE OR REPLACE FUNCTION transfer_between_accounts(
+    from_account_id BIGINT, 
+    to_account_id BIGINT, 
+    amount NUMERIC(20, 2), 
+    tx_detail TEXT
+) RETURNS TABLE (
+    new_balance_from NUMERIC(100, 2),
+    transaction_id BIGINT
+) AS $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account" 
+        WHERE id IN (from_account_id, to_account_id) 
+        AND status = 'ACTIVE'
+        HAVING COUNT(DISTINCT id) = 2
+    ) THEN
+        IF NOT EXISTS (
+            SELECT 1 FROM "BK_Account" 
+            WHERE id = from_account_id AND status = 'ACTIVE'
+        ) THEN
+            RAISE EXCEPTION 'Account % not active', from_account_id USING ERRCODE = 'P0001';
+        END IF;
+        RAISE EXCEPTION 'Account % not active', to_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF from_account_id = to_account_id THEN
+        RAISE EXCEPTION 'Cannot transfer to the same account %', from_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF amount <= 0 THEN
+        RAISE EXCEPTION 'Amount must be positive, got %', amount USING ERRCODE = 'P0001';
+    END IF;
+
+    -- Lock both rows in id order so concurrent opposite transfers cannot deadlock
+    PERFORM 1 FROM "BK_Account"
+    WHERE id IN (from_account_id, to_account_id)
+    ORDER BY id
+    FOR UPDATE;
+
+    UPDATE "BK_Account"
+    SET balance = balance - amount
+    WHERE id = from_account_id 
+        AND balance + overdraft_limit - held_balance >= amount
+    RETURNING balance INTO new_balance_from;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Insufficient funds for account %', from_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET balance = balance + amount
+    WHERE id = to_account_id;
+
+    INSERT INTO "BK_Transaction" (
+        account_from, 
+        account_to, 
+        amount, 
+        balance_after, 
+        tx_type, 
+        detail
+    ) VALUES (
+        from_account_id, 
+        to_account_id, 
+        amount, 
+        new_balance_from, 
+        'TRANSFER', 
+        tx_detail
+    ) RETURNING id INTO transaction_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Reserve amount of the available balance until hold_expires_at
+CREATE OR REPLACE FUNCTION place_hold(
+    input_account_id BIGINT,
+    amount NUMERIC(20, 2),
+    hold_detail TEXT,
+    hold_expires_at TIMESTAMPTZ
+) RETURNS TABLE (
+    hold_id BIGINT,
+    new_available NUMERIC(100, 2)
+) AS $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account"
+        WHERE id = input_account_id
+            AND status = 'ACTIVE'
+    ) THEN
+        RAISE EXCEPTION 'Account % not active', input_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF amount <= 0 THEN
+        RAISE EXCEPTION 'Amount must be positive, got %', amount USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET held_balance = held_balance + amount
+    WHERE id = input_account_id
+        AND balance + overdraft_limit - held_balance >= amount
+    RETURNING balance + overdraft_limit - held_balance INTO new_available;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Insufficient funds for account %', input_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    INSERT INTO "BK_Account_Hold" (
+        account_id,
+        amount,
+        detail,
+        expires_at
+    ) VALUES (
+        input_account_id,
+        amount,
+        hold_detail,
+        hold_expires_at
+    ) RETURNING id INTO hold_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Give the whole amount of an active hold back to the available balance
+CREATE OR REPLACE FUNCTION release_hold(
+    input_account_id BIGINT,
+    input_hold_id BIGINT
+) RETURNS NUMERIC(100, 2) AS $$
+DECLARE
+    hold "BK_Account_Hold"%ROWTYPE;
+    new_available NUMERIC(100, 2);
+BEGIN
+    SELECT * INTO hold FROM "BK_Account_Hold"
+    WHERE id = input_hold_id
+        AND account_id = input_account_id
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Hold % not found', input_hold_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF hold.status <> 'ACTIVE' THEN
+        RAISE EXCEPTION 'Hold % is not active', input_hold_id USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET held_balance = held_balance - hold.amount
+    WHERE id = input_account_id
+    RETURNING balance + overdraft_limit - held_balance INTO new_available;
+
+    UPDATE "BK_Account_Hold"
+    SET status = 'RELEASED'
+    WHERE id = input_hold_id;
+
+    RETURN new_available;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Change the overdraft terms; the limit cannot drop below what is in use
+CREATE OR REPLACE FUNCTION update_overdraft(
+    input_id_number VARCHAR(20),
+    new_limit NUMERIC(100, 2),
+    new_interest_rate NUMERIC(7, 6),
+    new_daily_fee NUMERIC(100, 2)
+) RETURNS VOID AS $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account" WHERE id_number = input_id_number
+    ) THEN
+        RAISE EXCEPTION 'Account % not found', input_id_number USING ERRCODE = 'P0002';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET overdraft_limit = new_limit,
+        overdraft_interest_rate = new_interest_rate,
+        overdraft_daily_fee = new_daily_fee
+    WHERE id_number = input_id_number
+        AND balance + new_limit - held_balance >= 0;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Overdraft limit % is below the amount in use on account %', new_limit, input_id_number
+            USING ERRCODE = 'P0001';
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Post interest and the daily fee on every overdrawn account that was not
+-- charged for charge_date yet, and return the ids of the charged accounts.
+-- Accounts locked by a concurrent operation are left for the next run.
+CREATE OR REPLACE FUNCTION post_overdraft_charges(
+    charge_date DATE
+) RETURNS SETOF BIGINT AS $$
+DECLARE
+    acc RECORD;
+    interest NUMERIC(100, 2);
+    new_balance NUMERIC(100, 2);
+BEGIN
+    FOR acc IN
+        SELECT id, balance, overdraft_interest_rate, overdraft_daily_fee FROM "BK_Account"
+        WHERE balance < 0
+            AND status <> 'CLOSED'
+        ORDER BY id
+        FOR UPDATE SKIP LOCKED
+    LOOP
+        interest := ROUND(-acc.balance * acc.overdraft_interest_rate / 365, 2);
+
+        INSERT INTO "BK_Overdraft_Charge" (
+            account_id,
+            charge_date,
+            balance,
+            interest,
+            fee
+        ) VALUES (
+            acc.id,
+            post_overdraft_charges.charge_date,
+            acc.balance,
+            interest,
+            acc.overdraft_daily_fee
+        ) ON CONFLICT DO NOTHING;
+
+        IF NOT FOUND THEN
+            CONTINUE;
+        END IF;
+
+        IF interest > 0 THEN
+            UPDATE "BK_Account"
+            SET balance = balance - interest
+            WHERE id = acc.id
+            RETURNING balance INTO new_balance;
+
+            INSERT INTO "BK_Transaction" (
+                account_from,
+                amount,
+                balance_after,
+                tx_type,
+                detail
+            ) VALUES (
+                acc.id,
+                interest,
+                new_balance,
+                'INTEREST',
+                'Overdraft interest ' || post_overdraft_charges.charge_date
+            );
+        END IF;
+
+        IF acc.overdraft_daily_fee > 0 THEN
+            UPDATE "BK_Account"
+            SET balance = balance - acc.overdraft_daily_fee
+            WHERE id = acc.id
+            RETURNING balance INTO new_balance;
+
+            INSERT INTO "BK_Transaction" (
+                account_from,
+                amount,
+                balance_after,
+                tx_type,
+                detail
+            ) VALUES (
+                acc.id,
+                acc.overdraft_daily_fee,
+                new_balance,
+                'FEE',
+                'Overdraft fee ' || post_overdraft_charges.charge_date
+            );
+        END IF;
+
+        RETURN NEXT acc.id;
+    END LOOP;
+
+    RETURN;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,169 @@
+DROP FUNCTION IF EXISTS fx_transfer_between_accounts(BIGINT, BIGINT, NUMERIC, VARCHAR, TEXT);
+
+DROP TABLE IF EXISTS "BK_FX_Transfer";
+DROP TABLE IF EXISTS "BK_FX_Quote";
+DROP TABLE IF EXISTS "BK_FX_Rate";
+
+-- Transfer from one account to another, only from the available balance including
+-- the overdraft limit
+CREATE OR REPLACE FUNCTION transfer_between_accounts(
+    from_account_id BIGINT, 
+    to_account_id BIGINT, 
+    amount NUMERIC(20, 2), 
+    tx_detail TEXT
+) RETURNS TABLE (
+    new_balance_from NUMERIC(100, 2),
+    transaction_id BIGINT
+) AS $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account" 
+        WHERE id IN (from_account_id, to_account_id) 
+        AND status = 'ACTIVE'
+        HAVING COUNT(DISTINCT id) = 2
+    ) THEN
+        IF NOT EXISTS (
+            SELECT 1 FROM "BK_Account" 
+            WHERE id = from_account_id AND status = 'ACTIVE'
+        ) THEN
+            RAISE EXCEPTION 'Account % not active', from_account_id USING ERRCODE = 'P0001';
+        END IF;
+        RAISE EXCEPTION 'Account % not active', to_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF from_account_id = to_account_id THEN
+        RAISE EXCEPTION 'Cannot transfer to the same account %', from_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF amount <= 0 THEN
+        RAISE EXCEPTION 'Amount must be positive, got %', amount USING ERRCODE = 'P0001';
+    END IF;
+
+    -- Lock both rows in id order so concurrent opposite transfers cannot deadlock
+    PERFORM 1 FROM "BK_Account"
+    WHERE id IN (from_account_id, to_account_id)
+    ORDER BY id
+    FOR UPDATE;
+
+    UPDATE "BK_Account"
+    SET balance = balance - amount
+    WHERE id = from_account_id 
+        AND balance + overdraft_limit - held_balance >= amount
+    RETURNING balance INTO new_balance_from;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Insufficient funds for account %', from_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET balance = balance + amount
+    WHERE id = to_account_id;
+
+    INSERT INTO "BK_Transaction" (
+        account_from, 
+        account_to, 
+        amount, 
+        balance_after, 
+        tx_type, 
+        detail
+    ) VALUES (
+        from_account_id, 
+        to_account_id, 
+        amount, 
+        new_balance_from, 
+        'TRANSFER', 
+        tx_detail
+    ) RETURNING id INTO transaction_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Settle capture_amount of an active hold as a WITHDRAW, or as a TRANSFER when
+-- to_account_id is not NULL. The rest of the hold is released.
+CREATE OR REPLACE FUNCTION capture_hold(
+    input_account_id BIGINT,
+    input_hold_id BIGINT,
+    capture_amount NUMERIC(20, 2),
+    to_account_id BIGINT
+) RETURNS TABLE (
+    new_balance NUMERIC(100, 2),
+    transaction_id BIGINT
+) AS $$
+DECLARE
+    hold "BK_Account_Hold"%ROWTYPE;
+BEGIN
+    SELECT * INTO hold FROM "BK_Account_Hold"
+    WHERE id = input_hold_id
+        AND account_id = input_account_id
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Hold % not found', input_hold_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF hold.status <> 'ACTIVE' OR hold.expires_at <= NOW() THEN
+        RAISE EXCEPTION 'Hold % is not active', input_hold_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF capture_amount <= 0 OR capture_amount > hold.amount THEN
+        RAISE EXCEPTION 'Capture amount % must be positive and at most %', capture_amount, hold.amount
+            USING ERRCODE = 'P0001';
+    END IF;
+
+    IF to_account_id = input_account_id THEN
+        RAISE EXCEPTION 'Cannot transfer to the same account %', input_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF (
+        SELECT COUNT(*) FROM "BK_Account"
+        WHERE id IN (input_account_id, to_account_id)
+            AND status = 'ACTIVE'
+    ) <> CASE WHEN to_account_id IS NULL THEN 1 ELSE 2 END THEN
+        RAISE EXCEPTION 'Account % not active', COALESCE(to_account_id, input_account_id) USING ERRCODE = 'P0001';
+    END IF;
+
+    PERFORM 1 FROM "BK_Account"
+    WHERE id IN (input_account_id, to_account_id)
+    ORDER BY id
+    FOR UPDATE;
+
+    -- balance >= held_balance before and capture_amount <= hold.amount, so
+    -- the constraint on held_balance still holds afterwards
+    UPDATE "BK_Account"
+    SET balance = balance - capture_amount,
+        held_balance = held_balance - hold.amount
+    WHERE id = input_account_id
+    RETURNING balance INTO new_balance;
+
+    IF to_account_id IS NOT NULL THEN
+        UPDATE "BK_Account"
+        SET balance = balance + capture_amount
+        WHERE id = to_account_id;
+    END IF;
+
+    INSERT INTO "BK_Transaction" (
+        account_from,
+        account_to,
+        amount,
+        balance_after,
+        tx_type,
+        detail
+    ) VALUES (
+        input_account_id,
+        to_account_id,
+        capture_amount,
+        new_balance,
+        CASE WHEN to_account_id IS NULL THEN 'WITHDRAW' ELSE 'TRANSFER' END::TX_TYPE,
+        hold.detail
+    ) RETURNING id INTO transaction_id;
+
+    UPDATE "BK_Account_Hold"
+    SET status = 'CAPTURED',
+        captured_amount = capture_amount,
+        transaction_id = capture_hold.transaction_id
+    WHERE id = input_hold_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,384 @@
+-- Exchange rates for the database rate provider: one unit of base_currency
+-- buys rate units of quote_currency. Inverse and cross rates are derived.
+CREATE TABLE IF NOT EXISTS "BK_FX_Rate" (
+    base_currency VARCHAR(3) NOT NULL,
+    quote_currency VARCHAR(3) NOT NULL,
+    rate NUMERIC(20, 10) NOT NULL,
+    source TEXT NOT NULL DEFAULT 'manual',
+    as_of TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (base_currency, quote_currency),
+    CONSTRAINT positive_rate
+        CHECK (rate > 0)
+);
+
+-- A quote locks a customer rate, the mid rate less the spread, until
+-- expires_at. Each quote can be used for one transfer.
+CREATE TABLE IF NOT EXISTS "BK_FX_Quote" (
+    id VARCHAR(32) PRIMARY KEY,
+    from_currency VARCHAR(3) NOT NULL,
+    to_currency VARCHAR(3) NOT NULL,
+    mid_rate NUMERIC(20, 10) NOT NULL,
+    rate NUMERIC(20, 10) NOT NULL,
+    spread_bps INTEGER NOT NULL,
+    source TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    transaction_id BIGINT,
+
+    FOREIGN KEY (transaction_id)
+        REFERENCES "BK_Transaction"(id),
+    CONSTRAINT positive_quote_rate
+        CHECK (mid_rate > 0 AND rate > 0),
+    CONSTRAINT valid_spread
+        CHECK (spread_bps BETWEEN 0 AND 10000)
+);
+
+CREATE INDEX idx_bk_fx_quote_expires_at ON "BK_FX_Quote" (expires_at);
+
+-- The conversion behind a TRANSFER between accounts in different currencies.
+-- The transaction's amount is in the sender's currency, converted_amount is
+-- what the recipient was credited.
+CREATE TABLE IF NOT EXISTS "BK_FX_Transfer" (
+    transaction_id BIGINT PRIMARY KEY,
+    quote_id VARCHAR(32) NOT NULL,
+    from_currency VARCHAR(3) NOT NULL,
+    to_currency VARCHAR(3) NOT NULL,
+    amount NUMERIC(100, 2) NOT NULL,
+    converted_amount NUMERIC(100, 2) NOT NULL,
+    mid_rate NUMERIC(20, 10) NOT NULL,
+    rate NUMERIC(20, 10) NOT NULL,
+    spread_bps INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (transaction_id)
+        REFERENCES "BK_Transaction"(id) ON DELETE CASCADE,
+    FOREIGN KEY (quote_id)
+        REFERENCES "BK_FX_Quote"(id)
+);
+
+ALTER TABLE "BK_FX_Transfer" ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "BK_FX_Transfer_select_policy"
+ON "BK_FX_Transfer"
+FOR SELECT
+USING (
+    EXISTS (
+        SELECT 1 FROM v_user_transactions t
+        WHERE t.id = "BK_FX_Transfer".transaction_id
+            AND t.user_id = current_setting('app.current_user_id')::BIGINT
+    )
+);
+
+-- Transfer from one account to another in the same currency, only from the
+-- available balance including the overdraft limit
+CREATE OR REPLACE FUNCTION transfer_between_accounts(
+    from_account_id BIGINT, 
+    to_account_id BIGINT, 
+    amount NUMERIC(20, 2), 
+    tx_detail TEXT
+) RETURNS TABLE (
+    new_balance_from NUMERIC(100, 2),
+    transaction_id BIGINT
+) AS $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account" 
+        WHERE id IN (from_account_id, to_account_id) 
+        AND status = 'ACTIVE'
+        HAVING COUNT(DISTINCT id) = 2
+    ) THEN
+        IF NOT EXISTS (
+            SELECT 1 FROM "BK_Account" 
+            WHERE id = from_account_id AND status = 'ACTIVE'
+        ) THEN
+            RAISE EXCEPTION 'Account % not active', from_account_id USING ERRCODE = 'P0001';
+        END IF;
+        RAISE EXCEPTION 'Account % not active', to_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF from_account_id = to_account_id THEN
+        RAISE EXCEPTION 'Cannot transfer to the same account %', from_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF (
+        SELECT COUNT(DISTINCT currency_code) FROM "BK_Account"
+        WHERE id IN (from_account_id, to_account_id)
+    ) > 1 THEN
+        RAISE EXCEPTION 'Accounts % and % use different currencies', from_account_id, to_account_id
+            USING ERRCODE = 'P0001';
+    END IF;
+
+    IF amount <= 0 THEN
+        RAISE EXCEPTION 'Amount must be positive, got %', amount USING ERRCODE = 'P0001';
+    END IF;
+
+    -- Lock both rows in id order so concurrent opposite transfers cannot deadlock
+    PERFORM 1 FROM "BK_Account"
+    WHERE id IN (from_account_id, to_account_id)
+    ORDER BY id
+    FOR UPDATE;
+
+    UPDATE "BK_Account"
+    SET balance = balance - amount
+    WHERE id = from_account_id 
+        AND balance + overdraft_limit - held_balance >= amount
+    RETURNING balance INTO new_balance_from;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Insufficient funds for account %', from_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET balance = balance + amount
+    WHERE id = to_account_id;
+
+    INSERT INTO "BK_Transaction" (
+        account_from, 
+        account_to, 
+        amount, 
+        balance_after, 
+        tx_type, 
+        detail
+    ) VALUES (
+        from_account_id, 
+        to_account_id, 
+        amount, 
+        new_balance_from, 
+        'TRANSFER', 
+        tx_detail
+    ) RETURNING id INTO transaction_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Settle capture_amount of an active hold as a WITHDRAW, or as a TRANSFER when
+-- to_account_id is not NULL. The rest of the hold is released. Both accounts
+-- must use the same currency.
+CREATE OR REPLACE FUNCTION capture_hold(
+    input_account_id BIGINT,
+    input_hold_id BIGINT,
+    capture_amount NUMERIC(20, 2),
+    to_account_id BIGINT
+) RETURNS TABLE (
+    new_balance NUMERIC(100, 2),
+    transaction_id BIGINT
+) AS $$
+DECLARE
+    hold "BK_Account_Hold"%ROWTYPE;
+BEGIN
+    SELECT * INTO hold FROM "BK_Account_Hold"
+    WHERE id = input_hold_id
+        AND account_id = input_account_id
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Hold % not found', input_hold_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF hold.status <> 'ACTIVE' OR hold.expires_at <= NOW() THEN
+        RAISE EXCEPTION 'Hold % is not active', input_hold_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF capture_amount <= 0 OR capture_amount > hold.amount THEN
+        RAISE EXCEPTION 'Capture amount % must be positive and at most %', capture_amount, hold.amount
+            USING ERRCODE = 'P0001';
+    END IF;
+
+    IF to_account_id = input_account_id THEN
+        RAISE EXCEPTION 'Cannot transfer to the same account %', input_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF (
+        SELECT COUNT(DISTINCT currency_code) FROM "BK_Account"
+        WHERE id IN (input_account_id, to_account_id)
+    ) > 1 THEN
+        RAISE EXCEPTION 'Accounts % and % use different currencies', input_account_id, to_account_id
+            USING ERRCODE = 'P0001';
+    END IF;
+
+    IF (
+        SELECT COUNT(*) FROM "BK_Account"
+        WHERE id IN (input_account_id, to_account_id)
+            AND status = 'ACTIVE'
+    ) <> CASE WHEN to_account_id IS NULL THEN 1 ELSE 2 END THEN
+        RAISE EXCEPTION 'Account % not active', COALESCE(to_account_id, input_account_id) USING ERRCODE = 'P0001';
+    END IF;
+
+    PERFORM 1 FROM "BK_Account"
+    WHERE id IN (input_account_id, to_account_id)
+    ORDER BY id
+    FOR UPDATE;
+
+    -- balance >= held_balance before and capture_amount <= hold.amount, so
+    -- the constraint on held_balance still holds afterwards
+    UPDATE "BK_Account"
+    SET balance = balance - capture_amount,
+        held_balance = held_balance - hold.amount
+    WHERE id = input_account_id
+    RETURNING balance INTO new_balance;
+
+    IF to_account_id IS NOT NULL THEN
+        UPDATE "BK_Account"
+        SET balance = balance + capture_amount
+        WHERE id = to_account_id;
+    END IF;
+
+    INSERT INTO "BK_Transaction" (
+        account_from,
+        account_to,
+        amount,
+        balance_after,
+        tx_type,
+        detail
+    ) VALUES (
+        input_account_id,
+        to_account_id,
+        capture_amount,
+        new_balance,
+        CASE WHEN to_account_id IS NULL THEN 'WITHDRAW' ELSE 'TRANSFER' END::TX_TYPE,
+        hold.detail
+    ) RETURNING id INTO transaction_id;
+
+    UPDATE "BK_Account_Hold"
+    SET status = 'CAPTURED',
+        captured_amount = capture_amount,
+        transaction_id = capture_hold.transaction_id
+    WHERE id = input_hold_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Transfer between accounts in different currencies at the rate of a quote.
+-- The quote must match both currencies, be unexpired and unused.
+CREATE OR REPLACE FUNCTION fx_transfer_between_accounts(
+    from_account_id BIGINT,
+    to_account_id BIGINT,
+    amount NUMERIC(20, 2),
+    input_quote_id VARCHAR(32),
+    tx_detail TEXT
+) RETURNS TABLE (
+    new_balance_from NUMERIC(100, 2),
+    transaction_id BIGINT,
+    converted_amount NUMERIC(100, 2)
+) AS $$
+DECLARE
+    quote "BK_FX_Quote"%ROWTYPE;
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account"
+        WHERE id IN (from_account_id, to_account_id)
+        AND status = 'ACTIVE'
+        HAVING COUNT(DISTINCT id) = 2
+    ) THEN
+        IF NOT EXISTS (
+            SELECT 1 FROM "BK_Account"
+            WHERE id = from_account_id AND status = 'ACTIVE'
+        ) THEN
+            RAISE EXCEPTION 'Account % not active', from_account_id USING ERRCODE = 'P0001';
+        END IF;
+        RAISE EXCEPTION 'Account % not active', to_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF amount <= 0 THEN
+        RAISE EXCEPTION 'Amount must be positive, got %', amount USING ERRCODE = 'P0001';
+    END IF;
+
+    SELECT * INTO quote FROM "BK_FX_Quote"
+    WHERE id = input_quote_id
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Quote % not found', input_quote_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF quote.used_at IS NOT NULL OR quote.expires_at <= NOW() THEN
+        RAISE EXCEPTION 'Quote % expired', input_quote_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account" f, "BK_Account" t
+        WHERE f.id = from_account_id
+            AND t.id = to_account_id
+            AND f.currency_code = quote.from_currency
+            AND t.currency_code = quote.to_currency
+    ) THEN
+        RAISE EXCEPTION 'Quote % does not convert between the currencies of accounts % and %',
+            input_quote_id, from_account_id, to_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    converted_amount := ROUND(amount * quote.rate, 2);
+
+    IF converted_amount <= 0 THEN
+        RAISE EXCEPTION 'Amount % is too small to convert', amount USING ERRCODE = 'P0001';
+    END IF;
+
+    -- Lock both rows in id order so concurrent opposite transfers cannot deadlock
+    PERFORM 1 FROM "BK_Account"
+    WHERE id IN (from_account_id, to_account_id)
+    ORDER BY id
+    FOR UPDATE;
+
+    UPDATE "BK_Account"
+    SET balance = balance - amount
+    WHERE id = from_account_id
+        AND balance + overdraft_limit - held_balance >= amount
+    RETURNING balance INTO new_balance_from;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Insufficient funds for account %', from_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET balance = balance + converted_amount
+    WHERE id = to_account_id;
+
+    INSERT INTO "BK_Transaction" (
+        account_from,
+        account_to,
+        amount,
+        balance_after,
+        tx_type,
+        detail
+    ) VALUES (
+        from_account_id,
+        to_account_id,
+        amount,
+        new_balance_from,
+        'TRANSFER',
+        tx_detail
+    ) RETURNING id INTO transaction_id;
+
+    INSERT INTO "BK_FX_Transfer" (
+        transaction_id,
+        quote_id,
+        from_currency,
+        to_currency,
+        amount,
+        converted_amount,
+        mid_rate,
+        rate,
+        spread_bps
+    ) VALUES (
+        fx_transfer_between_accounts.transaction_id,
+        quote.id,
+        quote.from_currency,
+        quote.to_currency,
+        amount,
+        fx_transfer_between_accounts.converted_amount,
+        quote.mid_rate,
+        quote.rate,
+        quote.spread_bps
+    );
+
+    UPDATE "BK_FX_Quote"
+    SET used_at = NOW(),
+        transaction_id = fx_transfer_between_accounts.transaction_id
+    WHERE id = input_quote_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
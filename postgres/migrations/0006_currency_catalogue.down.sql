@@ -0,0 +1,309 @@
+DROP POLICY "BK_FX_Transfer_select_policy" ON "BK_FX_Transfer";
+DROP VIEW v_user_transactions;
+
+-- Amounts with more than 2 decimal places are rounded.
+ALTER TABLE "BK_Account"
+    ALTER COLUMN balance TYPE NUMERIC(100, 2),
+    ALTER COLUMN held_balance TYPE NUMERIC(100, 2),
+    ALTER COLUMN overdraft_limit TYPE NUMERIC(100, 2),
+    ALTER COLUMN overdraft_daily_fee TYPE NUMERIC(100, 2);
+
+ALTER TABLE "BK_Transaction"
+    ALTER COLUMN amount TYPE NUMERIC(20, 2),
+    ALTER COLUMN balance_after TYPE NUMERIC(100, 2);
+
+ALTER TABLE "BK_Account_Hold"
+    ALTER COLUMN amount TYPE NUMERIC(100, 2),
+    ALTER COLUMN captured_amount TYPE NUMERIC(100, 2);
+
+ALTER TABLE "BK_Overdraft_Charge"
+    ALTER COLUMN balance TYPE NUMERIC(100, 2),
+    ALTER COLUMN interest TYPE NUMERIC(100, 2),
+    ALTER COLUMN fee TYPE NUMERIC(100, 2);
+
+ALTER TABLE "BK_FX_Transfer"
+    ALTER COLUMN amount TYPE NUMERIC(100, 2),
+    ALTER COLUMN converted_amount TYPE NUMERIC(100, 2);
+
+CREATE OR REPLACE VIEW v_user_transactions AS
+SELECT 
+    t.*,
+    a.user_id
+FROM "BK_Transaction" t
+JOIN "BK_Account" a 
+    ON t.account_from = a.id OR t.account_to = a.id;
+
+CREATE POLICY "BK_FX_Transfer_select_policy"
+ON "BK_FX_Transfer"
+FOR SELECT
+USING (
+    EXISTS (
+        SELECT 1 FROM v_user_transactions t
+        WHERE t.id = "BK_FX_Transfer".transaction_id
+            AND t.user_id = current_setting('app.current_user_id')::BIGINT
+    )
+);
+
+-- Give the whole amount of an active hold back to the available balance
+CREATE OR REPLACE FUNCTION release_hold(
+    input_account_id BIGINT,
+    input_hold_id BIGINT
+) RETURNS NUMERIC(100, 2) AS $$
+DECLARE
+    hold "BK_Account_Hold"%ROWTYPE;
+    new_available NUMERIC(100, 2);
+BEGIN
+    SELECT * INTO hold FROM "BK_Account_Hold"
+    WHERE id = input_hold_id
+        AND account_id = input_account_id
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Hold % not found', input_hold_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF hold.status <> 'ACTIVE' THEN
+        RAISE EXCEPTION 'Hold % is not active', input_hold_id USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET held_balance = held_balance - hold.amount
+    WHERE id = input_account_id
+    RETURNING balance + overdraft_limit - held_balance INTO new_available;
+
+    UPDATE "BK_Account_Hold"
+    SET status = 'RELEASED'
+    WHERE id = input_hold_id;
+
+    RETURN new_available;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Post interest and the daily fee on every overdrawn account that was not
+-- charged for charge_date yet, and return the ids of the charged accounts.
+-- Accounts locked by a concurrent operation are left for the next run.
+CREATE OR REPLACE FUNCTION post_overdraft_charges(
+    charge_date DATE
+) RETURNS SETOF BIGINT AS $$
+DECLARE
+    acc RECORD;
+    interest NUMERIC(100, 2);
+    new_balance NUMERIC(100, 2);
+BEGIN
+    FOR acc IN
+        SELECT id, balance, overdraft_interest_rate, overdraft_daily_fee FROM "BK_Account"
+        WHERE balance < 0
+            AND status <> 'CLOSED'
+        ORDER BY id
+        FOR UPDATE SKIP LOCKED
+    LOOP
+        interest := ROUND(-acc.balance * acc.overdraft_interest_rate / 365, 2);
+
+        INSERT INTO "BK_Overdraft_Charge" (
+            account_id,
+            charge_date,
+            balance,
+            interest,
+            fee
+        ) VALUES (
+            acc.id,
+            post_overdraft_charges.charge_date,
+            acc.balance,
+            interest,
+            acc.overdraft_daily_fee
+        ) ON CONFLICT DO NOTHING;
+
+        IF NOT FOUND THEN
+            CONTINUE;
+        END IF;
+
+        IF interest > 0 THEN
+            UPDATE "BK_Account"
+            SET balance = balance - interest
+            WHERE id = acc.id
+            RETURNING balance INTO new_balance;
+
+            INSERT INTO "BK_Transaction" (
+                account_from,
+                amount,
+                balance_after,
+                tx_type,
+                detail
+            ) VALUES (
+                acc.id,
+                interest,
+                new_balance,
+                'INTEREST',
+                'Overdraft interest ' || post_overdraft_charges.charge_date
+            );
+        END IF;
+
+        IF acc.overdraft_daily_fee > 0 THEN
+            UPDATE "BK_Account"
+            SET balance = balance - acc.overdraft_daily_fee
+            WHERE id = acc.id
+            RETURNING balance INTO new_balance;
+
+            INSERT INTO "BK_Transaction" (
+                account_from,
+                amount,
+                balance_after,
+                tx_type,
+                detail
+            ) VALUES (
+                acc.id,
+                acc.overdraft_daily_fee,
+                new_balance,
+                'FEE',
+                'Overdraft fee ' || post_overdraft_charges.charge_date
+            );
+        END IF;
+
+        RETURN NEXT acc.id;
+    END LOOP;
+
+    RETURN;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Transfer between accounts in different currencies at the rate of a quote.
+-- The quote must match both currencies, be unexpired and unused.
+CREATE OR REPLACE FUNCTION fx_transfer_between_accounts(
+    from_account_id BIGINT,
+    to_account_id BIGINT,
+    amount NUMERIC(20, 2),
+    input_quote_id VARCHAR(32),
+    tx_detail TEXT
+) RETURNS TABLE (
+    new_balance_from NUMERIC(100, 2),
+    transaction_id BIGINT,
+    converted_amount NUMERIC(100, 2)
+) AS $$
+DECLARE
+    quote "BK_FX_Quote"%ROWTYPE;
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account"
+        WHERE id IN (from_account_id, to_account_id)
+        AND status = 'ACTIVE'
+        HAVING COUNT(DISTINCT id) = 2
+    ) THEN
+        IF NOT EXISTS (
+            SELECT 1 FROM "BK_Account"
+            WHERE id = from_account_id AND status = 'ACTIVE'
+        ) THEN
+            RAISE EXCEPTION 'Account % not active', from_account_id USING ERRCODE = 'P0001';
+        END IF;
+        RAISE EXCEPTION 'Account % not active', to_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF amount <= 0 THEN
+        RAISE EXCEPTION 'Amount must be positive, got %', amount USING ERRCODE = 'P0001';
+    END IF;
+
+    SELECT * INTO quote FROM "BK_FX_Quote"
+    WHERE id = input_quote_id
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Quote % not found', input_quote_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF quote.used_at IS NOT NULL OR quote.expires_at <= NOW() THEN
+        RAISE EXCEPTION 'Quote % expired', input_quote_id USING ERRCODE = 'P0001';
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1 FROM "BK_Account" f, "BK_Account" t
+        WHERE f.id = from_account_id
+            AND t.id = to_account_id
+            AND f.currency_code = quote.from_currency
+            AND t.currency_code = quote.to_currency
+    ) THEN
+        RAISE EXCEPTION 'Quote % does not convert between the currencies of accounts % and %',
+            input_quote_id, from_account_id, to_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    converted_amount := ROUND(amount * quote.rate, 2);
+
+    IF converted_amount <= 0 THEN
+        RAISE EXCEPTION 'Amount % is too small to convert', amount USING ERRCODE = 'P0001';
+    END IF;
+
+    -- Lock both rows in id order so concurrent opposite transfers cannot deadlock
+    PERFORM 1 FROM "BK_Account"
+    WHERE id IN (from_account_id, to_account_id)
+    ORDER BY id
+    FOR UPDATE;
+
+    UPDATE "BK_Account"
+    SET balance = balance - amount
+    WHERE id = from_account_id
+        AND balance + overdraft_limit - held_balance >= amount
+    RETURNING balance INTO new_balance_from;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Insufficient funds for account %', from_account_id USING ERRCODE = 'P0001';
+    END IF;
+
+    UPDATE "BK_Account"
+    SET balance = balance + converted_amount
+    WHERE id = to_account_id;
+
+    INSERT INTO "BK_Transaction" (
+        account_from,
+        account_to,
+        amount,
+        balance_after,
+        tx_type,
+        detail
+    ) VALUES (
+        from_account_id,
+        to_account_id,
+        amount,
+        new_balance_from,
+        'TRANSFER',
+        tx_detail
+    ) RETURNING id INTO transaction_id;
+
+    INSERT INTO "BK_FX_Transfer" (
+        transaction_id,
+        quote_id,
+        from_currency,
+        to_currency,
+        amount,
+        converted_amount,
+        mid_rate,
+        rate,
+        spread_bps
+    ) VALUES (
+        fx_transfer_between_accounts.transaction_id,
+        quote.id,
+        quote.from_currency,
+        quote.to_currency,
+        amount,
+        fx_transfer_between_accounts.converted_amount,
+        quote.mid_rate,
+        quote.rate,
+        quote.spread_bps
+    );
+
+    UPDATE "BK_FX_Quote"
+    SET used_at = NOW(),
+        transaction_id = fx_transfer_between_accounts.transaction_id
+    WHERE id = input_quote_id;
+
+    RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trig_bk_account_currency ON "BK_Account";
+DROP FUNCTION IF EXISTS check_currency_enabled();
+
+-- Fails while accounts use a currency other than USD, EUR and TWD.
+ALTER TABLE "BK_Account"
+    DROP CONSTRAINT fk_bk_account_currency,
+    ADD CONSTRAINT valid_currency_code
+        CHECK (currency_code IN ('USD', 'EUR', 'TWD'));
+
+DROP TABLE IF EXISTS "BK_Currency";
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS "BK_Standing_Order_Execution";
+DROP TABLE IF EXISTS "BK_Standing_Order";
+DROP TYPE IF EXISTS STANDING_ORDER_EXECUTION_STATUS;
+DROP TYPE IF EXISTS STANDING_ORDER_STATUS;
@@ -0,0 +1,132 @@
+-- Standing orders transfer a fixed amount on a schedule, a cron expression or
+-- an RRULE. The application evaluates the schedule: scheduled_at is the
+-- occurrence being paid and next_run_at when to try it, later than
+-- scheduled_at while failed attempts are retried. Both are NULL once the
+-- order is finished.
+CREATE TYPE STANDING_ORDER_STATUS AS ENUM (
+    'ACTIVE',
+    'PAUSED',
+    'CANCELLED',
+    'COMPLETED'
+);
+
+CREATE TYPE STANDING_ORDER_EXECUTION_STATUS AS ENUM (
+    'SUCCEEDED',
+    'RETRYING',
+    'FAILED'
+);
+
+CREATE TABLE IF NOT EXISTS "BK_Standing_Order" (
+    id BIGSERIAL PRIMARY KEY,
+    from_account_id BIGINT NOT NULL,
+    to_account_id BIGINT NOT NULL,
+    amount NUMERIC(100, 4) NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    schedule VARCHAR(256) NOT NULL,
+    -- The time zone the schedule is evaluated in.
+    time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    status STANDING_ORDER_STATUS NOT NULL DEFAULT 'ACTIVE',
+    start_at TIMESTAMPTZ NOT NULL,
+    end_at TIMESTAMPTZ,
+    max_occurrences INTEGER,
+    -- Occurrences that were paid or given up on.
+    occurrences INTEGER NOT NULL DEFAULT 0,
+    -- Failed attempts at the current occurrence.
+    attempts INTEGER NOT NULL DEFAULT 0,
+    scheduled_at TIMESTAMPTZ,
+    next_run_at TIMESTAMPTZ,
+    -- Set while an instance executes the order, so others skip it.
+    claimed_until TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (from_account_id)
+        REFERENCES "BK_Account"(id) ON DELETE CASCADE,
+    FOREIGN KEY (to_account_id)
+        REFERENCES "BK_Account"(id) ON DELETE CASCADE,
+    CONSTRAINT positive_standing_order_amount
+        CHECK (amount > 0),
+    CONSTRAINT different_standing_order_accounts
+        CHECK (from_account_id <> to_account_id),
+    CONSTRAINT positive_max_occurrences
+        CHECK (max_occurrences > 0),
+    CONSTRAINT valid_standing_order_period
+        CHECK (end_at IS NULL OR end_at > start_at)
+);
+
+CREATE INDEX idx_bk_standing_order_from_account_id ON "BK_Standing_Order" (from_account_id);
+CREATE INDEX idx_bk_standing_order_next_run_at ON "BK_Standing_Order" (next_run_at)
+    WHERE status = 'ACTIVE';
+
+CREATE TABLE IF NOT EXISTS "BK_Standing_Order_Execution" (
+    id BIGSERIAL PRIMARY KEY,
+    standing_order_id BIGINT NOT NULL,
+    scheduled_at TIMESTAMPTZ NOT NULL,
+    attempt INTEGER NOT NULL,
+    status STANDING_ORDER_EXECUTION_STATUS NOT NULL,
+    transaction_id BIGINT,
+    error TEXT NOT NULL DEFAULT '',
+    executed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (standing_order_id)
+        REFERENCES "BK_Standing_Order"(id) ON DELETE CASCADE,
+    FOREIGN KEY (transaction_id)
+        REFERENCES "BK_Transaction"(id)
+);
+
+CREATE INDEX idx_bk_standing_order_execution_order_id
+    ON "BK_Standing_Order_Execution" (standing_order_id, executed_at);
+
+ALTER TABLE "BK_Standing_Order" ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "BK_Standing_Order_select_policy"
+ON "BK_Standing_Order"
+FOR SELECT
+USING (
+    EXISTS (
+        SELECT 1 FROM "BK_Account"
+        WHERE id = from_account_id
+            AND user_id = current_setting('app.current_user_id')::BIGINT
+    )
+);
+
+CREATE POLICY "BK_Standing_Order_update_policy"
+ON "BK_Standing_Order"
+FOR UPDATE
+USING (
+    EXISTS (
+        SELECT 1 FROM "BK_Account"
+        WHERE id = from_account_id
+            AND user_id = current_setting('app.current_user_id')::BIGINT
+    )
+);
+
+CREATE POLICY "BK_Standing_Order_delete_policy"
+ON "BK_Standing_Order"
+FOR DELETE
+USING (
+    EXISTS (
+        SELECT 1 FROM "BK_Account"
+        WHERE id = from_account_id
+            AND user_id = current_setting('app.current_user_id')::BIGINT
+    )
+);
+
+ALTER TABLE "BK_Standing_Order_Execution" ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "BK_Standing_Order_Execution_select_policy"
+ON "BK_Standing_Order_Execution"
+FOR SELECT
+USING (
+    EXISTS (
+        SELECT 1 FROM "BK_Standing_Order" so
+        JOIN "BK_Account" a ON a.id = so.from_account_id
+        WHERE so.id = standing_order_id
+            AND a.user_id = current_setting('app.current_user_id')::BIGINT
+    )
+);
+
+CREATE TRIGGER trig_bk_standing_order_update
+BEFORE UPDATE ON "BK_Standing_Order"
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at();
@@ -0,0 +1,55 @@
+-- Payees are the accounts a user saved to transfer to. A payee is verified
+-- once the user confirmed it with their second factor; until then, and for
+-- the cooling-off period after it was added, large transfers to it are
+-- refused by the application.
+CREATE TABLE IF NOT EXISTS "BK_Payee" (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    nickname VARCHAR(64) NOT NULL,
+    account_id BIGINT NOT NULL,
+    verified BOOLEAN NOT NULL DEFAULT FALSE,
+    verified_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id)
+        REFERENCES "BK_User"(id) ON DELETE CASCADE,
+    FOREIGN KEY (account_id)
+        REFERENCES "BK_Account"(id) ON DELETE CASCADE,
+    CONSTRAINT unique_payee_account
+        UNIQUE (user_id, account_id),
+    CONSTRAINT unique_payee_nickname
+        UNIQUE (user_id, nickname),
+    CONSTRAINT verified_payee_has_verified_at
+        CHECK (NOT verified OR verified_at IS NOT NULL)
+);
+
+CREATE INDEX idx_bk_payee_account_id ON "BK_Payee" (account_id);
+
+ALTER TABLE "BK_Payee" ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "BK_Payee_select_policy"
+ON "BK_Payee"
+FOR SELECT
+USING (
+    user_id = current_setting('app.current_user_id')::BIGINT
+);
+
+CREATE POLICY "BK_Payee_update_policy"
+ON "BK_Payee"
+FOR UPDATE
+USING (
+    user_id = current_setting('app.current_user_id')::BIGINT
+);
+
+CREATE POLICY "BK_Payee_delete_policy"
+ON "BK_Payee"
+FOR DELETE
+USING (
+    user_id = current_setting('app.current_user_id')::BIGINT
+);
+
+CREATE TRIGGER trig_bk_payee_update
+BEFORE UPDATE ON "BK_Payee"
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at();
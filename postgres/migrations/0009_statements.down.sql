@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_bk_transaction_account_to_created_at;
+DROP INDEX IF EXISTS idx_bk_transaction_account_from_created_at;
+DROP TABLE IF EXISTS "BK_Statement";
@@ -0,0 +1,39 @@
+-- Statements of an account over [period_start, period_end). The application
+-- computes them from "BK_Transaction" and stores the result in data, so that a
+-- statement downloaded later shows what was issued.
+CREATE TABLE IF NOT EXISTS "BK_Statement" (
+    id BIGSERIAL PRIMARY KEY,
+    account_id BIGINT NOT NULL,
+    period_start TIMESTAMPTZ NOT NULL,
+    period_end TIMESTAMPTZ NOT NULL,
+    opening_balance NUMERIC(100, 4) NOT NULL,
+    closing_balance NUMERIC(100, 4) NOT NULL,
+    data JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (account_id)
+        REFERENCES "BK_Account"(id) ON DELETE CASCADE,
+    CONSTRAINT unique_statement_period
+        UNIQUE (account_id, period_start, period_end),
+    CONSTRAINT valid_statement_period
+        CHECK (period_end > period_start)
+);
+
+-- Statements read the transactions of an account by time.
+CREATE INDEX idx_bk_transaction_account_from_created_at
+    ON "BK_Transaction" (account_from, created_at);
+CREATE INDEX idx_bk_transaction_account_to_created_at
+    ON "BK_Transaction" (account_to, created_at);
+
+ALTER TABLE "BK_Statement" ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "BK_Statement_select_policy"
+ON "BK_Statement"
+FOR SELECT
+USING (
+    EXISTS (
+        SELECT 1 FROM "BK_Account"
+        WHERE id = account_id
+            AND user_id = current_setting('app.current_user_id')::BIGINT
+    )
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS "BK_Bulk_Payment_Line";
+DROP TABLE IF EXISTS "BK_Bulk_Payment";
+DROP TYPE IF EXISTS BULK_PAYMENT_LINE_STATUS;
+DROP TYPE IF EXISTS BULK_PAYMENT_STATUS;
+DROP TYPE IF EXISTS BULK_PAYMENT_MODE;
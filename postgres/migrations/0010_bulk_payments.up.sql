@@ -0,0 +1,112 @@
+-- Bulk payments are files of transfers from one account, uploaded as
+-- pain.001 or CSV and executed in the background. message_id identifies the
+-- file, the pain.001 MsgId or the SHA-256 of a CSV, so that the same file is
+-- not paid twice.
+CREATE TYPE BULK_PAYMENT_MODE AS ENUM (
+    'ALL_OR_NOTHING',
+    'BEST_EFFORT'
+);
+
+CREATE TYPE BULK_PAYMENT_STATUS AS ENUM (
+    'PENDING',
+    'PROCESSING',
+    'COMPLETED',
+    'PARTIALLY_COMPLETED',
+    'FAILED'
+);
+
+CREATE TYPE BULK_PAYMENT_LINE_STATUS AS ENUM (
+    'PENDING',
+    'SUCCEEDED',
+    'FAILED',
+    'REJECTED'
+);
+
+CREATE TABLE IF NOT EXISTS "BK_Bulk_Payment" (
+    id BIGSERIAL PRIMARY KEY,
+    account_id BIGINT NOT NULL,
+    message_id VARCHAR(64) NOT NULL,
+    format VARCHAR(16) NOT NULL,
+    mode BULK_PAYMENT_MODE NOT NULL,
+    status BULK_PAYMENT_STATUS NOT NULL DEFAULT 'PENDING',
+    line_count INTEGER NOT NULL,
+    total_amount NUMERIC(100, 4) NOT NULL,
+    succeeded_count INTEGER NOT NULL DEFAULT 0,
+    failed_count INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    -- Set while an instance executes the batch, so others skip it.
+    claimed_until TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ,
+
+    FOREIGN KEY (account_id)
+        REFERENCES "BK_Account"(id) ON DELETE CASCADE,
+    CONSTRAINT unique_bulk_payment_message
+        UNIQUE (account_id, message_id),
+    CONSTRAINT valid_bulk_payment_format
+        CHECK (format IN ('pain001', 'csv')),
+    CONSTRAINT positive_bulk_payment_line_count
+        CHECK (line_count > 0)
+);
+
+CREATE INDEX idx_bk_bulk_payment_pending ON "BK_Bulk_Payment" (created_at)
+    WHERE status IN ('PENDING', 'PROCESSING');
+
+-- Lines keep what the file said; to_account_id is NULL when the destination
+-- does not exist, and the line is REJECTED.
+CREATE TABLE IF NOT EXISTS "BK_Bulk_Payment_Line" (
+    id BIGSERIAL PRIMARY KEY,
+    bulk_payment_id BIGINT NOT NULL,
+    line_number INTEGER NOT NULL,
+    to_account VARCHAR(64) NOT NULL,
+    to_account_id BIGINT,
+    amount NUMERIC(100, 4) NOT NULL,
+    reference VARCHAR(140) NOT NULL DEFAULT '',
+    end_to_end_id VARCHAR(35) NOT NULL DEFAULT '',
+    status BULK_PAYMENT_LINE_STATUS NOT NULL DEFAULT 'PENDING',
+    error TEXT NOT NULL DEFAULT '',
+    transaction_id BIGINT,
+    executed_at TIMESTAMPTZ,
+
+    FOREIGN KEY (bulk_payment_id)
+        REFERENCES "BK_Bulk_Payment"(id) ON DELETE CASCADE,
+    FOREIGN KEY (to_account_id)
+        REFERENCES "BK_Account"(id),
+    FOREIGN KEY (transaction_id)
+        REFERENCES "BK_Transaction"(id),
+    CONSTRAINT unique_bulk_payment_line
+        UNIQUE (bulk_payment_id, line_number)
+);
+
+ALTER TABLE "BK_Bulk_Payment" ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "BK_Bulk_Payment_select_policy"
+ON "BK_Bulk_Payment"
+FOR SELECT
+USING (
+    EXISTS (
+        SELECT 1 FROM "BK_Account"
+        WHERE id = account_id
+            AND user_id = current_setting('app.current_user_id')::BIGINT
+    )
+);
+
+ALTER TABLE "BK_Bulk_Payment_Line" ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "BK_Bulk_Payment_Line_select_policy"
+ON "BK_Bulk_Payment_Line"
+FOR SELECT
+USING (
+    EXISTS (
+        SELECT 1 FROM "BK_Bulk_Payment" bp
+        JOIN "BK_Account" a ON a.id = bp.account_id
+        WHERE bp.id = bulk_payment_id
+            AND a.user_id = current_setting('app.current_user_id')::BIGINT
+    )
+);
+
+CREATE TRIGGER trig_bk_bulk_payment_update
+BEFORE UPDATE ON "BK_Bulk_Payment"
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at();
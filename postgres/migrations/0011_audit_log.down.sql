@@ -0,0 +1,12 @@
+DROP TRIGGER IF EXISTS trig_bk_bulk_payment_audit ON "BK_Bulk_Payment";
+DROP TRIGGER IF EXISTS trig_bk_payee_audit ON "BK_Payee";
+DROP TRIGGER IF EXISTS trig_bk_standing_order_audit ON "BK_Standing_Order";
+DROP TRIGGER IF EXISTS trig_bk_currency_audit ON "BK_Currency";
+DROP TRIGGER IF EXISTS trig_bk_account_hold_audit ON "BK_Account_Hold";
+DROP TRIGGER IF EXISTS trig_bk_transaction_audit ON "BK_Transaction";
+DROP TRIGGER IF EXISTS trig_bk_account_audit ON "BK_Account";
+DROP TRIGGER IF EXISTS trig_bk_user_totp_audit ON "BK_User_TOTP";
+DROP TRIGGER IF EXISTS trig_bk_user_audit ON "BK_User";
+DROP FUNCTION IF EXISTS audit_row_change();
+DROP TABLE IF EXISTS "BK_Audit_Log";
+DROP FUNCTION IF EXISTS protect_audit_log();
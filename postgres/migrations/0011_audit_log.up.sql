@@ -0,0 +1,170 @@
+-- Every change to the audited tables, written by triggers in the transaction
+-- that makes it. Entries are append-only; once the transaction that wrote an
+-- entry has ended, the application seals it into a hash chain: seq orders the
+-- chain and hash covers prev_hash and the entry.
+CREATE TABLE IF NOT EXISTS "BK_Audit_Log" (
+    id BIGSERIAL PRIMARY KEY,
+    xact_id XID8 NOT NULL DEFAULT pg_current_xact_id(),
+    actor TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL DEFAULT '',
+    operation VARCHAR(6) NOT NULL,
+    target_table VARCHAR(64) NOT NULL,
+    target_id TEXT NOT NULL,
+    -- The changed columns only, for updates.
+    before JSONB,
+    after JSONB,
+    request_id TEXT NOT NULL DEFAULT '',
+    client_ip TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    seq BIGINT UNIQUE,
+    prev_hash BYTEA,
+    hash BYTEA,
+
+    CONSTRAINT valid_audit_operation
+        CHECK (operation IN ('INSERT', 'UPDATE', 'DELETE')),
+    CONSTRAINT sealed_audit_entry
+        CHECK ((seq IS NULL) = (hash IS NULL))
+);
+
+CREATE INDEX idx_bk_audit_log_target ON "BK_Audit_Log" (target_table, target_id);
+CREATE INDEX idx_bk_audit_log_actor ON "BK_Audit_Log" (actor);
+CREATE INDEX idx_bk_audit_log_request_id ON "BK_Audit_Log" (request_id);
+CREATE INDEX idx_bk_audit_log_created_at ON "BK_Audit_Log" (created_at);
+CREATE INDEX idx_bk_audit_log_unsealed ON "BK_Audit_Log" (id)
+    WHERE seq IS NULL;
+
+-- No policy: only the owner reads the log.
+ALTER TABLE "BK_Audit_Log" ENABLE ROW LEVEL SECURITY;
+
+-- Entries never change, except to be sealed once.
+CREATE OR REPLACE FUNCTION protect_audit_log()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND OLD.seq IS NULL
+        AND to_jsonb(NEW) - '{seq,prev_hash,hash}'::TEXT[] = to_jsonb(OLD) - '{seq,prev_hash,hash}'::TEXT[] THEN
+        RETURN NEW;
+    END IF;
+
+    RAISE EXCEPTION '"BK_Audit_Log" is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trig_bk_audit_log_protect
+BEFORE UPDATE OR DELETE ON "BK_Audit_Log"
+FOR EACH ROW
+EXECUTE FUNCTION protect_audit_log();
+
+CREATE TRIGGER trig_bk_audit_log_truncate
+BEFORE TRUNCATE ON "BK_Audit_Log"
+FOR EACH STATEMENT
+EXECUTE FUNCTION protect_audit_log();
+
+-- Records a row change in "BK_Audit_Log". The arguments are the key column,
+-- the columns whose changes alone are not worth an entry and the columns
+-- whose values are replaced by "[redacted]". Who made the change is read from
+-- the app.audit_* settings of the session.
+CREATE OR REPLACE FUNCTION audit_row_change()
+RETURNS TRIGGER AS $$
+DECLARE
+    key_column TEXT := TG_ARGV[0];
+    ignored TEXT[] := TG_ARGV[1]::TEXT[];
+    redacted TEXT[] := TG_ARGV[2]::TEXT[];
+    old_row JSONB;
+    new_row JSONB;
+    target TEXT;
+    column_name TEXT;
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        old_row := to_jsonb(OLD);
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        new_row := to_jsonb(NEW);
+    END IF;
+    target := COALESCE(new_row, old_row) ->> key_column;
+
+    IF TG_OP = 'UPDATE' THEN
+        FOR column_name IN SELECT jsonb_object_keys(new_row) LOOP
+            IF column_name = ANY(ignored) OR old_row -> column_name = new_row -> column_name THEN
+                old_row := old_row - column_name;
+                new_row := new_row - column_name;
+            END IF;
+        END LOOP;
+
+        IF new_row = '{}'::JSONB THEN
+            RETURN NULL;
+        END IF;
+    END IF;
+
+    FOREACH column_name IN ARRAY redacted LOOP
+        IF old_row ? column_name THEN
+            old_row := jsonb_set(old_row, ARRAY[column_name], '"[redacted]"');
+        END IF;
+        IF new_row ? column_name THEN
+            new_row := jsonb_set(new_row, ARRAY[column_name], '"[redacted]"');
+        END IF;
+    END LOOP;
+
+    INSERT INTO "BK_Audit_Log" (
+        actor, action, operation, target_table, target_id, before, after, request_id, client_ip
+    ) VALUES (
+        COALESCE(current_setting('app.audit_actor', true), ''),
+        COALESCE(current_setting('app.audit_action', true), ''),
+        TG_OP,
+        TG_TABLE_NAME,
+        target,
+        old_row,
+        new_row,
+        COALESCE(current_setting('app.audit_request_id', true), ''),
+        COALESCE(current_setting('app.audit_client_ip', true), '')
+    );
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trig_bk_user_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_User"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('id', '{updated_at}', '{password}');
+
+CREATE TRIGGER trig_bk_user_totp_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_User_TOTP"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('user_id', '{updated_at}', '{secret,recovery_codes}');
+
+-- Balances change with every transaction, which is audited itself.
+CREATE TRIGGER trig_bk_account_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_Account"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('id', '{balance,held_balance,updated_at}', '{}');
+
+CREATE TRIGGER trig_bk_transaction_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_Transaction"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('id', '{}', '{}');
+
+CREATE TRIGGER trig_bk_account_hold_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_Account_Hold"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('id', '{updated_at}', '{}');
+
+CREATE TRIGGER trig_bk_currency_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_Currency"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('code', '{updated_at}', '{}');
+
+CREATE TRIGGER trig_bk_standing_order_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_Standing_Order"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('id', '{updated_at,claimed_until}', '{}');
+
+CREATE TRIGGER trig_bk_payee_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_Payee"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('id', '{updated_at}', '{}');
+
+CREATE TRIGGER trig_bk_bulk_payment_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_Bulk_Payment"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('id', '{updated_at,claimed_until}', '{}');
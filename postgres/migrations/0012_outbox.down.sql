@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS trig_bk_account_outbox ON "BK_Account";
+DROP TRIGGER IF EXISTS trig_bk_transaction_outbox ON "BK_Transaction";
+DROP FUNCTION IF EXISTS outbox_account_status_changed();
+DROP FUNCTION IF EXISTS outbox_transaction_recorded();
+DROP TABLE IF EXISTS "BK_Outbox";
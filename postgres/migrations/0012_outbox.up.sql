@@ -0,0 +1,110 @@
+-- Domain events, written by triggers when the transaction that causes them
+-- commits and relayed to Redis Streams by the application. Events of one
+-- account are numbered by id in the order their transactions committed,
+-- since those transactions lock the account row.
+CREATE TABLE IF NOT EXISTS "BK_Outbox" (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL UNIQUE DEFAULT gen_random_uuid(),
+    event_type VARCHAR(64) NOT NULL,
+    -- The version of the schema of payload for event_type.
+    version SMALLINT NOT NULL,
+    account_id BIGINT NOT NULL,
+    payload JSONB NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_bk_outbox_unpublished ON "BK_Outbox" (id)
+    WHERE published_at IS NULL;
+CREATE INDEX idx_bk_outbox_published_at ON "BK_Outbox" (published_at)
+    WHERE published_at IS NOT NULL;
+
+-- No policy: only the owner reads the outbox.
+ALTER TABLE "BK_Outbox" ENABLE ROW LEVEL SECURITY;
+
+-- Records a deposit, withdrawal, transfer, fee or interest charge. The trigger
+-- is deferred to the commit, by when the conversion of an FX transfer exists.
+CREATE OR REPLACE FUNCTION outbox_transaction_recorded()
+RETURNS TRIGGER AS $$
+DECLARE
+    from_account "BK_Account";
+    to_account "BK_Account";
+    fx "BK_FX_Transfer";
+BEGIN
+    SELECT * INTO from_account FROM "BK_Account" WHERE id = NEW.account_from;
+    IF NEW.account_to IS NOT NULL THEN
+        SELECT * INTO to_account FROM "BK_Account" WHERE id = NEW.account_to;
+        SELECT * INTO fx FROM "BK_FX_Transfer" WHERE transaction_id = NEW.id;
+    END IF;
+
+    INSERT INTO "BK_Outbox" (
+        event_type, version, account_id, payload, occurred_at
+    ) VALUES (
+        CASE NEW.tx_type
+            WHEN 'DEPOSIT' THEN 'deposit.completed'
+            WHEN 'WITHDRAW' THEN 'withdrawal.completed'
+            WHEN 'TRANSFER' THEN 'transfer.completed'
+            WHEN 'FEE' THEN 'fee.charged'
+            WHEN 'INTEREST' THEN 'interest.charged'
+            ELSE 'transaction.completed'
+        END,
+        1,
+        NEW.account_from,
+        jsonb_build_object(
+            'transaction_id', NEW.id,
+            'tx_type', NEW.tx_type,
+            'account_id', NEW.account_from,
+            'account_number', from_account.id_number,
+            'currency_code', from_account.currency_code,
+            'amount', NEW.amount,
+            'balance_after', NEW.balance_after,
+            'detail', COALESCE(NEW.detail, ''),
+            'to_account_id', NEW.account_to,
+            'to_account_number', to_account.id_number,
+            'to_currency_code', to_account.currency_code,
+            'credited_amount', CASE
+                WHEN NEW.account_to IS NOT NULL THEN COALESCE(fx.converted_amount, NEW.amount)
+            END
+        ),
+        NEW.created_at
+    );
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION outbox_account_status_changed()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO "BK_Outbox" (
+        event_type, version, account_id, payload, occurred_at
+    ) VALUES (
+        'account.status_changed',
+        1,
+        NEW.id,
+        jsonb_build_object(
+            'account_id', NEW.id,
+            'account_number', NEW.id_number,
+            'old_status', OLD.status,
+            'new_status', NEW.status
+        ),
+        NOW()
+    );
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER trig_bk_transaction_outbox
+AFTER INSERT ON "BK_Transaction"
+DEFERRABLE INITIALLY DEFERRED
+FOR EACH ROW
+EXECUTE FUNCTION outbox_transaction_recorded();
+
+CREATE CONSTRAINT TRIGGER trig_bk_account_outbox
+AFTER UPDATE OF status ON "BK_Account"
+DEFERRABLE INITIALLY DEFERRED
+FOR EACH ROW
+WHEN (OLD.status IS DISTINCT FROM NEW.status)
+EXECUTE FUNCTION outbox_account_status_changed();
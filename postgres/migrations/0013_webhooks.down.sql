@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS "BK_Webhook_Attempt";
+DROP TABLE IF EXISTS "BK_Webhook_Delivery";
+DROP TYPE IF EXISTS WEBHOOK_DELIVERY_STATUS;
+DROP TABLE IF EXISTS "BK_Webhook";
@@ -0,0 +1,95 @@
+-- Webhooks push the domain events of "BK_Outbox" to an URL of a user, for
+-- the events of their accounts, or of a partner, for the events of every
+-- account. An empty event_types subscribes to every type.
+CREATE TABLE IF NOT EXISTS "BK_Webhook" (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT,
+    partner VARCHAR(64),
+    url TEXT NOT NULL,
+    event_types TEXT[] NOT NULL DEFAULT '{}',
+    -- Signs the deliveries, so it is kept in clear.
+    secret TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id)
+        REFERENCES "BK_User"(id) ON DELETE CASCADE,
+    CONSTRAINT webhook_has_one_owner
+        CHECK ((user_id IS NULL) <> (partner IS NULL))
+);
+
+CREATE INDEX idx_bk_webhook_user_id ON "BK_Webhook" (user_id);
+
+ALTER TABLE "BK_Webhook" ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "BK_Webhook_select_policy"
+ON "BK_Webhook"
+FOR SELECT
+USING (
+    user_id = current_setting('app.current_user_id')::BIGINT
+);
+
+CREATE TRIGGER trig_bk_webhook_update
+BEFORE UPDATE ON "BK_Webhook"
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at();
+
+CREATE TRIGGER trig_bk_webhook_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_Webhook"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('id', '{updated_at}', '{secret}');
+
+CREATE TYPE WEBHOOK_DELIVERY_STATUS AS ENUM (
+    'PENDING',
+    'DELIVERED',
+    'DEAD'
+);
+
+-- An event to deliver to a webhook, once per webhook. A delivery is retried
+-- with a growing delay until it succeeds or runs out of attempts and is DEAD.
+CREATE TABLE IF NOT EXISTS "BK_Webhook_Delivery" (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id BIGINT NOT NULL,
+    event_id UUID NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    -- The event as it is posted.
+    payload JSONB NOT NULL,
+    status WEBHOOK_DELIVERY_STATUS NOT NULL DEFAULT 'PENDING',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- Set while an instance delivers it, so others skip it.
+    claimed_until TIMESTAMPTZ,
+    delivered_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (webhook_id)
+        REFERENCES "BK_Webhook"(id) ON DELETE CASCADE,
+    CONSTRAINT unique_webhook_delivery
+        UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX idx_bk_webhook_delivery_due ON "BK_Webhook_Delivery" (next_attempt_at)
+    WHERE status = 'PENDING';
+
+CREATE TRIGGER trig_bk_webhook_delivery_update
+BEFORE UPDATE ON "BK_Webhook_Delivery"
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at();
+
+-- Every attempt to deliver, with the response status, 0 when there was none.
+CREATE TABLE IF NOT EXISTS "BK_Webhook_Attempt" (
+    id BIGSERIAL PRIMARY KEY,
+    delivery_id BIGINT NOT NULL,
+    attempt INTEGER NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    duration_ms INTEGER NOT NULL,
+    attempted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (delivery_id)
+        REFERENCES "BK_Webhook_Delivery"(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_bk_webhook_attempt_delivery_id ON "BK_Webhook_Attempt" (delivery_id);
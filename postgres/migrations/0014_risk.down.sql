@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_bk_transaction_account_from_account_to;
+DROP TABLE IF EXISTS "BK_Risk_Decision";
+DROP TYPE IF EXISTS RISK_REVIEW_STATUS;
+DROP TYPE IF EXISTS RISK_OUTCOME;
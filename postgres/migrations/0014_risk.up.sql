@@ -0,0 +1,82 @@
+CREATE TYPE RISK_OUTCOME AS ENUM (
+    'ALLOW',
+    'STEP_UP',
+    'REVIEW',
+    'BLOCK'
+);
+
+CREATE TYPE RISK_REVIEW_STATUS AS ENUM (
+    'PENDING',
+    'APPROVED',
+    'REJECTED'
+);
+
+-- Every withdrawal and transfer the risk rules judged, before it was made,
+-- with the rules that objected. Movements to review are held, by hold_id,
+-- until an operator approves or rejects them.
+CREATE TABLE IF NOT EXISTS "BK_Risk_Decision" (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    account_id BIGINT NOT NULL,
+    movement_type VARCHAR(16) NOT NULL,
+    amount NUMERIC(20, 2) NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    to_account_id BIGINT,
+    payee_id BIGINT,
+    client_ip VARCHAR(64) NOT NULL DEFAULT '',
+    -- The network of client_ip the rules compare, /24 for IPv4 and /48
+    -- for IPv6.
+    network VARCHAR(64) NOT NULL DEFAULT '',
+    outcome RISK_OUTCOME NOT NULL,
+    -- [{"rule": ..., "outcome": ..., "reason": ...}]
+    reasons JSONB NOT NULL DEFAULT '[]',
+    hold_id BIGINT,
+    review_status RISK_REVIEW_STATUS,
+    reviewed_by TEXT NOT NULL DEFAULT '',
+    review_note TEXT NOT NULL DEFAULT '',
+    reviewed_at TIMESTAMPTZ,
+    transaction_id BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id)
+        REFERENCES "BK_User"(id) ON DELETE CASCADE,
+    FOREIGN KEY (account_id)
+        REFERENCES "BK_Account"(id) ON DELETE CASCADE,
+    FOREIGN KEY (to_account_id)
+        REFERENCES "BK_Account"(id) ON DELETE SET NULL,
+    FOREIGN KEY (payee_id)
+        REFERENCES "BK_Payee"(id) ON DELETE SET NULL,
+    FOREIGN KEY (hold_id)
+        REFERENCES "BK_Account_Hold"(id) ON DELETE SET NULL,
+    FOREIGN KEY (transaction_id)
+        REFERENCES "BK_Transaction"(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_bk_risk_decision_user_id_created_at ON "BK_Risk_Decision" (user_id, created_at);
+CREATE INDEX idx_bk_risk_decision_account_id ON "BK_Risk_Decision" (account_id);
+CREATE INDEX idx_bk_risk_decision_pending ON "BK_Risk_Decision" (id)
+    WHERE review_status = 'PENDING';
+
+-- Finds the last withdrawal or transfer to an account for the new payee rule.
+CREATE INDEX idx_bk_transaction_account_from_account_to
+    ON "BK_Transaction" (account_from, account_to);
+
+ALTER TABLE "BK_Risk_Decision" ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "BK_Risk_Decision_select_policy"
+ON "BK_Risk_Decision"
+FOR SELECT
+USING (
+    user_id = current_setting('app.current_user_id')::BIGINT
+);
+
+CREATE TRIGGER trig_bk_risk_decision_update
+BEFORE UPDATE ON "BK_Risk_Decision"
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at();
+
+CREATE TRIGGER trig_bk_risk_decision_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_Risk_Decision"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('id', '{updated_at}', '{}');
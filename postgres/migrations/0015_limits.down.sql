@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS trig_bk_transaction_limits ON "BK_Transaction";
+DROP FUNCTION IF EXISTS enforce_transaction_limits();
+DROP FUNCTION IF EXISTS limit_period_start(TEXT, TIMESTAMPTZ);
+DROP FUNCTION IF EXISTS limit_usage(BIGINT, LIMIT_SCOPE, TX_TYPE, TIMESTAMPTZ);
+DROP FUNCTION IF EXISTS account_limit_rules(BIGINT);
+DROP INDEX IF EXISTS idx_bk_transaction_account_from_tx_type_created_at;
+DROP TABLE IF EXISTS "BK_Limit_Assignment";
+DROP TABLE IF EXISTS "BK_Limit_Rule";
+DROP TABLE IF EXISTS "BK_Limit_Profile";
+DROP TYPE IF EXISTS LIMIT_SCOPE;
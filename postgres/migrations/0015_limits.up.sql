@@ -0,0 +1,214 @@
+CREATE TYPE LIMIT_SCOPE AS ENUM (
+    'ACCOUNT',
+    'USER'
+);
+
+-- Limit profiles group the limits assigned to accounts and users. The default
+-- profile applies to every user with no profile of their own.
+CREATE TABLE IF NOT EXISTS "BK_Limit_Profile" (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(64) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_bk_limit_profile_default ON "BK_Limit_Profile" (is_default)
+    WHERE is_default;
+
+-- A rule limits the postings of one type, or withdrawals and transfers
+-- together when tx_type is NULL, in one currency, or any when currency_code
+-- is NULL. A NULL limit is not checked.
+CREATE TABLE IF NOT EXISTS "BK_Limit_Rule" (
+    id BIGSERIAL PRIMARY KEY,
+    profile_id BIGINT NOT NULL,
+    tx_type TX_TYPE,
+    currency_code VARCHAR(3),
+    per_transaction NUMERIC(22, 4),
+    daily NUMERIC(22, 4),
+    monthly NUMERIC(22, 4),
+
+    FOREIGN KEY (profile_id)
+        REFERENCES "BK_Limit_Profile"(id) ON DELETE CASCADE,
+    FOREIGN KEY (currency_code)
+        REFERENCES "BK_Currency"(code),
+    CONSTRAINT valid_limit_rule_tx_type
+        CHECK (tx_type IN ('WITHDRAW', 'DEPOSIT', 'TRANSFER')),
+    CONSTRAINT positive_limits
+        CHECK (per_transaction > 0 AND daily > 0 AND monthly > 0)
+);
+
+CREATE UNIQUE INDEX idx_bk_limit_rule_profile_id_tx_type_currency_code ON "BK_Limit_Rule" (
+    profile_id, COALESCE(tx_type::TEXT, ''), COALESCE(currency_code, '')
+);
+
+-- Assigns a profile to an account, whose own postings it limits, or to a
+-- user, whose postings from all accounts in a currency it limits together.
+CREATE TABLE IF NOT EXISTS "BK_Limit_Assignment" (
+    id BIGSERIAL PRIMARY KEY,
+    profile_id BIGINT NOT NULL,
+    account_id BIGINT UNIQUE,
+    user_id BIGINT UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (profile_id)
+        REFERENCES "BK_Limit_Profile"(id) ON DELETE CASCADE,
+    FOREIGN KEY (account_id)
+        REFERENCES "BK_Account"(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id)
+        REFERENCES "BK_User"(id) ON DELETE CASCADE,
+    CONSTRAINT limit_assignment_target
+        CHECK ((account_id IS NULL) <> (user_id IS NULL))
+);
+
+CREATE INDEX idx_bk_limit_assignment_profile_id ON "BK_Limit_Assignment" (profile_id);
+
+-- Sums the postings of the user's accounts of a currency for the user scope.
+CREATE INDEX idx_bk_transaction_account_from_tx_type_created_at
+    ON "BK_Transaction" (account_from, tx_type, created_at);
+
+CREATE TRIGGER trig_bk_limit_profile_update
+BEFORE UPDATE ON "BK_Limit_Profile"
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at();
+
+CREATE TRIGGER trig_bk_limit_assignment_update
+BEFORE UPDATE ON "BK_Limit_Assignment"
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at();
+
+CREATE TRIGGER trig_bk_limit_profile_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_Limit_Profile"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('id', '{updated_at}', '{}');
+
+CREATE TRIGGER trig_bk_limit_rule_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_Limit_Rule"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('id', '{}', '{}');
+
+CREATE TRIGGER trig_bk_limit_assignment_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_Limit_Assignment"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('id', '{updated_at}', '{}');
+
+-- The limit rules that apply to an account: those of the profile assigned to
+-- the account, in the account scope, and those of the profile assigned to
+-- its owner, or else of the default profile, in the user scope. Rules for
+-- another currency than the account's do not apply.
+CREATE OR REPLACE FUNCTION account_limit_rules(input_account_id BIGINT)
+RETURNS TABLE (
+    rule_id BIGINT,
+    profile_id BIGINT,
+    profile_name VARCHAR(64),
+    scope LIMIT_SCOPE,
+    tx_type TX_TYPE,
+    currency_code VARCHAR(3),
+    per_transaction NUMERIC(22, 4),
+    daily NUMERIC(22, 4),
+    monthly NUMERIC(22, 4)
+) AS $$
+    WITH account AS (
+        SELECT id, user_id, currency_code FROM "BK_Account" WHERE id = input_account_id
+    ), assigned AS (
+        SELECT la.profile_id, 'ACCOUNT'::LIMIT_SCOPE AS scope
+        FROM "BK_Limit_Assignment" la, account
+        WHERE la.account_id = account.id
+        UNION ALL
+        SELECT COALESCE(
+            (SELECT la.profile_id FROM "BK_Limit_Assignment" la WHERE la.user_id = account.user_id),
+            (SELECT p.id FROM "BK_Limit_Profile" p WHERE p.is_default)
+        ), 'USER'::LIMIT_SCOPE
+        FROM account
+    )
+    SELECT r.id, p.id, p.name, assigned.scope, r.tx_type, account.currency_code,
+        r.per_transaction, r.daily, r.monthly
+    FROM assigned
+    JOIN "BK_Limit_Profile" p ON p.id = assigned.profile_id
+    JOIN "BK_Limit_Rule" r ON r.profile_id = p.id
+    CROSS JOIN account
+    WHERE r.currency_code IS NULL OR r.currency_code = account.currency_code
+    ORDER BY assigned.scope, r.id;
+$$ LANGUAGE sql STABLE;
+
+-- The amount a rule of the scope has used since then: the postings of its
+-- type from the account, or from all the owner's accounts in the account's
+-- currency in the user scope.
+CREATE OR REPLACE FUNCTION limit_usage(
+    input_account_id BIGINT,
+    rule_scope LIMIT_SCOPE,
+    rule_tx_type TX_TYPE,
+    since TIMESTAMPTZ
+) RETURNS NUMERIC(22, 4) AS $$
+    SELECT COALESCE(SUM(t.amount), 0)
+    FROM "BK_Account" account
+    JOIN "BK_Account" a ON a.id = account.id
+        OR rule_scope = 'USER' AND a.user_id = account.user_id AND a.currency_code = account.currency_code
+    JOIN "BK_Transaction" t ON t.account_from = a.id
+    WHERE account.id = input_account_id
+        AND t.created_at >= since
+        AND (t.tx_type = rule_tx_type OR rule_tx_type IS NULL AND t.tx_type IN ('WITHDRAW', 'TRANSFER'));
+$$ LANGUAGE sql STABLE;
+
+-- Days and months start at midnight UTC.
+CREATE OR REPLACE FUNCTION limit_period_start(period TEXT, at_time TIMESTAMPTZ)
+RETURNS TIMESTAMPTZ AS $$
+    SELECT date_trunc(period, at_time AT TIME ZONE 'UTC') AT TIME ZONE 'UTC';
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Rejects a posting that takes a rule that applies to its account beyond a
+-- limit. Postings run in serializable transactions, so concurrent postings
+-- that only exceed a limit together cannot both commit.
+CREATE OR REPLACE FUNCTION enforce_transaction_limits()
+RETURNS TRIGGER AS $$
+DECLARE
+    limit_rule RECORD;
+    period TEXT;
+    lim NUMERIC(22, 4);
+    remaining NUMERIC(22, 4);
+BEGIN
+    IF NEW.tx_type NOT IN ('WITHDRAW', 'DEPOSIT', 'TRANSFER') THEN
+        RETURN NEW;
+    END IF;
+
+    FOR limit_rule IN
+        SELECT * FROM account_limit_rules(NEW.account_from) r
+        WHERE r.tx_type = NEW.tx_type OR r.tx_type IS NULL AND NEW.tx_type IN ('WITHDRAW', 'TRANSFER')
+    LOOP
+        FOREACH period IN ARRAY ARRAY['per-transaction', 'daily', 'monthly'] LOOP
+            lim := CASE period
+                WHEN 'per-transaction' THEN limit_rule.per_transaction
+                WHEN 'daily' THEN limit_rule.daily
+                ELSE limit_rule.monthly
+            END;
+            CONTINUE WHEN lim IS NULL;
+
+            remaining := lim;
+            IF period <> 'per-transaction' THEN
+                remaining := GREATEST(lim - limit_usage(
+                    NEW.account_from, limit_rule.scope, limit_rule.tx_type,
+                    limit_period_start(CASE period WHEN 'daily' THEN 'day' ELSE 'month' END, NOW())
+                ), 0);
+            END IF;
+
+            IF NEW.amount > remaining THEN
+                RAISE EXCEPTION '% % limit of % % per % (profile %), % remaining',
+                    period, COALESCE(lower(limit_rule.tx_type::TEXT), 'outgoing'),
+                    to_char(lim, 'FM999999999999999990.0099'), limit_rule.currency_code,
+                    lower(limit_rule.scope::TEXT), limit_rule.profile_name,
+                    to_char(remaining, 'FM999999999999999990.0099')
+                    USING ERRCODE = 'BKL01';
+            END IF;
+        END LOOP;
+    END LOOP;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trig_bk_transaction_limits
+BEFORE INSERT ON "BK_Transaction"
+FOR EACH ROW
+EXECUTE FUNCTION enforce_transaction_limits();
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_bk_transaction_cash_created_at;
+DROP TABLE IF EXISTS "BK_AML_Case_Note";
+DROP TABLE IF EXISTS "BK_AML_Case";
+DROP TABLE IF EXISTS "BK_AML_Report";
+DROP TYPE IF EXISTS AML_CASE_STATUS;
+DROP TYPE IF EXISTS AML_CASE_KIND;
@@ -0,0 +1,113 @@
+CREATE TYPE AML_CASE_KIND AS ENUM (
+    'LARGE_CASH',
+    'STRUCTURING'
+);
+
+CREATE TYPE AML_CASE_STATUS AS ENUM (
+    'OPEN',
+    'CLOSED'
+);
+
+-- One report per UTC day of cash deposits and withdrawals scanned, with the
+-- thresholds it was scanned with: thresholds maps each currency scanned to its
+-- threshold, and unscanned_currencies lists the currencies of the cash that
+-- had none. files_written_at is set once the report is written to the report
+-- directory.
+CREATE TABLE IF NOT EXISTS "BK_AML_Report" (
+    id BIGSERIAL PRIMARY KEY,
+    period_start TIMESTAMPTZ NOT NULL,
+    period_end TIMESTAMPTZ NOT NULL,
+    thresholds JSONB NOT NULL,
+    unscanned_currencies TEXT[] NOT NULL DEFAULT '{}',
+    structuring_margin NUMERIC(5, 4) NOT NULL,
+    structuring_count INTEGER NOT NULL,
+    structuring_window_seconds BIGINT NOT NULL,
+    files_written_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    UNIQUE (period_start, period_end)
+);
+
+-- A case is the cash movements of one user in one currency and direction that
+-- a report flagged: LARGE_CASH when they add up to the threshold within the
+-- day, STRUCTURING when enough of them fell just below it within the window.
+-- Compliance annotates and closes it as REPORTED or DISMISSED.
+CREATE TABLE IF NOT EXISTS "BK_AML_Case" (
+    id BIGSERIAL PRIMARY KEY,
+    report_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    kind AML_CASE_KIND NOT NULL,
+    tx_type TX_TYPE NOT NULL,
+    currency_code VARCHAR(3) NOT NULL,
+    total NUMERIC(22, 4) NOT NULL,
+    transaction_ids BIGINT[] NOT NULL,
+    account_numbers TEXT[] NOT NULL,
+    period_start TIMESTAMPTZ NOT NULL,
+    period_end TIMESTAMPTZ NOT NULL,
+    status AML_CASE_STATUS NOT NULL DEFAULT 'OPEN',
+    resolution VARCHAR(16) NOT NULL DEFAULT '',
+    closed_by TEXT NOT NULL DEFAULT '',
+    closed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (report_id)
+        REFERENCES "BK_AML_Report"(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id)
+        REFERENCES "BK_User"(id) ON DELETE CASCADE,
+    CONSTRAINT valid_aml_case_tx_type
+        CHECK (tx_type IN ('DEPOSIT', 'WITHDRAW')),
+    CONSTRAINT valid_aml_case_resolution
+        CHECK ((status = 'OPEN') = (resolution = '') AND resolution IN ('', 'REPORTED', 'DISMISSED'))
+);
+
+CREATE INDEX idx_bk_aml_report_files ON "BK_AML_Report" (id)
+    WHERE files_written_at IS NULL;
+
+CREATE INDEX idx_bk_aml_case_report_id ON "BK_AML_Case" (report_id);
+CREATE INDEX idx_bk_aml_case_user_id ON "BK_AML_Case" (user_id);
+CREATE INDEX idx_bk_aml_case_open ON "BK_AML_Case" (id)
+    WHERE status = 'OPEN';
+
+CREATE TABLE IF NOT EXISTS "BK_AML_Case_Note" (
+    id BIGSERIAL PRIMARY KEY,
+    case_id BIGINT NOT NULL,
+    author TEXT NOT NULL DEFAULT '',
+    note TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (case_id)
+        REFERENCES "BK_AML_Case"(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_bk_aml_case_note_case_id ON "BK_AML_Case_Note" (case_id);
+
+-- Finds the cash movements of a day for the reports.
+CREATE INDEX idx_bk_transaction_cash_created_at ON "BK_Transaction" (created_at)
+    WHERE tx_type IN ('DEPOSIT', 'WITHDRAW');
+
+-- Customers must not learn that they were reported, so no policy lets them
+-- read the cases.
+ALTER TABLE "BK_AML_Report" ENABLE ROW LEVEL SECURITY;
+ALTER TABLE "BK_AML_Case" ENABLE ROW LEVEL SECURITY;
+ALTER TABLE "BK_AML_Case_Note" ENABLE ROW LEVEL SECURITY;
+
+CREATE TRIGGER trig_bk_aml_case_update
+BEFORE UPDATE ON "BK_AML_Case"
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at();
+
+CREATE TRIGGER trig_bk_aml_report_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_AML_Report"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('id', '{}', '{}');
+
+CREATE TRIGGER trig_bk_aml_case_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_AML_Case"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('id', '{updated_at}', '{}');
+
+CREATE TRIGGER trig_bk_aml_case_note_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_AML_Case_Note"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('id', '{}', '{}');
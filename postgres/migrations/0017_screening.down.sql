@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "BK_Screening_Hit";
+DROP TYPE IF EXISTS SCREENING_HIT_STATUS;
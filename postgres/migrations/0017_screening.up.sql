@@ -0,0 +1,53 @@
+CREATE TYPE SCREENING_HIT_STATUS AS ENUM (
+    'PENDING',
+    'CLEARED',
+    'CONFIRMED',
+    'BLOCKED'
+);
+
+-- A name given at sign-up or on a profile update that matched an entry of the
+-- sanctions list. A hit that scored too high to let the user in is BLOCKED and
+-- has no user; the others are PENDING until compliance clears them as false
+-- positives (CLEARED) or confirms them (CONFIRMED). Pending and confirmed hits
+-- hold back the user's withdrawals and transfers, and transfers to them.
+CREATE TABLE IF NOT EXISTS "BK_Screening_Hit" (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT,
+    name TEXT NOT NULL,
+    entry_id TEXT NOT NULL,
+    entry_name TEXT NOT NULL,
+    matched_name TEXT NOT NULL,
+    program TEXT NOT NULL DEFAULT '',
+    score DOUBLE PRECISION NOT NULL,
+    status SCREENING_HIT_STATUS NOT NULL,
+    reviewed_by TEXT NOT NULL DEFAULT '',
+    review_note TEXT NOT NULL DEFAULT '',
+    reviewed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    -- Hits are kept for compliance after the user is gone.
+    FOREIGN KEY (user_id)
+        REFERENCES "BK_User"(id) ON DELETE SET NULL,
+    CONSTRAINT valid_screening_hit_score
+        CHECK (score > 0 AND score <= 1),
+    CONSTRAINT valid_screening_hit_review
+        CHECK ((status IN ('CLEARED', 'CONFIRMED')) = (reviewed_at IS NOT NULL))
+);
+
+CREATE INDEX idx_bk_screening_hit_user_id ON "BK_Screening_Hit" (user_id);
+CREATE INDEX idx_bk_screening_hit_pending ON "BK_Screening_Hit" (id)
+    WHERE status = 'PENDING';
+
+-- Hits are for compliance only, so no policy lets customers read them.
+ALTER TABLE "BK_Screening_Hit" ENABLE ROW LEVEL SECURITY;
+
+CREATE TRIGGER trig_bk_screening_hit_update
+BEFORE UPDATE ON "BK_Screening_Hit"
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at();
+
+CREATE TRIGGER trig_bk_screening_hit_audit
+AFTER INSERT OR UPDATE OR DELETE ON "BK_Screening_Hit"
+FOR EACH ROW
+EXECUTE FUNCTION audit_row_change('id', '{updated_at}', '{}');
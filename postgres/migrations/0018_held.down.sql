@@ -0,0 +1,27 @@
+-- Enum values cannot be dropped: the types are made again without HELD, which
+-- becomes FAILED.
+UPDATE "BK_Standing_Order_Execution" SET status = 'FAILED' WHERE status = 'HELD';
+UPDATE "BK_Bulk_Payment_Line" SET status = 'FAILED' WHERE status = 'HELD';
+
+ALTER TYPE STANDING_ORDER_EXECUTION_STATUS RENAME TO STANDING_ORDER_EXECUTION_STATUS_OLD;
+CREATE TYPE STANDING_ORDER_EXECUTION_STATUS AS ENUM (
+    'SUCCEEDED',
+    'RETRYING',
+    'FAILED'
+);
+ALTER TABLE "BK_Standing_Order_Execution"
+    ALTER COLUMN status TYPE STANDING_ORDER_EXECUTION_STATUS USING status::TEXT::STANDING_ORDER_EXECUTION_STATUS;
+DROP TYPE STANDING_ORDER_EXECUTION_STATUS_OLD;
+
+ALTER TYPE BULK_PAYMENT_LINE_STATUS RENAME TO BULK_PAYMENT_LINE_STATUS_OLD;
+CREATE TYPE BULK_PAYMENT_LINE_STATUS AS ENUM (
+    'PENDING',
+    'SUCCEEDED',
+    'FAILED',
+    'REJECTED'
+);
+ALTER TABLE "BK_Bulk_Payment_Line" ALTER COLUMN status DROP DEFAULT;
+ALTER TABLE "BK_Bulk_Payment_Line"
+    ALTER COLUMN status TYPE BULK_PAYMENT_LINE_STATUS USING status::TEXT::BULK_PAYMENT_LINE_STATUS;
+ALTER TABLE "BK_Bulk_Payment_Line" ALTER COLUMN status SET DEFAULT 'PENDING';
+DROP TYPE BULK_PAYMENT_LINE_STATUS_OLD;
@@ -0,0 +1,4 @@
+-- Standing order executions and bulk payment lines the risk engine holds for
+-- review are HELD; the review queue makes the transfer if it is approved.
+ALTER TYPE STANDING_ORDER_EXECUTION_STATUS ADD VALUE IF NOT EXISTS 'HELD';
+ALTER TYPE BULK_PAYMENT_LINE_STATUS ADD VALUE IF NOT EXISTS 'HELD';
@@ -0,0 +1,2 @@
+-- Amounts with more than two decimals are rounded.
+ALTER TABLE "BK_Risk_Decision" ALTER COLUMN amount TYPE NUMERIC(20, 2);
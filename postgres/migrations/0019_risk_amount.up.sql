@@ -0,0 +1 @@
+ALTER TABLE "BK_Risk_Decision" ALTER COLUMN amount TYPE NUMERIC(22, 4);
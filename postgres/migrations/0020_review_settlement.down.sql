@@ -0,0 +1,19 @@
+ALTER TABLE "BK_Bulk_Payment_Line" DROP COLUMN IF EXISTS decision_id;
+ALTER TABLE "BK_Standing_Order_Execution" DROP COLUMN IF EXISTS decision_id;
+
+-- Enum values cannot be dropped: the type is made again without CANCELLED,
+-- which becomes REJECTED.
+UPDATE "BK_Risk_Decision" SET review_status = 'REJECTED' WHERE review_status = 'CANCELLED';
+
+DROP INDEX IF EXISTS idx_bk_risk_decision_pending;
+ALTER TYPE RISK_REVIEW_STATUS RENAME TO RISK_REVIEW_STATUS_OLD;
+CREATE TYPE RISK_REVIEW_STATUS AS ENUM (
+    'PENDING',
+    'APPROVED',
+    'REJECTED'
+);
+ALTER TABLE "BK_Risk_Decision"
+    ALTER COLUMN review_status TYPE RISK_REVIEW_STATUS USING review_status::TEXT::RISK_REVIEW_STATUS;
+DROP TYPE RISK_REVIEW_STATUS_OLD;
+CREATE INDEX idx_bk_risk_decision_pending ON "BK_Risk_Decision" (id)
+    WHERE review_status = 'PENDING';
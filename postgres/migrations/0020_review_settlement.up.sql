@@ -0,0 +1,14 @@
+-- A decision whose movement is given up on before it is reviewed, e.g. a line
+-- of an all-or-nothing bulk payment that is not paid, is CANCELLED.
+ALTER TYPE RISK_REVIEW_STATUS ADD VALUE IF NOT EXISTS 'CANCELLED';
+
+-- The decision a HELD execution or line waits for; reviewing it settles them.
+ALTER TABLE "BK_Standing_Order_Execution" ADD COLUMN decision_id BIGINT
+    REFERENCES "BK_Risk_Decision"(id) ON DELETE SET NULL;
+ALTER TABLE "BK_Bulk_Payment_Line" ADD COLUMN decision_id BIGINT
+    REFERENCES "BK_Risk_Decision"(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_bk_standing_order_execution_decision_id ON "BK_Standing_Order_Execution" (decision_id)
+    WHERE decision_id IS NOT NULL;
+CREATE INDEX idx_bk_bulk_payment_line_decision_id ON "BK_Bulk_Payment_Line" (decision_id)
+    WHERE decision_id IS NOT NULL;
@@ -0,0 +1,87 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LoginLockout locks an identity out after MaxAttempts failed logins within Window.
+type LoginLockout struct {
+	client      *redis.Client
+	maxAttempts int64
+	window      time.Duration
+	duration    time.Duration
+}
+
+// NewLoginLockout creates the lockout. Zero values fall back to 5 attempts
+// within 15 minutes and a 15 minute lock.
+func NewLoginLockout(client *redis.Client, maxAttempts int, window, duration time.Duration) *LoginLockout {
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	if window <= 0 {
+		window = 15 * time.Minute
+	}
+	if duration <= 0 {
+		duration = 15 * time.Minute
+	}
+
+	return &LoginLockout{
+		client:      client,
+		maxAttempts: int64(maxAttempts),
+		window:      window,
+		duration:    duration,
+	}
+}
+
+// LockedFor returns how long the identity stays locked, or 0 if it is not locked.
+func (l *LoginLockout) LockedFor(ctx context.Context, identity string) (time.Duration, error) {
+	ttl, err := l.client.PTTL(ctx, lockedKey(identity)).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// RecordFailure counts a failed login and locks the identity once the limit is reached.
+func (l *LoginLockout) RecordFailure(ctx context.Context, identity string) error {
+	key := failuresKey(identity)
+
+	failures, err := l.client.Incr(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if failures == 1 {
+		if err := l.client.Expire(ctx, key, l.window).Err(); err != nil {
+			return err
+		}
+	}
+
+	if failures < l.maxAttempts {
+		return nil
+	}
+
+	pipe := l.client.TxPipeline()
+	pipe.Set(ctx, lockedKey(identity), 1, l.duration)
+	pipe.Del(ctx, key)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// RecordSuccess clears the failure counter of the identity.
+func (l *LoginLockout) RecordSuccess(ctx context.Context, identity string) error {
+	return l.client.Del(ctx, failuresKey(identity)).Err()
+}
+
+func failuresKey(identity string) string {
+	return "login:failures:" + identity
+}
+
+func lockedKey(identity string) string {
+	return "login:locked:" + identity
+}
@@ -8,11 +8,20 @@ import (
 	"time"
 
 	"bank_system/pkg/account"
+	"bank_system/pkg/aml"
+	"bank_system/pkg/audit"
+	"bank_system/pkg/bulkpayment"
+	"bank_system/pkg/currency"
+	"bank_system/pkg/outbox"
+	"bank_system/pkg/screening"
+	"bank_system/pkg/standingorder"
+	"bank_system/pkg/statement"
 	"bank_system/pkg/transaction"
 	"bank_system/pkg/user"
+	"bank_system/pkg/webhook"
+	"bank_system/utils"
 
 	"github.com/go-co-op/gocron/v2"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type CronService struct {
@@ -21,33 +30,413 @@ type CronService struct {
 	usrService *user.UserService
 	actService *account.AccountService
 	txService  *transaction.TxService
+	curService *currency.CurrencyService
+	soService  *standingorder.StandingOrderService
+	stService  *statement.StatementService
+	bpService  *bulkpayment.BulkPaymentService
+	auService  *audit.AuditService
+	obService  *outbox.OutboxService
+	whService  *webhook.WebhookService
+	amlService *aml.AMLService
+	scrService *screening.ScreeningService
+	demo       bool
 }
 
-func NewCronService(pool *pgxpool.Pool, logger *log.Logger) (*CronService, error) {
+func NewCronService(
+	usrService *user.UserService,
+	actService *account.AccountService,
+	txService *transaction.TxService,
+	curService *currency.CurrencyService,
+	soService *standingorder.StandingOrderService,
+	stService *statement.StatementService,
+	bpService *bulkpayment.BulkPaymentService,
+	auService *audit.AuditService,
+	obService *outbox.OutboxService,
+	whService *webhook.WebhookService,
+	amlService *aml.AMLService,
+	scrService *screening.ScreeningService,
+	demo bool,
+	logger *log.Logger,
+) (*CronService, error) {
 	s, err := gocron.NewScheduler()
 	if err != nil {
 		return nil, err
 	}
 
-	usrRepo := user.NewUserRepository(pool)
-	usrService := user.NewUserService(usrRepo)
-
-	txRepo := transaction.NewTxRepository(pool)
-	txService := transaction.NewTxService(txRepo)
-
-	actRepo := account.NewAccountRepository(pool)
-	actService := account.NewAccountService(actRepo)
-
 	return &CronService{
 		scheduler:  s,
 		logger:     logger,
 		usrService: usrService,
 		actService: actService,
 		txService:  txService,
+		curService: curService,
+		soService:  soService,
+		stService:  stService,
+		bpService:  bpService,
+		auService:  auService,
+		obService:  obService,
+		whService:  whService,
+		amlService: amlService,
+		scrService: scrService,
+		demo:       demo,
 	}, nil
 }
 
 func (c *CronService) Start() error {
+	if c.demo {
+		if err := c.startDemoJobs(); err != nil {
+			return err
+		}
+	}
+
+	// Job: Release expired holds
+	_, err := c.scheduler.NewJob(
+		gocron.DurationJob(
+			1*time.Minute,
+		),
+		gocron.NewTask(
+			func(logger *log.Logger) {
+				expired, err := c.actService.ExpireHolds(jobContext(4))
+				if err != nil {
+					logger.Printf("cronjob 4 - expire holds failed: %v\n", err)
+					return
+				}
+
+				if expired > 0 {
+					logger.Printf("cronjob 4 - released %d expired holds\n", expired)
+				}
+			},
+			c.logger,
+		),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	// Job: Post overdraft interest and fees, once per account and day
+	_, err = c.scheduler.NewJob(
+		gocron.DurationJob(
+			1*time.Hour,
+		),
+		gocron.NewTask(
+			func(logger *log.Logger) {
+				charged, err := c.actService.PostOverdraftCharges(jobContext(5), time.Now().UTC())
+				if err != nil {
+					logger.Printf("cronjob 5 - post overdraft charges failed: %v\n", err)
+					return
+				}
+
+				if charged > 0 {
+					logger.Printf("cronjob 5 - charged %d overdrawn accounts\n", charged)
+				}
+			},
+			c.logger,
+		),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	// Job: Reload the currency catalogue, for changes made by other instances
+	_, err = c.scheduler.NewJob(
+		gocron.DurationJob(
+			1*time.Minute,
+		),
+		gocron.NewTask(
+			func(logger *log.Logger) {
+				if err := c.curService.Refresh(jobContext(6)); err != nil {
+					logger.Printf("cronjob 6 - refresh currencies failed: %v\n", err)
+				}
+			},
+			c.logger,
+		),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	// Job: Execute the standing orders that are due
+	_, err = c.scheduler.NewJob(
+		gocron.DurationJob(
+			1*time.Minute,
+		),
+		gocron.NewTask(
+			func(logger *log.Logger) {
+				succeeded, err := c.soService.ExecuteDue(jobContext(7), time.Now())
+				if err != nil {
+					logger.Printf("cronjob 7 - execute standing orders failed: %v\n", err)
+				}
+
+				if succeeded > 0 {
+					logger.Printf("cronjob 7 - executed %d standing orders\n", succeeded)
+				}
+			},
+			c.logger,
+		),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	// Job: Store last month's statements, once the month is over
+	_, err = c.scheduler.NewJob(
+		gocron.DurationJob(
+			1*time.Hour,
+		),
+		gocron.NewTask(
+			func(logger *log.Logger) {
+				generated, err := c.stService.GenerateMonthlyStatements(jobContext(8), time.Now())
+				if err != nil {
+					logger.Printf("cronjob 8 - generate statements failed: %v\n", err)
+				}
+
+				if generated > 0 {
+					logger.Printf("cronjob 8 - generated %d statements\n", generated)
+				}
+			},
+			c.logger,
+		),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	// Job: Execute the bulk payments waiting to be executed
+	_, err = c.scheduler.NewJob(
+		gocron.DurationJob(
+			10*time.Second,
+		),
+		gocron.NewTask(
+			func(logger *log.Logger) {
+				executed, err := c.bpService.ExecutePending(jobContext(9), time.Now())
+				if err != nil {
+					logger.Printf("cronjob 9 - execute bulk payments failed: %v\n", err)
+				}
+
+				if executed > 0 {
+					logger.Printf("cronjob 9 - executed %d bulk payments\n", executed)
+				}
+			},
+			c.logger,
+		),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	// Job: Seal the audit log entries of the transactions that ended
+	_, err = c.scheduler.NewJob(
+		gocron.DurationJob(
+			10*time.Second,
+		),
+		gocron.NewTask(
+			func(logger *log.Logger) {
+				sealed, err := c.auService.Seal(jobContext(10))
+				if err != nil {
+					logger.Printf("cronjob 10 - seal audit log failed: %v\n", err)
+				}
+
+				if sealed > 0 {
+					logger.Printf("cronjob 10 - sealed %d audit log entries\n", sealed)
+				}
+			},
+			c.logger,
+		),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	// Job: Relay the outbox events to Redis
+	_, err = c.scheduler.NewJob(
+		gocron.DurationJob(
+			1*time.Second,
+		),
+		gocron.NewTask(
+			func(logger *log.Logger) {
+				published, err := c.obService.Relay(jobContext(11))
+				if err != nil {
+					logger.Printf("cronjob 11 - relay outbox events failed: %v\n", err)
+				}
+
+				if published > 0 {
+					logger.Printf("cronjob 11 - published %d outbox events\n", published)
+				}
+			},
+			c.logger,
+		),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	// Job: Delete the outbox events published before the retention
+	_, err = c.scheduler.NewJob(
+		gocron.DurationJob(
+			1*time.Hour,
+		),
+		gocron.NewTask(
+			func(logger *log.Logger) {
+				deleted, err := c.obService.Purge(jobContext(12), time.Now())
+				if err != nil {
+					logger.Printf("cronjob 12 - purge outbox events failed: %v\n", err)
+					return
+				}
+
+				if deleted > 0 {
+					logger.Printf("cronjob 12 - deleted %d published outbox events\n", deleted)
+				}
+			},
+			c.logger,
+		),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	// Job: Post the webhook deliveries that are due
+	_, err = c.scheduler.NewJob(
+		gocron.DurationJob(
+			5*time.Second,
+		),
+		gocron.NewTask(
+			func(logger *log.Logger) {
+				delivered, err := c.whService.DeliverDue(jobContext(13), time.Now())
+				if err != nil {
+					logger.Printf("cronjob 13 - deliver webhooks failed: %v\n", err)
+				}
+
+				if delivered > 0 {
+					logger.Printf("cronjob 13 - delivered %d webhooks\n", delivered)
+				}
+			},
+			c.logger,
+		),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	// Job: Report the cash movements of the days that ended
+	_, err = c.scheduler.NewJob(
+		gocron.DurationJob(
+			1*time.Hour,
+		),
+		gocron.NewTask(
+			func(logger *log.Logger) {
+				generated, err := c.amlService.GenerateReports(jobContext(14), time.Now())
+				if err != nil {
+					logger.Printf("cronjob 14 - generate aml reports failed: %v\n", err)
+				}
+
+				if generated > 0 {
+					logger.Printf("cronjob 14 - generated %d aml reports\n", generated)
+				}
+			},
+			c.logger,
+		),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	// Job: Reload the sanctions list when its file changed
+	if c.scrService != nil {
+		_, err = c.scheduler.NewJob(
+			gocron.DurationJob(
+				1*time.Minute,
+			),
+			gocron.NewTask(
+				func(logger *log.Logger) {
+					reloaded, err := c.scrService.ReloadIfChanged()
+					if err != nil {
+						logger.Printf("cronjob 15 - reload sanctions list failed: %v\n", err)
+					}
+
+					if reloaded {
+						logger.Printf("cronjob 15 - reloaded sanctions list, %d entries\n", c.scrService.Status().Entries)
+					}
+				},
+				c.logger,
+			),
+			gocron.WithSingletonMode(gocron.LimitModeReschedule),
+		)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	c.scheduler.Start()
+	c.logger.Printf("Cron jobs started successfully\n")
+
+	return nil
+}
+
+// jobContext is the context of cron job n, whose changes the audit log
+// records as made by the system.
+func jobContext(n int) context.Context {
+	return utils.WithAuditMetadata(context.Background(), utils.AuditMetadata{
+		Actor:  "system",
+		Action: fmt.Sprintf("cronjob %d", n),
+	})
+}
+
+func (c *CronService) Stop() error {
+	err := c.scheduler.Shutdown()
+	if err != nil {
+		c.logger.Printf("Failed to stop cron jobs: %v\n", err)
+		return err
+	}
+	c.logger.Printf("Cron jobs stopped successfully\n")
+	return nil
+}
+
+// func getModel(i uint32) *simulator.LLModel {
+// 	depositModel := simulator.NewLLModel(
+// 		[]simulator.Message{
+// 			{
+// 				Role:    viper.GetString("openrouter.role.user"),
+// 				Content: viper.GetString("openrouter.message.deposit"),
+// 			},
+// 		})
+
+// 	withdrawModel := simulator.NewLLModel(
+// 		[]simulator.Message{
+// 			{
+// 				Role:    viper.GetString("openrouter.role.user"),
+// 				Content: viper.GetString("openrouter.message.withdraw"),
+// 			},
+// 		})
+
+// 	if i%2 == 0 {
+// 		return depositModel
+// 	}
+// 	return withdrawModel
+// }
+
+// startDemoJobs schedules the jobs that fill a demo instance with random
+// users, accounts and transactions. They bypass the risk checks and the
+// step-up, so they only run with cron.demo_jobs.
+func (c *CronService) startDemoJobs() error {
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 
 	// Job: Create user, account, and transaction
@@ -61,9 +450,9 @@ func (c *CronService) Start() error {
 
 				username := fmt.Sprintf("user_%d", rInt)
 				email := username + "@example.com"
-				password := fmt.Sprintf("password_%d", rInt)
+				password := fmt.Sprintf("Password_%d", rInt)
 
-				ctx := context.Background()
+				ctx := jobContext(1)
 
 				user, err := c.usrService.CreateUser(ctx, username, email, password)
 				if err != nil {
@@ -71,7 +460,7 @@ func (c *CronService) Start() error {
 					return
 				}
 
-				account, err := c.actService.CreateAccount(ctx, user.ID)
+				account, err := c.actService.CreateAccount(ctx, user.ID, "")
 				if err != nil {
 					logger.Printf("cronjob 1 - create account failed: %v\n", err)
 					return
@@ -105,15 +494,15 @@ func (c *CronService) Start() error {
 			func(logger *log.Logger) {
 				rInt := r.Uint32()
 
-				users, err := c.usrService.GetAllUsers(context.Background())
+				users, err := c.usrService.GetAllUsers(jobContext(2))
 				if err != nil {
 					logger.Printf("cronjob 2 - get all users failed: %v\n", err)
 					return
 				}
 
 				for _, user := range *users {
-					ctx := context.Background()
-					account, err := c.actService.CreateAccount(ctx, user.ID)
+					ctx := jobContext(2)
+					account, err := c.actService.CreateAccount(ctx, user.ID, "")
 					if err != nil {
 						logger.Printf("cronjob 2 - create account failed: %v\n", err)
 						return
@@ -148,14 +537,14 @@ func (c *CronService) Start() error {
 			func(logger *log.Logger) {
 				rInt := r.Intn(1000000)
 
-				accounts, err := c.actService.GetAllAccounts(context.Background())
+				accounts, err := c.actService.GetAllAccounts(jobContext(3))
 				if err != nil {
 					logger.Printf("cronjob 3 - get all accounts failed: %v\n", err)
 					return
 				}
 
 				for _, account := range accounts {
-					txId, balance, err := c.actService.Withdraw(context.Background(), account.IDNumber, float64(rInt), "")
+					txId, balance, err := c.actService.Withdraw(jobContext(3), account.IDNumber, float64(rInt), "")
 					if err != nil {
 						logger.Printf("cronjob 3 - create transaction failed: %v\n", err)
 						return
@@ -175,41 +564,5 @@ func (c *CronService) Start() error {
 		return err
 	}
 
-	c.scheduler.Start()
-	c.logger.Printf("Cron jobs started successfully\n")
-
-	return nil
-}
-
-func (c *CronService) Stop() error {
-	err := c.scheduler.Shutdown()
-	if err != nil {
-		c.logger.Printf("Failed to stop cron jobs: %v\n", err)
-		return err
-	}
-	c.logger.Printf("Cron jobs stopped successfully\n")
 	return nil
 }
-
-// func getModel(i uint32) *simulator.LLModel {
-// 	depositModel := simulator.NewLLModel(
-// 		[]simulator.Message{
-// 			{
-// 				Role:    viper.GetString("openrouter.role.user"),
-// 				Content: viper.GetString("openrouter.message.deposit"),
-// 			},
-// 		})
-
-// 	withdrawModel := simulator.NewLLModel(
-// 		[]simulator.Message{
-// 			{
-// 				Role:    viper.GetString("openrouter.role.user"),
-// 				Content: viper.GetString("openrouter.message.withdraw"),
-// 			},
-// 		})
-
-// 	if i%2 == 0 {
-// 		return depositModel
-// 	}
-// 	return withdrawModel
-// }
@@ -1,13 +1,139 @@
 package server
 
 import (
+	"bank_system/pkg/account"
+	"bank_system/pkg/aml"
+	"bank_system/pkg/audit"
+	"bank_system/pkg/bulkpayment"
+	"bank_system/pkg/currency"
+	"bank_system/pkg/fx"
+	"bank_system/pkg/limit"
+	"bank_system/pkg/memstore"
+	"bank_system/pkg/outbox"
+	"bank_system/pkg/payee"
+	"bank_system/pkg/risk"
+	"bank_system/pkg/screening"
+	"bank_system/pkg/standingorder"
+	"bank_system/pkg/statement"
+	"bank_system/pkg/stream"
+	"bank_system/pkg/transaction"
+	"bank_system/pkg/user"
+	"bank_system/pkg/webhook"
 	"context"
+	"fmt"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/spf13/viper"
 )
 
+// Values of the storage.backend setting.
+const (
+	BackendPostgres = "postgres"
+	BackendMemory   = "memory"
+)
+
+type repositories struct {
+	users        user.UserRepository
+	accounts     account.AccountRepository
+	transactions transaction.TxRepository
+	quotes       fx.QuoteRepository
+	currencies   currency.CurrencyRepository
+	orders       standingorder.StandingOrderRepository
+	payees       payee.PayeeRepository
+	statements   statement.StatementRepository
+	bulkPayments bulkpayment.BulkPaymentRepository
+	audit        audit.AuditRepository
+	outbox       outbox.OutboxRepository
+	webhooks     webhook.WebhookRepository
+	streams      stream.StreamRepository
+	risk         risk.RiskRepository
+	limits       limit.LimitRepository
+	aml          aml.AMLRepository
+	screening    screening.ScreeningRepository
+}
+
+func newPostgresRepositories(pool *pgxpool.Pool) repositories {
+	return repositories{
+		users:        user.NewUserRepository(pool),
+		accounts:     account.NewAccountRepository(pool),
+		transactions: transaction.NewTxRepository(pool),
+		quotes:       fx.NewQuoteRepository(pool),
+		currencies:   currency.NewCurrencyRepository(pool),
+		orders:       standingorder.NewStandingOrderRepository(pool),
+		payees:       payee.NewPayeeRepository(pool),
+		statements:   statement.NewStatementRepository(pool),
+		bulkPayments: bulkpayment.NewBulkPaymentRepository(pool),
+		audit:        audit.NewAuditRepository(pool),
+		outbox:       outbox.NewOutboxRepository(pool),
+		webhooks:     webhook.NewWebhookRepository(pool),
+		streams:      stream.NewStreamRepository(pool),
+		risk:         risk.NewRiskRepository(pool),
+		limits:       limit.NewLimitRepository(pool),
+		aml:          aml.NewAMLRepository(pool),
+		screening:    screening.NewScreeningRepository(pool),
+	}
+}
+
+// newMemoryRepositories backs every repository by the same store, so that the
+// server can run without a database during development.
+func newMemoryRepositories(store *memstore.Store) repositories {
+	return repositories{
+		users:        user.NewMemoryUserRepository(store),
+		accounts:     account.NewMemoryAccountRepository(store),
+		transactions: transaction.NewMemoryTxRepository(store),
+		quotes:       fx.NewMemoryQuoteRepository(store),
+		currencies:   currency.NewMemoryCurrencyRepository(store),
+		orders:       standingorder.NewMemoryStandingOrderRepository(store),
+		payees:       payee.NewMemoryPayeeRepository(store),
+		statements:   statement.NewMemoryStatementRepository(store),
+		bulkPayments: bulkpayment.NewMemoryBulkPaymentRepository(store),
+		audit:        audit.NewMemoryAuditRepository(store),
+		outbox:       outbox.NewMemoryOutboxRepository(store),
+		webhooks:     webhook.NewMemoryWebhookRepository(store),
+		streams:      stream.NewMemoryStreamRepository(store),
+		risk:         risk.NewMemoryRiskRepository(store),
+		limits:       limit.NewMemoryLimitRepository(store),
+		aml:          aml.NewMemoryAMLRepository(store),
+		screening:    screening.NewMemoryScreeningRepository(store),
+	}
+}
+
+// newRateProvider picks the exchange rate source from fx.provider: "file"
+// reads fx.rates_file and "postgres" the "BK_FX_Rate" table. When unset the
+// file is used if configured, else the database. It returns nil when there is
+// no source, i.e. on the memory backend without a rates file.
+func newRateProvider(pool *pgxpool.Pool) (fx.RateProvider, error) {
+	provider := viper.GetString("fx.provider")
+	if provider == "" && viper.GetString("fx.rates_file") != "" {
+		provider = "file"
+	}
+
+	switch provider {
+	case "file":
+		return fx.NewFileRateProvider(viper.GetString("fx.rates_file"))
+	case "", "postgres":
+		if pool == nil {
+			if provider == "" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("fx provider %q needs the postgres storage backend", provider)
+		}
+		return fx.NewPostgresRateProvider(pool), nil
+	default:
+		return nil, fmt.Errorf("unknown fx provider %q", provider)
+	}
+}
+
+// SetPGConn connects a pool whose connections carry the audit metadata of
+// the context they are acquired with.
 func SetPGConn(ctx context.Context, dbLink string) (*pgxpool.Pool, error) {
-	pool, err := pgxpool.New(ctx, dbLink)
+	config, err := pgxpool.ParseConfig(dbLink)
+	if err != nil {
+		return nil, err
+	}
+	config.BeforeAcquire = audit.BeforeAcquire
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -1 +1,351 @@
 package server
+
+import (
+	"bank_system/postgres/sqlc"
+	"bank_system/redis"
+	"bank_system/utils"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/spf13/viper"
+)
+
+// IdentityFunc returns the identity a request is rate limited by.
+type IdentityFunc func(ctx *gin.Context) string
+
+func IdentifyByIP(ctx *gin.Context) string {
+	return "ip:" + ctx.ClientIP()
+}
+
+// IdentifyByUser uses the user of the request's session, see Authenticate,
+// and falls back to the client IP.
+func IdentifyByUser(ctx *gin.Context) string {
+	if userID, ok := utils.UserIDFrom(ctx.Request.Context()); ok {
+		return "user:" + strconv.FormatInt(userID, 10)
+	}
+	return IdentifyByIP(ctx)
+}
+
+func identityFunc(name string) IdentityFunc {
+	switch name {
+	case "user":
+		return IdentifyByUser
+	default:
+		return IdentifyByIP
+	}
+}
+
+type RateLimitPolicy struct {
+	Name     string
+	Limit    int
+	Window   time.Duration
+	Identity IdentityFunc
+}
+
+// RateLimitPolicies picks the policy of a request. A policy for the exact
+// route ("POST /users/login") wins over one for its group ("/users"), which
+// wins over the default.
+type RateLimitPolicies struct {
+	Default RateLimitPolicy
+	Groups  map[string]RateLimitPolicy
+	Routes  map[string]RateLimitPolicy
+}
+
+func (p RateLimitPolicies) match(method, path string) RateLimitPolicy {
+	if policy, ok := p.Routes[method+" "+path]; ok {
+		return policy
+	}
+
+	best, bestLen := p.Default, -1
+	for prefix, policy := range p.Groups {
+		if strings.HasPrefix(path, prefix) && len(prefix) > bestLen {
+			best, bestLen = policy, len(prefix)
+		}
+	}
+	return best
+}
+
+// LoadRateLimitPolicies reads rate_limit.* from the configuration. Login and
+// user creation get strict limits unless they are configured explicitly.
+func LoadRateLimitPolicies() RateLimitPolicies {
+	policies := RateLimitPolicies{
+		Default: loadRateLimitPolicy("default", "rate_limit.default", RateLimitPolicy{
+			Limit: 120, Window: time.Minute, Identity: IdentifyByIP,
+		}),
+		Groups: map[string]RateLimitPolicy{},
+		Routes: map[string]RateLimitPolicy{
+			"POST /users/login": loadRateLimitPolicy("login", "rate_limit.routes.login", RateLimitPolicy{
+				Limit: 5, Window: time.Minute, Identity: IdentifyByIP,
+			}),
+			"POST /users": loadRateLimitPolicy("create_user", "rate_limit.routes.create_user", RateLimitPolicy{
+				Limit: 3, Window: time.Hour, Identity: IdentifyByIP,
+			}),
+		},
+	}
+
+	for name := range viper.GetStringMap("rate_limit.groups") {
+		key := "rate_limit.groups." + name
+		policies.Groups["/"+name] = loadRateLimitPolicy(name, key, policies.Default)
+	}
+
+	return policies
+}
+
+func loadRateLimitPolicy(name, key string, fallback RateLimitPolicy) RateLimitPolicy {
+	policy := fallback
+	policy.Name = name
+
+	if limit := viper.GetInt(key + ".limit"); limit > 0 {
+		policy.Limit = limit
+	}
+	if window := viper.GetDuration(key + ".window"); window > 0 {
+		policy.Window = window
+	}
+	if identity := viper.GetString(key + ".identity"); identity != "" {
+		policy.Identity = identityFunc(identity)
+	}
+	return policy
+}
+
+// RateLimit rejects requests over their policy with 429 and sets the
+// RateLimit-* headers. Like the login lockout it fails closed: requests are
+// rejected with 503 while Redis is unavailable, so that an outage does not
+// lift the limits. It runs after Authenticate, so that IdentifyByUser sees
+// the user.
+func RateLimit(limiter *redis.RateLimiter, policies RateLimitPolicies, logger *log.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		policy := policies.match(ctx.Request.Method, ctx.FullPath())
+		key := policy.Name + ":" + policy.Identity(ctx)
+
+		result, err := limiter.Allow(ctx.Request.Context(), key, policy.Limit, policy.Window)
+		if err != nil {
+			logger.Printf("rate limiter unavailable: %v\n", err)
+			err = utils.NewBankSystemError(utils.ErrSecurityUnavailable, "rate limiter")
+			ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, utils.ErrorResponse(err))
+			return
+		}
+
+		reset := strconv.Itoa(int((result.Reset + time.Second - 1) / time.Second))
+		ctx.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		ctx.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		ctx.Header("RateLimit-Reset", reset)
+
+		if !result.Allowed {
+			ctx.Header("Retry-After", reset)
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// AdminAuth lets requests through whose X-Admin-Token header matches token.
+// With an empty token every request is rejected, which disables the admin
+// endpoints.
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		given := ctx.GetHeader("X-Admin-Token")
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin token required"})
+			return
+		}
+
+		metadata := utils.AuditMetadataFrom(ctx.Request.Context())
+		metadata.Actor = "admin"
+		ctx.Request = ctx.Request.WithContext(utils.WithAuditMetadata(ctx.Request.Context(), metadata))
+		ctx.Next()
+	}
+}
+
+// SessionAuthenticator checks the session tokens handed out at login.
+type SessionAuthenticator interface {
+	Authenticate(token string) (int64, error)
+}
+
+// Authenticate puts the user of the request's "Authorization: Bearer"
+// session token in its context, see utils.UserIDFrom. Requests without a
+// token go on anonymously; those with an invalid or expired one are rejected
+// with 401.
+func Authenticate(sessions SessionAuthenticator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		header := ctx.GetHeader("Authorization")
+		if header == "" {
+			ctx.Next()
+			return
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "bearer token required"})
+			return
+		}
+		userID, err := sessions.Authenticate(token)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.Request = ctx.Request.WithContext(utils.WithUserID(ctx.Request.Context(), userID))
+		ctx.Next()
+	}
+}
+
+// QueryToken authenticates a request that has no session with the token of
+// its access_token query parameter, for clients that cannot set headers:
+// EventSource and the WebSockets of browsers. An invalid token is rejected
+// with 401.
+func QueryToken(sessions SessionAuthenticator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token := ctx.Query("access_token")
+		if _, ok := utils.UserIDFrom(ctx.Request.Context()); ok || token == "" {
+			ctx.Next()
+			return
+		}
+
+		userID, err := sessions.Authenticate(token)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.Request = ctx.Request.WithContext(utils.WithUserID(ctx.Request.Context(), userID))
+		ctx.Next()
+	}
+}
+
+// AccessLog logs every request like gin.Logger, with the value of the
+// access_token query parameter, a session token, see QueryToken, left out.
+func AccessLog() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(params gin.LogFormatterParams) string {
+		if params.Latency > time.Minute {
+			params.Latency = params.Latency.Truncate(time.Second)
+		}
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+			params.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			params.StatusCode,
+			params.Latency,
+			params.ClientIP,
+			params.Method,
+			redactQuery(params.Path),
+			params.ErrorMessage,
+		)
+	})
+}
+
+// redactQuery replaces the access_token of a path with "REDACTED".
+func redactQuery(path string) string {
+	base, rawQuery, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// Do not log what cannot be told apart from a token.
+		return base + "?REDACTED"
+	}
+	if !query.Has("access_token") {
+		return path
+	}
+	query.Set("access_token", "REDACTED")
+	return base + "?" + query.Encode()
+}
+
+// AccountOwners finds who owns an account.
+type AccountOwners interface {
+	GetAccountByIDNumber(ctx context.Context, idNumber string) (sqlc.GetAccountByIDNumberRow, error)
+}
+
+// OwnerAuth lets an authenticated user through to what is theirs: the user
+// of the route's :id, or the account of its :id_number. Anonymous requests
+// are rejected with 401 and those of other users with 403.
+func OwnerAuth(accounts AccountOwners) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, ok := utils.UserIDFrom(ctx.Request.Context())
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+
+		if id := ctx.Param("id"); id != "" && id != strconv.FormatInt(userID, 10) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not your user"})
+			return
+		}
+		if idNumber := ctx.Param("id_number"); idNumber != "" {
+			reqCtx, cancel := context.WithTimeout(ctx.Request.Context(), utils.TIMEOUT)
+			account, err := accounts.GetAccountByIDNumber(reqCtx, idNumber)
+			cancel()
+			if errors.Is(err, pgx.ErrNoRows) {
+				err = utils.NewBankSystemError(utils.ErrAccountNotFound, idNumber)
+				ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse(err))
+				return
+			}
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if account.UserID != userID {
+				ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not your account"})
+				return
+			}
+		}
+
+		ctx.Next()
+	}
+}
+
+// OwnerOrAdminAuth lets requests with the admin token through like
+// AdminAuth, and the others only to the owner like OwnerAuth.
+func OwnerOrAdminAuth(token string, accounts AccountOwners) gin.HandlerFunc {
+	admin, owner := AdminAuth(token), OwnerAuth(accounts)
+	return func(ctx *gin.Context) {
+		if ctx.GetHeader("X-Admin-Token") != "" {
+			admin(ctx)
+			return
+		}
+		owner(ctx)
+	}
+}
+
+// MAX_REQUEST_ID_LENGTH bounds the X-Request-ID a client may choose.
+const MAX_REQUEST_ID_LENGTH = 128
+
+// AuditContext puts who makes a request in its context, for the audit log:
+// the user of its session, see Authenticate, which must run first, the route,
+// the client IP and the X-Request-ID header, generated when absent and sent
+// back. AdminAuth replaces the actor with "admin" on the admin routes.
+func AuditContext() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader("X-Request-ID")
+		if requestID == "" || len(requestID) > MAX_REQUEST_ID_LENGTH {
+			b := make([]byte, 16)
+			rand.Read(b)
+			requestID = hex.EncodeToString(b)
+		}
+		ctx.Header("X-Request-ID", requestID)
+
+		actor := "anonymous"
+		if userID, ok := utils.UserIDFrom(ctx.Request.Context()); ok {
+			actor = "user:" + strconv.FormatInt(userID, 10)
+		}
+
+		ctx.Request = ctx.Request.WithContext(utils.WithAuditMetadata(ctx.Request.Context(), utils.AuditMetadata{
+			Actor:     actor,
+			Action:    ctx.Request.Method + " " + ctx.FullPath(),
+			RequestID: requestID,
+			ClientIP:  ctx.ClientIP(),
+		}))
+		ctx.Next()
+	}
+}
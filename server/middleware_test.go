@@ -0,0 +1,46 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRedactQuery(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"/users/1/stream", "/users/1/stream"},
+		{"/users/1/stream?last_event_id=5", "/users/1/stream?last_event_id=5"},
+		{"/users/1/stream?access_token=1.2.secret", "/users/1/stream?access_token=REDACTED"},
+		{"/users/1/stream?last_event_id=5&access_token=1.2.secret", "/users/1/stream?access_token=REDACTED&last_event_id=5"},
+		{"/users/1/stream?access_token=a&access_token=b", "/users/1/stream?access_token=REDACTED"},
+		{"/users/1/stream?access_token=%zz", "/users/1/stream?REDACTED"},
+	}
+	for _, tt := range tests {
+		if got := redactQuery(tt.path); got != tt.want {
+			t.Errorf("redactQuery(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAccessLogLeavesOutTokens(t *testing.T) {
+	var buf bytes.Buffer
+	saved := gin.DefaultWriter
+	gin.DefaultWriter = &buf
+	defer func() { gin.DefaultWriter = saved }()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(AccessLog())
+	router.GET("/stream", func(ctx *gin.Context) { ctx.Status(http.StatusNoContent) })
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/stream?access_token=1.2.secret", nil))
+	if log := buf.String(); strings.Contains(log, "secret") || !strings.Contains(log, "access_token=REDACTED") {
+		t.Errorf("access log %q", log)
+	}
+}
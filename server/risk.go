@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bank_system/pkg/risk"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// LoadRiskRules reads the rules of the risk engine from risk.*. Every rule
+// but the amount thresholds, which are unset by default, runs with the
+// defaults below unless its outcome is configured as ALLOW.
+func LoadRiskRules() ([]risk.Rule, error) {
+	var rules []risk.Rule
+
+	amount := risk.AmountRule{
+		StepUp: viper.GetFloat64("risk.amount.step_up"),
+		Review: viper.GetFloat64("risk.amount.review"),
+		Block:  viper.GetFloat64("risk.amount.block"),
+	}
+	if amount.StepUp > 0 || amount.Review > 0 || amount.Block > 0 {
+		rules = append(rules, amount)
+	}
+
+	velocity := risk.VelocityRule{Count: 10, Window: time.Hour}
+	if count := viper.GetInt("risk.velocity.count"); count > 0 {
+		velocity.Count = count
+	}
+	if window := viper.GetDuration("risk.velocity.window"); window > 0 {
+		velocity.Window = window
+	}
+	if err := loadRiskOutcome(velocity.Name(), risk.OutcomeReview, &velocity.Outcome); err != nil {
+		return nil, err
+	}
+	if velocity.Outcome != risk.OutcomeAllow {
+		rules = append(rules, velocity)
+	}
+
+	newPayee := risk.NewPayeeRule{Age: 72 * time.Hour, Amount: 1000}
+	if age := viper.GetDuration("risk.new_payee.age"); age > 0 {
+		newPayee.Age = age
+	}
+	if viper.IsSet("risk.new_payee.amount") {
+		newPayee.Amount = viper.GetFloat64("risk.new_payee.amount")
+	}
+	if err := loadRiskOutcome(newPayee.Name(), risk.OutcomeStepUp, &newPayee.Outcome); err != nil {
+		return nil, err
+	}
+	if newPayee.Outcome != risk.OutcomeAllow {
+		rules = append(rules, newPayee)
+	}
+
+	network := risk.NetworkRule{Lookback: 30 * 24 * time.Hour}
+	if lookback := viper.GetDuration("risk.network.lookback"); lookback > 0 {
+		network.Lookback = lookback
+	}
+	if err := loadRiskOutcome(network.Name(), risk.OutcomeStepUp, &network.Outcome); err != nil {
+		return nil, err
+	}
+	if network.Outcome != risk.OutcomeAllow {
+		rules = append(rules, network)
+	}
+
+	dormant := risk.DormantRule{After: 180 * 24 * time.Hour}
+	if after := viper.GetDuration("risk.dormant.after"); after > 0 {
+		dormant.After = after
+	}
+	if err := loadRiskOutcome(dormant.Name(), risk.OutcomeReview, &dormant.Outcome); err != nil {
+		return nil, err
+	}
+	if dormant.Outcome != risk.OutcomeAllow {
+		rules = append(rules, dormant)
+	}
+
+	return rules, nil
+}
+
+// loadRiskOutcome reads risk.<rule>.outcome into outcome, fallback when unset.
+func loadRiskOutcome(rule, fallback string, outcome *string) error {
+	*outcome = fallback
+	if configured := viper.GetString("risk." + rule + ".outcome"); configured != "" {
+		*outcome = configured
+	}
+	if !slices.Contains(risk.Outcomes, *outcome) {
+		return fmt.Errorf("risk.%s.outcome must be one of %v", rule, risk.Outcomes)
+	}
+	return nil
+}
@@ -2,70 +2,344 @@ package server
 
 import (
 	"bank_system/pkg/account"
+	"bank_system/pkg/aml"
+	"bank_system/pkg/audit"
+	"bank_system/pkg/bulkpayment"
+	"bank_system/pkg/currency"
+	"bank_system/pkg/fx"
+	"bank_system/pkg/limit"
+	"bank_system/pkg/memstore"
+	"bank_system/pkg/outbox"
+	"bank_system/pkg/payee"
+	"bank_system/pkg/risk"
+	"bank_system/pkg/screening"
+	"bank_system/pkg/standingorder"
+	"bank_system/pkg/statement"
+	"bank_system/pkg/stream"
 	"bank_system/pkg/transaction"
 	"bank_system/pkg/user"
+	"bank_system/pkg/webhook"
+	"bank_system/postgres"
+	"bank_system/redis"
+	"bank_system/utils"
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"expvar"
 	"fmt"
 	"log"
+	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
+	goredis "github.com/redis/go-redis/v9"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
 type Server struct {
-	logger        *log.Logger
-	pool          *pgxpool.Pool
-	router        *gin.Engine
-	actController *account.AccountController
-	usrController *user.UserController
-	txController  *transaction.TxController
-	cron          *CronService
+	logger          *log.Logger
+	pool            *pgxpool.Pool
+	redis           *goredis.Client
+	router          *gin.Engine
+	actController   *account.AccountController
+	usrController   *user.UserController
+	txController    *transaction.TxController
+	fxController    *fx.FXController
+	curController   *currency.CurrencyController
+	soController    *standingorder.StandingOrderController
+	payeeController *payee.PayeeController
+	stController    *statement.StatementController
+	bpController    *bulkpayment.BulkPaymentController
+	auController    *audit.AuditController
+	whController    *webhook.WebhookController
+	strController   *stream.StreamController
+	rkController    *risk.RiskController
+	lmController    *limit.LimitController
+	amlController   *aml.AMLController
+	scrController   *screening.ScreeningController
+	cron            *CronService
 }
 
 func NewServer() (*Server, error) {
 	logger := log.Default()
 
-	pool, err := SetPGConn(context.Background(), viper.GetString("postgres.connection_string"))
+	var (
+		pool  *pgxpool.Pool
+		repos repositories
+		err   error
+	)
+	switch backend := viper.GetString("storage.backend"); backend {
+	case BackendMemory:
+		logger.Printf("Using the in-memory storage backend, data is lost on restart\n")
+		repos = newMemoryRepositories(memstore.New())
+	case "", BackendPostgres:
+		pool, err = SetPGConn(context.Background(), viper.GetString("postgres.connection_string"))
+		if err != nil {
+			fmt.Println("Failed to create connection pool", zap.Error(err))
+			return nil, err
+		}
+
+		migrator, err := postgres.NewMigrator(pool, logger)
+		if err != nil {
+			return nil, err
+		}
+		if err := migrator.Verify(context.Background()); err != nil {
+			logger.Printf("Refusing to start, run \"migrate up\" first: %v\n", err)
+			return nil, err
+		}
+
+		repos = newPostgresRepositories(pool)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+
+	totpKey, err := base64.StdEncoding.DecodeString(viper.GetString("security.totp.encryption_key"))
 	if err != nil {
-		fmt.Println("Failed to create connection pool", zap.Error(err))
 		return nil, err
 	}
+	sessionKey, err := base64.StdEncoding.DecodeString(viper.GetString("security.session.key"))
+	if err != nil {
+		return nil, err
+	}
+	if len(sessionKey) == 0 {
+		logger.Printf("No security.session.key configured, sessions end when the server stops\n")
+		sessionKey = make([]byte, 32)
+		if _, err := rand.Read(sessionKey); err != nil {
+			return nil, err
+		}
+	}
+
+	redisClient := redis.NewRedisClient()
+	lockout := redis.NewLoginLockout(
+		redisClient,
+		viper.GetInt("security.lockout.max_attempts"),
+		viper.GetDuration("security.lockout.window"),
+		viper.GetDuration("security.lockout.duration"),
+	)
+
+	var (
+		scrService    *screening.ScreeningService
+		scrController *screening.ScreeningController
+		screener      user.Screener
+	)
+	if listFile := viper.GetString("screening.list_file"); listFile != "" {
+		scrService = screening.NewScreeningService(repos.screening, screening.Config{
+			ListFile:    listFile,
+			ReviewScore: viper.GetFloat64("screening.review_score"),
+			BlockScore:  viper.GetFloat64("screening.block_score"),
+		})
+		status, err := scrService.Reload()
+		if err != nil {
+			return nil, fmt.Errorf("load sanctions list: %w", err)
+		}
+		logger.Printf("Screening names against %d entries of %s\n", status.Entries, status.Source)
+		scrController = screening.NewScreeningController(scrService, logger)
+		screener = scrService
+	} else {
+		logger.Printf("No sanctions list configured, names are not screened\n")
+	}
 
-	usrRepo := user.NewUserRepository(pool)
-	usrService := user.NewUserService(usrRepo)
+	usrService := user.NewUserService(repos.users, user.TOTPConfig{
+		Issuer:        viper.GetString("security.totp.issuer"),
+		EncryptionKey: totpKey,
+	}, user.SessionConfig{
+		Key: sessionKey,
+		TTL: viper.GetDuration("security.session.ttl"),
+	}, lockout, screener)
 	usrController := user.NewUserController(usrService, logger)
 
-	txRepo := transaction.NewTxRepository(pool)
-	txService := transaction.NewTxService(txRepo)
+	curService := currency.NewCurrencyService(repos.currencies)
+	if err := curService.Refresh(context.Background()); err != nil {
+		return nil, fmt.Errorf("load currencies: %w", err)
+	}
+	curController := currency.NewCurrencyController(curService, logger)
+
+	txService := transaction.NewTxService(repos.transactions)
 	txController := transaction.NewTxController(txService, logger)
 
-	actRepo := account.NewAccountRepository(pool)
-	actService := account.NewAccountService(actRepo)
+	actRepo := repos.accounts
+	if viper.GetBool("cache.account.enabled") {
+		actRepo = account.NewCachedAccountRepository(actRepo, redisClient, viper.GetDuration("cache.account.ttl"), logger)
+	}
+	rates, err := newRateProvider(pool)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		quoter       account.Quoter
+		fxController *fx.FXController
+	)
+	if rates != nil {
+		fxService := fx.NewFXService(rates, repos.quotes, viper.GetInt("fx.spread_bps"), viper.GetDuration("fx.quote_ttl"))
+		fxController = fx.NewFXController(fxService, logger)
+		quoter = fxService
+	} else {
+		logger.Printf("No exchange rate source configured, transfers between currencies are disabled\n")
+	}
+
+	var (
+		assessor account.RiskAssessor
+		rules    []risk.Rule
+	)
+	if viper.GetBool("risk.enabled") {
+		if rules, err = LoadRiskRules(); err != nil {
+			return nil, err
+		}
+	}
+	if scrService != nil {
+		// Screening holds back movements even without the other risk rules.
+		rules = append(rules, screening.NewRule(scrService, actRepo, usrService))
+	}
+	if viper.GetBool("risk.enabled") || scrService != nil {
+		engine := risk.NewEngine(repos.risk, viper.GetDuration("risk.review_ttl"), rules...)
+		logger.Printf("Risk engine enabled with rules %v\n", engine.Rules())
+		assessor = engine
+	}
+
+	coolingOff := payee.CoolingOff{
+		Period: viper.GetDuration("payees.cooling_off.period"),
+		Amount: viper.GetFloat64("payees.cooling_off.amount"),
+	}
+	actService := account.NewAccountService(
+		actRepo,
+		usrService,
+		viper.GetFloat64("security.step_up.threshold"),
+		account.NewRedisOverdraftNotifier(redisClient, logger),
+		quoter,
+		assessor,
+		payee.NewRecipientCheck(repos.payees, coolingOff),
+	)
 	actController := account.NewAccountController(actService, logger)
 
-	cronService, err := NewCronService(pool, logger)
+	lmService := limit.NewLimitService(repos.limits, actService, usrService)
+	lmController := limit.NewLimitController(lmService, logger)
+
+	amlService := aml.NewAMLService(repos.aml, aml.Config{
+		Thresholds:        loadAMLThresholds(),
+		StructuringMargin: viper.GetFloat64("aml.structuring.margin"),
+		StructuringCount:  viper.GetInt("aml.structuring.count"),
+		StructuringWindow: viper.GetDuration("aml.structuring.window"),
+		Backfill:          viper.GetInt("aml.backfill_days"),
+		ReportDir:         viper.GetString("aml.report_dir"),
+	})
+	amlController := aml.NewAMLController(amlService, logger)
+
+	soService := standingorder.NewStandingOrderService(repos.orders, actService, standingorder.RetryPolicy{
+		MaxAttempts: viper.GetInt("standing_orders.retry.max_attempts"),
+		Interval:    viper.GetDuration("standing_orders.retry.interval"),
+	}, viper.GetInt("standing_orders.batch_size"))
+	soController := standingorder.NewStandingOrderController(soService, logger)
+
+	payeeService := payee.NewPayeeService(repos.payees, actService, usrService, coolingOff)
+	payeeController := payee.NewPayeeController(payeeService, logger)
+
+	stService := statement.NewStatementService(
+		repos.statements, actService, viper.GetInt("statements.batch_size"), viper.GetString("statements.bank_id"),
+	)
+	stController := statement.NewStatementController(stService, logger)
+
+	bpService := bulkpayment.NewBulkPaymentService(repos.bulkPayments, actService, viper.GetInt("bulk_payments.batch_size"))
+	bpController := bulkpayment.NewBulkPaymentController(bpService, logger)
+
+	// Reviews settle the standing order executions and bulk payment lines
+	// they held.
+	rkService := risk.NewRiskService(repos.risk, actService, soService, bpService)
+	rkController := risk.NewRiskController(rkService, logger)
+
+	auService := audit.NewAuditService(repos.audit, viper.GetInt("audit.batch_size"))
+	auController := audit.NewAuditController(auService, logger)
+
+	whService := webhook.NewWebhookService(repos.webhooks, usrService, webhook.Config{
+		MaxAttempts:   viper.GetInt("webhooks.max_attempts"),
+		Backoff:       viper.GetDuration("webhooks.backoff"),
+		MaxBackoff:    viper.GetDuration("webhooks.max_backoff"),
+		Timeout:       viper.GetDuration("webhooks.timeout"),
+		BatchSize:     viper.GetInt("webhooks.batch_size"),
+		AllowInsecure: viper.GetBool("webhooks.allow_insecure"),
+		AllowPrivate:  viper.GetBool("webhooks.allow_private"),
+	})
+	whController := webhook.NewWebhookController(whService, logger)
+
+	obService := outbox.NewOutboxService(
+		repos.outbox,
+		outbox.MultiPublisher(
+			outbox.NewRedisStreamPublisher(redisClient, viper.GetString("outbox.stream"), viper.GetInt64("outbox.max_len")),
+			whService,
+			stream.NewRedisPubSubPublisher(redisClient),
+		),
+		viper.GetInt("outbox.batch_size"),
+		viper.GetDuration("outbox.retention"),
+	)
+
+	strService := stream.NewStreamService(repos.streams, usrService, redisClient, viper.GetDuration("stream.heartbeat"))
+	strController := stream.NewStreamController(strService, viper.GetStringSlice("stream.allowed_origins"), logger)
+
+	cronService, err := NewCronService(
+		usrService, actService, txService, curService, soService, stService, bpService, auService, obService, whService,
+		amlService, scrService, viper.GetBool("cron.demo_jobs"), logger,
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	router := gin.Default()
-	router.Use(gin.Logger())
+	utils.UseJSONFieldNames()
+
+	router := gin.New()
+	router.Use(AccessLog())
 	router.Use(gin.Recovery())
+	router.Use(Authenticate(usrService))
+	router.Use(RateLimit(redis.NewRateLimiter(redisClient), LoadRateLimitPolicies(), logger))
+	router.Use(AuditContext())
+	adminToken := viper.GetString("admin.token")
+	admin := AdminAuth(adminToken)
+	router.GET("/debug/vars", admin, gin.WrapH(expvar.Handler()))
 
-	usrController.RegisterRoutes(router)
+	owner := OwnerAuth(actRepo)
+	usrController.RegisterRoutes(router, owner)
 	txController.RegisterRoutes(router)
-	actController.RegisterRoutes(router)
+	actController.RegisterRoutes(router, owner, OwnerOrAdminAuth(adminToken, actRepo), admin)
+	if fxController != nil {
+		fxController.RegisterRoutes(router)
+	}
+	curController.RegisterRoutes(router, admin)
+	soController.RegisterRoutes(router, owner)
+	payeeController.RegisterRoutes(router, owner)
+	stController.RegisterRoutes(router, owner)
+	bpController.RegisterRoutes(router, owner)
+	auController.RegisterRoutes(router, admin)
+	whController.RegisterRoutes(router, owner, admin)
+	strController.RegisterRoutes(router, QueryToken(usrService), owner)
+	rkController.RegisterRoutes(router, admin)
+	lmController.RegisterRoutes(router, admin)
+	amlController.RegisterRoutes(router, admin)
+	if scrController != nil {
+		scrController.RegisterRoutes(router, admin)
+	}
 
 	return &Server{
-		logger:        logger,
-		pool:          pool,
-		router:        router,
-		actController: actController,
-		usrController: usrController,
-		txController:  txController,
-		cron:          cronService,
+		logger:          logger,
+		pool:            pool,
+		redis:           redisClient,
+		router:          router,
+		actController:   actController,
+		usrController:   usrController,
+		txController:    txController,
+		fxController:    fxController,
+		curController:   curController,
+		soController:    soController,
+		payeeController: payeeController,
+		stController:    stController,
+		bpController:    bpController,
+		auController:    auController,
+		whController:    whController,
+		strController:   strController,
+		rkController:    rkController,
+		lmController:    lmController,
+		amlController:   amlController,
+		scrController:   scrController,
+		cron:            cronService,
 	}, nil
 }
 
@@ -79,7 +353,27 @@ func (s *Server) Start(port, certFile, keyFile string) error {
 	return s.router.RunTLS(":"+port, certFile, keyFile)
 }
 
+// Handler returns the router without starting the cron jobs, e.g. to serve it
+// from httptest.
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
+
 func (s *Server) Stop() {
-	s.pool.Close()
+	if s.pool != nil {
+		s.pool.Close()
+	}
+	s.redis.Close()
 	s.cron.Stop()
 }
+
+// loadAMLThresholds reads aml.thresholds, the reporting threshold of each
+// currency by its code.
+func loadAMLThresholds() map[string]float64 {
+	thresholds := map[string]float64{}
+	for code := range viper.GetStringMap("aml.thresholds") {
+		// Viper lowercases keys.
+		thresholds[strings.ToUpper(code)] = viper.GetFloat64("aml.thresholds." + code)
+	}
+	return thresholds
+}
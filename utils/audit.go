@@ -0,0 +1,26 @@
+package utils
+
+import "context"
+
+// AuditMetadata says who makes the changes of a context. The audit log
+// records it with every change.
+type AuditMetadata struct {
+	// Actor is "user:<id>", "admin", "system" or "anonymous".
+	Actor string
+	// Action is the route of a request, e.g. "PUT /users/:id", or the job.
+	Action    string
+	RequestID string
+	ClientIP  string
+}
+
+type auditMetadataKey struct{}
+
+func WithAuditMetadata(ctx context.Context, metadata AuditMetadata) context.Context {
+	return context.WithValue(ctx, auditMetadataKey{}, metadata)
+}
+
+// AuditMetadataFrom returns the metadata of ctx, zero when it has none.
+func AuditMetadataFrom(ctx context.Context) AuditMetadata {
+	metadata, _ := ctx.Value(auditMetadataKey{}).(AuditMetadata)
+	return metadata
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MAX_MINOR_UNITS is the scale of the money columns, NUMERIC(100, 4).
+const MAX_MINOR_UNITS = 4
+
+// CurrencyInfo is what validation and formatting need to know about a
+// currency of the catalogue.
+type CurrencyInfo struct {
+	MinorUnits int
+	Symbol     string
+	Enabled    bool
+}
+
+// currencies mirrors "BK_Currency". It starts with the currencies the schema
+// is seeded with and is replaced by SetCurrencies once the catalogue is loaded.
+var currencies = struct {
+	sync.RWMutex
+	byCode map[string]CurrencyInfo
+}{
+	byCode: map[string]CurrencyInfo{
+		"USD": {MinorUnits: 2, Symbol: "$", Enabled: true},
+		"EUR": {MinorUnits: 2, Symbol: "€", Enabled: true},
+		"TWD": {MinorUnits: 2, Symbol: "NT$", Enabled: true},
+	},
+}
+
+// SetCurrencies replaces the catalogue used by ValidateAmount, ValidateCurrency
+// and FormatAmount.
+func SetCurrencies(byCode map[string]CurrencyInfo) {
+	currencies.Lock()
+	defer currencies.Unlock()
+	currencies.byCode = byCode
+}
+
+func LookupCurrency(code string) (CurrencyInfo, bool) {
+	currencies.RLock()
+	defer currencies.RUnlock()
+	info, ok := currencies.byCode[code]
+	return info, ok
+}
+
+// ValidateCurrency requires code to be an enabled currency of the catalogue.
+func ValidateCurrency(verr *ValidationError, field, code string) {
+	if info, ok := LookupCurrency(code); !ok || !info.Enabled {
+		verr.Add(field, "is not a supported currency")
+	}
+}
+
+// FormatAmount renders amount with the symbol and the minor units of the
+// currency and thousands separators, e.g. "-NT$1,234.50". Unknown currencies
+// use DEFAULT_MINOR_UNITS and the code as the symbol.
+func FormatAmount(amount float64, code string) string {
+	info, ok := LookupCurrency(code)
+	if !ok {
+		info = CurrencyInfo{MinorUnits: DEFAULT_MINOR_UNITS, Symbol: code + " "}
+	}
+
+	sign := ""
+	if amount < 0 && math.Round(amount*math.Pow10(info.MinorUnits)) != 0 {
+		sign = "-"
+	}
+	digits := strconv.FormatFloat(math.Abs(amount), 'f', info.MinorUnits, 64)
+	whole, fraction, _ := strings.Cut(digits, ".")
+
+	var b strings.Builder
+	b.WriteString(sign)
+	b.WriteString(info.Symbol)
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	if fraction != "" {
+		b.WriteByte('.')
+		b.WriteString(fraction)
+	}
+	return b.String()
+}
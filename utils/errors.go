@@ -1,6 +1,9 @@
 package utils
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 const (
 	// simulator
@@ -12,9 +15,67 @@ const (
 
 	// user
 	ErrEmailExists
+	ErrInvalidCredentials
+	ErrOTPRequired
+	ErrInvalidOTP
+	ErrTOTPNotEnabled
+	ErrTOTPAlreadyEnabled
+	ErrTOTPNotConfigured
+	ErrLoginLocked
+	ErrSecurityUnavailable
+	ErrUserNotFound
 	// account
 	ErrInsufficientBalance
 	ErrAccountNotFound
+	ErrAccountNotActive
+	ErrSameAccountTransfer
+	ErrHoldNotFound
+	ErrHoldNotActive
+	ErrInvalidCaptureAmount
+	ErrOverdraftLimitInUse
+	ErrCurrencyMismatch
+	// fx
+	ErrQuoteNotFound
+	ErrQuoteExpired
+	ErrRateUnavailable
+	// currency
+	ErrCurrencyNotFound
+	ErrCurrencyExists
+	ErrCurrencyInUse
+	// standing order
+	ErrStandingOrderNotFound
+	ErrStandingOrderStatus
+	// payee
+	ErrPayeeNotFound
+	ErrPayeeExists
+	ErrPayeeCoolingOff
+	ErrPayeeRequired
+	// statement
+	ErrStatementNotFound
+	// bulk payment
+	ErrBulkPaymentNotFound
+	ErrBulkPaymentExists
+	// webhook
+	ErrWebhookNotFound
+	ErrWebhookDeliveryNotFound
+	ErrTransactionBlocked
+	ErrTransactionHeld
+	ErrTransactionRejected
+	ErrRiskDecisionNotFound
+	ErrRiskDecisionNotPending
+	// limit
+	ErrLimitExceeded
+	ErrLimitProfileNotFound
+	ErrLimitProfileExists
+	// aml
+	ErrAMLCaseNotFound
+	ErrAMLCaseClosed
+	ErrAMLReportNotFound
+	// screening
+	ErrUserScreeningBlocked
+	ErrScreeningHitNotFound
+	ErrScreeningHitNotPending
+	ErrScreeningListInvalid
 )
 
 type BankSystemError struct {
@@ -26,6 +87,19 @@ func (e *BankSystemError) Error() string {
 	return e.message
 }
 
+func (e *BankSystemError) Code() int {
+	return e.code
+}
+
+// IsBankSystemError reports whether err is a BankSystemError with the given code.
+func IsBankSystemError(err error, code int) bool {
+	var bsErr *BankSystemError
+	if !errors.As(err, &bsErr) {
+		return false
+	}
+	return bsErr.code == code
+}
+
 func NewBankSystemError(code int, opts ...string) *BankSystemError {
 	message := GetErrorMessage(code, opts...)
 	return &BankSystemError{code: code, message: message}
@@ -43,10 +117,106 @@ func GetErrorMessage(code int, opts ...string) string {
 		return fmt.Sprintf("invalid amount: %v", opts)
 	case ErrEmailExists:
 		return fmt.Sprintf("email already exists: %v", opts)
+	case ErrInvalidCredentials:
+		return "invalid email or password"
+	case ErrOTPRequired:
+		return "two-factor authentication code required"
+	case ErrInvalidOTP:
+		return fmt.Sprintf("invalid two-factor authentication code: %v", opts)
+	case ErrTOTPNotEnabled:
+		return fmt.Sprintf("two-factor authentication is not enabled: %v", opts)
+	case ErrTOTPAlreadyEnabled:
+		return "two-factor authentication is already enabled"
+	case ErrTOTPNotConfigured:
+		return "two-factor authentication is not configured on this server"
+	case ErrLoginLocked:
+		return fmt.Sprintf("too many failed login attempts, try again in %v", opts)
+	case ErrSecurityUnavailable:
+		return fmt.Sprintf("security checks unavailable, try again later: %v", opts)
+	case ErrUserNotFound:
+		return fmt.Sprintf("user not found: %v", opts)
 	case ErrInsufficientBalance:
 		return fmt.Sprintf("insufficient balance: %v", opts)
 	case ErrAccountNotFound:
 		return fmt.Sprintf("account not found: %v", opts)
+	case ErrAccountNotActive:
+		return fmt.Sprintf("account not active: %v", opts)
+	case ErrSameAccountTransfer:
+		return fmt.Sprintf("cannot transfer to the same account: %v", opts)
+	case ErrHoldNotFound:
+		return fmt.Sprintf("hold not found: %v", opts)
+	case ErrHoldNotActive:
+		return fmt.Sprintf("hold is not active: %v", opts)
+	case ErrInvalidCaptureAmount:
+		return fmt.Sprintf("capture amount exceeds the hold: %v", opts)
+	case ErrOverdraftLimitInUse:
+		return fmt.Sprintf("overdraft limit is below the amount in use: %v", opts)
+	case ErrCurrencyMismatch:
+		return fmt.Sprintf("currencies do not match: %v", opts)
+	case ErrQuoteNotFound:
+		return fmt.Sprintf("quote not found: %v", opts)
+	case ErrQuoteExpired:
+		return fmt.Sprintf("quote expired or already used: %v", opts)
+	case ErrRateUnavailable:
+		return fmt.Sprintf("no exchange rate available: %v", opts)
+	case ErrCurrencyNotFound:
+		return fmt.Sprintf("currency not found: %v", opts)
+	case ErrCurrencyExists:
+		return fmt.Sprintf("currency already exists: %v", opts)
+	case ErrCurrencyInUse:
+		return fmt.Sprintf("minor units of a currency with accounts cannot change: %v", opts)
+	case ErrStandingOrderNotFound:
+		return fmt.Sprintf("standing order not found: %v", opts)
+	case ErrStandingOrderStatus:
+		return fmt.Sprintf("standing order cannot change from its status: %v", opts)
+	case ErrPayeeNotFound:
+		return fmt.Sprintf("payee not found: %v", opts)
+	case ErrPayeeExists:
+		return fmt.Sprintf("payee already exists: %v", opts)
+	case ErrPayeeCoolingOff:
+		return fmt.Sprintf("payee is new, larger transfers are allowed after it is verified or from %v", opts)
+	case ErrPayeeRequired:
+		return fmt.Sprintf("larger transfers to accounts of other users must go to a payee: %v", opts)
+	case ErrStatementNotFound:
+		return fmt.Sprintf("statement not found: %v", opts)
+	case ErrBulkPaymentNotFound:
+		return fmt.Sprintf("bulk payment not found: %v", opts)
+	case ErrBulkPaymentExists:
+		return fmt.Sprintf("bulk payment file was already uploaded: %v", opts)
+	case ErrWebhookNotFound:
+		return fmt.Sprintf("webhook not found: %v", opts)
+	case ErrWebhookDeliveryNotFound:
+		return fmt.Sprintf("webhook delivery not found: %v", opts)
+	case ErrTransactionBlocked:
+		return fmt.Sprintf("transaction blocked by risk checks, decision %v", opts)
+	case ErrTransactionHeld:
+		return fmt.Sprintf("transaction held for review by risk checks, decision %v", opts)
+	case ErrTransactionRejected:
+		return fmt.Sprintf("transaction rejected in review, decision %v", opts)
+	case ErrRiskDecisionNotFound:
+		return fmt.Sprintf("risk decision not found: %v", opts)
+	case ErrRiskDecisionNotPending:
+		return fmt.Sprintf("risk decision is not pending review: %v", opts)
+	case ErrLimitExceeded:
+		return fmt.Sprintf("transaction limit exceeded: %v", opts)
+	case ErrLimitProfileNotFound:
+		return fmt.Sprintf("limit profile not found: %v", opts)
+	case ErrLimitProfileExists:
+		return fmt.Sprintf("limit profile already exists: %v", opts)
+	case ErrAMLCaseNotFound:
+		return fmt.Sprintf("aml case not found: %v", opts)
+	case ErrAMLCaseClosed:
+		return fmt.Sprintf("aml case is closed: %v", opts)
+	case ErrAMLReportNotFound:
+		return fmt.Sprintf("aml report not found: %v", opts)
+	case ErrUserScreeningBlocked:
+		return fmt.Sprintf("user refused by sanctions screening, hit %v", opts)
+	case ErrScreeningHitNotFound:
+		return fmt.Sprintf("screening hit not found: %v", opts)
+	case ErrScreeningHitNotPending:
+		return fmt.Sprintf("screening hit is not pending review: %v", opts)
+	case ErrScreeningListInvalid:
+		return fmt.Sprintf("invalid sanctions list: %v", opts)
 	default:
 		return "unknown error"
 	}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSession = errors.New("invalid or expired session token")
+
+// NewSessionToken signs a token that authenticates userID until expiresAt,
+// "<user id>.<expiry, unix seconds>.<HMAC-SHA256 of both>".
+func NewSessionToken(key []byte, userID int64, expiresAt time.Time) string {
+	payload := strconv.FormatInt(userID, 10) + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	return payload + "." + sessionMAC(key, payload)
+}
+
+// ParseSessionToken returns the user of a token NewSessionToken signed with
+// key, unless it expired at now.
+func ParseSessionToken(key []byte, token string, now time.Time) (int64, error) {
+	dot := strings.LastIndexByte(token, '.')
+	if dot < 0 || len(key) == 0 {
+		return 0, ErrInvalidSession
+	}
+	payload, mac := token[:dot], token[dot+1:]
+	if !hmac.Equal([]byte(mac), []byte(sessionMAC(key, payload))) {
+		return 0, ErrInvalidSession
+	}
+
+	userPart, expiryPart, ok := strings.Cut(payload, ".")
+	if !ok {
+		return 0, ErrInvalidSession
+	}
+	userID, err := strconv.ParseInt(userPart, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidSession
+	}
+	expiry, err := strconv.ParseInt(expiryPart, 10, 64)
+	if err != nil || !now.Before(time.Unix(expiry, 0)) {
+		return 0, ErrInvalidSession
+	}
+	return userID, nil
+}
+
+func sessionMAC(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+type userIDKey struct{}
+
+// WithUserID marks ctx as authenticated as the user.
+func WithUserID(ctx context.Context, userID int64) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// UserIDFrom returns the authenticated user of ctx, false when it has none.
+func UserIDFrom(ctx context.Context) (int64, bool) {
+	userID, ok := ctx.Value(userIDKey{}).(int64)
+	return userID, ok
+}
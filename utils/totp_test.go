@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of RFC 6238 Appendix B, "12345678901234567890",
+// in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestTOTPCodeRFC6238 checks the SHA-1 vectors of RFC 6238 Appendix B, cut to
+// their last TOTP_DIGITS digits.
+func TestTOTPCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(rfcSecret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tt.code[len(tt.code)-TOTP_DIGITS:]; got != want {
+			t.Errorf("TOTPCode at %d = %s, want %s", tt.unix, got, want)
+		}
+	}
+}
+
+func TestTOTPCodeSecretFormat(t *testing.T) {
+	want, err := TOTPCode(rfcSecret, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := TOTPCode(" gezdgnbvgy3tqojqgezdgnbvgy3tqojq ", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("lower case secret gives %s, want %s", got, want)
+	}
+	if _, err := TOTPCode("not base32!", 1); err == nil {
+		t.Error("TOTPCode accepted a secret that is not base32")
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := TOTPStep(now)
+
+	tests := []struct {
+		name     string
+		offset   int64
+		lastStep int64
+		ok       bool
+	}{
+		{"current step", 0, 0, true},
+		{"previous step", -1, 0, true},
+		{"next step", 1, 0, true},
+		{"two steps behind", -2, 0, false},
+		{"two steps ahead", 2, 0, false},
+		{"step used already", 0, current, false},
+		{"earlier step than the used one", -1, current - 1, false},
+		{"later step than the used one", 1, current, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := TOTPCode(rfcSecret, current+tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			step, ok := ValidateTOTP(rfcSecret, code, now, tt.lastStep)
+			if ok != tt.ok {
+				t.Fatalf("ValidateTOTP = %v, want %v", ok, tt.ok)
+			}
+			if ok && step != current+tt.offset {
+				t.Errorf("matched step %d, want %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPSkewAtStepBoundary(t *testing.T) {
+	// The last second of a step and the first of the next one both accept
+	// the code of either.
+	end := time.Unix(59, 0)
+	code, err := TOTPCode(rfcSecret, TOTPStep(end))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, at := range []time.Time{end, end.Add(time.Second), end.Add(TOTP_PERIOD)} {
+		if _, ok := ValidateTOTP(rfcSecret, code, at, 0); !ok {
+			t.Errorf("code of %v refused at %v", end, at)
+		}
+	}
+	if _, ok := ValidateTOTP(rfcSecret, code, end.Add(2*TOTP_PERIOD), 0); ok {
+		t.Error("code accepted two steps later")
+	}
+}
+
+func TestValidateTOTPMalformed(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, err := TOTPCode(rfcSecret, TOTPStep(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, given := range []string{"", code[:TOTP_DIGITS-1], code + "0", "abcdef"} {
+		if _, ok := ValidateTOTP(rfcSecret, given, now, 0); ok {
+			t.Errorf("ValidateTOTP accepted %q", given)
+		}
+	}
+	if _, ok := ValidateTOTP(rfcSecret, " "+code+" ", now, 0); !ok {
+		t.Error("ValidateTOTP refused a code with surrounding spaces")
+	}
+}
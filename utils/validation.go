@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	USERNAME_MIN_LENGTH = 3
+	USERNAME_MAX_LENGTH = 20 // "BK_User".username VARCHAR(20)
+	EMAIL_MAX_LENGTH    = 256
+	PASSWORD_MIN_LENGTH = 8
+	PASSWORD_MAX_BYTES  = 72 // bcrypt ignores everything after 72 bytes
+	DETAIL_MAX_LENGTH   = 256
+	MAX_AMOUNT          = 1e18 // NUMERIC(22, 4)
+	DEFAULT_MINOR_UNITS = 2
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every invalid field of a request.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Field+": "+f.Message)
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+// Err returns nil when no field failed, so callers can return it directly.
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func IsValidationError(err error) bool {
+	var verr *ValidationError
+	return errors.As(err, &verr)
+}
+
+// ErrorResponse builds the JSON body returned by the controllers, adding the
+// field errors when err is a validation failure.
+func ErrorResponse(err error) map[string]any {
+	body := map[string]any{"error": err.Error()}
+
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		body["error"] = "validation failed"
+		body["fields"] = verr.Fields
+	}
+	return body
+}
+
+// BindingError converts errors from gin's ShouldBind* into a ValidationError.
+func BindingError(err error) error {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return &ValidationError{Fields: []FieldError{{Field: "body", Message: err.Error()}}}
+	}
+
+	result := &ValidationError{}
+	for _, fe := range verrs {
+		switch fe.Tag() {
+		case "required":
+			result.Add(fe.Field(), "is required")
+		default:
+			result.Add(fe.Field(), fmt.Sprintf("failed on %q", fe.Tag()))
+		}
+	}
+	return result
+}
+
+// UseJSONFieldNames makes binding errors report the json name of a field.
+func UseJSONFieldNames() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "" || name == "-" {
+			return field.Name
+		}
+		return name
+	})
+}
+
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func ValidateEmail(verr *ValidationError, email string) {
+	if email == "" {
+		verr.Add("email", "is required")
+		return
+	}
+	if len(email) > EMAIL_MAX_LENGTH {
+		verr.Add("email", fmt.Sprintf("must be at most %d characters", EMAIL_MAX_LENGTH))
+		return
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		verr.Add("email", "is not a valid email address")
+		return
+	}
+
+	domain := email[strings.LastIndex(email, "@")+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		verr.Add("email", "is not a valid email address")
+	}
+}
+
+func ValidateUsername(verr *ValidationError, username string) {
+	n := len([]rune(username))
+	if n < USERNAME_MIN_LENGTH || n > USERNAME_MAX_LENGTH {
+		verr.Add("username", fmt.Sprintf("must be between %d and %d characters", USERNAME_MIN_LENGTH, USERNAME_MAX_LENGTH))
+		return
+	}
+	if !usernamePattern.MatchString(username) {
+		verr.Add("username", "may only contain letters, digits, '_', '.' and '-'")
+	}
+}
+
+func ValidatePassword(verr *ValidationError, password string) {
+	if len([]rune(password)) < PASSWORD_MIN_LENGTH {
+		verr.Add("password", fmt.Sprintf("must be at least %d characters", PASSWORD_MIN_LENGTH))
+		return
+	}
+	if len(password) > PASSWORD_MAX_BYTES {
+		verr.Add("password", fmt.Sprintf("must be at most %d bytes", PASSWORD_MAX_BYTES))
+		return
+	}
+
+	var upper, lower, digit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	if !upper || !lower || !digit {
+		verr.Add("password", "must contain an upper-case letter, a lower-case letter and a digit")
+	}
+}
+
+// ValidateAmount checks that amount is positive and has no more decimals than
+// the currency allows. An unknown currency falls back to DEFAULT_MINOR_UNITS.
+func ValidateAmount(verr *ValidationError, amount float64, currency string) {
+	if math.IsNaN(amount) || math.IsInf(amount, 0) || amount <= 0 {
+		verr.Add("amount", "must be a positive number")
+		return
+	}
+	if amount >= MAX_AMOUNT {
+		verr.Add("amount", "is too large")
+		return
+	}
+
+	units := DEFAULT_MINOR_UNITS
+	if info, ok := LookupCurrency(currency); ok {
+		units = info.MinorUnits
+	}
+	scaled := amount * math.Pow10(units)
+	if math.Abs(scaled-math.Round(scaled)) > 1e-6 {
+		verr.Add("amount", fmt.Sprintf("must have at most %d decimal places", units))
+	}
+}
+
+func ValidateDetail(verr *ValidationError, detail string) {
+	if len([]rune(detail)) > DETAIL_MAX_LENGTH {
+		verr.Add("detail", fmt.Sprintf("must be at most %d characters", DETAIL_MAX_LENGTH))
+	}
+}
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// withCurrencies replaces the catalogue for the duration of the test.
+func withCurrencies(t *testing.T, byCode map[string]CurrencyInfo) {
+	currencies.RLock()
+	saved := currencies.byCode
+	currencies.RUnlock()
+	SetCurrencies(byCode)
+	t.Cleanup(func() { SetCurrencies(saved) })
+}
+
+func fields(verr *ValidationError) []string {
+	var names []string
+	for _, f := range verr.Fields {
+		names = append(names, f.Field)
+	}
+	return names
+}
+
+func TestValidateEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		ok    bool
+	}{
+		{"alice@example.com", true},
+		{"alice.smith+bank@mail.example.co.uk", true},
+		{"", false},
+		{"alice", false},
+		{"alice@", false},
+		{"@example.com", false},
+		{"alice@localhost", false},
+		{"alice@.example.com", false},
+		{"alice@example.com.", false},
+		{"Alice <alice@example.com>", false},
+		{"alice@example.com, bob@example.com", false},
+		{strings.Repeat("a", EMAIL_MAX_LENGTH) + "@example.com", false},
+	}
+	for _, tt := range tests {
+		verr := &ValidationError{}
+		ValidateEmail(verr, tt.email)
+		if ok := verr.Err() == nil; ok != tt.ok {
+			t.Errorf("ValidateEmail(%q) ok = %v, want %v: %v", tt.email, ok, tt.ok, verr.Fields)
+		}
+	}
+}
+
+func TestValidateUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		ok       bool
+	}{
+		{"bob", true},
+		{"bob_smith.jr-2", true},
+		{strings.Repeat("a", USERNAME_MAX_LENGTH), true},
+		{"bo", false},
+		{strings.Repeat("a", USERNAME_MAX_LENGTH+1), false},
+		{"bob smith", false},
+		{"bob@home", false},
+		{"bjørn", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		verr := &ValidationError{}
+		ValidateUsername(verr, tt.username)
+		if ok := verr.Err() == nil; ok != tt.ok {
+			t.Errorf("ValidateUsername(%q) ok = %v, want %v", tt.username, ok, tt.ok)
+		}
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		ok       bool
+	}{
+		{"strong", "Password123", true},
+		{"minimum length", "Passwor1", true},
+		{"non-ASCII letters count", "Pässwörd1", true},
+		{"too short", "Pass12", false},
+		{"no upper-case letter", "password123", false},
+		{"no lower-case letter", "PASSWORD123", false},
+		{"no digit", "PasswordABC", false},
+		{"at the bcrypt limit", "Aa1" + strings.Repeat("x", PASSWORD_MAX_BYTES-3), true},
+		{"over the bcrypt limit", "Aa1" + strings.Repeat("x", PASSWORD_MAX_BYTES-2), false},
+		{"over the bcrypt limit in bytes only", "Aa1" + strings.Repeat("é", PASSWORD_MAX_BYTES/2), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verr := &ValidationError{}
+			ValidatePassword(verr, tt.password)
+			if ok := verr.Err() == nil; ok != tt.ok {
+				t.Errorf("ValidatePassword ok = %v, want %v: %v", ok, tt.ok, verr.Fields)
+			}
+		})
+	}
+}
+
+func TestValidateAmount(t *testing.T) {
+	withCurrencies(t, map[string]CurrencyInfo{
+		"USD": {MinorUnits: 2, Enabled: true},
+		"KWD": {MinorUnits: 3, Enabled: true},
+		"JPY": {MinorUnits: 0, Enabled: true},
+	})
+
+	tests := []struct {
+		amount   float64
+		currency string
+		ok       bool
+	}{
+		{0.01, "USD", true},
+		{19.99, "USD", true},
+		{0.1 + 0.2, "USD", true},
+		{1.005, "USD", false},
+		{1.005, "KWD", true},
+		{1.0005, "KWD", false},
+		{100, "JPY", true},
+		{100.5, "JPY", false},
+		{1.23, "XXX", true},
+		{1.234, "XXX", false},
+		{0, "USD", false},
+		{-1, "USD", false},
+		{math.NaN(), "USD", false},
+		{math.Inf(1), "USD", false},
+		{MAX_AMOUNT, "USD", false},
+	}
+	for _, tt := range tests {
+		verr := &ValidationError{}
+		ValidateAmount(verr, tt.amount, tt.currency)
+		if ok := verr.Err() == nil; ok != tt.ok {
+			t.Errorf("ValidateAmount(%v, %s) ok = %v, want %v: %v", tt.amount, tt.currency, ok, tt.ok, verr.Fields)
+		}
+	}
+}
+
+func TestValidateDetail(t *testing.T) {
+	verr := &ValidationError{}
+	ValidateDetail(verr, strings.Repeat("é", DETAIL_MAX_LENGTH))
+	if err := verr.Err(); err != nil {
+		t.Errorf("detail of %d characters refused: %v", DETAIL_MAX_LENGTH, err)
+	}
+	ValidateDetail(verr, strings.Repeat("a", DETAIL_MAX_LENGTH+1))
+	if got := fields(verr); len(got) != 1 || got[0] != "detail" {
+		t.Errorf("detail of %d characters: fields %v, want [detail]", DETAIL_MAX_LENGTH+1, got)
+	}
+}
+
+func TestValidationErrorCollectsFields(t *testing.T) {
+	verr := &ValidationError{}
+	if verr.Err() != nil {
+		t.Fatal("empty ValidationError is an error")
+	}
+	ValidateUsername(verr, "x")
+	ValidateEmail(verr, "nope")
+	ValidatePassword(verr, "short")
+
+	got := fields(verr)
+	if strings.Join(got, ",") != "username,email,password" {
+		t.Errorf("fields %v, want [username email password]", got)
+	}
+	if !IsValidationError(verr.Err()) {
+		t.Error("IsValidationError is false")
+	}
+	body := ErrorResponse(verr)
+	if body["error"] != "validation failed" || body["fields"] == nil {
+		t.Errorf("ErrorResponse = %v", body)
+	}
+}